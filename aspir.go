@@ -1,16 +1,107 @@
 package pir
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
 
 	"github.com/ncw/gmp"
 	"github.com/sachaservan/paillier"
 )
 
 /*
- Single-server AHE variant of ASPIR
+ Authenticated PIR (ASPIR).
+ This file holds the only ASPIR implementation of the package; both
+ variants authenticate a query against a key database aligned with the
+ database (see GenerateKeyDatabase) and share the auth token encoding.
+ Single-server AHE variant: the client generates a pair of doubly
+ encrypted queries, one real and one fake, and keeps the private state
+ (NewAuthenticatedQuery); the server answers both, challenges the client
+ (GenerateAuthChalForQuery), the client proves the challenge with its
+ state (AuthProve) and the server checks the proof (AuthCheck) before
+ releasing the answer. Secret shared variant: the client sends query
+ shares carrying auth token shares (NewAuthenticatedIndexQueryShares or
+ NewAuthenticatedKeywordQueryShares); each server computes an audit
+ share (GenerateAuditForSharedQuery) and the servers release their
+ answers only if the audit shares xor to zero (CheckAudit).
 */
 
+// DefaultStatisticalSecurityBytes is the default size (in bytes) of the auth keys
+// and the statistical security parameter of the proofs
+const DefaultStatisticalSecurityBytes = 8
+
+// KeyDBSizeFor returns the number of slots of the key database
+// associated with a data database with the provided metadata
+// (one auth key for each group of groupSize slots)
+func KeyDBSizeFor(dbmd *DBMetadata, groupSize int) int {
+	return ceilDiv(dbmd.DBSize, groupSize)
+}
+
+// KeyLookup maps the slots of a database to their auth keys
+// (e.g., to distribute keys to authorized clients)
+type KeyLookup struct {
+	GroupSize int
+	Keys      []*Slot // key of each group (the slots of the key database)
+}
+
+// KeyForGroup returns the auth key of the group (row) of the database
+func (kl *KeyLookup) KeyForGroup(group int) (*Slot, error) {
+
+	if group < 0 || group >= len(kl.Keys) {
+		return nil, errors.New("group out of range")
+	}
+
+	return kl.Keys[group], nil
+}
+
+// KeyForIndex returns the auth key of the group containing the slot at index
+func (kl *KeyLookup) KeyForIndex(index int) (*Slot, error) {
+
+	if index < 0 {
+		return nil, errors.New("index out of range")
+	}
+
+	return kl.KeyForGroup(index / kl.GroupSize)
+}
+
+// GenerateKeyDatabase generates a key database aligned with a database with the
+// provided metadata (one random non-zero key of keyBytes for each group of groupSize
+// slots) using randomness from rng (e.g., crypto/rand.Reader)
+func GenerateKeyDatabase(dbmd *DBMetadata, groupSize, keyBytes int, rng io.Reader) (*Database, *KeyLookup, error) {
+
+	if groupSize <= 0 || keyBytes <= 0 {
+		return nil, nil, errors.New("group size and key size must be positive")
+	}
+
+	keys := make([]*Slot, KeyDBSizeFor(dbmd, groupSize))
+	for i := range keys {
+		keys[i] = NewEmptySlot(keyBytes)
+
+		// an all-zero key would pass any audit
+		for isZeroSlot(keys[i]) {
+			if _, err := io.ReadFull(rng, keys[i].Data); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	keyDB := NewDatabase()
+	keyDB.Slots = keys
+	keyDB.SlotBytes = keyBytes
+	keyDB.DBSize = len(keys)
+
+	return keyDB, &KeyLookup{GroupSize: groupSize, Keys: keys}, nil
+}
+
+func isZeroSlot(slot *Slot) bool {
+	for _, b := range slot.Data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // AuthenticatedEncryptedQuery is a single-server encrypted query
 // attached with an authentication token that proves knowledge of a
 // secret associated with the retrieved item.
@@ -59,6 +150,66 @@ type ProofToken struct {
 	S         *gmp.Int
 }
 
+// ErrServerMisbehavior is matched (using errors.Is) by the error returned by
+// AuthProve when the challenge shows that the server deviated from the protocol.
+// The error is a *ServerMisbehaviorError carrying the evidence
+var ErrServerMisbehavior = errors.New("both tokens non-zero -- server likely cheating")
+
+// MisbehaviorEvidence is the evidence collected by the client when
+// detecting that the server cheated while issuing a challenge
+type MisbehaviorEvidence struct {
+	ChalToken  *ChalToken
+	AuthToken0 *paillier.Ciphertext
+	AuthToken1 *paillier.Ciphertext
+	Diff0      *gmp.Int // decryption of Token0 minus AuthToken0
+	Diff1      *gmp.Int // decryption of Token1 minus AuthToken1
+}
+
+// ServerMisbehaviorError is returned by AuthProve when misbehavior is detected
+type ServerMisbehaviorError struct {
+	Evidence *MisbehaviorEvidence
+}
+
+func (e *ServerMisbehaviorError) Error() string {
+	return ErrServerMisbehavior.Error()
+}
+
+// Is reports whether target is ErrServerMisbehavior
+func (e *ServerMisbehaviorError) Is(target error) bool {
+	return target == ErrServerMisbehavior
+}
+
+// exportedEvidence is the serialization format of MisbehaviorEvidence
+// (big integers are encoded as base 10 strings)
+type exportedEvidence struct {
+	Token0     string
+	Token1     string
+	SecParam   int
+	AuthToken0 string
+	AuthToken1 string
+	Diff0      string
+	Diff1      string
+}
+
+// Export serializes the evidence (as JSON) for out-of-band reporting.
+// The evidence reveals the client's auth tokens but not the secret key
+func (ev *MisbehaviorEvidence) Export() ([]byte, error) {
+
+	if ev.ChalToken == nil || ev.AuthToken0 == nil || ev.AuthToken1 == nil {
+		return nil, errors.New("incomplete misbehavior evidence")
+	}
+
+	return json.Marshal(&exportedEvidence{
+		Token0:     ev.ChalToken.Token0.C.String(),
+		Token1:     ev.ChalToken.Token1.C.String(),
+		SecParam:   ev.ChalToken.SecParam,
+		AuthToken0: ev.AuthToken0.C.String(),
+		AuthToken1: ev.AuthToken1.C.String(),
+		Diff0:      ev.Diff0.String(),
+		Diff1:      ev.Diff1.String(),
+	})
+}
+
 // GenerateAuthChalForQuery generates a challenge token for the provided PIR query
 func GenerateAuthChalForQuery(
 	secparam int,
@@ -75,6 +226,12 @@ func GenerateAuthChalForQuery(
 	query.Query1.Row.DBWidth /= groupSize
 	query.Query0.Row.DBWidth /= groupSize
 
+	// the layout fingerprints are for the database and not the key database
+	fingerprint0 := query.Query0.Row.LayoutFingerprint
+	fingerprint1 := query.Query1.Row.LayoutFingerprint
+	query.Query0.Row.LayoutFingerprint = LayoutFingerprint{}
+	query.Query1.Row.LayoutFingerprint = LayoutFingerprint{}
+
 	// get the row for query0
 	rowQueryRes0, err := keyDB.PrivateEncryptedQuery(query.Query0.Row, nprocs)
 	if err != nil {
@@ -103,12 +260,15 @@ func GenerateAuthChalForQuery(
 	query.Query1.Col.GroupSize = groupSize
 	query.Query0.Row.DBWidth *= groupSize
 	query.Query1.Row.DBWidth *= groupSize
+	query.Query0.Row.LayoutFingerprint = fingerprint0
+	query.Query1.Row.LayoutFingerprint = fingerprint1
 
 	return &ChalToken{res0.Slots[0].Cts[0], res1.Slots[0].Cts[0], secparam}, nil
 }
 
 // AuthProve proves that challenge token is correct (a nested encryption of zero)
-// bit indicate which query (query0 or query1) is the real query
+// bit indicate which query (query0 or query1) is the real query.
+// Returns a *ServerMisbehaviorError if neither token is correct
 func AuthProve(state *AuthQueryPrivateState, chalToken *ChalToken) (*ProofToken, error) {
 
 	sk := state.Sk
@@ -122,7 +282,15 @@ func AuthProve(state *AuthQueryPrivateState, chalToken *ChalToken) (*ProofToken,
 	decTok1 := sk.NestedDecrypt(token1)
 
 	if decTok0.Cmp(zero) != 0 && decTok1.Cmp(zero) != 0 {
-		return nil, errors.New("both tokens non-zero -- server likely cheating")
+		return nil, &ServerMisbehaviorError{
+			Evidence: &MisbehaviorEvidence{
+				ChalToken:  chalToken,
+				AuthToken0: state.AuthToken0,
+				AuthToken1: state.AuthToken1,
+				Diff0:      decTok0,
+				Diff1:      decTok1,
+			},
+		}
 	}
 
 	var chal *paillier.Ciphertext
@@ -242,16 +410,45 @@ func NewAuthTokenSharesForKey(authKey *Slot, numShares uint) []*AuthTokenShare {
 	return shares
 }
 
+// NewKeywordKeyDB constructs a key database for a keyword database where
+// authKeys[i] is the key for the row (group) with keywords[i].
+// The key database is keyed by the same keywords so that the audit binds
+// each key to its keyword rather than to a position.
+// Only the secret shared variant supports keywords (encrypted queries are index based)
+func NewKeywordKeyDB(keywords []uint, authKeys []*Slot) (*Database, error) {
+
+	if len(keywords) != len(authKeys) || len(authKeys) == 0 {
+		return nil, errors.New("need exactly one auth key per keyword")
+	}
+
+	keySize := len(authKeys[0].Data)
+	for _, key := range authKeys {
+		if len(key.Data) != keySize {
+			return nil, errors.New("auth keys must all have the same size")
+		}
+	}
+
+	keyDB := NewDatabase()
+	keyDB.Slots = authKeys
+	keyDB.SlotBytes = keySize
+	keyDB.DBSize = len(authKeys)
+	keyDB.SetKeywords(keywords)
+
+	return keyDB, nil
+}
+
 // GenerateAuditForSharedQuery generates an audit share that is sent to the other server(s)
 func GenerateAuditForSharedQuery(
 	keyDB *Database,
 	query *AuthenticatedQueryShare,
 	nprocs int) (*AuditTokenShare, error) {
 
-	oldGroupSize := query.GroupSize
-	query.GroupSize = 1 // key database has group size 1
-	bits := keyDB.ExpandSharedQuery(query.QueryShare, nprocs)
-	query.GroupSize = oldGroupSize
+	keyQuery, err := keyDBQueryShare(keyDB, query)
+	if err != nil {
+		return nil, err
+	}
+
+	bits := keyDB.ExpandSharedQuery(keyQuery, nprocs)
 
 	return GenerateAuditForSharedQueryWithExpandedBits(keyDB, query, bits, nprocs)
 }
@@ -264,7 +461,12 @@ func GenerateAuditForSharedQueryWithExpandedBits(
 	bits []bool,
 	nprocs int) (*AuditTokenShare, error) {
 
-	res, err := keyDB.PrivateSecretSharedQueryWithExpandedBits(query.QueryShare, bits, nprocs)
+	keyQuery, err := keyDBQueryShare(keyDB, query)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := keyDB.PrivateSecretSharedQueryWithExpandedBits(keyQuery, bits, nprocs)
 	if err != nil {
 		return nil, err
 	}
@@ -278,6 +480,21 @@ func GenerateAuditForSharedQueryWithExpandedBits(
 	return &AuditTokenShare{keySlotShare}, nil
 }
 
+// keyDBQueryShare returns a copy of the query share to be evaluated on the key database
+// which has group size 1 (one key per group of the database)
+func keyDBQueryShare(keyDB *Database, query *AuthenticatedQueryShare) (*QueryShare, error) {
+
+	if query.IsKeywordBased && len(keyDB.Keywords) < keyDB.DBSize {
+		return nil, errors.New("key database is not keyed by keywords")
+	}
+
+	keyQuery := *query.QueryShare
+	keyQuery.GroupSize = 1
+	keyQuery.LayoutFingerprint = LayoutFingerprint{} // fingerprint is for the database
+
+	return &keyQuery, nil
+}
+
 // CheckAudit outputs True of all provided audit tokens xor to zero
 func CheckAudit(auditTokens ...*AuditTokenShare) bool {
 
@@ -287,9 +504,5 @@ func CheckAudit(auditTokens ...*AuditTokenShare) bool {
 	}
 
 	// make sure the resulting slot is all zero
-	if ints, _, _ := res.ToGmpIntArray(1); ints[0].Cmp(gmp.NewInt(0)) != 0 {
-		return false
-	}
-
-	return true
+	return res.EqualConstantTime(NewEmptySlot(len(res.Data)))
 }
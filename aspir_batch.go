@@ -0,0 +1,137 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+ Batch verification of secret shared ASPIR audits.
+ An audit passes if its audit token shares XOR to zero. To verify many
+ audits at once, the shares are combined with random coefficients in
+ GF(2^64): multiplying by a field element is linear over XOR, so the
+ combination of the shares of every server XORs to the combination of
+ the audit results, which is zero if all the audits pass and is zero
+ with probability 2^-64 (per 8-byte chunk) otherwise.
+ Each server can combine its own shares locally (the coefficients are
+ derived from a common seed chosen once the queries are fixed) and send
+ a single token to the audit server, which then runs one CheckAudit
+ regardless of the number of audits.
+*/
+
+// auditBatchCoefficientsContext is hashed with the seed when deriving coefficients
+const auditBatchCoefficientsContext = "pir-audit-batch-v1"
+
+// AuditBatchCoefficients derives n non-zero coefficients in GF(2^64) from the seed.
+// The seed must be chosen after the audit tokens are fixed (e.g., by the audit server)
+func AuditBatchCoefficients(seed []byte, n int) []uint64 {
+
+	coeffs := make([]uint64, 0, n)
+
+	var block [sha256.Size]byte
+	for counter := uint64(0); len(coeffs) < n; counter++ {
+		h := sha256.New()
+		h.Write([]byte(auditBatchCoefficientsContext))
+		h.Write(binary.BigEndian.AppendUint64(nil, counter))
+		h.Write(seed)
+		h.Sum(block[:0])
+
+		for i := 0; i+8 <= len(block) && len(coeffs) < n; i += 8 {
+			if c := binary.BigEndian.Uint64(block[i:]); c != 0 {
+				coeffs = append(coeffs, c)
+			}
+		}
+	}
+
+	return coeffs
+}
+
+// CombineAuditTokens combines the audit token shares held by one server (one per audit)
+// using the coefficients (see AuditBatchCoefficients). The combined shares of all
+// the servers pass CheckAudit if and only if (with overwhelming probability) every audit passes
+func CombineAuditTokens(coeffs []uint64, tokens []*AuditTokenShare) (*AuditTokenShare, error) {
+
+	if len(tokens) == 0 || len(coeffs) != len(tokens) {
+		return nil, errors.New("need exactly one coefficient per audit token")
+	}
+
+	numBytes := len(tokens[0].T.Data)
+	numChunks := (numBytes + 7) / 8
+	combined := make([]uint64, numChunks)
+
+	for i, tok := range tokens {
+		if len(tok.T.Data) != numBytes {
+			return nil, errors.New("audit tokens must all have the same size")
+		}
+
+		for c := range combined {
+			combined[c] ^= gf64Mul(coeffs[i], auditTokenChunk(tok.T.Data, c))
+		}
+	}
+
+	res := NewEmptySlot(8 * numChunks)
+	for c, v := range combined {
+		binary.BigEndian.PutUint64(res.Data[8*c:], v)
+	}
+
+	return &AuditTokenShare{res}, nil
+}
+
+// CheckAuditBatch outputs True if all the audits pass. audits[i] contains the audit
+// token shares of audit i (one per server, in the same order for every audit)
+func CheckAuditBatch(seed []byte, audits [][]*AuditTokenShare) bool {
+
+	if len(audits) == 0 {
+		return true
+	}
+
+	numServers := len(audits[0])
+	coeffs := AuditBatchCoefficients(seed, len(audits))
+	combined := make([]*AuditTokenShare, numServers)
+
+	for s := 0; s < numServers; s++ {
+		tokens := make([]*AuditTokenShare, len(audits))
+		for i, audit := range audits {
+			if len(audit) != numServers {
+				return false
+			}
+			tokens[i] = audit[s]
+		}
+
+		var err error
+		if combined[s], err = CombineAuditTokens(coeffs, tokens); err != nil {
+			return false
+		}
+	}
+
+	return CheckAudit(combined...)
+}
+
+// auditTokenChunk returns the c-th 8-byte chunk of the token (zero padded)
+func auditTokenChunk(data []byte, c int) uint64 {
+
+	var chunk [8]byte
+	copy(chunk[:], data[8*c:])
+
+	return binary.BigEndian.Uint64(chunk[:])
+}
+
+// gf64Mul multiplies a and b in GF(2^64) = GF(2)[x]/(x^64 + x^4 + x^3 + x + 1)
+func gf64Mul(a, b uint64) uint64 {
+
+	var res uint64
+	for b != 0 {
+		if b&1 == 1 {
+			res ^= a
+		}
+		b >>= 1
+
+		// multiply a by x
+		carry := a >> 63
+		a <<= 1
+		a ^= carry * 0x1b
+	}
+
+	return res
+}
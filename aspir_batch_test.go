@@ -0,0 +1,67 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestSharedASPIRBatchAudit' to see log outputs.
+func TestSharedASPIRBatchAudit(t *testing.T) {
+	setup()
+
+	keydb := GenerateRandomDB(TestDBSize, StatisticalSecurityBytes)
+	seed := []byte("audit batch seed")
+
+	numAudits := 20
+	audits := make([][]*AuditTokenShare, numAudits)
+	for i := range audits {
+		index := rand.Intn(TestDBSize)
+		queryShares := keydb.NewAuthenticatedIndexQueryShares(index, keydb.Slots[index], 1, 2)
+
+		audits[i] = make([]*AuditTokenShare, 2)
+		for s := range audits[i] {
+			var err error
+			if audits[i][s], err = GenerateAuditForSharedQuery(keydb, queryShares[s], 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if !CheckAuditBatch(seed, audits) {
+		t.Fatalf("Batch audit failed")
+	}
+
+	// a single audit with a false auth key fails the batch
+	bad := rand.Intn(numAudits)
+	index := rand.Intn(TestDBSize-1) + 1
+	queryShares := keydb.NewAuthenticatedIndexQueryShares(index, keydb.Slots[0], 1, 2)
+	for s := range audits[bad] {
+		audits[bad][s], _ = GenerateAuditForSharedQuery(keydb, queryShares[s], 1)
+	}
+
+	if CheckAuditBatch(seed, audits) {
+		t.Fatalf("Batch audit succeeded with a false auth key")
+	}
+
+	// shares are combined locally by each server
+	coeffs := AuditBatchCoefficients(seed, numAudits)
+	if _, err := CombineAuditTokens(coeffs[1:], audits[0]); err == nil {
+		t.Fatalf("Combined audit tokens with missing coefficients")
+	}
+}
+
+func TestGF64Mul(t *testing.T) {
+
+	for i := 0; i < 100; i++ {
+		a, b, c := rand.Uint64(), rand.Uint64(), rand.Uint64()
+
+		// multiplication distributes over xor (which makes combining shares possible)
+		if gf64Mul(a, b^c) != gf64Mul(a, b)^gf64Mul(a, c) {
+			t.Fatalf("Multiplication does not distribute over xor")
+		}
+
+		if gf64Mul(a, b) != gf64Mul(b, a) || gf64Mul(a, 1) != a {
+			t.Fatalf("Multiplication is incorrect")
+		}
+	}
+}
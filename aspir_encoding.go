@@ -0,0 +1,214 @@
+package pir
+
+import (
+	"github.com/sachaservan/paillier"
+)
+
+// MarshalBinary encodes the challenge token
+func (chal *ChalToken) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagChalToken)
+	e.writeCiphertext(chal.Token0)
+	e.writeCiphertext(chal.Token1)
+	e.writeInt(int64(chal.SecParam))
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a challenge token encoded by MarshalBinary
+func (chal *ChalToken) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagChalToken)
+	token0 := d.readCiphertext()
+	token1 := d.readCiphertext()
+	secParam := d.readInt()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	chal.Token0, chal.Token1, chal.SecParam = token0, token1, int(secParam)
+
+	return nil
+}
+
+// MarshalBinary encodes the proof token (including the DDLEQ proof)
+func (proof *ProofToken) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagProofToken)
+	e.writeCiphertext(proof.AuthToken)
+	e.writeCiphertext(proof.T)
+	if err := e.writeFields(proof.P); err != nil {
+		return nil, err
+	}
+	e.writeInt(int64(proof.QBit))
+	e.writeBigInt(proof.R)
+	e.writeBigInt(proof.S)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a proof token encoded by MarshalBinary
+func (proof *ProofToken) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagProofToken)
+	res := &ProofToken{}
+	res.AuthToken = d.readCiphertext()
+	res.T = d.readCiphertext()
+	res.P = &paillier.DDLEQProof{}
+	if !d.readFields(res.P) {
+		res.P = nil
+	}
+	res.QBit = int(d.readInt())
+	res.R = d.readBigInt()
+	res.S = d.readBigInt()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*proof = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the audit token share
+func (share *AuditTokenShare) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagAuditTokenShare)
+	e.writeSlot(share.T)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an audit token share encoded by MarshalBinary
+func (share *AuditTokenShare) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagAuditTokenShare)
+	t := d.readSlot()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	share.T = t
+
+	return nil
+}
+
+// MarshalBinary encodes the auth token share
+func (share *AuthTokenShare) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagAuthTokenShare)
+	e.writeSlot(share.T)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an auth token share encoded by MarshalBinary
+func (share *AuthTokenShare) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagAuthTokenShare)
+	t := d.readSlot()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	share.T = t
+
+	return nil
+}
+
+// MarshalBinary encodes the authenticated query (both queries and commitments)
+func (query *AuthenticatedEncryptedQuery) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagAuthenticatedEncryptedQuery)
+	if err := e.writeMarshaler(query.Query0 != nil, query.Query0); err != nil {
+		return nil, err
+	}
+	if err := e.writeMarshaler(query.Query1 != nil, query.Query1); err != nil {
+		return nil, err
+	}
+	e.writeCommitment(query.AuthTokenComm0)
+	e.writeCommitment(query.AuthTokenComm1)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an authenticated query encoded by MarshalBinary
+func (query *AuthenticatedEncryptedQuery) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagAuthenticatedEncryptedQuery)
+	res := &AuthenticatedEncryptedQuery{}
+	if q := (&DoublyEncryptedQuery{}); d.readUnmarshaler(q) {
+		res.Query0 = q
+	}
+	if q := (&DoublyEncryptedQuery{}); d.readUnmarshaler(q) {
+		res.Query1 = q
+	}
+	res.AuthTokenComm0 = d.readCommitment()
+	res.AuthTokenComm1 = d.readCommitment()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*query = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the query share and the auth token share.
+// Defined explicitly since the method promoted from the embedded
+// QueryShare would drop the auth token share
+func (share *AuthenticatedQueryShare) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagAuthenticatedQueryShare)
+	if err := e.writeMarshaler(share.QueryShare != nil, share.QueryShare); err != nil {
+		return nil, err
+	}
+	if err := e.writeMarshaler(share.AuthToken != nil, share.AuthToken); err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an authenticated query share encoded by MarshalBinary
+func (share *AuthenticatedQueryShare) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagAuthenticatedQueryShare)
+	res := &AuthenticatedQueryShare{}
+	if q := (&QueryShare{}); d.readUnmarshaler(q) {
+		res.QueryShare = q
+	}
+	if t := (&AuthTokenShare{}); d.readUnmarshaler(t) {
+		res.AuthToken = t
+	}
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*share = *res
+
+	return nil
+}
+
+func (e *encoder) writeCommitment(comm *ROCommitment) {
+	if comm == nil {
+		e.writeByte(0)
+		return
+	}
+	e.writeByte(1)
+	e.writeBytes(comm.HashBytes)
+	e.writeBigInt(comm.R)
+}
+
+func (d *decoder) readCommitment() *ROCommitment {
+	if !d.readPresent() {
+		return nil
+	}
+	return &ROCommitment{HashBytes: d.readBytes(), R: d.readBigInt()}
+}
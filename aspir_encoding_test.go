@@ -0,0 +1,171 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestASPIREncoding' to see log outputs.
+func TestASPIREncoding(t *testing.T) {
+	setup()
+
+	secbytes := StatisticalSecurityBytes
+	sk, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, secbytes)
+	groupSize := 2
+
+	keydb := GenerateRandomDB(KeyDBSizeFor(&db.DBMetadata, groupSize), secbytes)
+	qIndex := rand.Intn(keydb.DBSize)
+	query, state := db.NewAuthenticatedQuery(sk, groupSize, qIndex, keydb.Slots[qIndex])
+
+	encodedQuery, err := query.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server issues the challenge for the decoded query
+	authQuery := &AuthenticatedEncryptedQuery{}
+	if err := authQuery.UnmarshalBinary(encodedQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	chalToken, err := GenerateAuthChalForQuery(secbytes, keydb, authQuery, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodedChal, err := chalToken.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedChal := &ChalToken{}
+	if err := decodedChal.UnmarshalBinary(encodedChal); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client proves using the decoded challenge
+	proofToken, err := AuthProve(state, decodedChal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encodedProof, err := proofToken.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedProof := &ProofToken{}
+	if err := decodedProof.UnmarshalBinary(encodedProof); err != nil {
+		t.Fatal(err)
+	}
+
+	if !AuthCheck(pk, authQuery, chalToken, decodedProof) {
+		t.Fatalf("ASPIR proof failed after decoding")
+	}
+
+	if decodedProof.QBit != proofToken.QBit || decodedProof.R.Cmp(proofToken.R) != 0 || decodedProof.S.Cmp(proofToken.S) != 0 {
+		t.Fatalf("Proof token not decoded. %v != %v\n", decodedProof, proofToken)
+	}
+
+	// nil and negative values round trip
+	proof := &ProofToken{QBit: 1, R: gmp.NewInt(-42)}
+	encoded, _ := proof.MarshalBinary()
+	decoded := &ProofToken{}
+	if err := decoded.UnmarshalBinary(encoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.P != nil || decoded.AuthToken != nil || decoded.S != nil || decoded.R.Cmp(gmp.NewInt(-42)) != 0 {
+		t.Fatalf("Proof token not decoded. %v != %v\n", decoded, proof)
+	}
+
+	// truncated bytes and bytes of another type are rejected
+	for i := 0; i < len(encodedProof); i++ {
+		if err := decoded.UnmarshalBinary(encodedProof[:i]); err != ErrInvalidEncoding {
+			t.Fatalf("Decoded a truncated proof token (%v bytes)\n", i)
+		}
+	}
+
+	if err := decodedChal.UnmarshalBinary(encodedProof); err != ErrInvalidEncoding {
+		t.Fatalf("Decoded a proof token as a challenge token")
+	}
+}
+
+// run with 'go test -v -run TestTokenShareEncoding' to see log outputs.
+func TestTokenShareEncoding(t *testing.T) {
+
+	for _, share := range NewAuthTokenSharesForKey(NewRandomSlot(StatisticalSecurityBytes), 3) {
+		encoded, err := share.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := &AuthTokenShare{}
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if !decoded.T.Equal(share.T) {
+			t.Fatalf("Auth token share not decoded. %v != %v\n", decoded.T, share.T)
+		}
+
+		audit := &AuditTokenShare{share.T}
+		encoded, err = audit.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decodedAudit := &AuditTokenShare{}
+		if err := decodedAudit.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if !decodedAudit.T.Equal(audit.T) {
+			t.Fatalf("Audit token share not decoded. %v != %v\n", decodedAudit.T, audit.T)
+		}
+
+		if err := decoded.UnmarshalBinary(encoded); err != ErrInvalidEncoding {
+			t.Fatalf("Decoded an audit token share as an auth token share")
+		}
+	}
+}
+
+// run with 'go test -v -run TestAuthenticatedQueryShareEncoding' to see log outputs.
+func TestAuthenticatedQueryShareEncoding(t *testing.T) {
+	setup()
+
+	keydb := GenerateRandomDB(TestDBSize, StatisticalSecurityBytes)
+	index := rand.Intn(TestDBSize)
+	shares := keydb.NewAuthenticatedIndexQueryShares(index, keydb.Slots[index], 1, 2)
+
+	audits := make([]*AuditTokenShare, len(shares))
+	for i, share := range shares {
+		encoded, err := share.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := &AuthenticatedQueryShare{}
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+
+		// the auth token share is not dropped by the embedded query share
+		if decoded.AuthToken == nil || !decoded.AuthToken.T.Equal(share.AuthToken.T) {
+			t.Fatalf("Auth token share not decoded")
+		}
+
+		audits[i], err = GenerateAuditForSharedQuery(keydb, decoded, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !CheckAudit(audits...) {
+		t.Fatalf("Secret shared ASPIR proof failed after decoding")
+	}
+}
@@ -1,10 +1,13 @@
 package pir
 
 import (
-	"math"
+	"bytes"
+	crand "crypto/rand"
+	"errors"
 	"math/rand"
 	"testing"
 
+	"github.com/ncw/gmp"
 	"github.com/sachaservan/paillier"
 )
 
@@ -21,7 +24,7 @@ func TestASPIR(t *testing.T) {
 
 		for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
 
-			keydbSize := int(math.Ceil(float64(TestDBSize / groupSize)))
+			keydbSize := KeyDBSizeFor(&db.DBMetadata, groupSize)
 			keydb := GenerateRandomDB(keydbSize, secbytes) // get secparam in bytes
 			qIndex := rand.Intn(keydb.DBSize)
 
@@ -56,6 +59,49 @@ func TestASPIR(t *testing.T) {
 	}
 }
 
+// run with 'go test -v -run TestASPIRServerMisbehavior' to see log outputs.
+func TestASPIRServerMisbehavior(t *testing.T) {
+	secbytes := StatisticalSecurityBytes
+
+	sk, pk := paillier.KeyGen(128)
+
+	keydb := GenerateRandomDB(TestDBSize, secbytes)
+	qIndex := rand.Intn(keydb.DBSize)
+
+	authQuery, state := keydb.NewAuthenticatedQuery(sk, 1, qIndex, keydb.Slots[qIndex])
+
+	chalToken, err := GenerateAuthChalForQuery(secbytes, keydb, authQuery, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// server replaces both tokens with a nested encryption of a random value
+	inner := pk.Encrypt(gmp.NewInt(rand.Int63n(1<<32) + 1))
+	chalToken.Token0 = pk.EncryptWithRAtLevel(inner.C, gmp.NewInt(1), paillier.EncLevelTwo)
+	chalToken.Token1 = pk.EncryptWithRAtLevel(inner.C, gmp.NewInt(1), paillier.EncLevelTwo)
+
+	_, err = AuthProve(state, chalToken)
+	if !errors.Is(err, ErrServerMisbehavior) {
+		t.Fatalf("Misbehavior not detected (err = %v)", err)
+	}
+
+	var misbehavior *ServerMisbehaviorError
+	if !errors.As(err, &misbehavior) {
+		t.Fatalf("Error does not carry misbehavior evidence")
+	}
+
+	if misbehavior.Evidence.ChalToken != chalToken {
+		t.Fatalf("Evidence does not contain the challenge")
+	}
+
+	exported, err := misbehavior.Evidence.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("evidence = %s\n", exported)
+}
+
 // run with 'go test -v -run TestSharedASPIRCompleteness' to see log outputs.
 func TestSharedASPIRCompleteness(t *testing.T) {
 
@@ -154,3 +200,119 @@ func BenchmarkProve(b *testing.B) {
 		}
 	}
 }
+
+// run with 'go test -v -run TestSharedASPIRKeywords' to see log outputs.
+func TestSharedASPIRKeywords(t *testing.T) {
+	setup()
+
+	secbytes := StatisticalSecurityBytes // statistical secuirity parameter for proof soundness
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize *= 2 {
+
+		db := GenerateRandomDB(TestDBSize, SlotBytes)
+		keywords := generateKeywords(TestDBSize / groupSize)
+		db.SetKeywords(keywords)
+
+		authKeys := GenerateRandomDB(len(keywords), secbytes).Slots
+		keydb, err := NewKeywordKeyDB(keywords, authKeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < NumQueries/10; i++ {
+			row := rand.Intn(len(keywords))
+			keyword := int(keywords[row])
+
+			queryShares := db.NewAuthenticatedKeywordQueryShares(keyword, authKeys[row], groupSize, 2)
+
+			audits := make([]*AuditTokenShare, 2)
+			results := make([]*SecretSharedQueryResult, 2)
+			for s := 0; s < 2; s++ {
+				// the DPF is expanded once and shared by the query and the audit
+				bits := db.ExpandSharedQuery(queryShares[s].QueryShare, 1)
+
+				audits[s], err = GenerateAuditForSharedQueryWithExpandedBits(keydb, queryShares[s], bits, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				results[s], err = db.PrivateSecretSharedQueryWithExpandedBits(queryShares[s].QueryShare, bits, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !CheckAudit(audits...) {
+				t.Fatalf("Keyword ASPIR audit failed")
+			}
+
+			res := Recover(results)
+			for j := 0; j < groupSize; j++ {
+				if !db.Slots[row*groupSize+j].Equal(res[j]) {
+					t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[row*groupSize+j], res[j])
+				}
+			}
+
+			// the key of another keyword does not authenticate the query
+			other := (row + 1) % len(keywords)
+			queryShares = db.NewAuthenticatedKeywordQueryShares(keyword, authKeys[other], groupSize, 2)
+			audits[0], _ = GenerateAuditForSharedQuery(keydb, queryShares[0], 1)
+			audits[1], _ = GenerateAuditForSharedQuery(keydb, queryShares[1], 1)
+			if CheckAudit(audits...) {
+				t.Fatalf("Keyword ASPIR audit succeeded with a false auth key")
+			}
+		}
+	}
+
+	// a key database without keywords cannot audit keyword queries
+	keydb := GenerateRandomDB(TestDBSize, secbytes)
+	queryShares := keydb.NewAuthenticatedKeywordQueryShares(1, keydb.Slots[0], 1, 2)
+	if _, err := GenerateAuditForSharedQuery(keydb, queryShares[0], 1); err == nil {
+		t.Fatalf("Audited a keyword query without keywords")
+	}
+}
+
+// run with 'go test -v -run TestGenerateKeyDatabase' to see log outputs.
+func TestGenerateKeyDatabase(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize+1, SlotBytes)
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+		keydb, lookup, err := GenerateKeyDatabase(&db.DBMetadata, groupSize, StatisticalSecurityBytes, crand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if keydb.DBSize != KeyDBSizeFor(&db.DBMetadata, groupSize) {
+			t.Fatalf("Key database has %v keys; expected %v\n", keydb.DBSize, KeyDBSizeFor(&db.DBMetadata, groupSize))
+		}
+
+		for i := 0; i < NumQueries; i++ {
+			index := rand.Intn(db.DBSize)
+			authKey, err := lookup.KeyForIndex(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the client retrieves the group containing index
+			queryShares := keydb.NewAuthenticatedIndexQueryShares(index/groupSize, authKey, 1, 2)
+
+			audits := make([]*AuditTokenShare, 2)
+			audits[0], _ = GenerateAuditForSharedQuery(keydb, queryShares[0], 1)
+			audits[1], _ = GenerateAuditForSharedQuery(keydb, queryShares[1], 1)
+
+			if !CheckAudit(audits...) {
+				t.Fatalf("Secret shared ASPIR proof failed with the key for index %v", index)
+			}
+		}
+
+		if _, err := lookup.KeyForIndex(db.DBSize + groupSize); err == nil {
+			t.Fatalf("Returned a key for an index out of range")
+		}
+	}
+
+	if _, _, err := GenerateKeyDatabase(&db.DBMetadata, 1, StatisticalSecurityBytes, bytes.NewReader(nil)); err == nil {
+		t.Fatalf("Generated keys without randomness")
+	}
+}
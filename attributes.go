@@ -0,0 +1,89 @@
+package pir
+
+import (
+	"errors"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Attribute-filtered retrieval.
+ Each slot can be tagged with a public bitmap of up to 64 attributes
+ (e.g., categories). A query carrying an attribute mask only retrieves
+ slots that have every attribute in the mask: the servers skip the
+ other slots while scanning, so a query for a slot that does not match
+ returns a null (all-zero) slot in the same round. The mask is sent in
+ the clear and is visible to the servers; the retrieved index is not.
+*/
+
+// ErrNoAttributes is returned when a query with an attribute mask is
+// answered by a database without attributes
+var ErrNoAttributes = errors.New("database has no attributes")
+
+// SetAttributes sets the public attribute bitmap of each slot (in logical order).
+// Attributes are cleared when the contents are swapped (see SwapIn)
+func (db *Database) SetAttributes(attributes []uint64) error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if attributes != nil && len(attributes) != db.DBSize {
+		return errors.New("number of attributes does not match the database size")
+	}
+
+	// stored in the same order as the slots (see ShuffleWithinGroups)
+	if db.GroupShuffle != nil {
+		attributes = db.GroupShuffle.applyToAttributes(attributes, db.Epoch, false)
+	}
+
+	db.Attributes = attributes
+
+	return nil
+}
+
+// NewIndexQuerySharesWithAttributeMask generates PIR query shares for the group at index
+// that only retrieve the slots with all attributes in mask
+func (dbmd *DBMetadata) NewIndexQuerySharesWithAttributeMask(index int, groupSize int, numShares uint, mask uint64) []*QueryShare {
+
+	shares := dbmd.NewIndexQueryShares(index, groupSize, numShares)
+	for _, share := range shares {
+		share.AttributeMask = mask
+	}
+
+	return shares
+}
+
+// NewEncryptedQueryWithAttributeMask generates an encrypted PIR query for the row at index
+// that only retrieves the slots with all attributes in mask
+func (dbmd *DBMetadata) NewEncryptedQueryWithAttributeMask(pk *paillier.PublicKey, groupSize, index int, mask uint64) *EncryptedQuery {
+
+	query := dbmd.NewEncryptedQuery(pk, groupSize, index)
+	query.AttributeMask = mask
+
+	return query
+}
+
+// NewDoublyEncryptedQueryWithAttributeMask generates a doubly encrypted PIR query for the group
+// containing index that only retrieves the slots with all attributes in mask
+func (dbmd *DBMetadata) NewDoublyEncryptedQueryWithAttributeMask(pk *paillier.PublicKey, groupSize, index int, mask uint64) *DoublyEncryptedQuery {
+
+	query := dbmd.NewDoublyEncryptedQuery(pk, groupSize, index)
+	query.Row.AttributeMask = mask // slots are filtered by the row query
+
+	return query
+}
+
+// checkAttributeMask returns ErrNoAttributes if the mask is set but the database has no attributes
+func (db *Database) checkAttributeMask(mask uint64) error {
+
+	if mask != 0 && len(db.Attributes) != db.DBSize {
+		return ErrNoAttributes
+	}
+
+	return nil
+}
+
+// matchesAttributes returns true if the slot at index has all attributes in mask
+func (db *Database) matchesAttributes(index int, mask uint64) bool {
+	return mask == 0 || db.Attributes[index]&mask == mask
+}
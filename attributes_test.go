@@ -0,0 +1,222 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// attribute bits of the test slots: even slots have attribute 1 and every
+// third slot has attribute 2
+func testAttributes(n int) []uint64 {
+	attributes := make([]uint64, n)
+	for i := range attributes {
+		if i%2 == 0 {
+			attributes[i] |= 1
+		}
+		if i%3 == 0 {
+			attributes[i] |= 2
+		}
+	}
+	return attributes
+}
+
+// expected returns the slot if its attributes match the mask and a null slot otherwise
+func expectedWithAttributes(db *Database, attributes []uint64, index int, mask uint64) *Slot {
+	if attributes[index]&mask == mask {
+		return db.Slots[index]
+	}
+	return NewEmptySlot(db.SlotBytes)
+}
+
+// run with 'go test -v -run TestAttributeSharedQuery' to see log outputs.
+func TestAttributeSharedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	attributes := testAttributes(TestDBSize)
+	if err := db.SetAttributes(attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mask := range []uint64{0, 1, 2, 3} {
+		for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+			qIndex := rand.Intn(TestDBSize / groupSize)
+			shares := db.NewIndexQuerySharesWithAttributeMask(qIndex, groupSize, 2, mask)
+
+			res := make([]*SecretSharedQueryResult, len(shares))
+			for i, share := range shares {
+				var err error
+				if res[i], err = db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			slots, valid := db.RecoverGroup(res, qIndex)
+			for j := 0; j < valid; j++ {
+				index := qIndex*groupSize + j
+				if expected := expectedWithAttributes(db, attributes, index, mask); !expected.Equal(slots[j]) {
+					t.Fatalf("Incorrect slot at index %v (mask %v): %v != %v\n", index, mask, slots[j], expected)
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestAttributeEncryptedQuery' to see log outputs.
+func TestAttributeEncryptedQuery(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	attributes := testAttributes(TestDBSize)
+	if err := db.SetAttributes(attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mask := range []uint64{1, 2} {
+		query := db.NewEncryptedQueryWithAttributeMask(pk, 1, 0, mask)
+		row := rand.Intn(query.DBHeight)
+		query = db.NewEncryptedQueryWithAttributeMask(pk, 1, row, mask)
+
+		res, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slots, valid, err := db.RecoverEncryptedGroup(res, sk, row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < valid; j++ {
+			index := row*query.DBWidth + j
+			if expected := expectedWithAttributes(db, attributes, index, mask); !expected.Equal(slots[j]) {
+				t.Fatalf("Incorrect slot at index %v (mask %v): %v != %v\n", index, mask, slots[j], expected)
+			}
+		}
+
+		// doubly encrypted queries are filtered by the row query
+		index := rand.Intn(TestDBSize)
+		dquery := db.NewDoublyEncryptedQueryWithAttributeMask(pk, 1, index, mask)
+		dres, err := db.PrivateDoublyEncryptedQuery(dquery, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dslots, _, err := db.RecoverDoublyEncryptedGroup(dres, sk, index, dquery.Row.DBWidth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := expectedWithAttributes(db, attributes, index, mask); !expected.Equal(dslots[0]) {
+			t.Fatalf("Incorrect slot at index %v (mask %v): %v != %v\n", index, mask, dslots[0], expected)
+		}
+	}
+}
+
+func TestAttributeShuffledQuery(t *testing.T) {
+	setup()
+
+	groupSize := 4
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	logical := append([]*Slot{}, db.Slots...)
+	attributes := testAttributes(TestDBSize)
+
+	if err := db.ShuffleWithinGroups(groupSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SetAttributes(attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	index := rand.Intn(TestDBSize)
+	row, pos := db.GroupPosition(index, groupSize)
+
+	shares := db.NewIndexQuerySharesWithAttributeMask(row, groupSize, 2, 1)
+	res := make([]*SecretSharedQueryResult, len(shares))
+	for i, share := range shares {
+		var err error
+		if res[i], err = db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := NewEmptySlot(SlotBytes)
+	if attributes[index]&1 == 1 {
+		expected = logical[index]
+	}
+
+	if slot := Recover(res)[pos]; !slot.Equal(expected) {
+		t.Fatalf("Incorrect slot at index %v: %v != %v\n", index, slot, expected)
+	}
+
+	// attributes follow the slots when shuffling is disabled
+	db.DisableGroupShuffling()
+	for i := range attributes {
+		if db.Attributes[i] != attributes[i] {
+			t.Fatalf("Attributes are not in logical order")
+		}
+	}
+}
+
+func TestAttributeErrors(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	shares := db.NewIndexQuerySharesWithAttributeMask(0, 1, 2, 1)
+	if _, err := db.PrivateSecretSharedQuery(shares[0], 1); !errors.Is(err, ErrNoAttributes) {
+		t.Fatalf("Expected ErrNoAttributes, got %v\n", err)
+	}
+
+	if err := db.SetAttributes(make([]uint64, TestDBSize-1)); err == nil {
+		t.Fatalf("Set attributes of the wrong size")
+	}
+
+	if err := db.SetAttributes(testAttributes(TestDBSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	// attributes are associated with the old contents
+	if err := db.SwapIn(db.Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Attributes != nil {
+		t.Fatalf("Attributes were not cleared by SwapIn")
+	}
+}
+
+func TestAttributesClearedByBuild(t *testing.T) {
+	setup()
+
+	db := NewDatabase()
+	db.BuildForData(generateStringsInSequence(TestDBSize))
+
+	if err := db.SetAttributes(testAttributes(TestDBSize)); err != nil {
+		t.Fatal(err)
+	}
+	keywords := make([]uint, TestDBSize)
+	for i := range keywords {
+		keywords[i] = uint(i)
+	}
+	db.SetKeywords(keywords)
+
+	// the attributes and keywords are associated with the old contents
+	db.BuildForData(generateStringsInSequence(TestDBSize / 2))
+
+	if db.Attributes != nil {
+		t.Fatalf("Attributes were not cleared by BuildForData")
+	}
+	if db.Keywords != nil || db.KeywordDigest != nil {
+		t.Fatalf("Keywords were not cleared by BuildForData")
+	}
+
+	shares := db.NewIndexQuerySharesWithAttributeMask(0, 1, 2, 1)
+	if _, err := db.PrivateSecretSharedQuery(shares[0], 1); !errors.Is(err, ErrNoAttributes) {
+		t.Fatalf("Expected ErrNoAttributes after rebuilding, got %v\n", err)
+	}
+}
@@ -0,0 +1,316 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+)
+
+/*
+ Batch queries.
+ Retrieving k slots with k queries scans the database k times. Probabilistic
+ batch codes (Angel et al., "PIR with compressed queries and amortized query
+ processing") replicate each slot into the BatchNumHashes buckets chosen by
+ public hash functions of its index, with NumBuckets = 1.5k buckets. The client
+ places each of its indices into a distinct bucket using cuckoo hashing and
+ sends a query share for every bucket (for a random row of the buckets that do
+ not hold an index) so that the servers do not learn which buckets are used.
+ Each bucket holds about BatchNumHashes*n/NumBuckets slots, so answering a
+ batch scans about BatchNumHashes*n slots instead of k*n. The buckets are
+ derived from the metadata: the slots of each bucket are in increasing order
+ of index (with NumBuckets and the epoch fixing the layout). Cuckoo hashing
+ fails with small probability, in which case ErrBatchPlacement is returned and
+ the client can retry with more buckets or split the batch.
+*/
+
+// BatchNumHashes is the number of buckets each slot is replicated into
+const BatchNumHashes = 3
+
+// maxBatchEvictions bounds the number of cuckoo evictions when placing a batch
+const maxBatchEvictions = 500
+
+// ErrBatchPlacement is returned when the indices of a batch cannot be placed into distinct buckets
+var ErrBatchPlacement = errors.New("failed to place the batch indices into distinct buckets")
+
+// BatchQueryShare is a share of a batch query: one query share per bucket
+type BatchQueryShare struct {
+	NumBuckets int
+	Queries    []*QueryShare
+}
+
+// BatchQueryResult contains the result shares of each bucket
+type BatchQueryResult struct {
+	Results []*SecretSharedQueryResult
+}
+
+// BatchPlan records where the slot of each index of a batch query is retrieved
+// (kept by the client to recover the slots; see RecoverBatch)
+type BatchPlan struct {
+	Indices   []int
+	GroupSize int
+	Buckets   []int // bucket of each index
+	Offsets   []int // position of each index within the group retrieved from its bucket
+}
+
+// NumBatchBuckets returns the number of buckets used for a batch of k indices
+func NumBatchBuckets(k int) int {
+	return ceilDiv(3*k, 2)
+}
+
+// NewIndexBatchQueryShares generates PIR query shares retrieving the slots at the indices
+// (with groupSize slots per row of each bucket) and the plan used to recover them
+func (dbmd *DBMetadata) NewIndexBatchQueryShares(indices []int, groupSize int, numShares uint) ([]*BatchQueryShare, *BatchPlan, error) {
+
+	if len(indices) == 0 {
+		return nil, nil, errors.New("no indices provided")
+	}
+
+	if groupSize <= 0 {
+		return nil, nil, errors.New("invalid group size")
+	}
+
+	for _, index := range indices {
+		if index < 0 || index >= dbmd.DBSize {
+			return nil, nil, errors.New("index out of range")
+		}
+	}
+
+	numBuckets := NumBatchBuckets(len(indices))
+
+	placement, err := placeBatch(indices, numBuckets)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	buckets := dbmd.batchBuckets(numBuckets)
+
+	plan := &BatchPlan{
+		Indices:   indices,
+		GroupSize: groupSize,
+		Buckets:   make([]int, len(indices)),
+		Offsets:   make([]int, len(indices)),
+	}
+
+	// row of the bucket queried (-1 for random rows)
+	rows := make([]int, numBuckets)
+	for b := range rows {
+		rows[b] = -1
+	}
+
+	for i, index := range indices {
+		b := placement[index]
+		pos := sort.SearchInts(buckets[b], index)
+
+		plan.Buckets[i] = b
+		plan.Offsets[i] = pos % groupSize
+		rows[b] = pos / groupSize
+	}
+
+	shares := make([]*BatchQueryShare, numShares)
+	for s := range shares {
+		shares[s] = &BatchQueryShare{
+			NumBuckets: numBuckets,
+			Queries:    make([]*QueryShare, numBuckets),
+		}
+	}
+
+	for b := range buckets {
+		md := dbmd.bucketMetadata(len(buckets[b]))
+
+		row := rows[b]
+		if row < 0 {
+			row = randomIntn(ceilDiv(md.DBSize, groupSize))
+		}
+
+		for s, share := range md.NewIndexQueryShares(row, groupSize, numShares) {
+			shares[s].Queries[b] = share
+		}
+	}
+
+	return shares, plan, nil
+}
+
+// PrivateSecretSharedBatchQuery answers each bucket query of the batch query share
+func (db *Database) PrivateSecretSharedBatchQuery(query *BatchQueryShare, nprocs int) (*BatchQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateSecretSharedBatchQuery(query, nprocs)
+}
+
+func (db *Database) privateSecretSharedBatchQuery(query *BatchQueryShare, nprocs int) (*BatchQueryResult, error) {
+
+	if query.NumBuckets <= 0 || len(query.Queries) != query.NumBuckets {
+		return nil, errors.New("invalid number of buckets provided in batch query")
+	}
+
+	for _, q := range query.Queries {
+		if q == nil || q.IsKeywordBased {
+			return nil, errors.New("batch queries only support index query shares")
+		}
+	}
+
+	// the buckets contain the slots in logical order
+	slots, attributes := db.Slots, db.Attributes
+	if db.GroupShuffle != nil {
+		slots = db.GroupShuffle.unshuffle(slots, db.Epoch)
+		attributes = db.GroupShuffle.applyToAttributes(attributes, db.Epoch, true)
+	}
+
+	buckets := db.batchBuckets(query.NumBuckets)
+	res := &BatchQueryResult{Results: make([]*SecretSharedQueryResult, query.NumBuckets)}
+
+	for b, indices := range buckets {
+		bucket := &Database{
+			DBMetadata:       *db.bucketMetadata(len(indices)),
+			Slots:            make([]*Slot, 0, len(indices)),
+			queryMemoryLimit: db.queryMemoryLimit,
+		}
+
+		for _, index := range indices {
+			bucket.Slots = append(bucket.Slots, slots[index])
+		}
+
+		if attributes != nil {
+			bucket.Attributes = make([]uint64, 0, len(indices))
+			for _, index := range indices {
+				bucket.Attributes = append(bucket.Attributes, attributes[index])
+			}
+		}
+
+		// empty buckets hold a single empty slot (see bucketMetadata)
+		if len(indices) == 0 {
+			bucket.Slots = append(bucket.Slots, NewEmptySlot(db.SlotBytes))
+			if attributes != nil {
+				bucket.Attributes = append(bucket.Attributes, 0)
+			}
+		}
+
+		var err error
+		if res.Results[b], err = bucket.privateSecretSharedQuery(query.Queries[b], nprocs); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// RecoverBatch recovers the slot of each index of the plan from the result shares
+func RecoverBatch(plan *BatchPlan, resShares []*BatchQueryResult) ([]*Slot, error) {
+
+	if len(resShares) == 0 {
+		return nil, errors.New("no result shares provided")
+	}
+
+	slots := make([]*Slot, len(plan.Indices))
+	for i := range plan.Indices {
+		b := plan.Buckets[i]
+
+		bucketShares := make([]*SecretSharedQueryResult, len(resShares))
+		for s, res := range resShares {
+			if b >= len(res.Results) {
+				return nil, errors.New("result shares do not match the plan")
+			}
+			bucketShares[s] = res.Results[b]
+		}
+
+		group := Recover(bucketShares)
+		if plan.Offsets[i] >= len(group) {
+			return nil, errors.New("result shares do not match the plan")
+		}
+
+		slots[i] = group[plan.Offsets[i]]
+	}
+
+	return slots, nil
+}
+
+// bucketMetadata returns the metadata of a bucket with size slots.
+// Empty buckets hold a single empty slot so that they can be queried like the others
+func (dbmd *DBMetadata) bucketMetadata(size int) *DBMetadata {
+
+	if size == 0 {
+		size = 1
+	}
+
+	md := dbmd.logicalMetadata()
+	md.DBSize = size
+	return md
+}
+
+// batchBuckets returns the indices of the slots replicated into each of the numBuckets buckets
+// (in increasing order)
+func (dbmd *DBMetadata) batchBuckets(numBuckets int) [][]int {
+
+	buckets := make([][]int, numBuckets)
+	for index := 0; index < dbmd.DBSize; index++ {
+		for _, b := range batchCandidates(index, numBuckets) {
+			buckets[b] = append(buckets[b], index)
+		}
+	}
+
+	return buckets
+}
+
+// batchCandidates returns the distinct buckets the slot at index is replicated into
+func batchCandidates(index, numBuckets int) []int {
+
+	candidates := make([]int, 0, BatchNumHashes)
+	for i := 0; i < BatchNumHashes; i++ {
+		b := idPosition(uint64(index), uint32(i), numBuckets)
+		if !containsInt(candidates, b) {
+			candidates = append(candidates, b)
+		}
+	}
+
+	return candidates
+}
+
+// placeBatch assigns each distinct index to one of its candidate buckets
+// such that no two indices share a bucket (cuckoo hashing with random walks)
+func placeBatch(indices []int, numBuckets int) (map[int]int, error) {
+
+	placement := make(map[int]int, len(indices))
+	occupant := make([]int, numBuckets)
+	for b := range occupant {
+		occupant[b] = -1
+	}
+
+	for _, index := range indices {
+		if _, ok := placement[index]; ok {
+			continue
+		}
+
+		current := index
+		placed := false
+		for evictions := 0; evictions < maxBatchEvictions && !placed; evictions++ {
+			candidates := batchCandidates(current, numBuckets)
+
+			for _, b := range candidates {
+				if occupant[b] < 0 {
+					occupant[b] = current
+					placement[current] = b
+					placed = true
+					break
+				}
+			}
+
+			if !placed {
+				// evict the occupant of a random candidate bucket
+				b := candidates[rand.Intn(len(candidates))]
+				evicted := occupant[b]
+				occupant[b] = current
+				placement[current] = b
+				delete(placement, evicted)
+				current = evicted
+			}
+		}
+
+		if !placed {
+			return nil, ErrBatchPlacement
+		}
+	}
+
+	return placement, nil
+}
@@ -0,0 +1,135 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestBatchQuery' to see log outputs.
+func TestBatchQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for _, groupSize := range []int{1, 3} {
+		for _, numShares := range []uint{2, 3} {
+			for _, k := range []int{1, 2, 10, 32} {
+
+				indices := make([]int, k)
+				for i := range indices {
+					indices[i] = rand.Intn(TestDBSize)
+				}
+
+				shares, plan, err := db.NewIndexBatchQueryShares(indices, groupSize, numShares)
+				if errors.Is(err, ErrBatchPlacement) {
+					continue
+				} else if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(shares[0].Queries) != NumBatchBuckets(k) {
+					t.Fatalf("Batch query has %v buckets, expected %v\n", len(shares[0].Queries), NumBatchBuckets(k))
+				}
+
+				results := make([]*BatchQueryResult, numShares)
+				for s := range shares {
+					if results[s], err = db.PrivateSecretSharedBatchQuery(shares[s], NumProcsForQuery); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				slots, err := RecoverBatch(plan, results)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i, index := range indices {
+					if !db.Slots[index].Equal(slots[i]) {
+						t.Fatalf("Batch query result is incorrect for index %v. %v != %v\n", index, db.Slots[index], slots[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestBatchQueryShuffled' to see log outputs.
+func TestBatchQueryShuffled(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	original := make([]*Slot, db.DBSize)
+	copy(original, db.Slots)
+
+	if err := db.ShuffleWithinGroups(4); err != nil {
+		t.Fatal(err)
+	}
+
+	md := db.Metadata()
+	indices := []int{0, 5, TestDBSize - 1}
+
+	shares, plan, err := md.NewIndexBatchQueryShares(indices, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resA, err := db.PrivateSecretSharedBatchQuery(shares[0], NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resB, err := db.PrivateSecretSharedBatchQuery(shares[1], NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := RecoverBatch(plan, []*BatchQueryResult{resA, resB})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the slots are retrieved by logical index
+	for i, index := range indices {
+		if !original[index].Equal(slots[i]) {
+			t.Fatalf("Batch query result is incorrect for index %v\n", index)
+		}
+	}
+
+	// queries generated before the epoch changed are rejected
+	if err := db.SwapIn(GenerateRandomDB(TestDBSize, SlotBytes).Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.PrivateSecretSharedBatchQuery(shares[0], NumProcsForQuery); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestPlaceBatch' to see log outputs.
+func TestPlaceBatch(t *testing.T) {
+
+	indices := []int{3, 3, 7, 11, 100}
+	numBuckets := NumBatchBuckets(len(indices))
+
+	placement, err := placeBatch(indices, numBuckets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := make(map[int]bool)
+	for index, b := range placement {
+		if used[b] {
+			t.Fatalf("Bucket %v holds more than one index\n", b)
+		}
+		used[b] = true
+
+		if !containsInt(batchCandidates(index, numBuckets), b) {
+			t.Fatalf("Index %v placed in bucket %v which does not contain it\n", index, b)
+		}
+	}
+
+	if len(placement) != 4 {
+		t.Fatalf("Placed %v distinct indices, expected 4\n", len(placement))
+	}
+}
@@ -0,0 +1,185 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sachaservan/pir/dpf"
+)
+
+/*
+ Single-bit databases.
+ Membership tests only need one bit per element but slots are at least
+ a byte, so a database of bits stored as slots is 8x larger than the
+ data and its scans xor byte slices. A BitDatabase packs the bits into
+ 64-bit words: the bits are viewed as a grid of rows of RowBits bits (a
+ multiple of 64) and a secret shared query retrieves a row exactly like
+ a group of RowBits slots (see NewBitQueryShares). The servers expand
+ the DPF over the rows and xor the words of the selected rows (see
+ PrivateSecretSharedBitQuery), with a mask instead of a branch so that
+ the scan does not depend on the selection bits. Queries use the keys of
+ the other secret shared queries (two-party and multi-party).
+*/
+
+// BitDatabase is a database of bits packed into words, retrieved a row at a time.
+// DBSize is the number of bits (SlotBytes is zero)
+type BitDatabase struct {
+	DBMetadata
+	RowBits int      // bits of a row (a multiple of 64)
+	Words   []uint64 // rows of RowBits/64 words (bit i of a row is bit i%64 of word i/64)
+
+	mu sync.RWMutex
+}
+
+// BitDBMetadata is the metadata clients need to query a BitDatabase
+type BitDBMetadata struct {
+	DBMetadata
+	RowBits int
+}
+
+// BitQueryResult contains the share of the row retrieved by a query
+type BitQueryResult struct {
+	Words []uint64
+}
+
+// NewBitDatabase packs the bits into a database with rows of at least rowBits bits
+// (rounded up to a multiple of 64)
+func NewBitDatabase(bits []bool, rowBits int) (*BitDatabase, error) {
+
+	if len(bits) == 0 {
+		return nil, errors.New("database is empty")
+	}
+
+	if rowBits <= 0 {
+		return nil, errors.New("row size must be positive")
+	}
+
+	rowBits = ceilDiv(rowBits, 64) * 64
+	numRows := ceilDiv(len(bits), rowBits)
+
+	bdb := &BitDatabase{RowBits: rowBits, Words: make([]uint64, numRows*rowBits/64)}
+	bdb.DBSize = len(bits)
+
+	for i, bit := range bits {
+		if bit {
+			bdb.Words[i/64] |= 1 << uint(i%64)
+		}
+	}
+
+	return bdb, nil
+}
+
+// BitMetadata returns the metadata of the database
+func (bdb *BitDatabase) BitMetadata() BitDBMetadata {
+
+	bdb.mu.RLock()
+	defer bdb.mu.RUnlock()
+
+	return BitDBMetadata{DBMetadata: bdb.DBMetadata, RowBits: bdb.RowBits}
+}
+
+// Bit returns the bit at the index
+func (bdb *BitDatabase) Bit(index int) bool {
+
+	bdb.mu.RLock()
+	defer bdb.mu.RUnlock()
+
+	return (bdb.Words[index/64]>>uint(index%64))&1 == 1
+}
+
+// NewBitQueryShares generates the query shares retrieving the row holding the bit at the index
+func (md *BitDBMetadata) NewBitQueryShares(index int, numShares uint) ([]*QueryShare, error) {
+
+	if index < 0 || index >= md.DBSize {
+		return nil, fmt.Errorf("index %v is not in the database", index)
+	}
+
+	return md.NewIndexQueryShares(index/md.RowBits, md.RowBits, numShares), nil
+}
+
+// RecoverBit combines the results of the servers and returns the bit at the index
+func (md *BitDBMetadata) RecoverBit(index int, resShares []*BitQueryResult) (bool, error) {
+
+	rowWords := md.RowBits / 64
+	offset := index % md.RowBits
+
+	word := uint64(0)
+	for _, res := range resShares {
+		if len(res.Words) != rowWords {
+			return false, fmt.Errorf("expected %v words, got %v", rowWords, len(res.Words))
+		}
+		word ^= res.Words[offset/64]
+	}
+
+	return (word>>uint(offset%64))&1 == 1, nil
+}
+
+// PrivateSecretSharedBitQuery returns the share of the row retrieved by the query
+func (bdb *BitDatabase) PrivateSecretSharedBitQuery(query *QueryShare, nprocs int) (*BitQueryResult, error) {
+
+	bdb.mu.RLock()
+	defer bdb.mu.RUnlock()
+
+	if query.IsKeywordBased {
+		return nil, errors.New("bit databases only support index queries")
+	}
+
+	if query.GroupSize != bdb.RowBits {
+		return nil, fmt.Errorf("%w: query retrieves %v bits per row, database has %v",
+			ErrStaleLayout, query.GroupSize, bdb.RowBits)
+	}
+
+	if err := bdb.checkSharedLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := bdb.checkKeyDomain(query); err != nil {
+		return nil, err
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	rowWords := bdb.RowBits / 64
+	numRows := len(bdb.Words) / rowWords
+
+	pf := dpf.ServerInitialize(query.PrfKeys, bdb.sharedQueryDomainBits(bdb.RowBits, false))
+
+	bits := make([]bool, numRows)
+	if err := expandSharedRows(pf, query, nil, 0, bits, nprocs); err != nil {
+		return nil, err
+	}
+
+	partial := make([][]uint64, nprocs)
+	for w := range partial {
+		partial[w] = make([]uint64, rowWords)
+	}
+
+	err := parallelRanges(context.Background(), numRows, nprocs, func(w, start, end int) error {
+		acc := partial[w]
+		for row := start; row < end; row++ {
+			mask := -uint64(boolToInt(bits[row]))
+			words := bdb.Words[row*rowWords : (row+1)*rowWords]
+			for i, word := range words {
+				acc[i] ^= word & mask
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := &BitQueryResult{Words: make([]uint64, rowWords)}
+	for _, acc := range partial {
+		for i, word := range acc {
+			res.Words[i] ^= word
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,78 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestBitDatabase(t *testing.T) {
+
+	for _, numBits := range []int{1, 63, 64, 1000, 4097} {
+		bits := make([]bool, numBits)
+		for i := range bits {
+			bits[i] = rand.Intn(2) == 1
+		}
+
+		bdb, err := NewBitDatabase(bits, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bdb.RowBits != 128 {
+			t.Fatalf("expected rows of 128 bits, got %v", bdb.RowBits)
+		}
+
+		md := bdb.BitMetadata()
+
+		for _, numShares := range []uint{2, 3} {
+			for trial := 0; trial < NumTrials; trial++ {
+				index := rand.Intn(numBits)
+
+				shares, err := md.NewBitQueryShares(index, numShares)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				resShares := make([]*BitQueryResult, len(shares))
+				for i, share := range shares {
+					if resShares[i], err = bdb.PrivateSecretSharedBitQuery(share, NumProcsForQuery); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				bit, err := md.RecoverBit(index, resShares)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if bit != bits[index] || bit != bdb.Bit(index) {
+					t.Fatalf("bit %v of %v recovered incorrectly", index, numBits)
+				}
+			}
+		}
+	}
+}
+
+func TestBitDatabaseStaleQuery(t *testing.T) {
+
+	bdb, err := NewBitDatabase(make([]bool, 1000), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewBitDatabase(make([]bool, 1000), 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md := other.BitMetadata()
+	shares, err := md.NewBitQueryShares(10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bdb.PrivateSecretSharedBitQuery(shares[0], 1); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("expected ErrStaleLayout, got %v", err)
+	}
+}
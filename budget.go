@@ -0,0 +1,140 @@
+package pir
+
+import (
+	"crypto/aes"
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+	"github.com/sachaservan/pir/dpf"
+)
+
+/*
+ Client bandwidth budgets.
+ The query constructors below estimate the upload (query) and download
+ (response) sizes per server from the layout before generating any keys
+ or ciphertexts and fail fast if they exceed the caller's budget.
+*/
+
+// Budget limits the bytes sent to (upload) and received from (download) each server.
+// A zero limit is unlimited
+type Budget struct {
+	MaxUploadBytes   int
+	MaxDownloadBytes int
+}
+
+// ErrBudgetExceeded is matched (using errors.Is) by the error returned when
+// a query exceeds its budget. The error is a *BudgetExceededError with the estimates
+var ErrBudgetExceeded = errors.New("query exceeds the bandwidth budget")
+
+// BudgetExceededError contains the estimated sizes of the rejected query
+type BudgetExceededError struct {
+	UploadBytes   int
+	DownloadBytes int
+	Budget        Budget
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("%v: upload %v bytes (max %v), download %v bytes (max %v)",
+		ErrBudgetExceeded, e.UploadBytes, e.Budget.MaxUploadBytes, e.DownloadBytes, e.Budget.MaxDownloadBytes)
+}
+
+// Is reports whether target is ErrBudgetExceeded
+func (e *BudgetExceededError) Is(target error) bool {
+	return target == ErrBudgetExceeded
+}
+
+// check returns a *BudgetExceededError if the sizes exceed the budget
+func (b Budget) check(upload, download int) error {
+
+	if (b.MaxUploadBytes > 0 && upload > b.MaxUploadBytes) ||
+		(b.MaxDownloadBytes > 0 && download > b.MaxDownloadBytes) {
+		return &BudgetExceededError{upload, download, b}
+	}
+
+	return nil
+}
+
+// EstimateSharedQuerySize returns the upload and download sizes (in bytes)
+// per server of a secret shared index query
+func (dbmd *DBMetadata) EstimateSharedQuerySize(groupSize int, numShares uint) (int, int) {
+
+	numBits := dbmd.sharedQueryDomainBits(groupSize, false)
+
+	// prf keys are sent along with each key
+	upload := 4 * aes.BlockSize
+
+	if numShares == 2 {
+		// SInit, TInit, one (aes.BlockSize + 2)-byte CW per level and FinalCW
+		upload += aes.BlockSize + 1 + int(numBits)*(aes.BlockSize+2) + 8
+	} else {
+		keyBytes, _ := dpf.EstimateMultiServerMemory(numBits, numShares)
+		upload += saturatingInt(keyBytes)
+	}
+
+	return upload, groupSize * dbmd.SlotBytes
+}
+
+// EstimateEncryptedQuerySize returns the upload and download sizes (in bytes)
+// of an encrypted query over a width x height layout
+func (dbmd *DBMetadata) EstimateEncryptedQuerySize(pk *paillier.PublicKey, width, height int) (int, int) {
+
+	nBytes := len(pk.N.Bytes())
+	ctBytes := 2 * nBytes // ciphertexts are mod N^2
+
+	return height * ctBytes, width * dbmd.numCiphertextsPerSlot(nBytes) * ctBytes
+}
+
+// EstimateDoublyEncryptedQuerySize returns the upload and download sizes (in bytes)
+// of a doubly encrypted query over a width x height layout
+func (dbmd *DBMetadata) EstimateDoublyEncryptedQuerySize(pk *paillier.PublicKey, width, height, groupSize int) (int, int) {
+
+	nBytes := len(pk.N.Bytes())
+
+	// row ciphertexts are mod N^2 and column ciphertexts mod N^3
+	upload := height*2*nBytes + (width/groupSize)*3*nBytes
+	download := groupSize * dbmd.numCiphertextsPerSlot(nBytes) * 3 * nBytes
+
+	return upload, download
+}
+
+// NewIndexQuerySharesWithBudget generates PIR query shares for the index
+// or returns a *BudgetExceededError if the query exceeds the budget
+func (dbmd *DBMetadata) NewIndexQuerySharesWithBudget(index int, groupSize int, numShares uint, budget Budget) ([]*QueryShare, error) {
+
+	if err := budget.check(dbmd.EstimateSharedQuerySize(groupSize, numShares)); err != nil {
+		return nil, err
+	}
+
+	return dbmd.NewIndexQueryShares(index, groupSize, numShares), nil
+}
+
+// NewEncryptedQueryWithBudget generates an encrypted PIR query (see NewEncryptedQuery)
+// or returns a *BudgetExceededError if the query exceeds the budget
+func (dbmd *DBMetadata) NewEncryptedQueryWithBudget(pk *paillier.PublicKey, groupSize, index int, budget Budget) (*EncryptedQuery, error) {
+
+	layout := dbmd.DefaultLayout(groupSize)
+	if err := budget.check(dbmd.EstimateEncryptedQuerySize(pk, layout.Width, layout.Height)); err != nil {
+		return nil, err
+	}
+
+	return dbmd.NewEncryptedQueryWithDimentions(pk, layout.Width, layout.Height, groupSize, index), nil
+}
+
+// NewDoublyEncryptedQueryWithBudget generates a doubly encrypted PIR query (see NewDoublyEncryptedQuery)
+// or returns a *BudgetExceededError if the query exceeds the budget
+func (dbmd *DBMetadata) NewDoublyEncryptedQueryWithBudget(pk *paillier.PublicKey, groupSize, index int, budget Budget) (*DoublyEncryptedQuery, error) {
+
+	layout := dbmd.DefaultLayout(groupSize)
+	if err := budget.check(dbmd.EstimateDoublyEncryptedQuerySize(pk, layout.Width, layout.Height, groupSize)); err != nil {
+		return nil, err
+	}
+
+	return dbmd.NewDoublyEncryptedQueryWithDimentions(pk, layout.Width, layout.Height, groupSize, index), nil
+}
+
+// numCiphertextsPerSlot returns the number of ciphertexts needed to encrypt a slot
+// for a public key with an nBytes modulus (see newPkParams)
+func (dbmd *DBMetadata) numCiphertextsPerSlot(nBytes int) int {
+	return ceilDiv(dbmd.SlotBytes, nBytes-2)
+}
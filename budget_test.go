@@ -0,0 +1,78 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestBudget' to see log outputs.
+func TestBudget(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes*10)
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+
+		// estimates match the generated queries and responses
+		shares, err := db.NewIndexQuerySharesWithBudget(0, groupSize, 2, Budget{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, download := db.EstimateSharedQuerySize(groupSize, 2)
+		if download != len(res.Shares)*len(res.Shares[0].Data) {
+			t.Fatalf("Incorrect download estimate %v\n", download)
+		}
+
+		query, err := db.NewEncryptedQueryWithBudget(pk, groupSize, 0, Budget{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		upload, download := db.EstimateEncryptedQuerySize(pk, query.DBWidth, query.DBHeight)
+		if upload < len(query.EBits)*len(query.EBits[0].C.Bytes()) {
+			t.Fatalf("Upload estimate %v is too small\n", upload)
+		}
+
+		_, err = db.NewEncryptedQueryWithBudget(pk, groupSize, 0, Budget{MaxDownloadBytes: download - 1})
+		if !errors.Is(err, ErrBudgetExceeded) {
+			t.Fatalf("Budget not enforced (err = %v)", err)
+		}
+
+		var exceeded *BudgetExceededError
+		if !errors.As(err, &exceeded) || exceeded.DownloadBytes != download || exceeded.UploadBytes != upload {
+			t.Fatalf("Error does not contain the estimates (err = %v)", err)
+		}
+
+		dquery, err := db.NewDoublyEncryptedQueryWithBudget(pk, groupSize, 0, Budget{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dres, err := db.PrivateDoublyEncryptedQuery(dquery, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, download = db.EstimateDoublyEncryptedQuerySize(pk, dquery.Row.DBWidth, dquery.Row.DBHeight, groupSize)
+		if len(dres.Slots)*len(dres.Slots[0].Cts) != download/(3*len(pk.N.Bytes())) {
+			t.Fatalf("Incorrect download estimate %v\n", download)
+		}
+
+		if !recoverDoublyEncrypted(t, dres, sk)[0].Equal(db.Slots[0]) {
+			t.Fatalf("Query result is incorrect")
+		}
+	}
+
+	if _, err := db.NewIndexQuerySharesWithBudget(0, 1, 2, Budget{MaxUploadBytes: 1}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Budget not enforced (err = %v)", err)
+	}
+}
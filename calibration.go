@@ -0,0 +1,167 @@
+package pir
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Calibration answers.
+ A calibration answer is a random result with the same shape as the
+ answer to a real query (number of slots, slot size, ciphertext levels
+ and sizes) that is generated without reading the database. Clients
+ use calibration answers to measure decoding, latency and bandwidth
+ end-to-end before sending real queries. Calibration queries are
+ checked like real queries (scheme, layout and attribute mask) so that
+ a query rejected by the server is also rejected during calibration.
+ Encrypted calibration answers are encryptions of random slots under
+ the public key of the query and decrypt without errors.
+*/
+
+// CalibrationSharedAnswer returns a random result share shaped like the answer to the query share
+func (db *Database) CalibrationSharedAnswer(query *QueryShare) (*SecretSharedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := db.checkScheme(query.scheme()); err != nil {
+		return nil, err
+	}
+
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if err := db.checkSharedLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkAttributeMask(query.AttributeMask); err != nil {
+		return nil, err
+	}
+
+	shares := make([]*Slot, query.GroupSize)
+	for i := range shares {
+		shares[i] = NewRandomSlot(db.SlotBytes)
+	}
+
+	return &SecretSharedQueryResult{db.SlotBytes, shares}, nil
+}
+
+// CalibrationEncryptedAnswer returns a random result shaped like the answer to the encrypted query
+func (db *Database) CalibrationEncryptedAnswer(query *EncryptedQuery) (*EncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := db.checkScheme(query.scheme()); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkEncryptedQuery(query); err != nil {
+		return nil, err
+	}
+
+	params := db.paramsForPublicKey(query.Pk)
+
+	numBytesPerCiphertext := 0
+	slots := make([]*EncryptedSlot, query.DBWidth)
+	for i := range slots {
+		cts, n, err := randomEncryptedSlot(query.Pk, db.SlotBytes, params.numCiphertextsPerSlot, paillier.EncLevelOne)
+		if err != nil {
+			return nil, err
+		}
+		slots[i] = &EncryptedSlot{Cts: cts}
+		numBytesPerCiphertext = n
+	}
+
+	return &EncryptedQueryResult{
+		Pk:                    query.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(query.Pk),
+		Slots:                 slots,
+		NumBytesPerCiphertext: numBytesPerCiphertext,
+		SlotBytes:             db.SlotBytes,
+	}, nil
+}
+
+// CalibrationDoublyEncryptedAnswer returns a random result shaped like the answer to the
+// doubly encrypted query
+func (db *Database) CalibrationDoublyEncryptedAnswer(query *DoublyEncryptedQuery) (*DoublyEncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, err := db.recursionBackend(query); err != nil {
+		return nil, err
+	}
+
+	if query.Col.GroupSize > query.Row.DBWidth || query.Col.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if err := db.checkEncryptedQuery(query.Row); err != nil {
+		return nil, err
+	}
+
+	// the row query determines the number of ciphertexts per slot
+	params := db.paramsForPublicKey(query.Row.Pk)
+
+	numBytesPerCiphertext := 0
+	slots := make([]*DoublyEncryptedSlot, query.Col.GroupSize)
+	for i := range slots {
+		cts, n, err := randomEncryptedSlot(query.Col.Pk, db.SlotBytes, params.numCiphertextsPerSlot, paillier.EncLevelTwo)
+		if err != nil {
+			return nil, err
+		}
+		slots[i] = &DoublyEncryptedSlot{Cts: cts}
+		numBytesPerCiphertext = n
+	}
+
+	return &DoublyEncryptedQueryResult{
+		Pk:                    query.Col.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(query.Col.Pk),
+		Slots:                 slots,
+		NumBytesPerCiphertext: numBytesPerCiphertext,
+		SlotBytes:             db.SlotBytes,
+	}, nil
+}
+
+// randomEncryptedSlot encrypts a random slot at the level (nested for EncLevelTwo)
+// and returns the ciphertexts and the number of bytes of the slot in each ciphertext
+func randomEncryptedSlot(pk *paillier.PublicKey, slotBytes, numCiphertexts int, level paillier.EncryptionLevel) ([]*paillier.Ciphertext, int, error) {
+
+	ints, numBytesPerCiphertext, err := NewRandomSlot(slotBytes).ToGmpIntArray(numCiphertexts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cts := make([]*paillier.Ciphertext, len(ints))
+	for i, v := range ints {
+		cts[i] = pk.Encrypt(v)
+		if level == paillier.EncLevelTwo {
+			r, err := randomUnit(pk)
+			if err != nil {
+				return nil, 0, err
+			}
+			cts[i] = pk.EncryptWithRAtLevel(cts[i].C, r, paillier.EncLevelTwo)
+		}
+	}
+
+	return cts, numBytesPerCiphertext, nil
+}
+
+// randomUnit returns a random non-zero integer smaller than N
+// (a unit modulo N with overwhelming probability)
+func randomUnit(pk *paillier.PublicKey) (*gmp.Int, error) {
+
+	b := make([]byte, len(pk.N.Bytes())-1)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	b[0] |= 1 // non-zero
+
+	return new(gmp.Int).SetBytes(b), nil
+}
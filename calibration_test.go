@@ -0,0 +1,103 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestCalibrationSharedAnswer' to see log outputs.
+func TestCalibrationSharedAnswer(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	groupSize := 4
+	shares := db.NewIndexQueryShares(0, groupSize, 2)
+
+	resA, err := db.CalibrationSharedAnswer(shares[0])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	resB, err := db.CalibrationSharedAnswer(shares[1])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	res := Recover([]*SecretSharedQueryResult{resA, resB})
+	if len(res) != groupSize {
+		t.Fatalf("Calibration answer has %v slots, expected %v\n", len(res), groupSize)
+	}
+
+	for _, slot := range res {
+		if len(slot.Data) != db.SlotBytes {
+			t.Fatalf("Calibration slot has %v bytes, expected %v\n", len(slot.Data), db.SlotBytes)
+		}
+	}
+
+	// calibration queries are checked like real queries
+	stale := db.Metadata()
+	stale.Epoch++
+	if _, err := db.CalibrationSharedAnswer(stale.NewIndexQueryShares(0, groupSize, 2)[0]); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestCalibrationEncryptedAnswer' to see log outputs.
+func TestCalibrationEncryptedAnswer(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	groupSize := 2
+	query := db.NewEncryptedQuery(pk, groupSize, 0)
+
+	dummy, err := db.CalibrationEncryptedAnswer(query)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	real, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(dummy.Slots) != len(real.Slots) ||
+		len(dummy.Slots[0].Cts) != len(real.Slots[0].Cts) ||
+		dummy.NumBytesPerCiphertext != real.NumBytesPerCiphertext {
+		t.Fatalf("Calibration answer does not have the shape of the real answer")
+	}
+
+	for _, slot := range recoverEncrypted(t, dummy, sk) {
+		if len(slot.Data) != db.SlotBytes {
+			t.Fatalf("Calibration slot has %v bytes, expected %v\n", len(slot.Data), db.SlotBytes)
+		}
+	}
+
+	doublyQuery := db.NewDoublyEncryptedQuery(pk, groupSize, 0)
+	doublyDummy, err := db.CalibrationDoublyEncryptedAnswer(doublyQuery)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	doublyReal, err := db.PrivateDoublyEncryptedQuery(doublyQuery, NumProcsForQuery)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(doublyDummy.Slots) != len(doublyReal.Slots) ||
+		len(doublyDummy.Slots[0].Cts) != len(doublyReal.Slots[0].Cts) ||
+		doublyDummy.Slots[0].Cts[0].Level != doublyReal.Slots[0].Cts[0].Level ||
+		doublyDummy.NumBytesPerCiphertext != doublyReal.NumBytesPerCiphertext {
+		t.Fatalf("Calibration answer does not have the shape of the real answer")
+	}
+
+	for _, slot := range recoverDoublyEncrypted(t, doublyDummy, sk) {
+		if len(slot.Data) != db.SlotBytes {
+			t.Fatalf("Calibration slot has %v bytes, expected %v\n", len(slot.Data), db.SlotBytes)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package pir
+
+import (
+	"errors"
+	"time"
+)
+
+/*
+ Server capability hints.
+ Servers advertise (in the metadata sent to clients) the schemes they
+ answer, the largest group size they serve and the expected latency
+ per row scanned, so that clients pick query parameters that a given
+ server can serve within its SLA instead of hardcoding assumptions.
+ The hints are advisory: servers still reject unsupported schemes.
+*/
+
+// ErrGroupSizeNotSupported is returned when a group size exceeds the advertised maximum
+var ErrGroupSizeNotSupported = errors.New("group size exceeds the maximum supported by the server")
+
+// LatencyClass is a coarse class of the time a server spends per row scanned
+type LatencyClass int
+
+const (
+	// LatencyUnknown is the class of servers that do not advertise their latency
+	LatencyUnknown LatencyClass = iota
+	// LatencyFast is under 1µs per row (e.g., secret shared schemes)
+	LatencyFast
+	// LatencyMedium is under 100µs per row
+	LatencyMedium
+	// LatencySlow is 100µs or more per row (e.g., encrypted schemes over large slots)
+	LatencySlow
+)
+
+func (c LatencyClass) String() string {
+	switch c {
+	case LatencyFast:
+		return "fast"
+	case LatencyMedium:
+		return "medium"
+	case LatencySlow:
+		return "slow"
+	}
+	return "unknown"
+}
+
+// LatencyClassFor returns the latency class of a server that spends perRow per row scanned
+// (e.g., the time per row of a query answered with all its processes)
+func LatencyClassFor(perRow time.Duration) LatencyClass {
+
+	switch {
+	case perRow <= 0:
+		return LatencyUnknown
+	case perRow < time.Microsecond:
+		return LatencyFast
+	case perRow < 100*time.Microsecond:
+		return LatencyMedium
+	}
+
+	return LatencySlow
+}
+
+// ServerCapabilities are hints on the queries that a server can serve within its SLA
+type ServerCapabilities struct {
+	Schemes      []Scheme     // schemes answered by the server
+	MaxGroupSize int          // largest group size served (0 if unlimited)
+	MaxNumProcs  int          // processes used to answer each query (0 if unknown)
+	LatencyClass LatencyClass // expected latency per row scanned
+}
+
+// AdvertiseCapabilities includes the capabilities in the metadata of the database.
+// The supported schemes (see SupportedSchemes) are advertised if caps has no schemes
+func (db *Database) AdvertiseCapabilities(caps ServerCapabilities) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(caps.Schemes) == 0 {
+		caps.Schemes = db.supportedSchemesLocked()
+	} else {
+		caps.Schemes = append([]Scheme{}, caps.Schemes...)
+	}
+
+	db.Capabilities = &caps
+}
+
+// CheckCapabilities returns an *UnsupportedSchemeError or ErrGroupSizeNotSupported if the
+// server does not advertise support for queries with the scheme and group size.
+// Metadata without capabilities are assumed to support every query
+func (dbmd *DBMetadata) CheckCapabilities(scheme Scheme, groupSize int) error {
+
+	caps := dbmd.Capabilities
+	if caps == nil {
+		return nil
+	}
+
+	if len(caps.Schemes) > 0 && !containsScheme(caps.Schemes, scheme) {
+		return &UnsupportedSchemeError{Scheme: scheme, Supported: caps.Schemes}
+	}
+
+	if caps.MaxGroupSize > 0 && groupSize > caps.MaxGroupSize {
+		return ErrGroupSizeNotSupported
+	}
+
+	return nil
+}
+
+func containsScheme(schemes []Scheme, scheme Scheme) bool {
+	for _, s := range schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// run with 'go test -v -run TestServerCapabilities' to see log outputs.
+func TestServerCapabilities(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	// no capabilities advertised
+	if err := db.CheckCapabilities(SchemeAHEPaillierV1, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	db.SetSupportedSchemes(SchemeDPFv1)
+	db.AdvertiseCapabilities(ServerCapabilities{
+		MaxGroupSize: 4,
+		MaxNumProcs:  NumProcsForQuery,
+		LatencyClass: LatencyClassFor(500 * time.Nanosecond),
+	})
+
+	caps := db.Capabilities
+	if len(caps.Schemes) != 1 || caps.Schemes[0] != SchemeDPFv1 || caps.LatencyClass != LatencyFast {
+		t.Fatalf("Unexpected capabilities %+v\n", caps)
+	}
+
+	t.Logf("Capabilities: %+v (latency %v)\n", caps, caps.LatencyClass)
+
+	if err := db.CheckCapabilities(SchemeDPFv1, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.CheckCapabilities(SchemeAHEPaillierV1, 1); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Expected ErrUnsupportedScheme, got %v\n", err)
+	}
+
+	if err := db.CheckCapabilities(SchemeDPFv1, 5); !errors.Is(err, ErrGroupSizeNotSupported) {
+		t.Fatalf("Expected ErrGroupSizeNotSupported, got %v\n", err)
+	}
+
+	// clients fail before querying the servers
+	queried := false
+	client := NewClient(db.DBMetadata, 8, 2, func(shares []*QueryShare) ([]*SecretSharedQueryResult, error) {
+		queried = true
+		return nil, nil
+	})
+
+	if _, err := client.Get(0); !errors.Is(err, ErrGroupSizeNotSupported) || queried {
+		t.Fatalf("Expected ErrGroupSizeNotSupported without a query, got %v\n", err)
+	}
+
+	for perRow, class := range map[time.Duration]LatencyClass{
+		0:                      LatencyUnknown,
+		10 * time.Microsecond:  LatencyMedium,
+		100 * time.Microsecond: LatencySlow,
+	} {
+		if LatencyClassFor(perRow) != class {
+			t.Fatalf("Latency class of %v is %v; expected %v\n", perRow, LatencyClassFor(perRow), class)
+		}
+	}
+}
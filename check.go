@@ -0,0 +1,272 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ In-process scheme checks.
+ CheckScheme retrieves every group of the database through the query,
+ answer and recovery routines of a scheme and compares the recovered
+ slots with the stored ones. This covers the boundary conditions where
+ schemes differ (the last row, a partial last group, padding slots and
+ the zero slots past the end of the database) and is intended as a
+ smoke test on real data after a deployment.
+*/
+
+// SchemeCheckKeyBits is the size of the throwaway keys used to check encrypted schemes
+var SchemeCheckKeyBits = 1024
+
+// earlyTerminationCheckGamma is the number of early termination levels of the
+// keys used to check SchemeDPFv2EarlyTerm (clamped to the depth of the tree)
+const earlyTerminationCheckGamma = 7
+
+// ErrSchemeCheckFailed is matched (using errors.Is) by the error returned by CheckScheme
+// when slots are recovered incorrectly. The error is a *SchemeCheckError
+var ErrSchemeCheckFailed = errors.New("scheme check failed")
+
+// SchemeCheckError lists the (logical) indices recovered incorrectly by a scheme.
+// Indices >= DBSize are positions past the end of the database that were not recovered as zero
+type SchemeCheckError struct {
+	Scheme    Scheme
+	GroupSize int
+	Indices   []int
+}
+
+func (e *SchemeCheckError) Error() string {
+	return fmt.Sprintf("%v: %q (group size %v) recovered %v incorrect slots at indices %v",
+		ErrSchemeCheckFailed, e.Scheme, e.GroupSize, len(e.Indices), e.Indices)
+}
+
+// Is reports whether target is ErrSchemeCheckFailed
+func (e *SchemeCheckError) Is(target error) bool {
+	return target == ErrSchemeCheckFailed
+}
+
+// CheckScheme retrieves every group of groupSize slots using the scheme and checks
+// that the recovered slots match the database. Queries are answered through the
+// scheme dispatcher (see AnswerSharedQuery and AnswerEncryptedQuery) so the check
+// fails if the scheme is not supported. Returns a *SchemeCheckError listing the
+// incorrect indices, or ErrStaleLayout if the contents are swapped during the check
+func (db *Database) CheckScheme(scheme Scheme, groupSize, nprocs int) error {
+
+	c, err := db.newSchemeChecker(scheme, groupSize, nprocs)
+	if err != nil {
+		return err
+	}
+
+	switch scheme {
+	case SchemeDPFv1:
+		// payload-in-leaf two-party keys and multi-party keys
+		if err = c.checkShared(2, KeyPayloadInLeaf, 0); err == nil {
+			err = c.checkShared(3, KeyPayloadInLeaf, 0)
+		}
+	case SchemeDPFv2EarlyTerm:
+		if err = c.checkShared(2, KeyFullDepth, 0); err == nil {
+			err = c.checkShared(2, KeyEarlyTermination, earlyTerminationCheckGamma)
+		}
+		if err == nil {
+			err = c.checkShared(2, KeyAsymmetric, 0)
+		}
+	case SchemeAHEPaillierV1:
+		err = c.checkEncrypted()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.result()
+}
+
+// newSchemeChecker snapshots the metadata and the slots (in logical order) of the database
+func (db *Database) newSchemeChecker(scheme Scheme, groupSize, nprocs int) (*schemeChecker, error) {
+
+	if groupSize < 1 {
+		return nil, errors.New("group size must be positive")
+	}
+
+	switch scheme {
+	case SchemeDPFv1, SchemeDPFv2EarlyTerm, SchemeAHEPaillierV1:
+	default:
+		return nil, &UnsupportedSchemeError{Scheme: scheme, Supported: db.SupportedSchemes()}
+	}
+
+	db.mu.RLock()
+	dbmd := db.DBMetadata
+	want := db.Slots
+	if dbmd.GroupShuffle != nil && dbmd.GroupShuffle.GroupSize == groupSize {
+		// groups of other sizes are retrieved in stored order (see GroupPosition)
+		want = dbmd.GroupShuffle.unshuffle(db.Slots, dbmd.Epoch)
+	}
+	db.mu.RUnlock()
+
+	if dbmd.DBSize == 0 {
+		return nil, errors.New("database is empty")
+	}
+
+	return &schemeChecker{
+		db:        db,
+		dbmd:      &dbmd,
+		want:      want,
+		groupSize: groupSize,
+		layout:    dbmd.DefaultLayout(groupSize),
+		nprocs:    nprocs,
+		err:       &SchemeCheckError{Scheme: scheme, GroupSize: groupSize},
+	}, nil
+}
+
+type schemeChecker struct {
+	db        *Database
+	dbmd      *DBMetadata
+	want      []*Slot // slots in logical order
+	groupSize int
+	layout    Layout // layout of encrypted queries
+	nprocs    int
+
+	mu  sync.Mutex // guards err (see StressCheckScheme)
+	err *SchemeCheckError
+}
+
+// result returns the check error if any slot was recovered incorrectly
+func (c *schemeChecker) result() error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.err.Indices) > 0 {
+		sort.Ints(c.err.Indices)
+		return c.err
+	}
+
+	return nil
+}
+
+// checkShared retrieves every group using secret shared queries with the given keys
+func (c *schemeChecker) checkShared(numShares uint, variant KeyVariant, gamma uint) error {
+
+	numGroups := ceilDiv(c.dbmd.DBSize, c.groupSize)
+
+	for row := 0; row < numGroups; row++ {
+		if err := c.checkSharedRow(row, c.sharedQuery(row, numShares, variant, gamma)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sharedQuery returns the query shares retrieving the group (row) with the given keys
+func (c *schemeChecker) sharedQuery(row int, numShares uint, variant KeyVariant, gamma uint) []*QueryShare {
+
+	if numShares == 2 {
+		return c.dbmd.NewIndexQuerySharesWithKeyVariant(row, c.groupSize, variant, gamma)
+	}
+
+	return c.dbmd.NewIndexQueryShares(row, c.groupSize, numShares)
+}
+
+// checkSharedRow answers the query shares retrieving the group (row) and compares the recovered slots
+func (c *schemeChecker) checkSharedRow(row int, shares []*QueryShare) error {
+
+	resShares := make([]*SecretSharedQueryResult, len(shares))
+	for i, share := range shares {
+		res, err := c.db.AnswerSharedQuery(share, c.nprocs)
+		if err != nil {
+			return err
+		}
+		resShares[i] = res
+	}
+
+	slots, _ := c.dbmd.RecoverGroup(resShares, row)
+	c.compare(row*c.groupSize, c.dbmd.UnshuffleGroup(row, c.groupSize, slots))
+
+	return nil
+}
+
+// checkEncrypted retrieves every row of the layout using encrypted queries
+func (c *schemeChecker) checkEncrypted() error {
+
+	sk, pk := paillier.KeyGen(SchemeCheckKeyBits)
+
+	_, height := c.encryptedDimensions()
+
+	for row := 0; row < height; row++ {
+		if err := c.checkEncryptedRow(sk, c.encryptedQuery(pk, row), row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encryptedDimensions returns the layout used by encrypted queries
+// (the square-root layout of NewEncryptedQuery unless changed)
+func (c *schemeChecker) encryptedDimensions() (int, int) {
+	return c.layout.Width, c.layout.Height
+}
+
+// encryptedQuery returns the encrypted query retrieving the row of the layout
+func (c *schemeChecker) encryptedQuery(pk *paillier.PublicKey, row int) *EncryptedQuery {
+
+	width, height := c.encryptedDimensions()
+	return c.dbmd.NewEncryptedQueryWithDimentions(pk, width, height, c.groupSize, row)
+}
+
+// checkEncryptedRow answers the encrypted query retrieving the row and compares the recovered slots
+func (c *schemeChecker) checkEncryptedRow(sk *paillier.SecretKey, query *EncryptedQuery, row int) error {
+
+	width, _ := c.encryptedDimensions()
+
+	res, err := c.db.AnswerEncryptedQuery(query, c.nprocs)
+	if err != nil {
+		return err
+	}
+
+	slots, _, err := c.dbmd.RecoverEncryptedGroup(res, sk, row)
+	if err != nil {
+		return err
+	}
+
+	// rows are made of whole groups
+	for start := 0; start < len(slots); start += c.groupSize {
+		end := start + c.groupSize
+		if end > len(slots) {
+			end = len(slots)
+		}
+
+		index := row*width + start
+		group := c.dbmd.UnshuffleGroup(index/c.groupSize, c.groupSize, slots[start:end])
+		c.compare(index, group)
+	}
+
+	return nil
+}
+
+// compare records the indices of the slots (starting at index start) that do not match
+// the database; slots past the end of the database must be zero
+func (c *schemeChecker) compare(start int, slots []*Slot) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, slot := range slots {
+		index := start + i
+
+		var want *Slot
+		if index < c.dbmd.DBSize {
+			want = c.want[index]
+		} else {
+			want = NewEmptySlot(c.dbmd.SlotBytes)
+		}
+
+		if slot == nil || !slot.Equal(want) {
+			c.err.Indices = append(c.err.Indices, index)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+)
+
+// run with 'go test -v -run TestCheckScheme' to see log outputs.
+func TestCheckScheme(t *testing.T) {
+	setup()
+
+	defer func(bits int) { SchemeCheckKeyBits = bits }(SchemeCheckKeyBits)
+	SchemeCheckKeyBits = 128
+
+	// odd size so that the last row and group are partial
+	db := GenerateRandomDB(37, SlotBytes)
+
+	padded := NewDatabase()
+	data := make([][]byte, 23)
+	for i := range data {
+		data[i] = NewRandomSlot(1 + i%SlotBytes).Data
+	}
+	if err := padded.BuildForPaddedBinaryData(data, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	shuffled := GenerateRandomDB(37, SlotBytes)
+	if err := shuffled.ShuffleWithinGroups(4); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []*Database{db, padded, shuffled} {
+		for _, groupSize := range []int{1, 3, 4} {
+			for _, scheme := range ImplementedSchemes {
+				if err := d.CheckScheme(scheme, groupSize, NumProcsForQuery); err != nil {
+					t.Fatalf("Check failed (DB size %v, group size %v): %v\n", d.DBSize, groupSize, err)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckSchemeErrors(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	db.SetSupportedSchemes(SchemeDPFv1)
+
+	if err := db.CheckScheme(SchemeDPFv2EarlyTerm, 1, 1); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Expected an unsupported scheme error, got %v\n", err)
+	}
+
+	if err := db.CheckScheme(SchemeAHELWEv1, 1, 1); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Expected an unsupported scheme error, got %v\n", err)
+	}
+
+	if err := NewDatabase().CheckScheme(SchemeDPFv1, 1, 1); err == nil {
+		t.Fatalf("Check on an empty database succeeded")
+	}
+
+	// incorrect slots (and non-zero slots past the end) are reported
+	dbmd := db.Metadata()
+	c := &schemeChecker{
+		dbmd:      &dbmd,
+		want:      db.Slots,
+		groupSize: 2,
+		err:       &SchemeCheckError{Scheme: SchemeDPFv1, GroupSize: 2},
+	}
+	c.compare(TestDBSize-2, []*Slot{db.Slots[TestDBSize-2], NewRandomSlot(SlotBytes), NewRandomSlot(SlotBytes)})
+
+	if len(c.err.Indices) != 2 || c.err.Indices[0] != TestDBSize-1 || c.err.Indices[1] != TestDBSize {
+		t.Fatalf("Unexpected incorrect indices %v\n", c.err.Indices)
+	}
+
+	if !errors.Is(c.err, ErrSchemeCheckFailed) {
+		t.Fatalf("Check error does not match ErrSchemeCheckFailed")
+	}
+}
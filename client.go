@@ -0,0 +1,245 @@
+package pir
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+/*
+ Client with a cache of recovered slots.
+ The client retrieves slots using secret shared queries and (optionally)
+ keeps the recovered groups in an LRU cache keyed by (epoch, index) so
+ that repeated reads do not trigger repeated queries. Cached entries are
+ bounded in bytes, are dropped as soon as the client learns of a new
+ epoch and their contents are zeroed when evicted so that recovered
+ data does not linger in memory.
+*/
+
+// Client retrieves slots from a database replicated across servers
+type Client struct {
+	GroupSize int  // number of adjacent slots retrieved by each query
+	NumShares uint // number of servers
+	Retries   int  // number of times a failed query is retried with fresh shares (see QuerySet)
+
+	query QuerySharesFunc
+
+	mu    sync.Mutex
+	dbmd  DBMetadata
+	cache *slotCache
+}
+
+// NewClient returns a client for the database described by dbmd that sends
+// query shares to the servers using query
+func NewClient(dbmd DBMetadata, groupSize int, numShares uint, query QuerySharesFunc) *Client {
+	return &Client{
+		GroupSize: groupSize,
+		NumShares: numShares,
+		query:     query,
+		dbmd:      dbmd,
+	}
+}
+
+// EnableCache caches recovered slots using up to maxBytes of slot data.
+// A non-positive maxBytes disables (and clears) the cache
+func (c *Client) EnableCache(maxBytes int) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache != nil {
+		c.cache.clear()
+		c.cache = nil
+	}
+
+	if maxBytes > 0 {
+		c.cache = newSlotCache(maxBytes)
+	}
+}
+
+// InvalidateCache drops all cached slots
+func (c *Client) InvalidateCache() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache != nil {
+		c.cache.clear()
+	}
+}
+
+// Metadata returns the metadata used by the client
+func (c *Client) Metadata() DBMetadata {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.dbmd
+}
+
+// SetMetadata updates the metadata used by the client (e.g., after a swap).
+// Cached slots are dropped if the epoch changed
+func (c *Client) SetMetadata(dbmd DBMetadata) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache != nil && dbmd.Epoch != c.dbmd.Epoch {
+		c.cache.clear()
+	}
+
+	c.dbmd = dbmd
+}
+
+// Get returns the slot at index, from the cache if possible and otherwise by
+// privately retrieving its group. Returns ErrStaleLayout (from the servers)
+// if the metadata is outdated
+func (c *Client) Get(index int) (*Slot, error) {
+
+	c.mu.Lock()
+	dbmd := c.dbmd
+	if c.cache != nil {
+		if slot := c.cache.get(dbmd.Epoch, index); slot != nil {
+			c.mu.Unlock()
+			return slot, nil
+		}
+	}
+	c.mu.Unlock()
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, errors.New("index out of range")
+	}
+
+	// fail before querying servers that do not serve the query
+	if err := dbmd.CheckCapabilities(SchemeDPFv1, c.GroupSize); err != nil {
+		return nil, err
+	}
+
+	qs, err := dbmd.NewQuerySet(index, c.GroupSize, c.NumShares)
+	if err != nil {
+		return nil, err
+	}
+
+	row, pos := qs.Group()
+
+	var resShares []*SecretSharedQueryResult
+	for attempt := 0; ; attempt++ {
+		shares, err := qs.Shares()
+		if err != nil {
+			return nil, err
+		}
+
+		if resShares, err = c.query(shares); err == nil {
+			break
+		}
+
+		// stale metadata fails again until the client learns the new metadata
+		if attempt >= c.Retries || errors.Is(err, ErrStaleLayout) {
+			return nil, err
+		}
+
+		// never resend shares that were already sent
+		qs = qs.Refresh()
+	}
+
+	slots, valid := dbmd.RecoverGroup(resShares, row)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the group is only cached if the epoch has not changed in the meantime
+	if c.cache != nil && c.dbmd.Epoch == dbmd.Epoch {
+		for offset, slot := range dbmd.UnshuffleGroup(row, c.GroupSize, slots)[:valid] {
+			c.cache.put(dbmd.Epoch, row*c.GroupSize+offset, slot)
+		}
+	}
+
+	return slots[pos], nil
+}
+
+type slotCacheKey struct {
+	epoch int
+	index int
+}
+
+type slotCacheEntry struct {
+	key  slotCacheKey
+	slot *Slot
+}
+
+// slotCache is an LRU cache of slots bounded by the total size of the slot data
+type slotCache struct {
+	maxBytes int
+	numBytes int
+	entries  map[slotCacheKey]*list.Element
+	lru      *list.List // most recently used first
+}
+
+func newSlotCache(maxBytes int) *slotCache {
+	return &slotCache{
+		maxBytes: maxBytes,
+		entries:  make(map[slotCacheKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// get returns a copy of the cached slot or nil
+func (sc *slotCache) get(epoch, index int) *Slot {
+
+	elem, ok := sc.entries[slotCacheKey{epoch, index}]
+	if !ok {
+		return nil
+	}
+
+	sc.lru.MoveToFront(elem)
+	return copySlot(elem.Value.(*slotCacheEntry).slot)
+}
+
+// put caches a copy of the slot and evicts the least recently used slots
+// until the cache fits in maxBytes (slots larger than maxBytes are not cached)
+func (sc *slotCache) put(epoch, index int, slot *Slot) {
+
+	if len(slot.Data) > sc.maxBytes {
+		return
+	}
+
+	key := slotCacheKey{epoch, index}
+	if elem, ok := sc.entries[key]; ok {
+		sc.remove(elem)
+	}
+
+	sc.entries[key] = sc.lru.PushFront(&slotCacheEntry{key: key, slot: copySlot(slot)})
+	sc.numBytes += len(slot.Data)
+
+	for sc.numBytes > sc.maxBytes {
+		sc.remove(sc.lru.Back())
+	}
+}
+
+// remove drops the entry and zeroes its contents
+func (sc *slotCache) remove(elem *list.Element) {
+
+	entry := sc.lru.Remove(elem).(*slotCacheEntry)
+	delete(sc.entries, entry.key)
+	sc.numBytes -= len(entry.slot.Data)
+
+	for i := range entry.slot.Data {
+		entry.slot.Data[i] = 0
+	}
+}
+
+func (sc *slotCache) clear() {
+	for sc.lru.Len() > 0 {
+		sc.remove(sc.lru.Back())
+	}
+}
+
+func (sc *slotCache) len() int {
+	return sc.lru.Len()
+}
+
+func copySlot(slot *Slot) *Slot {
+	data := make([]byte, len(slot.Data))
+	copy(data, slot.Data)
+	return NewSlot(data)
+}
@@ -0,0 +1,109 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+)
+
+// run with 'go test -v -run TestClientCache' to see log outputs.
+func TestClientCache(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	numQueries := 0
+	answer := answerWith(db)
+	query := func(shares []*QueryShare) ([]*SecretSharedQueryResult, error) {
+		numQueries++
+		return answer(shares)
+	}
+
+	groupSize := 4
+	client := NewClient(db.Metadata(), groupSize, 2, query)
+	client.EnableCache(TestDBSize * SlotBytes)
+
+	// every slot of the retrieved group is cached
+	for i := 0; i < 2*groupSize; i++ {
+		slot, err := client.Get(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slot.Equal(db.Slots[i]) {
+			t.Fatalf("Incorrect slot at index %v: %v != %v\n", i, slot, db.Slots[i])
+		}
+	}
+
+	if numQueries != 2 {
+		t.Fatalf("Expected 2 queries, got %v\n", numQueries)
+	}
+
+	// the returned slots are copies
+	slot, _ := client.Get(0)
+	slot.Data[0]++
+	if slot, _ = client.Get(0); !slot.Equal(db.Slots[0]) {
+		t.Fatalf("Cached slot was modified through a returned slot")
+	}
+
+	// swapping in new contents makes the metadata (and the cache) stale
+	newDB := GenerateRandomDB(TestDBSize, SlotBytes)
+	if err := db.SwapIn(newDB.Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Get(2 * groupSize); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+
+	client.SetMetadata(db.Metadata())
+	if client.cache.len() != 0 {
+		t.Fatalf("Cache was not invalidated on epoch change")
+	}
+
+	numQueries = 0
+	if slot, _ = client.Get(0); !slot.Equal(newDB.Slots[0]) || numQueries != 1 {
+		t.Fatalf("Expected the new slot after one query, got %v after %v queries\n", slot, numQueries)
+	}
+
+	client.InvalidateCache()
+	if client.cache.len() != 0 {
+		t.Fatalf("Cache was not invalidated")
+	}
+}
+
+func TestClientCacheEviction(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	client := NewClient(db.Metadata(), 1, 2, answerWith(db))
+	client.EnableCache(3 * SlotBytes)
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.Get(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// index 0 is the least recently used after reading index 1 and 2 again
+	evicted := client.cache.entries[slotCacheKey{0, 0}].Value.(*slotCacheEntry).slot
+	client.Get(1)
+	client.Get(2)
+	client.Get(3)
+
+	if client.cache.len() != 3 || client.cache.numBytes != 3*SlotBytes {
+		t.Fatalf("Cache holds %v slots (%v bytes)\n", client.cache.len(), client.cache.numBytes)
+	}
+
+	if client.cache.get(0, 0) != nil || client.cache.get(0, 1) == nil {
+		t.Fatalf("Incorrect slot evicted")
+	}
+
+	if !evicted.Equal(NewEmptySlot(SlotBytes)) {
+		t.Fatalf("Evicted slot was not zeroed")
+	}
+
+	client.EnableCache(0)
+	if _, err := client.Get(0); err != nil || client.cache != nil {
+		t.Fatalf("Cache was not disabled")
+	}
+}
@@ -0,0 +1,70 @@
+// Command pir-lint checks that a serialized query (see pir.LintQuery) is
+// well-formed for the layout of a database described by its metadata,
+// without a server. The metadata file is a JSON encoded pir.DBMetadata.
+// The exit status is 1 if the query has problems and 2 if the files
+// cannot be read or decoded.
+//
+// Usage:
+//
+//	go run ./cmd/pir-lint -metadata metadata.json -query query.bin
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/sachaservan/pir"
+)
+
+func main() {
+
+	metadataPath := flag.String("metadata", "", "JSON encoded metadata of the database")
+	queryPath := flag.String("query", "", "serialized query (query share, encrypted or doubly encrypted query)")
+	flag.Parse()
+
+	if *metadataPath == "" || *queryPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	log.SetFlags(0)
+
+	b, err := os.ReadFile(*metadataPath)
+	if err != nil {
+		fail(err)
+	}
+
+	var dbmd pir.DBMetadata
+	if err := json.Unmarshal(b, &dbmd); err != nil {
+		fail(fmt.Errorf("decoding metadata: %v", err))
+	}
+
+	payload, err := os.ReadFile(*queryPath)
+	if err != nil {
+		fail(err)
+	}
+
+	report, err := pir.LintQuery(&dbmd, payload)
+	if err != nil {
+		fail(fmt.Errorf("decoding query: %v", err))
+	}
+
+	if report.OK() {
+		fmt.Printf("ok: %v (scheme %q)\n", report.Kind, report.Scheme)
+		return
+	}
+
+	fmt.Printf("%v (scheme %q) has %v problems:\n", report.Kind, report.Scheme, len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Printf("  %v\n", problem)
+	}
+	os.Exit(1)
+}
+
+func fail(err error) {
+	log.Print(err)
+	os.Exit(2)
+}
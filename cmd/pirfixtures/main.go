@@ -0,0 +1,37 @@
+// Command pirfixtures writes the conformance fixtures of the binary encoding
+// (see pir.GenerateConformanceFixtures) to a directory.
+//
+// Usage (from the repository root):
+//
+//	go run ./cmd/pirfixtures -out testdata/fixtures
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/sachaservan/pir"
+)
+
+func main() {
+
+	out := flag.String("out", "testdata/fixtures", "output directory")
+	flag.Parse()
+
+	for _, seed := range pir.ConformanceFixtureSeeds {
+		fixtures, err := pir.GenerateConformanceFixtures(seed)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, fixture := range fixtures {
+			path := filepath.Join(*out, fixture.Name)
+			if err := os.WriteFile(path, fixture.Data, 0644); err != nil {
+				log.Fatal(err)
+			}
+			log.Printf("wrote %v (%v bytes)\n", path, len(fixture.Data))
+		}
+	}
+}
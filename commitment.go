@@ -1,9 +1,8 @@
 package pir
 
 import (
-	"bytes"
 	"crypto/sha256"
-	"math/rand"
+	"crypto/subtle"
 
 	"github.com/ncw/gmp"
 )
@@ -19,7 +18,7 @@ type ROCommitment struct {
 // Commit uses the random oracle to generate a commitment
 func Commit(value *gmp.Int) *ROCommitment {
 	rBytes := make([]byte, 32)
-	rand.Read(rBytes)
+	randomBytes(rBytes)
 	r := new(gmp.Int).SetBytes(rBytes)
 	comm := &ROCommitment{
 		HashBytes: RandomOracleDigest(value, r),
@@ -34,7 +33,7 @@ func (c *ROCommitment) CheckOpen(value *gmp.Int) bool {
 	hash1 := RandomOracleDigest(value, c.R)
 	hash2 := c.HashBytes
 
-	return bytes.Equal(hash1, hash2)
+	return subtle.ConstantTimeCompare(hash1, hash2) == 1
 }
 
 // RandomOracleDigest returns the digest of all the input bytes
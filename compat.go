@@ -0,0 +1,81 @@
+package pir
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math"
+	mrand "math/rand"
+	"sync/atomic"
+)
+
+/*
+ Compatibility switches for legacy behaviors.
+ Some behaviors of earlier releases were replaced by corrected
+ implementations that are not compatible with them: layout math with
+ floats (see intmath.go), trailing zero bytes stripped from the values
+ of slots that are not length prefixed (see DecodeSlot) and client-side
+ randomness drawn from math/rand (the order of the real and fake queries
+ of an authenticated query, the dummy rows of batch queries, commitment
+ randomness and the offsets of hint queries). Deployments that still
+ talk to (or store data from) older releases turn the legacy behaviors
+ back on one at a time with SetCompat and migrate incrementally; the
+ zero Compat selects the corrected implementations. Clients and servers
+ must agree on FloatLayoutMath, since it changes the domain of the DPF
+ keys of some layouts.
+*/
+
+// Compat selects legacy behaviors (the zero value selects none)
+type Compat struct {
+	FloatLayoutMath    bool // compute square roots and domain bits with floats
+	StripTrailingZeros bool // DecodeSlot strips trailing zero bytes of slots that are not length prefixed
+	MathRand           bool // draw client-side randomness from math/rand instead of crypto/rand
+}
+
+var compat atomic.Value // Compat
+
+// SetCompat selects the legacy behaviors used by the package
+func SetCompat(c Compat) {
+	compat.Store(c)
+}
+
+// CurrentCompat returns the legacy behaviors used by the package
+func CurrentCompat() Compat {
+
+	c, _ := compat.Load().(Compat)
+	return c
+}
+
+// randomIntn returns a uniformly random integer in [0, n) for n > 0, drawn
+// from crypto/rand (or from math/rand with Compat.MathRand)
+func randomIntn(n int) int {
+
+	if CurrentCompat().MathRand {
+		return mrand.Intn(n)
+	}
+
+	// rejection sampling over the largest multiple of n
+	limit := math.MaxUint64 - math.MaxUint64%uint64(n)
+	var buf [8]byte
+	for {
+		if _, err := crand.Read(buf[:]); err != nil {
+			panic("crypto/rand failed: " + err.Error())
+		}
+		if v := binary.BigEndian.Uint64(buf[:]); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// randomBytes fills b with random bytes drawn from crypto/rand
+// (or from math/rand with Compat.MathRand)
+func randomBytes(b []byte) {
+
+	if CurrentCompat().MathRand {
+		mrand.Read(b)
+		return
+	}
+
+	if _, err := crand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+}
@@ -0,0 +1,115 @@
+package pir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompatDefault(t *testing.T) {
+
+	if CurrentCompat() != (Compat{}) {
+		t.Fatalf("Legacy behaviors are selected by default: %+v\n", CurrentCompat())
+	}
+}
+
+func TestCompatStripTrailingZeros(t *testing.T) {
+
+	defer SetCompat(Compat{})
+
+	dbmd := &DBMetadata{DBSize: 1}
+	slot := NewSlot([]byte{1, 2, 0, 0})
+
+	value, err := dbmd.DecodeSlot(slot)
+	if err != nil || !bytes.Equal(value, slot.Data) {
+		t.Fatalf("Unexpected value %v (%v)\n", value, err)
+	}
+
+	SetCompat(Compat{StripTrailingZeros: true})
+
+	value, err = dbmd.DecodeSlot(slot)
+	if err != nil || !bytes.Equal(value, []byte{1, 2}) {
+		t.Fatalf("Unexpected legacy value %v (%v)\n", value, err)
+	}
+}
+
+func TestCompatFloatLayoutMath(t *testing.T) {
+
+	defer SetCompat(Compat{})
+
+	for _, compat := range []Compat{{}, {FloatLayoutMath: true}} {
+		SetCompat(compat)
+
+		// both versions agree away from the rounding errors of large numbers
+		for n := 1; n < 1<<16; n++ {
+			if bitLength(n) != bitLength64(n) {
+				t.Fatalf("bitLength(%v) = %v with %+v\n", n, bitLength(n), compat)
+			}
+			if r := ceilSqrt(n); r*r < n || (r-1)*(r-1) >= n {
+				t.Fatalf("ceilSqrt(%v) = %v with %+v\n", n, r, compat)
+			}
+		}
+
+		db := GenerateRandomDB(TestDBSize, SlotBytes)
+		for groupSize := 1; groupSize < 4; groupSize++ {
+			for row := 0; row < ceilDiv(TestDBSize, groupSize); row += 37 {
+				shares := db.NewIndexQueryShares(row, groupSize, 2)
+				results := make([]*SecretSharedQueryResult, len(shares))
+				for i, share := range shares {
+					res, err := db.PrivateSecretSharedQuery(share, NumProcsForQuery)
+					if err != nil {
+						t.Fatal(err)
+					}
+					results[i] = res
+				}
+
+				for j, slot := range Recover(results) {
+					index := row*groupSize + j
+					if index < TestDBSize && !bytes.Equal(slot.Data, db.Slots[index].Data) {
+						t.Fatalf("Query result is incorrect with %+v\n", compat)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCompatMathRand(t *testing.T) {
+
+	defer SetCompat(Compat{})
+
+	for _, compat := range []Compat{{}, {MathRand: true}} {
+		SetCompat(compat)
+
+		seen := make([]bool, 5)
+		for i := 0; i < 1000; i++ {
+			v := randomIntn(len(seen))
+			if v < 0 || v >= len(seen) {
+				t.Fatalf("randomIntn returned %v with %+v\n", v, compat)
+			}
+			seen[v] = true
+		}
+
+		for v, ok := range seen {
+			if !ok {
+				t.Fatalf("randomIntn never returned %v with %+v\n", v, compat)
+			}
+		}
+
+		b := make([]byte, 32)
+		randomBytes(b)
+		if bytes.Equal(b, make([]byte, 32)) {
+			t.Fatalf("randomBytes returned zeros with %+v\n", compat)
+		}
+	}
+}
+
+// bitLength64 is the number of bits of n computed with shifts
+func bitLength64(n int) uint {
+
+	res := uint(0)
+	for ; n > 0; n >>= 1 {
+		res++
+	}
+
+	return res
+}
@@ -0,0 +1,92 @@
+package pir
+
+import (
+	"crypto/subtle"
+)
+
+/*
+ Constant-time slot operations.
+ The selection bits of a secret shared query are a share of the
+ selected row: a scan that skips the rows whose bit is zero runs in
+ time depending on the share, which a co-tenant timing the server (or
+ watching its cache) can observe. XorSlots, Slot.Equal and Slot.Compare
+ branch on the data they process, so the scans and the checks of secret
+ values (audit tokens, commitment openings) use the variants below,
+ whose running time only depends on the lengths of the slots. The scans
+ XOR every row masked by its selection bit, which doubles the XOR work
+ of a secret shared query on average.
+*/
+
+// ConditionalXorSlots computes a ^= b if choice is true and leaves a unchanged otherwise,
+// in time independent of choice and of the data
+func ConditionalXorSlots(a, b *Slot, choice bool) {
+
+	mask := choiceMask(choice)
+
+	n := len(a.Data)
+	if len(b.Data) < n {
+		n = len(b.Data)
+	}
+
+	for j := 0; j < n; j++ {
+		a.Data[j] ^= b.Data[j] & mask
+	}
+}
+
+// choiceMask returns 0xff if choice is true and 0 otherwise
+// (compiled to a flag move rather than a branch)
+func choiceMask(choice bool) byte {
+
+	var b byte
+	if choice {
+		b = 1
+	}
+
+	return -b
+}
+
+// EqualConstantTime reports whether the slots hold the same data in time
+// independent of the data (see Equal)
+func (slot *Slot) EqualConstantTime(other *Slot) bool {
+
+	if slot == nil || other == nil {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(slot.Data, other.Data) == 1
+}
+
+// CompareConstantTime returns the comparison of the two byte arrays (see Compare)
+// in time independent of the data of the shortest array
+func (slot *Slot) CompareConstantTime(other *Slot) int {
+
+	n := len(slot.Data)
+	if len(other.Data) < n {
+		n = len(other.Data)
+	}
+
+	// the first differing byte decides; the following bytes are still visited
+	res, decided := 0, 0
+	for j := 0; j < n; j++ {
+		x, y := int(slot.Data[j]), int(other.Data[j])
+		lt := ((x - y) >> 8) & 1
+		gt := ((y - x) >> 8) & 1
+
+		res += (1 ^ decided) * (gt - lt)
+		decided |= lt | gt
+	}
+
+	if res != 0 {
+		return res
+	}
+
+	// the lengths are public
+	switch {
+	case len(slot.Data) < len(other.Data):
+		return -1
+	case len(slot.Data) > len(other.Data):
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,48 @@
+package pir
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestConstantTimeSlotOps(t *testing.T) {
+
+	for trial := 0; trial < 1000; trial++ {
+		a := NewSlot(make([]byte, rand.Intn(4)))
+		b := NewSlot(make([]byte, rand.Intn(4)))
+
+		// small alphabet to exercise equal prefixes
+		for i := range a.Data {
+			a.Data[i] = byte(rand.Intn(3))
+		}
+		for i := range b.Data {
+			b.Data[i] = byte(rand.Intn(3)) * 127
+		}
+
+		if got, want := a.CompareConstantTime(b), bytes.Compare(a.Data, b.Data); got != want {
+			t.Fatalf("CompareConstantTime(%v, %v) = %v instead of %v\n", a.Data, b.Data, got, want)
+		}
+
+		if a.EqualConstantTime(b) != a.Equal(b) {
+			t.Fatalf("EqualConstantTime(%v, %v) != Equal\n", a.Data, b.Data)
+		}
+
+		for _, choice := range []bool{false, true} {
+			xored := NewSlot(append([]byte{}, a.Data...))
+			want := NewSlot(append([]byte{}, a.Data...))
+			if choice {
+				XorSlots(want, b)
+			}
+
+			ConditionalXorSlots(xored, b, choice)
+			if !xored.Equal(want) {
+				t.Fatalf("ConditionalXorSlots(%v, %v, %v) = %v\n", a.Data, b.Data, choice, xored.Data)
+			}
+		}
+	}
+
+	if (*Slot)(nil).EqualConstantTime(NewEmptySlot(0)) {
+		t.Fatalf("A nil slot is equal to an empty slot\n")
+	}
+}
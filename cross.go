@@ -0,0 +1,196 @@
+package pir
+
+import (
+	"errors"
+)
+
+/*
+ Cross queries.
+ Grid-structured data (tiles of a map, cells of a table) is stored row by
+ row in a Width x Height grid. A cross query retrieves the row of a slot
+ together with its column, e.g. the neighbors of a tile in both
+ directions. Sending a row query and a column query separately would let
+ the servers correlate them by their timing; a cross query sends both
+ in a single message that the servers answer together. The column is
+ retrieved by a query over the transposed grid (one row per column of
+ the grid; see transposedMetadata), so the servers scan the database
+ twice and return Width + Height slots. Both queries address the slots
+ in logical order (see ShuffleWithinGroups).
+*/
+
+// CrossQueryShare is a share of a query retrieving the row and the column of a slot
+// of the database viewed as a Width x Height grid (Height = ceil(DBSize / Width))
+type CrossQueryShare struct {
+	Width  int
+	Row    *QueryShare // over the rows of the grid (Width slots each)
+	Column *QueryShare // over the columns of the grid (Height slots each)
+}
+
+// CrossQueryResult contains the result shares of the row and of the column
+type CrossQueryResult struct {
+	Row    *SecretSharedQueryResult
+	Column *SecretSharedQueryResult
+}
+
+// NewCrossQueryShares generates PIR query shares for the row and the column of the slot
+// at index in the database viewed as a width-wide grid
+func (dbmd *DBMetadata) NewCrossQueryShares(index, width int, numShares uint) ([]*CrossQueryShare, error) {
+
+	if width <= 0 {
+		return nil, errors.New("grid width must be positive")
+	}
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, errors.New("index out of range")
+	}
+
+	row, col := dbmd.IndexToCoordinates(index, width, ceilDiv(dbmd.DBSize, width))
+
+	rowShares := dbmd.logicalMetadata().NewIndexQueryShares(row, width, numShares)
+	colShares := dbmd.transposedMetadata(width).NewIndexQueryShares(col, ceilDiv(dbmd.DBSize, width), numShares)
+
+	shares := make([]*CrossQueryShare, numShares)
+	for i := range shares {
+		shares[i] = &CrossQueryShare{
+			Width:  width,
+			Row:    rowShares[i],
+			Column: colShares[i],
+		}
+	}
+
+	return shares, nil
+}
+
+// PrivateSecretSharedCrossQuery answers the row and the column queries of the cross query share
+func (db *Database) PrivateSecretSharedCrossQuery(query *CrossQueryShare, nprocs int) (*CrossQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateSecretSharedCrossQuery(query, nprocs)
+}
+
+func (db *Database) privateSecretSharedCrossQuery(query *CrossQueryShare, nprocs int) (*CrossQueryResult, error) {
+
+	if query.Width <= 0 || query.Row == nil || query.Column == nil {
+		return nil, errors.New("invalid cross query")
+	}
+
+	height := ceilDiv(db.DBSize, query.Width)
+	if query.Row.GroupSize != query.Width || query.Column.GroupSize != height {
+		return nil, ErrStaleLayout
+	}
+
+	if query.Row.IsKeywordBased || query.Column.IsKeywordBased {
+		return nil, errors.New("cross queries only support index query shares")
+	}
+
+	slots, attributes := db.Slots, db.Attributes
+	if db.GroupShuffle != nil {
+		slots = db.GroupShuffle.unshuffle(slots, db.Epoch)
+		attributes = db.GroupShuffle.applyToAttributes(attributes, db.Epoch, true)
+	}
+
+	rows := &Database{
+		DBMetadata:       *db.logicalMetadata(),
+		Slots:            slots,
+		Attributes:       attributes,
+		queryMemoryLimit: db.queryMemoryLimit,
+	}
+
+	// slot (row, col) of the grid is at col*height + row in the transposed grid
+	cols := &Database{
+		DBMetadata:       *db.transposedMetadata(query.Width),
+		Slots:            make([]*Slot, query.Width*height),
+		queryMemoryLimit: db.queryMemoryLimit,
+	}
+
+	if attributes != nil {
+		cols.Attributes = make([]uint64, len(cols.Slots))
+	}
+
+	for col := 0; col < query.Width; col++ {
+		for row := 0; row < height; row++ {
+			index := row*query.Width + col
+			pos := col*height + row
+
+			if index >= db.DBSize {
+				cols.Slots[pos] = NewEmptySlot(db.SlotBytes)
+				continue
+			}
+
+			cols.Slots[pos] = slots[index]
+			if attributes != nil {
+				cols.Attributes[pos] = attributes[index]
+			}
+		}
+	}
+
+	rowRes, err := rows.privateSecretSharedQuery(query.Row, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	colRes, err := cols.privateSecretSharedQuery(query.Column, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrossQueryResult{Row: rowRes, Column: colRes}, nil
+}
+
+// RecoverCross recovers the row of the slot at index and the slots of its column
+// within radius rows of it (the slot itself is included in both).
+// The row and the column are in logical order and the slots outside of the
+// database are omitted
+func (dbmd *DBMetadata) RecoverCross(resShares []*CrossQueryResult, index, width, radius int) ([]*Slot, []*Slot, error) {
+
+	if len(resShares) == 0 || width <= 0 {
+		return nil, nil, errors.New("invalid cross query results")
+	}
+
+	rowShares := make([]*SecretSharedQueryResult, len(resShares))
+	colShares := make([]*SecretSharedQueryResult, len(resShares))
+	for i, res := range resShares {
+		rowShares[i], colShares[i] = res.Row, res.Column
+	}
+
+	height := ceilDiv(dbmd.DBSize, width)
+	row, col := dbmd.IndexToCoordinates(index, width, height)
+
+	rowSlots := Recover(rowShares)
+	colSlots := Recover(colShares)
+
+	if len(rowSlots) != width || len(colSlots) != height {
+		return nil, nil, errors.New("invalid cross query results")
+	}
+
+	rowSlots = rowSlots[:dbmd.numSlotsInDatabase(row*width, width)]
+
+	var neighbors []*Slot
+	for r := row - radius; r <= row+radius; r++ {
+		if r >= 0 && r < height && r*width+col < dbmd.DBSize {
+			neighbors = append(neighbors, colSlots[r])
+		}
+	}
+
+	return rowSlots, neighbors, nil
+}
+
+// logicalMetadata returns the metadata of the database with the slots in logical order
+func (dbmd *DBMetadata) logicalMetadata() *DBMetadata {
+	return &DBMetadata{
+		SlotBytes:      dbmd.SlotBytes,
+		DBSize:         dbmd.DBSize,
+		Epoch:          dbmd.Epoch,
+		LengthPrefixed: dbmd.LengthPrefixed,
+	}
+}
+
+// transposedMetadata returns the metadata of the database viewed as a width-wide grid
+// and stored column by column (the cells after the last slot of the grid are empty)
+func (dbmd *DBMetadata) transposedMetadata(width int) *DBMetadata {
+	md := dbmd.logicalMetadata()
+	md.DBSize = width * ceilDiv(dbmd.DBSize, width)
+	return md
+}
@@ -0,0 +1,81 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestCrossQuery' to see log outputs.
+func TestCrossQuery(t *testing.T) {
+	setup()
+
+	dbSize := TestDBSize - 5 // the last row of the grid is partial
+	db := GenerateRandomDB(dbSize, SlotBytes)
+	original := make([]*Slot, dbSize)
+	copy(original, db.Slots)
+
+	width := 16
+	if err := db.ShuffleWithinGroups(width); err != nil {
+		t.Fatal(err)
+	}
+
+	md := db.Metadata()
+	radius := 2
+
+	for _, numShares := range []uint{2, 3} {
+		for _, index := range []int{0, dbSize - 1, rand.Intn(dbSize)} {
+
+			shares, err := md.NewCrossQueryShares(index, width, numShares)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results := make([]*CrossQueryResult, numShares)
+			for s := range shares {
+				if results[s], err = db.PrivateSecretSharedCrossQuery(shares[s], NumProcsForQuery); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			row, column, err := md.RecoverCross(results, index, width, radius)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := index - index%width
+			for i, slot := range row {
+				if !original[start+i].Equal(slot) {
+					t.Fatalf("Row slot %v is incorrect\n", start+i)
+				}
+			}
+
+			var expected []*Slot
+			for r := index/width - radius; r <= index/width+radius; r++ {
+				if i := r*width + index%width; r >= 0 && i < dbSize {
+					expected = append(expected, original[i])
+				}
+			}
+
+			if len(column) != len(expected) {
+				t.Fatalf("Recovered %v column neighbors, expected %v\n", len(column), len(expected))
+			}
+
+			for i := range expected {
+				if !expected[i].Equal(column[i]) {
+					t.Fatalf("Column neighbor %v of index %v is incorrect\n", i, index)
+				}
+			}
+		}
+	}
+
+	// queries generated for another grid width are rejected
+	shares, err := md.NewCrossQueryShares(0, width, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares[0].Width = width / 2
+	if _, err := db.PrivateSecretSharedCrossQuery(shares[0], 1); err == nil {
+		t.Fatalf("Answered a cross query with the wrong width\n")
+	}
+}
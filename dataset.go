@@ -0,0 +1,195 @@
+package pir
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+ Schema-aware databases where each slot packs a record of typed fields.
+ The schema (with the offset of each field) is published in the metadata
+ so that clients can decode the slots they retrieve into records.
+*/
+
+// FieldType is the type of a record field
+type FieldType int
+
+const (
+	// FieldUint64 is an unsigned integer (8 bytes, big-endian)
+	FieldUint64 FieldType = iota
+	// FieldInt64 is a signed integer (8 bytes, big-endian two's complement)
+	FieldInt64
+	// FieldString is a string of at most Size bytes (zero padded)
+	FieldString
+	// FieldBytes is a byte string of exactly Size bytes
+	FieldBytes
+)
+
+// Field describes a field of a record
+type Field struct {
+	Name   string
+	Type   FieldType
+	Size   int // bytes (set automatically for integer fields)
+	Offset int // offset of the field in the slot (set by NewSchema)
+}
+
+// Schema describes the layout of the records stored in the slots
+type Schema struct {
+	Fields      []Field
+	RecordBytes int
+}
+
+// Record maps field names to values (uint64, int64, string or []byte
+// depending on the field type)
+type Record map[string]interface{}
+
+// NewSchema returns a schema with the fields laid out in order
+func NewSchema(fields ...Field) (*Schema, error) {
+
+	schema := &Schema{Fields: make([]Field, len(fields))}
+	names := make(map[string]bool)
+
+	for i, f := range fields {
+		if names[f.Name] {
+			return nil, fmt.Errorf("duplicate field %v", f.Name)
+		}
+		names[f.Name] = true
+
+		switch f.Type {
+		case FieldUint64, FieldInt64:
+			f.Size = 8
+		case FieldString, FieldBytes:
+			if f.Size <= 0 {
+				return nil, fmt.Errorf("field %v must have a positive size", f.Name)
+			}
+		default:
+			return nil, fmt.Errorf("field %v has an unknown type", f.Name)
+		}
+
+		f.Offset = schema.RecordBytes
+		schema.RecordBytes += f.Size
+		schema.Fields[i] = f
+	}
+
+	return schema, nil
+}
+
+// Encode packs the record into a slot
+func (schema *Schema) Encode(rec Record) (*Slot, error) {
+
+	data := make([]byte, schema.RecordBytes)
+
+	for _, f := range schema.Fields {
+		value, ok := rec[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("record is missing field %v", f.Name)
+		}
+
+		buf := data[f.Offset : f.Offset+f.Size]
+
+		switch f.Type {
+		case FieldUint64:
+			v, ok := value.(uint64)
+			if !ok {
+				return nil, fmt.Errorf("field %v must be a uint64", f.Name)
+			}
+			binary.BigEndian.PutUint64(buf, v)
+		case FieldInt64:
+			v, ok := value.(int64)
+			if !ok {
+				return nil, fmt.Errorf("field %v must be an int64", f.Name)
+			}
+			binary.BigEndian.PutUint64(buf, uint64(v))
+		case FieldString:
+			v, ok := value.(string)
+			if !ok || len(v) > f.Size {
+				return nil, fmt.Errorf("field %v must be a string of at most %v bytes", f.Name, f.Size)
+			}
+			copy(buf, v)
+		case FieldBytes:
+			v, ok := value.([]byte)
+			if !ok || len(v) != f.Size {
+				return nil, fmt.Errorf("field %v must be %v bytes", f.Name, f.Size)
+			}
+			copy(buf, v)
+		}
+	}
+
+	return NewSlot(data), nil
+}
+
+// Decode unpacks the record stored in a slot.
+// Trailing zero bytes of string fields are removed
+func (schema *Schema) Decode(slot *Slot) (Record, error) {
+
+	if len(slot.Data) != schema.RecordBytes {
+		return nil, errors.New("slot size does not match the schema")
+	}
+
+	rec := make(Record, len(schema.Fields))
+
+	for _, f := range schema.Fields {
+		buf := slot.Data[f.Offset : f.Offset+f.Size]
+
+		switch f.Type {
+		case FieldUint64:
+			rec[f.Name] = binary.BigEndian.Uint64(buf)
+		case FieldInt64:
+			rec[f.Name] = int64(binary.BigEndian.Uint64(buf))
+		case FieldString:
+			end := len(buf)
+			for end > 0 && buf[end-1] == 0 {
+				end--
+			}
+			rec[f.Name] = string(buf[:end])
+		case FieldBytes:
+			v := make([]byte, f.Size)
+			copy(v, buf)
+			rec[f.Name] = v
+		}
+	}
+
+	return rec, nil
+}
+
+// BuildForRecords constructs a PIR database where each record gets a slot
+// and publishes the schema in the metadata
+func (db *Database) BuildForRecords(schema *Schema, records []Record) error {
+
+	slots := make([]*Slot, len(records))
+	for i, rec := range records {
+		slot, err := schema.Encode(rec)
+		if err != nil {
+			return err
+		}
+		slots[i] = slot
+	}
+
+	db.install(&builtContents{
+		slots:     slots,
+		slotBytes: schema.RecordBytes,
+		schema:    schema,
+	})
+
+	return nil
+}
+
+// RecoverRecords decodes the recovered slots into records using the schema in the metadata
+func (dbmd *DBMetadata) RecoverRecords(slots []*Slot) ([]Record, error) {
+
+	if dbmd.Schema == nil {
+		return nil, errors.New("metadata does not contain a schema")
+	}
+
+	records := make([]Record, len(slots))
+	for i, slot := range slots {
+		rec, err := dbmd.Schema.Decode(slot)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = rec
+	}
+
+	return records, nil
+}
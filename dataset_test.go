@@ -0,0 +1,80 @@
+package pir
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// run with 'go test -v -run TestRecordQuery' to see log outputs.
+func TestRecordQuery(t *testing.T) {
+	setup()
+
+	schema, err := NewSchema(
+		Field{Name: "id", Type: FieldUint64},
+		Field{Name: "balance", Type: FieldInt64},
+		Field{Name: "name", Type: FieldString, Size: 10},
+		Field{Name: "tag", Type: FieldBytes, Size: 2},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schema.RecordBytes != 28 || schema.Fields[2].Offset != 16 {
+		t.Fatalf("Incorrect layout: %v bytes, name at offset %v\n", schema.RecordBytes, schema.Fields[2].Offset)
+	}
+
+	records := make([]Record, TestDBSize)
+	for i := range records {
+		records[i] = Record{
+			"id":      uint64(i),
+			"balance": int64(rand.Intn(1000) - 500),
+			"name":    "user" + strconv.Itoa(i),
+			"tag":     []byte{byte(i), 0},
+		}
+	}
+
+	db := NewDatabase()
+	if err := db.BuildForRecords(schema, records); err != nil {
+		t.Fatal(err)
+	}
+
+	md := db.Metadata()
+
+	for i := 0; i < NumQueries; i++ {
+		qIndex := rand.Intn(TestDBSize)
+		shares := md.NewIndexQueryShares(qIndex, 1, 2)
+
+		resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := md.RecoverRecords(Recover([]*SecretSharedQueryResult{resA, resB}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := records[qIndex]
+		if res[0]["id"] != expected["id"] ||
+			res[0]["balance"] != expected["balance"] ||
+			res[0]["name"] != expected["name"] ||
+			!bytes.Equal(res[0]["tag"].([]byte), expected["tag"].([]byte)) {
+			t.Fatalf("Query result is incorrect. %v != %v\n", expected, res[0])
+		}
+	}
+
+	if _, err := schema.Encode(Record{"id": 1}); err == nil {
+		t.Fatalf("Did not throw error on a record with missing fields")
+	}
+
+	if _, err := NewSchema(Field{Name: "a", Type: FieldString}); err == nil {
+		t.Fatalf("Did not throw error on a string field without a size")
+	}
+}
@@ -1,8 +1,9 @@
 package pir
 
 import (
+	"context"
 	"errors"
-	"math"
+	"fmt"
 	"sync"
 
 	"github.com/ncw/gmp"
@@ -13,16 +14,49 @@ import (
 // DBMetadata contains information on the layout
 // and size information for a slot database type
 type DBMetadata struct {
-	SlotBytes int
-	DBSize    int
+	SlotBytes         int
+	DBSize            int
+	Epoch             int                 // incremented every time the database contents are swapped
+	KeywordCommitment []byte              // Merkle root binding keywords to slots (optional)
+	LengthPrefixed    bool                // slots are encoded using NewLengthPrefixedSlot
+	Schema            *Schema             // layout of the records packed in each slot (optional)
+	NumPaddingSlots   int                 // the last NumPaddingSlots slots are padding
+	GroupShuffle      *GroupShuffle       // permutation of the slots within groups (optional)
+	Capabilities      *ServerCapabilities // hints on the queries the server can serve (optional)
+	SlotKeyID         string              // ID of the key encrypting the slots at rest (optional)
+	KeywordBits       int                 // bits of the domain of keyword queries (DefaultKeywordBits if zero)
+	KeywordDigest     []byte              // hash of the keywords of the rows (see CheckPeerKeywords)
+	KeyValue          *KeyValueLayout     // cuckoo hash tables of a key-value database (optional)
+	LogTree           *LogTreeHead        // tree head the slots of a log database are proven against (optional)
 }
 
 // Database is a set of slots arranged in a grid of size width x height
-// where each slot has size slotBytes
+// where each slot has size slotBytes.
+// Queries are safe for concurrent use with each other and with the methods
+// replacing the contents (the Build functions, SetKeywords, SwapIn, ...)
 type Database struct {
 	DBMetadata
 	Slots    []*Slot
 	Keywords []uint // set of keywords (optional)
+
+	// public attribute bitmap of each slot in storage order (optional; see SetAttributes)
+	Attributes []uint64
+
+	mu            sync.RWMutex // held for reading while answering queries and for writing while replacing contents
+	swapListeners []func(epoch int)
+	pkCache       publicKeyCache // values derived from client public keys
+
+	records          *RecordIndex  // indices of the source values (see IndexOf)
+	supportedSchemes []Scheme      // schemes answered by the dispatcher (all implemented if empty)
+	keywordLayer     bool          // second layer of a PrivateSqrtST
+	queryMemoryLimit int64         // see SetQueryMemoryLimit
+	tracer           *QueryTracer  // see SetQueryTracer
+	selfCheck        SiblingShares // see SetSelfCheck
+
+	numaAlloc      NodeAllocator // set by PartitionForNUMA
+	numaPartitions []RowRange    // slots stored on each node
+
+	mappings []*fileMapping // memory-mapped database files (see LoadFromFile)
 }
 
 // SecretSharedQueryResult contains shares of the resulting slots
@@ -49,6 +83,12 @@ type EncryptedQueryResult struct {
 	Pk                    *paillier.PublicKey
 	SlotBytes             int
 	NumBytesPerCiphertext int
+
+	// fingerprint of the key the slots are encrypted under (see PublicKeyFingerprint)
+	KeyFingerprint KeyFingerprint
+
+	// ciphertexts of the slots in place of Slots (see PackEncryptedResult)
+	Packed *PackedCiphertexts
 }
 
 // DoublyEncryptedQueryResult is an array of encrypted slots
@@ -57,6 +97,14 @@ type DoublyEncryptedQueryResult struct {
 	Pk                    *paillier.PublicKey
 	SlotBytes             int
 	NumBytesPerCiphertext int
+
+	// fingerprint of the key the slots are encrypted under (see PublicKeyFingerprint)
+	KeyFingerprint KeyFingerprint
+
+	// level-1 ciphertexts too large for the level-2 plaintext space of Pk are split into
+	// ChunksPerCiphertext ciphertexts of ChunkBytes bytes (zero if not split; see levelsplit.go)
+	ChunksPerCiphertext int
+	ChunkBytes          int
 }
 
 // NewDatabase returns an empty database
@@ -67,16 +115,81 @@ func NewDatabase() *Database {
 // PrivateSecretSharedQuery uses the provided PIR query to retreive a slot row
 func (db *Database) PrivateSecretSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
 
-	bits := db.ExpandSharedQuery(query, nprocs)
-	return db.PrivateSecretSharedQueryWithExpandedBits(query, bits, nprocs)
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateSecretSharedQuery(query, nprocs)
+}
+
+func (db *Database) privateSecretSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+	return db.privateSecretSharedQueryProgress(query, nprocs, nil)
+}
+
+func (db *Database) privateSecretSharedQueryProgress(query *QueryShare, nprocs int, progress *queryProgress) (*SecretSharedQueryResult, error) {
+
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if err := db.checkSharedLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkKeyDomain(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkKeywordLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkQueryMemory(db.estimateSharedQueryMemory(query, nprocs)); err != nil {
+		return nil, err
+	}
+
+	bits, err := db.expandSharedQuery(query, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := db.privateSecretSharedQueryWithExpandedBits(query, bits, nprocs, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.selfCheckLocked(query, bits, res, nprocs); err != nil {
+		return nil, err
+	}
+
+	return res, nil
 }
 
 // PrivateSecretSharedQueryWithExpandedBits returns the result without expanding the query DPF
 func (db *Database) PrivateSecretSharedQueryWithExpandedBits(query *QueryShare, bits []bool, nprocs int) (*SecretSharedQueryResult, error) {
 
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateSecretSharedQueryWithExpandedBits(query, bits, nprocs, nil)
+}
+
+func (db *Database) privateSecretSharedQueryWithExpandedBits(query *QueryShare, bits []bool, nprocs int, progress *queryProgress) (*SecretSharedQueryResult, error) {
+
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if err := db.checkAttributeMask(query.AttributeMask); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkQueryMemory(db.estimateSharedQueryMemory(query, nprocs)); err != nil {
+		return nil, err
+	}
+
 	// height of databse given query.GroupSize = dbWidth
 	dimWidth := query.GroupSize
-	dimHeight := int(math.Ceil(float64(db.DBSize / query.GroupSize)))
+	dimHeight := ceilDiv(db.DBSize, query.GroupSize)
 
 	// mapping of results; one for each process
 	results := make([]*Slot, dimWidth)
@@ -88,170 +201,260 @@ func (db *Database) PrivateSecretSharedQueryWithExpandedBits(query *QueryShare,
 		}
 	}
 
-	for row := 0; row < dimHeight; row++ {
+	progress.setTotal(dimHeight)
 
-		if bits[row] {
-			for col := 0; col < dimWidth; col++ {
-				slotIndex := row*dimWidth + col
-				// xor if bit is set and within bounds
-				if slotIndex < len(db.Slots) {
-					XorSlots(results[col], db.Slots[slotIndex])
-				} else {
-					break
-				}
-			}
+	if db.isPartitioned() && nprocs > 1 {
+		if err := db.scanRowsPartitioned(results, bits, dimWidth, query.AttributeMask, nprocs, progress); err != nil {
+			return nil, err
+		}
+	} else if nprocs > 1 {
+		if err := db.scanRowsParallel(results, bits, dimWidth, query.AttributeMask, nprocs, progress); err != nil {
+			return nil, err
 		}
+	} else {
+		db.xorRows(results, bits, dimWidth, query.AttributeMask, 0, dimHeight)
+		progress.advance(dimHeight, 0)
 	}
 
 	return &SecretSharedQueryResult{db.SlotBytes, results}, nil
 }
 
 // ExpandSharedQuery returns the expands the DPF and returns an array of bits
+// (nil if the expansion fails)
 func (db *Database) ExpandSharedQuery(query *QueryShare, nprocs int) []bool {
 
-	var wg sync.WaitGroup
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	bits, err := db.expandSharedQuery(query, nprocs)
+	if err != nil {
+		return nil
+	}
 
-	dimHeight := int(math.Ceil(float64(db.DBSize / query.GroupSize)))
+	return bits
+}
 
-	// num bits to represent the index
-	numBits := uint(math.Log2(float64(dimHeight)) + 1)
+func (db *Database) expandSharedQuery(query *QueryShare, nprocs int) ([]bool, error) {
 
-	if query.IsKeywordBased {
-		numBits = uint(32)
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
 	}
 
+	dimHeight := ceilDiv(db.DBSize, query.GroupSize)
+
+	// num bits to represent the index (or the keyword)
+	numBits := db.sharedQueryDomainBits(query.GroupSize, query.IsKeywordBased)
+
 	// init server DPF
 	pf := dpf.ServerInitialize(query.PrfKeys, numBits)
 
 	bits := make([]bool, dimHeight)
-	// expand the DPF into the bits array
-	for i := 0; i < dimHeight; i++ {
-		// key (index or uint) depending on whether
-		// the query is keyword based or index based
-		// when keyword based use FSS
-		key := uint(i)
+	if err := expandSharedRows(pf, query, db.Keywords, 0, bits, nprocs); err != nil {
+		return nil, err
+	}
+
+	return bits, nil
+}
+
+// expandSharedRows writes the shares of the selection bits of the rows first, ...,
+// first+len(bits)-1 to bits using nprocs workers (keywords are the keywords of the
+// rows for keyword queries)
+func expandSharedRows(pf *dpf.Dpf, query *QueryShare, keywords []uint, first int, bits []bool, nprocs int) error {
+
+	// each range of rows is expanded at once so that the nodes
+	// of the tree above the range are expanded once (see dpf.EvalFull2PBit)
+	return parallelRanges(context.Background(), len(bits), nprocs, func(_, start, end int) error {
+
+		// keywords are arbitrary points of the domain
+		// so each keyword is evaluated on its own
 		if query.IsKeywordBased {
-			key = db.Keywords[i]
+			for i := start; i < end; i++ {
+				bits[i] = evaluateShare(pf, query, keywords[first+i])
+			}
+			return nil
 		}
 
-		// don't spin up go routines in the single-thread case
-		if nprocs == 1 {
-			if query.IsTwoParty {
-				res := pf.Evaluate2P(query.ShareNumber, query.KeyTwoParty, key)
-				// IMPORTANT: take mod 2 of uint *before* casting to float64, otherwise there is an overflow edge case!
-				bits[i] = (int(math.Abs(float64(res%2))) == 0)
-			} else {
-				res := pf.EvaluateMP(query.KeyMultiParty, key)
-				// IMPORTANT: take mod 2 of uint *before* casting to float64, otherwise there is an overflow edge case!
-				bits[i] = (int(math.Abs(float64(res%2))) == 0)
-			}
+		expandShareRange(pf, query, uint(first+start), bits[start:end])
+		return nil
+	})
+}
 
-		} else {
-			wg.Add(1)
-			go func(i int, key uint) {
-				defer wg.Done()
-
-				if query.IsTwoParty {
-					res := pf.Evaluate2P(query.ShareNumber, query.KeyTwoParty, key)
-					// IMPORTANT: take mod 2 of uint *before* casting to float64, otherwise there is an overflow edge case!
-					bits[i] = (int(math.Abs(float64(res%2))) == 0)
-				} else {
-					res := pf.EvaluateMP(query.KeyMultiParty, key)
-					// IMPORTANT: take mod 2 of uint *before* casting to float64, otherwise there is an overflow edge case!
-					bits[i] = (int(math.Abs(float64(res%2))) == 0)
-				}
+// expandShareRange evaluates the query DPF on start, ..., start+len(bits)-1 and
+// writes the shares of the selection bits to bits (see evaluateShare)
+func expandShareRange(pf *dpf.Dpf, query *QueryShare, start uint, bits []bool) {
 
-			}(i, key)
+	if !query.IsTwoParty {
+		res := make([]uint32, len(bits))
+		pf.EvalFullMP(query.KeyMultiParty, start, res)
+		for i := range res {
+			bits[i] = res[i]%2 == 1
+		}
+		return
+	}
 
-			// launch nprocs threads in parallel to evaluate the DPF
-			if i%nprocs == 0 || i+1 == dimHeight {
-				wg.Wait()
-			}
+	res := make([]byte, len(bits))
+	if query.KeyVariant != KeyPayloadInLeaf {
+		pf.EvalFull2PBits(query.KeyTwoParty, start, res)
+		for i := range res {
+			bits[i] = res[i] == 1
 		}
+		return
 	}
 
-	return bits
+	pf.EvalFull2PBit(query.KeyTwoParty, start, res)
+	for i := range res {
+		bits[i] = res[i] == 0
+	}
+}
+
+// evaluateShare evaluates the query DPF on key and returns the share of the selection bit
+func evaluateShare(pf *dpf.Dpf, query *QueryShare, key uint) bool {
+
+	if !query.IsTwoParty {
+		res := pf.EvaluateMP(query.KeyMultiParty, key)
+		// multi-party outputs are XOR shares so the parity itself is the share
+		return res%2 == 1
+	}
+
+	if query.KeyVariant != KeyPayloadInLeaf {
+		return pf.Evaluate2PBits(query.KeyTwoParty, key) == 1
+	}
+
+	return pf.Evaluate2PBit(query.ShareNumber, query.KeyTwoParty, key) == 0
 }
 
 // PrivateEncryptedQuery uses the provided PIR query to retreive a slot row (encrypted)
 // the tricky details are in regards to converting slot bytes to ciphertexts, specifically
 // the encryption scheme might not have a message space large enough to accomodate
-// all the bytes in a slot, thus requiring the bytes to be split up into several ciphertexts
+// all the bytes in a slot, thus requiring the bytes to be split up into several ciphertexts.
+// The response is bitwise identical for any nprocs (see parallelRanges)
 func (db *Database) PrivateEncryptedQuery(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
 
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateEncryptedQuery(query, nprocs)
+}
+
+// PrivateEncryptedQueryContext is PrivateEncryptedQuery with a context; the workers
+// stop as soon as the context is done and the error of the context is returned
+func (db *Database) PrivateEncryptedQueryContext(ctx context.Context, query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateEncryptedQueryContext(ctx, query, nprocs, nil)
+}
+
+func (db *Database) privateEncryptedQuery(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+	return db.privateEncryptedQueryContext(context.Background(), query, nprocs, nil)
+}
+
+// checkEncryptedQuery checks that the query can be answered by the database
+func (db *Database) checkEncryptedQuery(query *EncryptedQuery) error {
+
+	if err := db.checkEncryptedLayout(query); err != nil {
+		return err
+	}
+
+	if len(query.EBits) < query.DBHeight {
+		return fmt.Errorf("query has %v encrypted bits for %v rows", len(query.EBits), query.DBHeight)
+	}
+
+	if msgSpaceBytes(query.Pk) < 1 {
+		return ErrKeyTooSmall
+	}
+
+	if query.IsKeywordBased && !db.keywordLayer {
+		return ErrNotKeywordLayer
+	}
+
+	return db.checkAttributeMask(query.AttributeMask)
+}
+
+func (db *Database) privateEncryptedQueryContext(ctx context.Context, query *EncryptedQuery, nprocs int, progress *queryProgress) (*EncryptedQueryResult, error) {
+
+	if err := db.checkEncryptedQuery(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkQueryMemory(db.estimateEncryptedQueryMemory(query, nprocs)); err != nil {
+		return nil, err
+	}
+
 	// width of databse given query.height
 	dimWidth := query.DBWidth
 	dimHeight := query.DBHeight
 
 	// how many ciphertexts are needed to represent a slot
-	msgSpaceBytes := float64(len(query.Pk.N.Bytes()) - 2)
-	numCiphertextsPerSlot := int(math.Ceil(float64(db.SlotBytes) / msgSpaceBytes))
+	params := db.paramsForPublicKey(query.Pk)
+	numCiphertextsPerSlot := params.numCiphertextsPerSlot
 
-	numBytesPerCiphertext := 0
+	if nprocs < 1 {
+		nprocs = 1
+	}
 
-	// mapping of results; one for each process
+	// mapping of results and number of bytes per ciphertext; one for each process
 	slotRes := make([][]*EncryptedSlot, nprocs)
+	procBytesPerCiphertext := make([]int, nprocs)
 
-	// how many rows each process gets
-	numRowsPerProc := int(float64(dimHeight) / float64(nprocs))
-
-	var wg sync.WaitGroup
-
-	for i := 0; i < nprocs; i++ {
+	// initialize the slots
+	for i := range slotRes {
 		slotRes[i] = make([]*EncryptedSlot, dimWidth)
+		for col := 0; col < dimWidth; col++ {
+			slotRes[i][col] = &EncryptedSlot{
+				Cts: make([]*paillier.Ciphertext, numCiphertextsPerSlot),
+			}
 
-		wg.Add(1)
-		go func(i int) {
-			defer wg.Done()
-
-			start := i * numRowsPerProc
-			end := i*numRowsPerProc + numRowsPerProc
-
-			// handle the edge case
-			if i+1 == nprocs {
-				end = dimHeight
+			for j := range slotRes[i][col].Cts {
+				slotRes[i][col].Cts[j] = params.nullLevelOne
 			}
+		}
+	}
+
+	progress.setTotal(dimHeight)
 
-			// initialize the slots
+	err := parallelRanges(ctx, dimHeight, nprocs, func(i, start, end int) error {
+		ops := int64(0)
+		for row := start; row < end; row++ {
 			for col := 0; col < dimWidth; col++ {
-				slotRes[i][col] = &EncryptedSlot{
-					Cts: make([]*paillier.Ciphertext, numCiphertextsPerSlot),
+				slotIndex := row*dimWidth + col
+				if slotIndex >= len(db.Slots) || !db.matchesAttributes(slotIndex, query.AttributeMask) {
+					continue
 				}
 
-				for j := range slotRes[i][col].Cts {
-					slotRes[i][col].Cts[j] = nullCiphertext(query.Pk, paillier.EncLevelOne)
+				// convert the slot into big.Int array
+				intArr, numBytesPerInt, err := db.Slots[slotIndex].ToGmpIntArray(numCiphertextsPerSlot)
+				if err != nil {
+					return err
 				}
-			}
 
-			for row := start; row < end; row++ {
-				for col := 0; col < dimWidth; col++ {
-					slotIndex := row*dimWidth + col
-					if slotIndex >= len(db.Slots) {
-						continue
-					}
-
-					// convert the slot into big.Int array
-					intArr, numBytesPerInt, err := db.Slots[slotIndex].ToGmpIntArray(numCiphertextsPerSlot)
-					if err != nil {
-						panic(err)
-					}
-
-					// set the number of bytes that each ciphertest represents
-					if numBytesPerCiphertext == 0 {
-						numBytesPerCiphertext = numBytesPerInt
-					}
+				// set the number of bytes that each ciphertest represents
+				procBytesPerCiphertext[i] = numBytesPerInt
 
-					for j, val := range intArr {
-						sel := query.Pk.ConstMult(query.EBits[row], val)
-						slotRes[i][col].Cts[j] = query.Pk.Add(slotRes[i][col].Cts[j], sel)
-					}
+				for j, val := range intArr {
+					sel := query.Pk.ConstMult(query.EBits[row], val)
+					slotRes[i][col].Cts[j] = query.Pk.Add(slotRes[i][col].Cts[j], sel)
 				}
+				ops += 2 * int64(len(intArr))
 			}
+		}
+
+		progress.advance(end-start, ops)
+		return nil
+	})
 
-		}(i)
+	if err != nil {
+		return nil, err
 	}
 
-	wg.Wait()
+	numBytesPerCiphertext := 0
+	for _, n := range procBytesPerCiphertext {
+		if n != 0 {
+			numBytesPerCiphertext = n
+			break
+		}
+	}
 
 	slots := slotRes[0]
 	for i := 1; i < nprocs; i++ {
@@ -262,6 +465,7 @@ func (db *Database) PrivateEncryptedQuery(query *EncryptedQuery, nprocs int) (*E
 
 	queryResult := &EncryptedQueryResult{
 		Pk:                    query.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(query.Pk),
 		Slots:                 slots,
 		NumBytesPerCiphertext: numBytesPerCiphertext,
 		SlotBytes:             db.SlotBytes,
@@ -271,9 +475,20 @@ func (db *Database) PrivateEncryptedQuery(query *EncryptedQuery, nprocs int) (*E
 }
 
 // PrivateDoublyEncryptedQuery executes a row PIR query and col PIR query by recursively
-// applying PrivateEncryptedQuery
+// applying PrivateEncryptedQuery. The passes are pipelined: the column query is applied
+// to each group of columns as soon as the row query result for the group is computed
 func (db *Database) PrivateDoublyEncryptedQuery(query *DoublyEncryptedQuery, nprocs int) (*DoublyEncryptedQueryResult, error) {
 
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateDoublyEncryptedQueryLocked(query, nprocs, nil)
+}
+
+// privateDoublyEncryptedQueryLocked checks the group sizes and the memory used
+// by the query and answers it
+func (db *Database) privateDoublyEncryptedQueryLocked(query *DoublyEncryptedQuery, nprocs int, progress *queryProgress) (*DoublyEncryptedQueryResult, error) {
+
 	if query.Row.GroupSize > db.DBSize || query.Row.GroupSize == 0 {
 		return nil, errors.New("invalid group size provided in query")
 	}
@@ -282,60 +497,261 @@ func (db *Database) PrivateDoublyEncryptedQuery(query *DoublyEncryptedQuery, npr
 		return nil, errors.New("invalid group size provided in query")
 	}
 
-	// get the row
-	rowQueryRes, err := db.PrivateEncryptedQuery(query.Row, nprocs)
+	if err := db.checkQueryMemory(db.estimateDoublyEncryptedQueryMemory(query, nprocs)); err != nil {
+		return nil, err
+	}
+
+	return db.privateDoublyEncryptedQuery(query, nprocs, progress)
+}
+
+// privateDoublyEncryptedQuery answers the row and column queries in a single pass.
+// Workers take ranges of the groups of columns selected by the bits of the column query in turn,
+// compute the row query result for the columns of the group and accumulate it into
+// their share of the column query result, so that the column pass of a group overlaps
+// the row pass of the other groups instead of waiting for the whole row pass
+func (db *Database) privateDoublyEncryptedQuery(query *DoublyEncryptedQuery, nprocs int, progress *queryProgress) (*DoublyEncryptedQueryResult, error) {
+
+	rowQuery, colQuery := query.Row, query.Col
+
+	if err := db.checkEncryptedQuery(rowQuery); err != nil {
+		return nil, err
+	}
+
+	dimWidth := rowQuery.DBWidth
+	dimHeight := rowQuery.DBHeight
+
+	if dimWidth%colQuery.GroupSize != 0 {
+		return nil, errors.New("row has a size that is not a multiple of the group size")
+	}
+
+	numGroups := dimWidth / colQuery.GroupSize
+	if len(rowQuery.EBits) < dimHeight || len(colQuery.EBits) < numGroups {
+		return nil, errors.New("query has fewer encrypted bits than the dimensions of the database")
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	split, err := newLevelTwoSplit(rowQuery.Pk, colQuery.Pk)
+	if err != nil {
+		return nil, err
+	}
+
+	rowParams := db.paramsForPublicKey(rowQuery.Pk)
+	colParams := db.paramsForPublicKey(colQuery.Pk)
+	numCiphertextsPerSlot := rowParams.numCiphertextsPerSlot
+	numResultCiphertexts := numCiphertextsPerSlot * split.chunks
+
+	// share of the result and number of bytes per ciphertext of each process
+	procRes := make([][][]*paillier.Ciphertext, nprocs)
+	procBytesPerCiphertext := make([]int, nprocs)
+
+	for p := range procRes {
+		procRes[p] = make([][]*paillier.Ciphertext, colQuery.GroupSize)
+		for i := range procRes[p] {
+			procRes[p][i] = make([]*paillier.Ciphertext, numResultCiphertexts)
+			for j := range procRes[p][i] {
+				procRes[p][i][j] = colParams.nullLevelTwo
+			}
+		}
+	}
+
+	progress.setTotal(numGroups)
+
+	err = parallelRanges(context.Background(), numGroups, nprocs, func(p, start, end int) error {
+
+		res := procRes[p]
+		ops := int64(0)
+
+		// row query result for one column
+		column := make([]*paillier.Ciphertext, numCiphertextsPerSlot)
+
+		for g := start; g < end; g++ {
+			for member := 0; member < colQuery.GroupSize; member++ {
+				col := g*colQuery.GroupSize + member
+
+				for j := range column {
+					column[j] = rowParams.nullLevelOne
+				}
+
+				for row := 0; row < dimHeight; row++ {
+					slotIndex := row*dimWidth + col
+					if slotIndex >= len(db.Slots) || !db.matchesAttributes(slotIndex, rowQuery.AttributeMask) {
+						continue
+					}
+
+					intArr, numBytesPerInt, err := db.Slots[slotIndex].ToGmpIntArray(numCiphertextsPerSlot)
+					if err != nil {
+						return err
+					}
+					procBytesPerCiphertext[p] = numBytesPerInt
+
+					for j, val := range intArr {
+						sel := rowQuery.Pk.ConstMult(rowQuery.EBits[row], val)
+						column[j] = rowQuery.Pk.Add(column[j], sel)
+					}
+					ops += 2 * int64(len(intArr))
+				}
+
+				// "selection" bit of the group
+				bitCt := colQuery.EBits[g]
+				for j, ct := range column {
+					for c, chunk := range split.split(ct) {
+						k := j*split.chunks + c
+						sel := colQuery.Pk.ConstMult(bitCt, chunk)
+						res[member][k] = colQuery.Pk.Add(res[member][k], sel)
+					}
+				}
+				ops += 2 * int64(numResultCiphertexts)
+			}
+		}
+
+		progress.advance(end-start, ops)
+		return nil
+	})
+
 	if err != nil {
 		return nil, err
 	}
 
-	return db.PrivateEncryptedQueryOverEncryptedResult(query.Col, rowQueryRes, nprocs)
+	numBytesPerCiphertext := 0
+	for _, n := range procBytesPerCiphertext {
+		if n != 0 {
+			numBytesPerCiphertext = n
+			break
+		}
+	}
+
+	res := procRes[0]
+	for p := 1; p < nprocs; p++ {
+		for i := range res {
+			for j := range res[i] {
+				res[i][j] = colQuery.Pk.Add(res[i][j], procRes[p][i][j])
+			}
+		}
+	}
+
+	resSlots := make([]*DoublyEncryptedSlot, colQuery.GroupSize)
+	for i, cts := range res {
+		resSlots[i] = &DoublyEncryptedSlot{
+			Cts: cts,
+		}
+	}
+
+	queryResult := &DoublyEncryptedQueryResult{
+		Pk:                    colQuery.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(colQuery.Pk),
+		Slots:                 resSlots,
+		NumBytesPerCiphertext: numBytesPerCiphertext,
+		SlotBytes:             db.SlotBytes,
+	}
+	split.setResult(queryResult)
+
+	return queryResult, nil
 }
 
 // PrivateEncryptedQueryOverEncryptedResult executes the query over an encrypted query result
 func (db *Database) PrivateEncryptedQueryOverEncryptedResult(query *EncryptedQuery, result *EncryptedQueryResult, nprocs int) (*DoublyEncryptedQueryResult, error) {
 
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.privateEncryptedQueryOverEncryptedResult(query, result, nprocs)
+}
+
+func (db *Database) privateEncryptedQueryOverEncryptedResult(query *EncryptedQuery, result *EncryptedQueryResult, nprocs int) (*DoublyEncryptedQueryResult, error) {
+
+	if len(result.Slots) == 0 || result.Slots[0] == nil {
+		return nil, errors.New("encrypted result has no slots")
+	}
+
 	// number of ciphertexts needed to encrypt a slot
 	numCiphertextsPerSlot := len(result.Slots[0].Cts)
+	for _, slot := range result.Slots {
+		if slot == nil || len(slot.Cts) != numCiphertextsPerSlot {
+			return nil, errors.New("all encrypted slots must have the same number of ciphertexts")
+		}
+	}
 
-	if len(result.Slots)%query.GroupSize != 0 {
-		panic("row has a size that is not a multiple of the group size")
+	if query.GroupSize <= 0 || len(result.Slots)%query.GroupSize != 0 {
+		return nil, errors.New("row has a size that is not a multiple of the group size")
+	}
+
+	if len(query.EBits) < len(result.Slots)/query.GroupSize {
+		return nil, errors.New("query has fewer encrypted bits than the groups of the result")
+	}
+
+	split, err := newLevelTwoSplit(result.Pk, query.Pk)
+	if err != nil {
+		return nil, err
+	}
+
+	params := db.paramsForPublicKey(query.Pk)
+	numResultCiphertexts := numCiphertextsPerSlot * split.chunks
+
+	if nprocs < 1 {
+		nprocs = 1
 	}
 
 	// need to encrypt each of the ciphertexts representing one slot
 	// res is a 2D array where each row is an encrypted slot composed of possibly multiple ciphertexts
-	res := make([][]*paillier.Ciphertext, query.GroupSize)
+	// (one per process)
+	procRes := make([][][]*paillier.Ciphertext, nprocs)
 
 	// initialize the slots
-	for i := 0; i < query.GroupSize; i++ {
-		res[i] = make([]*paillier.Ciphertext, numCiphertextsPerSlot)
-		for j := 0; j < numCiphertextsPerSlot; j++ {
-			res[i][j] = nullCiphertext(query.Pk, paillier.EncLevelTwo)
+	for p := range procRes {
+		procRes[p] = make([][]*paillier.Ciphertext, query.GroupSize)
+		for i := 0; i < query.GroupSize; i++ {
+			procRes[p][i] = make([]*paillier.Ciphertext, numResultCiphertexts)
+			for j := 0; j < numResultCiphertexts; j++ {
+				procRes[p][i][j] = params.nullLevelTwo
+			}
 		}
 	}
 
-	// group memeber
-	member := 0
+	// the groups of columns are split among the processes
+	numGroups := len(result.Slots) / query.GroupSize
 
-	// apply the PIR column query to get the desired column ciphertext
-	for col := 0; col < len(result.Slots); col++ {
+	err = parallelRanges(context.Background(), numGroups, nprocs, func(p, start, end int) error {
 
-		if col%query.GroupSize == 0 {
-			member = 0
-		}
+		res := procRes[p]
 
-		// "selection" bit
-		bitIndex := int(col / query.GroupSize)
-		bitCt := query.EBits[bitIndex]
+		// apply the PIR column query to get the desired column ciphertext
+		for bitIndex := start; bitIndex < end; bitIndex++ {
 
-		slotCiphertexts := result.Slots[col].Cts
-		for j, slotCiphertext := range slotCiphertexts {
-			ctVal := slotCiphertext.C
+			// "selection" bit
+			bitCt := query.EBits[bitIndex]
 
-			sel := query.Pk.ConstMult(bitCt, ctVal)
-			res[member][j] = query.Pk.Add(res[member][j], sel)
+			// group memeber
+			for member := 0; member < query.GroupSize; member++ {
+				col := bitIndex*query.GroupSize + member
+
+				slotCiphertexts := result.Slots[col].Cts
+				for j, slotCiphertext := range slotCiphertexts {
+					for c, chunk := range split.split(slotCiphertext) {
+						k := j*split.chunks + c
+						sel := query.Pk.ConstMult(bitCt, chunk)
+						res[member][k] = query.Pk.Add(res[member][k], sel)
+					}
+				}
+			}
 		}
 
-		member++
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := procRes[0]
+	for p := 1; p < nprocs; p++ {
+		for i := range res {
+			for j := range res[i] {
+				res[i][j] = query.Pk.Add(res[i][j], procRes[p][i][j])
+			}
+		}
 	}
 
 	resSlots := make([]*DoublyEncryptedSlot, query.GroupSize)
@@ -348,10 +764,12 @@ func (db *Database) PrivateEncryptedQueryOverEncryptedResult(query *EncryptedQue
 
 	queryResult := &DoublyEncryptedQueryResult{
 		Pk:                    query.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(query.Pk),
 		Slots:                 resSlots,
 		NumBytesPerCiphertext: result.NumBytesPerCiphertext,
 		SlotBytes:             db.SlotBytes,
 	}
+	split.setResult(queryResult)
 
 	return queryResult, nil
 
@@ -371,9 +789,7 @@ func (db *Database) BuildForData(data []string) {
 // of slots where each string gets a slot of the specified size
 func (db *Database) BuildForDataWithSlotSize(data []string, slotSize int) {
 
-	db.Slots = make([]*Slot, len(data))
-	db.SlotBytes = slotSize
-	db.DBSize = len(data)
+	slots := make([]*Slot, len(data))
 
 	for i := 0; i < len(data); i++ {
 		slotData := make([]byte, slotSize)
@@ -382,55 +798,261 @@ func (db *Database) BuildForDataWithSlotSize(data []string, slotSize int) {
 		copy(slotData[:], stringData)
 
 		// make a new slot with slotData
-		db.Slots[i] = &Slot{
+		slots[i] = &Slot{
 			Data: slotData,
 		}
 	}
+
+	db.install(&builtContents{
+		slots:     slots,
+		slotBytes: slotSize,
+		records:   NewRecordIndexForStrings(data),
+	})
+}
+
+// BuildFromFunc constructs a PIR database of n slots of slotBytes bytes
+// where slot i is filled with fn(i) (zero padded) without materializing the data first
+func (db *Database) BuildFromFunc(n int, slotBytes int, fn func(i int) []byte) error {
+	return db.BuildFromFuncParallel(n, slotBytes, fn, 1)
+}
+
+// BuildFromFuncParallel is like BuildFromFunc but calls fn from nprocs goroutines
+// (fn must be safe for concurrent use)
+func (db *Database) BuildFromFuncParallel(n int, slotBytes int, fn func(i int) []byte, nprocs int) error {
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	slots := make([]*Slot, n)
+	hashes := make([]RecordHash, n)
+	errs := make([]error, nprocs)
+
+	// how many slots each process gets
+	numSlotsPerProc := n / nprocs
+
+	var wg sync.WaitGroup
+	for p := 0; p < nprocs; p++ {
+		start := p * numSlotsPerProc
+		end := start + numSlotsPerProc
+
+		// handle the edge case
+		if p+1 == nprocs {
+			end = n
+		}
+
+		wg.Add(1)
+		go func(p, start, end int) {
+			defer wg.Done()
+
+			for i := start; i < end; i++ {
+				data := fn(i)
+				if len(data) > slotBytes {
+					errs[p] = errors.New("generated data does not fit in the slot")
+					return
+				}
+
+				slotData := make([]byte, slotBytes)
+				copy(slotData, data)
+				slots[i] = NewSlot(slotData)
+				hashes[i] = HashRecord(data)
+			}
+		}(p, start, end)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	db.install(&builtContents{
+		slots:     slots,
+		slotBytes: slotBytes,
+		records:   newRecordIndexForHashes(hashes),
+	})
+
+	return nil
+}
+
+// BuildForBinaryData constructs a PIR database of slots where each
+// value gets a length prefixed slot such that arbitrary binary values
+// (including ones with trailing zero bytes) are recovered exactly
+func (db *Database) BuildForBinaryData(data [][]byte) error {
+
+	slotSize := GetRequiredLengthPrefixedSlotSize(data)
+	return db.BuildForBinaryDataWithSlotSize(data, slotSize)
+}
+
+// BuildForBinaryDataWithSlotSize constructs a PIR database of length
+// prefixed slots of the specified size (see BuildForBinaryData)
+func (db *Database) BuildForBinaryDataWithSlotSize(data [][]byte, slotSize int) error {
+
+	contents, err := binaryContents(data, slotSize)
+	if err != nil {
+		return err
+	}
+
+	db.install(contents)
+
+	return nil
+}
+
+// BuildForPaddedBinaryData constructs a PIR database for data padded
+// using PadBytesToSqrt or PadBytesToPowerOf2 (see BuildForBinaryData)
+// and marks the last numPadding slots as padding in the metadata
+func (db *Database) BuildForPaddedBinaryData(data [][]byte, numPadding int) error {
+
+	if numPadding < 0 || numPadding > len(data) {
+		return errors.New("invalid number of padding values")
+	}
+
+	contents, err := binaryContents(data, GetRequiredLengthPrefixedSlotSize(data))
+	if err != nil {
+		return err
+	}
+
+	contents.numPadding = numPadding
+	db.install(contents)
+
+	return nil
+}
+
+// builtContents are the contents of a database built by one of the Build functions
+type builtContents struct {
+	slots          []*Slot
+	slotBytes      int
+	lengthPrefixed bool
+	schema         *Schema
+	numPadding     int
+	keyID          string       // see BuildForSealedData
+	logTree        *LogTreeHead // see BuildFromLog
+	records        *RecordIndex
+}
+
+// binaryContents returns the length prefixed slots of the data (see BuildForBinaryData)
+func binaryContents(data [][]byte, slotSize int) (*builtContents, error) {
+
+	slots := make([]*Slot, len(data))
+	for i := range data {
+		slot, err := NewLengthPrefixedSlot(data[i], slotSize)
+		if err != nil {
+			return nil, err
+		}
+		slots[i] = slot
+	}
+
+	return &builtContents{
+		slots:          slots,
+		slotBytes:      slotSize,
+		lengthPrefixed: true,
+		records:        NewRecordIndex(data),
+	}, nil
+}
+
+// install replaces the contents of the database with the built contents.
+// The slots are built without holding the lock and installed at once, so
+// concurrent queries see either the old or the new contents
+func (db *Database) install(c *builtContents) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.Slots = c.slots
+	db.SlotBytes = c.slotBytes
+	db.DBSize = len(c.slots)
+	db.LengthPrefixed = c.lengthPrefixed
+	db.Schema = c.schema
+	db.NumPaddingSlots = c.numPadding
+	db.GroupShuffle = nil
+	db.SlotKeyID = c.keyID
+	db.LogTree = c.logTree
+	db.records = c.records
+
+	// keywords and attributes are associated with the old rows (see SwapIn)
+	db.Keywords = nil
+	db.KeywordBits = 0
+	db.KeywordDigest = nil
+	db.KeywordCommitment = nil
+	db.KeyValue = nil
+	db.Attributes = nil
+
+	// cached values depend on the slot size
+	db.pkCache.clear()
+
+	// the new slots are not allocated on the nodes
+	db.numaAlloc = nil
+	db.numaPartitions = nil
+}
+
+// IsPaddingSlot returns true if the slot at index is padding
+func (dbmd *DBMetadata) IsPaddingSlot(index int) bool {
+	return index >= dbmd.DBSize-dbmd.NumPaddingSlots
+}
+
+// DecodeSlot returns the value stored in a slot recovered from the database.
+// Slots that are not length prefixed are returned whole (see Compat.StripTrailingZeros)
+func (dbmd *DBMetadata) DecodeSlot(slot *Slot) ([]byte, error) {
+
+	if dbmd.LengthPrefixed {
+		return slot.LengthPrefixedData()
+	}
+
+	res := make([]byte, len(slot.Data))
+	copy(res, slot.Data)
+
+	if CurrentCompat().StripTrailingZeros {
+		return removeTrailingZeros(res), nil
+	}
+
+	return res, nil
 }
 
 // SetKeywords set the keywords (uints) associated with each row of the database
+// along with the size of the domain of keyword queries (see KeywordBits) and
+// the digest of the keywords (see KeywordDigest)
 func (db *Database) SetKeywords(keywords []uint) {
-	db.Keywords = keywords
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.setKeywords(keywords)
 }
 
 // IndexToCoordinates returns the 2D coodindates for an index
 // a PIR query should use the first value to recover the row
 // and the second value to recover the column in the response
 func (dbmd *DBMetadata) IndexToCoordinates(index, width, height int) (int, int) {
-	return int(index / width), int(index % width)
+	return Layout{Width: width, Height: height}.Coordinates(index)
 }
 
 // GetDimentionsForDatabase returns the width and height given a height constraint
 // height is the desired height of the database (number of rows)
 // groupSize is the number of *adjacent* slots needed to constitute a "group" (default = 1)
+// (see LayoutForHeight)
 func (dbmd *DBMetadata) GetDimentionsForDatabase(height int, groupSize int) (int, int) {
 
-	dimWidth := int(math.Ceil(float64(dbmd.DBSize / (height * groupSize))))
+	layout := dbmd.LayoutForHeight(height, groupSize)
 
-	if dimWidth == 0 {
-		dimWidth = 1
-	}
-
-	dimHeight := height
-
-	// trim the height to fit the database without extra rows
-	dimHeight = int(math.Ceil(float64(dbmd.DBSize / (dimWidth * groupSize))))
-
-	return dimWidth * groupSize, dimHeight
+	return layout.Width, layout.Height
 }
 
 // GetSqrtOfDBSize returns sqrt(DBSize) + 1
 func (dbmd *DBMetadata) GetSqrtOfDBSize() int {
-	return int(math.Sqrt(float64(dbmd.DBSize)) + 1)
+	return floorSqrt(dbmd.DBSize) + 1
 }
 
 // GetOptimalDBDimentions returns the optimal DB dimentions for PIR
 func GetOptimalDBDimentions(slotSize int, dbSize int) (int, int) {
 
-	height := int(math.Max(1, math.Sqrt(float64(dbSize*slotSize))))
-	width := math.Ceil(float64(dbSize) / float64(height))
+	height := floorSqrt(dbSize * slotSize)
+	if height < 1 {
+		height = 1
+	}
 
-	return int(width), int(height)
+	return ceilDiv(dbSize, height), height
 }
 
 // GetOptimalWeightedDBDimentions returns the optimal DB dimentions for PIR
@@ -440,7 +1062,7 @@ func GetOptimalWeightedDBDimentions(slotSize int, dbSize int, weight int) (int,
 	width, height := GetOptimalDBDimentions(slotSize, dbSize)
 
 	newWidth := int(width / weight)
-	newHeight := int(math.Ceil(float64(height * weight)))
+	newHeight := height * weight
 
 	return newWidth, newHeight
 }
@@ -1,13 +1,17 @@
 package pir
 
 import (
+	"bytes"
+	"errors"
 	"math"
 	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/ncw/gmp"
 	"github.com/sachaservan/paillier"
+	"github.com/sachaservan/pir/dpf"
 )
 
 func setup() {
@@ -63,6 +67,139 @@ func TestSharedQuery(t *testing.T) {
 	}
 }
 
+// run with 'go test -v -run TestSharedQueryKeyVariants' to see log outputs.
+func TestSharedQueryKeyVariants(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	variants := []KeyVariant{KeyPayloadInLeaf, KeyFullDepth, KeyEarlyTermination, KeyAsymmetric}
+
+	for _, variant := range variants {
+		for gamma := uint(0); gamma < 10; gamma++ {
+			for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+
+				dimHeight := int(math.Ceil(float64(TestDBSize / groupSize)))
+
+				qIndex := rand.Intn(dimHeight)
+				shares := db.NewIndexQuerySharesWithKeyVariant(qIndex, groupSize, variant, gamma)
+
+				resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+
+				resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+
+				res := Recover([]*SecretSharedQueryResult{resA, resB})
+
+				for j := 0; j < groupSize; j++ {
+
+					index := qIndex*groupSize + j
+					if index >= db.DBSize {
+						break
+					}
+
+					if !db.Slots[index].Equal(res[j]) {
+						t.Fatalf(
+							"Query result is incorrect for variant %v (gamma = %v). %v != %v\n",
+							variant,
+							gamma,
+							db.Slots[index],
+							res[j],
+						)
+					}
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestExpandSharedQuery' to see log outputs.
+func TestExpandSharedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 3
+
+	shares := [][]*QueryShare{
+		db.NewIndexQueryShares(1, groupSize, 2),
+		db.NewIndexQueryShares(2, groupSize, 3),
+		db.NewIndexQuerySharesWithKeyVariant(3, groupSize, KeyFullDepth, 0),
+		db.NewIndexQuerySharesWithKeyVariant(4, groupSize, KeyEarlyTermination, 5),
+		db.NewIndexQuerySharesWithKeyVariant(5, groupSize, KeyAsymmetric, 0),
+	}
+
+	numBits := db.sharedQueryDomainBits(groupSize, false)
+
+	for _, s := range shares {
+		for _, share := range s {
+			pf := dpf.ServerInitialize(share.PrfKeys, numBits)
+
+			// the rows are split in ranges that do not align with the tree
+			for _, nprocs := range []int{1, 3, 7} {
+				bits := db.ExpandSharedQuery(share, nprocs)
+				for i := range bits {
+					if bits[i] != evaluateShare(pf, share, uint(i)) {
+						t.Fatalf("Row %v is expanded incorrectly with %v procs\n", i, nprocs)
+					}
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestSharedQueryMultiParty' to see log outputs.
+func TestSharedQueryMultiParty(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for numShares := uint(3); numShares < 5; numShares++ {
+		for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+
+			dimWidth := groupSize
+			dimHeight := int(math.Ceil(float64(TestDBSize / dimWidth)))
+
+			for i := 0; i < NumQueries; i++ {
+				qIndex := rand.Intn(dimHeight)
+				shares := db.NewIndexQueryShares(qIndex, groupSize, numShares)
+
+				resultShares := make([]*SecretSharedQueryResult, numShares)
+				for s := range shares {
+					res, err := db.PrivateSecretSharedQuery(shares[s], NumProcsForQuery)
+					if err != nil {
+						t.Fatalf("%v", err)
+					}
+					resultShares[s] = res
+				}
+
+				res := Recover(resultShares)
+
+				for j := 0; j < dimWidth; j++ {
+
+					index := int(qIndex)*dimWidth + j
+					if index >= db.DBSize {
+						break
+					}
+
+					if !db.Slots[index].Equal(res[j]) {
+						t.Fatalf(
+							"Query result is incorrect with %v shares. %v != %v\n",
+							numShares,
+							db.Slots[index],
+							res[j],
+						)
+					}
+				}
+			}
+		}
+	}
+}
+
 // run with 'go test -v -run TestEncryptedQuery' to see log outputs.
 func TestEncryptedQuery(t *testing.T) {
 	setup()
@@ -86,7 +223,7 @@ func TestEncryptedQuery(t *testing.T) {
 					t.Fatalf("%v", err)
 				}
 
-				res := RecoverEncrypted(response, sk)
+				res := recoverEncrypted(t, response, sk)
 
 				if len(res)%groupSize != 0 {
 					t.Fatalf("Response size is not a multiple of DBGroupSize")
@@ -134,7 +271,7 @@ func TestEncryptedNullQuery(t *testing.T) {
 					t.Fatalf("%v", err)
 				}
 
-				res := RecoverEncrypted(response, sk)
+				res := recoverEncrypted(t, response, sk)
 
 				if len(res)%groupSize != 0 {
 					t.Fatalf("Response size is not a multiple of DBGroupSize")
@@ -175,7 +312,7 @@ func TestDoublyEncryptedNullQuery(t *testing.T) {
 					t.Fatalf("%v", err)
 				}
 
-				res := RecoverDoublyEncrypted(response, sk)
+				res := recoverDoublyEncrypted(t, response, sk)
 				emptySlot := NewEmptySlot(len(res[0].Data))
 
 				for col := 0; col < groupSize; col++ {
@@ -239,7 +376,7 @@ func TestDoublyEncryptedQuery(t *testing.T) {
 					t.Fatalf("%v", err)
 				}
 
-				res := RecoverDoublyEncrypted(response, sk)
+				res := recoverDoublyEncrypted(t, response, sk)
 
 				rowIndex, colIndex := db.IndexToCoordinates(qIndex, dimWidth, dimHeight)
 				colIndex = int(colIndex / groupSize)
@@ -264,6 +401,221 @@ func TestDoublyEncryptedQuery(t *testing.T) {
 	}
 }
 
+func TestDoublyEncryptedQueryNumProcs(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 3
+
+	index := rand.Intn(db.DBSize)
+	query := db.NewDoublyEncryptedQuery(pk, groupSize, index)
+	dimWidth := query.Row.DBWidth
+
+	rowIndex, colIndex := db.IndexToCoordinates(index, dimWidth, 0)
+	start := rowIndex*dimWidth + (colIndex/groupSize)*groupSize
+
+	// single process and more processes than groups of columns
+	for _, nprocs := range []int{1, 3, dimWidth/groupSize + 1} {
+		response, err := db.PrivateDoublyEncryptedQuery(query, nprocs)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		slots, valid, err := db.RecoverDoublyEncryptedGroup(response, sk, index, dimWidth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < valid; j++ {
+			if !db.Slots[start+j].Equal(slots[j]) {
+				t.Fatalf("Query result is incorrect with %v processes. %v != %v\n", nprocs, db.Slots[start+j], slots[j])
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestEncryptedQueryReproducible' to see log outputs.
+func TestEncryptedQueryReproducible(t *testing.T) {
+	setup()
+
+	_, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	index := rand.Intn(db.DBSize)
+
+	ciphertextsEqual := func(a, b []*paillier.Ciphertext) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for j := range a {
+			if a[j].Level != b[j].Level || a[j].C.Cmp(b[j].C) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	query := db.NewEncryptedQuery(pk, 1, index)
+	doublyQuery := db.NewDoublyEncryptedQuery(pk, 2, index)
+
+	expected, err := db.PrivateEncryptedQuery(query, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedDoubly, err := db.PrivateDoublyEncryptedQuery(doublyQuery, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the responses do not depend on the number of processes (nor on scheduling)
+	for _, nprocs := range []int{2, 3, 7, query.DBHeight + 1} {
+		res, err := db.PrivateEncryptedQuery(query, nprocs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for col := range res.Slots {
+			if !ciphertextsEqual(res.Slots[col].Cts, expected.Slots[col].Cts) {
+				t.Fatalf("Encrypted response differs with %v processes\n", nprocs)
+			}
+		}
+
+		doubly, err := db.PrivateDoublyEncryptedQuery(doublyQuery, nprocs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for col := range doubly.Slots {
+			if !ciphertextsEqual(doubly.Slots[col].Cts, expectedDoubly.Slots[col].Cts) {
+				t.Fatalf("Doubly encrypted response differs with %v processes\n", nprocs)
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestDoublyEncryptedQueryPipelined' to see log outputs.
+func TestDoublyEncryptedQueryPipelined(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 2
+
+	attributes := make([]uint64, db.DBSize)
+	for i := range attributes {
+		attributes[i] = uint64(i % 2)
+	}
+	if err := db.SetAttributes(attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pipelined passes match the row pass followed by the column pass
+	for _, mask := range []uint64{0, 1} {
+		index := rand.Intn(db.DBSize)
+		query := db.NewDoublyEncryptedQueryWithAttributeMask(pk, groupSize, index, mask)
+
+		response, err := db.PrivateDoublyEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rowRes, err := db.PrivateEncryptedQuery(query.Row, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, err := db.PrivateEncryptedQueryOverEncryptedResult(query.Col, rowRes, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slots, expected := recoverDoublyEncrypted(t, response, sk), recoverDoublyEncrypted(t, want, sk)
+		for j := range expected {
+			if !slots[j].Equal(expected[j]) {
+				t.Fatalf("Query result is incorrect with mask %v. %v != %v\n", mask, slots[j], expected[j])
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestRecoverEndOfDatabase' to see log outputs.
+func TestRecoverEndOfDatabase(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	// database size that is not a multiple of any group size
+	dbSize := TestDBSize - 3
+	db := GenerateRandomDB(dbSize, SlotBytes)
+
+	checkGroup := func(scheme string, slots []*Slot, validCount, start int) {
+		expected := dbSize - start
+		if expected > len(slots) {
+			expected = len(slots)
+		}
+
+		if validCount != expected {
+			t.Fatalf("%v: expected %v valid slots, got %v\n", scheme, expected, validCount)
+		}
+
+		for j := 0; j < validCount; j++ {
+			if !db.Slots[start+j].Equal(slots[j]) {
+				t.Fatalf("%v: query result is incorrect. %v != %v\n", scheme, db.Slots[start+j], slots[j])
+			}
+		}
+	}
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+
+		// secret shared: last group of the database
+		lastGroup := int(math.Ceil(float64(dbSize)/float64(groupSize))) - 1
+		shares := db.NewIndexQueryShares(lastGroup, groupSize, 2)
+
+		resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slots, validCount := db.RecoverGroup([]*SecretSharedQueryResult{resA, resB}, lastGroup)
+		checkGroup("secret shared", slots, validCount, lastGroup*groupSize)
+
+		// encrypted: last row of the database
+		dimWidth, dimHeight := db.GetDimentionsForDatabase(TestDBHeight, groupSize)
+		if dimWidth*dimHeight < dbSize {
+			t.Fatalf("Dimensions %v x %v do not cover the database of size %v\n", dimWidth, dimHeight, dbSize)
+		}
+
+		query := db.NewEncryptedQueryWithDimentions(pk, dimWidth, dimHeight, groupSize, dimHeight-1)
+		response, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slots, validCount, err = db.RecoverEncryptedGroup(response, sk, dimHeight-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGroup("encrypted", slots, validCount, (dimHeight-1)*dimWidth)
+
+		// doubly encrypted: group containing the last slot of the database
+		index := dbSize - 1
+		doublyQuery := db.NewDoublyEncryptedQueryWithDimentions(pk, dimWidth, dimHeight, groupSize, index)
+		doublyResponse, err := db.PrivateDoublyEncryptedQuery(doublyQuery, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rowIndex, colIndex := db.IndexToCoordinates(index, dimWidth, dimHeight)
+		slots, validCount, err = db.RecoverDoublyEncryptedGroup(doublyResponse, sk, index, dimWidth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkGroup("doubly encrypted", slots, validCount, rowIndex*dimWidth+(colIndex/groupSize)*groupSize)
+	}
+}
+
 func BenchmarkBuildDB(b *testing.B) {
 	setup()
 
@@ -475,3 +827,153 @@ func fakeDoublyEncryptedQuery(pk *paillier.PublicKey, dbSize int) *DoublyEncrypt
 		Col: colQuery,
 	}
 }
+
+// run with 'go test -v -run TestBinaryDataQuery' to see log outputs.
+func TestBinaryDataQuery(t *testing.T) {
+	setup()
+
+	// values with (possibly all-zero) trailing bytes
+	data := make([][]byte, TestDBSize)
+	for i := range data {
+		data[i] = make([]byte, rand.Intn(SlotBytes+1))
+		if len(data[i]) > 0 {
+			data[i][0] = byte(rand.Intn(256))
+		}
+	}
+
+	db := NewDatabase()
+	if err := db.BuildForBinaryData(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < NumQueries; i++ {
+		qIndex := rand.Intn(TestDBSize)
+		shares := db.NewIndexQueryShares(qIndex, 1, 2)
+
+		resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := Recover([]*SecretSharedQueryResult{resA, resB})
+		value, err := db.DecodeSlot(res[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(value, data[qIndex]) {
+			t.Fatalf("Query result is incorrect. %v != %v\n", data[qIndex], value)
+		}
+	}
+}
+
+// run with 'go test -v -run TestBuildFromFunc' to see log outputs.
+func TestBuildFromFunc(t *testing.T) {
+
+	fn := func(i int) []byte {
+		return []byte{byte(i >> 8), byte(i)}
+	}
+
+	for _, nprocs := range []int{1, NumProcsForQuery, TestDBSize + 1} {
+		db := NewDatabase()
+		if err := db.BuildFromFuncParallel(TestDBSize, SlotBytes, fn, nprocs); err != nil {
+			t.Fatal(err)
+		}
+
+		if db.DBSize != TestDBSize || db.SlotBytes != SlotBytes {
+			t.Fatalf("Incorrect database size %v x %v\n", db.DBSize, db.SlotBytes)
+		}
+
+		for i, slot := range db.Slots {
+			expected := NewSlot(append(fn(i), make([]byte, SlotBytes-2)...))
+			if !slot.Equal(expected) {
+				t.Fatalf("Slot %v is incorrect. %v != %v\n", i, expected, slot)
+			}
+		}
+	}
+
+	err := NewDatabase().BuildFromFunc(TestDBSize, 1, fn)
+	if err == nil {
+		t.Fatalf("Did not throw error when generated data does not fit in the slot")
+	}
+}
+
+func TestBuildConcurrentQueries(t *testing.T) {
+	setup()
+
+	data := make([][]byte, TestDBSize)
+	keywords := make([]uint, TestDBSize)
+	for i := range data {
+		data[i] = []byte{byte(i), byte(i >> 8)}
+		keywords[i] = uint(i)
+	}
+
+	db := NewDatabase()
+	if err := db.BuildForBinaryData(data); err != nil {
+		t.Fatal(err)
+	}
+	db.SetKeywords(keywords)
+
+	var wg sync.WaitGroup
+	for i := 0; i < NumProcsForQuery; i++ {
+		wg.Add(1)
+		go func(keyword bool) {
+			defer wg.Done()
+			for j := 0; j < NumQueries; j++ {
+				md := db.Metadata()
+				var shares []*QueryShare
+				if keyword {
+					shares = md.NewKeywordQueryShares(rand.Intn(TestDBSize), 1, 2)
+				} else {
+					shares = md.NewIndexQueryShares(rand.Intn(TestDBSize), 1, 2)
+				}
+
+				res, err := db.PrivateSecretSharedQuery(shares[0], 1)
+				if keyword && errors.Is(err, ErrKeywordMismatch) {
+					// a rebuild clears the keywords until they are set again
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				if len(res.Shares) != 1 || len(res.Shares[0].Data) != md.SlotBytes {
+					t.Errorf("Unexpected result shape during a rebuild")
+					return
+				}
+			}
+		}(i%2 == 0)
+	}
+
+	// the contents are rebuilt (with the same layout) while the queries run
+	for i := 0; i < NumQueries; i++ {
+		for j := range data {
+			data[j] = []byte{byte(rand.Intn(256)), byte(i)}
+		}
+
+		if err := db.BuildForBinaryData(data); err != nil {
+			t.Fatal(err)
+		}
+		db.SetKeywords(keywords)
+	}
+
+	wg.Wait()
+
+	md := db.Metadata()
+	index := rand.Intn(TestDBSize)
+	slot, err := retrieveSlot(db, md, index, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := md.DecodeSlot(slot)
+	if err != nil || !bytes.Equal(value, data[index]) {
+		t.Fatalf("Query result is incorrect after the rebuilds. %v != %v (%v)\n", data[index], value, err)
+	}
+}
@@ -0,0 +1,198 @@
+package pir
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+/*
+ On-disk database format.
+ A database file is a fixed-size header followed by the slots stored
+ contiguously (all integers are big-endian):
+
+	magic            8 bytes ("PIRDB001")
+	slot bytes       uint32
+	number of slots  uint64
+	padding slots    uint64 (number of padding slots at the end)
+	slots            number of slots x slot bytes
+*/
+
+const dbFileMagic = "PIRDB001"
+
+// dbFileHeaderBytes is the size of the header of a database file
+const dbFileHeaderBytes = len(dbFileMagic) + 4 + 8 + 8
+
+// ErrInvalidDBFile is returned when reading a file that is not a database file
+var ErrInvalidDBFile = errors.New("invalid database file")
+
+// DBFileWriter streams slots to a database file without holding the database in memory
+type DBFileWriter struct {
+	w          *bufio.Writer
+	slotBytes  int
+	dbSize     int
+	numWritten int
+}
+
+// NewDBFileWriter writes the header of a database with dbSize slots of slotBytes
+// (the last numPadding of which are padding) and returns a writer for the slots
+func NewDBFileWriter(w io.Writer, slotBytes, dbSize, numPadding int) (*DBFileWriter, error) {
+
+	if slotBytes < 0 || dbSize < 0 || numPadding < 0 || numPadding > dbSize {
+		return nil, errors.New("invalid database dimensions")
+	}
+
+	header := make([]byte, dbFileHeaderBytes)
+	n := copy(header, dbFileMagic)
+	binary.BigEndian.PutUint32(header[n:], uint32(slotBytes))
+	binary.BigEndian.PutUint64(header[n+4:], uint64(dbSize))
+	binary.BigEndian.PutUint64(header[n+12:], uint64(numPadding))
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &DBFileWriter{w: bw, slotBytes: slotBytes, dbSize: dbSize}, nil
+}
+
+// WriteSlot appends the data as the next slot (zero padded to the slot size)
+func (dw *DBFileWriter) WriteSlot(data []byte) error {
+
+	if len(data) > dw.slotBytes {
+		return errors.New("data does not fit in a slot")
+	}
+
+	if dw.numWritten == dw.dbSize {
+		return errors.New("all slots have already been written")
+	}
+
+	if _, err := dw.w.Write(data); err != nil {
+		return err
+	}
+
+	for i := len(data); i < dw.slotBytes; i++ {
+		if err := dw.w.WriteByte(0); err != nil {
+			return err
+		}
+	}
+
+	dw.numWritten++
+
+	return nil
+}
+
+// Flush checks that all slots were written and flushes them to the underlying writer
+func (dw *DBFileWriter) Flush() error {
+
+	if dw.numWritten != dw.dbSize {
+		return errors.New("not all slots were written")
+	}
+
+	return dw.w.Flush()
+}
+
+// Save writes the database to w in the database file format
+func (db *Database) Save(w io.Writer) error {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	dw, err := NewDBFileWriter(w, db.SlotBytes, db.DBSize, db.NumPaddingSlots)
+	if err != nil {
+		return err
+	}
+
+	for _, slot := range db.Slots {
+		if err := dw.WriteSlot(slot.Data); err != nil {
+			return err
+		}
+	}
+
+	return dw.Flush()
+}
+
+// SaveFile writes the database to the file at path (see Save)
+func (db *Database) SaveFile(path string) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// LoadDatabase reads a database in the database file format from r
+func LoadDatabase(r io.Reader) (*Database, error) {
+
+	br := bufio.NewReader(r)
+
+	slotBytes, dbSize, numPadding, err := readDBFileHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the slots one at a time rather than trusting dbSize for the allocation
+	slots := make([]*Slot, 0)
+	for i := 0; i < dbSize; i++ {
+		slot := NewEmptySlot(slotBytes)
+		if _, err := io.ReadFull(br, slot.Data); err != nil {
+			return nil, ErrInvalidDBFile
+		}
+		slots = append(slots, slot)
+	}
+
+	db := NewDatabase()
+	db.Slots = slots
+	db.SlotBytes = slotBytes
+	db.DBSize = len(slots)
+	db.NumPaddingSlots = numPadding
+
+	return db, nil
+}
+
+// readDBFileHeader reads the header of a database file and returns
+// the slot size, the number of slots and the number of padding slots
+func readDBFileHeader(r io.Reader) (int, int, int, error) {
+
+	header := make([]byte, dbFileHeaderBytes)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, 0, ErrInvalidDBFile
+	}
+
+	n := len(dbFileMagic)
+	if string(header[:n]) != dbFileMagic {
+		return 0, 0, 0, ErrInvalidDBFile
+	}
+
+	slotBytes := int(binary.BigEndian.Uint32(header[n:]))
+	dbSize := binary.BigEndian.Uint64(header[n+4:])
+	numPadding := binary.BigEndian.Uint64(header[n+12:])
+
+	if numPadding > dbSize || dbSize > uint64(math.MaxInt) {
+		return 0, 0, 0, ErrInvalidDBFile
+	}
+
+	return slotBytes, int(dbSize), int(numPadding), nil
+}
+
+// LoadDatabaseFile reads the database stored in the file at path (see LoadDatabase)
+func LoadDatabaseFile(path string) (*Database, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadDatabase(f)
+}
@@ -0,0 +1,49 @@
+package pir
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// run with 'go test -v -run TestDatabaseFile' to see log outputs.
+func TestDatabaseFile(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	db.NumPaddingSlots = 3
+
+	path := filepath.Join(t.TempDir(), "db")
+	if err := db.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadDatabaseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.DBSize != db.DBSize || loaded.SlotBytes != db.SlotBytes || loaded.NumPaddingSlots != db.NumPaddingSlots {
+		t.Fatalf("Metadata not loaded: %v != %v\n", loaded.DBMetadata, db.DBMetadata)
+	}
+
+	for i := range db.Slots {
+		if !db.Slots[i].Equal(loaded.Slots[i]) {
+			t.Fatalf("Slot %v not loaded. %v != %v\n", i, db.Slots[i], loaded.Slots[i])
+		}
+	}
+
+	// truncated files are rejected
+	var buf bytes.Buffer
+	if err := db.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadDatabase(bytes.NewReader(buf.Bytes()[:buf.Len()-1])); err != ErrInvalidDBFile {
+		t.Fatalf("Loaded a truncated database file: %v\n", err)
+	}
+
+	if _, err := LoadDatabase(bytes.NewReader([]byte("not a database file at all"))); err != ErrInvalidDBFile {
+		t.Fatalf("Loaded an invalid database file: %v\n", err)
+	}
+}
@@ -0,0 +1,87 @@
+package pir
+
+import (
+	"errors"
+	"math"
+)
+
+/*
+ Query domains.
+ The DPF keys of a secret shared query are generated over the rows of
+ the database (bitLength(height) bits) for index queries and over the
+ keywords for keyword queries. Indices are ints, so databases with more
+ than 2^31 rows need a 64-bit platform (on which the DPF domain can be
+ up to 64 bits; see dpf.MaxNumBits). Keyword queries use a 32-bit domain
+ unless a keyword does not fit in 32 bits, in which case the metadata
+ advertises a 64-bit domain (see KeywordBits): with a 32-bit domain
+ keywords that only differ in their upper bits would select the same
+ rows (byte-string keywords use the domain chosen with SetByteKeywords).
+ The server checks that the keys of each query share match the
+ domain of the database so that shares generated from other metadata
+ are rejected with ErrStaleLayout instead of being misevaluated.
+*/
+
+// DefaultKeywordBits is the size of the domain of keyword queries when all keywords fit in 32 bits
+const DefaultKeywordBits = 32
+
+// keywordBitsFor returns the KeywordBits of a database with the keywords
+// (0 if all keywords fit in DefaultKeywordBits bits)
+func keywordBitsFor(keywords []uint) int {
+
+	for _, keyword := range keywords {
+		if uint64(keyword) > math.MaxUint32 {
+			return 64
+		}
+	}
+
+	return 0
+}
+
+// keywordDomainBits returns the number of bits of the domain of keyword queries
+func (dbmd *DBMetadata) keywordDomainBits() uint {
+
+	if dbmd.KeywordBits == 0 {
+		return DefaultKeywordBits
+	}
+
+	return uint(dbmd.KeywordBits)
+}
+
+// sharedQueryDomainBits returns the number of bits of the domain of the DPF keys of a
+// secret shared query: the rows of the database viewed with groupSize slots per row
+// or the keywords
+func (dbmd *DBMetadata) sharedQueryDomainBits(groupSize int, isKeywordBased bool) uint {
+
+	if isKeywordBased {
+		return dbmd.keywordDomainBits()
+	}
+
+	return bitLength(ceilDiv(dbmd.DBSize, groupSize))
+}
+
+// checkKeyDomain returns ErrStaleLayout if the keys of the query share were not
+// generated for the domain of the database
+func (dbmd *DBMetadata) checkKeyDomain(query *QueryShare) error {
+
+	numBits := dbmd.sharedQueryDomainBits(query.GroupSize, query.IsKeywordBased)
+
+	if query.IsTwoParty {
+		if query.KeyTwoParty == nil {
+			return errors.New("query share has no two-party key")
+		}
+		if query.KeyTwoParty.CheckDomain(numBits) != nil {
+			return ErrStaleLayout
+		}
+		return nil
+	}
+
+	if query.KeyMultiParty == nil {
+		return errors.New("query share has no multi-party key")
+	}
+
+	if query.KeyMultiParty.CheckDomain(numBits) != nil {
+		return ErrStaleLayout
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/pir/dpf"
+)
+
+// largeDBSize is a synthetic database size with more than 2^32 rows.
+// Only the metadata is used: the queries are evaluated on a few rows
+const largeDBSize = 1<<33 + 3
+
+// run with 'go test -v -run TestLargeDomainQueryShares' to see log outputs.
+func TestLargeDomainQueryShares(t *testing.T) {
+	setup()
+
+	md := &DBMetadata{DBSize: largeDBSize, SlotBytes: SlotBytes}
+
+	numBits := md.sharedQueryDomainBits(1, false)
+	if numBits != 34 {
+		t.Fatalf("Domain has %v bits, expected 34\n", numBits)
+	}
+
+	evaluate := func(shares []*QueryShare, index int) {
+
+		for _, share := range shares {
+			if err := md.checkKeyDomain(share); err != nil {
+				t.Fatalf("Query share rejected: %v\n", err)
+			}
+		}
+
+		pf := dpf.ServerInitialize(shares[0].PrfKeys, numBits)
+
+		// the upper bits of the index select the row
+		for _, x := range []int{index, index ^ 1<<32, index ^ 1<<33, index ^ 1} {
+			if x >= largeDBSize {
+				continue
+			}
+
+			selected := false
+			for _, share := range shares {
+				selected = selected != evaluateShare(pf, share, uint(x))
+			}
+
+			if selected != (x == index) {
+				t.Fatalf("Row %v is selected: %v (index %v)\n", x, selected, index)
+			}
+		}
+	}
+
+	for _, index := range []int{0, 1<<32 + rand.Intn(1<<32), largeDBSize - 1} {
+		evaluate(md.NewIndexQueryShares(index, 1, 2), index)
+		evaluate(md.NewIndexQuerySharesWithKeyVariant(index, 1, KeyFullDepth, 0), index)
+		evaluate(md.NewIndexQuerySharesWithKeyVariant(index, 1, KeyEarlyTermination, 7), index)
+	}
+
+	evaluate(md.NewIndexQueryShares(1<<32+1, 1, 3), 1<<32+1)
+
+	// shares generated for a smaller database are rejected
+	small := &DBMetadata{DBSize: 1 << 20, SlotBytes: SlotBytes}
+	if err := md.checkKeyDomain(small.NewIndexQueryShares(0, 1, 2)[0]); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestLargeDimensions' to see log outputs.
+func TestLargeDimensions(t *testing.T) {
+
+	md := &DBMetadata{DBSize: largeDBSize, SlotBytes: SlotBytes}
+
+	for _, groupSize := range []int{1, 3} {
+		width, height := md.GetDimentionsForDatabase(ceilSqrt(md.DBSize), groupSize)
+		if width*height < md.DBSize || width%groupSize != 0 {
+			t.Fatalf("Dimensions %vx%v do not cover the database\n", width, height)
+		}
+
+		row, col := md.IndexToCoordinates(md.DBSize-1, width, height)
+		if row >= height || col >= width || row*width+col != md.DBSize-1 {
+			t.Fatalf("Coordinates (%v, %v) are incorrect\n", row, col)
+		}
+	}
+
+	upload, _ := md.EstimateSharedQuerySize(1, 3)
+	if upload <= 0 {
+		t.Fatalf("Upload size overflowed: %v\n", upload)
+	}
+}
+
+// run with 'go test -v -run TestLargeKeywords' to see log outputs.
+func TestLargeKeywords(t *testing.T) {
+	setup()
+
+	// keywords that only differ in their upper 32 bits
+	base := uint(rand.Uint32())
+	keywords := make([]uint, 8)
+	for i := range keywords {
+		keywords[i] = base + uint(i)<<32
+	}
+	keywords[len(keywords)-1] |= 1 << 63
+
+	db := GenerateRandomDB(len(keywords), SlotBytes)
+	db.SetKeywords(keywords)
+
+	if db.KeywordBits != 64 {
+		t.Fatalf("Keyword domain has %v bits, expected 64\n", db.KeywordBits)
+	}
+
+	for i, keyword := range keywords {
+		if slot := retrieveKeyword(t, db, keyword, 1)[0]; !slot.Equal(db.Slots[i]) {
+			t.Fatalf("Retrieved slot %v is incorrect\n", i)
+		}
+	}
+
+	// shares generated for a 32-bit keyword domain are rejected
+	md := db.Metadata()
+	md.KeywordBits = 0
+	shares := md.NewKeywordQueryShares(int(keywords[0]), 1, 2)
+	if _, err := db.PrivateSecretSharedQuery(shares[0], 1); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+
+	db.SetKeywords([]uint{1, 2, 3, 4, 5, 6, 7, 8})
+	if db.KeywordBits != 0 {
+		t.Fatalf("Keyword domain not reset to %v bits\n", DefaultKeywordBits)
+	}
+}
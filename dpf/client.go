@@ -9,14 +9,26 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/binary"
+	"io"
+	"runtime"
+	"sync"
 )
 
 // ClientInitialize client with this function
 // numBits represents the input domain for the function, i.e. the number
 // of bits to check
 func ClientInitialize(numBits uint) *Dpf {
+	return ClientInitializeWithRand(numBits, nil)
+}
+
+// ClientInitializeWithRand is ClientInitialize with the PRF keys and the keys
+// generated by the client drawn from random instead of crypto/rand.
+// Only meant for reproducible keys (e.g., test vectors): keys are only
+// secure if random is a cryptographically secure source
+func ClientInitializeWithRand(numBits uint, random io.Reader) *Dpf {
 	f := new(Dpf)
 	f.NumBits = numBits
+	f.random = random
 	f.PrfKeys = make([]*PrfKey, initPRFLen)
 	// Create fixed AES blocks
 	f.FixedBlocks = make([]cipher.Block, initPRFLen)
@@ -24,7 +36,7 @@ func ClientInitialize(numBits uint) *Dpf {
 		f.PrfKeys[i] = &PrfKey{}
 		f.PrfKeys[i].Bytes = make([]byte, aes.BlockSize)
 
-		rand.Read(f.PrfKeys[i].Bytes)
+		f.read(f.PrfKeys[i].Bytes)
 		//fmt.Println("client")
 		//fmt.Println(f.PrfKeys[i])
 		block, err := aes.NewCipher(f.PrfKeys[i].Bytes)
@@ -54,17 +66,110 @@ func ClientInitialize(numBits uint) *Dpf {
 // It creates keys for a function that evaluates to b when input x = a.
 
 func (f *Dpf) GenerateTwoServer(a, b uint) []*Key2P {
+	fssKeys, sCurr0, sCurr1, tCurr1 := f.generateTree2P(a, f.NumBits)
+
+	// Convert final CW to integer
+	sFinal0, _ := binary.Varint(sCurr0[:8])
+	sFinal1, _ := binary.Varint(sCurr1[:8])
+	fssKeys[0].FinalCW = (int(b) - int(sFinal0) + int(sFinal1))
+	fssKeys[1].FinalCW = fssKeys[0].FinalCW
+	if tCurr1 == 1 {
+		fssKeys[0].FinalCW = fssKeys[0].FinalCW * -1
+		fssKeys[1].FinalCW = fssKeys[0].FinalCW
+	}
+	return fssKeys
+}
+
+// Generate Keys for 2-party point functions with a single output bit
+// It creates keys whose output bits XOR to 1 when input x = a and to 0 otherwise.
+// The tree stops gamma levels early (early termination) and the leaf seeds are
+// expanded into 2^gamma output bits, with the final correction word holding 2^gamma bits.
+// gamma = 0 walks the full tree.
+
+func (f *Dpf) GenerateTwoServerBits(a, gamma uint) []*Key2P {
+	fssKeys, _, _, _ := f.generateTwoServerBits(a, gamma)
+	return fssKeys
+}
+
+// generateTwoServerBits generates the keys of GenerateTwoServerBits
+// and returns the seeds of both keys at the leaf of a and the t bit of the second key
+func (f *Dpf) generateTwoServerBits(a, gamma uint) ([]*Key2P, []byte, []byte, byte) {
+	if gamma > f.NumBits {
+		gamma = f.NumBits
+	}
+
+	fssKeys, sCurr0, sCurr1, tCurr1 := f.generateTree2P(a, f.NumBits-gamma)
+
+	numLeafBits := uint(1) << gamma
+	finalBits := make([]byte, (numLeafBits+7)/8)
+
+	in := make([]byte, aes.BlockSize)
+	out0 := make([]byte, aes.BlockSize)
+	out1 := make([]byte, aes.BlockSize)
+	for j := uint(0); j < uint(len(finalBits)); j++ {
+		if j%aes.BlockSize == 0 {
+			prgBlock(sCurr0, f.FixedBlocks, j/aes.BlockSize, in, out0)
+			prgBlock(sCurr1, f.FixedBlocks, j/aes.BlockSize, in, out1)
+		}
+		finalBits[j] = out0[j%aes.BlockSize] ^ out1[j%aes.BlockSize]
+	}
+
+	// flip the output bit at the position of a within the leaf
+	low := a & (numLeafBits - 1)
+	finalBits[low/8] ^= 1 << (low % 8)
+
+	for i := range fssKeys {
+		fssKeys[i].Gamma = gamma
+		fssKeys[i].FinalBits = finalBits
+	}
+
+	return fssKeys, sCurr0, sCurr1, tCurr1
+}
+
+// Generate asymmetric keys for 2-party point functions with a single output bit
+// for servers with different bandwidth. The first key only holds a PRG seed
+// (aes.BlockSize bytes) and the second key holds all 2^NumBits output bits:
+// the expansion of the seed with the bit at a flipped. The output bits XOR
+// to 1 when input x = a and to 0 otherwise.
+// The first key is meant for the constrained server; the second key grows
+// linearly with the domain (2^NumBits/8 bytes) and should only be used for
+// small domains (e.g., the rows of a database)
+
+func (f *Dpf) GenerateTwoServerAsymmetric(a uint) []*Key2P {
+	seed := make([]byte, aes.BlockSize)
+	f.read(seed)
+
+	numBits := uint(1) << f.NumBits
+	bits := make([]byte, (numBits+7)/8)
+
+	in := make([]byte, aes.BlockSize)
+	out := make([]byte, aes.BlockSize)
+	for j := uint(0); j < uint(len(bits)); j++ {
+		if j%aes.BlockSize == 0 {
+			prgBlock(seed, f.FixedBlocks, j/aes.BlockSize, in, out)
+		}
+		bits[j] = out[j%aes.BlockSize]
+	}
+
+	bits[a/8] ^= 1 << (a % 8)
+
+	return []*Key2P{{Seed: seed}, {Bits: bits}}
+}
+
+// generateTree2P generates the correction words for the first depth levels of the tree
+// and returns the keys along with the final seeds and the final t bit of the second key
+func (f *Dpf) generateTree2P(a, depth uint) ([]*Key2P, []byte, []byte, byte) {
 	fssKeys := make([]*Key2P, 2)
 	// Set up initial values
 	tempRand1 := make([]byte, aes.BlockSize+1)
-	rand.Read(tempRand1)
+	f.read(tempRand1)
 	fssKeys[0] = &Key2P{}
 	fssKeys[0].SInit = tempRand1[:aes.BlockSize]
 	fssKeys[0].TInit = tempRand1[aes.BlockSize] % 2
 
 	fssKeys[1] = &Key2P{}
 	fssKeys[1].SInit = make([]byte, aes.BlockSize)
-	rand.Read(fssKeys[1].SInit)
+	f.read(fssKeys[1].SInit)
 	fssKeys[1].TInit = fssKeys[0].TInit ^ 1
 
 	// Set current seed being used
@@ -76,9 +181,9 @@ func (f *Dpf) GenerateTwoServer(a, b uint) []*Key2P {
 	tCurr1 := fssKeys[1].TInit
 
 	// Initialize correction words in FSS keys
-	fssKeys[0].CW = make([][]byte, f.NumBits)
-	fssKeys[1].CW = make([][]byte, f.NumBits)
-	for i := uint(0); i < f.NumBits; i++ {
+	fssKeys[0].CW = make([][]byte, depth)
+	fssKeys[1].CW = make([][]byte, depth)
+	for i := uint(0); i < depth; i++ {
 		// make AES block size + 2 bytes
 		fssKeys[0].CW[i] = make([]byte, aes.BlockSize+2)
 		fssKeys[1].CW[i] = make([]byte, aes.BlockSize+2)
@@ -86,7 +191,7 @@ func (f *Dpf) GenerateTwoServer(a, b uint) []*Key2P {
 
 	leftStart := 0
 	rightStart := aes.BlockSize + 1
-	for i := uint(0); i < f.NumBits; i++ {
+	for i := uint(0); i < depth; i++ {
 		// "expand" seed into two seeds + 2 bits
 		prf(sCurr0, f.FixedBlocks, 3, f.Temp, f.Out)
 		prfOut0 := make([]byte, aes.BlockSize*3)
@@ -137,20 +242,149 @@ func (f *Dpf) GenerateTwoServer(a, b uint) []*Key2P {
 		tCurr0 = (prfOut0[keep+aes.BlockSize] % 2) ^ tCWKeep*tCurr0
 		tCurr1 = (prfOut1[keep+aes.BlockSize] % 2) ^ tCWKeep*tCurr1
 	}
-	// Convert final CW to integer
-	sFinal0, _ := binary.Varint(sCurr0[:8])
-	sFinal1, _ := binary.Varint(sCurr1[:8])
-	fssKeys[0].FinalCW = (int(b) - int(sFinal0) + int(sFinal1))
-	fssKeys[1].FinalCW = fssKeys[0].FinalCW
-	if tCurr1 == 1 {
-		fssKeys[0].FinalCW = fssKeys[0].FinalCW * -1
-		fssKeys[1].FinalCW = fssKeys[0].FinalCW
-	}
-	return fssKeys
+
+	return fssKeys, sCurr0, sCurr1, tCurr1
 }
 
+// Generate Keys for multi-party (3 or more parties) point functions
+// It creates keys for a function that evaluates to b when input x = a
+// and whose outputs XOR to zero everywhere else.
+// Use EstimateMultiServerMemory to check the size of the keys beforehand.
+
 func (f *Dpf) GenerateMultiServer(a, b, num_p uint) []*KeyMP {
 
-	panic("not implemented")
+	p2, mu, v := multiPartyParams(f.NumBits, num_p)
+
+	delta := a % mu
+	gamma := a / mu
+
+	// back the sigma of each party with a single buffer
+	// so that the rows below can be written in place
+	keys := make([]*KeyMP, num_p)
+	rowBytes := p2 * aes.BlockSize
+	for i := uint(0); i < num_p; i++ {
+		buf := make([]byte, v*rowBytes)
+		keys[i] = &KeyMP{}
+		keys[i].NumParties = num_p
+		keys[i].Sigma = make([][]byte, v)
+		for j := uint(0); j < v; j++ {
+			keys[i].Sigma[j] = buf[j*rowBytes : (j+1)*rowBytes]
+		}
+	}
+
+	// seeds of row gamma are needed to compute the correction words
+	sGamma := make([]byte, rowBytes)
+
+	// each row is independent: pick p2 random seeds and give seed k to every
+	// party whose bit k is set, such that each seed is held by an even number
+	// of parties in every row except row gamma (where it is held by an odd number)
+	nprocs := uint(runtime.NumCPU())
+	if f.random != nil {
+		// rows are generated in order so that the keys only depend on random
+		nprocs = 1
+	}
+	rowsPerProc := (v + nprocs - 1) / nprocs
+
+	var wg sync.WaitGroup
+	for start := uint(0); start < v; start += rowsPerProc {
+		end := start + rowsPerProc
+		if end > v {
+			end = v
+		}
+
+		wg.Add(1)
+		go func(start, end uint) {
+			defer wg.Done()
+
+			seeds := make([]byte, rowBytes)
+			bits := make([]byte, p2)
+			parity := make([]byte, p2)
 
+			for i := start; i < end; i++ {
+				f.read(seeds)
+
+				var target byte = 0
+				if i == gamma {
+					target = 1
+					copy(sGamma, seeds)
+				}
+
+				for k := range parity {
+					parity[k] = target
+				}
+
+				for j := uint(0); j < num_p; j++ {
+					// the last party fixes the parity of each column
+					if j+1 == num_p {
+						copy(bits, parity)
+					} else {
+						f.read(bits)
+						for k := range bits {
+							bits[k] %= 2
+							parity[k] ^= bits[k]
+						}
+					}
+
+					row := keys[j].Sigma[i]
+					for k := uint(0); k < p2; k++ {
+						if bits[k] != 0 {
+							copy(row[k*aes.BlockSize:(k+1)*aes.BlockSize], seeds[k*aes.BlockSize:(k+1)*aes.BlockSize])
+						}
+					}
+				}
+			}
+		}(start, end)
+	}
+
+	wg.Wait()
+
+	// the correction words XOR (together with the expanded seeds of row gamma)
+	// to the point function b at position delta
+	cwSum := make([]uint32, mu)
+	in := make([]byte, aes.BlockSize)
+	out := make([]byte, aes.BlockSize)
+	wordsPerBlock := uint(aes.BlockSize) / f.M
+	for k := uint(0); k < p2; k++ {
+		seed := sGamma[k*aes.BlockSize : (k+1)*aes.BlockSize]
+		for j := uint(0); j < mu; j++ {
+			if j%wordsPerBlock == 0 {
+				prgBlock(seed, f.FixedBlocks, j/wordsPerBlock, in, out)
+			}
+			offset := (j % wordsPerBlock) * f.M
+			cwSum[j] ^= binary.LittleEndian.Uint32(out[offset : offset+f.M])
+		}
+	}
+
+	cw := make([][]uint32, p2)
+	cwBytes := make([]byte, f.M*mu)
+	for k := uint(0); k+1 < p2; k++ {
+		f.read(cwBytes)
+		cw[k] = make([]uint32, mu)
+		for j := uint(0); j < mu; j++ {
+			cw[k][j] = binary.LittleEndian.Uint32(cwBytes[f.M*j : f.M*j+f.M])
+			cwSum[j] ^= cw[k][j]
+		}
+	}
+
+	cwSum[delta] ^= uint32(b)
+	cw[p2-1] = cwSum
+
+	// correction words are identical for all parties
+	for i := uint(0); i < num_p; i++ {
+		keys[i].CW = cw
+	}
+
+	return keys
+}
+
+// read fills b with randomness from the source of the client
+func (f *Dpf) read(b []byte) {
+	if f.random == nil {
+		rand.Read(b)
+		return
+	}
+
+	if _, err := io.ReadFull(f.random, b); err != nil {
+		panic(err.Error())
+	}
 }
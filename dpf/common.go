@@ -5,10 +5,20 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"io"
+	"math"
 )
 
 const initPRFLen uint = 4
 
+// MaxNumBits is the largest domain (in bits) supported on the platform
+// (the number of bits in uint)
+const MaxNumBits = 32 << (^uint(0) >> 63)
+
+// ErrKeyDomain is returned when a key cannot be evaluated over a domain (see CheckDomain)
+var ErrKeyDomain = errors.New("key does not match the domain")
+
 // PrfKey contains the prg seed bytes
 type PrfKey struct {
 	Bytes []byte
@@ -22,16 +32,32 @@ type Dpf struct {
 	M           uint // used only in multiparty. It is default to 4. If you want to change this, you should also change the size of the CWs in the multiparty keys.
 	N           uint
 	NumBits     uint   // number of bits in domain
-	Temp        []byte // temporary slices so that we only need to allocate memory at the beginning
+	Temp        []byte // temporary slices used by key generation (evaluation uses goroutine-local scratch)
 	Out         []byte
+
+	random io.Reader // source of the randomness of the keys (crypto/rand if nil)
 }
 
 // Key2P is a two-party DPF key
 type Key2P struct {
-	SInit   []byte
-	TInit   byte
-	CW      [][]byte // there are n
-	FinalCW int
+	SInit     []byte
+	TInit     byte
+	CW        [][]byte // there are n (or n - Gamma for bit keys)
+	FinalCW   int
+	Gamma     uint   // levels cut by early termination (bit keys only)
+	FinalBits []byte // final correction word of 2^Gamma bits (bit keys only)
+
+	// asymmetric keys (see GenerateTwoServerAsymmetric) shift the key material
+	// to one server: the constrained server only receives Seed (aes.BlockSize bytes)
+	// and the other server receives all 2^NumBits output bits
+	Seed []byte // PRG seed expanded into the output bits (constrained server)
+	Bits []byte // output bits (well-connected server)
+
+	// proof correction word of verifiable keys (see GenerateTwoServerVerifiable)
+	CS []byte
+
+	// final correction word of payload keys (see GenerateTwoServerPayload)
+	FinalPayload []byte
 }
 
 // KeyMP is a multi-party DPF key
@@ -39,6 +65,8 @@ type KeyMP struct {
 	NumParties uint
 	CW         [][]uint32 // Assume CW is 32-bit because f.M is 4. If you change f.M, you should change this
 	Sigma      [][]byte
+
+	packed *packedSigma // compressed Sigma of a decoded key (see UnmarshalBinary)
 }
 
 // Helper functions
@@ -73,3 +101,108 @@ func prf(x []byte, aesBlocks []cipher.Block, numBlocks uint, temp, out []byte) {
 		}
 	}
 }
+
+// multiPartyParams returns the layout of a multi-party key over a domain
+// of numBits bits: the domain is viewed as a v x mu grid where each of the
+// v rows holds p2 = 2^(numParties-1) seeds and each correction word has mu entries
+func multiPartyParams(numBits, numParties uint) (p2, mu, v uint) {
+	p2 = uint(1) << (numParties - 1)
+	mu = uint(math.Ceil(math.Pow(2, float64(numBits)/2) * math.Pow(2, float64(numParties-1)/2)))
+	v = uint(math.Ceil(math.Pow(2, float64(numBits)) / float64(mu)))
+	return p2, mu, v
+}
+
+// EstimateMultiServerMemory returns the size in bytes of one party's KeyMP
+// and the total number of bytes allocated by GenerateMultiServer for a domain
+// of numBits bits split across numParties parties.
+// Clients can use it to check that key generation is feasible before calling it.
+func EstimateMultiServerMemory(numBits, numParties uint) (keyBytes, totalBytes uint64) {
+	p2, mu, v := multiPartyParams(numBits, numParties)
+
+	sigmaBytes := float64(v) * float64(p2) * aes.BlockSize
+	cwBytes := float64(p2) * float64(mu) * 4
+
+	return saturatingUint64(sigmaBytes + cwBytes),
+		saturatingUint64(float64(numParties)*sigmaBytes + cwBytes)
+}
+
+func saturatingUint64(x float64) uint64 {
+	if x >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(x)
+}
+
+// prgBlock writes the ctr-th block of the expansion of seed x into out
+// using the fixed key PRF on x xor'd with the block counter.
+// Blocks can be computed independently so evaluation only expands the block it needs.
+func prgBlock(x []byte, aesBlocks []cipher.Block, ctr uint, in, out []byte) {
+	copy(in, x)
+	numKeys := uint(len(aesBlocks))
+	binary.LittleEndian.PutUint64(in, binary.LittleEndian.Uint64(in)^uint64(ctr/numKeys))
+	aesBlocks[ctr%numKeys].Encrypt(out, in)
+	for j := range out[:aes.BlockSize] {
+		out[j] ^= in[j]
+	}
+}
+
+// CheckDomain returns ErrKeyDomain if the key was not generated for a domain of numBits bits
+// (evaluating such a key would read past its correction words)
+func (k *Key2P) CheckDomain(numBits uint) error {
+
+	if numBits > MaxNumBits {
+		return ErrKeyDomain
+	}
+
+	switch {
+	case k.Bits != nil:
+		if numBits >= MaxNumBits || uint64(len(k.Bits)) != (uint64(1)<<numBits+7)/8 {
+			return ErrKeyDomain
+		}
+	case k.Seed != nil:
+		if len(k.Seed) != aes.BlockSize {
+			return ErrKeyDomain
+		}
+	default:
+		if len(k.SInit) != aes.BlockSize || k.Gamma > numBits || uint(len(k.CW))+k.Gamma != numBits {
+			return ErrKeyDomain
+		}
+		for _, cw := range k.CW {
+			if len(cw) != aes.BlockSize+2 {
+				return ErrKeyDomain
+			}
+		}
+		// bit keys hold 2^Gamma final bits
+		if k.FinalBits != nil && (k.Gamma >= MaxNumBits || uint64(len(k.FinalBits)) != (uint64(1)<<k.Gamma+7)/8) {
+			return ErrKeyDomain
+		}
+		// verifiable keys are full-depth bit or payload keys with a non-zero proof correction word
+		if k.CS != nil && (!validProofCorrection(k.CS) || k.Gamma != 0 || (k.FinalBits == nil && k.FinalPayload == nil)) {
+			return ErrKeyDomain
+		}
+	}
+
+	return nil
+}
+
+// CheckDomain returns ErrKeyDomain if the key was not generated for a domain of numBits bits
+func (k *KeyMP) CheckDomain(numBits uint) error {
+
+	if numBits > MaxNumBits || k.NumParties < 2 || k.NumParties > MaxNumBits {
+		return ErrKeyDomain
+	}
+
+	p2, mu, v := multiPartyParams(numBits, k.NumParties)
+
+	if rows, blocks := k.sigmaShape(); uint(len(k.CW)) != p2 || rows != v || blocks != p2 {
+		return ErrKeyDomain
+	}
+
+	for _, cw := range k.CW {
+		if uint(len(cw)) != mu {
+			return ErrKeyDomain
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,7 @@
+// Package dpf implements distributed point functions (function secret sharing of
+// point functions) for two servers and for more servers.
+//
+// The package only depends on the standard library. It is a module of its own
+// (github.com/sachaservan/pir/dpf) so that it can be imported without the cgo
+// dependencies (gmp, paillier) of the pir package.
+package dpf
@@ -1,8 +1,16 @@
 package dpf
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
 	"math"
 	"math/rand"
+	"sync"
 	"testing"
 )
 
@@ -70,6 +78,40 @@ func TestCorrectPointFunctionTwoServer(t *testing.T) {
 	}
 }
 
+func TestEvaluate2PBit(t *testing.T) {
+
+	for trial := 0; trial < numTrials; trial++ {
+		num := rand.Intn(1<<10) + 100
+
+		specialIndex := uint(rand.Intn(num))
+
+		// generate fss Keys on client
+		fClient := ClientInitialize(uint(math.Log2(float64(num))) + 1)
+		fssKeys := fClient.GenerateTwoServer(specialIndex, 1)
+
+		// simulate the server
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		for i := 0; i < num; i++ {
+			bit0 := fServer.Evaluate2PBit(0, fssKeys[0], uint(i))
+			bit1 := fServer.Evaluate2PBit(1, fssKeys[1], uint(i))
+
+			// must match the parity of the full output
+			if ans0 := fServer.Evaluate2P(0, fssKeys[0], uint(i)); uint8(ans0&1) != bit0 {
+				t.Fatalf("Parity of %v is not %v", ans0, bit0)
+			}
+
+			if uint(i) == specialIndex && bit0^bit1 != 1 {
+				t.Fatalf("Expected: %v Got: %v", 1, bit0^bit1)
+			}
+
+			if uint(i) != specialIndex && bit0^bit1 != 0 {
+				t.Fatalf("Expected: 0 Got: %v", bit0^bit1)
+			}
+		}
+	}
+}
+
 func TestCorrectTwoServerKeyword(t *testing.T) {
 
 	for trial := 0; trial < numTrials; trial++ {
@@ -106,6 +148,258 @@ func TestCorrectTwoServerKeyword(t *testing.T) {
 	}
 }
 
+func TestCorrectTwoServerBits(t *testing.T) {
+
+	for trial := 0; trial < numTrials/10; trial++ {
+		num := rand.Intn(1<<10) + 100
+		numBits := uint(math.Log2(float64(num))) + 1
+
+		specialIndex := uint(rand.Intn(num))
+
+		for gamma := uint(0); gamma <= numBits; gamma++ {
+
+			// generate fss Keys on client
+			fClient := ClientInitialize(numBits)
+			fssKeys := fClient.GenerateTwoServerBits(specialIndex, gamma)
+
+			if len(fssKeys[0].CW) != int(numBits-gamma) {
+				t.Fatalf("Expected %v correction words, got %v", numBits-gamma, len(fssKeys[0].CW))
+			}
+
+			// simulate the server
+			fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+			for i := 0; i < num; i++ {
+				ans := fServer.Evaluate2PBits(fssKeys[0], uint(i)) ^ fServer.Evaluate2PBits(fssKeys[1], uint(i))
+
+				if uint(i) == specialIndex && ans != 1 {
+					t.Fatalf("Expected: 1 Got: %v (gamma = %v)", ans, gamma)
+				}
+
+				if uint(i) != specialIndex && ans != 0 {
+					t.Fatalf("Expected: 0 Got: %v (gamma = %v)", ans, gamma)
+				}
+			}
+		}
+	}
+}
+
+func TestCorrectTwoServerAsymmetric(t *testing.T) {
+
+	for trial := 0; trial < numTrials/10; trial++ {
+		num := rand.Intn(1<<10) + 100
+		numBits := uint(math.Log2(float64(num))) + 1
+
+		specialIndex := uint(rand.Intn(num))
+
+		// generate fss Keys on client
+		fClient := ClientInitialize(numBits)
+		fssKeys := fClient.GenerateTwoServerAsymmetric(specialIndex)
+
+		if len(fssKeys[0].Seed) != 16 || len(fssKeys[1].Bits) != (1<<numBits+7)/8 {
+			t.Fatalf("Unexpected key sizes %v and %v", len(fssKeys[0].Seed), len(fssKeys[1].Bits))
+		}
+
+		// simulate the server
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		for i := 0; i < num; i++ {
+			ans := fServer.Evaluate2PBits(fssKeys[0], uint(i)) ^ fServer.Evaluate2PBits(fssKeys[1], uint(i))
+
+			if uint(i) == specialIndex && ans != 1 {
+				t.Fatalf("Expected: 1 Got: %v", ans)
+			}
+
+			if uint(i) != specialIndex && ans != 0 {
+				t.Fatalf("Expected: 0 Got: %v", ans)
+			}
+		}
+	}
+}
+
+func TestCorrectMultiServer(t *testing.T) {
+
+	for trial := 0; trial < numTrials/10; trial++ {
+		num := rand.Intn(1<<10) + 100
+		numParties := uint(rand.Intn(3) + 3)
+
+		specialIndex := uint(rand.Intn(num))
+		outputValueAtSpecialIndex := uint32(rand.Intn(1<<32-1) + 1)
+
+		// generate fss Keys on client
+		fClient := ClientInitialize(uint(math.Log2(float64(num))) + 1)
+		fssKeys := fClient.GenerateMultiServer(specialIndex, uint(outputValueAtSpecialIndex), numParties)
+
+		// simulate the servers
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		for i := 0; i < num; i++ {
+			var ans uint32
+			for _, key := range fssKeys {
+				ans ^= fServer.EvaluateMP(key, uint(i))
+			}
+
+			if uint(i) == specialIndex && ans != outputValueAtSpecialIndex {
+				t.Fatalf("Expected: %v Got: %v", outputValueAtSpecialIndex, ans)
+			}
+
+			if uint(i) != specialIndex && ans != 0 {
+				t.Fatalf("Expected: 0 Got: %v", ans)
+			}
+		}
+	}
+}
+
+func TestEvalFull(t *testing.T) {
+
+	for trial := 0; trial < numTrials/10; trial++ {
+		num := rand.Intn(1<<10) + 100
+		numBits := uint(math.Log2(float64(num))) + 1
+
+		specialIndex := uint(rand.Intn(num))
+
+		// full domain or a random range of it
+		lo := uint(0)
+		n := num
+		if trial%2 == 1 {
+			lo = uint(rand.Intn(num))
+			n = rand.Intn(num-int(lo)) + 1
+		}
+
+		fClient := ClientInitialize(numBits)
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		out := make([]byte, n)
+		for _, k := range fClient.GenerateTwoServer(specialIndex, 1) {
+			fServer.EvalFull2PBit(k, lo, out)
+			for i := range out {
+				if out[i] != fServer.Evaluate2PBit(0, k, lo+uint(i)) {
+					t.Fatalf("EvalFull2PBit differs from Evaluate2PBit at %v", lo+uint(i))
+				}
+			}
+		}
+
+		keys := append(fClient.GenerateTwoServerBits(specialIndex, uint(trial)%numBits), fClient.GenerateTwoServerAsymmetric(specialIndex)...)
+		for _, k := range keys {
+			fServer.EvalFull2PBits(k, lo, out)
+			for i := range out {
+				if out[i] != fServer.Evaluate2PBits(k, lo+uint(i)) {
+					t.Fatalf("EvalFull2PBits differs from Evaluate2PBits at %v", lo+uint(i))
+				}
+			}
+		}
+
+		outMP := make([]uint32, n)
+		for _, k := range fClient.GenerateMultiServer(specialIndex, 1, 3) {
+			fServer.EvalFullMP(k, lo, outMP)
+			for i := range outMP {
+				if outMP[i] != fServer.EvaluateMP(k, lo+uint(i)) {
+					t.Fatalf("EvalFullMP differs from EvaluateMP at %v", lo+uint(i))
+				}
+			}
+		}
+	}
+}
+
+func TestEstimateMultiServerMemory(t *testing.T) {
+
+	for numParties := uint(3); numParties < 6; numParties++ {
+		fClient := ClientInitialize(12)
+		fssKeys := fClient.GenerateMultiServer(0, 1, numParties)
+
+		keyBytes, totalBytes := EstimateMultiServerMemory(12, numParties)
+
+		sigmaBytes := uint64(0)
+		for _, row := range fssKeys[0].Sigma {
+			sigmaBytes += uint64(len(row))
+		}
+
+		cwBytes := uint64(0)
+		for _, cw := range fssKeys[0].CW {
+			cwBytes += uint64(len(cw) * 4)
+		}
+
+		if sigmaBytes+cwBytes != keyBytes {
+			t.Fatalf("Expected key size: %v Got: %v", sigmaBytes+cwBytes, keyBytes)
+		}
+
+		if uint64(numParties)*sigmaBytes+cwBytes != totalBytes {
+			t.Fatalf("Expected total size: %v Got: %v", uint64(numParties)*sigmaBytes+cwBytes, totalBytes)
+		}
+	}
+}
+
+func TestCheckDomain(t *testing.T) {
+
+	for _, numBits := range []uint{8, 34} {
+		fClient := ClientInitialize(numBits)
+
+		keys := [][]*Key2P{
+			fClient.GenerateTwoServer(1, 1),
+			fClient.GenerateTwoServerBits(1, 0),
+			fClient.GenerateTwoServerBits(1, 7),
+			fClient.GenerateTwoServerVerifiable(1),
+		}
+		if numBits == 8 {
+			keys = append(keys, fClient.GenerateTwoServerAsymmetric(1))
+		}
+
+		for _, pair := range keys {
+			for _, k := range pair {
+				if err := k.CheckDomain(numBits); err != nil {
+					t.Fatalf("Key rejected for its domain of %v bits", numBits)
+				}
+
+				// seeds can be evaluated over any domain
+				if k.Seed == nil && k.CheckDomain(numBits+1) != ErrKeyDomain {
+					t.Fatalf("Key accepted for a domain of %v bits", numBits+1)
+				}
+			}
+		}
+
+		for _, k := range fClient.GenerateMultiServer(1, 1, 3) {
+			if err := k.CheckDomain(numBits); err != nil {
+				t.Fatalf("Multi-party key rejected for its domain of %v bits", numBits)
+			}
+
+			if k.CheckDomain(numBits+2) != ErrKeyDomain {
+				t.Fatalf("Multi-party key accepted for a domain of %v bits", numBits+2)
+			}
+		}
+	}
+}
+
+func TestConcurrentEvaluation(t *testing.T) {
+
+	fClient := ClientInitialize(10)
+	fssKeys := fClient.GenerateTwoServer(7, 1)
+
+	fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+	// concurrent evaluation of the shared Dpf
+	var wg sync.WaitGroup
+	errs := make(chan uint, 1<<10)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint(0); i < 1<<10; i++ {
+				ans := fServer.Evaluate2P(0, fssKeys[0], i) + fServer.Evaluate2P(1, fssKeys[1], i)
+				if (i == 7 && ans != 1) || (i != 7 && ans != 0) {
+					errs <- i
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for i := range errs {
+		t.Fatalf("Incorrect concurrent evaluation at %v", i)
+	}
+}
+
 func Benchmark2PartyServerInit(b *testing.B) {
 
 	fClient := ClientInitialize(32)
@@ -142,3 +436,535 @@ func Benchmark2Party64BitKeywordEval(b *testing.B) {
 		fServer.Evaluate2P(0, fssKeys[0], uint(i))
 	}
 }
+
+func BenchmarkMultiPartyGenerate(b *testing.B) {
+
+	fClient := ClientInitialize(20)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		fClient.GenerateMultiServer(1, 1, 4)
+	}
+}
+
+func TestMultiServerKeyEncoding(t *testing.T) {
+
+	for numParties := uint(3); numParties < 6; numParties++ {
+		num := rand.Intn(1<<10) + 100
+		specialIndex := uint(rand.Intn(num))
+
+		fClient := ClientInitialize(uint(math.Log2(float64(num))) + 1)
+		fssKeys := fClient.GenerateMultiServer(specialIndex, 1, numParties)
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		// keys for another point have the same length
+		otherKey, err := fClient.GenerateMultiServer((specialIndex+1)%uint(num), 1, numParties)[0].MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := make([]*KeyMP, len(fssKeys))
+		for i, key := range fssKeys {
+			b, err := key.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(b) != len(otherKey) {
+				t.Fatalf("Encoded keys have different lengths: %v != %v bytes", len(b), len(otherKey))
+			}
+
+			// keys in the packed encoding of earlier releases are still decoded
+			decoded[i] = &KeyMP{}
+			if err := decoded[i].UnmarshalBinary(marshalPackedKeyMP(key)); err != nil {
+				t.Fatal(err)
+			}
+
+			unpacked := &KeyMP{}
+			if err := unpacked.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if unpacked.packed != nil || !sigmaEqual(unpacked.Sigma, key.Sigma) {
+				t.Fatalf("Decoded sigma does not match the key")
+			}
+
+			// truncated and extended encodings are rejected
+			if err := (&KeyMP{}).UnmarshalBinary(b[:len(b)-1]); err == nil {
+				t.Fatalf("Decoded a truncated key")
+			}
+			if err := (&KeyMP{}).UnmarshalBinary(append(b, 0)); err == nil {
+				t.Fatalf("Decoded a key with trailing bytes")
+			}
+		}
+
+		// decoded keys are evaluated without unpacking sigma
+		for x := 0; x < num; x++ {
+			var ans uint32
+			for i, key := range decoded {
+				y := fServer.EvaluateMP(key, uint(x))
+				if y != fServer.EvaluateMP(fssKeys[i], uint(x)) {
+					t.Fatalf("Decoded key evaluates differently at %v", x)
+				}
+				ans ^= y
+			}
+
+			if (uint(x) == specialIndex) != (ans == 1) {
+				t.Fatalf("Incorrect output %v at %v", ans, x)
+			}
+		}
+
+		for i, key := range decoded {
+			key.UnpackSigma()
+			if !sigmaEqual(key.Sigma, fssKeys[i].Sigma) {
+				t.Fatalf("Unpacked sigma does not match the key")
+			}
+		}
+	}
+}
+
+func sigmaEqual(a, b [][]byte) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for r := range a {
+		if !bytes.Equal(a[r], b[r]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// marshalPackedKeyMP encodes the key in the packed encoding of earlier releases (version 1)
+func marshalPackedKeyMP(k *KeyMP) []byte {
+
+	buf := []byte{keyMPEncodingVersion}
+	buf = binary.AppendUvarint(buf, uint64(k.NumParties))
+
+	buf = binary.AppendUvarint(buf, uint64(len(k.CW)))
+	for _, cw := range k.CW {
+		buf = binary.AppendUvarint(buf, uint64(len(cw)))
+		for _, w := range cw {
+			buf = binary.LittleEndian.AppendUint32(buf, w)
+		}
+	}
+
+	blocksPerRow := len(k.Sigma[0]) / aes.BlockSize
+	buf = binary.AppendUvarint(buf, uint64(len(k.Sigma)))
+	buf = binary.AppendUvarint(buf, uint64(blocksPerRow))
+
+	for _, row := range k.Sigma {
+		bitmap := make([]byte, (blocksPerRow+7)/8)
+		var blocks []byte
+		for i := 0; i < blocksPerRow; i++ {
+			block := row[i*aes.BlockSize : (i+1)*aes.BlockSize]
+			if !isZeroBlock(block) {
+				bitmap[i/8] |= 1 << (i % 8)
+				blocks = append(blocks, block...)
+			}
+		}
+
+		buf = append(buf, bitmap...)
+		buf = append(buf, blocks...)
+	}
+
+	return buf
+}
+
+// marshalVarintKey2P encodes the key with FinalCW as a varint (versions 2 to 4
+// of earlier releases)
+func marshalVarintKey2P(k *Key2P) []byte {
+
+	version := key2PEncodingVersion
+	if k.FinalPayload != nil {
+		version = key2PPayloadEncodingVersion
+	} else if k.CS != nil {
+		version = key2PVerifiableEncodingVersion
+	}
+
+	buf := []byte{version}
+	buf = appendNullableBytes(buf, k.SInit)
+	buf = append(buf, k.TInit)
+
+	buf = binary.AppendUvarint(buf, uint64(len(k.CW)))
+	for _, cw := range k.CW {
+		buf = appendNullableBytes(buf, cw)
+	}
+
+	buf = binary.AppendVarint(buf, int64(k.FinalCW))
+	buf = binary.AppendUvarint(buf, uint64(k.Gamma))
+	buf = appendNullableBytes(buf, k.FinalBits)
+	buf = appendNullableBytes(buf, k.Seed)
+	buf = appendNullableBytes(buf, k.Bits)
+
+	if version != key2PEncodingVersion {
+		buf = appendNullableBytes(buf, k.CS)
+	}
+	if version == key2PPayloadEncodingVersion {
+		buf = appendNullableBytes(buf, k.FinalPayload)
+	}
+
+	return buf
+}
+
+func TestTwoServerKeyEncodingLengths(t *testing.T) {
+
+	fClient := ClientInitialize(10)
+	payload := []byte{1, 2, 3}
+
+	generators := map[string]func(a uint) []*Key2P{
+		"point":      func(a uint) []*Key2P { return fClient.GenerateTwoServer(a, 1) },
+		"bits":       func(a uint) []*Key2P { return fClient.GenerateTwoServerBits(a, 3) },
+		"verifiable": func(a uint) []*Key2P { return fClient.GenerateTwoServerVerifiable(a) },
+		"payload":    func(a uint) []*Key2P { return fClient.GenerateTwoServerPayload(a, payload) },
+	}
+
+	for name, generate := range generators {
+		length := -1
+		for trial := 0; trial < 50; trial++ {
+			for _, key := range generate(uint(rand.Intn(1 << 10))) {
+				b, err := key.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// FinalCW is encoded at a fixed width
+				if length >= 0 && len(b) != length {
+					t.Fatalf("Encoded %v keys have different lengths: %v != %v bytes", name, len(b), length)
+				}
+				length = len(b)
+
+				// keys with a varint FinalCW (earlier releases) are still decoded
+				decoded := &Key2P{}
+				if err := decoded.UnmarshalBinary(marshalVarintKey2P(key)); err != nil {
+					t.Fatal(err)
+				}
+				if decoded.FinalCW != key.FinalCW || !bytes.Equal(decoded.CS, key.CS) ||
+					!bytes.Equal(decoded.FinalPayload, key.FinalPayload) {
+					t.Fatalf("Decoded %v key does not match the key", name)
+				}
+
+				if err := decoded.UnmarshalBinary(b); err != nil || decoded.FinalCW != key.FinalCW {
+					t.Fatalf("Decoded %v key does not match the key (%v)", name, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifiableTwoServer(t *testing.T) {
+
+	for trial := 0; trial < 100; trial++ {
+		num := rand.Intn(1<<10) + 100
+		specialIndex := uint(rand.Intn(num))
+
+		fClient := ClientInitialize(uint(math.Log2(float64(num))) + 1)
+		fssKeys := fClient.GenerateTwoServerVerifiable(specialIndex)
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		// keys survive encoding
+		for i, key := range fssKeys {
+			b, err := key.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fssKeys[i] = &Key2P{}
+			if err := fssKeys[i].UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		out0 := make([]byte, num)
+		out1 := make([]byte, num)
+		proof0, err := fServer.EvalFull2PBitsProof(fssKeys[0], 0, out0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proof1, err := fServer.EvalFull2PBitsProof(fssKeys[1], 0, out1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !VerifyProofs(proof0, proof1) {
+			t.Fatalf("Proofs of honest keys do not match")
+		}
+
+		for x := 0; x < num; x++ {
+			if (uint(x) == specialIndex) != (out0[x]^out1[x] == 1) {
+				t.Fatalf("Incorrect output at %v", x)
+			}
+			if out0[x] != fServer.Evaluate2PBits(fssKeys[0], uint(x)) {
+				t.Fatalf("Output at %v does not match Evaluate2PBits", x)
+			}
+		}
+
+		// keys for different points (two non-zero outputs) are rejected
+		other := fClient.GenerateTwoServerVerifiable((specialIndex + 1) % uint(num))
+		proof1, _ = fServer.EvalFull2PBitsProof(other[1], 0, out1)
+		if VerifyProofs(proof0, proof1) {
+			t.Fatalf("Proofs of keys for different points match")
+		}
+
+		// tampered correction words are rejected
+		tampered := *fssKeys[1]
+		tampered.FinalBits = []byte{fssKeys[1].FinalBits[0] ^ 1}
+		proof1, _ = fServer.EvalFull2PBitsProof(&tampered, 0, out1)
+		if VerifyProofs(proof0, proof1) {
+			t.Fatalf("Proof of a key with a tampered final correction word matches")
+		}
+	}
+
+	fClient := ClientInitialize(8)
+	if _, err := fClient.EvalFull2PBitsProof(fClient.GenerateTwoServerBits(1, 0)[0], 0, make([]byte, 8)); err != ErrNotVerifiable {
+		t.Fatalf("Expected ErrNotVerifiable, got %v", err)
+	}
+}
+
+// forgeEverywhereKeys returns keys with equal seeds and different t bits at every leaf
+// (their outputs differ on every point) along with a proof correction word cs
+func forgeEverywhereKeys(numBits uint, cs []byte) []*Key2P {
+
+	sInit := make([]byte, aes.BlockSize)
+	rand.Read(sInit)
+
+	cw := make([][]byte, numBits)
+	for i := range cw {
+		cw[i] = make([]byte, aes.BlockSize+2)
+		cw[i][aes.BlockSize] = 1
+		cw[i][aes.BlockSize+1] = 1
+	}
+
+	keys := make([]*Key2P, 2)
+	for i := range keys {
+		keys[i] = &Key2P{SInit: sInit, TInit: byte(i), CW: cw, FinalBits: []byte{1}, CS: cs}
+	}
+
+	return keys
+}
+
+func TestVerifiableTwoServerForged(t *testing.T) {
+
+	numBits := uint(6)
+	fClient := ClientInitialize(numBits)
+	fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+	// an all-zero proof correction word is rejected
+	forged := forgeEverywhereKeys(numBits, make([]byte, sha256.Size))
+	if err := forged[0].CheckDomain(numBits); err != ErrKeyDomain {
+		t.Fatalf("Expected ErrKeyDomain, got %v", err)
+	}
+	if _, err := fServer.EvalFull2PBitsProof(forged[0], 0, make([]byte, 1<<numBits)); err != ErrNotVerifiable {
+		t.Fatalf("Expected ErrNotVerifiable, got %v", err)
+	}
+
+	// any other proof correction word does not match the hashes of the t bits
+	cs := make([]byte, sha256.Size)
+	rand.Read(cs)
+	forged = forgeEverywhereKeys(numBits, cs)
+
+	outs := [][]byte{make([]byte, 1<<numBits), make([]byte, 1<<numBits)}
+	proofs := make([][]byte, 2)
+	for i := range forged {
+		var err error
+		if proofs[i], err = fServer.EvalFull2PBitsProof(forged[i], 0, outs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for x := range outs[0] {
+		if outs[0][x] == outs[1][x] {
+			t.Fatalf("Forged keys agree at %v", x)
+		}
+	}
+
+	if VerifyProofs(proofs[0], proofs[1]) {
+		t.Fatalf("Proofs of keys selecting every point match")
+	}
+}
+
+func TestPayloadTwoServer(t *testing.T) {
+
+	for trial := 0; trial < 50; trial++ {
+		num := rand.Intn(1<<9) + 10
+		specialIndex := uint(rand.Intn(num))
+
+		payload := make([]byte, rand.Intn(40)+1)
+		rand.Read(payload)
+
+		fClient := ClientInitialize(uint(math.Log2(float64(num))) + 1)
+		fssKeys := fClient.GenerateTwoServerPayload(specialIndex, payload)
+		fServer := ServerInitialize(fClient.PrfKeys, fClient.NumBits)
+
+		// keys survive encoding
+		for i, key := range fssKeys {
+			b, err := key.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			fssKeys[i] = &Key2P{}
+			if err := fssKeys[i].UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		outs := make([][][]byte, 2)
+		proofs := make([][]byte, 2)
+		for i := range outs {
+			outs[i] = make([][]byte, num)
+			for x := range outs[i] {
+				outs[i][x] = make([]byte, len(payload))
+			}
+
+			var err error
+			if proofs[i], err = fServer.EvalFull2PPayloadProof(fssKeys[i], 0, outs[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !VerifyProofs(proofs[0], proofs[1]) {
+			t.Fatalf("Proofs of honest keys do not match")
+		}
+
+		for x := 0; x < num; x++ {
+			xored := append([]byte{}, outs[0][x]...)
+			xorBytes(xored, outs[1][x])
+
+			expected := make([]byte, len(payload))
+			if uint(x) == specialIndex {
+				expected = payload
+			}
+			if !bytes.Equal(xored, expected) {
+				t.Fatalf("Incorrect output at %v", x)
+			}
+		}
+
+		// keys for different points (two non-zero outputs) are rejected
+		other := fClient.GenerateTwoServerPayload((specialIndex+1)%uint(num), payload)
+		proof, _ := fServer.EvalFull2PPayloadProof(other[1], 0, outs[1])
+		if VerifyProofs(proofs[0], proof) {
+			t.Fatalf("Proofs of keys for different points match")
+		}
+	}
+
+	fClient := ClientInitialize(8)
+	out := [][]byte{make([]byte, 1)}
+	if _, err := fClient.EvalFull2PPayloadProof(fClient.GenerateTwoServerVerifiable(1)[0], 0, out); err != ErrNotVerifiable {
+		t.Fatalf("Expected ErrNotVerifiable, got %v", err)
+	}
+}
+
+// wireKeys is a query as sent to a server (PRF keys and a key of each type)
+type wireKeys struct {
+	PrfKeys []*PrfKey
+	Key2P   *Key2P
+	KeyMP   *KeyMP
+}
+
+func TestKeyWireEncodings(t *testing.T) {
+
+	num := 1000
+	specialIndex := uint(rand.Intn(num))
+
+	fClient := ClientInitialize(10)
+	keys2P := fClient.GenerateTwoServerBits(specialIndex, 3)
+	keysMP := fClient.GenerateMultiServer(specialIndex, 1, 3)
+
+	// keys decoded from the packed encoding keep Sigma packed
+	packed := &KeyMP{}
+	if err := packed.UnmarshalBinary(marshalPackedKeyMP(keysMP[0])); err != nil {
+		t.Fatal(err)
+	}
+
+	in := &wireKeys{PrfKeys: fClient.PrfKeys, Key2P: keys2P[0], KeyMP: packed}
+
+	var gobBuf bytes.Buffer
+	if err := gob.NewEncoder(&gobBuf).Encode(in); err != nil {
+		t.Fatal(err)
+	}
+	fromGob := &wireKeys{}
+	if err := gob.NewDecoder(&gobBuf).Decode(fromGob); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonBytes, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON := &wireKeys{}
+	if err := json.Unmarshal(jsonBytes, fromJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, out := range []*wireKeys{fromGob, fromJSON} {
+		fServer := ServerInitialize(out.PrfKeys, fClient.NumBits)
+		for x := 0; x < num; x++ {
+			want2P := fClient.Evaluate2PBits(keys2P[0], uint(x))
+			wantMP := fClient.EvaluateMP(keysMP[0], uint(x))
+			if fServer.Evaluate2PBits(out.Key2P, uint(x)) != want2P || fServer.EvaluateMP(out.KeyMP, uint(x)) != wantMP {
+				t.Fatalf("Decoded keys evaluate incorrectly at %v", x)
+			}
+		}
+	}
+
+	// malformed encodings are rejected
+	if err := (&PrfKey{}).UnmarshalText([]byte("not base64!")); err != ErrInvalidKeyEncoding {
+		t.Fatalf("Decoded malformed text")
+	}
+	prf, err := fClient.PrfKeys[0].MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&PrfKey{}).UnmarshalBinary(prf[:len(prf)-1]); err != ErrInvalidKeyEncoding {
+		t.Fatalf("Decoded a truncated PRF key")
+	}
+	if err := (&Key2P{}).UnmarshalBinary(prf); err != ErrInvalidKeyEncoding {
+		t.Fatalf("Decoded a PRF key as a two-party key")
+	}
+}
+
+func TestClientInitializeWithRand(t *testing.T) {
+
+	generate := func(seed int64) [][]byte {
+		fClient := ClientInitializeWithRand(10, rand.New(rand.NewSource(seed)))
+
+		var keys []encoding.BinaryMarshaler
+		for _, k := range fClient.PrfKeys {
+			keys = append(keys, k)
+		}
+		for _, k := range fClient.GenerateTwoServer(3, 1) {
+			keys = append(keys, k)
+		}
+		for _, k := range fClient.GenerateTwoServerBits(3, 2) {
+			keys = append(keys, k)
+		}
+		for _, k := range fClient.GenerateMultiServer(3, 1, 3) {
+			keys = append(keys, k)
+		}
+
+		encoded := make([][]byte, len(keys))
+		for i, k := range keys {
+			b, err := k.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoded[i] = b
+		}
+
+		return encoded
+	}
+
+	// the keys only depend on the seed
+	a, b, c := generate(1), generate(1), generate(2)
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			t.Fatalf("Keys %v generated from the same seed are different", i)
+		}
+	}
+
+	if bytes.Equal(a[0], c[0]) {
+		t.Fatalf("Keys generated from different seeds are the same")
+	}
+}
@@ -0,0 +1,589 @@
+package dpf
+
+// This file contains the wire encoding of keys, stable across releases so
+// that keys can be persisted and exchanged with implementations in other
+// languages. Every encoding starts with a version byte identifying the type
+// of the key and the fields present (see the versions below); decoders
+// reject unknown versions, truncated encodings and trailing bytes.
+// Integers are unsigned LEB128 varints (uvarint) except FinalCW (zigzag
+// varint) and the entries of the correction words of multi-party keys
+// (4-byte little-endian). Byte strings are nullable: a 0 byte for nil, or a
+// 1 byte followed by the uvarint length and the bytes.
+//
+//	PrfKey (5):      uvarint len, bytes
+//	Key2P (2):       SInit, TInit (1 byte), uvarint len(CW), CW[i]...,
+//	                 FinalCW, uvarint Gamma, FinalBits, Seed, Bits
+//	Key2P (3):       as 2, followed by CS
+//	Key2P (4):       as 3, followed by FinalPayload
+//	KeyMP (1):       uvarint NumParties, uvarint len(CW), for each CW its
+//	                 uvarint length and entries, uvarint rows, uvarint blocks
+//	                 per row, and for each row of Sigma a bitmap of its
+//	                 non-zero 16-byte blocks followed by those blocks
+//	Key2P (6, 7, 8): as 2, 3 and 4 with FinalCW as an 8-byte little-endian
+//	                 two's complement integer
+//	KeyMP (9):       as 1 with every block of each row of Sigma (no bitmaps)
+//
+// Keys are encoded with the fixed-width versions (6 to 9) so that the length
+// of the encoding only depends on the parameters of the key and not on its
+// random values (FinalCW and the zero blocks of Sigma); the other versions
+// are decoded for keys encoded by earlier releases.
+//
+// The text encoding (MarshalText, used by encoding/json) is the standard
+// base64 encoding of the binary encoding; encoding/gob uses the binary one.
+
+import (
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// ErrInvalidKeyEncoding is returned when decoding a malformed key
+var ErrInvalidKeyEncoding = errors.New("invalid key encoding")
+
+// versions identifying the encoding of each type of key
+const (
+	keyMPEncodingVersion byte = 1
+	key2PEncodingVersion byte = 2
+
+	// verifiable keys append the proof correction word
+	// (other keys keep the previous encoding)
+	key2PVerifiableEncodingVersion byte = 3
+
+	// payload keys append the proof correction word and the final payload
+	key2PPayloadEncodingVersion byte = 4
+
+	prfKeyEncodingVersion byte = 5
+
+	// fixed-width encodings of the keys
+	key2PFixedEncodingVersion           byte = 6
+	key2PVerifiableFixedEncodingVersion byte = 7
+	key2PPayloadFixedEncodingVersion    byte = 8
+	keyMPFixedEncodingVersion           byte = 9
+)
+
+// key2PFixedVersionOffset is the difference between the fixed-width and the
+// variable-width version of each encoding of Key2P
+const key2PFixedVersionOffset = key2PFixedEncodingVersion - key2PEncodingVersion
+
+// packedSigma holds the seeds of a multi-party key decoded from the packed
+// encoding (version 1) with zero blocks removed.
+// By construction a party holds each seed of a row with probability 1/2 and
+// the other blocks are zero, so about half of Sigma is zero blocks.
+// Row r has a bitmap of its non-zero blocks and the blocks themselves
+// start at block offsets[r] of blocks
+type packedSigma struct {
+	blocksPerRow int
+	bitmaps      []byte // (blocksPerRow+7)/8 bytes per row
+	offsets      []int  // index of the first block of each row
+	blocks       []byte
+}
+
+// MarshalBinary encodes the key. Every block of Sigma is encoded (including the
+// zero blocks) so that all keys with the same parameters have the same length
+func (k *KeyMP) MarshalBinary() ([]byte, error) {
+
+	buf := []byte{keyMPFixedEncodingVersion}
+	buf = binary.AppendUvarint(buf, uint64(k.NumParties))
+
+	buf = binary.AppendUvarint(buf, uint64(len(k.CW)))
+	for _, cw := range k.CW {
+		buf = binary.AppendUvarint(buf, uint64(len(cw)))
+		for _, w := range cw {
+			buf = binary.LittleEndian.AppendUint32(buf, w)
+		}
+	}
+
+	numRows := k.numSigmaRows()
+	blocksPerRow := 0
+	if numRows > 0 {
+		blocksPerRow = len(k.sigmaRow(0)) / aes.BlockSize
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(numRows))
+	buf = binary.AppendUvarint(buf, uint64(blocksPerRow))
+
+	for r := 0; r < numRows; r++ {
+		row := k.sigmaRow(r)
+		if len(row) != blocksPerRow*aes.BlockSize {
+			return nil, errors.New("rows of sigma have different sizes")
+		}
+
+		buf = append(buf, row...)
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a key encoded by MarshalBinary. Sigma of a key in the
+// packed encoding (version 1) is kept compressed and blocks are read from the
+// compressed form when the key is evaluated; call UnpackSigma to restore Sigma
+func (k *KeyMP) UnmarshalBinary(b []byte) error {
+
+	if len(b) == 0 || (b[0] != keyMPEncodingVersion && b[0] != keyMPFixedEncodingVersion) {
+		return ErrInvalidKeyEncoding
+	}
+	version := b[0]
+	b = b[1:]
+
+	readUvarint := func() (int, bool) {
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v > math.MaxInt32 {
+			return 0, false
+		}
+		b = b[n:]
+		return int(v), true
+	}
+
+	numParties, ok := readUvarint()
+	if !ok {
+		return ErrInvalidKeyEncoding
+	}
+
+	numCW, ok := readUvarint()
+	if !ok || numCW > len(b) {
+		return ErrInvalidKeyEncoding
+	}
+
+	cws := make([][]uint32, numCW)
+	for i := range cws {
+		n, ok := readUvarint()
+		if !ok || n > len(b)/4 {
+			return ErrInvalidKeyEncoding
+		}
+		cws[i] = make([]uint32, n)
+		for j := range cws[i] {
+			cws[i][j] = binary.LittleEndian.Uint32(b[4*j:])
+		}
+		b = b[4*n:]
+	}
+
+	numRows, ok1 := readUvarint()
+	blocksPerRow, ok2 := readUvarint()
+
+	if version == keyMPFixedEncodingVersion {
+		rowBytes := blocksPerRow * aes.BlockSize
+		if !ok1 || !ok2 || (numRows > 0 && (rowBytes == 0 || numRows != len(b)/rowBytes)) || numRows*rowBytes != len(b) {
+			return ErrInvalidKeyEncoding
+		}
+
+		sigma := make([][]byte, numRows)
+		for r := range sigma {
+			sigma[r] = append([]byte{}, b[r*rowBytes:(r+1)*rowBytes]...)
+		}
+
+		k.NumParties = uint(numParties)
+		k.CW = cws
+		k.Sigma = sigma
+		k.packed = nil
+
+		return nil
+	}
+
+	bitmapBytes := (blocksPerRow + 7) / 8
+	if !ok1 || !ok2 || (numRows > 0 && blocksPerRow == 0) || numRows*bitmapBytes > len(b) {
+		return ErrInvalidKeyEncoding
+	}
+
+	packed := &packedSigma{
+		blocksPerRow: blocksPerRow,
+		bitmaps:      make([]byte, 0, numRows*bitmapBytes),
+		offsets:      make([]int, numRows),
+	}
+
+	for r := 0; r < numRows; r++ {
+		if len(b) < bitmapBytes {
+			return ErrInvalidKeyEncoding
+		}
+		bitmap := b[:bitmapBytes]
+
+		count := 0
+		for i, x := range bitmap {
+			// bits past the end of the row must be unset
+			if i == bitmapBytes-1 && blocksPerRow%8 != 0 && x>>(blocksPerRow%8) != 0 {
+				return ErrInvalidKeyEncoding
+			}
+			count += bits.OnesCount8(x)
+		}
+
+		if len(b)-bitmapBytes < count*aes.BlockSize {
+			return ErrInvalidKeyEncoding
+		}
+
+		packed.bitmaps = append(packed.bitmaps, bitmap...)
+		packed.offsets[r] = len(packed.blocks) / aes.BlockSize
+		packed.blocks = append(packed.blocks, b[bitmapBytes:bitmapBytes+count*aes.BlockSize]...)
+		b = b[bitmapBytes+count*aes.BlockSize:]
+	}
+
+	if len(b) != 0 {
+		return ErrInvalidKeyEncoding
+	}
+
+	k.NumParties = uint(numParties)
+	k.CW = cws
+	k.Sigma = nil
+	k.packed = packed
+
+	return nil
+}
+
+// sigmaShape returns the number of rows of Sigma (packed or not) and the number
+// of blocks in each row. The number of blocks is zero if the rows differ in length
+func (k *KeyMP) sigmaShape() (uint, uint) {
+
+	if k.packed != nil {
+		return uint(len(k.packed.offsets)), uint(k.packed.blocksPerRow)
+	}
+
+	if len(k.Sigma) == 0 {
+		return 0, 0
+	}
+
+	rowBytes := len(k.Sigma[0])
+	for _, row := range k.Sigma {
+		if len(row) != rowBytes || len(row)%aes.BlockSize != 0 {
+			return uint(len(k.Sigma)), 0
+		}
+	}
+
+	return uint(len(k.Sigma)), uint(rowBytes / aes.BlockSize)
+}
+
+// UnpackSigma restores Sigma of a key decoded by UnmarshalBinary
+func (k *KeyMP) UnpackSigma() {
+
+	if k.packed == nil {
+		return
+	}
+
+	numRows := k.numSigmaRows()
+	sigma := make([][]byte, numRows)
+	for r := range sigma {
+		sigma[r] = k.sigmaRow(r)
+	}
+
+	k.Sigma = sigma
+	k.packed = nil
+}
+
+// MarshalBinary encodes the key. Nil byte slices are distinguished from empty
+// ones since they select how the key is evaluated (see Evaluate2PBits)
+func (k *Key2P) MarshalBinary() ([]byte, error) {
+
+	version := key2PFixedEncodingVersion
+	if k.FinalPayload != nil {
+		version = key2PPayloadFixedEncodingVersion
+	} else if k.CS != nil {
+		version = key2PVerifiableFixedEncodingVersion
+	}
+
+	buf := []byte{version}
+	buf = appendNullableBytes(buf, k.SInit)
+	buf = append(buf, k.TInit)
+
+	buf = binary.AppendUvarint(buf, uint64(len(k.CW)))
+	for _, cw := range k.CW {
+		buf = appendNullableBytes(buf, cw)
+	}
+
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(int64(k.FinalCW)))
+	buf = binary.AppendUvarint(buf, uint64(k.Gamma))
+	buf = appendNullableBytes(buf, k.FinalBits)
+	buf = appendNullableBytes(buf, k.Seed)
+	buf = appendNullableBytes(buf, k.Bits)
+
+	if version != key2PFixedEncodingVersion {
+		buf = appendNullableBytes(buf, k.CS)
+	}
+
+	if version == key2PPayloadFixedEncodingVersion {
+		buf = appendNullableBytes(buf, k.FinalPayload)
+	}
+
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a key encoded by MarshalBinary
+func (k *Key2P) UnmarshalBinary(b []byte) error {
+
+	if len(b) == 0 {
+		return ErrInvalidKeyEncoding
+	}
+
+	// the fixed-width versions only differ in the encoding of FinalCW
+	version, fixed := b[0], false
+	if version >= key2PFixedEncodingVersion && version <= key2PPayloadFixedEncodingVersion {
+		version, fixed = version-key2PFixedVersionOffset, true
+	}
+	if version < key2PEncodingVersion || version > key2PPayloadEncodingVersion {
+		return ErrInvalidKeyEncoding
+	}
+	r := &keyReader{buf: b[1:], ok: true}
+
+	res := &Key2P{}
+	res.SInit = r.readNullableBytes()
+	res.TInit = r.readByte()
+
+	numCW := r.readUvarint()
+	if numCW > uint64(len(r.buf)) {
+		return ErrInvalidKeyEncoding
+	}
+	res.CW = make([][]byte, numCW)
+	for i := range res.CW {
+		res.CW[i] = r.readNullableBytes()
+	}
+
+	if fixed {
+		if len(r.buf) < 8 {
+			return ErrInvalidKeyEncoding
+		}
+		res.FinalCW = int(int64(binary.LittleEndian.Uint64(r.buf)))
+		r.buf = r.buf[8:]
+	} else {
+		finalCW, n := binary.Varint(r.buf)
+		if n <= 0 {
+			return ErrInvalidKeyEncoding
+		}
+		r.buf = r.buf[n:]
+		res.FinalCW = int(finalCW)
+	}
+
+	gamma := r.readUvarint()
+	if gamma > math.MaxInt32 {
+		return ErrInvalidKeyEncoding
+	}
+	res.Gamma = uint(gamma)
+
+	res.FinalBits = r.readNullableBytes()
+	res.Seed = r.readNullableBytes()
+	res.Bits = r.readNullableBytes()
+
+	if version != key2PEncodingVersion {
+		if res.CS = r.readNullableBytes(); res.CS == nil {
+			return ErrInvalidKeyEncoding
+		}
+	}
+
+	if version == key2PPayloadEncodingVersion {
+		if res.FinalPayload = r.readNullableBytes(); res.FinalPayload == nil {
+			return ErrInvalidKeyEncoding
+		}
+	}
+
+	if !r.ok || len(r.buf) != 0 {
+		return ErrInvalidKeyEncoding
+	}
+
+	*k = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the PRF key
+func (k *PrfKey) MarshalBinary() ([]byte, error) {
+
+	buf := []byte{prfKeyEncodingVersion}
+	buf = binary.AppendUvarint(buf, uint64(len(k.Bytes)))
+
+	return append(buf, k.Bytes...), nil
+}
+
+// UnmarshalBinary decodes a PRF key encoded by MarshalBinary
+func (k *PrfKey) UnmarshalBinary(b []byte) error {
+
+	if len(b) == 0 || b[0] != prfKeyEncodingVersion {
+		return ErrInvalidKeyEncoding
+	}
+	r := &keyReader{buf: b[1:], ok: true}
+
+	n := r.readUvarint()
+	if !r.ok || n != uint64(len(r.buf)) {
+		return ErrInvalidKeyEncoding
+	}
+
+	k.Bytes = append([]byte{}, r.buf...)
+
+	return nil
+}
+
+// MarshalText encodes the key as the base64 encoding of MarshalBinary
+func (k *PrfKey) MarshalText() ([]byte, error) {
+	return marshalText(k.MarshalBinary())
+}
+
+// UnmarshalText decodes a key encoded by MarshalText
+func (k *PrfKey) UnmarshalText(text []byte) error {
+	return unmarshalText(text, k.UnmarshalBinary)
+}
+
+// MarshalText encodes the key as the base64 encoding of MarshalBinary
+func (k *Key2P) MarshalText() ([]byte, error) {
+	return marshalText(k.MarshalBinary())
+}
+
+// UnmarshalText decodes a key encoded by MarshalText
+func (k *Key2P) UnmarshalText(text []byte) error {
+	return unmarshalText(text, k.UnmarshalBinary)
+}
+
+// MarshalText encodes the key as the base64 encoding of MarshalBinary
+// (Sigma of a decoded key is encoded even if it was not unpacked)
+func (k *KeyMP) MarshalText() ([]byte, error) {
+	return marshalText(k.MarshalBinary())
+}
+
+// UnmarshalText decodes a key encoded by MarshalText
+func (k *KeyMP) UnmarshalText(text []byte) error {
+	return unmarshalText(text, k.UnmarshalBinary)
+}
+
+func marshalText(b []byte, err error) ([]byte, error) {
+
+	if err != nil {
+		return nil, err
+	}
+
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
+	base64.StdEncoding.Encode(text, b)
+
+	return text, nil
+}
+
+func unmarshalText(text []byte, unmarshal func([]byte) error) error {
+
+	b := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(b, text)
+	if err != nil {
+		return ErrInvalidKeyEncoding
+	}
+
+	return unmarshal(b[:n])
+}
+
+// appendNullableBytes appends a presence flag followed by the length prefixed bytes
+func appendNullableBytes(buf, b []byte) []byte {
+
+	if b == nil {
+		return append(buf, 0)
+	}
+
+	buf = append(buf, 1)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+
+	return append(buf, b...)
+}
+
+// keyReader reads the fields of an encoded key; ok is false after the first error
+type keyReader struct {
+	buf []byte
+	ok  bool
+}
+
+func (r *keyReader) readByte() byte {
+	if len(r.buf) == 0 {
+		r.buf, r.ok = nil, false
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *keyReader) readUvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.buf, r.ok = nil, false
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *keyReader) readNullableBytes() []byte {
+
+	switch r.readByte() {
+	case 0:
+		return nil
+	case 1:
+	default:
+		r.buf, r.ok = nil, false
+		return nil
+	}
+
+	n := r.readUvarint()
+	if n > uint64(len(r.buf)) {
+		r.buf, r.ok = nil, false
+		return nil
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buf)
+	r.buf = r.buf[n:]
+
+	return b
+}
+
+// sigmaBlock returns block i of row r of Sigma or nil if the block is zero
+func (k *KeyMP) sigmaBlock(r, i uint) []byte {
+
+	if k.packed == nil {
+		block := k.Sigma[r][i*aes.BlockSize : (i+1)*aes.BlockSize]
+		if isZeroBlock(block) {
+			return nil
+		}
+		return block
+	}
+
+	p := k.packed
+	bitmapBytes := uint(p.blocksPerRow+7) / 8
+	bitmap := p.bitmaps[r*bitmapBytes : (r+1)*bitmapBytes]
+
+	if bitmap[i/8]&(1<<(i%8)) == 0 {
+		return nil
+	}
+
+	// rank of the block among the non-zero blocks of the row
+	rank := bits.OnesCount8(bitmap[i/8] & (1<<(i%8) - 1))
+	for j := uint(0); j < i/8; j++ {
+		rank += bits.OnesCount8(bitmap[j])
+	}
+
+	start := (p.offsets[r] + rank) * aes.BlockSize
+	return p.blocks[start : start+aes.BlockSize]
+}
+
+func (k *KeyMP) numSigmaRows() int {
+	if k.packed != nil {
+		return len(k.packed.offsets)
+	}
+	return len(k.Sigma)
+}
+
+// sigmaRow returns row r of Sigma (decompressed if needed)
+func (k *KeyMP) sigmaRow(r int) []byte {
+
+	if k.packed == nil {
+		return k.Sigma[r]
+	}
+
+	row := make([]byte, k.packed.blocksPerRow*aes.BlockSize)
+	for i := 0; i < k.packed.blocksPerRow; i++ {
+		if block := k.sigmaBlock(uint(r), uint(i)); block != nil {
+			copy(row[i*aes.BlockSize:], block)
+		}
+	}
+
+	return row
+}
+
+func isZeroBlock(block []byte) bool {
+	for _, b := range block {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package dpf
+
+// This file contains the full-domain evaluation of the keys.
+// Evaluating a two-party key on a single point walks the tree from the
+// root to the leaf of the point, so evaluating every point expands each
+// node once per leaf below it. The functions below walk the tree once
+// (depth first, in increasing order of the points) for a range of points
+// and expand each node of the range once, and expand each PRG block of
+// the leaves (or of the multi-party seeds) once for all the points it covers.
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+)
+
+// EvalFull2PBit evaluates Evaluate2PBit on the points lo, ..., lo+len(out)-1
+// and writes the output bits to out (the full domain for lo = 0 and len(out) = 2^NumBits).
+// The output bits are the same for both server numbers (see Evaluate2PBit)
+func (f *Dpf) EvalFull2PBit(k *Key2P, lo uint, out []byte) {
+
+	w := newTreeWalker(f, k, f.NumBits)
+	w.walk(0, 0, k.SInit, k.TInit, uint64(lo), uint64(lo)+uint64(len(out)), func(x uint64, s []byte, t byte) {
+		sFinal, _ := binary.Varint(s[:8])
+		out[x-uint64(lo)] = uint8((uint64(sFinal) + uint64(t)*uint64(k.FinalCW)) & 1)
+	})
+}
+
+// EvalFull2PBits evaluates Evaluate2PBits on the points lo, ..., lo+len(out)-1
+// and writes the output bits to out (the full domain for lo = 0 and len(out) = 2^NumBits)
+func (f *Dpf) EvalFull2PBits(k *Key2P, lo uint, out []byte) {
+
+	if k.Bits != nil {
+		for i := range out {
+			x := lo + uint(i)
+			out[i] = (k.Bits[x/8] >> (x % 8)) & 1
+		}
+		return
+	}
+
+	in := make([]byte, aes.BlockSize)
+	blk := make([]byte, aes.BlockSize)
+	const bitsPerBlock = aes.BlockSize * 8
+
+	if k.Seed != nil {
+		for i := range out {
+			x := lo + uint(i)
+			if i == 0 || x%bitsPerBlock == 0 {
+				prgBlock(k.Seed, f.FixedBlocks, x/bitsPerBlock, in, blk)
+			}
+			out[i] = (blk[(x/8)%aes.BlockSize] >> (x % 8)) & 1
+		}
+		return
+	}
+
+	start, end := uint64(lo), uint64(lo)+uint64(len(out))
+	leafBits := uint64(1) << k.Gamma
+
+	// each leaf of the tree holds the output bits of 2^Gamma points
+	w := newTreeWalker(f, k, f.NumBits-k.Gamma)
+	w.walk(0, 0, k.SInit, k.TInit, start>>k.Gamma, (end+leafBits-1)>>k.Gamma, func(leaf uint64, s []byte, t byte) {
+		base := leaf << k.Gamma
+
+		first, last := uint64(0), leafBits
+		if start > base {
+			first = start - base
+		}
+		if end-base < last {
+			last = end - base
+		}
+
+		for low := first; low < last; low++ {
+			if low == first || low%bitsPerBlock == 0 {
+				prgBlock(s, f.FixedBlocks, uint(low/bitsPerBlock), in, blk)
+			}
+			b := blk[(low/8)%aes.BlockSize] ^ (t * k.FinalBits[low/8])
+			out[base+low-start] = (b >> (low % 8)) & 1
+		}
+	})
+}
+
+// EvalFullMP evaluates EvaluateMP on the points lo, ..., lo+len(out)-1
+// and writes the outputs to out (the full domain for lo = 0 and len(out) = 2^NumBits)
+func (f *Dpf) EvalFullMP(k *KeyMP, lo uint, out []uint32) {
+
+	p2, mu, _ := multiPartyParams(f.NumBits, k.NumParties)
+
+	wordsPerBlock := uint(aes.BlockSize) / f.M
+	in := make([]byte, aes.BlockSize)
+	blk := make([]byte, aes.BlockSize)
+
+	for i := range out {
+		out[i] = 0
+	}
+
+	end := lo + uint(len(out))
+
+	// the points of each row of the grid share the seeds of the row
+	for x := lo; x < end; {
+		gamma := x / mu
+		first := x % mu
+		last := mu
+		if (gamma+1)*mu > end {
+			last = end - gamma*mu
+		}
+
+		for i := uint(0); i < p2; i++ {
+			// zero blocks are seeds not held by the party
+			s := k.sigmaBlock(gamma, i)
+			if s == nil {
+				continue
+			}
+
+			for delta := first; delta < last; delta++ {
+				if delta == first || delta%wordsPerBlock == 0 {
+					prgBlock(s, f.FixedBlocks, delta/wordsPerBlock, in, blk)
+				}
+				offset := (delta % wordsPerBlock) * f.M
+				out[gamma*mu+delta-lo] ^= binary.LittleEndian.Uint32(blk[offset:offset+f.M]) ^ k.CW[i][delta]
+			}
+		}
+
+		x = gamma*mu + last
+	}
+}
+
+// treeWalker walks the tree of a two-party key depth first
+type treeWalker struct {
+	f     *Dpf
+	k     *Key2P
+	depth uint
+	temp  []byte
+	outs  [][]byte // expansion of the node at each level
+}
+
+func newTreeWalker(f *Dpf, k *Key2P, depth uint) *treeWalker {
+
+	w := &treeWalker{f: f, k: k, depth: depth, temp: make([]byte, aes.BlockSize)}
+
+	w.outs = make([][]byte, depth)
+	for i := range w.outs {
+		w.outs[i] = make([]byte, aes.BlockSize*initPRFLen)
+	}
+
+	return w
+}
+
+// walk calls leaf with the seed and t bit of each leaf in [lo, hi) below the node
+// at the level with the prefix (the leaves are visited in increasing order)
+func (w *treeWalker) walk(level uint, prefix uint64, s []byte, t byte, lo, hi uint64, leaf func(x uint64, s []byte, t byte)) {
+
+	// leaves below the node are [first, first+2^rem)
+	rem := w.depth - level
+	if rem < 64 {
+		first := prefix << rem
+		if first >= hi || first+(uint64(1)<<rem) <= lo {
+			return
+		}
+	}
+
+	if level == w.depth {
+		leaf(prefix, s, t)
+		return
+	}
+
+	// expand the seed into two seeds and two t bits and apply the correction
+	// word (see evaluateTree2P)
+	out := w.outs[level]
+	cw := w.k.CW[level]
+	prf(s, w.f.FixedBlocks, 3, w.temp, out)
+
+	for j := 0; j < aes.BlockSize; j++ {
+		out[j] ^= t * cw[j]
+		out[aes.BlockSize+1+j] ^= t * cw[j]
+	}
+	out[aes.BlockSize] ^= t * cw[aes.BlockSize]
+	out[aes.BlockSize*2+1] ^= t * cw[aes.BlockSize+1]
+
+	w.walk(level+1, prefix<<1, out[:aes.BlockSize], out[aes.BlockSize]%2, lo, hi, leaf)
+	w.walk(level+1, prefix<<1|1, out[aes.BlockSize+1:aes.BlockSize*2+1], out[aes.BlockSize*2+1]%2, lo, hi, leaf)
+}
@@ -0,0 +1,3 @@
+module github.com/sachaservan/pir/dpf
+
+go 1.19
@@ -0,0 +1,84 @@
+package dpf
+
+// This file contains two-party keys with payloads (for private writes).
+// Bit keys output a single bit per point. A payload key outputs a string
+// of len(FinalPayload) bytes per point: the seed of each leaf is expanded
+// into that many bytes and corrected with FinalPayload when the t bit of
+// the leaf is set. FinalPayload is the xor of the expansions of both seeds
+// at the special point and of the payload, so the outputs of the two keys
+// xor to the payload at the special point and to zero everywhere else
+// (the construction of Boyle, Gilboa and Ishai with outputs in GF(2)^k).
+// Payload keys carry a proof correction word (see verifiable.go) so that
+// the servers can check that the outputs of a pair of keys differ on at
+// most one point, i.e., that a key writes to at most one point.
+
+import "crypto/aes"
+
+// GenerateTwoServerPayload generates full-depth keys whose outputs xor to payload
+// when input x = a and to zero otherwise, along with a proof correction word
+// (see EvalFull2PPayloadProof)
+func (f *Dpf) GenerateTwoServerPayload(a uint, payload []byte) []*Key2P {
+
+	fssKeys, s0, s1, t1 := f.generateTree2P(a, f.NumBits)
+
+	final := make([]byte, len(payload))
+	expanded := make([]byte, len(payload))
+
+	f.expandPayload(s0, final)
+	f.expandPayload(s1, expanded)
+	xorBytes(final, expanded)
+	xorBytes(final, payload)
+
+	cs := proofCorrection(uint64(a), s0, t1^1, s1, t1)
+
+	for _, k := range fssKeys {
+		k.FinalPayload = final
+		k.CS = cs
+	}
+
+	return fssKeys
+}
+
+// EvalFull2PPayloadProof evaluates a payload key on the points lo, ..., lo+len(out)-1,
+// writes the output of point lo+i to out[i] (of len(k.FinalPayload) bytes) and returns
+// the proof of the evaluation (see VerifyProofs). Returns ErrNotVerifiable if the key
+// is not a payload key
+func (f *Dpf) EvalFull2PPayloadProof(k *Key2P, lo uint, out [][]byte) ([]byte, error) {
+
+	if !validProofCorrection(k.CS) || k.FinalPayload == nil || k.Gamma != 0 || uint(len(k.CW)) != f.NumBits {
+		return nil, ErrNotVerifiable
+	}
+
+	for _, o := range out {
+		if len(o) != len(k.FinalPayload) {
+			return nil, ErrNotVerifiable
+		}
+	}
+
+	proof := newLeafProof(k.CS, k.FinalPayload)
+	start := uint64(lo)
+
+	w := newTreeWalker(f, k, f.NumBits)
+	w.walk(0, 0, k.SInit, k.TInit, start, start+uint64(len(out)), func(x uint64, s []byte, t byte) {
+		o := out[x-start]
+		f.expandPayload(s, o)
+		if t == 1 {
+			xorBytes(o, k.FinalPayload)
+		}
+		proof.add(x, s, t)
+	})
+
+	return proof.sum(), nil
+}
+
+// expandPayload expands the seed into len(out) bytes
+func (f *Dpf) expandPayload(s []byte, out []byte) {
+
+	in := make([]byte, aes.BlockSize)
+	blk := make([]byte, aes.BlockSize)
+
+	for j := 0; j < len(out); j += aes.BlockSize {
+		prgBlock(s, f.FixedBlocks, uint(j/aes.BlockSize), in, blk)
+		copy(out[j:], blk)
+	}
+}
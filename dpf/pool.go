@@ -0,0 +1,32 @@
+package dpf
+
+import (
+	"crypto/aes"
+	"sync"
+)
+
+// evalScratch is the scratch memory used by a single evaluation
+type evalScratch struct {
+	out  []byte
+	temp []byte
+	seed []byte
+	in   []byte
+	blk  []byte
+}
+
+// scratchPool holds the scratch of evaluations so that each goroutine evaluating
+// a Dpf gets its own. It is the only state reused across queries: server Dpfs are
+// not cached since ClientInitialize draws fresh PRF keys for every query (a cache
+// keyed by PRF keys would never hit). A Dpf returned by ServerInitialize only
+// reads its fields when evaluated, so it can be evaluated concurrently
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		return &evalScratch{
+			out:  make([]byte, aes.BlockSize*initPRFLen),
+			temp: make([]byte, aes.BlockSize),
+			seed: make([]byte, aes.BlockSize),
+			in:   make([]byte, aes.BlockSize),
+			blk:  make([]byte, aes.BlockSize),
+		}
+	},
+}
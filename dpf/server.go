@@ -7,12 +7,12 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/binary"
-	"math"
 )
 
 // Upon receiving query from client, initialize server with
 // this function. The server, unlike the client
-// receives prfKeys, so it doesn't need to pick random ones
+// receives prfKeys, so it doesn't need to pick random ones.
+// The returned Dpf can be evaluated concurrently
 func ServerInitialize(prfKeys []*PrfKey, numBits uint) *Dpf {
 	f := new(Dpf)
 	f.NumBits = numBits
@@ -51,15 +51,78 @@ func ServerInitialize(prfKeys []*PrfKey, numBits uint) *Dpf {
 
 // Each of the 2 server calls this function to evaluate their function
 // share on a value. Then, the client adds the results from both servers.
+// Callers that only need the parity of the output should use Evaluate2PBit
 
 func (f *Dpf) Evaluate2P(serverNum uint, k *Key2P, x uint) int {
-	fOut := make([]byte, aes.BlockSize*initPRFLen)
-	fTemp := make([]byte, aes.BlockSize)
+	sc := scratchPool.Get().(*evalScratch)
+	defer scratchPool.Put(sc)
 
-	sCurr := make([]byte, aes.BlockSize)
+	sCurr, tCurr := f.evaluateTree2P(k, x, f.NumBits, sc)
+
+	sFinal, _ := binary.Varint(sCurr[:8])
+	if serverNum == 0 {
+		return int(sFinal) + int(tCurr)*k.FinalCW
+	} else {
+		return -1 * (int(sFinal) + int(tCurr)*k.FinalCW)
+	}
+}
+
+// Evaluate2PBit returns the parity of Evaluate2P using integer operations only.
+// For a key with output value 1 the parities of both servers XOR to 1 on the
+// special point and to 0 everywhere else (negation does not change the parity,
+// so the result is the same for both server numbers)
+
+func (f *Dpf) Evaluate2PBit(serverNum uint, k *Key2P, x uint) uint8 {
+	sc := scratchPool.Get().(*evalScratch)
+	defer scratchPool.Put(sc)
+
+	sCurr, tCurr := f.evaluateTree2P(k, x, f.NumBits, sc)
+
+	sFinal, _ := binary.Varint(sCurr[:8])
+
+	// two's complement parity is correct for negative values (and on overflow)
+	return uint8((uint64(sFinal) + uint64(tCurr)*uint64(k.FinalCW)) & 1)
+}
+
+// Evaluate2PBits evaluates a key generated by GenerateTwoServerBits
+// (or GenerateTwoServerAsymmetric) on x and returns the output bit share;
+// the output bits of both servers XOR to 1 on the special point and to 0 everywhere else.
+
+func (f *Dpf) Evaluate2PBits(k *Key2P, x uint) byte {
+	if k.Bits != nil {
+		return (k.Bits[x/8] >> (x % 8)) & 1
+	}
+
+	sc := scratchPool.Get().(*evalScratch)
+	defer scratchPool.Put(sc)
+
+	if k.Seed != nil {
+		// only the PRG block containing the output bit is needed
+		prgBlock(k.Seed, f.FixedBlocks, x/(aes.BlockSize*8), sc.in, sc.blk)
+		return (sc.blk[(x/8)%aes.BlockSize] >> (x % 8)) & 1
+	}
+
+	sCurr, tCurr := f.evaluateTree2P(k, x, f.NumBits-k.Gamma, sc)
+
+	// only the PRG block containing the output bit is needed
+	low := x & ((uint(1) << k.Gamma) - 1)
+	out := sc.blk
+	prgBlock(sCurr, f.FixedBlocks, low/(aes.BlockSize*8), sc.in, out)
+
+	b := out[(low/8)%aes.BlockSize] ^ (tCurr * k.FinalBits[low/8])
+	return (b >> (low % 8)) & 1
+}
+
+// evaluateTree2P walks the first depth levels of the tree along the path of x
+// and returns the resulting seed (backed by the scratch memory) and t bit
+func (f *Dpf) evaluateTree2P(k *Key2P, x uint, depth uint, sc *evalScratch) ([]byte, byte) {
+	fOut := sc.out
+	fTemp := sc.temp
+
+	sCurr := sc.seed
 	copy(sCurr, k.SInit)
 	tCurr := k.TInit
-	for i := uint(0); i < f.NumBits; i++ {
+	for i := uint(0); i < depth; i++ {
 		var xBit byte = 0
 		if i != f.N {
 			xBit = byte(getBit(x, (f.N - f.NumBits + i + 1), f.N))
@@ -92,12 +155,7 @@ func (f *Dpf) Evaluate2P(serverNum uint, k *Key2P, x uint) int {
 		}
 		//fmt.Println(f.Out)
 	}
-	sFinal, _ := binary.Varint(sCurr[:8])
-	if serverNum == 0 {
-		return int(sFinal) + int(tCurr)*k.FinalCW
-	} else {
-		return -1 * (int(sFinal) + int(tCurr)*k.FinalCW)
-	}
+	return sCurr, tCurr
 }
 
 // This function is for multi-party (3 or more parties) FSS
@@ -109,36 +167,28 @@ func (f *Dpf) Evaluate2P(serverNum uint, k *Key2P, x uint) int {
 
 func (f *Dpf) EvaluateMP(k *KeyMP, x uint) uint32 {
 
-	p2 := uint(math.Pow(2, float64(k.NumParties-1)))
-	mu := uint(math.Ceil(math.Pow(2, float64(f.NumBits)/2) * math.Pow(2, float64(k.NumParties-1)/2)))
-	numBits := f.NumBits
+	p2, mu, _ := multiPartyParams(f.NumBits, k.NumParties)
 
-	delta := x & ((1 << (numBits / 2)) - 1)
-	gamma := (x & (((1 << (numBits + 1) / 2) - 1) << numBits / 2)) >> numBits / 2
-	mBytes := f.M * mu
+	delta := x % mu
+	gamma := x / mu
 
-	y := make([]uint32, mu)
-	for i := uint(0); i < p2; i++ {
-		s := k.Sigma[gamma][i*aes.BlockSize : i*aes.BlockSize+aes.BlockSize]
-		all_zero_bytes := true
-		for j := uint(0); j < aes.BlockSize; j++ {
-			if s[j] != 0 {
-				all_zero_bytes = false
-				break
-			}
-		}
+	// only the PRG block containing entry delta is needed
+	wordsPerBlock := uint(aes.BlockSize) / f.M
+	offset := (delta % wordsPerBlock) * f.M
 
-		if !all_zero_bytes {
-			numBlocks := uint(math.Ceil(float64(mBytes) / float64(aes.BlockSize)))
-			prf(s, f.FixedBlocks, numBlocks, f.Temp, f.Out)
-			for k := uint(0); k < mu; k++ {
-				tempInt := binary.LittleEndian.Uint32(f.Out[f.M*k : f.M*k+f.M])
-				y[k] = y[k] ^ tempInt
-			}
-			for j := uint(0); j < mu; j++ {
-				y[j] = k.CW[i][j] ^ y[j]
-			}
+	// goroutine-local scratch so that evaluation can run concurrently
+	sc := scratchPool.Get().(*evalScratch)
+	defer scratchPool.Put(sc)
+	in, out := sc.in, sc.blk
+
+	var y uint32
+	for i := uint(0); i < p2; i++ {
+		// zero blocks are seeds not held by the party
+		if s := k.sigmaBlock(gamma, i); s != nil {
+			prgBlock(s, f.FixedBlocks, delta/wordsPerBlock, in, out)
+			y ^= binary.LittleEndian.Uint32(out[offset:offset+f.M]) ^ k.CW[i][delta]
 		}
 	}
-	return y[delta]
+
+	return y
 }
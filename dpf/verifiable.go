@@ -0,0 +1,208 @@
+package dpf
+
+// This file contains verifiable two-party keys (VDPF).
+// A malicious client can send keys that do not encode a point function
+// (e.g. keys that select several rows of a database). Two keys encode a
+// point function if their seeds and t bits agree on every leaf but one.
+// Each server hashes the seed and the t bit of every leaf of the domain
+// and corrects the hash with the proof correction word CS when its t bit
+// is set; CS is the xor of the hashes of both keys at the special point,
+// so the corrected hashes of honest keys agree on every leaf. Hashing the
+// t bit binds it to the leaf: keys whose seeds agree on a leaf but whose
+// t bits differ (and thus whose outputs differ) would need CS to match
+// the hashes of that leaf, which a single CS cannot do for several leaves.
+// The servers fold the corrected hash of every leaf x into a short proof,
+// pi <- pi xor H'(pi xor (H(x || s || t) xor t*CS)), starting from the hash
+// of the final correction words, and exchange the proofs:
+// matching proofs show that the outputs differ on at most one point,
+// without revealing the point.
+// This follows de Castro and Polychroniadou, "Lightweight, Maliciously
+// Secure Verifiable Function Secret Sharing" (EUROCRYPT 2022).
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// ErrNotVerifiable is returned when evaluating a key without a proof correction word
+// (see GenerateTwoServerVerifiable) with a proof
+var ErrNotVerifiable = errors.New("key is not verifiable")
+
+// leafHashDomain and proofHashDomain separate the leaf hashes (H) and the
+// proof hashes (H') from each other and from other uses of the hash function
+const (
+	leafHashDomain  = "dpf-vdpf-leaf-v2"
+	proofHashDomain = "dpf-vdpf-proof-v2"
+)
+
+// GenerateTwoServerVerifiable generates full-depth keys with a single output bit
+// (see GenerateTwoServerBits with gamma = 0) along with a proof correction word
+// so that the servers can check that the keys encode a point function
+// (see EvalFull2PBitsProof and VerifyProofs)
+func (f *Dpf) GenerateTwoServerVerifiable(a uint) []*Key2P {
+
+	fssKeys, s0, s1, t1 := f.generateTwoServerBits(a, 0)
+
+	cs := proofCorrection(uint64(a), s0, t1^1, s1, t1)
+
+	for _, k := range fssKeys {
+		k.CS = cs
+	}
+
+	return fssKeys
+}
+
+// EvalFull2PBitsProof evaluates a verifiable key on the points lo, ..., lo+len(out)-1
+// (see EvalFull2PBits) and returns the proof of the evaluation. The keys encode a
+// point function on the points if both servers evaluate the same points and obtain
+// the same proof (see VerifyProofs). Returns ErrNotVerifiable if the key has no proof
+// correction word
+func (f *Dpf) EvalFull2PBitsProof(k *Key2P, lo uint, out []byte) ([]byte, error) {
+
+	if !validProofCorrection(k.CS) || k.Gamma != 0 || len(k.FinalBits) == 0 {
+		return nil, ErrNotVerifiable
+	}
+
+	proof := newLeafProof(k.CS, k.FinalBits)
+
+	in := make([]byte, aes.BlockSize)
+	blk := make([]byte, aes.BlockSize)
+
+	start := uint64(lo)
+
+	w := newTreeWalker(f, k, f.NumBits)
+	w.walk(0, 0, k.SInit, k.TInit, start, start+uint64(len(out)), func(x uint64, s []byte, t byte) {
+		// the output bit of the leaf (see EvalFull2PBits)
+		prgBlock(s, f.FixedBlocks, 0, in, blk)
+		out[x-start] = (blk[0] ^ (t * k.FinalBits[0])) & 1
+		proof.add(x, s, t)
+	})
+
+	return proof.sum(), nil
+}
+
+// VerifyProofs returns true if the proofs computed by both servers (see EvalFull2PBitsProof)
+// match, i.e., if the keys encode a point function on the points evaluated
+func VerifyProofs(proof0, proof1 []byte) bool {
+	return len(proof0) == sha256.Size && subtle.ConstantTimeCompare(proof0, proof1) == 1
+}
+
+// proofCorrection returns the proof correction word of keys whose leaves at the
+// special point x have seeds s0, s1 and t bits t0, t1
+func proofCorrection(x uint64, s0 []byte, t0 byte, s1 []byte, t1 byte) []byte {
+
+	h := newLeafHasher()
+	cs := make([]byte, sha256.Size)
+	copy(cs, h.hash(x, s0, t0))
+	xorBytes(cs, h.hash(x, s1, t1))
+
+	return cs
+}
+
+// validProofCorrection returns true if cs can be the proof correction word of a
+// verifiable key. An all-zero CS never corrects the hash of a leaf, which lets
+// keys differ on leaves whose corrected hashes agree
+func validProofCorrection(cs []byte) bool {
+
+	if len(cs) != sha256.Size {
+		return false
+	}
+
+	var acc byte
+	for _, b := range cs {
+		acc |= b
+	}
+
+	return acc != 0
+}
+
+// leafHasher hashes the seeds and t bits of the leaves
+type leafHasher struct {
+	h   hash.Hash
+	buf []byte
+	sum []byte
+}
+
+func newLeafHasher() *leafHasher {
+	return &leafHasher{
+		h:   sha256.New(),
+		buf: make([]byte, 9),
+		sum: make([]byte, 0, sha256.Size),
+	}
+}
+
+// hash returns H(x || s || t), the hash of the seed and t bit of leaf x
+// (valid until the next call)
+func (lh *leafHasher) hash(x uint64, s []byte, t byte) []byte {
+	lh.h.Reset()
+	lh.h.Write([]byte(leafHashDomain))
+	binary.BigEndian.PutUint64(lh.buf, x)
+	lh.buf[8] = t
+	lh.h.Write(lh.buf)
+	lh.h.Write(s[:aes.BlockSize])
+	return lh.h.Sum(lh.sum[:0])
+}
+
+// leafProof folds the corrected hashes of the leaves of a key into a proof
+type leafProof struct {
+	lh  *leafHasher
+	h   hash.Hash
+	cs  []byte
+	pi  []byte
+	buf []byte
+}
+
+// newLeafProof starts the proof of a key with proof correction word cs
+// from the hash of the final correction words of the key
+func newLeafProof(cs []byte, final ...[]byte) *leafProof {
+
+	p := &leafProof{
+		lh:  newLeafHasher(),
+		h:   sha256.New(),
+		cs:  cs,
+		buf: make([]byte, sha256.Size),
+	}
+
+	// the final correction words are sent to each server separately
+	// and must match for the outputs to agree
+	p.h.Write([]byte(proofHashDomain))
+	for _, cw := range final {
+		p.h.Write(cw)
+	}
+	p.h.Write(cs)
+	p.pi = p.h.Sum(nil)
+
+	return p
+}
+
+// add folds leaf x with seed s and t bit t into the proof:
+// pi <- pi xor H'(pi xor (H(x || s || t) xor t*CS))
+func (p *leafProof) add(x uint64, s []byte, t byte) {
+
+	copy(p.buf, p.lh.hash(x, s, t))
+	if t == 1 {
+		xorBytes(p.buf, p.cs)
+	}
+	xorBytes(p.buf, p.pi)
+
+	p.h.Reset()
+	p.h.Write([]byte(proofHashDomain))
+	p.h.Write(p.buf)
+	xorBytes(p.pi, p.h.Sum(p.buf[:0]))
+}
+
+// sum returns the proof
+func (p *leafProof) sum() []byte {
+	return append([]byte{}, p.pi...)
+}
+
+// xorBytes sets dst to dst xor src
+func xorBytes(dst, src []byte) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
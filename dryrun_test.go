@@ -0,0 +1,36 @@
+package pir
+
+import (
+	"testing"
+)
+
+// run with 'go test -v -run TestDryRunQuery' to see log outputs.
+func TestDryRunQuery(t *testing.T) {
+	setup()
+
+	defer func(bits int) { DryRunKeyBits = bits }(DryRunKeyBits)
+	DryRunKeyBits = 128
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for _, mode := range []DryRunMode{DryRunSecretShared, DryRunEncrypted, DryRunDoublyEncrypted} {
+		report, err := db.DryRunQuery(mode, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Mode != mode || report.DBSize != TestDBSize || report.NumRows == 0 || report.Total <= 0 {
+			t.Fatalf("Invalid report: %+v\n", report)
+		}
+
+		t.Logf("%+v\n", report)
+	}
+
+	if _, err := db.DryRunQuery(DryRunMode(-1), 1); err == nil {
+		t.Fatalf("Dry run with an unknown mode succeeded")
+	}
+
+	if _, err := NewDatabase().DryRunQuery(DryRunSecretShared, 1); err == nil {
+		t.Fatalf("Dry run on an empty database succeeded")
+	}
+}
@@ -0,0 +1,142 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Dual-mode queries for migrating between secret shared and encrypted PIR.
+ The server answers the same logical request in both modes so that the
+ client can cross-validate the recovered slots.
+*/
+
+// ErrModesDiverge is matched (using errors.Is) by the error returned by
+// VerifyDualMode when the two modes recover different slots.
+// The error is a *DivergenceError with diagnostics
+var ErrModesDiverge = errors.New("secret shared and encrypted results diverge")
+
+// DualModeQuery is the query sent to one server: a share of the secret
+// shared query and (optionally) an encrypted query for the same group
+type DualModeQuery struct {
+	Share     *QueryShare
+	Encrypted *EncryptedQuery
+}
+
+// DualModeResult contains the server's answers in both modes
+type DualModeResult struct {
+	Shared    *SecretSharedQueryResult
+	Encrypted *EncryptedQueryResult
+}
+
+// DivergenceError describes the slots on which the modes diverged
+type DivergenceError struct {
+	Server    int   // server whose encrypted result diverges
+	Positions []int // positions in the group of the diverging slots
+	Shared    []*Slot
+	Encrypted []*Slot
+}
+
+func (e *DivergenceError) Error() string {
+	return fmt.Sprintf("%v: server %v differs on %v of %v slots (positions %v)",
+		ErrModesDiverge, e.Server, len(e.Positions), len(e.Shared), e.Positions)
+}
+
+// Is reports whether target is ErrModesDiverge
+func (e *DivergenceError) Is(target error) bool {
+	return target == ErrModesDiverge
+}
+
+// NewIndexDualModeQueries generates queries for the group at index to be sent to
+// numShares servers. Each server in encryptedServers also receives an encrypted query
+// over a groupSize-wide layout so that both modes retrieve the same group
+func (dbmd *DBMetadata) NewIndexDualModeQueries(
+	pk *paillier.PublicKey,
+	index, groupSize int,
+	numShares uint,
+	encryptedServers ...int) []*DualModeQuery {
+
+	shares := dbmd.NewIndexQueryShares(index, groupSize, numShares)
+	height := ceilDiv(dbmd.DBSize, groupSize)
+
+	queries := make([]*DualModeQuery, numShares)
+	for i := range queries {
+		queries[i] = &DualModeQuery{Share: shares[i]}
+	}
+
+	for _, server := range encryptedServers {
+		queries[server].Encrypted = dbmd.NewEncryptedQueryWithDimentions(pk, groupSize, height, groupSize, index)
+	}
+
+	return queries
+}
+
+// PrivateDualModeQuery answers both modes of the query over the same epoch
+func (db *Database) PrivateDualModeQuery(query *DualModeQuery, nprocs int) (*DualModeResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	shared, err := db.privateSecretSharedQuery(query.Share, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DualModeResult{Shared: shared}
+
+	if query.Encrypted != nil {
+		res.Encrypted, err = db.privateEncryptedQuery(query.Encrypted, nprocs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// VerifyDualMode recovers the slots from the secret shared results and checks
+// them against every encrypted result. Returns a *DivergenceError if they differ.
+// results must be ordered by server
+func VerifyDualMode(results []*DualModeResult, sk *paillier.SecretKey) ([]*Slot, error) {
+
+	shares := make([]*SecretSharedQueryResult, len(results))
+	for i, res := range results {
+		if res == nil || res.Shared == nil {
+			return nil, errors.New("missing secret shared result")
+		}
+		shares[i] = res.Shared
+	}
+
+	slots := Recover(shares)
+
+	for server, res := range results {
+		if res.Encrypted == nil {
+			continue
+		}
+
+		encrypted, err := RecoverEncrypted(res.Encrypted, sk)
+		if err != nil {
+			return nil, err
+		}
+
+		var positions []int
+		for i := range slots {
+			if i >= len(encrypted) || !slots[i].Equal(encrypted[i]) {
+				positions = append(positions, i)
+			}
+		}
+
+		if len(positions) > 0 || len(encrypted) != len(slots) {
+			return nil, &DivergenceError{
+				Server:    server,
+				Positions: positions,
+				Shared:    slots,
+				Encrypted: encrypted,
+			}
+		}
+	}
+
+	return slots, nil
+}
@@ -0,0 +1,64 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+func dualModeRoundTrip(t *testing.T, db *Database, queries []*DualModeQuery) []*DualModeResult {
+
+	results := make([]*DualModeResult, len(queries))
+	for i, q := range queries {
+		res, err := db.PrivateDualModeQuery(q, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results[i] = res
+	}
+
+	return results
+}
+
+// run with 'go test -v -run TestDualModeQuery' to see log outputs.
+func TestDualModeQuery(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+		dimHeight := (TestDBSize + groupSize - 1) / groupSize
+		qIndex := rand.Intn(dimHeight)
+
+		queries := db.NewIndexDualModeQueries(pk, qIndex, groupSize, 2, 0, 1)
+		results := dualModeRoundTrip(t, db, queries)
+
+		slots, err := VerifyDualMode(results, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j := 0; j < groupSize && qIndex*groupSize+j < TestDBSize; j++ {
+			if !db.Slots[qIndex*groupSize+j].Equal(slots[j]) {
+				t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[qIndex*groupSize+j], slots[j])
+			}
+		}
+
+		// encrypted answer computed over a different group
+		other := db.NewIndexDualModeQueries(pk, (qIndex+1)%dimHeight, groupSize, 2, 1)
+		results[1].Encrypted = dualModeRoundTrip(t, db, other)[1].Encrypted
+
+		_, err = VerifyDualMode(results, sk)
+		if !errors.Is(err, ErrModesDiverge) {
+			t.Fatalf("Divergence not detected (err = %v)", err)
+		}
+
+		var divergence *DivergenceError
+		if !errors.As(err, &divergence) || divergence.Server != 1 {
+			t.Fatalf("Divergence not attributed to server 1 (err = %v)", err)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package pir
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"filippo.io/edwards25519"
+)
+
+/*
+ Elliptic curve (exponent) ElGamal backend for encrypted queries.
+ Ciphertexts are two edwards25519 points (64 bytes compressed) instead of
+ the multi-hundred-byte Paillier ciphertexts, at the cost of a discrete log
+ computation on decryption. This restricts each ciphertext to ECMessageBytes
+ of slot data and is best suited to databases of small slots (counters, flags).
+*/
+
+// ECMessageBytes is the number of slot bytes encoded in each EC ciphertext
+const ECMessageBytes = 2
+
+// ecBabySteps is the number of baby steps used to recover messages
+// (the square root of the message space)
+const ecBabySteps = 1 << (4 * ECMessageBytes)
+
+// ECPublicKey is an EC-ElGamal public key
+type ECPublicKey struct {
+	P *edwards25519.Point
+}
+
+// ECSecretKey is an EC-ElGamal secret key
+type ECSecretKey struct {
+	ECPublicKey
+	D *edwards25519.Scalar
+}
+
+// ECCiphertext is an EC-ElGamal encryption (rG, mG + rP) of m
+type ECCiphertext struct {
+	C1, C2 *edwards25519.Point
+}
+
+// ECEncryptedQuery is an EC-ElGamal encryption of a point function
+// that evaluates to 1 at the desired row in the database
+type ECEncryptedQuery struct {
+	Pk                *ECPublicKey
+	EBits             []*ECCiphertext
+	GroupSize         int
+	DBWidth, DBHeight int
+}
+
+// ECEncryptedSlot is an array of EC-ElGamal ciphertexts encrypting a slot
+type ECEncryptedSlot struct {
+	Cts []*ECCiphertext
+}
+
+// ECEncryptedQueryResult is an array of EC-ElGamal encrypted slots
+type ECEncryptedQueryResult struct {
+	Slots     []*ECEncryptedSlot
+	SlotBytes int
+}
+
+// ECKeyGen generates a new EC-ElGamal key pair
+func ECKeyGen() (*ECSecretKey, *ECPublicKey, error) {
+
+	d, err := ecRandomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sk := &ECSecretKey{
+		ECPublicKey: ECPublicKey{new(edwards25519.Point).ScalarBaseMult(d)},
+		D:           d,
+	}
+
+	return sk, &sk.ECPublicKey, nil
+}
+
+// ecRandomScalar returns a uniformly random scalar
+func ecRandomScalar() (*edwards25519.Scalar, error) {
+
+	var buf [64]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return nil, err
+	}
+
+	return edwards25519.NewScalar().SetUniformBytes(buf[:])
+}
+
+// ecScalar returns m as a scalar (m is smaller than the order of the group)
+func ecScalar(m uint64) *edwards25519.Scalar {
+
+	var buf [32]byte
+	binary.LittleEndian.PutUint64(buf[:], m)
+
+	k, err := edwards25519.NewScalar().SetCanonicalBytes(buf[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return k
+}
+
+// Encrypt encrypts m in the exponent
+func (pk *ECPublicKey) Encrypt(m uint64) (*ECCiphertext, error) {
+
+	r, err := ecRandomScalar()
+	if err != nil {
+		return nil, err
+	}
+
+	c1 := new(edwards25519.Point).ScalarBaseMult(r)
+	c2 := new(edwards25519.Point).ScalarMult(r, pk.P)
+	c2.Add(c2, new(edwards25519.Point).ScalarBaseMult(ecScalar(m)))
+
+	return &ECCiphertext{c1, c2}, nil
+}
+
+// Add homomorphically adds the plaintexts of a and b
+func (pk *ECPublicKey) Add(a, b *ECCiphertext) *ECCiphertext {
+	return &ECCiphertext{
+		new(edwards25519.Point).Add(a.C1, b.C1),
+		new(edwards25519.Point).Add(a.C2, b.C2),
+	}
+}
+
+// ConstMult homomorphically multiplies the plaintext of ct by k
+func (pk *ECPublicKey) ConstMult(ct *ECCiphertext, k uint64) *ECCiphertext {
+
+	ks := ecScalar(k)
+
+	return &ECCiphertext{
+		new(edwards25519.Point).ScalarMult(ks, ct.C1),
+		new(edwards25519.Point).ScalarMult(ks, ct.C2),
+	}
+}
+
+// Bytes returns the compressed encoding of the ciphertext
+func (ct *ECCiphertext) Bytes() []byte {
+	return append(ct.C1.Bytes(), ct.C2.Bytes()...)
+}
+
+// Decrypt recovers the plaintext of ct if it is smaller than 2^(8*ECMessageBytes)
+func (sk *ECSecretKey) Decrypt(ct *ECCiphertext) (uint64, error) {
+
+	// mG = C2 - d*C1
+	s := new(edwards25519.Point).ScalarMult(sk.D, ct.C1)
+	m := new(edwards25519.Point).Subtract(ct.C2, s)
+
+	return ecDiscreteLog(m)
+}
+
+// ecDiscreteLog finds m < 2^(8*ECMessageBytes) such that mG = p
+// using baby-step giant-step
+func ecDiscreteLog(p *edwards25519.Point) (uint64, error) {
+
+	table, giant := ecBabyStepTable()
+
+	p = new(edwards25519.Point).Set(p)
+	for i := uint64(0); i < ecBabySteps; i++ {
+		if j, ok := table[string(p.Bytes())]; ok {
+			return i*ecBabySteps + j, nil
+		}
+
+		// subtract one giant step
+		p.Add(p, giant)
+	}
+
+	return 0, errors.New("plaintext is outside of the message space")
+}
+
+var (
+	ecTableOnce sync.Once
+	ecTable     map[string]uint64
+	ecGiant     *edwards25519.Point
+)
+
+// ecBabyStepTable returns the table of jG for j < ecBabySteps
+// along with the (negated) giant step -ecBabySteps*G
+func ecBabyStepTable() (map[string]uint64, *edwards25519.Point) {
+
+	ecTableOnce.Do(func() {
+		ecTable = make(map[string]uint64, ecBabySteps)
+
+		p := edwards25519.NewIdentityPoint()
+		for j := uint64(0); j < ecBabySteps; j++ {
+			ecTable[string(p.Bytes())] = j
+			p.Add(p, edwards25519.NewGeneratorPoint())
+		}
+
+		ecGiant = new(edwards25519.Point).Negate(p)
+	})
+
+	return ecTable, ecGiant
+}
+
+// NewECEncryptedQuery generates a new EC-ElGamal encrypted point function that acts as a PIR query
+// defaults to sqrt sized grid database layout
+func (dbmd *DBMetadata) NewECEncryptedQuery(pk *ECPublicKey, groupSize, index int) (*ECEncryptedQuery, error) {
+
+	layout := dbmd.DefaultLayout(groupSize)
+	width, height := layout.Width, layout.Height
+
+	res := make([]*ECCiphertext, height)
+	for i := 0; i < height; i++ {
+		bit := uint64(0)
+		if i == index {
+			bit = 1
+		}
+
+		var err error
+		res[i], err = pk.Encrypt(bit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ECEncryptedQuery{
+		Pk:        pk,
+		EBits:     res,
+		GroupSize: groupSize,
+		DBWidth:   width,
+		DBHeight:  height,
+	}, nil
+}
+
+// PrivateECEncryptedQuery uses the provided EC-ElGamal PIR query to retreive a slot row (encrypted).
+// Each slot is split into chunks of ECMessageBytes, one per ciphertext
+func (db *Database) PrivateECEncryptedQuery(query *ECEncryptedQuery, nprocs int) (*ECEncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	dimWidth := query.DBWidth
+	dimHeight := query.DBHeight
+
+	if len(query.EBits) != dimHeight {
+		return nil, errors.New("query does not match the database height")
+	}
+
+	numCiphertextsPerSlot := (db.SlotBytes + ECMessageBytes - 1) / ECMessageBytes
+
+	// null ciphertext (identity point)
+	null := &ECCiphertext{edwards25519.NewIdentityPoint(), edwards25519.NewIdentityPoint()}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	// mapping of results; one for each process
+	slotRes := make([][]*ECEncryptedSlot, nprocs)
+
+	// initialize the slots
+	for i := range slotRes {
+		slotRes[i] = make([]*ECEncryptedSlot, dimWidth)
+		for col := 0; col < dimWidth; col++ {
+			slotRes[i][col] = &ECEncryptedSlot{
+				Cts: make([]*ECCiphertext, numCiphertextsPerSlot),
+			}
+
+			for j := range slotRes[i][col].Cts {
+				slotRes[i][col].Cts[j] = null
+			}
+		}
+	}
+
+	err := parallelRanges(context.Background(), dimHeight, nprocs, func(i, start, end int) error {
+		for row := start; row < end; row++ {
+			for col := 0; col < dimWidth; col++ {
+				slotIndex := row*dimWidth + col
+				if slotIndex >= len(db.Slots) {
+					continue
+				}
+
+				for j, val := range ecSlotChunks(db.Slots[slotIndex], numCiphertextsPerSlot) {
+					if val == 0 {
+						continue
+					}
+
+					sel := query.Pk.ConstMult(query.EBits[row], val)
+					slotRes[i][col].Cts[j] = query.Pk.Add(slotRes[i][col].Cts[j], sel)
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	slots := slotRes[0]
+	for i := 1; i < nprocs; i++ {
+		for j := 0; j < dimWidth; j++ {
+			for k := range slots[j].Cts {
+				slots[j].Cts[k] = query.Pk.Add(slots[j].Cts[k], slotRes[i][j].Cts[k])
+			}
+		}
+	}
+
+	return &ECEncryptedQueryResult{
+		Slots:     slots,
+		SlotBytes: db.SlotBytes,
+	}, nil
+}
+
+// RecoverECEncrypted decrypts the EC-ElGamal encrypted slots and returns the slots.
+// Returns an error if the slot size of the result does not fit in its ciphertexts
+func RecoverECEncrypted(res *ECEncryptedQueryResult, sk *ECSecretKey) ([]*Slot, error) {
+
+	slots := make([]*Slot, len(res.Slots))
+
+	for i, eslot := range res.Slots {
+		data := make([]byte, len(eslot.Cts)*ECMessageBytes)
+		if res.SlotBytes < 0 || res.SlotBytes > len(data) {
+			return nil, fmt.Errorf("slot size %v does not fit in %v ciphertexts", res.SlotBytes, len(eslot.Cts))
+		}
+
+		for j, ct := range eslot.Cts {
+			val, err := sk.Decrypt(ct)
+			if err != nil {
+				return nil, err
+			}
+
+			for k := 0; k < ECMessageBytes; k++ {
+				data[(j+1)*ECMessageBytes-k-1] = byte(val >> uint(8*k))
+			}
+		}
+
+		slots[i] = NewSlot(data[:res.SlotBytes])
+	}
+
+	return slots, nil
+}
+
+// ecSlotChunks splits the slot into n big-endian integers of ECMessageBytes each
+func ecSlotChunks(slot *Slot, n int) []uint64 {
+
+	chunks := make([]uint64, n)
+	for i, b := range slot.Data {
+		chunks[i/ECMessageBytes] = chunks[i/ECMessageBytes]<<8 | uint64(b)
+	}
+
+	// left align the last chunk when the slot size is not a multiple of ECMessageBytes
+	if rem := len(slot.Data) % ECMessageBytes; rem != 0 {
+		chunks[n-1] <<= uint(8 * (ECMessageBytes - rem))
+	}
+
+	return chunks
+}
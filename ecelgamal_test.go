@@ -0,0 +1,185 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestECElGamal' to see log outputs.
+func TestECElGamal(t *testing.T) {
+	setup()
+
+	sk, pk, err := ECKeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < NumQueries; i++ {
+		a := uint64(rand.Intn(1 << 7))
+		b := uint64(rand.Intn(1 << 7))
+		k := uint64(rand.Intn(1 << 8))
+
+		ctA, err := pk.Encrypt(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctB, err := pk.Encrypt(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := sk.Decrypt(pk.ConstMult(pk.Add(ctA, ctB), k))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res != (a+b)*k {
+			t.Fatalf("Decryption is incorrect. %v != %v\n", res, (a+b)*k)
+		}
+	}
+
+	ct, _ := pk.Encrypt(1 << (8 * ECMessageBytes))
+	if _, err := sk.Decrypt(ct); err == nil {
+		t.Fatalf("Decrypted a message outside of the message space")
+	}
+
+	t.Logf("ciphertext size = %v bytes\n", len(ct.Bytes()))
+}
+
+// run with 'go test -v -run TestECEncryptedQuery' to see log outputs.
+func TestECEncryptedQuery(t *testing.T) {
+	setup()
+
+	sk, pk, err := ECKeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for slotBytes := 1; slotBytes <= SlotBytes; slotBytes++ {
+		db := GenerateRandomDB(TestDBSize, slotBytes)
+
+		for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+			// null query retrieves the all-zero slots
+			query, err := db.NewECEncryptedQuery(pk, groupSize, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, err := db.PrivateECEncryptedQuery(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := RecoverECEncrypted(response, sk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for j := range res {
+				if !res[j].Equal(NewEmptySlot(slotBytes)) {
+					t.Fatalf("Null query result is non-zero. %v\n", res[j])
+				}
+			}
+
+			qIndex := rand.Intn(query.DBHeight)
+			query, err = db.NewECEncryptedQuery(pk, groupSize, qIndex)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			response, err = db.PrivateECEncryptedQuery(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err = RecoverECEncrypted(response, sk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for j := 0; j < query.DBWidth; j++ {
+				index := qIndex*query.DBWidth + j
+				if index >= db.DBSize {
+					break
+				}
+
+				if !db.Slots[index].Equal(res[j]) {
+					t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[index], res[j])
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestECEncryptedQueryNumProcs' to see log outputs.
+func TestECEncryptedQueryNumProcs(t *testing.T) {
+	setup()
+
+	sk, pk, err := ECKeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	qIndex := 1
+
+	query, err := db.NewECEncryptedQuery(pk, 1, qIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no workers and more workers than rows
+	for _, nprocs := range []int{0, query.DBHeight + 3} {
+		response, err := db.PrivateECEncryptedQuery(query, nprocs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := RecoverECEncrypted(response, sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j := 0; j < query.DBWidth; j++ {
+			index := qIndex*query.DBWidth + j
+			if index >= db.DBSize {
+				break
+			}
+
+			if !db.Slots[index].Equal(res[j]) {
+				t.Fatalf("Query result with %v processes is incorrect. %v != %v\n", nprocs, db.Slots[index], res[j])
+			}
+		}
+	}
+}
+
+func TestRecoverECEncryptedSlotBytes(t *testing.T) {
+	setup()
+
+	sk, pk, err := ECKeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	query, err := db.NewECEncryptedQuery(pk, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := db.PrivateECEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the slot size is chosen by the server
+	numCiphertexts := len(response.Slots[0].Cts)
+	for _, slotBytes := range []int{-1, numCiphertexts*ECMessageBytes + 1} {
+		response.SlotBytes = slotBytes
+		if _, err := RecoverECEncrypted(response, sk); err == nil {
+			t.Fatalf("Recovered slots of %v bytes from %v ciphertexts\n", slotBytes, numCiphertexts)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package pir
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Binary encoding helpers.
+ Every encoded value starts with a tag identifying its type so that a
+ value of one type is never decoded as another. Integers are varints,
+ byte strings and big integers are length prefixed and nil pointers
+ are encoded explicitly.
+*/
+
+// ErrInvalidEncoding is returned when decoding malformed (or truncated) bytes
+var ErrInvalidEncoding = errors.New("invalid encoding")
+
+// encoding tags (one per encoded type)
+const (
+	tagChalToken byte = iota + 1
+	tagProofToken
+	tagAuditTokenShare
+	tagAuthTokenShare
+	tagQueryEnvelope
+	tagQueryShare
+	tagSecretSharedQueryResult
+	tagEncryptedQuery
+	tagDoublyEncryptedQuery
+	tagEncryptedQueryResult
+	tagDoublyEncryptedQueryResult
+	tagAuthenticatedEncryptedQuery
+	tagAuthenticatedQueryShare
+	tagSlotPatch
+	tagCompactEncryptedQueryResult
+	tagMaskedQueryShare
+	tagShamirQueryShare
+	tagShamirQueryResult
+)
+
+// big integer signs (nil pointers are encoded as intNil)
+const (
+	intNil byte = iota
+	intNonNegative
+	intNegative
+)
+
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder(tag byte) *encoder {
+	return &encoder{buf: []byte{tag}}
+}
+
+func (e *encoder) writeByte(b byte) {
+	e.buf = append(e.buf, b)
+}
+
+func (e *encoder) writeInt(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.writeByte(1)
+	} else {
+		e.writeByte(0)
+	}
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) writeBigInt(v *gmp.Int) {
+	switch {
+	case v == nil:
+		e.writeByte(intNil)
+		return
+	case v.Sign() < 0:
+		e.writeByte(intNegative)
+	default:
+		e.writeByte(intNonNegative)
+	}
+	e.writeBytes(v.Bytes())
+}
+
+func (e *encoder) writeCiphertext(ct *paillier.Ciphertext) {
+	if ct == nil {
+		e.writeByte(0)
+		return
+	}
+	e.writeByte(1)
+	e.writeBigInt(ct.C)
+	e.writeInt(int64(ct.Level))
+}
+
+func (e *encoder) writeSlot(slot *Slot) {
+	if slot == nil {
+		e.writeByte(0)
+		return
+	}
+	e.writeByte(1)
+	e.writeBytes(slot.Data)
+}
+
+func (e *encoder) writeSlots(slots []*Slot) {
+	e.writeInt(int64(len(slots)))
+	for _, slot := range slots {
+		e.writeSlot(slot)
+	}
+}
+
+func (e *encoder) writeCiphertexts(cts []*paillier.Ciphertext) {
+	e.writeInt(int64(len(cts)))
+	for _, ct := range cts {
+		e.writeCiphertext(ct)
+	}
+}
+
+// writeFixedCiphertexts is writeCiphertexts with every ciphertext left-padded to
+// the length of its modulus so that the length of the encoding only depends on
+// the public key and the levels (readCiphertexts decodes both)
+func (e *encoder) writeFixedCiphertexts(pk *paillier.PublicKey, cts []*paillier.Ciphertext) {
+	if pk == nil {
+		e.writeCiphertexts(cts)
+		return
+	}
+
+	e.writeInt(int64(len(cts)))
+	for _, ct := range cts {
+		if ct == nil || ct.C == nil || ct.C.Sign() < 0 {
+			e.writeCiphertext(ct)
+			continue
+		}
+
+		padded := make([]byte, ciphertextModulusBytes(pk, ct.Level))
+		c := ct.C.Bytes()
+		if len(c) > len(padded) {
+			// not reduced modulo N^(s+1); encoded as is
+			e.writeCiphertext(ct)
+			continue
+		}
+		copy(padded[len(padded)-len(c):], c)
+
+		e.writeByte(1)
+		e.writeByte(intNonNegative)
+		e.writeBytes(padded)
+		e.writeInt(int64(ct.Level))
+	}
+}
+
+// ciphertextModulusBytes returns the length of N^(s+1) for ciphertexts at the level
+func ciphertextModulusBytes(pk *paillier.PublicKey, level paillier.EncryptionLevel) int {
+	s := 1
+	if level == paillier.EncLevelTwo {
+		s = 2
+	}
+	return (s + 1) * len(pk.N.Bytes())
+}
+
+// writeFields encodes the exported fields of the struct pointed to by v in order.
+// Used for types defined by the paillier library (e.g., DDLEQProof) so that the
+// encoding follows their definition. Supports big integers, ciphertexts,
+// slices of either and integers
+func (e *encoder) writeFields(v interface{}) error {
+
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		e.writeByte(0)
+		return nil
+	}
+	e.writeByte(1)
+
+	rv = rv.Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).PkgPath != "" {
+			continue // unexported
+		}
+		if err := e.writeValue(rv.Field(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	bigIntPtrType     = reflect.TypeOf((*gmp.Int)(nil))
+	ciphertextPtrType = reflect.TypeOf((*paillier.Ciphertext)(nil))
+)
+
+func (e *encoder) writeValue(v reflect.Value) error {
+
+	switch {
+	case v.Type() == bigIntPtrType:
+		e.writeBigInt(v.Interface().(*gmp.Int))
+	case v.Type() == ciphertextPtrType:
+		e.writeCiphertext(v.Interface().(*paillier.Ciphertext))
+	case v.Kind() == reflect.Slice:
+		e.writeInt(int64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.writeValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		e.writeInt(v.Int())
+	default:
+		return fmt.Errorf("cannot encode field of type %v", v.Type())
+	}
+
+	return nil
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+// newDecoder returns a decoder for b after checking its tag
+func newDecoder(b []byte, tag byte) *decoder {
+	if len(b) == 0 || b[0] != tag {
+		return &decoder{err: ErrInvalidEncoding}
+	}
+	return &decoder{buf: b[1:]}
+}
+
+// finish returns the first decoding error or ErrInvalidEncoding if bytes remain
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.buf) != 0 {
+		d.err = ErrInvalidEncoding
+	}
+	return d.err
+}
+
+func (d *decoder) readByte() byte {
+	if d.err != nil || len(d.buf) == 0 {
+		d.err = ErrInvalidEncoding
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) readInt() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.err = ErrInvalidEncoding
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) readBytes() []byte {
+	if d.err != nil {
+		return nil
+	}
+	n, k := binary.Uvarint(d.buf)
+	if k <= 0 || n > uint64(len(d.buf)-k) {
+		d.err = ErrInvalidEncoding
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.buf[k:])
+	d.buf = d.buf[k+int(n):]
+	return b
+}
+
+// readFixedBytes reads a byte string of exactly len(b) bytes into b
+func (d *decoder) readFixedBytes(b []byte) {
+	v := d.readBytes()
+	if d.err == nil && len(v) != len(b) {
+		d.err = ErrInvalidEncoding
+	}
+	copy(b, v)
+}
+
+func (d *decoder) readBool() bool {
+	switch d.readByte() {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	d.err = ErrInvalidEncoding
+	return false
+}
+
+// readLen reads a length and checks that at least one byte per element remains
+func (d *decoder) readLen() int {
+	n := d.readInt()
+	if d.err == nil && (n < 0 || n > int64(len(d.buf))) {
+		d.err = ErrInvalidEncoding
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) readBigInt() *gmp.Int {
+	sign := d.readByte()
+	if d.err != nil || sign == intNil {
+		return nil
+	}
+	if sign != intNonNegative && sign != intNegative {
+		d.err = ErrInvalidEncoding
+		return nil
+	}
+	v := new(gmp.Int).SetBytes(d.readBytes())
+	if sign == intNegative {
+		v.Neg(v)
+	}
+	return v
+}
+
+// readPresent reads the flag written before nullable values
+func (d *decoder) readPresent() bool {
+	switch d.readByte() {
+	case 0:
+		return false
+	case 1:
+		return d.err == nil
+	}
+	d.err = ErrInvalidEncoding
+	return false
+}
+
+func (d *decoder) readCiphertext() *paillier.Ciphertext {
+	if !d.readPresent() {
+		return nil
+	}
+	c := d.readBigInt()
+	level := d.readInt()
+	if d.err == nil && c == nil {
+		d.err = ErrInvalidEncoding
+	}
+	return &paillier.Ciphertext{C: c, Level: paillier.EncryptionLevel(level)}
+}
+
+func (d *decoder) readSlot() *Slot {
+	if !d.readPresent() {
+		return nil
+	}
+	return NewSlot(d.readBytes())
+}
+
+func (d *decoder) readSlots() []*Slot {
+	n := d.readLen()
+	slots := make([]*Slot, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		slots[i] = d.readSlot()
+	}
+	return slots
+}
+
+func (d *decoder) readCiphertexts() []*paillier.Ciphertext {
+	n := d.readLen()
+	cts := make([]*paillier.Ciphertext, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		cts[i] = d.readCiphertext()
+	}
+	return cts
+}
+
+// readFields decodes the fields written by writeFields into the struct pointed to by v
+// and returns false if the pointer was nil
+func (d *decoder) readFields(v interface{}) bool {
+
+	if !d.readPresent() {
+		return false
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	for i := 0; i < rv.NumField() && d.err == nil; i++ {
+		if rv.Type().Field(i).PkgPath != "" {
+			continue // unexported
+		}
+		d.readValue(rv.Field(i))
+	}
+
+	return true
+}
+
+func (d *decoder) readValue(v reflect.Value) {
+
+	switch {
+	case v.Type() == bigIntPtrType:
+		if x := d.readBigInt(); x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+	case v.Type() == ciphertextPtrType:
+		if ct := d.readCiphertext(); ct != nil {
+			v.Set(reflect.ValueOf(ct))
+		}
+	case v.Kind() == reflect.Slice:
+		n := d.readLen()
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			d.readValue(s.Index(i))
+		}
+		v.Set(s)
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		v.SetInt(d.readInt())
+	default:
+		d.err = ErrInvalidEncoding
+	}
+}
@@ -0,0 +1,180 @@
+package pir
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+ Signed query envelopes.
+ In audited deployments the servers must log who queried and why
+ (without learning what was queried) and must reject queries that are
+ replayed long after they were issued. An envelope wraps an encoded
+ query with the identity of the client, the purpose of the query, the
+ epoch it was generated for and an expiry, all signed (Ed25519) by the
+ client. The server verifies the envelope before answering the query.
+*/
+
+var (
+	// ErrUnknownClient is returned when the client of an envelope is not registered
+	ErrUnknownClient = errors.New("envelope signed by an unknown client")
+
+	// ErrInvalidEnvelopeSignature is returned when the signature of an envelope does not verify
+	ErrInvalidEnvelopeSignature = errors.New("invalid envelope signature")
+
+	// ErrEnvelopeExpired is returned when the expiry of an envelope has passed
+	ErrEnvelopeExpired = errors.New("envelope has expired")
+)
+
+// envelopeSignatureContext is signed along with the envelope so that
+// signatures over envelopes cannot be confused with other signatures of the client
+const envelopeSignatureContext = "pir-query-envelope-v1"
+
+// QueryEnvelope wraps an encoded query with the identity of the client and
+// the purpose of the query
+type QueryEnvelope struct {
+	ClientID  string
+	Purpose   string
+	Epoch     int       // epoch of the database the query was generated for
+	Expiry    time.Time // the query is rejected after the expiry (second precision)
+	Query     []byte    // the encoded query
+	Signature []byte
+}
+
+// NewQueryEnvelope returns an envelope for the encoded query signed using sk
+func NewQueryEnvelope(sk ed25519.PrivateKey, clientID, purpose string, epoch int, expiry time.Time, query []byte) *QueryEnvelope {
+
+	env := &QueryEnvelope{
+		ClientID: clientID,
+		Purpose:  purpose,
+		Epoch:    epoch,
+		Expiry:   time.Unix(expiry.Unix(), 0),
+		Query:    query,
+	}
+
+	env.Signature = ed25519.Sign(sk, env.signedBytes())
+
+	return env
+}
+
+// MarshalBinary encodes the envelope
+func (env *QueryEnvelope) MarshalBinary() ([]byte, error) {
+
+	e := env.encodeSigned()
+	e.writeBytes(env.Signature)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an envelope encoded by MarshalBinary.
+// The signature is not verified (see EnvelopeVerifier)
+func (env *QueryEnvelope) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagQueryEnvelope)
+	clientID := d.readBytes()
+	purpose := d.readBytes()
+	epoch := d.readInt()
+	expiry := d.readInt()
+	query := d.readBytes()
+	signature := d.readBytes()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	env.ClientID = string(clientID)
+	env.Purpose = string(purpose)
+	env.Epoch = int(epoch)
+	env.Expiry = time.Unix(expiry, 0)
+	env.Query = query
+	env.Signature = signature
+
+	return nil
+}
+
+// encodeSigned encodes the signed fields of the envelope
+func (env *QueryEnvelope) encodeSigned() *encoder {
+
+	e := newEncoder(tagQueryEnvelope)
+	e.writeBytes([]byte(env.ClientID))
+	e.writeBytes([]byte(env.Purpose))
+	e.writeInt(int64(env.Epoch))
+	e.writeInt(env.Expiry.Unix())
+	e.writeBytes(env.Query)
+
+	return e
+}
+
+// signedBytes returns the message signed by the client
+func (env *QueryEnvelope) signedBytes() []byte {
+	return append([]byte(envelopeSignatureContext), env.encodeSigned().buf...)
+}
+
+// EnvelopeVerifier verifies envelopes signed by registered clients.
+// It is safe for concurrent use
+type EnvelopeVerifier struct {
+	mu      sync.RWMutex
+	clients map[string]ed25519.PublicKey
+
+	// Now returns the current time (time.Now if nil)
+	Now func() time.Time
+}
+
+// NewEnvelopeVerifier returns a verifier without registered clients
+func NewEnvelopeVerifier() *EnvelopeVerifier {
+	return &EnvelopeVerifier{clients: make(map[string]ed25519.PublicKey)}
+}
+
+// AddClient registers the public key of the client
+func (v *EnvelopeVerifier) AddClient(clientID string, pk ed25519.PublicKey) {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.clients[clientID] = pk
+}
+
+// RemoveClient unregisters the client; its envelopes are rejected from now on
+func (v *EnvelopeVerifier) RemoveClient(clientID string) {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	delete(v.clients, clientID)
+}
+
+// Verify checks that the envelope is signed by its (registered) client, has not
+// expired and was generated for the epoch of the database described by dbmd.
+// Returns ErrUnknownClient, ErrInvalidEnvelopeSignature, ErrEnvelopeExpired or
+// ErrStaleLayout
+func (v *EnvelopeVerifier) Verify(env *QueryEnvelope, dbmd *DBMetadata) error {
+
+	v.mu.RLock()
+	pk, ok := v.clients[env.ClientID]
+	v.mu.RUnlock()
+
+	if !ok {
+		return ErrUnknownClient
+	}
+
+	if len(pk) != ed25519.PublicKeySize || !ed25519.Verify(pk, env.signedBytes(), env.Signature) {
+		return ErrInvalidEnvelopeSignature
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+
+	if now().After(env.Expiry) {
+		return ErrEnvelopeExpired
+	}
+
+	if env.Epoch != dbmd.Epoch {
+		return ErrStaleLayout
+	}
+
+	return nil
+}
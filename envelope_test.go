@@ -0,0 +1,86 @@
+package pir
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+)
+
+// run with 'go test -v -run TestQueryEnvelope' to see log outputs.
+func TestQueryEnvelope(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewEnvelopeVerifier()
+	verifier.AddClient("alice", pk)
+
+	now := time.Unix(1700000000, 0)
+	verifier.Now = func() time.Time { return now }
+
+	query := []byte{1, 2, 3, 4}
+	env := NewQueryEnvelope(sk, "alice", "audit", db.Epoch, now.Add(time.Minute), query)
+
+	b, err := env.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &QueryEnvelope{}
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifier.Verify(decoded, &db.DBMetadata); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("Envelope: %v bytes for a %v byte query\n", len(b), len(query))
+
+	// tampered fields are detected
+	tampered := *decoded
+	tampered.Purpose = "other"
+	if err := verifier.Verify(&tampered, &db.DBMetadata); !errors.Is(err, ErrInvalidEnvelopeSignature) {
+		t.Fatalf("Expected ErrInvalidEnvelopeSignature, got %v\n", err)
+	}
+
+	tampered = *decoded
+	tampered.Query = []byte{1, 2, 3, 5}
+	if err := verifier.Verify(&tampered, &db.DBMetadata); !errors.Is(err, ErrInvalidEnvelopeSignature) {
+		t.Fatalf("Expected ErrInvalidEnvelopeSignature, got %v\n", err)
+	}
+
+	tampered = *decoded
+	tampered.ClientID = "bob"
+	if err := verifier.Verify(&tampered, &db.DBMetadata); !errors.Is(err, ErrUnknownClient) {
+		t.Fatalf("Expected ErrUnknownClient, got %v\n", err)
+	}
+
+	// stale epoch
+	db.Epoch++
+	if err := verifier.Verify(decoded, &db.DBMetadata); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+	db.Epoch--
+
+	// expired
+	now = now.Add(2 * time.Minute)
+	if err := verifier.Verify(decoded, &db.DBMetadata); !errors.Is(err, ErrEnvelopeExpired) {
+		t.Fatalf("Expected ErrEnvelopeExpired, got %v\n", err)
+	}
+
+	verifier.RemoveClient("alice")
+	if err := verifier.Verify(decoded, &db.DBMetadata); !errors.Is(err, ErrUnknownClient) {
+		t.Fatalf("Expected ErrUnknownClient, got %v\n", err)
+	}
+
+	if err := decoded.UnmarshalBinary(b[:len(b)-1]); !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("Expected ErrInvalidEncoding, got %v\n", err)
+	}
+}
@@ -0,0 +1,115 @@
+package pir
+
+import (
+	"errors"
+)
+
+// SwapIn atomically replaces the contents of the database with newSlots.
+// Queries in progress complete over the old contents and queries issued
+// afterwards see the new contents. The epoch is incremented and
+// all registered swap listeners are notified with the new epoch
+// (e.g., to invalidate caches derived from the old contents)
+func (db *Database) SwapIn(newSlots []*Slot) error {
+	return db.swapIn(newSlots, "")
+}
+
+// swapIn replaces the contents with newSlots encrypted at rest under the
+// key with keyID (not encrypted if keyID is empty; see SwapInSealed)
+func (db *Database) swapIn(newSlots []*Slot, keyID string) error {
+
+	slotBytes := 0
+	if len(newSlots) > 0 {
+		slotBytes = len(newSlots[0].Data)
+	}
+
+	for _, slot := range newSlots {
+		if slot == nil || len(slot.Data) != slotBytes {
+			return errors.New("all slots must have the same size")
+		}
+	}
+
+	db.mu.Lock()
+
+	// the new contents are shuffled with a fresh key (see ShuffleWithinGroups)
+	var shuffle *GroupShuffle
+	if db.GroupShuffle != nil {
+		var err error
+		if shuffle, err = newGroupShuffle(db.GroupShuffle.GroupSize); err != nil {
+			db.mu.Unlock()
+			return err
+		}
+	}
+
+	db.Epoch++
+	if shuffle != nil {
+		newSlots = shuffle.shuffle(newSlots, db.Epoch)
+	}
+
+	db.Slots = newSlots
+	db.SlotBytes = slotBytes
+	db.DBSize = len(newSlots)
+	db.GroupShuffle = shuffle
+	db.SlotKeyID = keyID
+
+	// keywords and attributes are associated with the old rows
+	db.Keywords = nil
+	db.KeywordBits = 0
+	db.KeywordDigest = nil
+	db.KeywordCommitment = nil
+	db.KeyValue = nil
+	db.LogTree = nil
+	db.Attributes = nil
+	db.records = nil
+
+	// cached values depend on the slot size
+	db.pkCache.clear()
+
+	// the new slots are not allocated on the nodes
+	db.numaAlloc = nil
+	db.numaPartitions = nil
+
+	epoch := db.Epoch
+	listeners := db.swapListenersLocked()
+
+	db.mu.Unlock()
+
+	notifySwap(listeners, epoch)
+
+	return nil
+}
+
+// swapListenersLocked returns a copy of the swap listeners
+// (to notify once the lock is released)
+func (db *Database) swapListenersLocked() []func(int) {
+
+	listeners := make([]func(int), len(db.swapListeners))
+	copy(listeners, db.swapListeners)
+
+	return listeners
+}
+
+func notifySwap(listeners []func(int), epoch int) {
+	for _, listener := range listeners {
+		listener(epoch)
+	}
+}
+
+// OnSwap registers a listener that is called with the new epoch
+// after each call to SwapIn and whenever slots move (see AppendSlots and DeleteSlot)
+func (db *Database) OnSwap(listener func(epoch int)) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.swapListeners = append(db.swapListeners, listener)
+}
+
+// Metadata returns a snapshot of the database metadata
+// (including the current epoch) to distribute to clients
+func (db *Database) Metadata() DBMetadata {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.DBMetadata
+}
@@ -0,0 +1,77 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSwapIn(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	notified := -1
+	db.OnSwap(func(epoch int) {
+		notified = epoch
+	})
+
+	newDB := GenerateRandomDB(TestDBSize/2, SlotBytes+1)
+	if err := db.SwapIn(newDB.Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Epoch != 1 || notified != 1 {
+		t.Fatalf("Epoch not incremented: epoch %v, notified %v\n", db.Epoch, notified)
+	}
+
+	if db.DBSize != TestDBSize/2 || db.SlotBytes != SlotBytes+1 {
+		t.Fatalf("Metadata not updated: %v\n", db.DBMetadata)
+	}
+
+	qIndex := rand.Intn(db.DBSize)
+	shares := db.NewIndexQueryShares(qIndex, 1, 2)
+
+	resA, _ := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+	resB, _ := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+
+	res := Recover([]*SecretSharedQueryResult{resA, resB})
+	if !newDB.Slots[qIndex].Equal(res[0]) {
+		t.Fatalf("Query result is incorrect after swap. %v != %v\n", newDB.Slots[qIndex], res[0])
+	}
+
+	if err := db.SwapIn([]*Slot{NewEmptySlot(1), NewEmptySlot(2)}); err == nil {
+		t.Fatalf("Swapped in slots of different sizes")
+	}
+}
+
+func TestSwapInConcurrentQueries(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	var wg sync.WaitGroup
+	for i := 0; i < NumProcsForQuery; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < NumQueries; j++ {
+				md := db.Metadata()
+				shares := md.NewIndexQueryShares(rand.Intn(md.DBSize), 1, 2)
+				// queries generated before a swap are rejected as stale
+				if _, err := db.PrivateSecretSharedQuery(shares[0], 1); err != nil && !errors.Is(err, ErrStaleLayout) {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < NumQueries; i++ {
+		if err := db.SwapIn(GenerateRandomDB(TestDBSize, SlotBytes).Slots); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,286 @@
+package pir
+
+import (
+	"bufio"
+	"container/heap"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/*
+ External-sort builder for PrivateSqrtST.
+ The keys are sorted in runs that fit in memory, each run is written to a
+ temporary file, and the runs are merged while the padded second layer is
+ streamed directly to a database file. Only the first layer (sqrt N keys)
+ is held in memory.
+*/
+
+// DefaultMaxKeysInMemory is the default number of keys sorted in memory per run
+const DefaultMaxKeysInMemory = 1 << 20
+
+// ExternalSortOptions configures BuildSqrtSTExternal
+type ExternalSortOptions struct {
+	TempDir         string // directory for the sorted runs (os.TempDir() if empty)
+	MaxKeysInMemory int    // keys sorted in memory per run (DefaultMaxKeysInMemory if zero)
+}
+
+// BuildSqrtSTExternal reads newline-separated keys (empty lines are ignored),
+// sorts and pads them to a perfect square as BuildForData expects, and writes the
+// second layer to the database file at dbPath. The returned PrivateSqrtST does not
+// hold the second layer in memory; load it with LoadSecondLayer
+func BuildSqrtSTExternal(keys io.Reader, dbPath string, opts ExternalSortOptions) (*PrivateSqrtST, error) {
+
+	if opts.MaxKeysInMemory <= 0 {
+		opts.MaxKeysInMemory = DefaultMaxKeysInMemory
+	}
+
+	runs, numKeys, maxKeyBytes, err := writeSortedRuns(keys, opts)
+	defer func() {
+		for _, run := range runs {
+			os.Remove(run)
+		}
+	}()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if numKeys == 0 {
+		return nil, errors.New("no keys to build the database for")
+	}
+
+	sqrtDim := ceilSqrt(numKeys)
+	dbSize := sqrtDim * sqrtDim
+	numPadding := dbSize - numKeys
+
+	slotBytes := maxKeyBytes
+	if numPadding > 0 && slotBytes < len(padding) {
+		slotBytes = len(padding)
+	}
+
+	f, err := os.Create(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dw, err := NewDBFileWriter(f, slotBytes, dbSize, numPadding)
+	if err != nil {
+		return nil, err
+	}
+
+	// the first layer holds every sqrtDim-th key and the last key (see BuildForData)
+	firstLayer := make([]string, 0, sqrtDim)
+	position := 0
+	emit := func(key string) error {
+		if position > 0 && position%sqrtDim == 0 {
+			firstLayer = append(firstLayer, key)
+		}
+		if position == dbSize-1 {
+			firstLayer = append(firstLayer, key)
+		}
+		position++
+
+		return dw.WriteSlot([]byte(key))
+	}
+
+	if err := mergeSortedRuns(runs, emit); err != nil {
+		return nil, err
+	}
+
+	// data is sorted in descending order so padding is at the end
+	for i := 0; i < numPadding; i++ {
+		if err := emit(padding); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := dw.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	sqst := NewPrivateSqrtST()
+	sqst.FirstLayer = firstLayer
+	sqst.SlotBytes = GetRequiredSlotSize(firstLayer)
+	sqst.NumKeys = dbSize
+	sqst.NumPadding = numPadding
+	sqst.Width = sqrtDim
+	sqst.Height = sqrtDim
+
+	return sqst, nil
+}
+
+// LoadSecondLayer loads the second layer from the database file at path
+// (see BuildSqrtSTExternal)
+func (sqst *PrivateSqrtST) LoadSecondLayer(path string) error {
+
+	db, err := LoadDatabaseFile(path)
+	if err != nil {
+		return err
+	}
+
+	if db.DBSize != sqst.NumKeys || db.NumPaddingSlots != sqst.NumPadding {
+		return errors.New("database file does not match the search tree")
+	}
+
+	db.keywordLayer = true
+	sqst.SecondLayer = db
+
+	return nil
+}
+
+// writeSortedRuns splits the keys into runs of at most opts.MaxKeysInMemory keys
+// sorted in descending order and writes each run to a temporary file.
+// Returns the run files, the number of keys and the size of the largest key
+func writeSortedRuns(keys io.Reader, opts ExternalSortOptions) ([]string, int, int, error) {
+
+	runs := make([]string, 0)
+	numKeys := 0
+	maxKeyBytes := 0
+
+	run := make([]string, 0)
+	flush := func() error {
+		if len(run) == 0 {
+			return nil
+		}
+
+		sort.Sort(sort.Reverse(sort.StringSlice(run)))
+
+		f, err := os.CreateTemp(opts.TempDir, "pir-run-*")
+		if err != nil {
+			return err
+		}
+		runs = append(runs, f.Name())
+
+		w := bufio.NewWriter(f)
+		for _, key := range run {
+			w.WriteString(key)
+			w.WriteByte('\n')
+		}
+
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+
+		run = run[:0]
+
+		return f.Close()
+	}
+
+	r := bufio.NewReader(keys)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return runs, 0, 0, err
+		}
+
+		key := strings.TrimSuffix(line, "\n")
+		if key != "" {
+			run = append(run, key)
+			numKeys++
+			if len(key) > maxKeyBytes {
+				maxKeyBytes = len(key)
+			}
+		}
+
+		if len(run) == opts.MaxKeysInMemory || (err == io.EOF && len(run) > 0) {
+			if ferr := flush(); ferr != nil {
+				return runs, 0, 0, ferr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return runs, numKeys, maxKeyBytes, nil
+}
+
+// runReader is the next key of a sorted run
+type runReader struct {
+	key string
+	r   *bufio.Reader
+}
+
+// runHeap orders the runs by their next key (largest first)
+type runHeap []*runReader
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].key > h[j].key }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// next advances the run to its next key; returns false at the end of the run
+func (rr *runReader) next() (bool, error) {
+
+	line, err := rr.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return false, nil
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	rr.key = strings.TrimSuffix(line, "\n")
+
+	return true, nil
+}
+
+// mergeSortedRuns merges the sorted runs and calls emit on each key in descending order
+func mergeSortedRuns(runs []string, emit func(string) error) error {
+
+	h := make(runHeap, 0, len(runs))
+	for _, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		rr := &runReader{r: bufio.NewReader(f)}
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, rr)
+		}
+	}
+
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		rr := h[0]
+		if err := emit(rr.key); err != nil {
+			return err
+		}
+
+		ok, err := rr.next()
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package pir
+
+import (
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// run with 'go test -v -run TestBuildSqrtSTExternal' to see log outputs.
+func TestBuildSqrtSTExternal(t *testing.T) {
+	setup()
+
+	for _, numKeys := range []int{1, 7, 100, 1000} {
+
+		keys := make([]string, numKeys)
+		for i := range keys {
+			keys[i] = randomString(1 + rand.Intn(7))
+		}
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "db")
+
+		// small runs so that the keys are merged from several files
+		opts := ExternalSortOptions{TempDir: dir, MaxKeysInMemory: 37}
+		sqst, err := BuildSqrtSTExternal(strings.NewReader(strings.Join(keys, "\n")), path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sqst.LoadSecondLayer(path); err != nil {
+			t.Fatal(err)
+		}
+
+		// compare with the in-memory builder
+		sorted := append([]string{}, keys...)
+		sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+		padded := PadToSqrt(sorted)
+		expected := NewPrivateSqrtST()
+		if err := expected.BuildForDataWithPadding(padded, len(padded)-len(sorted)); err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Join(sqst.FirstLayer, ",") != strings.Join(expected.FirstLayer, ",") {
+			t.Fatalf("First layer is incorrect. %v != %v\n", sqst.FirstLayer, expected.FirstLayer)
+		}
+
+		if sqst.NumKeys != expected.NumKeys || sqst.NumPadding != expected.NumPadding ||
+			sqst.SlotBytes != expected.SlotBytes || sqst.Width != expected.Width {
+			t.Fatalf("Search tree is incorrect. %v != %v\n", sqst, expected)
+		}
+
+		md := sqst.GetSecondLayerMetadata()
+		if md.SlotBytes != expected.SecondLayer.SlotBytes || md.NumPaddingSlots != expected.SecondLayer.NumPaddingSlots {
+			t.Fatalf("Second layer metadata is incorrect. %v != %v\n", md, expected.SecondLayer.DBMetadata)
+		}
+
+		for i := range expected.SecondLayer.Slots {
+			if !expected.SecondLayer.Slots[i].Equal(sqst.SecondLayer.Slots[i]) {
+				t.Fatalf("Slot %v is incorrect. %v != %v\n", i, sqst.SecondLayer.Slots[i], expected.SecondLayer.Slots[i])
+			}
+		}
+
+		// the runs are removed
+		if files, _ := filepath.Glob(filepath.Join(dir, "pir-run-*")); len(files) != 0 {
+			t.Fatalf("Runs were not removed: %v\n", files)
+		}
+	}
+
+	if _, err := BuildSqrtSTExternal(strings.NewReader("\n\n"), filepath.Join(t.TempDir(), "db"), ExternalSortOptions{}); err == nil {
+		t.Fatalf("Built a database without keys")
+	}
+}
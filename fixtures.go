@@ -0,0 +1,139 @@
+package pir
+
+import (
+	"encoding"
+	"fmt"
+	"math/rand"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Conformance fixtures for the binary encoding.
+ The fixtures are canonical encodings of values generated from fixed
+ seeds so that implementations in other languages can check that they
+ decode (and re-encode) the wire format identically without running Go.
+ Tokens are random values; query shares, their DPF and PRF keys and the
+ answer of a database of random slots are generated by the constructors
+ with the randomness drawn from the seed. None of the values are
+ cryptographically meaningful. Values encrypted with Paillier (encrypted
+ queries and results) are not part of the fixtures since the paillier
+ library only generates keys from crypto/rand; their encodings combine
+ the public key (its exported fields in order) with the ciphertexts
+ encoded here.
+ Fixtures are written to testdata/fixtures by cmd/pirfixtures and
+ checked by TestConformanceFixtures.
+*/
+
+// ConformanceFixtureSeeds are the seeds of the published fixtures
+var ConformanceFixtureSeeds = []int64{1, 2}
+
+// ConformanceFixture is the canonical encoding of a value
+type ConformanceFixture struct {
+	Name  string // file name (<type>-<seed>.bin)
+	Value encoding.BinaryMarshaler
+	Data  []byte
+}
+
+// GenerateConformanceFixtures returns the fixtures generated from seed
+func GenerateConformanceFixtures(seed int64) ([]*ConformanceFixture, error) {
+
+	rng := rand.New(rand.NewSource(seed))
+
+	values := []fixtureValue{
+		{"chal-token", &ChalToken{
+			Token0:   fixtureCiphertext(rng, 1),
+			Token1:   fixtureCiphertext(rng, 2),
+			SecParam: 1 + rng.Intn(128),
+		}},
+		{"proof-token", &ProofToken{
+			AuthToken: fixtureCiphertext(rng, 1),
+			T:         fixtureCiphertext(rng, 1),
+			QBit:      rng.Intn(2),
+			R:         fixtureBigInt(rng),
+			S:         new(gmp.Int).Neg(fixtureBigInt(rng)),
+		}},
+		{"audit-token-share", &AuditTokenShare{T: fixtureSlot(rng)}},
+		{"auth-token-share", &AuthTokenShare{T: fixtureSlot(rng)}},
+	}
+
+	shared, err := fixtureSharedValues(rng)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, shared...)
+
+	fixtures := make([]*ConformanceFixture, len(values))
+	for i, v := range values {
+		data, err := v.value.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+
+		fixtures[i] = &ConformanceFixture{
+			Name:  fmt.Sprintf("%v-%v.bin", v.name, seed),
+			Value: v.value,
+			Data:  data,
+		}
+	}
+
+	return fixtures, nil
+}
+
+type fixtureValue struct {
+	name  string
+	value encoding.BinaryMarshaler
+}
+
+// fixtureDBSize is the number of slots of the database answering the fixture queries
+const fixtureDBSize = 16
+
+// fixtureSharedValues returns query shares (two-party and multi-party) for a random
+// index of a database of random slots, their keys and the answer of the database
+func fixtureSharedValues(rng *rand.Rand) ([]fixtureValue, error) {
+
+	data := make([][]byte, fixtureDBSize)
+	for i := range data {
+		data[i] = fixtureSlot(rng).Data
+	}
+
+	db := NewDatabase()
+	if err := db.BuildForBinaryData(data); err != nil {
+		return nil, err
+	}
+
+	index := rng.Intn(fixtureDBSize)
+	twoParty := db.newQueryShares(index, 1, 2, true, KeyPayloadInLeaf, 0, rng)[0]
+	multiParty := db.newQueryShares(index, 1, 3, true, KeyPayloadInLeaf, 0, rng)[0]
+
+	res, err := db.PrivateSecretSharedQuery(twoParty, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return []fixtureValue{
+		{"query-share", twoParty},
+		{"query-share-multi-party", multiParty},
+		{"secret-shared-query-result", res},
+		{"dpf-key-two-party", twoParty.KeyTwoParty},
+		{"dpf-key-multi-party", multiParty.KeyMultiParty},
+		{"dpf-prf-key", twoParty.PrfKeys[0]},
+	}, nil
+}
+
+func fixtureBigInt(rng *rand.Rand) *gmp.Int {
+	b := make([]byte, 1+rng.Intn(64))
+	rng.Read(b)
+	return new(gmp.Int).SetBytes(b)
+}
+
+func fixtureCiphertext(rng *rand.Rand, level int) *paillier.Ciphertext {
+	return &paillier.Ciphertext{C: fixtureBigInt(rng), Level: paillier.EncryptionLevel(level)}
+}
+
+func fixtureSlot(rng *rand.Rand) *Slot {
+	b := make([]byte, 1+rng.Intn(32))
+	rng.Read(b)
+	return NewSlot(b)
+}
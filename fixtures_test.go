@@ -0,0 +1,50 @@
+package pir
+
+import (
+	"bytes"
+	"encoding"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// run with 'go test -v -run TestConformanceFixtures' to see log outputs.
+func TestConformanceFixtures(t *testing.T) {
+
+	for _, seed := range ConformanceFixtureSeeds {
+		fixtures, err := GenerateConformanceFixtures(seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, fixture := range fixtures {
+			data, err := os.ReadFile(filepath.Join("testdata", "fixtures", fixture.Name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the encoding is unchanged
+			if !bytes.Equal(data, fixture.Data) {
+				t.Fatalf("Fixture %v does not match the encoding (regenerate with cmd/pirfixtures)", fixture.Name)
+			}
+
+			// the fixture decodes and re-encodes to the same bytes
+			value := reflect.New(reflect.TypeOf(fixture.Value).Elem()).Interface()
+			if err := value.(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+				t.Fatalf("Failed to decode fixture %v: %v", fixture.Name, err)
+			}
+
+			encoded, err := value.(encoding.BinaryMarshaler).MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(encoded, data) {
+				t.Fatalf("Fixture %v does not re-encode to the same bytes", fixture.Name)
+			}
+
+			t.Logf("%v: %v bytes\n", fixture.Name, len(data))
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package pir
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+ Group-oblivious shuffling.
+ With groupSize > 1 the offset of a slot in its group is fixed by the
+ layout. Shuffling pseudorandomly permutes the slots within each group
+ with a fresh key every epoch. The key is published in the metadata so
+ that clients can locate (and reorder) the slots of the groups they
+ retrieve, while offsets no longer correlate across epochs.
+*/
+
+// GroupShuffleKeyBytes is the size of the permutation key
+const GroupShuffleKeyBytes = 16
+
+// GroupShuffle describes the permutation applied within each group of GroupSize slots
+type GroupShuffle struct {
+	GroupSize int
+	Key       []byte
+}
+
+// ShuffleWithinGroups permutes the slots within each group of groupSize slots using a
+// fresh random key and publishes the key in the metadata. The slots are shuffled with
+// a new key whenever the contents are swapped (see SwapIn) until DisableGroupShuffling
+func (db *Database) ShuffleWithinGroups(groupSize int) error {
+
+	if groupSize < 1 {
+		return errors.New("group size must be positive")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// undo the previous permutation so that the logical order is shuffled
+	slots, attributes := db.Slots, db.Attributes
+	if db.GroupShuffle != nil {
+		slots = db.GroupShuffle.unshuffle(db.Slots, db.Epoch)
+		attributes = db.GroupShuffle.applyToAttributes(db.Attributes, db.Epoch, true)
+	}
+
+	shuffle, err := newGroupShuffle(groupSize)
+	if err != nil {
+		return err
+	}
+
+	db.Slots = shuffle.shuffle(slots, db.Epoch)
+	db.Attributes = shuffle.applyToAttributes(attributes, db.Epoch, false)
+	db.GroupShuffle = shuffle
+
+	return nil
+}
+
+// DisableGroupShuffling restores the logical order of the slots
+func (db *Database) DisableGroupShuffling() {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.GroupShuffle != nil {
+		db.Slots = db.GroupShuffle.unshuffle(db.Slots, db.Epoch)
+		db.Attributes = db.GroupShuffle.applyToAttributes(db.Attributes, db.Epoch, true)
+		db.GroupShuffle = nil
+	}
+}
+
+// GroupPosition returns the group (row) containing the slot at the logical index
+// and the position of the slot within the retrieved group
+func (dbmd *DBMetadata) GroupPosition(index, groupSize int) (int, int) {
+
+	row, offset := index/groupSize, index%groupSize
+
+	if dbmd.GroupShuffle == nil || dbmd.GroupShuffle.GroupSize != groupSize {
+		return row, offset
+	}
+
+	perm := dbmd.GroupShuffle.permutation(dbmd.Epoch, row, dbmd.groupLen(row, groupSize))
+	return row, perm[offset]
+}
+
+// storagePosition returns the position in storage of the slot at the logical index
+func (dbmd *DBMetadata) storagePosition(index int) int {
+
+	if dbmd.GroupShuffle == nil {
+		return index
+	}
+
+	row, offset := dbmd.GroupPosition(index, dbmd.GroupShuffle.GroupSize)
+	return row*dbmd.GroupShuffle.GroupSize + offset
+}
+
+// UnshuffleGroup returns the slots of the retrieved group (row) in logical order
+func (dbmd *DBMetadata) UnshuffleGroup(row, groupSize int, slots []*Slot) []*Slot {
+
+	if dbmd.GroupShuffle == nil || dbmd.GroupShuffle.GroupSize != groupSize {
+		return slots
+	}
+
+	n := dbmd.groupLen(row, groupSize)
+	perm := dbmd.GroupShuffle.permutation(dbmd.Epoch, row, n)
+
+	res := make([]*Slot, len(slots))
+	copy(res, slots)
+	for offset := 0; offset < n && perm[offset] < len(slots); offset++ {
+		res[offset] = slots[perm[offset]]
+	}
+
+	return res
+}
+
+// groupLen returns the number of slots in the group (the last group may be partial)
+func (dbmd *DBMetadata) groupLen(row, groupSize int) int {
+	n := dbmd.DBSize - row*groupSize
+	if n > groupSize {
+		n = groupSize
+	}
+	return n
+}
+
+func newGroupShuffle(groupSize int) (*GroupShuffle, error) {
+
+	key := make([]byte, GroupShuffleKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &GroupShuffle{GroupSize: groupSize, Key: key}, nil
+}
+
+// permutation returns perm where the slot at offset o of the group is stored at perm[o].
+// Fisher-Yates shuffle driven by SHA-256(key || epoch || row || i)
+func (gs *GroupShuffle) permutation(epoch, row, n int) []int {
+
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+
+	buf := make([]byte, len(gs.Key)+24)
+	copy(buf, gs.Key)
+	binary.BigEndian.PutUint64(buf[len(gs.Key):], uint64(epoch))
+	binary.BigEndian.PutUint64(buf[len(gs.Key)+8:], uint64(row))
+
+	for i := n - 1; i > 0; i-- {
+		binary.BigEndian.PutUint64(buf[len(gs.Key)+16:], uint64(i))
+		h := sha256.Sum256(buf)
+		j := int(binary.BigEndian.Uint64(h[:8]) % uint64(i+1))
+		perm[i], perm[j] = perm[j], perm[i]
+	}
+
+	return perm
+}
+
+// shuffle returns the slots (in logical order) arranged by the permutation
+func (gs *GroupShuffle) shuffle(slots []*Slot, epoch int) []*Slot {
+	return gs.apply(slots, epoch, false)
+}
+
+// unshuffle returns the shuffled slots in logical order
+func (gs *GroupShuffle) unshuffle(slots []*Slot, epoch int) []*Slot {
+	return gs.apply(slots, epoch, true)
+}
+
+func (gs *GroupShuffle) apply(slots []*Slot, epoch int, inverse bool) []*Slot {
+
+	res := make([]*Slot, len(slots))
+	for i, src := range gs.sources(len(slots), epoch, inverse) {
+		res[i] = slots[src]
+	}
+
+	return res
+}
+
+// applyToAttributes arranges the attributes of the slots like apply
+func (gs *GroupShuffle) applyToAttributes(attributes []uint64, epoch int, inverse bool) []uint64 {
+
+	if attributes == nil {
+		return nil
+	}
+
+	res := make([]uint64, len(attributes))
+	for i, src := range gs.sources(len(attributes), epoch, inverse) {
+		res[i] = attributes[src]
+	}
+
+	return res
+}
+
+// sources returns the position of the n inputs moved to each position of the result
+func (gs *GroupShuffle) sources(n, epoch int, inverse bool) []int {
+
+	res := make([]int, n)
+
+	for start := 0; start < n; start += gs.GroupSize {
+		size := n - start
+		if size > gs.GroupSize {
+			size = gs.GroupSize
+		}
+
+		perm := gs.permutation(epoch, start/gs.GroupSize, size)
+		for offset, pos := range perm {
+			if inverse {
+				res[start+offset] = start + pos
+			} else {
+				res[start+pos] = start + offset
+			}
+		}
+	}
+
+	return res
+}
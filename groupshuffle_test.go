@@ -0,0 +1,83 @@
+package pir
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestGroupShuffle' to see log outputs.
+func TestGroupShuffle(t *testing.T) {
+	setup()
+
+	groupSize := 4
+	db := GenerateRandomDB(TestDBSize+3, SlotBytes) // last group is partial
+	original := make([]*Slot, db.DBSize)
+	copy(original, db.Slots)
+
+	if err := db.ShuffleWithinGroups(groupSize); err != nil {
+		t.Fatal(err)
+	}
+
+	moved := 0
+	for i := range original {
+		if db.Slots[i] != original[i] {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("No slots were shuffled\n")
+	}
+
+	check := func(contents []*Slot) {
+		md := db.Metadata()
+		for i := 0; i < NumQueries/10; i++ {
+			index := rand.Intn(md.DBSize)
+			row, pos := md.GroupPosition(index, groupSize)
+
+			shares := md.NewIndexQueryShares(row, groupSize, 2)
+			resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := Recover([]*SecretSharedQueryResult{resA, resB})
+			if !contents[index].Equal(res[pos]) {
+				t.Fatalf("Query result is incorrect. %v != %v\n", contents[index], res[pos])
+			}
+
+			group := md.UnshuffleGroup(row, groupSize, res)
+			for j := 0; j < groupSize && row*groupSize+j < md.DBSize; j++ {
+				if !contents[row*groupSize+j].Equal(group[j]) {
+					t.Fatalf("Group is not in logical order. %v != %v\n", contents[row*groupSize+j], group[j])
+				}
+			}
+		}
+	}
+
+	check(original)
+
+	// swapping in new contents shuffles them with a fresh key
+	key := db.GroupShuffle.Key
+	newDB := GenerateRandomDB(TestDBSize, SlotBytes)
+	if err := db.SwapIn(newDB.Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.GroupShuffle == nil || bytes.Equal(key, db.GroupShuffle.Key) {
+		t.Fatalf("Key was not refreshed after swap\n")
+	}
+
+	check(newDB.Slots)
+
+	db.DisableGroupShuffling()
+	for i := range newDB.Slots {
+		if db.Slots[i] != newDB.Slots[i] {
+			t.Fatalf("Logical order not restored\n")
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package pir
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+ Offline/online queries with database hints.
+ A secret shared query makes every server scan the whole database since
+ the expanded DPF selects a pseudorandom half of the rows. Clients that
+ issue many queries against a static database can instead pay the scan
+ once, in an offline phase, and then have each query touch O(sqrt n)
+ slots (Corrigan-Gibbs and Kogan, Eurocrypt 2020; Zhou et al., S&P 2024).
+ The database is split into chunks of ChunkSize slots. A hint set holds
+ one pseudorandom slot of each chunk (derived from a seed) and its hint
+ is the xor of its slots. The offline server computes the hints of the
+ client's sets (see Preprocess): numSets = lambda * ChunkSize sets cover
+ each index with probability about 1 - e^-lambda. To retrieve index x
+ the client picks a set holding x and sends the offsets of the set in
+ each chunk to the online server with the offset of the chunk of x
+ replaced by a fresh random offset, so the offsets are uniformly random.
+ The server returns, for each chunk, the xor of the slots of the other
+ chunks (see AnswerHintQuery) and the slot is the hint xored with the
+ parity without the chunk of x. The used set is replaced by a fresh set
+ through the x chunk whose parity is retrieved from the offline server
+ in the same way (see HintTable.NewQuery), so a set is never used twice.
+ The servers must not collude. Hints are only valid for the contents
+ they were computed over: a new epoch is detected (ErrStaleLayout) but
+ in-place updates (see UpdateSlot) are not, so hints are for static
+ databases.
+*/
+
+// ErrNoHint is returned when no hint set holds the index (fetch new hints)
+var ErrNoHint = errors.New("no hint set holds the index")
+
+// hintSeedBytes is the size of the seed of a hint set
+const hintSeedBytes = aes.BlockSize
+
+// HintRequest asks the offline server for the hints of the sets of the seeds
+type HintRequest struct {
+	Seeds [][]byte
+
+	// fingerprint of the layout the request was generated for (see Layout)
+	LayoutFingerprint LayoutFingerprint
+}
+
+// HintResponse contains the hint (xor of the slots) of each set of a HintRequest
+type HintResponse struct {
+	Hints []*Slot
+}
+
+// HintQuery holds an offset within each chunk of the database
+type HintQuery struct {
+	Offsets []int
+
+	// fingerprint of the layout the query was generated for (see Layout)
+	LayoutFingerprint LayoutFingerprint
+}
+
+// HintQueryResult contains, for each chunk, the xor of the slots of the query
+// in the other chunks
+type HintQueryResult struct {
+	Parities []*Slot
+}
+
+// HintTable holds the hint sets of a client and their hints
+type HintTable struct {
+	dbmd        DBMetadata
+	fingerprint LayoutFingerprint
+	chunkSize   int
+	numChunks   int
+
+	sets  []*hintSet // nil once used (until replaced)
+	hints []*Slot
+}
+
+// PendingHintQuery is a query waiting for the results of the servers (see HintTable.Recover)
+type PendingHintQuery struct {
+	index int
+	set   int      // set used by the query
+	fresh *hintSet // set replacing it
+}
+
+// hintSet is a pseudorandom set with one slot per chunk, optionally
+// with the offset of one chunk set explicitly
+type hintSet struct {
+	seed  []byte
+	block cipher.Block
+
+	chunk  int // chunk with an explicit offset (-1 if none)
+	offset int
+}
+
+// HintChunks returns the size and the number of the chunks of hint sets
+func (dbmd *DBMetadata) HintChunks() (int, int) {
+
+	chunkSize := ceilSqrt(dbmd.DBSize)
+	if chunkSize < 1 {
+		chunkSize = 1
+	}
+
+	return chunkSize, ceilDiv(dbmd.DBSize, chunkSize)
+}
+
+// hintLayout returns the layout hint queries are generated for
+func (dbmd *DBMetadata) hintLayout() LayoutFingerprint {
+	return dbmd.SharedLayout(1).Fingerprint()
+}
+
+// NewHintTable generates numSets fresh hint sets and the request for their hints
+// to send to the offline server (see Preprocess and SetHints)
+func (dbmd *DBMetadata) NewHintTable(numSets int) (*HintTable, *HintRequest, error) {
+
+	if numSets <= 0 {
+		return nil, nil, errors.New("invalid number of hint sets")
+	}
+
+	chunkSize, numChunks := dbmd.HintChunks()
+
+	t := &HintTable{
+		dbmd:        *dbmd,
+		fingerprint: dbmd.hintLayout(),
+		chunkSize:   chunkSize,
+		numChunks:   numChunks,
+		sets:        make([]*hintSet, numSets),
+	}
+
+	req := &HintRequest{Seeds: make([][]byte, numSets), LayoutFingerprint: t.fingerprint}
+
+	for i := range t.sets {
+		set, err := newHintSet()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		t.sets[i] = set
+		req.Seeds[i] = set.seed
+	}
+
+	return t, req, nil
+}
+
+// SetHints stores the hints computed by the offline server
+func (t *HintTable) SetHints(res *HintResponse) error {
+
+	if len(res.Hints) != len(t.sets) {
+		return fmt.Errorf("expected %v hints, got %v", len(t.sets), len(res.Hints))
+	}
+
+	t.hints = res.Hints
+
+	return nil
+}
+
+// NumAvailable returns the number of hint sets that can be used
+func (t *HintTable) NumAvailable() int {
+
+	n := 0
+	for _, set := range t.sets {
+		if set != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// NewQuery returns the query for the slot at the logical index to send to the online
+// server and the query refreshing the used hint set to send to the offline server.
+// The hint set is used up even if the query fails. Returns ErrNoHint if no hint set
+// holds the index
+func (t *HintTable) NewQuery(index int) (*HintQuery, *HintQuery, *PendingHintQuery, error) {
+
+	if t.hints == nil {
+		return nil, nil, nil, errors.New("hints were not set")
+	}
+
+	if index < 0 || index >= t.dbmd.DBSize {
+		return nil, nil, nil, errors.New("index out of range")
+	}
+
+	chunk, offset := index/t.chunkSize, index%t.chunkSize
+
+	used := -1
+	for i, set := range t.sets {
+		if set != nil && set.offsetIn(chunk, t.chunkSize) == offset {
+			used = i
+			break
+		}
+	}
+
+	if used < 0 {
+		return nil, nil, nil, ErrNoHint
+	}
+
+	// the replacing set holds the index in the chunk of the index
+	fresh, err := newHintSet()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fresh.chunk, fresh.offset = chunk, offset
+
+	online := t.puncturedQuery(t.sets[used], chunk)
+	refresh := t.puncturedQuery(fresh, chunk)
+
+	t.sets[used] = nil
+
+	return online, refresh, &PendingHintQuery{index: index, set: used, fresh: fresh}, nil
+}
+
+// Recover returns the slot of the pending query from the results of the online server
+// and of the offline server and replaces the used hint set
+func (t *HintTable) Recover(p *PendingHintQuery, online, refresh *HintQueryResult) (*Slot, error) {
+
+	chunk := p.index / t.chunkSize
+	if len(online.Parities) != t.numChunks || len(refresh.Parities) != t.numChunks {
+		return nil, errors.New("invalid hint query results")
+	}
+
+	slot := NewSlot(append([]byte{}, t.hints[p.set].Data...))
+	XorSlots(slot, online.Parities[chunk])
+
+	hint := NewSlot(append([]byte{}, refresh.Parities[chunk].Data...))
+	XorSlots(hint, slot)
+
+	t.sets[p.set] = p.fresh
+	t.hints[p.set] = hint
+
+	return slot, nil
+}
+
+// puncturedQuery returns the offsets of the set with the offset of the chunk replaced
+// by a random offset
+func (t *HintTable) puncturedQuery(set *hintSet, chunk int) *HintQuery {
+
+	q := &HintQuery{Offsets: make([]int, t.numChunks), LayoutFingerprint: t.fingerprint}
+	for c := range q.Offsets {
+		q.Offsets[c] = set.offsetIn(c, t.chunkSize)
+	}
+
+	q.Offsets[chunk] = randomIntn(t.chunkSize)
+
+	return q
+}
+
+func newHintSet() (*hintSet, error) {
+
+	seed := make([]byte, hintSeedBytes)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+
+	return hintSetFromSeed(seed)
+}
+
+func hintSetFromSeed(seed []byte) (*hintSet, error) {
+
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hintSet{seed: seed, block: block, chunk: -1}, nil
+}
+
+// offsetIn returns the offset of the slot of the set in the chunk
+func (set *hintSet) offsetIn(chunk, chunkSize int) int {
+
+	if chunk == set.chunk {
+		return set.offset
+	}
+
+	var in, out [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(in[8:], uint64(chunk))
+	set.block.Encrypt(out[:], in[:])
+
+	return int(binary.BigEndian.Uint64(out[:8]) % uint64(chunkSize))
+}
+
+// Preprocess computes the hint of each set of the request (run by the offline server)
+func (db *Database) Preprocess(req *HintRequest, nprocs int) (*HintResponse, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := db.checkHintLayout(req.LayoutFingerprint); err != nil {
+		return nil, err
+	}
+
+	sets := make([]*hintSet, len(req.Seeds))
+	for i, seed := range req.Seeds {
+		if len(seed) != hintSeedBytes {
+			return nil, errors.New("invalid hint seed")
+		}
+
+		var err error
+		if sets[i], err = hintSetFromSeed(seed); err != nil {
+			return nil, err
+		}
+	}
+
+	chunkSize, numChunks := db.HintChunks()
+
+	res := &HintResponse{Hints: make([]*Slot, len(sets))}
+	err := parallelRanges(context.Background(), len(sets), nprocs, func(_, start, end int) error {
+		for i := start; i < end; i++ {
+			hint := NewEmptySlot(db.SlotBytes)
+			for c := 0; c < numChunks; c++ {
+				if slot := db.hintSlot(c*chunkSize + sets[i].offsetIn(c, chunkSize)); slot != nil {
+					XorSlots(hint, slot)
+				}
+			}
+			res.Hints[i] = hint
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// AnswerHintQuery returns, for each chunk, the xor of the slots at the offsets of the
+// query in the other chunks (run by the online and offline servers)
+func (db *Database) AnswerHintQuery(q *HintQuery) (*HintQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := db.checkHintLayout(q.LayoutFingerprint); err != nil {
+		return nil, err
+	}
+
+	chunkSize, numChunks := db.HintChunks()
+	if len(q.Offsets) != numChunks {
+		return nil, fmt.Errorf("expected %v offsets, got %v", numChunks, len(q.Offsets))
+	}
+
+	// prefix[c] is the xor of the slots of the chunks before c
+	prefix := make([]*Slot, numChunks+1)
+	prefix[0] = NewEmptySlot(db.SlotBytes)
+	for c, offset := range q.Offsets {
+		if offset < 0 || offset >= chunkSize {
+			return nil, errors.New("offset out of range")
+		}
+
+		prefix[c+1] = NewSlot(append([]byte{}, prefix[c].Data...))
+		if slot := db.hintSlot(c*chunkSize + offset); slot != nil {
+			XorSlots(prefix[c+1], slot)
+		}
+	}
+
+	// the parity without chunk c is the xor of all the slots and of the slot of chunk c
+	res := &HintQueryResult{Parities: make([]*Slot, numChunks)}
+	for c := range res.Parities {
+		res.Parities[c] = NewSlot(append([]byte{}, prefix[numChunks].Data...))
+		XorSlots(res.Parities[c], prefix[c])
+		XorSlots(res.Parities[c], prefix[c+1])
+	}
+
+	return res, nil
+}
+
+// hintSlot returns the slot at the logical index (nil past the end of the database)
+func (db *Database) hintSlot(index int) *Slot {
+
+	if index >= db.DBSize {
+		return nil
+	}
+
+	return db.Slots[db.storagePosition(index)]
+}
+
+// checkHintLayout returns ErrStaleLayout if the fingerprint is set and does not match
+func (db *Database) checkHintLayout(fingerprint LayoutFingerprint) error {
+
+	if !fingerprint.IsZero() && fingerprint != db.hintLayout() {
+		return ErrStaleLayout
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestHintQueries' to see log outputs.
+func TestHintQueries(t *testing.T) {
+	setup()
+
+	// the online and the offline server hold the same contents
+	slots := GenerateRandomDB(TestDBSize, SlotBytes).Slots
+	online, offline := NewDatabase(), NewDatabase()
+	for _, db := range []*Database{online, offline} {
+		if err := db.SwapIn(cloneSlots(slots)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbmd := online.Metadata()
+	chunkSize, numChunks := dbmd.HintChunks()
+	if chunkSize*numChunks < TestDBSize {
+		t.Fatalf("%v chunks of %v slots do not cover the database\n", numChunks, chunkSize)
+	}
+
+	// misses happen with probability about e^-8
+	table, req, err := dbmd.NewHintTable(8 * chunkSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := offline.Preprocess(req, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.SetHints(res); err != nil {
+		t.Fatal(err)
+	}
+
+	available := table.NumAvailable()
+
+	// repeated queries for the same index use the refreshed sets
+	indices := []int{0, TestDBSize - 1, 5, 5, 5}
+	for i := 0; i < 2*NumTrials; i++ {
+		indices = append(indices, rand.Intn(TestDBSize))
+	}
+
+	for _, index := range indices {
+		onlineQuery, refreshQuery, pending, err := table.NewQuery(index)
+		if err == ErrNoHint {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(onlineQuery.Offsets) != numChunks {
+			t.Fatalf("Query has %v offsets for %v chunks\n", len(onlineQuery.Offsets), numChunks)
+		}
+
+		onlineRes, err := online.AnswerHintQuery(onlineQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		refreshRes, err := offline.AnswerHintQuery(refreshQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slot, err := table.Recover(pending, onlineRes, refreshRes)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slot.Equal(online.Slots[index]) {
+			t.Fatalf("Incorrect slot at index %v: %v != %v\n", index, slot, online.Slots[index])
+		}
+	}
+
+	if table.NumAvailable() != available {
+		t.Fatalf("Used hint sets were not replaced\n")
+	}
+
+	// hints are for the contents they were computed over
+	if err := online.SwapIn(GenerateRandomDB(TestDBSize, SlotBytes).Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	onlineQuery, _, _, err := table.NewQuery(indices[0])
+	if err == ErrNoHint {
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := online.AnswerHintQuery(onlineQuery); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Stale hint query was not rejected: %v\n", err)
+	}
+}
@@ -0,0 +1,161 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+/*
+ Translation of logical IDs (UUIDs, content hashes, ...) to database indices.
+ The server publishes a minimal perfect hash of the IDs (hash-and-displace)
+ which maps each of the n IDs to a distinct index in [0, n) using ~1 byte per ID.
+ Clients evaluate it locally so that the mapping never goes stale and
+ no additional PIR round is needed to translate an ID.
+*/
+
+// idIndexBucketSize is the average number of IDs per bucket
+const idIndexBucketSize = 4
+
+// IDIndex is a minimal perfect hash from a set of logical IDs to [0, NumIDs).
+// IDs outside of the set are mapped to arbitrary indices; applications that
+// need to detect this should store the ID (or its hash) alongside the data
+type IDIndex struct {
+	NumIDs        int
+	Displacements []uint32 // one per bucket
+}
+
+// NewIDIndex builds an IDIndex for the set of ids
+func NewIDIndex(ids [][]byte) (*IDIndex, error) {
+
+	if len(ids) == 0 {
+		return nil, errors.New("no IDs provided")
+	}
+
+	numBuckets := (len(ids) + idIndexBucketSize - 1) / idIndexBucketSize
+
+	type hashedID struct {
+		h0, h1 uint64
+	}
+
+	buckets := make([][]hashedID, numBuckets)
+	seen := make(map[[sha256.Size]byte]bool, len(ids))
+	for _, id := range ids {
+		digest := sha256.Sum256(id)
+		if seen[digest] {
+			return nil, errors.New("duplicate ID")
+		}
+		seen[digest] = true
+
+		h0, h1 := idHash(digest)
+		b := h0 % uint64(numBuckets)
+		buckets[b] = append(buckets[b], hashedID{h0, h1})
+	}
+
+	// place the largest buckets first while most positions are free
+	order := make([]int, numBuckets)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(buckets[order[i]]) > len(buckets[order[j]])
+	})
+
+	idx := &IDIndex{
+		NumIDs:        len(ids),
+		Displacements: make([]uint32, numBuckets),
+	}
+
+	taken := make([]bool, len(ids))
+	positions := make([]int, 0, idIndexBucketSize)
+	for _, b := range order {
+		if len(buckets[b]) == 0 {
+			continue
+		}
+
+		placed := false
+		for d := uint64(0); d <= math.MaxUint32 && !placed; d++ {
+			positions = positions[:0]
+			placed = true
+			for _, h := range buckets[b] {
+				pos := idPosition(h.h1, uint32(d), len(ids))
+				if taken[pos] || containsInt(positions, pos) {
+					placed = false
+					break
+				}
+				positions = append(positions, pos)
+			}
+
+			if placed {
+				idx.Displacements[b] = uint32(d)
+				for _, pos := range positions {
+					taken[pos] = true
+				}
+			}
+		}
+
+		if !placed {
+			return nil, errors.New("failed to find a perfect hash for the IDs")
+		}
+	}
+
+	return idx, nil
+}
+
+// Index returns the database index of the id
+func (idx *IDIndex) Index(id []byte) int {
+	h0, h1 := idHash(sha256.Sum256(id))
+	b := h0 % uint64(len(idx.Displacements))
+	return idPosition(h1, idx.Displacements[b], idx.NumIDs)
+}
+
+// ArrangeSlots returns the slots ordered such that the slot
+// associated with ids[i] is at index Index(ids[i])
+func (idx *IDIndex) ArrangeSlots(ids [][]byte, slots []*Slot) ([]*Slot, error) {
+
+	if len(ids) != idx.NumIDs || len(slots) != idx.NumIDs {
+		return nil, errors.New("number of IDs and slots must match the index")
+	}
+
+	res := make([]*Slot, idx.NumIDs)
+	for i, id := range ids {
+		pos := idx.Index(id)
+		if res[pos] != nil {
+			return nil, errors.New("IDs do not match the index")
+		}
+		res[pos] = slots[i]
+	}
+
+	return res, nil
+}
+
+// NewIDQueryShares generates PIR query shares for the group containing the slot of id.
+// The slot is at position idx.Index(id) % groupSize of the recovered group
+func (dbmd *DBMetadata) NewIDQueryShares(idx *IDIndex, id []byte, groupSize int, numShares uint) []*QueryShare {
+	return dbmd.NewIndexQueryShares(idx.Index(id)/groupSize, groupSize, numShares)
+}
+
+// idHash derives the bucket hash and the position hash from the ID digest
+func idHash(digest [sha256.Size]byte) (uint64, uint64) {
+	return binary.BigEndian.Uint64(digest[0:8]), binary.BigEndian.Uint64(digest[8:16])
+}
+
+// idPosition mixes the position hash with the bucket displacement (splitmix64 finalizer)
+func idPosition(h uint64, d uint32, n int) int {
+	z := h + (uint64(d)+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return int(z % uint64(n))
+}
+
+func containsInt(s []int, x int) bool {
+	for _, v := range s {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package pir
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func generateIDs(n int) [][]byte {
+
+	ids := make([][]byte, n)
+	for i := range ids {
+		ids[i] = make([]byte, 16)
+		rand.Read(ids[i])
+	}
+
+	return ids
+}
+
+// run with 'go test -v -run TestIDIndex' to see log outputs.
+func TestIDIndex(t *testing.T) {
+
+	for _, n := range []int{1, 3, TestDBSize, TestDBSize + 7} {
+		ids := generateIDs(n)
+		idx, err := NewIDIndex(ids)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		used := make([]bool, n)
+		for _, id := range ids {
+			pos := idx.Index(id)
+			if pos < 0 || pos >= n || used[pos] {
+				t.Fatalf("ID mapped to invalid or duplicate index %v", pos)
+			}
+			used[pos] = true
+		}
+
+		t.Logf("%v IDs: %v bytes of displacements\n", n, 4*len(idx.Displacements))
+	}
+
+	ids := generateIDs(10)
+	ids[3] = ids[7]
+	if _, err := NewIDIndex(ids); err == nil {
+		t.Fatalf("Duplicate IDs were not rejected")
+	}
+}
+
+// run with 'go test -v -run TestIDQuery' to see log outputs.
+func TestIDQuery(t *testing.T) {
+	setup()
+
+	ids := generateIDs(TestDBSize)
+	original := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	idx, err := NewIDIndex(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := idx.ArrangeSlots(ids, original.Slots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDatabase()
+	db.Slots = slots
+	db.SlotBytes = SlotBytes
+	db.DBSize = len(slots)
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+		for i := 0; i < NumQueries; i++ {
+			j := i * (TestDBSize / NumQueries)
+			shares := db.NewIDQueryShares(idx, ids[j], groupSize, 2)
+
+			resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := Recover([]*SecretSharedQueryResult{resA, resB})
+			slot := res[idx.Index(ids[j])%groupSize]
+			if !slot.Equal(original.Slots[j]) {
+				t.Fatalf("Query result is incorrect. %v != %v\n", original.Slots[j], slot)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package pir
+
+import (
+	"math"
+	"math/bits"
+)
+
+/*
+ Exact integer helpers for layout computations.
+ Float conversions (e.g., uint(math.Log2(float64(n)) + 1)) round
+ unpredictably near powers of two, and the client and the server must
+ agree exactly on the dimensions of the database and on the domain of
+ the DPF keys. Compat.FloatLayoutMath selects the float versions of
+ bitLength and floorSqrt of earlier releases.
+*/
+
+// bitLength returns the number of bits needed to represent n (0 for n <= 0).
+// The DPF domain over the rows of a database of height h has bitLength(h) bits
+func bitLength(n int) uint {
+
+	if n <= 0 {
+		return 0
+	}
+
+	if CurrentCompat().FloatLayoutMath {
+		return uint(math.Log2(float64(n)) + 1)
+	}
+
+	return uint(bits.Len(uint(n)))
+}
+
+// ceilDiv returns ceil(a / b) for a >= 0 and b > 0
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// floorSqrt returns the largest integer r such that r*r <= n (0 for n <= 0)
+func floorSqrt(n int) int {
+
+	if n <= 0 {
+		return 0
+	}
+
+	if CurrentCompat().FloatLayoutMath {
+		return int(math.Sqrt(float64(n)))
+	}
+
+	// the float estimate is within one of the result; fix it up exactly
+	r := int(math.Sqrt(float64(n)))
+	for r > 0 && r > n/r {
+		r--
+	}
+	for r+1 <= n/(r+1) {
+		r++
+	}
+
+	return r
+}
+
+// ceilSqrt returns the smallest integer r such that r*r >= n (0 for n <= 0)
+func ceilSqrt(n int) int {
+
+	r := floorSqrt(n)
+	if r*r < n {
+		r++
+	}
+
+	return r
+}
+
+// nextPowerOfTwo returns the smallest power of two >= n (1 for n <= 1)
+func nextPowerOfTwo(n int) int {
+
+	if n <= 1 {
+		return 1
+	}
+
+	return 1 << bits.Len(uint(n-1))
+}
+
+// saturatingInt returns x as an int (math.MaxInt if x does not fit)
+func saturatingInt(x uint64) int {
+
+	if x > math.MaxInt {
+		return math.MaxInt
+	}
+
+	return int(x)
+}
+
+// ceilRoot returns the smallest integer r such that r^d >= n (0 for n <= 0, d >= 1)
+func ceilRoot(n, d int) int {
+
+	if n <= 0 {
+		return 0
+	}
+
+	// the float estimate is within one of the result; fix it up exactly
+	r := int(math.Ceil(math.Pow(float64(n), 1/float64(d))))
+	for r > 1 && powAtLeast(r-1, d, n) {
+		r--
+	}
+	for !powAtLeast(r, d, n) {
+		r++
+	}
+
+	return r
+}
+
+// powAtLeast reports whether r^d >= n without overflowing
+func powAtLeast(r, d, n int) bool {
+
+	p := 1
+	for i := 0; i < d; i++ {
+		if p >= ceilDiv(n, r) {
+			return true
+		}
+		p *= r
+	}
+
+	return p >= n
+}
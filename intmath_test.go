@@ -0,0 +1,98 @@
+package pir
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBitLength(t *testing.T) {
+
+	for k := uint(1); k < 63; k++ {
+		n := 1 << k
+
+		// heights around powers of two (where float rounding breaks)
+		if bitLength(n-1) != k || bitLength(n) != k+1 || bitLength(n+1) != k+1 {
+			t.Fatalf("Incorrect bit lengths around 2^%v: %v %v %v\n", k, bitLength(n-1), bitLength(n), bitLength(n+1))
+		}
+	}
+
+	if bitLength(0) != 0 || bitLength(1) != 1 {
+		t.Fatalf("Incorrect bit lengths for 0 and 1")
+	}
+}
+
+func TestIntegerSqrt(t *testing.T) {
+
+	for k := 2; k < 31; k++ {
+		r := 1 << k
+		n := r * r
+
+		if floorSqrt(n-1) != r-1 || floorSqrt(n) != r || floorSqrt(n+1) != r {
+			t.Fatalf("Incorrect floor sqrt around %v\n", n)
+		}
+
+		if ceilSqrt(n-1) != r || ceilSqrt(n) != r || ceilSqrt(n+1) != r+1 {
+			t.Fatalf("Incorrect ceil sqrt around %v\n", n)
+		}
+
+		if nextPowerOfTwo(r-1) != r || nextPowerOfTwo(r) != r || nextPowerOfTwo(r+1) != 2*r {
+			t.Fatalf("Incorrect next power of two around %v\n", r)
+		}
+	}
+
+	// float64 cannot represent the square
+	r := 3037000499
+	if floorSqrt(r*r) != r || floorSqrt(math.MaxInt64) != r || ceilSqrt(r*r+1) != r+1 {
+		t.Fatalf("Incorrect sqrt of large values")
+	}
+
+	if ceilDiv(0, 3) != 0 || ceilDiv(6, 3) != 2 || ceilDiv(7, 3) != 3 {
+		t.Fatalf("Incorrect ceil division")
+	}
+}
+
+// run with 'go test -v -run TestSharedQueryPowerOfTwoHeights' to see log outputs.
+func TestSharedQueryPowerOfTwoHeights(t *testing.T) {
+	setup()
+
+	for k := uint(1); k < 10; k++ {
+		for _, height := range []int{1<<k - 1, 1 << k, 1<<k + 1} {
+			db := GenerateRandomDB(height, SlotBytes)
+
+			// the last row is the one that needs the top bit
+			for _, index := range []int{0, height - 1} {
+				for _, variant := range []KeyVariant{KeyPayloadInLeaf, KeyEarlyTermination} {
+					shares := db.NewIndexQuerySharesWithKeyVariant(index, 1, variant, 3)
+
+					if uint(len(shares[0].KeyTwoParty.CW))+shares[0].KeyTwoParty.Gamma != bitLength(height) {
+						t.Fatalf("Key for height %v does not have %v levels\n", height, bitLength(height))
+					}
+
+					res := make([]*SecretSharedQueryResult, 2)
+					for i, share := range shares {
+						var err error
+						if res[i], err = db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					if !Recover(res)[0].Equal(db.Slots[index]) {
+						t.Fatalf("Query for %v with height %v is incorrect\n", index, height)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCeilRoot(t *testing.T) {
+
+	for n := 0; n < 2000; n++ {
+		for d := 1; d <= 5; d++ {
+			r := ceilRoot(n, d)
+			if n > 0 && (!powAtLeast(r, d, n) || (r > 1 && powAtLeast(r-1, d, n))) {
+				t.Fatalf("ceilRoot(%v, %v) = %v\n", n, d, r)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Public key pinning of encrypted results.
+ Decrypting a result under the wrong secret key does not fail, it returns
+ garbage slots, which is easy to hit for clients that hold several keys
+ (e.g., one per server or a rotated key). Servers include the fingerprint
+ of the public key of the query in encrypted results (see
+ PublicKeyFingerprint) and RecoverEncrypted and RecoverDoublyEncrypted
+ check it against the secret key before decrypting. Results without a
+ fingerprint (from older servers) are not checked.
+*/
+
+// ErrWrongKey is matched (using errors.Is) by the error returned when a result
+// is decrypted with a secret key other than the one of its query.
+// The error is a *WrongKeyError
+var ErrWrongKey = errors.New("result was encrypted under a different public key")
+
+// KeyFingerprint identifies a public key (see PublicKeyFingerprint)
+type KeyFingerprint [sha256.Size]byte
+
+// IsZero returns true if the fingerprint is not set
+func (fp KeyFingerprint) IsZero() bool {
+	return fp == KeyFingerprint{}
+}
+
+// WrongKeyError holds the fingerprints of the key of the result and of the secret key
+type WrongKeyError struct {
+	Result KeyFingerprint
+	Key    KeyFingerprint
+}
+
+func (e *WrongKeyError) Error() string {
+	return fmt.Sprintf("%v (result key %x, secret key %x)", ErrWrongKey, e.Result[:8], e.Key[:8])
+}
+
+// Is reports whether target is ErrWrongKey
+func (e *WrongKeyError) Is(target error) bool {
+	return target == ErrWrongKey
+}
+
+// checkResultKey returns a *WrongKeyError if the fingerprint is set and is not the
+// fingerprint of the public key of sk
+func checkResultKey(fingerprint KeyFingerprint, sk *paillier.SecretKey) error {
+
+	if fingerprint.IsZero() {
+		return nil
+	}
+
+	if key := PublicKeyFingerprint(&sk.PublicKey); key != fingerprint {
+		return &WrongKeyError{Result: fingerprint, Key: key}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// recoverEncrypted is RecoverEncrypted failing the test on error
+func recoverEncrypted(t testing.TB, res *EncryptedQueryResult, sk *paillier.SecretKey) []*Slot {
+	t.Helper()
+
+	slots, err := RecoverEncrypted(res, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return slots
+}
+
+// recoverDoublyEncrypted is RecoverDoublyEncrypted failing the test on error
+func recoverDoublyEncrypted(t testing.TB, res *DoublyEncryptedQueryResult, sk *paillier.SecretKey) []*Slot {
+	t.Helper()
+
+	slots, err := RecoverDoublyEncrypted(res, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return slots
+}
+
+func TestResultKeyPinning(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	sk, pk := paillier.KeyGen(1024)
+	otherSK, _ := paillier.KeyGen(1024)
+
+	query := db.NewEncryptedQuery(pk, 1, 0)
+	res, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.KeyFingerprint != PublicKeyFingerprint(pk) {
+		t.Fatalf("result does not hold the fingerprint of the key of the query")
+	}
+
+	if _, err := RecoverEncrypted(res, otherSK); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+
+	// the fingerprint survives encoding
+	b, err := res.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &EncryptedQueryResult{}
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	var wrongKey *WrongKeyError
+	if _, _, err := db.RecoverEncryptedGroup(decoded, otherSK, 0); !errors.As(err, &wrongKey) {
+		t.Fatalf("expected a *WrongKeyError, got %v", err)
+	}
+
+	if slots := recoverEncrypted(t, decoded, sk); !slots[0].Equal(db.Slots[0]) {
+		t.Fatalf("slot recovered incorrectly")
+	}
+
+	// doubly encrypted results are checked too
+	dquery := db.NewDoublyEncryptedQuery(pk, 1, 0)
+	dres, err := db.PrivateDoublyEncryptedQuery(dquery, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RecoverDoublyEncrypted(dres, otherSK); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+
+	// results without a fingerprint (from older servers) are still recovered
+	res.KeyFingerprint = KeyFingerprint{}
+	if slots := recoverEncrypted(t, res, sk); !slots[0].Equal(db.Slots[0]) {
+		t.Fatalf("slot recovered incorrectly")
+	}
+}
@@ -0,0 +1,306 @@
+package pir
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	mrand "math/rand"
+	"sort"
+)
+
+/*
+ Key-value PIR using cuckoo hashing.
+ Keyword queries (see SetKeywords) match integer keywords using FSS and
+ PrivateSqrtST needs two rounds. BuildForKeyValueData instead places the
+ entries of a map with arbitrary byte-string keys in KeyValueNumTables
+ cuckoo hash tables stored one after the other in the database: each key
+ has one candidate position per table (derived from the key and the seed
+ published in the metadata, see KeyValueLayout) and each entry is stored
+ at one of the candidate positions of its key. A client retrieves the
+ value of a key in one round by querying all the candidate positions
+ (see NewKeyValueQueryShares) and keeps the slot tagged with a hash of
+ the key. Each slot holds the tag and the length-prefixed value, so
+ SlotBytes = keyValueTagBytes + 4 + the size of the largest value.
+ The layout depends on the contents, so the database cannot be changed
+ incrementally (see ErrFixedLayout).
+*/
+
+// KeyValueNumTables is the number of cuckoo hash tables (candidate positions per key)
+const KeyValueNumTables = 3
+
+// keyValueLoadFactor is the fraction of the positions of the tables holding an entry
+const keyValueLoadFactor = 0.75
+
+// keyValueTagBytes is the size of the tag identifying the key of a slot
+const keyValueTagBytes = 16
+
+// keyValueSeedBytes is the size of the seed of the hash functions
+const keyValueSeedBytes = 16
+
+// maxKeyValueEvictions bounds the number of cuckoo evictions per entry
+const maxKeyValueEvictions = 1000
+
+// maxKeyValueAttempts is the number of seeds tried before giving up
+const maxKeyValueAttempts = 10
+
+// KeyValueLayout describes the cuckoo hash tables of a key-value database
+type KeyValueLayout struct {
+	NumTables int
+	TableSize int    // number of positions of each table
+	Seed      []byte // seed of the hash functions
+}
+
+// KeyValueQueryShare is a share of a query for the value of a key:
+// one index query share per candidate position
+type KeyValueQueryShare struct {
+	Queries []*QueryShare
+}
+
+// KeyValueQueryResult contains the result shares of each candidate position
+type KeyValueQueryResult struct {
+	Results []*SecretSharedQueryResult
+}
+
+// BuildForKeyValueData builds a database holding the entries of data
+// placed in cuckoo hash tables (see KeyValueLayout)
+func (db *Database) BuildForKeyValueData(data map[string][]byte) error {
+	_, err := db.buildForKeyValueData(data)
+	return err
+}
+
+// buildForKeyValueData builds the key-value database and returns the position of each key
+func (db *Database) buildForKeyValueData(data map[string][]byte) (map[string]int, error) {
+
+	if len(data) == 0 {
+		return nil, errors.New("no entries provided")
+	}
+
+	keys := make([]string, 0, len(data))
+	maxValueBytes := 0
+	for key, value := range data {
+		keys = append(keys, key)
+		if len(value) > maxValueBytes {
+			maxValueBytes = len(value)
+		}
+	}
+
+	// placement only depends on the seed and the keys
+	sort.Strings(keys)
+
+	numPositions := int(float64(len(keys))/keyValueLoadFactor) + 1
+	layout := &KeyValueLayout{
+		NumTables: KeyValueNumTables,
+		TableSize: ceilDiv(numPositions, KeyValueNumTables),
+	}
+
+	var positions map[string]int
+	for attempt := 0; attempt < maxKeyValueAttempts && positions == nil; attempt++ {
+		layout.Seed = make([]byte, keyValueSeedBytes)
+		if _, err := rand.Read(layout.Seed); err != nil {
+			return nil, err
+		}
+
+		positions = layout.place(keys)
+	}
+
+	if positions == nil {
+		return nil, errors.New("failed to place the entries in the hash tables")
+	}
+
+	slotBytes := keyValueTagBytes + 4 + maxValueBytes
+	slots := layout.encodeEntries(data, positions, slotBytes)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.Slots = slots
+	db.SlotBytes = slotBytes
+	db.DBSize = len(slots)
+	db.KeyValue = layout
+	db.records = nil
+
+	return positions, nil
+}
+
+// encodeEntries returns the slots of the tables holding the entries of data at their positions
+func (layout *KeyValueLayout) encodeEntries(data map[string][]byte, positions map[string]int, slotBytes int) []*Slot {
+
+	slots := make([]*Slot, layout.NumTables*layout.TableSize)
+	for i := range slots {
+		slots[i] = NewEmptySlot(slotBytes)
+	}
+
+	for key, pos := range positions {
+		value := data[key]
+		slot := slots[pos].Data
+		copy(slot, layout.tag(key))
+		binary.BigEndian.PutUint32(slot[keyValueTagBytes:], uint32(len(value)))
+		copy(slot[keyValueTagBytes+4:], value)
+	}
+
+	return slots
+}
+
+// NewKeyValueQueryShares generates PIR query shares for the value of key
+// (one query share per candidate position of the key)
+func (dbmd *DBMetadata) NewKeyValueQueryShares(key string, numShares uint) ([]*KeyValueQueryShare, error) {
+
+	if dbmd.KeyValue == nil {
+		return nil, errors.New("database is not a key-value database")
+	}
+
+	shares := make([]*KeyValueQueryShare, numShares)
+	for i := range shares {
+		shares[i] = &KeyValueQueryShare{}
+	}
+
+	for _, pos := range dbmd.KeyValue.candidates(key) {
+		for i, share := range dbmd.NewIndexQueryShares(dbmd.storagePosition(pos), 1, numShares) {
+			shares[i].Queries = append(shares[i].Queries, share)
+		}
+	}
+
+	return shares, nil
+}
+
+// PrivateSecretSharedKeyValueQuery answers the query share of each candidate position
+func (db *Database) PrivateSecretSharedKeyValueQuery(query *KeyValueQueryShare, nprocs int) (*KeyValueQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.KeyValue == nil || len(query.Queries) != db.KeyValue.NumTables {
+		return nil, errors.New("query does not match the key-value layout")
+	}
+
+	res := &KeyValueQueryResult{Results: make([]*SecretSharedQueryResult, len(query.Queries))}
+	for i, q := range query.Queries {
+		if q == nil || q.IsKeywordBased || q.GroupSize != 1 {
+			return nil, errors.New("query does not match the key-value layout")
+		}
+
+		var err error
+		if res.Results[i], err = db.privateSecretSharedQuery(q, nprocs); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+// RecoverKeyValue returns the value of key from the result shares
+// or ErrKeyNotFound if the key is not in the database
+func (dbmd *DBMetadata) RecoverKeyValue(key string, resShares []*KeyValueQueryResult) ([]byte, error) {
+
+	if dbmd.KeyValue == nil || len(resShares) == 0 {
+		return nil, errors.New("invalid key-value query results")
+	}
+
+	tag := dbmd.KeyValue.tag(key)
+
+	for i := 0; i < dbmd.KeyValue.NumTables; i++ {
+		shares := make([]*SecretSharedQueryResult, len(resShares))
+		for s, res := range resShares {
+			if len(res.Results) != dbmd.KeyValue.NumTables {
+				return nil, errors.New("invalid key-value query results")
+			}
+			shares[s] = res.Results[i]
+		}
+
+		slot := Recover(shares)[0].Data
+		if len(slot) < keyValueTagBytes+4 || string(slot[:keyValueTagBytes]) != string(tag) {
+			continue
+		}
+
+		n := int(binary.BigEndian.Uint32(slot[keyValueTagBytes:]))
+		if n > len(slot)-keyValueTagBytes-4 {
+			return nil, errors.New("invalid key-value slot")
+		}
+
+		value := make([]byte, n)
+		copy(value, slot[keyValueTagBytes+4:])
+
+		return value, nil
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// candidates returns the position of the key in each table
+func (layout *KeyValueLayout) candidates(key string) []int {
+
+	positions := make([]int, layout.NumTables)
+	for i := range positions {
+		digest := layout.hash(byte(i), key)
+		h := binary.BigEndian.Uint64(digest[:8])
+		positions[i] = i*layout.TableSize + int(h%uint64(layout.TableSize))
+	}
+
+	return positions
+}
+
+// tag returns the tag stored with the value of key
+func (layout *KeyValueLayout) tag(key string) []byte {
+	digest := layout.hash(0xff, key)
+	return digest[:keyValueTagBytes]
+}
+
+// hash hashes the seed, the domain separator and the key
+func (layout *KeyValueLayout) hash(domain byte, key string) [sha256.Size]byte {
+
+	h := sha256.New()
+	h.Write(layout.Seed)
+	h.Write([]byte{domain})
+	h.Write([]byte(key))
+
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+
+	return digest
+}
+
+// place assigns a distinct candidate position to each key (cuckoo hashing with random walks)
+// and returns nil if the keys cannot be placed
+func (layout *KeyValueLayout) place(keys []string) map[string]int {
+
+	positions := make(map[string]int, len(keys))
+	occupant := make(map[int]string, len(keys))
+
+	for _, key := range keys {
+		if !layout.insert(key, positions, occupant) {
+			return nil
+		}
+	}
+
+	return positions
+}
+
+// insert places the key at a free candidate position, evicting the keys in the way,
+// and returns false if some key is left without a position
+func (layout *KeyValueLayout) insert(key string, positions map[string]int, occupant map[int]string) bool {
+
+	current := key
+
+	for evictions := 0; evictions < maxKeyValueEvictions; evictions++ {
+		candidates := layout.candidates(current)
+
+		for _, pos := range candidates {
+			if _, ok := occupant[pos]; !ok {
+				occupant[pos] = current
+				positions[current] = pos
+				return true
+			}
+		}
+
+		// evict the occupant of a random candidate position
+		pos := candidates[mrand.Intn(len(candidates))]
+		evicted := occupant[pos]
+		occupant[pos] = current
+		positions[current] = pos
+		delete(positions, evicted)
+		current = evicted
+	}
+
+	return false
+}
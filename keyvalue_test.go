@@ -0,0 +1,80 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// retrieveKeyValue retrieves the value of key using numShares query shares
+func retrieveKeyValue(t *testing.T, db *Database, key string, numShares uint) ([]byte, error) {
+
+	md := db.Metadata()
+	shares, err := md.NewKeyValueQueryShares(key, numShares)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := make([]*KeyValueQueryResult, numShares)
+	for s := range shares {
+		if results[s], err = db.PrivateSecretSharedKeyValueQuery(shares[s], NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return md.RecoverKeyValue(key, results)
+}
+
+// run with 'go test -v -run TestKeyValue' to see log outputs.
+func TestKeyValue(t *testing.T) {
+	setup()
+
+	data := make(map[string][]byte)
+	for i := 0; i < TestDBSize; i++ {
+		value := make([]byte, rand.Intn(SlotBytes+1))
+		rand.Read(value)
+		data[fmt.Sprintf("key/%v", i)] = value
+	}
+	data[""] = []byte("empty key")
+	data["\x00\xff binary"] = nil
+
+	db := NewDatabase()
+	if err := db.BuildForKeyValueData(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.DBSize < len(data) || db.KeyValue == nil {
+		t.Fatalf("Database has %v slots for %v entries\n", db.DBSize, len(data))
+	}
+
+	for _, key := range []string{"key/0", "key/17", "", "\x00\xff binary"} {
+		for _, numShares := range []uint{2, 3} {
+			value, err := retrieveKeyValue(t, db, key, numShares)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(value) != string(data[key]) {
+				t.Fatalf("Value of %q is incorrect. %v != %v\n", key, data[key], value)
+			}
+		}
+	}
+
+	if _, err := retrieveKeyValue(t, db, "missing", 2); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Expected ErrKeyNotFound, got %v\n", err)
+	}
+
+	// the candidate positions are stored in shuffled order
+	if err := db.ShuffleWithinGroups(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, err := retrieveKeyValue(t, db, "key/3", 2); err != nil || string(value) != string(data["key/3"]) {
+		t.Fatalf("Value is incorrect after shuffling: %v\n", err)
+	}
+
+	if err := db.UpdateSlot(0, nil); !errors.Is(err, ErrFixedLayout) {
+		t.Fatalf("Expected ErrFixedLayout, got %v\n", err)
+	}
+}
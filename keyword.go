@@ -2,11 +2,20 @@ package pir
 
 import (
 	"errors"
-	"math"
+
+	"github.com/sachaservan/paillier"
 )
 
 // padding value to encode when formatting the database for PIR
-const padding = string(0)
+const padding = "\x00"
+
+// ErrKeyNotFound is returned when a key is not in a PrivateSqrtST
+// (including when the key matches a padding slot)
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrNotKeywordLayer is returned when a keyword based encrypted query is answered
+// by a database that is not the second layer of a PrivateSqrtST
+var ErrNotKeywordLayer = errors.New("database is not the second layer of a search tree")
 
 // PrivateSqrtST is a search tree structure with sqrt nodes per layer.
 // Requires 1 PIR query to get the index
@@ -17,7 +26,8 @@ const padding = string(0)
 type PrivateSqrtST struct {
 	FirstLayer  []string
 	SecondLayer *Database
-	NumKeys     int
+	NumKeys     int // including padding
+	NumPadding  int // number of padding keys (at the end of the data)
 	SlotBytes   int
 	Width       int
 	Height      int
@@ -30,11 +40,23 @@ func NewPrivateSqrtST() *PrivateSqrtST {
 
 // BuildForData first generates a PrivateSqrtST for the data
 // and then converts one layer into a PIR database
-// with optimal width/height
+// with optimal width/height. Use BuildForDataWithPadding for padded data
 func (sqst *PrivateSqrtST) BuildForData(data []string) error {
+	return sqst.BuildForDataWithPadding(data, 0)
+}
+
+// BuildForDataWithPadding is BuildForData for data whose last numPadding values are
+// padding (e.g., the number of padding values returned by PadBytesToSqrt).
+// Padding is identified by its position rather than its value so that real keys
+// encoded like padding (e.g., "\x00") are still found (see FindIndex)
+func (sqst *PrivateSqrtST) BuildForDataWithPadding(data []string, numPadding int) error {
+
+	if numPadding < 0 || numPadding > len(data) {
+		return errors.New("invalid number of padding values")
+	}
 
 	// check if the data size has an integer sqrt and make it so if not
-	if math.Sqrt(float64(len(data))) != math.Floor(math.Sqrt(float64(len(data)))) {
+	if sqrtDim := floorSqrt(len(data)); sqrtDim*sqrtDim != len(data) {
 		return errors.New("length of data is not a perfect square")
 	}
 
@@ -48,7 +70,7 @@ func (sqst *PrivateSqrtST) BuildForData(data []string) error {
 		}
 	}
 
-	sqrtDim := int(math.Sqrt(float64(len(data))))
+	sqrtDim := floorSqrt(len(data))
 
 	firstLayeBoundries := make([]string, 0)
 	for i := sqrtDim; i < len(data); i += sqrtDim {
@@ -61,11 +83,14 @@ func (sqst *PrivateSqrtST) BuildForData(data []string) error {
 	db := NewDatabase()
 	slotSize := GetRequiredSlotSize(data)
 	db.BuildForDataWithSlotSize(data, slotSize)
+	db.keywordLayer = true
 
 	sqst.FirstLayer = firstLayeBoundries
 	sqst.SecondLayer = db
 	sqst.SlotBytes = slotBytes
 	sqst.NumKeys = len(data)
+	sqst.NumPadding = numPadding
+	db.NumPaddingSlots = numPadding
 	sqst.Width = sqrtDim
 	sqst.Height = sqrtDim
 
@@ -88,18 +113,68 @@ func (sqst *PrivateSqrtST) PrivateEncryptedQuery(
 	return sqst.SecondLayer.PrivateEncryptedQuery(query, nprocs)
 }
 
+// NewEncryptedKeywordQuery generates an encrypted query for the row of the second layer
+// that contains key and returns it along with the row index. Use FindIndex on the slots
+// recovered from the result (see RecoverEncrypted) to find the index of the key
+func (sqst *PrivateSqrtST) NewEncryptedKeywordQuery(pk *paillier.PublicKey, key string) (*EncryptedQuery, int) {
+
+	rowIndex := sqst.RowForKey(key)
+
+	md := sqst.GetSecondLayerMetadata()
+	query := md.NewEncryptedQueryWithDimentions(pk, sqst.Width, sqst.Height, 1, rowIndex)
+	query.IsKeywordBased = true
+
+	return query, rowIndex
+}
+
+// RowForKey returns the row of the second layer that contains key
+func (sqst *PrivateSqrtST) RowForKey(key string) int {
+
+	rowIndex := 0
+	for i, boundry := range sqst.FirstLayer {
+		rowIndex = i
+		if key > boundry {
+			break
+		}
+	}
+
+	return rowIndex
+}
+
+// FindIndex returns the index of key given the slots recovered for rowIndex
+// of the second layer or ErrKeyNotFound if the key is not in the data
+func (sqst *PrivateSqrtST) FindIndex(key string, rowIndex int, res []*Slot) (int, error) {
+
+	md := sqst.GetSecondLayerMetadata()
+	query := NewSlotFromString(key, md.SlotBytes)
+
+	colIndex := 0
+	for i, slot := range res {
+		colIndex = i
+		if slot.Compare(query) <= 0 {
+			break
+		}
+	}
+
+	index := rowIndex*sqst.Width + colIndex
+	if md.IsPaddingSlot(index) || !res[colIndex].Equal(query) {
+		return -1, ErrKeyNotFound
+	}
+
+	return index, nil
+}
+
 // GetSecondLayerMetadata returns the metadata for PIR database of the second layer
 func (sqst *PrivateSqrtST) GetSecondLayerMetadata() *DBMetadata {
-	return &DBMetadata{
-		sqst.SecondLayer.SlotBytes,
-		sqst.SecondLayer.DBSize,
-	}
+	md := sqst.SecondLayer.Metadata()
+	return &md
 }
 
 // PadToPowerOf2 pads the data to a power of 2
+// note: use PadBytesToPowerOf2 for data that may contain the padding value
 func PadToPowerOf2(data []string) []string {
 
-	nextPower := int(math.Pow(2, math.Ceil(math.Log2(float64(len(data))))))
+	nextPower := nextPowerOfTwo(len(data))
 	newdata := make([]string, nextPower)
 	for i := 0; i < nextPower; i++ {
 		if i < len(data) {
@@ -113,9 +188,11 @@ func PadToPowerOf2(data []string) []string {
 }
 
 // PadToSqrt pads the data such that sqrt(N) is an sinteger
+// note: the padding values are the last len(result) - len(data) values
+// (see BuildForDataWithPadding); use PadBytesToSqrt for non-string data
 func PadToSqrt(data []string) []string {
 
-	nextSqrt := int(math.Ceil(math.Sqrt(float64(len(data)))))
+	nextSqrt := ceilSqrt(len(data))
 	nextSqrt = nextSqrt * nextSqrt
 
 	newdata := make([]string, nextSqrt)
@@ -129,3 +206,37 @@ func PadToSqrt(data []string) []string {
 
 	return newdata
 }
+
+// PadBytesToPowerOf2 pads the data to a power of 2 with empty values
+// and returns the padded data along with the number of padding values.
+// Padding is identified by its position (see DBMetadata.NumPaddingSlots)
+// rather than its value so that it cannot collide with real data
+func PadBytesToPowerOf2(data [][]byte) ([][]byte, int) {
+
+	nextPower := 1
+	for nextPower < len(data) {
+		nextPower *= 2
+	}
+
+	return padBytes(data, nextPower)
+}
+
+// PadBytesToSqrt pads the data with empty values such that sqrt(N) is an integer
+// and returns the padded data along with the number of padding values (see PadBytesToPowerOf2)
+func PadBytesToSqrt(data [][]byte) ([][]byte, int) {
+
+	nextSqrt := ceilSqrt(len(data))
+
+	return padBytes(data, nextSqrt*nextSqrt)
+}
+
+func padBytes(data [][]byte, size int) ([][]byte, int) {
+
+	newdata := make([][]byte, size)
+	copy(newdata, data)
+	for i := len(data); i < size; i++ {
+		newdata[i] = []byte{}
+	}
+
+	return newdata, size - len(data)
+}
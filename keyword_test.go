@@ -7,6 +7,8 @@ import (
 	"sort"
 	"strconv"
 	"testing"
+
+	"github.com/sachaservan/paillier"
 )
 
 const NumTrials int = 10 // number of times to run some of the tests
@@ -37,31 +39,23 @@ func TestKeywordQuerySqrtST(t *testing.T) {
 		t.Logf("[Test]: data size %v\n", len(data))
 
 		sqst := NewPrivateSqrtST()
-		err := sqst.BuildForData(data)
+		err := sqst.BuildForDataWithPadding(data, len(data)-numStrings)
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		var res []*Slot
 
-		for i := 0; i < len(data); i++ {
-
-			query := NewSlotFromString(data[i], sqst.SlotBytes)
+		if int(math.Ceil(math.Sqrt(float64(len(data))))) != len(sqst.FirstLayer) {
+			t.Fatalf("First layer does not have the correct size. Expected: %v Actual %v\n",
+				int(math.Sqrt(float64(len(data)))),
+				len(sqst.FirstLayer),
+			)
+		}
 
-			if int(math.Ceil(math.Sqrt(float64(len(data))))) != len(sqst.FirstLayer) {
-				t.Fatalf("First layer does not have the correct size. Expected: %v Actual %v\n",
-					int(math.Sqrt(float64(len(data)))),
-					len(sqst.FirstLayer),
-				)
-			}
+		for i := 0; i < len(data); i++ {
 
-			boundry := ""
-			rowIndex := 0
-			for rowIndex, boundry = range sqst.FirstLayer {
-				if data[i] > boundry {
-					break
-				}
-			}
+			rowIndex := sqst.RowForKey(data[i])
 
 			shares := sqst.SecondLayer.NewIndexQueryShares(rowIndex, sqst.Height, 2)
 
@@ -84,15 +78,19 @@ func TestKeywordQuerySqrtST(t *testing.T) {
 				)
 			}
 
-			colIndex := 0
-			var slot *Slot
-			for colIndex, slot = range res {
-				if slot.Compare(query) <= 0 {
-					break
+			index, err := sqst.FindIndex(data[i], rowIndex, res)
+
+			// padding is never found
+			if data[i] == padding {
+				if err != ErrKeyNotFound {
+					t.Fatalf("Padding key was found at index %v\n", index)
 				}
+				continue
 			}
 
-			index := rowIndex*sqst.Width + colIndex
+			if err != nil {
+				t.Fatalf("Key %v not found; expected index %v\n", data[i], i)
+			}
 
 			if index != i && data[index] != data[i] {
 				t.Fatalf("Incorrect index %v, expected %v; Data at index %v, expected data %v\n", index, i, data[index], data[i])
@@ -100,3 +98,138 @@ func TestKeywordQuerySqrtST(t *testing.T) {
 		}
 	}
 }
+
+// run with 'go test -v -run TestEncryptedKeywordQuerySqrtST' to see log outputs.
+func TestEncryptedKeywordQuerySqrtST(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	numStrings := rand.Intn(1<<8) + 100
+	data := PadToSqrt(generateStringsInSequence(numStrings))
+	sort.Strings(data)
+	argsort.ReverseStrings(data)
+
+	sqst := NewPrivateSqrtST()
+	if err := sqst.BuildForDataWithPadding(data, len(data)-numStrings); err != nil {
+		t.Fatal(err)
+	}
+
+	for trial := 0; trial < NumTrials; trial++ {
+		i := rand.Intn(len(data))
+
+		query, rowIndex := sqst.NewEncryptedKeywordQuery(pk, data[i])
+
+		res, err := sqst.PrivateEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		index, err := sqst.FindIndex(data[i], rowIndex, recoverEncrypted(t, res, sk))
+
+		// padding is never found
+		if data[i] == padding {
+			if err != ErrKeyNotFound {
+				t.Fatalf("Padding key was found at index %v\n", index)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Key %v not found; expected index %v\n", data[i], i)
+		}
+
+		if data[index] != data[i] {
+			t.Fatalf("Incorrect index %v, expected %v\n", index, i)
+		}
+	}
+
+	// keys that are not in the data
+	query, rowIndex := sqst.NewEncryptedKeywordQuery(pk, "missing")
+	res, err := sqst.PrivateEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sqst.FindIndex("missing", rowIndex, recoverEncrypted(t, res, sk)); err != ErrKeyNotFound {
+		t.Fatalf("Missing key was found")
+	}
+
+	// keyword queries are only answered by the second layer
+	db := GenerateRandomDB(len(data), SlotBytes)
+	if _, err := db.PrivateEncryptedQuery(query, NumProcsForQuery); err != ErrNotKeywordLayer {
+		t.Fatalf("Expected ErrNotKeywordLayer, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestSqrtSTPaddingValueKey' to see log outputs.
+func TestSqrtSTPaddingValueKey(t *testing.T) {
+	setup()
+
+	// a real key encoded like the padding slots
+	keys := [][]byte{[]byte("b"), []byte("a"), []byte(padding)}
+	padded, numPadding := PadBytesToSqrt(keys)
+
+	data := make([]string, len(padded))
+	for i, key := range padded {
+		data[i] = string(key)
+	}
+
+	sqst := NewPrivateSqrtST()
+	if err := sqst.BuildForDataWithPadding(data, numPadding); err != nil {
+		t.Fatal(err)
+	}
+
+	if sqst.NumPadding != 1 || sqst.GetSecondLayerMetadata().NumPaddingSlots != 1 {
+		t.Fatalf("Incorrect number of padding slots: %v\n", sqst.NumPadding)
+	}
+
+	for i, key := range keys {
+		rowIndex := sqst.RowForKey(string(key))
+		shares := sqst.SecondLayer.NewIndexQueryShares(rowIndex, sqst.Height, 2)
+
+		results := make([]*SecretSharedQueryResult, len(shares))
+		for j, share := range shares {
+			var err error
+			if results[j], err = sqst.PrivateQuery(share, NumProcsForQuery); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		index, err := sqst.FindIndex(string(key), rowIndex, Recover(results))
+		if err != nil {
+			t.Fatalf("Key %q not found; expected index %v\n", key, i)
+		}
+
+		if index != i {
+			t.Fatalf("Incorrect index %v for key %q, expected %v\n", index, key, i)
+		}
+	}
+}
+
+func TestPadBytes(t *testing.T) {
+
+	// real data may contain the (string) padding value
+	data := [][]byte{[]byte(padding), {}, {1, 2}}
+
+	padded, numPadding := PadBytesToSqrt(data)
+	if len(padded) != 4 || numPadding != 1 {
+		t.Fatalf("Incorrect padding. Size: %v Padding: %v\n", len(padded), numPadding)
+	}
+
+	padded, numPadding = PadBytesToPowerOf2(append(data, data...))
+	if len(padded) != 8 || numPadding != 2 {
+		t.Fatalf("Incorrect padding. Size: %v Padding: %v\n", len(padded), numPadding)
+	}
+
+	db := NewDatabase()
+	if err := db.BuildForPaddedBinaryData(padded, numPadding); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range padded {
+		if db.IsPaddingSlot(i) != (i >= 6) {
+			t.Fatalf("Slot %v incorrectly marked as padding\n", i)
+		}
+	}
+}
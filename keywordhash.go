@@ -0,0 +1,103 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/pir/dpf"
+)
+
+/*
+ Byte-string keywords.
+ Keyword queries select the row whose keyword is the point of the DPF,
+ so keywords are integers of the keyword domain (see KeywordBits).
+ Arbitrary byte strings (email addresses, URLs, hashes, ...) are mapped
+ into a domain of the chosen number of bits with HashKeyword: the server
+ sets the hashes as the keywords of its rows (see SetByteKeywords) and
+ the client hashes the key it looks up (see NewByteKeywordQueryShares).
+ Two keys with the same hash would select both of their rows, so
+ SetByteKeywords rejects such keys with a *KeywordCollisionError; the
+ operator can then pick a larger domain. A key that is not in the
+ database selects no row unless its hash collides with the hash of a
+ key of the database (probability about numRows/2^bits per query).
+*/
+
+// ErrKeywordCollision is matched (using errors.Is) by the error returned by
+// SetByteKeywords when two keys hash to the same keyword. The error is a *KeywordCollisionError
+var ErrKeywordCollision = errors.New("keys hash to the same keyword")
+
+// KeywordCollisionError is returned when the keys of two rows hash to the same keyword
+type KeywordCollisionError struct {
+	Rows    [2]int // rows of the keys
+	Keyword uint
+	Bits    int
+}
+
+func (e *KeywordCollisionError) Error() string {
+	return fmt.Sprintf("%v: keys of rows %v and %v hash to %v in a %v-bit domain",
+		ErrKeywordCollision, e.Rows[0], e.Rows[1], e.Keyword, e.Bits)
+}
+
+// Is reports whether target is ErrKeywordCollision
+func (e *KeywordCollisionError) Is(target error) bool {
+	return target == ErrKeywordCollision
+}
+
+// keywordHashDomain separates the keyword hashes from other uses of the hash function
+const keywordHashDomain = "pir-keyword-v1"
+
+// HashKeyword maps the key into a domain of bits bits (1 <= bits <= dpf.MaxNumBits)
+func HashKeyword(key []byte, bits int) uint {
+
+	h := sha256.New()
+	h.Write([]byte(keywordHashDomain))
+	h.Write(key)
+	sum := h.Sum(nil)
+
+	keyword := binary.BigEndian.Uint64(sum)
+	if bits < 64 {
+		keyword &= uint64(1)<<uint(bits) - 1
+	}
+
+	return uint(keyword)
+}
+
+// SetByteKeywords sets the hashes of the keys (see HashKeyword) as the keywords of the rows
+// of the database, with a keyword domain of bits bits. Returns a *KeywordCollisionError if
+// the keys of two rows hash to the same keyword (including identical keys)
+func (db *Database) SetByteKeywords(keys [][]byte, bits int) error {
+
+	if bits < 1 || bits > dpf.MaxNumBits {
+		return fmt.Errorf("keyword domain of %v bits is not in [1, %v]", bits, dpf.MaxNumBits)
+	}
+
+	keywords := make([]uint, len(keys))
+	rows := make(map[uint]int, len(keys))
+
+	for i, key := range keys {
+		keywords[i] = HashKeyword(key, bits)
+
+		if j, ok := rows[keywords[i]]; ok {
+			return &KeywordCollisionError{Rows: [2]int{j, i}, Keyword: keywords[i], Bits: bits}
+		}
+		rows[keywords[i]] = i
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.Keywords = keywords
+	db.KeywordBits = bits
+	db.KeywordDigest = keywordDigest(keywords)
+
+	return nil
+}
+
+// NewByteKeywordQueryShares generates keyword-based PIR query shares for the key
+// (see SetByteKeywords)
+func (dbmd *DBMetadata) NewByteKeywordQueryShares(key []byte, groupSize int, numShares uint) []*QueryShare {
+	keyword := HashKeyword(key, int(dbmd.keywordDomainBits()))
+	return dbmd.NewKeywordQueryShares(int(keyword), groupSize, numShares)
+}
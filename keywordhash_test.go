@@ -0,0 +1,57 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// run with 'go test -v -run TestByteKeywords' to see log outputs.
+func TestByteKeywords(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	keys := make([][]byte, TestDBSize)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("user%v@example.com", i))
+	}
+
+	for _, bits := range []int{40, 64} {
+		if err := db.SetByteKeywords(keys, bits); err != nil {
+			t.Fatal(err)
+		}
+
+		md := db.Metadata()
+		for _, i := range []int{0, 17, TestDBSize - 1} {
+			shares := md.NewByteKeywordQueryShares(keys[i], 1, 2)
+
+			resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if slot := Recover([]*SecretSharedQueryResult{resA, resB})[0]; !slot.Equal(db.Slots[i]) {
+				t.Fatalf("Retrieved slot %v is incorrect (%v-bit domain)\n", i, bits)
+			}
+		}
+	}
+
+	// identical keys and keys colliding in a small domain are rejected
+	var collision *KeywordCollisionError
+	err := db.SetByteKeywords([][]byte{[]byte("a"), []byte("b"), []byte("a")}, 64)
+	if !errors.As(err, &collision) || collision.Rows != [2]int{0, 2} {
+		t.Fatalf("Expected a collision of rows 0 and 2, got %v\n", err)
+	}
+
+	if err := db.SetByteKeywords(keys, 4); !errors.Is(err, ErrKeywordCollision) {
+		t.Fatalf("Expected ErrKeywordCollision, got %v\n", err)
+	}
+
+	if err := db.SetByteKeywords(keys, 0); err == nil {
+		t.Fatalf("Set keywords with an empty domain\n")
+	}
+}
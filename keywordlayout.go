@@ -0,0 +1,107 @@
+package pir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+ Keyword layout checks.
+ The servers evaluate the DPF of a keyword query at the keyword of each
+ row, so all the servers must hold the same Keywords array: if they
+ diverge (e.g., an update was only applied to one server) the result
+ shares recover garbage without any error. The metadata therefore
+ includes a digest of the keywords (KeywordDigest) which is copied into
+ keyword query shares, and servers reject shares generated for different
+ keywords with a KeywordMismatchError. Servers can also compare their
+ digests before serving queries (see CheckPeerKeywords) so that a
+ divergence is detected without waiting for a client query.
+*/
+
+// ErrKeywordMismatch is returned when a keyword query was generated for different keywords than the database's
+var ErrKeywordMismatch = errors.New("query was generated for different keywords")
+
+// keywordDigestVersion is hashed along with the keywords
+const keywordDigestVersion = "pir-keywords-v1"
+
+// KeywordMismatchError is returned when the keyword digest of a query share (or of
+// another server) does not match the keywords of the database
+type KeywordMismatchError struct {
+	Expected []byte // digest of the query share or of the other server
+	Actual   []byte // digest of the keywords of the database (nil without keywords)
+}
+
+func (e *KeywordMismatchError) Error() string {
+	return fmt.Sprintf("%v: expected keyword digest %x, database has %x", ErrKeywordMismatch, e.Expected, e.Actual)
+}
+
+// Is reports whether target is ErrKeywordMismatch
+func (e *KeywordMismatchError) Is(target error) bool {
+	return target == ErrKeywordMismatch
+}
+
+// CheckPeerKeywords returns a KeywordMismatchError if digest (the KeywordDigest of
+// another server) does not match the keywords of the database
+func (db *Database) CheckPeerKeywords(digest []byte) error {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if !bytes.Equal(digest, db.KeywordDigest) {
+		return &KeywordMismatchError{Expected: digest, Actual: db.KeywordDigest}
+	}
+
+	return nil
+}
+
+// setKeywords sets the keywords of the rows along with their domain and digest
+func (db *Database) setKeywords(keywords []uint) {
+	db.Keywords = keywords
+	db.KeywordBits = keywordBitsFor(keywords)
+	db.KeywordDigest = keywordDigest(keywords)
+}
+
+// checkKeywordLayout returns a KeywordMismatchError if the keyword query share was
+// generated for different keywords. Shares without a digest (generated from
+// metadata without one) are only checked for the presence of the keywords
+func (db *Database) checkKeywordLayout(query *QueryShare) error {
+
+	if !query.IsKeywordBased {
+		return nil
+	}
+
+	if db.Keywords == nil || len(db.Keywords) < ceilDiv(db.DBSize, query.GroupSize) {
+		return &KeywordMismatchError{Expected: query.KeywordDigest}
+	}
+
+	if len(query.KeywordDigest) > 0 && !bytes.Equal(query.KeywordDigest, db.KeywordDigest) {
+		return &KeywordMismatchError{Expected: query.KeywordDigest, Actual: db.KeywordDigest}
+	}
+
+	return nil
+}
+
+// keywordDigest hashes the keywords in order (nil without keywords)
+func keywordDigest(keywords []uint) []byte {
+
+	if keywords == nil {
+		return nil
+	}
+
+	h := sha256.New()
+	h.Write([]byte(keywordDigestVersion))
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(len(keywords)))
+	h.Write(buf)
+
+	for _, keyword := range keywords {
+		binary.BigEndian.PutUint64(buf, uint64(keyword))
+		h.Write(buf)
+	}
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,64 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+)
+
+// run with 'go test -v -run TestKeywordMismatch' to see log outputs.
+func TestKeywordMismatch(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	keywords := make([]uint, TestDBSize)
+	for i := range keywords {
+		keywords[i] = uint(i * 7)
+	}
+
+	// keyword queries on a database without keywords are rejected
+	md := db.Metadata()
+	shares := md.NewKeywordQueryShares(7, 1, 2)
+	if _, err := db.PrivateSecretSharedQuery(shares[0], 1); !errors.Is(err, ErrKeywordMismatch) {
+		t.Fatalf("Expected ErrKeywordMismatch, got %v\n", err)
+	}
+
+	db.SetKeywords(keywords)
+	if slot := retrieveKeyword(t, db, 7, 1)[0]; !slot.Equal(db.Slots[1]) {
+		t.Fatalf("Retrieved slot is incorrect\n")
+	}
+
+	other := NewDatabase()
+	other.SetKeywords(append([]uint{}, keywords...))
+	if err := db.CheckPeerKeywords(other.KeywordDigest); err != nil {
+		t.Fatal(err)
+	}
+
+	md = db.Metadata()
+
+	// the keywords change after the query was generated
+	keywords[0], keywords[1] = keywords[1], keywords[0]
+	db.SetKeywords(keywords)
+
+	shares = md.NewKeywordQueryShares(7, 1, 2)
+	_, err := db.PrivateSecretSharedQuery(shares[0], 1)
+
+	var mismatch *KeywordMismatchError
+	if !errors.As(err, &mismatch) || string(mismatch.Actual) != string(db.KeywordDigest) {
+		t.Fatalf("Expected a KeywordMismatchError, got %v\n", err)
+	}
+
+	if err := db.CheckPeerKeywords(other.KeywordDigest); !errors.Is(err, ErrKeywordMismatch) {
+		t.Fatalf("Expected ErrKeywordMismatch, got %v\n", err)
+	}
+
+	// the digest survives encoding
+	b, err := shares[0].MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &QueryShare{}
+	if err := decoded.UnmarshalBinary(b); err != nil || string(decoded.KeywordDigest) != string(md.KeywordDigest) {
+		t.Fatalf("Keyword digest not decoded: %v\n", err)
+	}
+}
@@ -0,0 +1,227 @@
+package pir
+
+import (
+	"errors"
+	"sort"
+)
+
+/*
+ Importing existing key-value stores.
+ A KVSnapshot puts a key-value database (see BuildForKeyValueData) in
+ front of an existing store: the entries are read from a KVSource and
+ the keys index the cuckoo hash tables. Adapters read a Redis hash
+ (RedisHash, with HSCAN), a LevelDB database (LevelDB, with an iterator)
+ or a Bolt bucket (BoltBucket, with ForEach). The adapters only depend on
+ the shape of the client APIs (a function or a small interface) so that
+ the package does not depend on the client libraries, e.g., with go-redis,
+ goleveldb and bbolt:
+
+	pir.RedisHash{Scan: func(cursor uint64) ([]string, uint64, error) {
+		return rdb.HScan(ctx, "users", cursor, "", 1000).Result()
+	}}
+	pir.LevelDB{NewIterator: func() pir.LevelDBIterator { return ldb.NewIterator(nil, nil) }}
+	pir.BoltBucket{Bucket: tx.Bucket([]byte("users"))} // within a read transaction
+
+ Refresh reads the store again and keeps the keys that did not change at
+ their positions in the tables, so that the change is a small patch of
+ the slots (see SlotPatch) that is applied to the snapshot and replicated
+ to the other servers with ApplyPatch; the layout and the epoch do not
+ change. When the entries no longer fit the tables (the store grew or a
+ value is larger than the slots) Refresh returns ErrKVLayoutFull and a new
+ snapshot is taken (and swapped in by the servers, which changes the epoch).
+*/
+
+// ErrKVLayoutFull is returned when the entries of a store no longer fit the layout
+// of the snapshot (take a new snapshot with NewKVSnapshot)
+var ErrKVLayoutFull = errors.New("entries do not fit the key-value layout of the snapshot")
+
+// KVSource is a key-value store that can be read into a key-value database.
+// The key and the value are only valid during the call to fn
+type KVSource interface {
+	ForEach(fn func(key, value []byte) error) error
+}
+
+// RedisHash reads the fields and values of a Redis hash. Scan runs HSCAN from the
+// cursor and returns the fields and values (alternating) and the next cursor (0 at the end)
+type RedisHash struct {
+	Scan func(cursor uint64) ([]string, uint64, error)
+}
+
+// ForEach calls fn for each field and value of the hash. HSCAN may return a field
+// more than once (when the hash changes during the scan)
+func (h RedisHash) ForEach(fn func(key, value []byte) error) error {
+
+	cursor := uint64(0)
+	for {
+		entries, next, err := h.Scan(cursor)
+		if err != nil {
+			return err
+		}
+
+		if len(entries)%2 != 0 {
+			return errors.New("HSCAN returned a field without a value")
+		}
+
+		for i := 0; i < len(entries); i += 2 {
+			if err := fn([]byte(entries[i]), []byte(entries[i+1])); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// LevelDBIterator is the subset of a LevelDB iterator used by LevelDB
+type LevelDBIterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Release()
+	Error() error
+}
+
+// LevelDB reads the entries of a LevelDB database (or of the range of keys
+// of the iterators returned by NewIterator)
+type LevelDB struct {
+	NewIterator func() LevelDBIterator
+}
+
+// ForEach calls fn for each key and value of the iterator
+func (l LevelDB) ForEach(fn func(key, value []byte) error) error {
+
+	it := l.NewIterator()
+	defer it.Release()
+
+	for it.Next() {
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+
+	return it.Error()
+}
+
+// BoltBucket reads the entries of a Bolt bucket. Nested buckets are skipped
+type BoltBucket struct {
+	Bucket interface {
+		ForEach(fn func(k, v []byte) error) error
+	}
+}
+
+// ForEach calls fn for each key and value of the bucket
+func (b BoltBucket) ForEach(fn func(key, value []byte) error) error {
+
+	if b.Bucket == nil {
+		return errors.New("bucket does not exist")
+	}
+
+	return b.Bucket.ForEach(func(k, v []byte) error {
+		// nested buckets have nil values
+		if v == nil {
+			return nil
+		}
+		return fn(k, v)
+	})
+}
+
+// KVSnapshot is a key-value database holding the entries of a store
+type KVSnapshot struct {
+	DB *Database
+
+	positions map[string]int // position of each key in the tables
+}
+
+// NewKVSnapshot reads the entries of the source into a new key-value database
+func NewKVSnapshot(src KVSource) (*KVSnapshot, error) {
+
+	data, err := readKVSource(src)
+	if err != nil {
+		return nil, err
+	}
+
+	db := NewDatabase()
+	positions, err := db.buildForKeyValueData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KVSnapshot{DB: db, positions: positions}, nil
+}
+
+// Refresh reads the entries of the source again, applies the changes to the database
+// of the snapshot and returns the patch to apply to the other servers (see ApplyPatch).
+// Returns ErrKVLayoutFull (and leaves the snapshot unchanged) if the entries no longer fit
+func (snap *KVSnapshot) Refresh(src KVSource) (*SlotPatch, error) {
+
+	data, err := readKVSource(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dbmd := snap.DB.Metadata()
+	layout := dbmd.KeyValue
+
+	for _, value := range data {
+		if keyValueTagBytes+4+len(value) > dbmd.SlotBytes {
+			return nil, ErrKVLayoutFull
+		}
+	}
+
+	// the keys that are still in the store keep their positions
+	positions := make(map[string]int, len(data))
+	occupant := make(map[int]string, len(data))
+	added := make([]string, 0)
+	for key := range data {
+		if pos, ok := snap.positions[key]; ok {
+			positions[key] = pos
+			occupant[pos] = key
+		} else {
+			added = append(added, key)
+		}
+	}
+
+	sort.Strings(added)
+	for _, key := range added {
+		if !layout.insert(key, positions, occupant) {
+			return nil, ErrKVLayoutFull
+		}
+	}
+
+	refreshed := NewDatabase()
+	refreshed.Slots = layout.encodeEntries(data, positions, dbmd.SlotBytes)
+	refreshed.SlotBytes = dbmd.SlotBytes
+	refreshed.DBSize = len(refreshed.Slots)
+
+	patch, err := DiffSlots(snap.DB, refreshed)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := snap.DB.ApplyPatch(patch); err != nil {
+		return nil, err
+	}
+
+	snap.positions = positions
+
+	return patch, nil
+}
+
+// readKVSource returns a copy of the entries of the source
+func readKVSource(src KVSource) (map[string][]byte, error) {
+
+	data := make(map[string][]byte)
+	err := src.ForEach(func(key, value []byte) error {
+		data[string(key)] = append([]byte{}, value...)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
@@ -0,0 +1,192 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// fakeRedisHash serves HSCAN over a map in pages of pageSize fields
+func fakeRedisHash(data map[string]string, pageSize int) RedisHash {
+
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return RedisHash{Scan: func(cursor uint64) ([]string, uint64, error) {
+		end := int(cursor) + pageSize
+		if end >= len(fields) {
+			end = len(fields)
+		}
+
+		entries := make([]string, 0)
+		for _, field := range fields[cursor:end] {
+			entries = append(entries, field, data[field])
+		}
+
+		if end == len(fields) {
+			return entries, 0, nil
+		}
+		return entries, uint64(end), nil
+	}}
+}
+
+// fakeLevelDBIterator reuses its key and value buffers like LevelDB iterators
+type fakeLevelDBIterator struct {
+	keys, values []string
+	i            int
+	key, value   []byte
+	released     bool
+}
+
+func (it *fakeLevelDBIterator) Next() bool {
+	if it.i >= len(it.keys) {
+		return false
+	}
+	it.key = append(it.key[:0], it.keys[it.i]...)
+	it.value = append(it.value[:0], it.values[it.i]...)
+	it.i++
+	return true
+}
+
+func (it *fakeLevelDBIterator) Key() []byte   { return it.key }
+func (it *fakeLevelDBIterator) Value() []byte { return it.value }
+func (it *fakeLevelDBIterator) Release()      { it.released = true }
+func (it *fakeLevelDBIterator) Error() error  { return nil }
+
+// fakeBoltBucket holds entries and nested buckets (nil values)
+type fakeBoltBucket map[string][]byte
+
+func (b fakeBoltBucket) ForEach(fn func(k, v []byte) error) error {
+	for k, v := range b {
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkKVSnapshot checks that every key of the snapshot retrieves its value
+func checkKVSnapshot(t *testing.T, db *Database, data map[string]string) {
+
+	for key, expected := range data {
+		value, err := retrieveKeyValue(t, db, key, 2)
+		if err != nil {
+			t.Fatalf("Key %q: %v\n", key, err)
+		}
+
+		if string(value) != expected {
+			t.Fatalf("Value of %q is incorrect. %q != %q\n", key, expected, value)
+		}
+	}
+}
+
+func TestKVSnapshotAdapters(t *testing.T) {
+	setup()
+
+	data := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		data[fmt.Sprintf("user:%v", i)] = fmt.Sprintf("v%v", i*i)
+	}
+
+	keys := make([]string, 0, len(data))
+	values := make([]string, 0, len(data))
+	bucket := fakeBoltBucket{"nested": nil}
+	for key, value := range data {
+		keys = append(keys, key)
+		values = append(values, value)
+		bucket[key] = []byte(value)
+	}
+
+	it := &fakeLevelDBIterator{keys: keys, values: values}
+
+	sources := map[string]KVSource{
+		"redis":   fakeRedisHash(data, 7),
+		"leveldb": LevelDB{NewIterator: func() LevelDBIterator { return it }},
+		"bolt":    BoltBucket{Bucket: bucket},
+	}
+
+	for name, src := range sources {
+		snap, err := NewKVSnapshot(src)
+		if err != nil {
+			t.Fatalf("%v: %v\n", name, err)
+		}
+
+		checkKVSnapshot(t, snap.DB, data)
+
+		if _, err := retrieveKeyValue(t, snap.DB, "nested", 2); err != ErrKeyNotFound {
+			t.Fatalf("%v: nested bucket was imported: %v\n", name, err)
+		}
+	}
+
+	if !it.released {
+		t.Fatalf("LevelDB iterator was not released\n")
+	}
+}
+
+func TestKVSnapshotRefresh(t *testing.T) {
+	setup()
+
+	data := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		data[fmt.Sprintf("key/%v", i)] = fmt.Sprintf("%03d", i)
+	}
+
+	snap, err := NewKVSnapshot(fakeRedisHash(data, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a second server holding the same snapshot
+	replica := NewDatabase()
+	if err := replica.SwapIn(cloneSlots(snap.DB.Slots)); err != nil {
+		t.Fatal(err)
+	}
+	replica.KeyValue = snap.DB.KeyValue
+
+	epochs := []int{snap.DB.Epoch, replica.Epoch}
+
+	// update, delete and add entries
+	data["key/3"] = "new"
+	delete(data, "key/7")
+	data["key/new"] = "add"
+
+	patch, err := snap.Refresh(fakeRedisHash(data, 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(patch.Updates) >= snap.DB.DBSize/2 {
+		t.Fatalf("Refresh rewrote %v of %v slots\n", len(patch.Updates), snap.DB.DBSize)
+	}
+
+	if err := replica.ApplyPatch(patch); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, db := range []*Database{snap.DB, replica} {
+		if db.Epoch != epochs[i] {
+			t.Fatalf("Refresh changed the epoch\n")
+		}
+
+		checkKVSnapshot(t, db, data)
+
+		if _, err := retrieveKeyValue(t, db, "key/7", 2); err != ErrKeyNotFound {
+			t.Fatalf("Deleted key was found: %v\n", err)
+		}
+	}
+
+	// values that no longer fit the slots
+	data["key/0"] = "a much longer value"
+	digest := snap.DB.ContentDigest()
+	if _, err := snap.Refresh(fakeRedisHash(data, 10)); !errors.Is(err, ErrKVLayoutFull) {
+		t.Fatalf("Expected ErrKVLayoutFull, got %v\n", err)
+	}
+
+	if snap.DB.ContentDigest() != digest {
+		t.Fatalf("Failed refresh changed the snapshot\n")
+	}
+}
@@ -0,0 +1,181 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+/*
+ Layouts and layout fingerprints.
+ A query is generated for a specific view of the database (dimensions,
+ group size, slot size and epoch). The dimensions are computed once, with
+ integer math, by LayoutForHeight (DefaultLayout for the square-root grid
+ of encrypted queries), travel with the query (DBWidth, DBHeight and
+ GroupSize) and are validated by the server against the size of the
+ database (see Layout.Validate). The fingerprint of the layout is also
+ included in the query so that the server rejects queries generated from
+ stale metadata instead of returning wrong-shaped responses. The
+ fingerprint is deterministic and can also be used to key server-side
+ caches that depend on the layout.
+*/
+
+// ErrStaleLayout is returned when a query was generated for a different layout than the database's
+var ErrStaleLayout = errors.New("query was generated for a different database layout")
+
+// layoutFingerprintVersion is hashed along with the fields so that the
+// fingerprint changes if the layout ever gains new fields
+const layoutFingerprintVersion = "pir-layout-v1"
+
+// LayoutFingerprint identifies a Layout (see Layout.Fingerprint)
+type LayoutFingerprint [sha256.Size]byte
+
+// Layout is the view of the database that a query is generated for:
+// a Width x Height grid of slots retrieved in groups of GroupSize
+type Layout struct {
+	Width     int
+	Height    int
+	GroupSize int
+	SlotBytes int
+	Epoch     int
+
+	// number of cells of the grid past the end of the database
+	// (not fingerprinted: it follows from the dimensions and the size of the database)
+	Padding int
+}
+
+// Fingerprint returns a hash of the layout
+func (l Layout) Fingerprint() LayoutFingerprint {
+
+	fields := []int{l.Width, l.Height, l.GroupSize, l.SlotBytes, l.Epoch}
+
+	buf := make([]byte, len(layoutFingerprintVersion)+8*len(fields))
+	n := copy(buf, layoutFingerprintVersion)
+
+	for i, v := range fields {
+		binary.BigEndian.PutUint64(buf[n+8*i:], uint64(v))
+	}
+
+	return sha256.Sum256(buf)
+}
+
+// IsZero returns true if the fingerprint is not set
+func (fp LayoutFingerprint) IsZero() bool {
+	return fp == LayoutFingerprint{}
+}
+
+// Coordinates returns the row and the column of the cell of the index
+func (l Layout) Coordinates(index int) (int, int) {
+	return index / l.Width, index % l.Width
+}
+
+// Validate returns an error if the grid is malformed and ErrStaleLayout if it does
+// not cover a database of dbSize slots
+func (l Layout) Validate(dbSize int) error {
+
+	if l.Width <= 0 || l.Height <= 0 {
+		return fmt.Errorf("layout has non-positive dimensions %vx%v", l.Width, l.Height)
+	}
+
+	if l.Height > math.MaxInt/l.Width {
+		return fmt.Errorf("layout dimensions %vx%v overflow", l.Width, l.Height)
+	}
+
+	if l.Width*l.Height < dbSize {
+		return fmt.Errorf("%w: %vx%v grid for %v slots", ErrStaleLayout, l.Width, l.Height, dbSize)
+	}
+
+	return nil
+}
+
+// LayoutFor returns the layout of the database viewed as a width x height grid
+func (dbmd *DBMetadata) LayoutFor(width, height, groupSize int) Layout {
+
+	padding := width*height - dbmd.DBSize
+	if padding < 0 {
+		padding = 0
+	}
+
+	return Layout{
+		Width:     width,
+		Height:    height,
+		GroupSize: groupSize,
+		SlotBytes: dbmd.SlotBytes,
+		Epoch:     dbmd.Epoch,
+		Padding:   padding,
+	}
+}
+
+// LayoutForHeight returns the layout of the database viewed as a grid of at most height
+// rows whose width is a multiple of groupSize (default = 1). Rows past the end of the
+// database are trimmed so that the last row holds at least one slot
+func (dbmd *DBMetadata) LayoutForHeight(height, groupSize int) Layout {
+
+	if height < 1 {
+		height = 1
+	}
+
+	if groupSize < 1 {
+		groupSize = 1
+	}
+
+	numGroups := ceilDiv(dbmd.DBSize, height*groupSize)
+	if numGroups == 0 {
+		numGroups = 1
+	}
+
+	width := numGroups * groupSize
+
+	return dbmd.LayoutFor(width, ceilDiv(dbmd.DBSize, width), groupSize)
+}
+
+// DefaultLayout returns the square-root layout of encrypted queries (see NewEncryptedQuery)
+func (dbmd *DBMetadata) DefaultLayout(groupSize int) Layout {
+	return dbmd.LayoutForHeight(ceilSqrt(dbmd.DBSize), groupSize)
+}
+
+// SharedLayout returns the layout used by secret shared queries
+// (the database is viewed as a groupSize-wide grid)
+func (dbmd *DBMetadata) SharedLayout(groupSize int) Layout {
+	height := ceilDiv(dbmd.DBSize, groupSize)
+	return dbmd.LayoutFor(groupSize, height, groupSize)
+}
+
+// checkSharedLayout returns ErrStaleLayout if the query share has a fingerprint
+// that does not match the database. Queries without a fingerprint are not checked
+func (dbmd *DBMetadata) checkSharedLayout(query *QueryShare) error {
+
+	if query.LayoutFingerprint.IsZero() {
+		return nil
+	}
+
+	if query.GroupSize <= 0 || query.LayoutFingerprint != dbmd.SharedLayout(query.GroupSize).Fingerprint() {
+		return ErrStaleLayout
+	}
+
+	return nil
+}
+
+// checkEncryptedLayout returns an error if the dimensions of the encrypted query are
+// malformed and ErrStaleLayout if they do not cover the database or if the query has a
+// fingerprint that does not match the database. The fingerprint of queries without one
+// is not checked
+func (dbmd *DBMetadata) checkEncryptedLayout(query *EncryptedQuery) error {
+
+	layout := dbmd.LayoutFor(query.DBWidth, query.DBHeight, query.GroupSize)
+	if err := layout.Validate(dbmd.DBSize); err != nil {
+		return err
+	}
+
+	if query.LayoutFingerprint.IsZero() {
+		return nil
+	}
+
+	if query.LayoutFingerprint != layout.Fingerprint() {
+		return ErrStaleLayout
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+func TestLayoutFingerprint(t *testing.T) {
+
+	layout := Layout{Width: 8, Height: 4, GroupSize: 2, SlotBytes: 16, Epoch: 3}
+
+	if layout.Fingerprint() != layout.Fingerprint() {
+		t.Fatalf("Fingerprint is not deterministic\n")
+	}
+
+	if layout.Fingerprint().IsZero() {
+		t.Fatalf("Fingerprint is zero\n")
+	}
+
+	changed := []Layout{
+		{Width: 9, Height: 4, GroupSize: 2, SlotBytes: 16, Epoch: 3},
+		{Width: 8, Height: 5, GroupSize: 2, SlotBytes: 16, Epoch: 3},
+		{Width: 8, Height: 4, GroupSize: 1, SlotBytes: 16, Epoch: 3},
+		{Width: 8, Height: 4, GroupSize: 2, SlotBytes: 17, Epoch: 3},
+		{Width: 8, Height: 4, GroupSize: 2, SlotBytes: 16, Epoch: 4},
+		{Width: 4, Height: 8, GroupSize: 2, SlotBytes: 16, Epoch: 3},
+	}
+
+	for _, other := range changed {
+		if other.Fingerprint() == layout.Fingerprint() {
+			t.Fatalf("Layouts %v and %v have the same fingerprint\n", layout, other)
+		}
+	}
+}
+
+func TestStaleSharedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	shares := db.NewIndexQueryShares(rand.Intn(db.DBSize), 1, 2)
+
+	if _, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SwapIn(GenerateRandomDB(TestDBSize, SlotBytes).Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Stale query was not rejected: %v\n", err)
+	}
+
+	// a query without a fingerprint is not checked
+	shares[0].LayoutFingerprint = LayoutFingerprint{}
+	if _, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaleEncryptedQuery(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	query := db.NewEncryptedQuery(pk, 1, 0)
+
+	if _, err := db.PrivateEncryptedQuery(query, NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// the slot size changed since the query was generated
+	if err := db.SwapIn(GenerateRandomDB(TestDBSize, SlotBytes+1).Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.PrivateEncryptedQuery(query, NumProcsForQuery); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Stale query was not rejected: %v\n", err)
+	}
+
+	query = db.NewEncryptedQuery(pk, 1, 0)
+	res, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recoverEncrypted(t, res, sk)) == 0 {
+		t.Fatalf("No slots recovered\n")
+	}
+}
+
+func TestLayoutForHeight(t *testing.T) {
+
+	for dbSize := 1; dbSize <= 300; dbSize++ {
+		dbmd := &DBMetadata{SlotBytes: SlotBytes, DBSize: dbSize}
+
+		for groupSize := 1; groupSize <= 5; groupSize++ {
+			for _, height := range []int{1, 2, ceilSqrt(dbSize), dbSize, dbSize + 3} {
+				layout := dbmd.LayoutForHeight(height, groupSize)
+
+				if layout.Width%groupSize != 0 {
+					t.Fatalf("Width %v is not a multiple of the group size %v\n", layout.Width, groupSize)
+				}
+
+				if layout.Height > height {
+					t.Fatalf("Height %v exceeds %v\n", layout.Height, height)
+				}
+
+				// no rows past the end of the database
+				if layout.Width*layout.Height < dbSize || layout.Width*(layout.Height-1) >= dbSize {
+					t.Fatalf("Layout %vx%v does not fit %v slots\n", layout.Width, layout.Height, dbSize)
+				}
+
+				if layout.Padding != layout.Width*layout.Height-dbSize {
+					t.Fatalf("Incorrect padding %v for %vx%v and %v slots\n", layout.Padding, layout.Width, layout.Height, dbSize)
+				}
+
+				if err := layout.Validate(dbSize); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+func TestMalformedEncryptedLayout(t *testing.T) {
+	setup()
+
+	_, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	layout := db.DefaultLayout(1)
+
+	// dimensions that do not cover the database are rejected even without a fingerprint
+	query := db.NewEncryptedQueryWithDimentions(pk, layout.Width, layout.Height-1, 1, 0)
+	query.LayoutFingerprint = LayoutFingerprint{}
+
+	if _, err := db.PrivateEncryptedQuery(query, NumProcsForQuery); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Query not covering the database was not rejected: %v\n", err)
+	}
+
+	query = db.NewEncryptedQueryWithDimentions(pk, 0, layout.Height, 1, 0)
+	if _, err := db.PrivateEncryptedQuery(query, NumProcsForQuery); err == nil {
+		t.Fatalf("Query with an empty width was not rejected\n")
+	}
+
+	// fewer encrypted bits than rows
+	query = db.NewEncryptedQuery(pk, 1, 0)
+	query.EBits = query.EBits[:len(query.EBits)-1]
+	if _, err := db.PrivateEncryptedQuery(query, NumProcsForQuery); err == nil {
+		t.Fatalf("Query with missing bits was not rejected\n")
+	}
+}
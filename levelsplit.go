@@ -0,0 +1,98 @@
+package pir
+
+import (
+	"errors"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Splitting level-1 ciphertexts across level-2 ciphertexts.
+ The column pass of a doubly encrypted query (see
+ PrivateDoublyEncryptedQuery and PrivateEncryptedQueryOverEncryptedResult)
+ encrypts the level-1 ciphertexts of the row pass, which are integers
+ modulo the square of the modulus of the row key, under the level-2
+ plaintext space of the column key (integers modulo the square of its
+ modulus). When the column key is smaller than the row key, a level-1
+ ciphertext does not fit and is reduced modulo the plaintext space,
+ which corrupts the retrieved slots. Such ciphertexts are split into
+ ChunksPerCiphertext chunks of ChunkBytes bytes (least significant chunk
+ first), each encrypted in its own level-2 ciphertext, and the client
+ joins the chunks before decrypting the level-1 ciphertext (see
+ RecoverDoublyEncryptedWithKeys). Ciphertexts that fit (in particular
+ when both passes use the same key) are not split. Keys too small to
+ hold a byte of a slot are rejected with ErrKeyTooSmall.
+*/
+
+// ErrKeyTooSmall is returned when the plaintext space of a public key cannot
+// hold a byte of a slot (level 1) or of a level-1 ciphertext (level 2)
+var ErrKeyTooSmall = errors.New("public key is too small to encrypt the slots")
+
+// levelTwoSplit describes how level-1 ciphertexts are encrypted at level 2
+type levelTwoSplit struct {
+	chunks     int // level-2 ciphertexts per level-1 ciphertext (1 if not split)
+	chunkBytes int // bytes of a chunk (0 if not split)
+}
+
+// newLevelTwoSplit returns how level-1 ciphertexts under rowPk are encrypted at level 2 under colPk
+func newLevelTwoSplit(rowPk, colPk *paillier.PublicKey) (levelTwoSplit, error) {
+
+	if msgSpaceBytes(rowPk) < 1 || msgSpaceBytes(colPk) < 1 {
+		return levelTwoSplit{}, ErrKeyTooSmall
+	}
+
+	// level-1 ciphertexts are smaller than rowN^2, which is at most colN^2
+	if rowPk.N.Cmp(colPk.N) <= 0 {
+		return levelTwoSplit{chunks: 1}, nil
+	}
+
+	// integers of fewer bytes than colN^2 are smaller than colN^2
+	rowN2 := new(gmp.Int).Mul(rowPk.N, rowPk.N)
+	colN2 := new(gmp.Int).Mul(colPk.N, colPk.N)
+	chunkBytes := len(colN2.Bytes()) - 1
+
+	return levelTwoSplit{
+		chunks:     ceilDiv(len(rowN2.Bytes()), chunkBytes),
+		chunkBytes: chunkBytes,
+	}, nil
+}
+
+// split returns the chunks of the level-1 ciphertext to encrypt at level 2
+func (s levelTwoSplit) split(ct *paillier.Ciphertext) []*gmp.Int {
+
+	if s.chunks <= 1 {
+		return []*gmp.Int{ct.C}
+	}
+
+	bits := uint(8 * s.chunkBytes)
+	modulus := new(gmp.Int).Lsh(gmp.NewInt(1), bits)
+
+	chunks := make([]*gmp.Int, s.chunks)
+	v := ct.C
+	for i := range chunks {
+		chunks[i] = new(gmp.Int).Mod(v, modulus)
+		v = new(gmp.Int).Rsh(v, bits)
+	}
+
+	return chunks
+}
+
+// setResult records the split in the result
+func (s levelTwoSplit) setResult(res *DoublyEncryptedQueryResult) {
+	if s.chunks > 1 {
+		res.ChunksPerCiphertext, res.ChunkBytes = s.chunks, s.chunkBytes
+	}
+}
+
+// join returns the level-1 ciphertext of the chunks (see split)
+func (s levelTwoSplit) join(chunks []*gmp.Int) *paillier.Ciphertext {
+
+	v := new(gmp.Int)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		v.Lsh(v, uint(8*s.chunkBytes))
+		v.Add(v, chunks[i])
+	}
+
+	return &paillier.Ciphertext{C: v, Level: paillier.EncLevelOne}
+}
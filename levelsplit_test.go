@@ -0,0 +1,120 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+func TestDoublyEncryptedQueryMixedKeys(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 2
+
+	// a small column key splits the ciphertexts of the row pass, a large one does not
+	small, large := 128, 512
+	for _, bits := range [][2]int{{large, small}, {small, large}, {large, large}} {
+		rowSk, rowPk := paillier.KeyGen(bits[0])
+		colSk, colPk := paillier.KeyGen(bits[1])
+
+		for trial := 0; trial < NumTrials; trial++ {
+			index := rand.Intn(TestDBSize)
+			query := &DoublyEncryptedQuery{
+				Row: db.NewDoublyEncryptedQuery(rowPk, groupSize, index).Row,
+				Col: db.NewDoublyEncryptedQuery(colPk, groupSize, index).Col,
+			}
+
+			res, err := db.PrivateDoublyEncryptedQuery(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// ciphertexts are split whenever the row modulus exceeds the column modulus
+			split := res.ChunksPerCiphertext > 1
+			if split != (rowPk.N.Cmp(colPk.N) > 0) {
+				t.Fatalf("Result with keys of %v bits has %v chunks per ciphertext\n", bits, res.ChunksPerCiphertext)
+			}
+
+			// the pipelined passes split the same way as the column pass over the row result
+			rowRes, err := db.PrivateEncryptedQuery(query.Row, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			overRes, err := db.PrivateEncryptedQueryOverEncryptedResult(query.Col, rowRes, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if overRes.ChunksPerCiphertext != res.ChunksPerCiphertext || overRes.ChunkBytes != res.ChunkBytes {
+				t.Fatalf("Passes split differently (%v, %v)\n", res.ChunksPerCiphertext, overRes.ChunksPerCiphertext)
+			}
+
+			for _, r := range []*DoublyEncryptedQueryResult{res, overRes} {
+				b, err := r.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				decoded := &DoublyEncryptedQueryResult{}
+				if err := decoded.UnmarshalBinary(b); err != nil {
+					t.Fatal(err)
+				}
+
+				slots, err := RecoverDoublyEncryptedWithKeys(decoded, rowSk, colSk)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !slots[index%groupSize].Equal(db.Slots[index]) {
+					t.Fatalf("Result with keys of %v bits is incorrect. %v != %v\n", bits, slots[index%groupSize], db.Slots[index])
+				}
+			}
+		}
+	}
+}
+
+func TestLevelTwoSplit(t *testing.T) {
+
+	_, rowPk := paillier.KeyGen(512)
+	_, colPk := paillier.KeyGen(128)
+
+	split, err := newLevelTwoSplit(rowPk, colPk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	colN2 := new(gmp.Int).Mul(colPk.N, colPk.N)
+	rowN2 := new(gmp.Int).Mul(rowPk.N, rowPk.N)
+
+	for trial := 0; trial < NumTrials; trial++ {
+		v := new(gmp.Int).Sub(rowN2, gmp.NewInt(int64(trial+1)))
+		if trial%2 == 1 {
+			v = gmp.NewInt(int64(trial))
+		}
+
+		chunks := split.split(&paillier.Ciphertext{C: v, Level: paillier.EncLevelOne})
+		if len(chunks) != split.chunks {
+			t.Fatalf("Split into %v chunks, expected %v\n", len(chunks), split.chunks)
+		}
+
+		for _, chunk := range chunks {
+			if chunk.Cmp(colN2) >= 0 {
+				t.Fatalf("Chunk %v does not fit the level-2 plaintext space\n", chunk)
+			}
+		}
+
+		if split.join(chunks).C.Cmp(v) != 0 {
+			t.Fatalf("Joined chunks differ from %v\n", v)
+		}
+	}
+
+	// same keys do not split
+	split, err = newLevelTwoSplit(rowPk, rowPk)
+	if err != nil || split.chunks != 1 {
+		t.Fatalf("Split ciphertexts under the same key into %v chunks (%v)\n", split.chunks, err)
+	}
+}
@@ -0,0 +1,233 @@
+package pir
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Static query validation.
+ LintQuery decodes a serialized query (see MarshalBinary) and checks it
+ against the metadata of a database without answering it: the scheme
+ and its version, the sizes of the keys and encrypted bits, the levels
+ of the ciphertexts and the layout fingerprint. Operators can triage
+ client integration bugs from captured payloads without a server (see
+ cmd/pir-lint). A query without problems can still be rejected by a
+ server whose contents differ from the metadata (keywords, attributes).
+*/
+
+// Kinds of the queries checked by LintQuery
+const (
+	LintQueryShare           = "query share"
+	LintEncryptedQuery       = "encrypted query"
+	LintDoublyEncryptedQuery = "doubly encrypted query"
+)
+
+// LintReport lists the problems found in a query
+type LintReport struct {
+	Kind     string // one of LintQueryShare, LintEncryptedQuery or LintDoublyEncryptedQuery
+	Scheme   Scheme
+	Problems []string
+}
+
+// OK returns true if no problems were found
+func (r *LintReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *LintReport) addf(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// LintQuery checks that the serialized query (a QueryShare, EncryptedQuery or
+// DoublyEncryptedQuery) is well-formed for the database described by dbmd.
+// Returns an error only if the payload cannot be decoded
+func LintQuery(dbmd *DBMetadata, payload []byte) (*LintReport, error) {
+
+	if len(payload) == 0 {
+		return nil, ErrInvalidEncoding
+	}
+
+	switch payload[0] {
+	case tagQueryShare:
+		share := &QueryShare{}
+		if err := share.UnmarshalBinary(payload); err != nil {
+			return nil, err
+		}
+		return dbmd.LintQueryShare(share), nil
+
+	case tagEncryptedQuery:
+		query := &EncryptedQuery{}
+		if err := query.UnmarshalBinary(payload); err != nil {
+			return nil, err
+		}
+		return dbmd.LintEncryptedQuery(query), nil
+
+	case tagDoublyEncryptedQuery:
+		query := &DoublyEncryptedQuery{}
+		if err := query.UnmarshalBinary(payload); err != nil {
+			return nil, err
+		}
+		return dbmd.LintDoublyEncryptedQuery(query), nil
+	}
+
+	return nil, fmt.Errorf("%w: payload is not a query (tag %v)", ErrInvalidEncoding, payload[0])
+}
+
+// LintQueryShare checks that the query share is well-formed for the database
+func (dbmd *DBMetadata) LintQueryShare(share *QueryShare) *LintReport {
+
+	r := &LintReport{Kind: LintQueryShare, Scheme: share.scheme()}
+
+	dbmd.lintScheme(r, share.GroupSize)
+
+	if r.Scheme == SchemeDPFv1 || r.Scheme == SchemeDPFv2EarlyTerm {
+		if keys := schemeForKeys(share.IsTwoParty, share.KeyVariant); keys != r.Scheme {
+			r.addf("keys are for scheme %q", keys)
+		}
+	}
+
+	if share.GroupSize <= 0 {
+		// the layout and the domain of the keys depend on the group size
+		return r
+	}
+
+	if dbmd.checkSharedLayout(share) != nil {
+		r.addf("layout fingerprint does not match the metadata (epoch %v, slot size %v, group size %v)",
+			dbmd.Epoch, dbmd.SlotBytes, share.GroupSize)
+	}
+
+	if err := dbmd.checkKeyDomain(share); errors.Is(err, ErrStaleLayout) {
+		r.addf("keys are not over the %v-bit domain of the database",
+			dbmd.sharedQueryDomainBits(share.GroupSize, share.IsKeywordBased))
+	} else if err != nil {
+		r.addf("%v", err)
+	}
+
+	if share.IsTwoParty && share.ShareNumber > 1 {
+		r.addf("two-party share number %v", share.ShareNumber)
+	}
+
+	if share.IsKeywordBased && len(share.KeywordDigest) > 0 && len(dbmd.KeywordDigest) > 0 &&
+		!bytes.Equal(share.KeywordDigest, dbmd.KeywordDigest) {
+		r.addf("keyword digest does not match the metadata")
+	}
+
+	return r
+}
+
+// LintEncryptedQuery checks that the encrypted query is well-formed for the database
+func (dbmd *DBMetadata) LintEncryptedQuery(query *EncryptedQuery) *LintReport {
+
+	r := &LintReport{Kind: LintEncryptedQuery, Scheme: query.scheme()}
+
+	dbmd.lintScheme(r, query.GroupSize)
+	dbmd.lintEncryptedRows(r, query)
+
+	return r
+}
+
+// LintDoublyEncryptedQuery checks that the doubly encrypted query is well-formed for the database
+func (dbmd *DBMetadata) LintDoublyEncryptedQuery(query *DoublyEncryptedQuery) *LintReport {
+
+	r := &LintReport{Kind: LintDoublyEncryptedQuery}
+
+	if query.Row == nil || query.Col == nil {
+		r.addf("missing row or column query")
+		return r
+	}
+
+	r.Scheme = query.Row.scheme()
+	if schemes := query.Schemes(); isImplementedScheme(schemes.Col) {
+		if _, ok := recursionBackends[schemes]; !ok {
+			r.addf("tier schemes %v are not implemented (implemented: %v)", schemes, ImplementedRecursions)
+		}
+	} else {
+		r.addf("column scheme %q is not implemented", schemes.Col)
+	}
+
+	dbmd.lintScheme(r, query.Row.GroupSize)
+	dbmd.lintEncryptedRows(r, query.Row)
+
+	col := query.Col
+	if col.GroupSize <= 0 {
+		r.addf("column query has group size %v", col.GroupSize)
+		return r
+	}
+
+	if query.Row.DBWidth%col.GroupSize != 0 {
+		r.addf("row width %v is not a multiple of the group size %v", query.Row.DBWidth, col.GroupSize)
+	}
+
+	if numGroups := query.Row.DBWidth / col.GroupSize; len(col.EBits) < numGroups {
+		r.addf("column query has %v encrypted bits for %v groups", len(col.EBits), numGroups)
+	}
+
+	lintCiphertexts(r, "column", col, paillier.EncLevelTwo)
+
+	if col.Pk == nil || query.Row.Pk == nil || col.Pk.N == nil || query.Row.Pk.N == nil ||
+		col.Pk.N.Cmp(query.Row.Pk.N) != 0 {
+		r.addf("row and column queries use different public keys")
+	}
+
+	return r
+}
+
+// lintScheme checks that the scheme is implemented and advertised by the server
+// and that the group size is served
+func (dbmd *DBMetadata) lintScheme(r *LintReport, groupSize int) {
+
+	if !isImplementedScheme(r.Scheme) {
+		r.addf("scheme %q is not implemented (implemented: %v)", r.Scheme, ImplementedSchemes)
+	} else if caps := dbmd.Capabilities; caps != nil && len(caps.Schemes) > 0 && !containsScheme(caps.Schemes, r.Scheme) {
+		r.addf("scheme %q is not advertised by the server (advertised: %v)", r.Scheme, caps.Schemes)
+	}
+
+	if groupSize <= 0 {
+		r.addf("group size %v is not positive", groupSize)
+	} else if caps := dbmd.Capabilities; caps != nil && caps.MaxGroupSize > 0 && groupSize > caps.MaxGroupSize {
+		r.addf("group size %v exceeds the maximum of %v", groupSize, caps.MaxGroupSize)
+	}
+}
+
+// lintEncryptedRows checks the dimensions, layout and ciphertexts of an encrypted (row) query
+func (dbmd *DBMetadata) lintEncryptedRows(r *LintReport, query *EncryptedQuery) {
+
+	if query.Pk == nil {
+		r.addf("query has no public key")
+	}
+
+	if query.DBWidth <= 0 || query.DBHeight <= 0 {
+		r.addf("dimensions %vx%v are not positive", query.DBWidth, query.DBHeight)
+	} else if query.DBWidth*query.DBHeight < dbmd.DBSize {
+		r.addf("dimensions %vx%v do not cover the %v slots of the database",
+			query.DBWidth, query.DBHeight, dbmd.DBSize)
+	} else if !query.LayoutFingerprint.IsZero() && dbmd.checkEncryptedLayout(query) != nil {
+		r.addf("layout fingerprint does not match the metadata (epoch %v, slot size %v)",
+			dbmd.Epoch, dbmd.SlotBytes)
+	}
+
+	if len(query.EBits) < query.DBHeight {
+		r.addf("query has %v encrypted bits for %v rows", len(query.EBits), query.DBHeight)
+	}
+
+	lintCiphertexts(r, "row", query, paillier.EncLevelOne)
+}
+
+// lintCiphertexts checks that the encrypted bits of the query are set and at the level
+func lintCiphertexts(r *LintReport, name string, query *EncryptedQuery, level paillier.EncryptionLevel) {
+
+	for i, ct := range query.EBits {
+		if ct == nil || ct.C == nil {
+			r.addf("%v bit %v is missing", name, i)
+			return
+		}
+		if ct.Level != level {
+			r.addf("%v bit %v is encrypted at level %v instead of %v", name, i, ct.Level, level)
+			return
+		}
+	}
+}
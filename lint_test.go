@@ -0,0 +1,94 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestLintQuery' to see log outputs.
+func TestLintQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	dbmd := db.Metadata()
+
+	groupSize := 2
+	for _, variant := range []KeyVariant{KeyPayloadInLeaf, KeyEarlyTermination} {
+		for _, share := range dbmd.NewIndexQuerySharesWithKeyVariant(3, groupSize, variant, 4) {
+			b, err := share.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := LintQuery(&dbmd, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.OK() || report.Kind != LintQueryShare {
+				t.Fatalf("Unexpected report for a well-formed share: %+v\n", report)
+			}
+		}
+	}
+
+	// shares generated for another epoch or with keys of another scheme
+	stale := dbmd
+	stale.Epoch++
+	share := stale.NewIndexQueryShares(3, groupSize, 2)[0]
+	if report := dbmd.LintQueryShare(share); report.OK() {
+		t.Fatalf("Share generated for another epoch passed")
+	}
+
+	share = dbmd.NewIndexQueryShares(3, groupSize, 2)[0]
+	share.Scheme = SchemeDPFv2EarlyTerm
+	if report := dbmd.LintQueryShare(share); report.OK() {
+		t.Fatalf("Share with keys of another scheme passed")
+	}
+
+	dbmd.Capabilities = &ServerCapabilities{Schemes: []Scheme{SchemeDPFv1}, MaxGroupSize: 1}
+	if report := dbmd.LintQueryShare(dbmd.NewIndexQueryShares(3, groupSize, 2)[0]); len(report.Problems) != 1 {
+		t.Fatalf("Expected the group size to be reported, got %v\n", report.Problems)
+	}
+	dbmd.Capabilities = nil
+
+	// encrypted queries
+	_, pk := paillier.KeyGen(128)
+
+	query := dbmd.NewEncryptedQuery(pk, groupSize, 3)
+	b, err := query.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err := LintQuery(&dbmd, b); err != nil || !report.OK() {
+		t.Fatalf("Unexpected report for a well-formed encrypted query: %+v (%v)\n", report, err)
+	}
+
+	query.EBits[1] = pk.EncryptZeroAtLevel(paillier.EncLevelTwo)
+	query.EBits = query.EBits[:len(query.EBits)-1]
+	if report := dbmd.LintEncryptedQuery(query); len(report.Problems) != 2 {
+		t.Fatalf("Expected the level and the number of bits to be reported, got %v\n", report.Problems)
+	}
+
+	doubly := dbmd.NewDoublyEncryptedQuery(pk, groupSize, 3)
+	b, err = doubly.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err := LintQuery(&dbmd, b); err != nil || !report.OK() || report.Kind != LintDoublyEncryptedQuery {
+		t.Fatalf("Unexpected report for a well-formed doubly encrypted query: %+v (%v)\n", report, err)
+	}
+
+	// payloads that are not queries
+	res, err := db.AnswerSharedQuery(dbmd.NewIndexQueryShares(3, groupSize, 2)[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = res.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LintQuery(&dbmd, b); !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("Expected ErrInvalidEncoding, got %v\n", err)
+	}
+}
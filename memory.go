@@ -0,0 +1,155 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Memory usage reporting and guardrails.
+ The estimates count the buffers allocated by the database and by each
+ query (DPF bits, result slots and ciphertext accumulators) and ignore
+ the constant overhead of the runtime. With a query memory limit set,
+ queries whose estimate exceeds the limit are rejected before any
+ buffer is allocated, so that a large query cannot get a shared server
+ killed for running out of memory.
+*/
+
+// sizes (in bytes) of the headers of a *Slot and of a *gmp.Int on 64-bit platforms
+const (
+	slotOverheadBytes   = 8 + 24 // pointer and slice header
+	bigIntOverheadBytes = 8 + 32 // pointer and struct
+)
+
+// ErrQueryMemoryLimit is matched (using errors.Is) by the error returned when the
+// estimated memory of a query exceeds the limit. The error is a *QueryMemoryError
+var ErrQueryMemoryLimit = errors.New("query exceeds the memory limit")
+
+// QueryMemoryError contains the estimated memory of the rejected query and the limit
+type QueryMemoryError struct {
+	Estimated int64
+	Limit     int64
+}
+
+func (e *QueryMemoryError) Error() string {
+	return fmt.Sprintf("%v: estimated %v bytes (limit %v bytes)", ErrQueryMemoryLimit, e.Estimated, e.Limit)
+}
+
+// Is reports whether target is ErrQueryMemoryLimit
+func (e *QueryMemoryError) Is(target error) bool {
+	return target == ErrQueryMemoryLimit
+}
+
+// MemoryFootprint returns the estimated number of bytes held by the database
+// (slots, keywords and attributes)
+func (db *Database) MemoryFootprint() int64 {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	footprint := int64(len(db.Slots)) * slotOverheadBytes
+	for _, slot := range db.Slots {
+		if slot != nil {
+			footprint += int64(cap(slot.Data))
+		}
+	}
+
+	footprint += int64(len(db.Keywords)) * 8
+	footprint += int64(len(db.Attributes)) * 8
+
+	return footprint
+}
+
+// SetQueryMemoryLimit rejects queries whose estimated memory exceeds limit bytes
+// with a *QueryMemoryError. A non-positive limit disables the check
+func (db *Database) SetQueryMemoryLimit(limit int64) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.queryMemoryLimit = limit
+}
+
+// EstimateSharedQueryMemory returns the estimated peak memory (in bytes) of answering
+// the secret shared query: the expanded DPF bits and the result slots of each worker
+func (db *Database) EstimateSharedQueryMemory(query *QueryShare, nprocs int) int64 {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.estimateSharedQueryMemory(query, nprocs)
+}
+
+func (db *Database) estimateSharedQueryMemory(query *QueryShare, nprocs int) int64 {
+
+	if query.GroupSize <= 0 {
+		return 0
+	}
+
+	dimHeight := int64(ceilDiv(db.DBSize, query.GroupSize))
+	results := int64(query.GroupSize) * (slotOverheadBytes + int64(db.SlotBytes))
+
+	// parallel scans accumulate one set of result slots per worker
+	numResults := int64(1)
+	if db.isPartitioned() && nprocs > 1 {
+		numResults += int64(len(db.rowRanges(query.GroupSize, nprocs)))
+	} else if nprocs > 1 {
+		numResults += int64(nprocs)
+	}
+
+	return dimHeight + numResults*results
+}
+
+// EstimateEncryptedQueryMemory returns the estimated peak memory (in bytes) of answering
+// the encrypted query: the row of encrypted slots accumulated by each worker
+func (db *Database) EstimateEncryptedQueryMemory(query *EncryptedQuery, nprocs int) int64 {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.estimateEncryptedQueryMemory(query, nprocs)
+}
+
+func (db *Database) estimateEncryptedQueryMemory(query *EncryptedQuery, nprocs int) int64 {
+
+	params := db.paramsForPublicKey(query.Pk)
+	row := int64(query.DBWidth) * int64(params.numCiphertextsPerSlot) * ciphertextBytes(query.Pk, 1)
+
+	// the worker results are merged into the first
+	return int64(nprocs+1) * row
+}
+
+// EstimateDoublyEncryptedQueryMemory returns the estimated peak memory (in bytes) of answering
+// the doubly encrypted query: the row query and the column query over its result
+func (db *Database) EstimateDoublyEncryptedQueryMemory(query *DoublyEncryptedQuery, nprocs int) int64 {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.estimateDoublyEncryptedQueryMemory(query, nprocs)
+}
+
+func (db *Database) estimateDoublyEncryptedQueryMemory(query *DoublyEncryptedQuery, nprocs int) int64 {
+
+	params := db.paramsForPublicKey(query.Col.Pk)
+	group := int64(query.Col.GroupSize) * int64(params.numCiphertextsPerSlot) * ciphertextBytes(query.Col.Pk, 2)
+
+	return db.estimateEncryptedQueryMemory(query.Row, nprocs) + int64(nprocs+1)*group
+}
+
+// ciphertextBytes returns the size of a ciphertext at the level (modulo N^(level+1))
+func ciphertextBytes(pk *paillier.PublicKey, level int) int64 {
+	return int64(level+1)*int64(len(pk.N.Bytes())) + bigIntOverheadBytes
+}
+
+// checkQueryMemory returns a *QueryMemoryError if the estimate exceeds the limit
+func (db *Database) checkQueryMemory(estimated int64) error {
+
+	if db.queryMemoryLimit > 0 && estimated > db.queryMemoryLimit {
+		return &QueryMemoryError{Estimated: estimated, Limit: db.queryMemoryLimit}
+	}
+
+	return nil
+}
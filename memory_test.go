@@ -0,0 +1,101 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestMemoryFootprint' to see log outputs.
+func TestMemoryFootprint(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	footprint := db.MemoryFootprint()
+	if footprint < int64(TestDBSize*SlotBytes) {
+		t.Fatalf("Footprint %v is smaller than the slot data\n", footprint)
+	}
+
+	if err := db.SetAttributes(make([]uint64, TestDBSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.MemoryFootprint() != footprint+TestDBSize*8 {
+		t.Fatalf("Footprint does not include the attributes")
+	}
+
+	t.Logf("Footprint: %v bytes\n", db.MemoryFootprint())
+}
+
+// run with 'go test -v -run TestQueryMemoryLimit' to see log outputs.
+func TestQueryMemoryLimit(t *testing.T) {
+	setup()
+
+	_, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	share := db.NewIndexQueryShares(0, 1, 2)[0]
+	encrypted := db.NewEncryptedQuery(pk, 1, 0)
+	doubly := db.NewDoublyEncryptedQuery(pk, 1, 0)
+
+	sharedEstimate := db.EstimateSharedQueryMemory(share, NumProcsForQuery)
+	if sharedEstimate < TestDBSize {
+		t.Fatalf("Shared estimate %v does not include the DPF bits\n", sharedEstimate)
+	}
+
+	// estimates grow with the number of workers
+	encryptedEstimate := db.EstimateEncryptedQueryMemory(encrypted, NumProcsForQuery)
+	if encryptedEstimate <= db.EstimateEncryptedQueryMemory(encrypted, 1) {
+		t.Fatalf("Encrypted estimate does not grow with the number of workers")
+	}
+
+	doublyEstimate := db.EstimateDoublyEncryptedQueryMemory(doubly, NumProcsForQuery)
+	if doublyEstimate <= db.EstimateEncryptedQueryMemory(doubly.Row, NumProcsForQuery) {
+		t.Fatalf("Doubly encrypted estimate does not include the column query")
+	}
+
+	t.Logf("Estimates: shared %v, encrypted %v, doubly encrypted %v bytes\n",
+		sharedEstimate, encryptedEstimate, doublyEstimate)
+
+	// queries within the limit are answered
+	db.SetQueryMemoryLimit(doublyEstimate)
+
+	if _, err := db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.PrivateDoublyEncryptedQuery(doubly, NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// queries over the limit are rejected
+	db.SetQueryMemoryLimit(sharedEstimate - 1)
+
+	_, err := db.PrivateSecretSharedQuery(share, NumProcsForQuery)
+	if !errors.Is(err, ErrQueryMemoryLimit) {
+		t.Fatalf("Expected ErrQueryMemoryLimit, got %v\n", err)
+	}
+
+	var memErr *QueryMemoryError
+	if !errors.As(err, &memErr) || memErr.Estimated != sharedEstimate || memErr.Limit != sharedEstimate-1 {
+		t.Fatalf("Unexpected error %v\n", err)
+	}
+
+	db.SetQueryMemoryLimit(encryptedEstimate - 1)
+	if _, err := db.PrivateEncryptedQuery(encrypted, NumProcsForQuery); !errors.Is(err, ErrQueryMemoryLimit) {
+		t.Fatalf("Expected ErrQueryMemoryLimit, got %v\n", err)
+	}
+
+	db.SetQueryMemoryLimit(doublyEstimate - 1)
+	if _, err := db.PrivateDoublyEncryptedQuery(doubly, NumProcsForQuery); !errors.Is(err, ErrQueryMemoryLimit) {
+		t.Fatalf("Expected ErrQueryMemoryLimit, got %v\n", err)
+	}
+
+	// no limit
+	db.SetQueryMemoryLimit(0)
+	if _, err := db.PrivateEncryptedQuery(encrypted, NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+}
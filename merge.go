@@ -0,0 +1,188 @@
+package pir
+
+import (
+	"errors"
+	"reflect"
+)
+
+// IndexMap translates between the indices of a source database
+// and the indices of the merged database (see MergeDatabases).
+// The slots of the source are at [Offset, Offset+Size) in the merged database
+type IndexMap struct {
+	Offset int
+	Size   int
+}
+
+// Merged returns the index of the source slot at index in the merged database
+// and false if the index is not in the source
+func (m IndexMap) Merged(index int) (int, bool) {
+
+	if index < 0 || index >= m.Size {
+		return 0, false
+	}
+
+	return m.Offset + index, true
+}
+
+// Source returns the index in the source database of the merged slot at index
+// and false if the slot does not come from the source
+func (m IndexMap) Source(index int) (int, bool) {
+
+	if index < m.Offset || index >= m.Offset+m.Size {
+		return 0, false
+	}
+
+	return index - m.Offset, true
+}
+
+// MergeDatabases concatenates the slots of the databases (in order) into a new
+// database and returns one IndexMap per source. Slots are zero padded to the
+// largest slot size and padding slots of the sources are dropped.
+// Keywords (and attributes) are concatenated; keywords must be set on
+// all or none of the sources and must be unique across them.
+// The sources must agree on the slot encoding (length prefixed or schema)
+func MergeDatabases(dbs ...*Database) (*Database, []IndexMap, error) {
+
+	if len(dbs) == 0 {
+		return nil, nil, errors.New("no databases to merge")
+	}
+
+	snapshots := make([]*mergeSource, len(dbs))
+	for i, db := range dbs {
+		snapshots[i] = db.mergeSource()
+	}
+
+	first := snapshots[0]
+	slotBytes := 0
+	dbSize := 0
+	hasAttributes := false
+
+	for _, src := range snapshots {
+		if src.LengthPrefixed != first.LengthPrefixed || !reflect.DeepEqual(src.Schema, first.Schema) {
+			return nil, nil, errors.New("databases use different slot encodings")
+		}
+
+		// entries are placed by the hash of their key (see BuildForKeyValueData)
+		if src.KeyValue != nil {
+			return nil, nil, errors.New("cannot merge key-value databases")
+		}
+
+		// the inclusion proofs are for the tree head of each log
+		if src.LogTree != nil {
+			return nil, nil, errors.New("cannot merge log databases")
+		}
+
+		// sealed records are bound to their index (see SealData)
+		if src.SlotKeyID != "" {
+			return nil, nil, errors.New("cannot merge databases encrypted at rest")
+		}
+
+		if (src.keywords == nil) != (first.keywords == nil) {
+			return nil, nil, errors.New("keywords must be set on all or none of the databases")
+		}
+
+		if src.keywords != nil && len(src.keywords) != len(src.slots) {
+			return nil, nil, errors.New("keywords must be set for every slot")
+		}
+
+		if src.SlotBytes > slotBytes {
+			slotBytes = src.SlotBytes
+		}
+
+		dbSize += len(src.slots)
+		hasAttributes = hasAttributes || src.attributes != nil
+	}
+
+	// a schema fixes the size of the records
+	if first.Schema != nil && slotBytes != first.Schema.RecordBytes {
+		return nil, nil, errors.New("databases use different slot encodings")
+	}
+
+	merged := NewDatabase()
+	merged.Slots = make([]*Slot, 0, dbSize)
+	merged.SlotBytes = slotBytes
+	merged.DBSize = dbSize
+	merged.LengthPrefixed = first.LengthPrefixed
+	merged.Schema = first.Schema
+
+	if first.keywords != nil {
+		merged.Keywords = make([]uint, 0, dbSize)
+	}
+
+	if hasAttributes {
+		merged.Attributes = make([]uint64, 0, dbSize)
+	}
+
+	seen := make(map[uint]bool)
+	maps := make([]IndexMap, len(snapshots))
+
+	for i, src := range snapshots {
+		maps[i] = IndexMap{Offset: len(merged.Slots), Size: len(src.slots)}
+
+		for _, slot := range src.slots {
+			data := make([]byte, slotBytes)
+			copy(data, slot.Data)
+			merged.Slots = append(merged.Slots, NewSlot(data))
+		}
+
+		for _, keyword := range src.keywords {
+			if seen[keyword] {
+				return nil, nil, errors.New("duplicate keyword in merged databases")
+			}
+			seen[keyword] = true
+			merged.Keywords = append(merged.Keywords, keyword)
+		}
+
+		if hasAttributes {
+			attributes := src.attributes
+			if attributes == nil {
+				attributes = make([]uint64, len(src.slots))
+			}
+			merged.Attributes = append(merged.Attributes, attributes...)
+		}
+	}
+
+	merged.setKeywords(merged.Keywords)
+
+	return merged, maps, nil
+}
+
+// mergeSource is a consistent snapshot of the contents of a database in logical order
+// (without padding slots)
+type mergeSource struct {
+	DBMetadata
+	slots      []*Slot
+	keywords   []uint
+	attributes []uint64
+}
+
+func (db *Database) mergeSource() *mergeSource {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	src := &mergeSource{
+		DBMetadata: db.DBMetadata,
+		slots:      db.Slots,
+		keywords:   db.Keywords,
+		attributes: db.Attributes,
+	}
+
+	// keywords are associated with rows and are not shuffled
+	if db.GroupShuffle != nil {
+		src.slots = db.GroupShuffle.unshuffle(db.Slots, db.Epoch)
+		src.attributes = db.GroupShuffle.applyToAttributes(db.Attributes, db.Epoch, true)
+	}
+
+	n := db.DBSize - db.NumPaddingSlots
+	src.slots = src.slots[:n]
+	if len(src.keywords) > n {
+		// keywords of the padding slots
+		src.keywords = src.keywords[:n]
+	}
+	if src.attributes != nil {
+		src.attributes = src.attributes[:n]
+	}
+
+	return src
+}
@@ -0,0 +1,122 @@
+package pir
+
+import (
+	"testing"
+)
+
+// run with 'go test -v -run TestMergeDatabases' to see log outputs.
+func TestMergeDatabases(t *testing.T) {
+	setup()
+
+	a := GenerateRandomDB(10, SlotBytes)
+	b := GenerateRandomDB(7, SlotBytes+2)
+	c := GenerateRandomDB(12, SlotBytes)
+	if err := c.ShuffleWithinGroups(4); err != nil {
+		t.Fatal(err)
+	}
+
+	logical := [][]*Slot{a.Slots, b.Slots, c.GroupShuffle.unshuffle(c.Slots, c.Epoch)}
+
+	merged, maps, err := MergeDatabases(a, b, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.DBSize != 29 || len(merged.Slots) != 29 || merged.SlotBytes != SlotBytes+2 {
+		t.Fatalf("Unexpected merged database: size %v, slot bytes %v\n", merged.DBSize, merged.SlotBytes)
+	}
+
+	for i, m := range maps {
+		for j, slot := range logical[i] {
+			index, ok := m.Merged(j)
+			if !ok {
+				t.Fatalf("Index %v of database %v is not mapped\n", j, i)
+			}
+
+			if src, ok := m.Source(index); !ok || src != j {
+				t.Fatalf("Merged index %v does not map back to %v\n", index, j)
+			}
+
+			if !NewSlot(merged.Slots[index].Data[:len(slot.Data)]).Equal(slot) {
+				t.Fatalf("Slot %v of database %v is incorrect\n", j, i)
+			}
+		}
+
+		if _, ok := m.Merged(len(logical[i])); ok {
+			t.Fatalf("Index past the end of database %v is mapped\n", i)
+		}
+	}
+
+	// the merged database answers queries
+	index, _ := maps[1].Merged(3)
+	shares := merged.NewIndexQueryShares(index, 1, 2)
+	res := make([]*SecretSharedQueryResult, len(shares))
+	for i, share := range shares {
+		if res[i], err = merged.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !Recover(res)[0].Equal(merged.Slots[index]) {
+		t.Fatalf("Query over the merged database is incorrect")
+	}
+}
+
+func TestMergeDatabasesKeywords(t *testing.T) {
+	setup()
+
+	a := NewDatabase()
+	if err := a.BuildForPaddedBinaryData([][]byte{{1}, {2}, {3}, {0}}, 1); err != nil {
+		t.Fatal(err)
+	}
+	a.SetKeywords([]uint{10, 11, 12, 13})
+
+	b := NewDatabase()
+	if err := b.BuildForBinaryData([][]byte{{4, 4}, {5, 5}}); err != nil {
+		t.Fatal(err)
+	}
+	b.SetKeywords([]uint{20, 21})
+
+	merged, maps, err := MergeDatabases(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the padding slot is dropped
+	if merged.DBSize != 5 || maps[0].Size != 3 || maps[1].Offset != 3 || !merged.LengthPrefixed {
+		t.Fatalf("Unexpected merged database: size %v, maps %v\n", merged.DBSize, maps)
+	}
+
+	expected := []uint{10, 11, 12, 20, 21}
+	for i, keyword := range merged.Keywords {
+		if keyword != expected[i] {
+			t.Fatalf("Keywords %v != %v\n", merged.Keywords, expected)
+		}
+	}
+
+	data, err := merged.DecodeSlot(merged.Slots[4])
+	if err != nil || len(data) != 2 || data[0] != 5 {
+		t.Fatalf("Unexpected data %v (%v)\n", data, err)
+	}
+
+	// duplicate keywords
+	b.SetKeywords([]uint{20, 10})
+	if _, _, err := MergeDatabases(a, b); err == nil {
+		t.Fatalf("Merged databases with duplicate keywords")
+	}
+
+	// keywords on some of the databases
+	b.SetKeywords(nil)
+	if _, _, err := MergeDatabases(a, b); err == nil {
+		t.Fatalf("Merged databases with and without keywords")
+	}
+
+	// different slot encodings
+	if _, _, err := MergeDatabases(a, GenerateRandomDB(3, SlotBytes)); err == nil {
+		t.Fatalf("Merged databases with different slot encodings")
+	}
+
+	if _, _, err := MergeDatabases(); err == nil {
+		t.Fatalf("Merged no databases")
+	}
+}
@@ -0,0 +1,157 @@
+package pir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+ Keyword-to-slot binding using a Merkle commitment.
+ A server answering keyword queries could permute Keywords to redirect a client
+ to a different row without being detected. Each slot is therefore extended
+ with its index and the Merkle proof of the leaf H(keyword || index || data)
+ so that the client can check the slot it retrieved against the published root.
+*/
+
+const (
+	merkleHashBytes  = sha256.Size
+	merkleIndexBytes = 8
+	merkleLeafPrefix = 0x00
+	merkleNodePrefix = 0x01
+)
+
+// SetAuthenticatedKeywords sets the keywords associated with each row of the database
+// and binds each slot to the keyword of its row.
+// Slots are extended with a Merkle proof (increasing SlotBytes) and the
+// root of the tree is published as the KeywordCommitment in the metadata.
+// Use VerifyKeywordSlot on the client to check and strip the proof
+func (db *Database) SetAuthenticatedKeywords(keywords []uint) error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(keywords) == 0 || db.DBSize%len(keywords) != 0 {
+		return errors.New("number of keywords must divide the database size")
+	}
+
+	// keywords are associated with each row of groupSize slots
+	groupSize := db.DBSize / len(keywords)
+	depth := merkleDepth(db.DBSize)
+
+	// leaves padded to a power of two
+	layer := make([][]byte, 1<<depth)
+	for i := range layer {
+		if i < db.DBSize {
+			layer[i] = merkleLeaf(keywords[i/groupSize], i, db.Slots[i].Data)
+		} else {
+			layer[i] = merkleLeaf(0, i, nil)
+		}
+	}
+
+	proofs := make([][]byte, db.DBSize)
+	for i := range proofs {
+		proofs[i] = make([]byte, 0, depth*merkleHashBytes)
+	}
+
+	for level := 0; level < depth; level++ {
+		for i := range proofs {
+			sibling := (i >> uint(level)) ^ 1
+			proofs[i] = append(proofs[i], layer[sibling]...)
+		}
+
+		next := make([][]byte, len(layer)/2)
+		for i := range next {
+			next[i] = merkleNode(layer[2*i], layer[2*i+1])
+		}
+		layer = next
+	}
+
+	slotBytes := db.SlotBytes + merkleIndexBytes + depth*merkleHashBytes
+	for i, slot := range db.Slots {
+		data := make([]byte, slotBytes)
+		copy(data, slot.Data)
+		binary.BigEndian.PutUint64(data[db.SlotBytes:], uint64(i))
+		copy(data[db.SlotBytes+merkleIndexBytes:], proofs[i])
+		db.Slots[i] = NewSlot(data)
+	}
+
+	db.SlotBytes = slotBytes
+	db.setKeywords(keywords)
+	db.KeywordCommitment = layer[0]
+
+	return nil
+}
+
+// VerifyKeywordSlot checks that a slot retrieved using a keyword query is bound to keyword
+// in the database committed to in the metadata and returns the slot without the proof
+func (dbmd *DBMetadata) VerifyKeywordSlot(keyword uint, slot *Slot) (*Slot, error) {
+
+	if dbmd.KeywordCommitment == nil {
+		return nil, errors.New("metadata does not contain a keyword commitment")
+	}
+
+	depth := merkleDepth(dbmd.DBSize)
+	dataBytes := dbmd.SlotBytes - merkleIndexBytes - depth*merkleHashBytes
+	if dataBytes < 0 || len(slot.Data) != dbmd.SlotBytes {
+		return nil, errors.New("slot size does not match the metadata")
+	}
+
+	data := slot.Data[:dataBytes]
+	index := binary.BigEndian.Uint64(slot.Data[dataBytes:])
+	proof := slot.Data[dataBytes+merkleIndexBytes:]
+
+	if index >= uint64(dbmd.DBSize) {
+		return nil, errors.New("slot index outside of the database")
+	}
+
+	hash := merkleLeaf(keyword, int(index), data)
+	for level := 0; level < depth; level++ {
+		sibling := proof[level*merkleHashBytes : (level+1)*merkleHashBytes]
+		if (index>>uint(level))&1 == 0 {
+			hash = merkleNode(hash, sibling)
+		} else {
+			hash = merkleNode(sibling, hash)
+		}
+	}
+
+	if !bytes.Equal(hash, dbmd.KeywordCommitment) {
+		return nil, errors.New("slot is not bound to the keyword -- server likely cheating")
+	}
+
+	res := make([]byte, dataBytes)
+	copy(res, data)
+
+	return NewSlot(res), nil
+}
+
+// merkleDepth returns the depth of a tree with at least n leaves
+func merkleDepth(n int) int {
+	depth := 0
+	for (1 << uint(depth)) < n {
+		depth++
+	}
+	return depth
+}
+
+func merkleLeaf(keyword uint, index int, data []byte) []byte {
+	buf := make([]byte, 1+2*merkleIndexBytes, 1+2*merkleIndexBytes+len(data))
+	buf[0] = merkleLeafPrefix
+	binary.BigEndian.PutUint64(buf[1:], uint64(keyword))
+	binary.BigEndian.PutUint64(buf[1+merkleIndexBytes:], uint64(index))
+	buf = append(buf, data...)
+
+	res := sha256.Sum256(buf)
+	return res[:]
+}
+
+func merkleNode(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+2*merkleHashBytes)
+	buf = append(buf, merkleNodePrefix)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+
+	res := sha256.Sum256(buf)
+	return res[:]
+}
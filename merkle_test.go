@@ -0,0 +1,106 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func generateKeywords(n int) []uint {
+
+	keywords := make([]uint, n)
+	seen := make(map[uint]bool)
+	for i := range keywords {
+		for {
+			keywords[i] = uint(rand.Uint32())
+			if !seen[keywords[i]] {
+				seen[keywords[i]] = true
+				break
+			}
+		}
+	}
+
+	return keywords
+}
+
+func retrieveKeyword(t *testing.T, db *Database, keyword uint, groupSize int) []*Slot {
+
+	md := db.Metadata()
+	shares := md.NewKeywordQueryShares(int(keyword), groupSize, 2)
+
+	resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return Recover([]*SecretSharedQueryResult{resA, resB})
+}
+
+// run with 'go test -v -run TestAuthenticatedKeywords' to see log outputs.
+func TestAuthenticatedKeywords(t *testing.T) {
+	setup()
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize *= 2 {
+
+		db := GenerateRandomDB(TestDBSize, SlotBytes)
+		original := GenerateEmptyDB(TestDBSize, SlotBytes)
+		for i := range db.Slots {
+			copy(original.Slots[i].Data, db.Slots[i].Data)
+		}
+
+		keywords := generateKeywords(TestDBSize / groupSize)
+		if err := db.SetAuthenticatedKeywords(keywords); err != nil {
+			t.Fatal(err)
+		}
+
+		md := db.Metadata()
+
+		for i := 0; i < NumQueries/10; i++ {
+			row := rand.Intn(len(keywords))
+			res := retrieveKeyword(t, db, keywords[row], groupSize)
+
+			for j := 0; j < groupSize; j++ {
+				slot, err := md.VerifyKeywordSlot(keywords[row], res[j])
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !slot.Equal(original.Slots[row*groupSize+j]) {
+					t.Fatalf("Query result is incorrect. %v != %v\n", original.Slots[row*groupSize+j], slot)
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestAuthenticatedKeywordsDetectsSwap' to see log outputs.
+func TestAuthenticatedKeywordsDetectsSwap(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	keywords := generateKeywords(TestDBSize)
+	if err := db.SetAuthenticatedKeywords(keywords); err != nil {
+		t.Fatal(err)
+	}
+
+	md := db.Metadata()
+
+	for i := 0; i < NumQueries/10; i++ {
+		a := rand.Intn(TestDBSize)
+		b := (a + 1 + rand.Intn(TestDBSize-1)) % TestDBSize
+
+		// malicious server redirects keyword a to row b
+		db.Keywords[a], db.Keywords[b] = db.Keywords[b], db.Keywords[a]
+
+		res := retrieveKeyword(t, db, keywords[a], 1)
+		if _, err := md.VerifyKeywordSlot(keywords[a], res[0]); err == nil {
+			t.Fatalf("Keyword swap was not detected")
+		}
+
+		db.Keywords[a], db.Keywords[b] = db.Keywords[b], db.Keywords[a]
+	}
+}
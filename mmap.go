@@ -0,0 +1,109 @@
+package pir
+
+import (
+	"os"
+)
+
+/*
+ Memory-mapped databases.
+ LoadDatabase allocates every slot separately, so a database of a million
+ small slots pays an allocation header per slot and scans jump around the
+ heap. NewMMapDatabase (and LoadFromFile) instead map a database file (see
+ Save) into memory: the data of the slots are consecutive windows of the
+ mapping and the Slot headers are allocated in a single array, so the
+ database costs two allocations regardless of its size, pages are loaded
+ lazily by the kernel and scans read the file sequentially. The mapping
+ is private (copy-on-write): changes to the slots are never written back
+ to the file. Readers may hold on to the slots of a mapping after they
+ are swapped out, so mappings are only released by Close. On platforms
+ without mmap the file is read into a single buffer instead.
+*/
+
+// NewMMapDatabase returns a database whose slots are memory-mapped from the
+// database file at path (see LoadFromFile)
+func NewMMapDatabase(path string) (*Database, error) {
+
+	db := NewDatabase()
+	if err := db.LoadFromFile(path); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// LoadFromFile swaps in the slots of the database file at path (see SwapIn)
+// memory-mapped rather than read into separately allocated slots.
+// Call Close to release the mapping once the database is no longer used
+func (db *Database) LoadFromFile(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	slotBytes, dbSize, numPadding, err := readDBFileHeader(f)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the file must hold exactly the slots of the header
+	if slotBytes > 0 && dbSize > (int(info.Size())-dbFileHeaderBytes)/slotBytes {
+		return ErrInvalidDBFile
+	}
+	size := dbFileHeaderBytes + dbSize*slotBytes
+	if int64(size) != info.Size() {
+		return ErrInvalidDBFile
+	}
+
+	mapping, err := mapFile(f, size)
+	if err != nil {
+		return err
+	}
+
+	headers := make([]Slot, dbSize)
+	slots := make([]*Slot, dbSize)
+	for i := range slots {
+		start := dbFileHeaderBytes + i*slotBytes
+		headers[i].Data = mapping.data[start : start+slotBytes : start+slotBytes]
+		slots[i] = &headers[i]
+	}
+
+	if err := db.swapIn(slots, ""); err != nil {
+		mapping.unmap()
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.NumPaddingSlots = numPadding
+	db.mappings = append(db.mappings, mapping)
+
+	return nil
+}
+
+// Close releases the memory mappings of the database (see LoadFromFile).
+// The slots of the mappings are no longer valid, so Close must only be called
+// once the database (and the slots it returned) are no longer used
+func (db *Database) Close() error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var firstErr error
+	for _, mapping := range db.mappings {
+		if err := mapping.unmap(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	db.mappings = nil
+
+	return firstErr
+}
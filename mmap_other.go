@@ -0,0 +1,30 @@
+//go:build !unix
+
+package pir
+
+import (
+	"io"
+	"os"
+)
+
+// fileMapping holds the contents of a file read into a single buffer
+// (on platforms without mmap)
+type fileMapping struct {
+	data []byte
+}
+
+// mapFile reads the first size bytes of the file
+func mapFile(f *os.File, size int) (*fileMapping, error) {
+
+	data := make([]byte, size)
+	if _, err := f.ReadAt(data, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return &fileMapping{data: data}, nil
+}
+
+func (m *fileMapping) unmap() error {
+	m.data = nil
+	return nil
+}
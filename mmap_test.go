@@ -0,0 +1,83 @@
+package pir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// run with 'go test -v -run TestMMapDatabase' to see log outputs.
+func TestMMapDatabase(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	db.NumPaddingSlots = 2
+
+	path := filepath.Join(t.TempDir(), "db")
+	if err := db.SaveFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped, err := NewMMapDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mapped.Close()
+
+	if mapped.DBSize != db.DBSize || mapped.SlotBytes != db.SlotBytes || mapped.NumPaddingSlots != db.NumPaddingSlots {
+		t.Fatalf("Metadata not loaded: %v != %v\n", mapped.DBMetadata, db.DBMetadata)
+	}
+
+	for i := range db.Slots {
+		if !db.Slots[i].Equal(mapped.Slots[i]) {
+			t.Fatalf("Slot %v not loaded. %v != %v\n", i, db.Slots[i], mapped.Slots[i])
+		}
+	}
+
+	index := 7
+	slot, err := retrieveSlot(mapped, mapped.Metadata(), index, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slot.Equal(db.Slots[index]) {
+		t.Fatalf("Incorrect slot at index %v: %v != %v\n", index, slot, db.Slots[index])
+	}
+
+	// changes to the slots are not written to the file
+	XorSlots(mapped.Slots[0], mapped.Slots[1])
+
+	reloaded, err := LoadDatabaseFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reloaded.Slots[0].Equal(db.Slots[0]) {
+		t.Fatalf("Change to a mapped slot was written to the file\n")
+	}
+
+	// files whose size does not match the header are rejected
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := filepath.Join(t.TempDir(), "truncated")
+	if err := os.WriteFile(truncated, b[:len(b)-1], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewMMapDatabase(truncated); err != ErrInvalidDBFile {
+		t.Fatalf("Mapped a truncated database file: %v\n", err)
+	}
+
+	// loading a file swaps in its slots
+	epoch := mapped.Epoch
+	if err := mapped.LoadFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if mapped.Epoch != epoch+1 || !mapped.Slots[0].Equal(db.Slots[0]) {
+		t.Fatalf("File was not swapped in\n")
+	}
+}
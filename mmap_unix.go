@@ -0,0 +1,40 @@
+//go:build unix
+
+package pir
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileMapping is a private read-write mapping of a file
+type fileMapping struct {
+	data []byte
+}
+
+// mapFile maps the first size bytes of the file copy-on-write
+func mapFile(f *os.File, size int) (*fileMapping, error) {
+
+	if size == 0 {
+		return &fileMapping{}, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileMapping{data: data}, nil
+}
+
+func (m *fileMapping) unmap() error {
+
+	if m.data == nil {
+		return nil
+	}
+
+	data := m.data
+	m.data = nil
+
+	return syscall.Munmap(data)
+}
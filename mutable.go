@@ -0,0 +1,252 @@
+package pir
+
+import (
+	"errors"
+)
+
+/*
+ Incremental updates.
+ Long-running servers can change individual slots without rebuilding
+ the database (see SwapIn). Data is encoded like the existing slots
+ (length prefixed or zero padded) and must fit in SlotBytes so that the
+ slot size never changes. Updating a slot or appending slots does not
+ move the other slots and keeps the epoch, so metadata already held by
+ clients stays valid: the grid dimensions are derived from DBSize and
+ queries generated for a layout that still covers the database are
+ answered (those that no longer do are rejected with ErrStaleLayout).
+ Deleting a slot moves the slots after it, so the epoch is incremented
+ (and swap listeners are notified) unless no slot moves. Clients caching
+ slots (see Client.EnableCache) may return the previous contents of an
+ updated slot until the epoch changes.
+ Databases whose layout depends on the contents (keyword layers,
+ authenticated keywords and key-value databases) and databases with
+ padding slots cannot be resized, and slots encrypted at rest cannot be
+ moved (see SealData).
+*/
+
+// ErrFixedLayout is returned when a database cannot be changed incrementally
+var ErrFixedLayout = errors.New("database cannot be changed incrementally (use SwapIn)")
+
+// UpdateSlot replaces the contents of the slot at index with data.
+// The layout and the epoch are unchanged
+func (db *Database) UpdateSlot(index int, data []byte) error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// the Merkle proofs bind the contents of the slots and
+	// key-value slots are tagged with their key
+	if db.KeywordCommitment != nil || db.KeyValue != nil || db.LogTree != nil {
+		return ErrFixedLayout
+	}
+
+	if index < 0 || index >= db.DBSize {
+		return errors.New("index out of range")
+	}
+
+	slot, err := db.encodeSlotLocked(data)
+	if err != nil {
+		return err
+	}
+
+	// slots are stored in shuffled order (see ShuffleWithinGroups)
+	pos := db.storagePosition(index)
+
+	// copied so that snapshots of the slots taken by readers do not change
+	slots := make([]*Slot, len(db.Slots))
+	copy(slots, db.Slots)
+	slots[pos] = slot
+	db.Slots = slots
+	db.records = db.records.updated(index, data)
+
+	return nil
+}
+
+// AppendSlots adds a slot for each value of data at the end of the database and
+// returns the index of the first new slot. Attributes of the new slots are zero.
+// The epoch is unchanged unless the last group of a shuffled database is partial
+// (see ShuffleWithinGroups)
+func (db *Database) AppendSlots(data [][]byte) (int, error) {
+
+	db.mu.Lock()
+
+	if err := db.checkResizableLocked(); err != nil {
+		db.mu.Unlock()
+		return 0, err
+	}
+
+	newSlots := make([]*Slot, len(data))
+	for i := range data {
+		var err error
+		if newSlots[i], err = db.encodeSlotLocked(data[i]); err != nil {
+			db.mu.Unlock()
+			return 0, err
+		}
+	}
+
+	n := db.DBSize
+
+	// the permutation of a partial group depends on its size
+	moved := db.GroupShuffle != nil && n%db.GroupShuffle.GroupSize != 0
+
+	listeners, err := db.resizeLocked(moved, func(slots []*Slot, attributes []uint64) ([]*Slot, []uint64) {
+		if attributes != nil {
+			attributes = append(attributes[:n:n], make([]uint64, len(newSlots))...)
+		}
+		return append(slots[:n:n], newSlots...), attributes
+	})
+
+	if err == nil {
+		db.records = db.records.appended(data)
+	}
+
+	epoch := db.Epoch
+	db.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	notifySwap(listeners, epoch)
+
+	return n, nil
+}
+
+// DeleteSlot removes the slot at index. The slots after index move down by one,
+// in which case the epoch is incremented and the swap listeners are notified
+// (see OnSwap)
+func (db *Database) DeleteSlot(index int) error {
+
+	db.mu.Lock()
+
+	if err := db.checkResizableLocked(); err != nil {
+		db.mu.Unlock()
+		return err
+	}
+
+	n := db.DBSize
+	if index < 0 || index >= n {
+		db.mu.Unlock()
+		return errors.New("index out of range")
+	}
+
+	moved := index != n-1
+	if gs := db.GroupShuffle; gs != nil && db.groupLen((n-1)/gs.GroupSize, gs.GroupSize) > 1 {
+		// the last group shrinks and is permuted differently
+		moved = true
+	}
+
+	listeners, err := db.resizeLocked(moved, func(slots []*Slot, attributes []uint64) ([]*Slot, []uint64) {
+		res := make([]*Slot, 0, n-1)
+		res = append(append(res, slots[:index]...), slots[index+1:]...)
+
+		if attributes != nil {
+			attrs := make([]uint64, 0, n-1)
+			attributes = append(append(attrs, attributes[:index]...), attributes[index+1:]...)
+		}
+
+		return res, attributes
+	})
+
+	if err == nil {
+		db.records = db.records.deleted(index)
+	}
+
+	epoch := db.Epoch
+	db.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	notifySwap(listeners, epoch)
+
+	return nil
+}
+
+// checkResizableLocked returns ErrFixedLayout if the number of slots cannot change
+func (db *Database) checkResizableLocked() error {
+
+	if db.keywordLayer || db.Keywords != nil || db.KeywordCommitment != nil || db.KeyValue != nil || db.LogTree != nil || db.NumPaddingSlots > 0 {
+		return ErrFixedLayout
+	}
+
+	return nil
+}
+
+// resizeLocked replaces the slots and attributes by the result of edit, which is called
+// with (and returns new slices of) the slots and attributes in logical order.
+// If moved is true, slots held by clients have moved and the epoch is incremented;
+// the listeners to notify are returned in that case
+func (db *Database) resizeLocked(moved bool, edit func([]*Slot, []uint64) ([]*Slot, []uint64)) ([]func(int), error) {
+
+	// sealed records are bound to their index and epoch (see SealData)
+	if moved && db.SlotKeyID != "" {
+		return nil, ErrFixedLayout
+	}
+
+	slots, attributes := db.Slots, db.Attributes
+	if db.GroupShuffle != nil {
+		slots = db.GroupShuffle.unshuffle(slots, db.Epoch)
+		attributes = db.GroupShuffle.applyToAttributes(attributes, db.Epoch, true)
+	}
+
+	// the slots are shuffled with a fresh key in the new epoch (see SwapIn)
+	shuffle := db.GroupShuffle
+	if moved && shuffle != nil {
+		var err error
+		if shuffle, err = newGroupShuffle(shuffle.GroupSize); err != nil {
+			return nil, err
+		}
+	}
+
+	slots, attributes = edit(slots, attributes)
+
+	epoch := db.Epoch
+	if moved {
+		epoch++
+	}
+
+	if shuffle != nil {
+		slots = shuffle.shuffle(slots, epoch)
+		attributes = shuffle.applyToAttributes(attributes, epoch, false)
+	}
+
+	db.Epoch = epoch
+	db.Slots = slots
+	db.Attributes = attributes
+	db.DBSize = len(slots)
+	db.GroupShuffle = shuffle
+
+	// the new slots are not allocated on the nodes
+	db.numaAlloc = nil
+	db.numaPartitions = nil
+
+	if !moved {
+		return nil, nil
+	}
+
+	return db.swapListenersLocked(), nil
+}
+
+// encodeSlotLocked returns a slot containing data encoded like the other slots
+func (db *Database) encodeSlotLocked(data []byte) (*Slot, error) {
+	return db.DBMetadata.encodeSlot(data)
+}
+
+// encodeSlot encodes the data into a slot of the database (see encodeSlotLocked)
+func (dbmd *DBMetadata) encodeSlot(data []byte) (*Slot, error) {
+
+	if dbmd.LengthPrefixed {
+		return NewLengthPrefixedSlot(data, dbmd.SlotBytes)
+	}
+
+	if len(data) > dbmd.SlotBytes {
+		return nil, errors.New("data does not fit in the slot")
+	}
+
+	slotData := make([]byte, dbmd.SlotBytes)
+	copy(slotData, data)
+
+	return NewSlot(slotData), nil
+}
@@ -0,0 +1,239 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// retrieveSlot retrieves the slot at index using a query generated from md
+func retrieveSlot(db *Database, md DBMetadata, index, groupSize int) (*Slot, error) {
+
+	row, pos := md.GroupPosition(index, groupSize)
+	shares := md.NewIndexQueryShares(row, groupSize, 2)
+
+	resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return Recover([]*SecretSharedQueryResult{resA, resB})[pos], nil
+}
+
+// run with 'go test -v -run TestUpdateSlot' to see log outputs.
+func TestUpdateSlot(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	md := db.Metadata()
+
+	index := rand.Intn(TestDBSize)
+	data := NewRandomSlot(SlotBytes).Data
+	if err := db.UpdateSlot(index, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Epoch != md.Epoch || db.DBSize != md.DBSize || db.SlotBytes != md.SlotBytes {
+		t.Fatalf("Metadata changed: %v\n", db.DBMetadata)
+	}
+
+	// queries generated from the old metadata retrieve the new contents
+	slot, err := retrieveSlot(db, md, index, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slot.Equal(NewSlot(data)) {
+		t.Fatalf("Query result is incorrect after update. %v != %v\n", data, slot)
+	}
+
+	if err := db.UpdateSlot(index, make([]byte, SlotBytes+1)); err == nil {
+		t.Fatalf("Updated a slot with data that does not fit\n")
+	}
+
+	if err := db.UpdateSlot(TestDBSize, data); err == nil {
+		t.Fatalf("Updated a slot out of range\n")
+	}
+}
+
+// run with 'go test -v -run TestAppendSlots' to see log outputs.
+func TestAppendSlots(t *testing.T) {
+	setup()
+
+	groupSize := 4
+	db := GenerateRandomDB(TestDBSize-1, SlotBytes) // last group is partial
+	md := db.Metadata()
+
+	first, err := db.AppendSlots([][]byte{{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != TestDBSize-1 || db.DBSize != TestDBSize || db.Epoch != md.Epoch {
+		t.Fatalf("Metadata not updated: first %v, %v\n", first, db.DBMetadata)
+	}
+
+	// the grid dimensions are unchanged so the old metadata is still valid
+	for _, index := range []int{0, first} {
+		slot, err := retrieveSlot(db, md, index, groupSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slot.Equal(db.Slots[index]) {
+			t.Fatalf("Query result is incorrect after append. %v != %v\n", db.Slots[index], slot)
+		}
+	}
+
+	if !db.Slots[first].Equal(NewSlot([]byte{1, 0, 0})) {
+		t.Fatalf("Appended slot is not zero padded: %v\n", db.Slots[first])
+	}
+
+	// the last group of the shuffled slots is full so no slot moves
+	if err := db.ShuffleWithinGroups(groupSize); err != nil {
+		t.Fatal(err)
+	}
+
+	data := [][]byte{{1}, {2, 3}}
+	if first, err = db.AppendSlots(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Epoch != md.Epoch {
+		t.Fatalf("Epoch incremented although no slot moved: %v\n", db.Epoch)
+	}
+
+	for i, d := range data {
+		slot, err := retrieveSlot(db, db.Metadata(), first+i, groupSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := make([]byte, SlotBytes)
+		copy(expected, d)
+		if !slot.Equal(NewSlot(expected)) {
+			t.Fatalf("Appended slot is incorrect. %v != %v\n", expected, slot)
+		}
+	}
+
+	// the last group is now partial and is permuted differently
+	if _, err := db.AppendSlots(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Epoch != md.Epoch+1 {
+		t.Fatalf("Epoch not incremented after slots moved: %v\n", db.Epoch)
+	}
+
+	if slot, err := retrieveSlot(db, db.Metadata(), first+1, groupSize); err != nil || !slot.Equal(NewSlot([]byte{2, 3, 0})) {
+		t.Fatalf("Query result is incorrect after reshuffle: %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestDeleteSlot' to see log outputs.
+func TestDeleteSlot(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	if err := db.SetAttributes(make([]uint64, TestDBSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	notified := -1
+	db.OnSwap(func(epoch int) {
+		notified = epoch
+	})
+
+	original := make([]*Slot, db.DBSize)
+	copy(original, db.Slots)
+
+	// deleting the last slot does not move the others
+	if err := db.DeleteSlot(TestDBSize - 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Epoch != 0 || notified != -1 || db.DBSize != TestDBSize-1 || len(db.Attributes) != db.DBSize {
+		t.Fatalf("Metadata not updated: %v\n", db.DBMetadata)
+	}
+
+	md := db.Metadata()
+	index := rand.Intn(TestDBSize - 2)
+	if err := db.DeleteSlot(index); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Epoch != 1 || notified != 1 || db.DBSize != TestDBSize-2 {
+		t.Fatalf("Epoch not incremented: epoch %v, notified %v\n", db.Epoch, notified)
+	}
+
+	// queries generated before the slots moved are rejected
+	if _, err := retrieveSlot(db, md, index, 1); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+
+	slot, err := retrieveSlot(db, db.Metadata(), index, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slot.Equal(original[index+1]) {
+		t.Fatalf("Slots did not move after delete. %v != %v\n", original[index+1], slot)
+	}
+}
+
+// run with 'go test -v -run TestFixedLayout' to see log outputs.
+func TestFixedLayout(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	if err := db.SetAuthenticatedKeywords(make([]uint, TestDBSize)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.UpdateSlot(0, nil); !errors.Is(err, ErrFixedLayout) {
+		t.Fatalf("Expected ErrFixedLayout, got %v\n", err)
+	}
+
+	if _, err := db.AppendSlots([][]byte{nil}); !errors.Is(err, ErrFixedLayout) {
+		t.Fatalf("Expected ErrFixedLayout, got %v\n", err)
+	}
+
+	key, err := NewSlotKey("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := key.SealData(0, [][]byte{{1}, {2}, {3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db = NewDatabase()
+	if err := db.BuildForSealedData(key.ID, sealed); err != nil {
+		t.Fatal(err)
+	}
+
+	// sealed records cannot move
+	if err := db.DeleteSlot(0); !errors.Is(err, ErrFixedLayout) {
+		t.Fatalf("Expected ErrFixedLayout, got %v\n", err)
+	}
+
+	if err := db.DeleteSlot(2); err != nil {
+		t.Fatal(err)
+	}
+
+	md := db.Metadata()
+	slot, err := retrieveSlot(db, md, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := key.OpenSlot(&md, 1, slot); err != nil || data[0] != 2 {
+		t.Fatalf("Sealed slot is incorrect after delete: %v\n", err)
+	}
+}
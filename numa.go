@@ -0,0 +1,233 @@
+package pir
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+/*
+ NUMA-aware partitioning.
+ On multi-socket servers the scan loops bounce memory across nodes.
+ PartitionForNUMA splits the slots into one contiguous range per node
+ and copies each range into memory allocated by a worker pinned to that
+ node. Secret shared queries are then answered by workers pinned to the
+ node holding the rows they scan.
+*/
+
+// NodeAllocator places memory and workers on NUMA nodes
+type NodeAllocator interface {
+	// NumNodes returns the number of nodes
+	NumNodes() int
+	// Pin binds the calling OS thread to the CPUs of the node
+	Pin(node int) error
+	// Alloc returns numBytes of memory local to the node
+	// (called from a thread pinned to the node)
+	Alloc(node int, numBytes int) []byte
+}
+
+// RowRange is a range of rows [Start, End) stored on Node.
+// Scanning the range from a worker pinned to Node keeps the memory accesses local
+type RowRange struct {
+	Node       int
+	Start, End int
+}
+
+// PartitionForNUMA copies the slots into one contiguous buffer per node (allocated
+// by alloc) so that queries can be answered by workers local to the rows they scan.
+// The partitioning is dropped when the database contents are swapped
+func (db *Database) PartitionForNUMA(alloc NodeAllocator) error {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	numNodes := alloc.NumNodes()
+	if numNodes <= 0 {
+		return errors.New("allocator has no nodes")
+	}
+
+	if len(db.Slots) != db.DBSize {
+		return errors.New("database is not built")
+	}
+
+	perNode := ceilDiv(db.DBSize, numNodes)
+
+	partitions := make([]RowRange, 0, numNodes)
+	for node := 0; node < numNodes; node++ {
+		start := node * perNode
+		end := start + perNode
+		if end > db.DBSize {
+			end = db.DBSize
+		}
+		if start >= end {
+			break
+		}
+		partitions = append(partitions, RowRange{node, start, end})
+	}
+
+	slots := make([]*Slot, len(db.Slots))
+	errs := make([]error, len(partitions))
+
+	var wg sync.WaitGroup
+	for i, part := range partitions {
+		wg.Add(1)
+		go func(i int, part RowRange) {
+			defer wg.Done()
+
+			// the thread is never unlocked so that it exits (rather than
+			// returning pinned to the scheduler) when the goroutine is done
+			runtime.LockOSThread()
+			if err := alloc.Pin(part.Node); err != nil {
+				errs[i] = err
+				return
+			}
+
+			n := db.SlotBytes
+			buf := alloc.Alloc(part.Node, (part.End-part.Start)*n)
+			if len(buf) < (part.End-part.Start)*n {
+				errs[i] = errors.New("allocator returned too little memory")
+				return
+			}
+
+			for s := part.Start; s < part.End; s++ {
+				off := (s - part.Start) * n
+				data := buf[off : off+n : off+n]
+				copy(data, db.Slots[s].Data)
+				slots[s] = &Slot{Data: data}
+			}
+		}(i, part)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	db.Slots = slots
+	db.numaAlloc = alloc
+	db.numaPartitions = partitions
+
+	return nil
+}
+
+// isPartitioned returns true if the partitions cover the current slots
+func (db *Database) isPartitioned() bool {
+	n := len(db.numaPartitions)
+	return n > 0 && db.numaPartitions[n-1].End == len(db.Slots)
+}
+
+// RowRanges splits the rows of a groupSize-wide view of the database into ranges
+// for nprocs workers. When the database is partitioned (see PartitionForNUMA) each
+// range lies within a single node and is tagged with that node as a hint for where
+// the worker scanning it should run; otherwise all ranges are on node 0
+func (db *Database) RowRanges(groupSize, nprocs int) []RowRange {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.rowRanges(groupSize, nprocs)
+}
+
+func (db *Database) rowRanges(groupSize, nprocs int) []RowRange {
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	partitions := db.numaPartitions
+	if !db.isPartitioned() {
+		partitions = []RowRange{{0, 0, db.DBSize}}
+	}
+
+	// split the workers evenly between the nodes
+	workersPerNode := nprocs / len(partitions)
+	if workersPerNode < 1 {
+		workersPerNode = 1
+	}
+
+	ranges := make([]RowRange, 0)
+	for _, part := range partitions {
+		// a row belongs to the node that holds its first slot
+		rowStart := (part.Start + groupSize - 1) / groupSize
+		rowEnd := (part.End + groupSize - 1) / groupSize
+
+		perWorker := ceilDiv(rowEnd-rowStart, workersPerNode)
+		for start := rowStart; start < rowEnd; start += perWorker {
+			end := start + perWorker
+			if end > rowEnd {
+				end = rowEnd
+			}
+			ranges = append(ranges, RowRange{part.Node, start, end})
+		}
+	}
+
+	return ranges
+}
+
+// scanRowsPartitioned XORs the selected rows using workers pinned to the
+// node holding the rows they scan (see PartitionForNUMA)
+func (db *Database) scanRowsPartitioned(results []*Slot, bits []bool, dimWidth int, mask uint64, nprocs int, progress *queryProgress) error {
+
+	ranges := db.rowRanges(dimWidth, nprocs)
+	partial := make([][]*Slot, len(ranges))
+	errs := make([]error, len(ranges))
+
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r RowRange) {
+			defer wg.Done()
+
+			// see PartitionForNUMA for why the thread is not unlocked
+			runtime.LockOSThread()
+			if err := db.numaAlloc.Pin(r.Node); err != nil {
+				errs[i] = err
+				return
+			}
+
+			partial[i] = make([]*Slot, dimWidth)
+			for col := range partial[i] {
+				partial[i][col] = NewEmptySlot(db.SlotBytes)
+			}
+
+			db.xorRows(partial[i], bits, dimWidth, mask, r.Start, r.End)
+			progress.advance(r.End-r.Start, 0)
+		}(i, r)
+	}
+
+	wg.Wait()
+
+	for i := range ranges {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		for col := range results {
+			XorSlots(results[col], partial[i][col])
+		}
+	}
+
+	return nil
+}
+
+// xorRows XORs the slots of the selected rows in [rowStart, rowEnd) into results
+// (skipping slots whose attributes do not match mask). Every row is visited so that
+// the running time does not depend on the bits (see ConditionalXorSlots)
+func (db *Database) xorRows(results []*Slot, bits []bool, dimWidth int, mask uint64, rowStart, rowEnd int) {
+
+	for row := rowStart; row < rowEnd; row++ {
+		for col := 0; col < dimWidth; col++ {
+			slotIndex := row*dimWidth + col
+			// xor if bit is set and within bounds
+			if slotIndex >= len(db.Slots) {
+				break
+			}
+
+			if db.matchesAttributes(slotIndex, mask) {
+				ConditionalXorSlots(results[col], db.Slots[slotIndex], bits[row])
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package pir
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// SysfsNUMAAllocator pins threads to the CPUs of each node (as listed in
+// /sys/devices/system/node) and allocates memory that is first touched by
+// the pinned thread so that the kernel places it on that node
+type SysfsNUMAAllocator struct {
+	cpus [][]int // CPUs of each node
+}
+
+// NewSysfsNUMAAllocator reads the NUMA topology from sysfs
+func NewSysfsNUMAAllocator() (*SysfsNUMAAllocator, error) {
+
+	dirs, err := filepath.Glob("/sys/devices/system/node/node[0-9]*")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dirs) == 0 {
+		return nil, errors.New("no NUMA nodes found in sysfs")
+	}
+
+	// order the nodes by number (node10 after node9)
+	sort.Slice(dirs, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(dirs[i]), "node"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(filepath.Base(dirs[j]), "node"))
+		return a < b
+	})
+
+	alloc := &SysfsNUMAAllocator{}
+	for _, dir := range dirs {
+		list, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+
+		cpus, err := parseCPUList(strings.TrimSpace(string(list)))
+		if err != nil {
+			return nil, err
+		}
+
+		// skip memory-only nodes
+		if len(cpus) > 0 {
+			alloc.cpus = append(alloc.cpus, cpus)
+		}
+	}
+
+	if len(alloc.cpus) == 0 {
+		return nil, errors.New("no NUMA nodes with CPUs found in sysfs")
+	}
+
+	return alloc, nil
+}
+
+// NumNodes returns the number of nodes with CPUs
+func (alloc *SysfsNUMAAllocator) NumNodes() int {
+	return len(alloc.cpus)
+}
+
+// Pin sets the CPU affinity of the calling thread to the CPUs of the node
+func (alloc *SysfsNUMAAllocator) Pin(node int) error {
+
+	if node < 0 || node >= len(alloc.cpus) {
+		return errors.New("invalid NUMA node")
+	}
+
+	maxCPU := 0
+	for _, cpu := range alloc.cpus[node] {
+		if cpu > maxCPU {
+			maxCPU = cpu
+		}
+	}
+
+	mask := make([]uint64, maxCPU/64+1)
+	for _, cpu := range alloc.cpus[node] {
+		mask[cpu/64] |= 1 << uint(cpu%64)
+	}
+
+	_, _, errno := syscall.RawSyscall(
+		syscall.SYS_SCHED_SETAFFINITY,
+		0, // calling thread
+		uintptr(len(mask)*8),
+		uintptr(unsafe.Pointer(&mask[0])))
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// Alloc returns numBytes of memory. Memory obtained from the OS is placed on the
+// node of the thread that first touches it; the caller is expected to be pinned
+// to the node and to write the memory before other threads read it
+func (alloc *SysfsNUMAAllocator) Alloc(node int, numBytes int) []byte {
+	return make([]byte, numBytes)
+}
+
+// parseCPUList parses a sysfs CPU list (e.g., "0-3,8,10-11")
+func parseCPUList(list string) ([]int, error) {
+
+	cpus := make([]int, 0)
+	if list == "" {
+		return cpus, nil
+	}
+
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+
+		lo, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+
+		hi := lo
+		if len(bounds) == 2 {
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+
+		for cpu := lo; cpu <= hi; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
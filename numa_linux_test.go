@@ -0,0 +1,25 @@
+package pir
+
+import "testing"
+
+func TestParseCPUList(t *testing.T) {
+
+	cpus, err := parseCPUList("0-3,8,10-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []int{0, 1, 2, 3, 8, 10, 11}
+	if len(cpus) != len(expected) {
+		t.Fatalf("Expected %v got %v\n", expected, cpus)
+	}
+	for i := range cpus {
+		if cpus[i] != expected[i] {
+			t.Fatalf("Expected %v got %v\n", expected, cpus)
+		}
+	}
+
+	if _, err := parseCPUList("0-x"); err == nil {
+		t.Fatalf("Parsed an invalid CPU list")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package pir
+
+import "errors"
+
+// SysfsNUMAAllocator is only available on Linux
+type SysfsNUMAAllocator struct{}
+
+// NewSysfsNUMAAllocator returns an error on platforms other than Linux
+func NewSysfsNUMAAllocator() (*SysfsNUMAAllocator, error) {
+	return nil, errors.New("NUMA allocation is only supported on Linux")
+}
+
+// NumNodes returns 0
+func (alloc *SysfsNUMAAllocator) NumNodes() int { return 0 }
+
+// Pin returns an error
+func (alloc *SysfsNUMAAllocator) Pin(node int) error {
+	return errors.New("NUMA allocation is only supported on Linux")
+}
+
+// Alloc returns numBytes of memory
+func (alloc *SysfsNUMAAllocator) Alloc(node int, numBytes int) []byte {
+	return make([]byte, numBytes)
+}
@@ -0,0 +1,152 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// fakeNUMAAllocator simulates nodes without pinning threads
+type fakeNUMAAllocator struct {
+	sync.Mutex
+	numNodes int
+	pins     map[int]int
+	fail     bool
+}
+
+func (alloc *fakeNUMAAllocator) NumNodes() int { return alloc.numNodes }
+
+func (alloc *fakeNUMAAllocator) Pin(node int) error {
+	alloc.Lock()
+	defer alloc.Unlock()
+
+	if alloc.fail {
+		return errors.New("pin failed")
+	}
+
+	alloc.pins[node]++
+	return nil
+}
+
+func (alloc *fakeNUMAAllocator) Alloc(node int, numBytes int) []byte {
+	return make([]byte, numBytes)
+}
+
+// run with 'go test -v -run TestNUMAPartitionedQuery' to see log outputs.
+func TestNUMAPartitionedQuery(t *testing.T) {
+	setup()
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize *= 2 {
+
+		db := GenerateRandomDB(TestDBSize+3, SlotBytes)
+		original := GenerateRandomDB(db.DBSize, SlotBytes)
+		for i := range db.Slots {
+			copy(original.Slots[i].Data, db.Slots[i].Data)
+		}
+
+		alloc := &fakeNUMAAllocator{numNodes: 3, pins: make(map[int]int)}
+		if err := db.PartitionForNUMA(alloc); err != nil {
+			t.Fatal(err)
+		}
+
+		for node := 0; node < alloc.numNodes; node++ {
+			if alloc.pins[node] != 1 {
+				t.Fatalf("Node %v was not pinned while partitioning\n", node)
+			}
+		}
+
+		// the ranges cover all rows and each range is on a single node
+		dimHeight := (db.DBSize + groupSize - 1) / groupSize
+		next := 0
+		for _, r := range db.RowRanges(groupSize, 8) {
+			if r.Start != next || r.End <= r.Start {
+				t.Fatalf("Row ranges are not contiguous: %v\n", db.RowRanges(groupSize, 8))
+			}
+			next = r.End
+		}
+		if next != dimHeight {
+			t.Fatalf("Row ranges end at %v; expected %v\n", next, dimHeight)
+		}
+
+		for i := 0; i < NumQueries/10; i++ {
+			index := rand.Intn(dimHeight)
+			shares := db.NewIndexQueryShares(index, groupSize, 2)
+
+			resA, err := db.PrivateSecretSharedQuery(shares[0], 8)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resB, err := db.PrivateSecretSharedQuery(shares[1], 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res := Recover([]*SecretSharedQueryResult{resA, resB})
+			for j := 0; j < groupSize && index*groupSize+j < db.DBSize; j++ {
+				if !original.Slots[index*groupSize+j].Equal(res[j]) {
+					t.Fatalf("Query result is incorrect. %v != %v\n", original.Slots[index*groupSize+j], res[j])
+				}
+			}
+		}
+
+		// failures to pin are returned by the query
+		alloc.fail = true
+		shares := db.NewIndexQueryShares(0, groupSize, 2)
+		if _, err := db.PrivateSecretSharedQuery(shares[0], 8); err == nil {
+			t.Fatalf("Query succeeded without pinning")
+		}
+
+		// swapping drops the partitions
+		if err := db.SwapIn(original.Slots); err != nil {
+			t.Fatal(err)
+		}
+		if r := db.RowRanges(groupSize, 1); len(r) != 1 || r[0].Node != 0 {
+			t.Fatalf("Partitions not dropped after swap: %v\n", r)
+		}
+	}
+}
+
+// BenchmarkNUMAPartitionedQuery compares the pinned scan to the same scan without pinning.
+// Run on a multi-socket machine to see the effect of NUMA placement
+func BenchmarkNUMAPartitionedQuery(b *testing.B) {
+	setup()
+
+	alloc, err := NewSysfsNUMAAllocator()
+	if err != nil {
+		b.Skip(err)
+	}
+
+	// the baseline splits the scan in the same way without pinning the workers
+	unpinned := &fakeNUMAAllocator{numNodes: alloc.NumNodes(), pins: make(map[int]int)}
+
+	for _, partitioned := range []bool{false, true} {
+		db := GenerateRandomDB(BenchmarkDBSize, SlotBytes)
+
+		var nodeAlloc NodeAllocator = unpinned
+		if partitioned {
+			nodeAlloc = alloc
+		}
+
+		if err := db.PartitionForNUMA(nodeAlloc); err != nil {
+			b.Fatal(err)
+		}
+
+		shares := db.NewIndexQueryShares(0, 1, 2)
+		bits := make([]bool, db.DBSize)
+		for i := range bits {
+			bits[i] = rand.Intn(2) == 0
+		}
+
+		name := "unpinned"
+		if partitioned {
+			name = "partitioned"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				db.PrivateSecretSharedQueryWithExpandedBits(shares[0], bits, NumProcsForQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+/*
+ Stable slot ordering.
+ The Build functions (BuildForData, BuildForDataWithSlotSize,
+ BuildFromFunc, BuildFromFuncParallel, BuildForBinaryData,
+ BuildForBinaryDataWithSlotSize and BuildForPaddedBinaryData) store the
+ i-th value of their input in the slot at (logical) index i, whatever the
+ slot size, the number of processes or the storage order of the slots
+ (see ShuffleWithinGroups). Clients and servers built from the same
+ source data therefore agree on the index of every value without
+ exchanging a mapping: both hash the values with HashRecord and look the
+ hashes up in a RecordIndex (the server builds one when the database is
+ built, see Database.IndexOf). Values are hashed as given to the Build
+ function (strings as their bytes), not as stored in the slots.
+ Duplicate values map to the lowest index holding them.
+ UpdateSlot, AppendSlots and DeleteSlot keep the index of the database up
+ to date; contents set in any other way (SwapIn, BuildForRecords, ...)
+ have no index.
+*/
+
+// ErrNoRecordIndex is returned by Database.IndexOf when the contents of
+// the database were not built from source values
+var ErrNoRecordIndex = errors.New("database has no record index")
+
+// ErrRecordNotFound is returned when no slot holds a record
+var ErrRecordNotFound = errors.New("record not found")
+
+// recordHashDomain separates the record hashes from other uses of the hash function
+const recordHashDomain = "pir-record-v1"
+
+// RecordHash identifies a source value (see HashRecord)
+type RecordHash [sha256.Size]byte
+
+// HashRecord returns the hash of a source value
+func HashRecord(data []byte) RecordHash {
+
+	h := sha256.New()
+	h.Write([]byte(recordHashDomain))
+	h.Write(data)
+
+	var res RecordHash
+	h.Sum(res[:0])
+
+	return res
+}
+
+// RecordIndex maps the hashes of source values to their indices.
+// A RecordIndex is not modified once built and can be shared
+type RecordIndex struct {
+	hashes  []RecordHash // hash of the value at each index
+	indices map[RecordHash]int
+}
+
+// NewRecordIndex returns the index of the values as stored by the Build functions
+// (value i at index i)
+func NewRecordIndex(data [][]byte) *RecordIndex {
+
+	hashes := make([]RecordHash, len(data))
+	for i := range data {
+		hashes[i] = HashRecord(data[i])
+	}
+
+	return newRecordIndexForHashes(hashes)
+}
+
+// NewRecordIndexForStrings is NewRecordIndex for values given as strings (see BuildForData)
+func NewRecordIndexForStrings(data []string) *RecordIndex {
+
+	hashes := make([]RecordHash, len(data))
+	for i := range data {
+		hashes[i] = HashRecord([]byte(data[i]))
+	}
+
+	return newRecordIndexForHashes(hashes)
+}
+
+func newRecordIndexForHashes(hashes []RecordHash) *RecordIndex {
+
+	ri := &RecordIndex{
+		hashes:  hashes,
+		indices: make(map[RecordHash]int, len(hashes)),
+	}
+
+	// duplicates keep the lowest index
+	for i := len(hashes) - 1; i >= 0; i-- {
+		ri.indices[hashes[i]] = i
+	}
+
+	return ri
+}
+
+// IndexOf returns the lowest index of the value with the hash
+// or ErrRecordNotFound if no value has the hash
+func (ri *RecordIndex) IndexOf(hash RecordHash) (int, error) {
+
+	index, ok := ri.indices[hash]
+	if !ok {
+		return 0, ErrRecordNotFound
+	}
+
+	return index, nil
+}
+
+// Len returns the number of indexed values
+func (ri *RecordIndex) Len() int {
+	return len(ri.hashes)
+}
+
+// updated returns a copy of the index with the value at index replaced by data
+// (nil if ri is nil)
+func (ri *RecordIndex) updated(index int, data []byte) *RecordIndex {
+
+	if ri == nil {
+		return nil
+	}
+
+	hashes := make([]RecordHash, len(ri.hashes))
+	copy(hashes, ri.hashes)
+	hashes[index] = HashRecord(data)
+
+	return newRecordIndexForHashes(hashes)
+}
+
+// appended returns a copy of the index with the values of data added at the end
+// (nil if ri is nil)
+func (ri *RecordIndex) appended(data [][]byte) *RecordIndex {
+
+	if ri == nil {
+		return nil
+	}
+
+	hashes := make([]RecordHash, len(ri.hashes), len(ri.hashes)+len(data))
+	copy(hashes, ri.hashes)
+	for i := range data {
+		hashes = append(hashes, HashRecord(data[i]))
+	}
+
+	return newRecordIndexForHashes(hashes)
+}
+
+// deleted returns a copy of the index without the value at index
+// (nil if ri is nil)
+func (ri *RecordIndex) deleted(index int) *RecordIndex {
+
+	if ri == nil {
+		return nil
+	}
+
+	hashes := make([]RecordHash, 0, len(ri.hashes)-1)
+	hashes = append(append(hashes, ri.hashes[:index]...), ri.hashes[index+1:]...)
+
+	return newRecordIndexForHashes(hashes)
+}
+
+// IndexOf returns the (logical) index of the slot holding the source value with the hash
+// (see HashRecord). Returns ErrRecordNotFound if no slot holds the value or
+// ErrNoRecordIndex if the contents were not built from source values
+func (db *Database) IndexOf(hash RecordHash) (int, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.records == nil {
+		return 0, ErrNoRecordIndex
+	}
+
+	return db.records.IndexOf(hash)
+}
+
+// RecordIndex returns the index of the source values of the database
+// (nil if the contents were not built from source values)
+func (db *Database) RecordIndex() *RecordIndex {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.records
+}
@@ -0,0 +1,136 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// run with 'go test -v -run TestStableOrdering' to see log outputs.
+func TestStableOrdering(t *testing.T) {
+	setup()
+
+	n := 100
+	values := make([][]byte, n)
+	strs := make([]string, n)
+	for i := range values {
+		strs[i] = fmt.Sprintf("value %v", i%90) // last values are duplicates
+		values[i] = []byte(strs[i])
+	}
+
+	// client-side index computed from the source values only
+	ri := NewRecordIndex(values)
+	if ri.Len() != n {
+		t.Fatalf("Index has %v values instead of %v\n", ri.Len(), n)
+	}
+
+	dbs := map[string]*Database{}
+
+	dbs["strings"] = NewDatabase()
+	dbs["strings"].BuildForData(strs)
+
+	dbs["binary"] = NewDatabase()
+	if err := dbs["binary"].BuildForBinaryData(values); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nprocs := range []int{1, 7} {
+		db := NewDatabase()
+		if err := db.BuildFromFuncParallel(n, 16, func(i int) []byte { return values[i] }, nprocs); err != nil {
+			t.Fatal(err)
+		}
+		dbs[fmt.Sprintf("func/%v", nprocs)] = db
+	}
+
+	for name, db := range dbs {
+		for i := range values {
+			index, err := db.IndexOf(HashRecord(values[i]))
+			if err != nil {
+				t.Fatalf("%v: %v\n", name, err)
+			}
+
+			expected, _ := ri.IndexOf(HashRecord(values[i]))
+			if index != expected || index != i%90 {
+				t.Fatalf("%v: value %v is at index %v (client index %v)\n", name, i, index, expected)
+			}
+		}
+
+		if _, err := db.IndexOf(HashRecord([]byte("missing"))); !errors.Is(err, ErrRecordNotFound) {
+			t.Fatalf("%v: expected ErrRecordNotFound, got %v\n", name, err)
+		}
+	}
+
+	// the index is logical: queries for it retrieve the value after shuffling
+	db := dbs["func/7"]
+	if err := db.ShuffleWithinGroups(4); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := db.IndexOf(HashRecord(values[42]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slot, err := retrieveSlot(db, db.Metadata(), index, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := make([]byte, 16)
+	copy(expected, values[42])
+	if !slot.Equal(NewSlot(expected)) {
+		t.Fatalf("Query for the index of the value is incorrect. %v != %v\n", expected, slot)
+	}
+}
+
+// run with 'go test -v -run TestRecordIndexMutations' to see log outputs.
+func TestRecordIndexMutations(t *testing.T) {
+	setup()
+
+	values := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}
+
+	db := NewDatabase()
+	if err := db.BuildForBinaryDataWithSlotSize(values, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	indexOf := func(value string) int {
+		index, err := db.IndexOf(HashRecord([]byte(value)))
+		if errors.Is(err, ErrRecordNotFound) {
+			return -1
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index
+	}
+
+	if err := db.UpdateSlot(1, []byte("e")); err != nil {
+		t.Fatal(err)
+	}
+	if indexOf("b") != -1 || indexOf("e") != 1 {
+		t.Fatalf("Index not updated: b at %v, e at %v\n", indexOf("b"), indexOf("e"))
+	}
+
+	if _, err := db.AppendSlots([][]byte{[]byte("f")}); err != nil {
+		t.Fatal(err)
+	}
+	if indexOf("f") != 4 {
+		t.Fatalf("Appended value at %v instead of 4\n", indexOf("f"))
+	}
+
+	if err := db.DeleteSlot(0); err != nil {
+		t.Fatal(err)
+	}
+	if indexOf("a") != -1 || indexOf("c") != 1 || indexOf("f") != 3 {
+		t.Fatalf("Index not updated after delete: c at %v, f at %v\n", indexOf("c"), indexOf("f"))
+	}
+
+	// contents swapped in without source values have no index
+	if err := db.SwapIn([]*Slot{NewRandomSlot(8)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.IndexOf(HashRecord([]byte("c"))); !errors.Is(err, ErrNoRecordIndex) {
+		t.Fatalf("Expected ErrNoRecordIndex, got %v\n", err)
+	}
+}
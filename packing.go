@@ -0,0 +1,159 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Packed encrypted results.
+ Each ciphertext of an encrypted result encrypts NumBytesPerCiphertext
+ bytes of a slot, which is a small part of the plaintext space when the
+ slots are small (e.g., 16 bytes out of the 254 bytes of a 2048 bit key),
+ so the result of a query retrieving many slots (large groups or wide
+ layouts) is mostly ciphertext overhead. PackEncryptedResult combines
+ the ciphertexts of a result homomorphically: the ciphertexts of the
+ slots (in order) are split into runs of PackingFactor ciphertexts and
+ the j-th ciphertext of a run is shifted by j*NumBytesPerCiphertext
+ bytes and added to the packed ciphertext of the run. The plaintexts of
+ a run do not overlap and fit in the plaintext space, so the client
+ decrypts each packed ciphertext once and splits it (see
+ RecoverEncrypted). The download shrinks by up to PackingFactor at the
+ cost of an exponentiation per ciphertext of the result on the server.
+ Packing does not change what the server learns; it only applies to
+ results of (singly) encrypted queries.
+*/
+
+// PackedCiphertexts are the ciphertexts of the slots of an encrypted result
+// packed PackingFactor to a ciphertext (see PackEncryptedResult)
+type PackedCiphertexts struct {
+	Cts                   []*paillier.Ciphertext
+	NumSlots              int // slots of the result
+	NumCiphertextsPerSlot int // ciphertexts of each slot before packing
+	PackingFactor         int // ciphertexts packed into each ciphertext
+}
+
+// PrivateEncryptedQueryPacked answers the encrypted query with a packed result
+// (see PrivateEncryptedQuery and PackEncryptedResult)
+func (db *Database) PrivateEncryptedQueryPacked(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	res, err := db.PrivateEncryptedQuery(query, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	return PackEncryptedResult(res, nprocs)
+}
+
+// PackEncryptedResult returns the result with the ciphertexts of its slots packed into
+// as few ciphertexts as the plaintext space allows. The result is returned unchanged
+// if it is already packed or if no two ciphertexts fit in one
+func PackEncryptedResult(res *EncryptedQueryResult, nprocs int) (*EncryptedQueryResult, error) {
+
+	if res.Packed != nil || len(res.Slots) == 0 {
+		return res, nil
+	}
+
+	numCiphertextsPerSlot := len(res.Slots[0].Cts)
+	for _, slot := range res.Slots {
+		if slot == nil || len(slot.Cts) != numCiphertextsPerSlot {
+			return nil, errors.New("all encrypted slots must have the same number of ciphertexts")
+		}
+	}
+
+	// empty results encode every slot in zero bytes
+	numBytesPerCiphertext := res.NumBytesPerCiphertext
+	if numBytesPerCiphertext < 1 {
+		numBytesPerCiphertext = 1
+	}
+
+	factor := msgSpaceBytes(res.Pk) / numBytesPerCiphertext
+	if factor < 2 {
+		return res, nil
+	}
+
+	cts := make([]*paillier.Ciphertext, 0, len(res.Slots)*numCiphertextsPerSlot)
+	for _, slot := range res.Slots {
+		cts = append(cts, slot.Cts...)
+	}
+
+	shift := new(gmp.Int).Lsh(gmp.NewInt(1), uint(8*numBytesPerCiphertext))
+	packed := make([]*paillier.Ciphertext, ceilDiv(len(cts), factor))
+
+	err := parallelRanges(context.Background(), len(packed), nprocs, func(w, first, last int) error {
+		for i := first; i < last; i++ {
+			end := (i + 1) * factor
+			if end > len(cts) {
+				end = len(cts)
+			}
+			run := cts[i*factor : end]
+
+			// Horner's rule from the most significant ciphertext of the run
+			ct := run[len(run)-1]
+			for j := len(run) - 2; j >= 0; j-- {
+				ct = res.Pk.Add(res.Pk.ConstMult(ct, shift), run[j])
+			}
+			packed[i] = ct
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedQueryResult{
+		Pk:                    res.Pk,
+		KeyFingerprint:        res.KeyFingerprint,
+		SlotBytes:             res.SlotBytes,
+		NumBytesPerCiphertext: res.NumBytesPerCiphertext,
+		Packed: &PackedCiphertexts{
+			Cts:                   packed,
+			NumSlots:              len(res.Slots),
+			NumCiphertextsPerSlot: numCiphertextsPerSlot,
+			PackingFactor:         factor,
+		},
+	}, nil
+}
+
+// unpack decrypts the packed ciphertexts and returns the plaintexts of the
+// ciphertexts of each slot
+func (p *PackedCiphertexts) unpack(sk *paillier.SecretKey, numBytesPerCiphertext int) ([][]*gmp.Int, error) {
+
+	if p.NumSlots < 0 || p.NumCiphertextsPerSlot < 0 || p.PackingFactor < 1 || p.PackingFactor > msgSpaceBytes(&sk.PublicKey) {
+		return nil, errors.New("malformed packed result")
+	}
+
+	numCiphertexts := p.NumSlots * p.NumCiphertextsPerSlot
+	if len(p.Cts) != ceilDiv(numCiphertexts, p.PackingFactor) {
+		return nil, fmt.Errorf("expected %v packed ciphertexts, got %v",
+			ceilDiv(numCiphertexts, p.PackingFactor), len(p.Cts))
+	}
+
+	if numBytesPerCiphertext < 1 {
+		numBytesPerCiphertext = 1
+	}
+
+	bits := uint(8 * numBytesPerCiphertext)
+	modulus := new(gmp.Int).Lsh(gmp.NewInt(1), bits)
+
+	vals := make([]*gmp.Int, 0, numCiphertexts)
+	for _, ct := range p.Cts {
+		m := sk.Decrypt(ct)
+		for j := 0; j < p.PackingFactor && len(vals) < numCiphertexts; j++ {
+			vals = append(vals, new(gmp.Int).Mod(m, modulus))
+			m = new(gmp.Int).Rsh(m, bits)
+		}
+	}
+
+	slots := make([][]*gmp.Int, p.NumSlots)
+	for i := range slots {
+		slots[i] = vals[i*p.NumCiphertextsPerSlot : (i+1)*p.NumCiphertextsPerSlot]
+	}
+
+	return slots, nil
+}
@@ -0,0 +1,109 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+func TestPackedEncryptedQuery(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(512)
+
+	for _, slotBytes := range []int{1, 4, 20} {
+		db := GenerateRandomDB(TestDBSize, slotBytes)
+		width, height := 40, ceilDiv(TestDBSize, 40)
+
+		for trial := 0; trial < NumTrials; trial++ {
+			row := trial % height
+			query := db.NewEncryptedQueryWithDimentions(pk, width, height, 1, row)
+
+			res, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			packed, err := db.PrivateEncryptedQueryPacked(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			numCts := len(res.Slots) * len(res.Slots[0].Cts)
+			if packed.Packed == nil || len(packed.Packed.Cts) >= numCts {
+				t.Fatalf("Result of %v ciphertexts was not packed (slots of %v bytes)\n", numCts, slotBytes)
+			}
+
+			// the packed result survives the wire
+			b, err := packed.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := &EncryptedQueryResult{}
+			if err := decoded.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+
+			slots := recoverEncrypted(t, decoded, sk)
+			for col, slot := range slots {
+				index := row*width + col
+				if index < TestDBSize && !slot.Equal(db.Slots[index]) {
+					t.Fatalf("Packed result is incorrect at %v. %v != %v\n", index, db.Slots[index], slot)
+				}
+			}
+
+			// packing an unpacked result is the same as answering a packed query
+			repacked, err := PackEncryptedResult(res, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for col, slot := range recoverEncrypted(t, repacked, sk) {
+				if !slot.Equal(slots[col]) {
+					t.Fatalf("Repacked result is incorrect at column %v\n", col)
+				}
+			}
+		}
+	}
+}
+
+func TestPackedEncryptedQueryLargeSlots(t *testing.T) {
+	setup()
+
+	// a ciphertext holds less than two chunks of the slots
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, 20)
+
+	query := db.NewEncryptedQueryWithDimentions(pk, 10, ceilDiv(TestDBSize, 10), 1, 0)
+	res, err := db.PrivateEncryptedQueryPacked(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Packed != nil {
+		t.Fatalf("Packed a result that does not fit\n")
+	}
+
+	for col, slot := range recoverEncrypted(t, res, sk) {
+		if !slot.Equal(db.Slots[col]) {
+			t.Fatalf("Result is incorrect at %v\n", col)
+		}
+	}
+
+	// packed results are pinned to the key of the query as well
+	otherSk, _ := paillier.KeyGen(512)
+	_, pk = paillier.KeyGen(512)
+	db = GenerateRandomDB(TestDBSize, 4)
+
+	query = db.NewEncryptedQueryWithDimentions(pk, 10, ceilDiv(TestDBSize, 10), 1, 0)
+	res, err = db.PrivateEncryptedQueryPacked(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RecoverEncrypted(res, otherSk); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("Recovered a packed result with the wrong key (%v)\n", err)
+	}
+}
@@ -0,0 +1,157 @@
+package pir
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+
+	"github.com/sachaservan/paillier"
+)
+
+// DefaultPublicKeyCacheSize is the number of public keys for which
+// a database caches derived values unless configured otherwise
+const DefaultPublicKeyCacheSize = 16
+
+// PublicKeyFingerprint returns a digest identifying the public key
+func PublicKeyFingerprint(pk *paillier.PublicKey) KeyFingerprint {
+	return sha256.Sum256(pk.N.Bytes())
+}
+
+// pkParams are the values derived from a public key (and the slot size)
+// that are needed to answer encrypted queries
+type pkParams struct {
+	msgSpaceBytes         int
+	numCiphertextsPerSlot int
+	nullLevelOne          *paillier.Ciphertext
+	nullLevelTwo          *paillier.Ciphertext
+}
+
+type pkCacheEntry struct {
+	fingerprint KeyFingerprint
+	params      *pkParams
+}
+
+// publicKeyCache is an LRU cache of pkParams keyed by public key fingerprint.
+// The zero value is a cache of DefaultPublicKeyCacheSize entries
+type publicKeyCache struct {
+	mu         sync.Mutex
+	size       int
+	configured bool
+	entries    map[KeyFingerprint]*list.Element
+	order      *list.List // most recently used first
+
+	hits, misses uint64 // lookups since the database was created
+}
+
+// SetPublicKeyCacheSize sets the maximum number of public keys for which
+// derived values are cached; size <= 0 disables caching
+func (db *Database) SetPublicKeyCacheSize(size int) {
+
+	c := &db.pkCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.size = size
+	c.configured = true
+
+	for c.order != nil && c.order.Len() > 0 && c.order.Len() > c.capacity() {
+		c.evictOldest()
+	}
+}
+
+// ClearPublicKeyCache evicts all cached public key values
+func (db *Database) ClearPublicKeyCache() {
+	db.pkCache.clear()
+}
+
+// paramsForPublicKey returns the (possibly cached) values derived from pk
+func (db *Database) paramsForPublicKey(pk *paillier.PublicKey) *pkParams {
+
+	c := &db.pkCache
+	fingerprint := PublicKeyFingerprint(pk)
+
+	c.mu.Lock()
+	if elem, ok := c.entries[fingerprint]; ok {
+		c.hits++
+		c.order.MoveToFront(elem)
+		params := elem.Value.(*pkCacheEntry).params
+		c.mu.Unlock()
+		return params
+	}
+	c.misses++
+	c.mu.Unlock()
+
+	// compute without holding the lock
+	params := newPkParams(pk, db.SlotBytes)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity() <= 0 {
+		return params
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[KeyFingerprint]*list.Element)
+		c.order = list.New()
+	}
+
+	if _, ok := c.entries[fingerprint]; !ok {
+		c.entries[fingerprint] = c.order.PushFront(&pkCacheEntry{fingerprint, params})
+		if c.order.Len() > c.capacity() {
+			c.evictOldest()
+		}
+	}
+
+	return params
+}
+
+func newPkParams(pk *paillier.PublicKey, slotBytes int) *pkParams {
+
+	// how many ciphertexts are needed to represent a slot
+	msgBytes := msgSpaceBytes(pk)
+	numCiphertextsPerSlot := ceilDiv(slotBytes, msgBytes)
+
+	return &pkParams{
+		msgSpaceBytes:         msgBytes,
+		numCiphertextsPerSlot: numCiphertextsPerSlot,
+		nullLevelOne:          nullCiphertext(pk, paillier.EncLevelOne),
+		nullLevelTwo:          nullCiphertext(pk, paillier.EncLevelTwo),
+	}
+}
+
+// msgSpaceBytes returns the number of bytes that fit in the plaintext space of pk
+func msgSpaceBytes(pk *paillier.PublicKey) int {
+	return len(pk.N.Bytes()) - 2
+}
+
+func (c *publicKeyCache) capacity() int {
+	if !c.configured {
+		return DefaultPublicKeyCacheSize
+	}
+	return c.size
+}
+
+func (c *publicKeyCache) evictOldest() {
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.entries, oldest.Value.(*pkCacheEntry).fingerprint)
+}
+
+func (c *publicKeyCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.order == nil {
+		return 0
+	}
+	return c.order.Len()
+}
+
+func (c *publicKeyCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	c.order = nil
+}
@@ -0,0 +1,50 @@
+package pir
+
+import (
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+func TestPublicKeyCache(t *testing.T) {
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	_, pk1 := paillier.KeyGen(128)
+	_, pk2 := paillier.KeyGen(128)
+
+	if db.paramsForPublicKey(pk1) != db.paramsForPublicKey(pk1) {
+		t.Fatalf("Values for the same public key were not cached")
+	}
+
+	db.SetPublicKeyCacheSize(1)
+	db.paramsForPublicKey(pk2)
+	if db.pkCache.len() != 1 {
+		t.Fatalf("Cache has %v entries, expected 1", db.pkCache.len())
+	}
+
+	if _, ok := db.pkCache.entries[PublicKeyFingerprint(pk1)]; ok {
+		t.Fatalf("Least recently used public key was not evicted")
+	}
+
+	db.SetPublicKeyCacheSize(0)
+	db.paramsForPublicKey(pk1)
+	if db.pkCache.len() != 0 {
+		t.Fatalf("Disabled cache has %v entries", db.pkCache.len())
+	}
+
+	db.SetPublicKeyCacheSize(DefaultPublicKeyCacheSize)
+	db.paramsForPublicKey(pk1)
+	if err := db.SwapIn(GenerateRandomDB(TestDBSize, SlotBytes*100).Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.pkCache.len() != 0 {
+		t.Fatalf("Cache was not invalidated by SwapIn")
+	}
+
+	params := db.paramsForPublicKey(pk1)
+	if params.numCiphertextsPerSlot <= 1 {
+		t.Fatalf("Values were not recomputed for the new slot size")
+	}
+}
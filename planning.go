@@ -0,0 +1,186 @@
+package pir
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+/*
+ Deployment planning from target latency.
+ The time to answer a query is (roughly) linear in the number of rows
+ and slots scanned and inversely proportional to the number of
+ processes. Given the measured costs of a scheme (e.g., the 95th
+ percentile over dry runs on the target hardware), FeasiblePlans lists
+ the largest database that each combination of group size, recursion
+ depth and number of processes answers within the target latency, and
+ the number of shards needed to serve a database of the required size.
+*/
+
+// SchemeCost is the measured cost of a scheme for a single process
+type SchemeCost struct {
+	Scheme        Scheme
+	PerRow        time.Duration // per row scanned (e.g., DPF evaluation)
+	PerSlot       time.Duration // per slot of each row scanned
+	PerColumnSlot time.Duration // per (encrypted) slot of the column pass (recursion depth 2)
+}
+
+// SchemeCostFromDryRuns returns the 95th percentile of the costs measured by the dry runs
+// (see DryRunQuery) executed with nprocs processes
+func SchemeCostFromDryRuns(scheme Scheme, nprocs int, reports ...*DryRunReport) (SchemeCost, error) {
+
+	cost := SchemeCost{Scheme: scheme}
+	if len(reports) == 0 || nprocs <= 0 {
+		return cost, errors.New("need at least one dry run")
+	}
+
+	perRow := make([]time.Duration, 0, len(reports))
+	perSlot := make([]time.Duration, 0, len(reports))
+	perColumnSlot := make([]time.Duration, 0, len(reports))
+
+	for _, r := range reports {
+		if r.NumRows == 0 || r.DBSize == 0 {
+			return cost, errors.New("dry run did not scan any rows")
+		}
+
+		// the expansion is the only per-row work that does not depend on the slots
+		perRow = append(perRow, r.Expand*time.Duration(nprocs)/time.Duration(r.NumRows))
+		perSlot = append(perSlot, r.Scan*time.Duration(nprocs)/time.Duration(r.DBSize))
+
+		width := (r.DBSize + r.NumRows - 1) / r.NumRows
+		perColumnSlot = append(perColumnSlot, r.Columns*time.Duration(nprocs)/time.Duration(width))
+	}
+
+	cost.PerRow = percentile95(perRow)
+	cost.PerSlot = percentile95(perSlot)
+	cost.PerColumnSlot = percentile95(perColumnSlot)
+
+	return cost, nil
+}
+
+// maxRecursionDepth returns the largest recursion depth supported by the scheme:
+// secret shared schemes scan the database once and encrypted schemes can
+// recursively query the result of the row query (see PrivateDoublyEncryptedQuery)
+func maxRecursionDepth(scheme Scheme) int {
+
+	switch scheme {
+	case SchemeDPFv1, SchemeDPFv2EarlyTerm:
+		return 1
+	case SchemeAHEPaillierV1:
+		return 2
+	}
+
+	return 0
+}
+
+// EstimateLatency returns the estimated time to answer a query over dbSize slots
+// retrieved in groups of groupSize with the recursion depth and nprocs processes
+func (c SchemeCost) EstimateLatency(dbSize, groupSize, depth, nprocs int) (time.Duration, error) {
+
+	if dbSize <= 0 || groupSize <= 0 || nprocs <= 0 {
+		return 0, errors.New("invalid parameters")
+	}
+
+	if depth < 1 || depth > maxRecursionDepth(c.Scheme) {
+		return 0, errors.New("recursion depth is not supported by the scheme")
+	}
+
+	numGroups := ceilDiv(dbSize, groupSize)
+
+	// secret shared queries scan a groupSize-wide grid and encrypted
+	// queries a (roughly) square grid of groups
+	height := numGroups
+	if c.Scheme == SchemeAHEPaillierV1 {
+		height = ceilSqrt(numGroups)
+	}
+	width := groupSize * int(math.Ceil(float64(numGroups)/float64(height)))
+
+	work := time.Duration(height)*c.PerRow + time.Duration(dbSize)*c.PerSlot
+	if depth == 2 {
+		work += time.Duration(width/groupSize)*c.PerRow + time.Duration(width)*c.PerColumnSlot
+	}
+
+	return work / time.Duration(nprocs), nil
+}
+
+// PlanConstraints bound the parameters considered by FeasiblePlans
+type PlanConstraints struct {
+	TargetLatency time.Duration // target (e.g., p95) latency of a query
+	DBSize        int           // number of slots that must be served
+	GroupSizes    []int         // group sizes to consider (1 if empty)
+	MaxNumProcs   int           // numbers of processes considered are powers of two up to MaxNumProcs
+}
+
+// Plan is a feasible combination of parameters
+type Plan struct {
+	DBSize    int // largest database (at most the required size) answered within the target
+	GroupSize int
+	Depth     int
+	NumProcs  int
+	NumShards int           // number of shards of DBSize slots needed to serve the required size
+	Latency   time.Duration // estimated latency for DBSize slots
+}
+
+// FeasiblePlans returns the plans that answer queries within the target latency,
+// ordered by number of shards, then number of processes, then recursion depth
+func (c SchemeCost) FeasiblePlans(constraints PlanConstraints) ([]Plan, error) {
+
+	if constraints.TargetLatency <= 0 || constraints.DBSize <= 0 || constraints.MaxNumProcs <= 0 {
+		return nil, errors.New("invalid constraints")
+	}
+
+	groupSizes := constraints.GroupSizes
+	if len(groupSizes) == 0 {
+		groupSizes = []int{1}
+	}
+
+	var plans []Plan
+	for _, groupSize := range groupSizes {
+		for depth := 1; depth <= maxRecursionDepth(c.Scheme); depth++ {
+			for nprocs := 1; nprocs <= constraints.MaxNumProcs; nprocs *= 2 {
+
+				fits := func(dbSize int) bool {
+					latency, err := c.EstimateLatency(dbSize, groupSize, depth, nprocs)
+					return err == nil && latency <= constraints.TargetLatency
+				}
+
+				// the latency grows with the size of the database
+				dbSize := sort.Search(constraints.DBSize, func(n int) bool { return !fits(n + 1) })
+				if dbSize == 0 || !fits(dbSize) {
+					continue
+				}
+
+				latency, _ := c.EstimateLatency(dbSize, groupSize, depth, nprocs)
+				plans = append(plans, Plan{
+					DBSize:    dbSize,
+					GroupSize: groupSize,
+					Depth:     depth,
+					NumProcs:  nprocs,
+					NumShards: (constraints.DBSize + dbSize - 1) / dbSize,
+					Latency:   latency,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		if plans[i].NumShards != plans[j].NumShards {
+			return plans[i].NumShards < plans[j].NumShards
+		}
+		if plans[i].NumProcs != plans[j].NumProcs {
+			return plans[i].NumProcs < plans[j].NumProcs
+		}
+		return plans[i].Depth < plans[j].Depth
+	})
+
+	return plans, nil
+}
+
+func percentile95(values []time.Duration) time.Duration {
+
+	sorted := append([]time.Duration(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+}
@@ -0,0 +1,95 @@
+package pir
+
+import (
+	"testing"
+	"time"
+)
+
+// run with 'go test -v -run TestFeasiblePlans' to see log outputs.
+func TestFeasiblePlans(t *testing.T) {
+
+	cost := SchemeCost{
+		Scheme:        SchemeAHEPaillierV1,
+		PerSlot:       time.Microsecond,
+		PerColumnSlot: 10 * time.Microsecond,
+	}
+
+	constraints := PlanConstraints{
+		TargetLatency: 100 * time.Millisecond,
+		DBSize:        1 << 20,
+		GroupSizes:    []int{1, 4},
+		MaxNumProcs:   8,
+	}
+
+	plans, err := cost.FeasiblePlans(constraints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plans) != 2*2*4 {
+		t.Fatalf("Expected %v plans, got %v\n", 2*2*4, len(plans))
+	}
+
+	for _, plan := range plans {
+		if plan.Latency > constraints.TargetLatency {
+			t.Fatalf("Plan %+v exceeds the target latency\n", plan)
+		}
+
+		if plan.NumShards*plan.DBSize < constraints.DBSize {
+			t.Fatalf("Plan %+v does not serve the database\n", plan)
+		}
+
+		// one more slot does not fit
+		if plan.DBSize < constraints.DBSize {
+			latency, _ := cost.EstimateLatency(plan.DBSize+1, plan.GroupSize, plan.Depth, plan.NumProcs)
+			if latency <= constraints.TargetLatency {
+				t.Fatalf("Plan %+v is not the largest feasible database\n", plan)
+			}
+		}
+	}
+
+	// one million slots per second per process
+	best := plans[0]
+	if best.NumProcs != 8 || best.DBSize != 800000 || best.NumShards != 2 {
+		t.Fatalf("Unexpected best plan %+v\n", best)
+	}
+
+	t.Logf("Best plan: %+v\n", best)
+
+	// secret shared schemes do not recurse
+	cost.Scheme = SchemeDPFv1
+	if _, err := cost.EstimateLatency(100, 1, 2, 1); err == nil {
+		t.Fatalf("Estimated the latency of an unsupported recursion depth")
+	}
+}
+
+// run with 'go test -v -run TestSchemeCostFromDryRuns' to see log outputs.
+func TestSchemeCostFromDryRuns(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	reports := make([]*DryRunReport, 5)
+	for i := range reports {
+		var err error
+		if reports[i], err = db.DryRunQuery(DryRunSecretShared, NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cost, err := SchemeCostFromDryRuns(SchemeDPFv1, NumProcsForQuery, reports...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cost.PerRow <= 0 || cost.PerSlot <= 0 {
+		t.Fatalf("Unexpected cost %+v\n", cost)
+	}
+
+	latency, err := cost.EstimateLatency(TestDBSize, 1, 1, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Logf("Cost: %+v, estimated latency %v (measured %v)\n", cost, latency, reports[0].Total)
+}
@@ -0,0 +1,207 @@
+package pir
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+ Worker pools.
+ Queries split the rows (or groups of columns) they scan into ranges and
+ hand the ranges to nprocs workers over a channel (see parallelRanges):
+ a worker that is done with its range takes the next one instead of
+ waiting for the slowest worker. By default the workers of each query
+ run on goroutines started for the query. SetWorkerPool makes every
+ query run its workers on the goroutines of a shared pool instead, which
+ bounds the number of goroutines of a server answering many queries at
+ once. A query never waits for the pool: when every goroutine of the
+ pool is busy the worker runs on the goroutine of the query (so workers
+ can answer queries of their own without deadlocking the pool).
+ NUMA-pinned workers (see PartitionForNUMA) never run on the pool since
+ they keep their thread pinned to a node.
+ Each worker accumulates the ranges it takes into its own results, and
+ the results of the workers are merged in worker order (0, 1, ...) once
+ the scan is done. Which ranges a worker takes depends on scheduling,
+ but the merged response does not: XOR and homomorphic addition (a
+ product modulo N^2 or N^3 for Paillier, a point addition for EC
+ ElGamal) are associative and commutative, and the workers start from
+ the identity (the null ciphertext encrypts zero with randomness one),
+ so responses are bitwise identical for any nprocs and any scheduling.
+ Replicas can thus cross-check their responses byte for byte; new
+ accumulators must keep this property (e.g. by rerandomizing the merged
+ response rather than the results of the workers).
+*/
+
+// rangesPerWorker is the number of ranges per worker; more ranges balance
+// the load better at the cost of more channel operations
+const rangesPerWorker = 4
+
+// WorkerPool is a fixed set of goroutines running the workers of queries
+// (see SetWorkerPool)
+type WorkerPool struct {
+	tasks chan func()
+	done  chan struct{}
+	size  int
+
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewWorkerPool starts a pool of size goroutines (at least one)
+func NewWorkerPool(size int) *WorkerPool {
+
+	if size < 1 {
+		size = 1
+	}
+
+	pool := &WorkerPool{
+		tasks: make(chan func()),
+		done:  make(chan struct{}),
+		size:  size,
+	}
+
+	pool.wg.Add(size)
+	for i := 0; i < size; i++ {
+		go pool.work()
+	}
+
+	return pool
+}
+
+// Size returns the number of goroutines of the pool
+func (pool *WorkerPool) Size() int {
+	return pool.size
+}
+
+// Close stops the goroutines of the pool once their current workers return.
+// Queries using a closed pool run their workers on their own goroutine
+func (pool *WorkerPool) Close() {
+	pool.once.Do(func() {
+		close(pool.done)
+	})
+	pool.wg.Wait()
+}
+
+func (pool *WorkerPool) work() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case task := <-pool.tasks:
+			task()
+		case <-pool.done:
+			return
+		}
+	}
+}
+
+// tryRun runs task on an idle goroutine of the pool;
+// returns false if every goroutine is busy
+func (pool *WorkerPool) tryRun(task func()) bool {
+	select {
+	case pool.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+var (
+	workerPoolMu sync.RWMutex
+	workerPool   *WorkerPool
+)
+
+// SetWorkerPool makes the queries of every database run their workers on the pool
+// (nil restores goroutines started for each query). The pool is not closed when replaced
+func SetWorkerPool(pool *WorkerPool) {
+
+	workerPoolMu.Lock()
+	defer workerPoolMu.Unlock()
+
+	workerPool = pool
+}
+
+// sharedWorkerPool returns the pool set by SetWorkerPool (nil if none)
+func sharedWorkerPool() *WorkerPool {
+
+	workerPoolMu.RLock()
+	defer workerPoolMu.RUnlock()
+
+	return workerPool
+}
+
+// parallelRanges splits [0, n) into ranges and runs fn on each range with nprocs
+// workers taking the ranges from a channel. worker (0 <= worker < nprocs) identifies
+// the worker calling fn so that fn can accumulate into the results of the worker.
+// Returns the first *WorkerError (see workerGroup)
+func parallelRanges(ctx context.Context, n, nprocs int, fn func(worker, start, end int) error) error {
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	size := ceilDiv(n, nprocs*rangesPerWorker)
+	if size < 1 {
+		size = 1
+	}
+
+	ranges := make(chan RowRange, ceilDiv(n, size))
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		ranges <- RowRange{Start: start, End: end}
+	}
+	close(ranges)
+
+	workers := newWorkerGroup(ctx)
+
+	for w := 0; w < nprocs; w++ {
+		w := w
+		workers.Go(w, func() error {
+			for r := range ranges {
+				if workers.stopped() {
+					return nil
+				}
+				if err := fn(w, r.Start, r.End); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return workers.Wait()
+}
+
+// scanRowsParallel XORs the selected rows with nprocs workers, each accumulating
+// the rows it scans into its own result slots
+func (db *Database) scanRowsParallel(results []*Slot, bits []bool, dimWidth int, mask uint64, nprocs int, progress *queryProgress) error {
+
+	partial := make([][]*Slot, nprocs)
+	for w := range partial {
+		partial[w] = make([]*Slot, dimWidth)
+		for col := range partial[w] {
+			partial[w][col] = NewEmptySlot(db.SlotBytes)
+		}
+	}
+
+	err := parallelRanges(context.Background(), len(bits), nprocs, func(w, start, end int) error {
+		db.xorRows(partial[w], bits, dimWidth, mask, start, end)
+		progress.advance(end-start, 0)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for w := range partial {
+		for col := range results {
+			XorSlots(results[col], partial[w][col])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package pir
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestParallelRanges' to see log outputs.
+func TestParallelRanges(t *testing.T) {
+
+	for _, n := range []int{0, 1, 7, 100, 1023} {
+		for _, nprocs := range []int{0, 1, 3, 16} {
+			counts := make([]int, n)
+			var mu sync.Mutex
+
+			err := parallelRanges(context.Background(), n, nprocs, func(w, start, end int) error {
+				if w < 0 || (nprocs > 0 && w >= nprocs) {
+					t.Errorf("Worker %v out of range for %v workers\n", w, nprocs)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				for i := start; i < end; i++ {
+					counts[i]++
+				}
+				return nil
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, c := range counts {
+				if c != 1 {
+					t.Fatalf("Row %v scanned %v times (n = %v, nprocs = %v)\n", i, c, n, nprocs)
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestWorkerPool' to see log outputs.
+func TestWorkerPool(t *testing.T) {
+	setup()
+
+	pool := NewWorkerPool(2)
+	SetWorkerPool(pool)
+	defer func() {
+		SetWorkerPool(nil)
+		pool.Close()
+	}()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	md := db.Metadata()
+
+	// more workers than goroutines in the pool and concurrent queries
+	var wg sync.WaitGroup
+	for q := 0; q < 4; q++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+
+			slot, err := retrieveSlot(db, md, index, 4)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !slot.Equal(db.Slots[index]) {
+				t.Errorf("Query result is incorrect. %v != %v\n", db.Slots[index], slot)
+			}
+		}(q * 17)
+	}
+	wg.Wait()
+
+	sk, pk := paillier.KeyGen(128)
+	query := db.NewEncryptedQuery(pk, 1, 1)
+
+	res, err := db.PrivateEncryptedQuery(query, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for j, slot := range recoverEncrypted(t, res, sk) {
+		if !slot.Equal(db.Slots[query.DBWidth+j]) {
+			t.Fatalf("Incorrect result for slot %v\n", j)
+		}
+	}
+
+	// queries still run once the pool is closed
+	pool.Close()
+
+	if _, err := retrieveSlot(db, md, 3, 4); err != nil {
+		t.Fatal(err)
+	}
+}
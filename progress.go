@@ -0,0 +1,149 @@
+package pir
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ Progress and metrics of long-running queries.
+ Encrypted queries over large databases take seconds (a Paillier
+ exponentiation per ciphertext of every slot), so servers want to show
+ their progress and export their cost (e.g., as Prometheus metrics).
+ The WithOptions variants of the query methods take QueryOptions: the
+ OnProgress callback is called as the workers complete ranges of rows
+ and Metrics is filled with the rows scanned, the homomorphic operations
+ performed and the wall-clock time of the query once it completes. The
+ callbacks only see counts that depend on the public parameters of the
+ query, never on the selected row. Queries without options report
+ nothing and pay nothing.
+*/
+
+// QueryOptions configure the reporting of a query (the zero value reports nothing)
+type QueryOptions struct {
+	// OnProgress is called with the rows scanned so far and the rows to scan
+	// (groups of columns for doubly encrypted queries). Calls are serialized
+	// and done increases up to total
+	OnProgress func(done, total int)
+
+	// Metrics is filled when the query completes (optional)
+	Metrics *QueryMetrics
+}
+
+// QueryMetrics are the costs of an answered query
+type QueryMetrics struct {
+	Rows          int   // rows scanned (groups of columns for doubly encrypted queries)
+	CiphertextOps int64 // homomorphic operations of the scan (ConstMult and Add)
+	Start         time.Time
+	Duration      time.Duration
+}
+
+// queryProgress tracks a query answered with options (a nil *queryProgress ignores updates)
+type queryProgress struct {
+	opts  QueryOptions
+	start time.Time
+	total int
+
+	done int64 // atomic
+	ops  int64 // atomic
+
+	mu       sync.Mutex // serializes the calls to OnProgress
+	reported int
+}
+
+// newQueryProgress returns the progress of a query with options (nil without)
+func newQueryProgress(opts QueryOptions) *queryProgress {
+
+	if opts.OnProgress == nil && opts.Metrics == nil {
+		return nil
+	}
+
+	return &queryProgress{opts: opts, start: time.Now()}
+}
+
+// setTotal sets the number of rows the query scans
+func (p *queryProgress) setTotal(total int) {
+	if p != nil {
+		p.total = total
+	}
+}
+
+// advance records rows scanned with ops homomorphic operations
+func (p *queryProgress) advance(rows int, ops int64) {
+
+	if p == nil {
+		return
+	}
+
+	atomic.AddInt64(&p.ops, ops)
+	done := int(atomic.AddInt64(&p.done, int64(rows)))
+
+	if p.opts.OnProgress == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// ranges complete out of order; only report progress
+	if done > p.reported {
+		p.reported = done
+		p.opts.OnProgress(done, p.total)
+	}
+}
+
+// finish fills the metrics of the query
+func (p *queryProgress) finish() {
+
+	if p == nil || p.opts.Metrics == nil {
+		return
+	}
+
+	*p.opts.Metrics = QueryMetrics{
+		Rows:          int(atomic.LoadInt64(&p.done)),
+		CiphertextOps: atomic.LoadInt64(&p.ops),
+		Start:         p.start,
+		Duration:      time.Since(p.start),
+	}
+}
+
+// PrivateSecretSharedQueryWithOptions is PrivateSecretSharedQuery reporting
+// the progress and the metrics of the query (see QueryOptions)
+func (db *Database) PrivateSecretSharedQueryWithOptions(query *QueryShare, nprocs int, opts QueryOptions) (*SecretSharedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	progress := newQueryProgress(opts)
+	defer progress.finish()
+
+	return db.privateSecretSharedQueryProgress(query, nprocs, progress)
+}
+
+// PrivateEncryptedQueryWithOptions is PrivateEncryptedQueryContext reporting
+// the progress and the metrics of the query (see QueryOptions)
+func (db *Database) PrivateEncryptedQueryWithOptions(ctx context.Context, query *EncryptedQuery, nprocs int, opts QueryOptions) (*EncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	progress := newQueryProgress(opts)
+	defer progress.finish()
+
+	return db.privateEncryptedQueryContext(ctx, query, nprocs, progress)
+}
+
+// PrivateDoublyEncryptedQueryWithOptions is PrivateDoublyEncryptedQuery reporting
+// the progress and the metrics of the query (see QueryOptions)
+func (db *Database) PrivateDoublyEncryptedQueryWithOptions(query *DoublyEncryptedQuery, nprocs int, opts QueryOptions) (*DoublyEncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	progress := newQueryProgress(opts)
+	defer progress.finish()
+
+	return db.privateDoublyEncryptedQueryLocked(query, nprocs, progress)
+}
@@ -0,0 +1,140 @@
+package pir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// progressRecorder checks the calls to OnProgress
+type progressRecorder struct {
+	t     *testing.T
+	calls int
+	done  int
+	total int
+}
+
+func (r *progressRecorder) onProgress(done, total int) {
+
+	if done <= r.done || done > total {
+		r.t.Errorf("Progress %v/%v after %v/%v\n", done, total, r.done, r.total)
+	}
+
+	r.calls++
+	r.done, r.total = done, total
+}
+
+func TestSharedQueryProgress(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for _, nprocs := range []int{1, NumProcsForQuery} {
+		groupSize := 4
+		shares := db.NewIndexQueryShares(3, groupSize, 2)
+
+		rec := &progressRecorder{t: t}
+		metrics := &QueryMetrics{}
+
+		res, err := db.PrivateSecretSharedQueryWithOptions(shares[0], nprocs, QueryOptions{
+			OnProgress: rec.onProgress,
+			Metrics:    metrics,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other, err := db.PrivateSecretSharedQuery(shares[1], nprocs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slots := Recover([]*SecretSharedQueryResult{res, other})
+		if !slots[0].Equal(db.Slots[3*groupSize]) {
+			t.Fatalf("Query result is incorrect with options\n")
+		}
+
+		numRows := ceilDiv(TestDBSize, groupSize)
+		if rec.calls == 0 || rec.done != numRows || rec.total != numRows {
+			t.Fatalf("Progress ended at %v/%v after %v calls, expected %v rows\n", rec.done, rec.total, rec.calls, numRows)
+		}
+
+		if metrics.Rows != numRows || metrics.CiphertextOps != 0 || metrics.Start.IsZero() || metrics.Duration <= 0 {
+			t.Fatalf("Unexpected metrics %+v\n", metrics)
+		}
+	}
+}
+
+func TestEncryptedQueryProgress(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	width, height := 10, ceilDiv(TestDBSize, 10)
+	query := db.NewEncryptedQueryWithDimentions(pk, width, height, 1, 2)
+
+	rec := &progressRecorder{t: t}
+	metrics := &QueryMetrics{}
+
+	res, err := db.PrivateEncryptedQueryWithOptions(context.Background(), query, NumProcsForQuery, QueryOptions{
+		OnProgress: rec.onProgress,
+		Metrics:    metrics,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for col, slot := range recoverEncrypted(t, res, sk) {
+		if !slot.Equal(db.Slots[2*width+col]) {
+			t.Fatalf("Query result is incorrect with options\n")
+		}
+	}
+
+	// a ConstMult and an Add per ciphertext of every slot
+	numCts := len(res.Slots[0].Cts)
+	if rec.done != height || metrics.Rows != height || metrics.CiphertextOps != int64(2*numCts*TestDBSize) {
+		t.Fatalf("Unexpected progress %v/%v and metrics %+v\n", rec.done, rec.total, metrics)
+	}
+
+	// doubly encrypted queries report groups of columns
+	groupSize := 2
+	doublyQuery := db.NewDoublyEncryptedQuery(pk, groupSize, 5)
+
+	rec = &progressRecorder{t: t}
+	doublyRes, err := db.PrivateDoublyEncryptedQueryWithOptions(doublyQuery, NumProcsForQuery, QueryOptions{
+		OnProgress: rec.onProgress,
+		Metrics:    metrics,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots, err := RecoverDoublyEncrypted(doublyRes, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slots[5%groupSize].Equal(db.Slots[5]) {
+		t.Fatalf("Doubly encrypted query result is incorrect with options\n")
+	}
+
+	numGroups := doublyQuery.Row.DBWidth / groupSize
+	if rec.done != numGroups || metrics.Rows != numGroups || metrics.CiphertextOps <= int64(2*numCts*TestDBSize) {
+		t.Fatalf("Unexpected progress %v/%v and metrics %+v\n", rec.done, rec.total, metrics)
+	}
+}
+
+func TestQueryProgressWithoutOptions(t *testing.T) {
+
+	if newQueryProgress(QueryOptions{}) != nil {
+		t.Fatalf("Tracked the progress of a query without options")
+	}
+
+	// updates of untracked queries are ignored
+	var progress *queryProgress
+	progress.setTotal(10)
+	progress.advance(1, 1)
+	progress.finish()
+}
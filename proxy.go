@@ -0,0 +1,151 @@
+package pir
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+)
+
+/*
+ Proxy aggregation of result shares.
+ A client of a secret shared deployment downloads one result share per
+ server. With aggregation, an untrusted proxy (e.g., a CDN edge in front
+ of the servers) collects the result shares and combines them into a
+ single message, so the client downloads a single group of slots: half
+ the download in two-server mode. The combination of the shares is the
+ retrieved group, so each server first masks its share with a one-time
+ pad expanded from a seed that the client sends along with the query
+ share (see MaskedQueryShare) and the proxy only learns the group xored
+ with the pads of all the servers (see AggregateShares). The client
+ removes the pads (see RecoverAggregated). The proxy is partially
+ trusted: it must not learn the seeds, so the masked query shares are
+ sent to the servers over channels the proxy cannot read (as the query
+ shares themselves), and it must not collude with the servers. A proxy
+ that tampers with the message makes the client recover garbage, as a
+ server returning a bad share would.
+*/
+
+// maskSeedBytes is the size of the seed of the one-time pad of a result share
+const maskSeedBytes = aes.BlockSize
+
+// MaskedQueryShare is a query share along with the seed of the one-time pad masking
+// the result share (see PrivateSecretSharedQueryMasked)
+type MaskedQueryShare struct {
+	*QueryShare
+	MaskSeed []byte
+}
+
+// ResponseMasks holds the seeds of the one-time pads of the result shares
+// of a query, kept by the client to recover the aggregated result
+type ResponseMasks struct {
+	seeds [][]byte
+}
+
+// NewMaskedQueryShares generates the query shares for the group at index
+// (see NewIndexQueryShares), each with a fresh mask seed, and the masks to
+// recover the aggregated result with
+func (dbmd *DBMetadata) NewMaskedQueryShares(index int, groupSize int, numShares uint) ([]*MaskedQueryShare, *ResponseMasks, error) {
+
+	shares := dbmd.NewIndexQueryShares(index, groupSize, numShares)
+
+	masked := make([]*MaskedQueryShare, len(shares))
+	masks := &ResponseMasks{seeds: make([][]byte, len(shares))}
+
+	for i, share := range shares {
+		seed := make([]byte, maskSeedBytes)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, nil, err
+		}
+
+		masked[i] = &MaskedQueryShare{QueryShare: share, MaskSeed: seed}
+		masks.seeds[i] = seed
+	}
+
+	return masked, masks, nil
+}
+
+// PrivateSecretSharedQueryMasked answers the query share and masks the result share
+// with the one-time pad of the seed of the query (see PrivateSecretSharedQuery)
+func (db *Database) PrivateSecretSharedQueryMasked(query *MaskedQueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+
+	if query.QueryShare == nil || len(query.MaskSeed) != maskSeedBytes {
+		return nil, errors.New("invalid masked query share")
+	}
+
+	res, err := db.PrivateSecretSharedQuery(query.QueryShare, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyResponseMask(res, query.MaskSeed); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// AggregateShares combines the masked result shares of the servers into a single
+// message (run by the proxy; see RecoverAggregated)
+func AggregateShares(resShares []*SecretSharedQueryResult) (*SecretSharedQueryResult, error) {
+
+	if len(resShares) == 0 {
+		return nil, errors.New("no result shares")
+	}
+
+	first := resShares[0]
+	agg := &SecretSharedQueryResult{SlotBytes: first.SlotBytes, Shares: make([]*Slot, len(first.Shares))}
+	for i, share := range first.Shares {
+		agg.Shares[i] = NewSlot(append([]byte{}, share.Data...))
+	}
+
+	for _, res := range resShares[1:] {
+		if res.SlotBytes != agg.SlotBytes || len(res.Shares) != len(agg.Shares) {
+			return nil, errors.New("result shares have different sizes")
+		}
+
+		for i, share := range res.Shares {
+			if len(share.Data) != len(agg.Shares[i].Data) {
+				return nil, errors.New("result shares have different sizes")
+			}
+			XorSlots(agg.Shares[i], share)
+		}
+	}
+
+	return agg, nil
+}
+
+// RecoverAggregated removes the masks from the message aggregated by the proxy
+// and returns the slots of the group
+func RecoverAggregated(agg *SecretSharedQueryResult, masks *ResponseMasks) ([]*Slot, error) {
+
+	res := &SecretSharedQueryResult{SlotBytes: agg.SlotBytes, Shares: make([]*Slot, len(agg.Shares))}
+	for i, share := range agg.Shares {
+		res.Shares[i] = NewSlot(append([]byte{}, share.Data...))
+	}
+
+	for _, seed := range masks.seeds {
+		if err := applyResponseMask(res, seed); err != nil {
+			return nil, err
+		}
+	}
+
+	return res.Shares, nil
+}
+
+// applyResponseMask xors the one-time pad expanded from the seed into the result share
+func applyResponseMask(res *SecretSharedQueryResult, seed []byte) error {
+
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return err
+	}
+
+	// each seed is only used for one result share so the counter starts at zero
+	stream := cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	for _, share := range res.Shares {
+		stream.XORKeyStream(share.Data, share.Data)
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestProxyAggregation(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	dbmd := db.Metadata()
+	groupSize := 4
+
+	for _, numShares := range []uint{2, 3} {
+		index := rand.Intn(TestDBSize)
+		row, pos := dbmd.GroupPosition(index, groupSize)
+
+		shares, masks, err := dbmd.NewMaskedQueryShares(row, groupSize, numShares)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resShares := make([]*SecretSharedQueryResult, len(shares))
+		for i, share := range shares {
+			// the shares survive encoding
+			b, err := share.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded := &MaskedQueryShare{}
+			if err := decoded.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+
+			if resShares[i], err = db.PrivateSecretSharedQueryMasked(decoded, NumProcsForQuery); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		agg, err := AggregateShares(resShares)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the aggregated message is not the group
+		if agg.Shares[pos].Equal(db.Slots[index]) {
+			t.Fatalf("Aggregated message reveals the slot\n")
+		}
+
+		slots, err := RecoverAggregated(agg, masks)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slots[pos].Equal(db.Slots[index]) {
+			t.Fatalf("Incorrect slot at index %v: %v != %v\n", index, slots[pos], db.Slots[index])
+		}
+	}
+
+	// result shares of different queries are not aggregated
+	a := &SecretSharedQueryResult{SlotBytes: SlotBytes, Shares: []*Slot{NewEmptySlot(SlotBytes)}}
+	b := &SecretSharedQueryResult{SlotBytes: SlotBytes, Shares: []*Slot{NewEmptySlot(SlotBytes), NewEmptySlot(SlotBytes)}}
+	if _, err := AggregateShares([]*SecretSharedQueryResult{a, b}); err == nil {
+		t.Fatalf("Result shares of different sizes were aggregated\n")
+	}
+}
@@ -1,8 +1,9 @@
 package pir
 
 import (
-	"math"
-	"math/rand"
+	"errors"
+	"fmt"
+	"io"
 
 	"github.com/ncw/gmp"
 	"github.com/sachaservan/paillier"
@@ -10,17 +11,58 @@ import (
 )
 
 // QueryShare is a secret share of a query over the database
-// to retrieve a row
+// to retrieve a row. A share must only be sent to the server it was generated for
+// and failed queries are retried with new shares (see QuerySet)
 type QueryShare struct {
 	KeyTwoParty    *dpf.Key2P
 	KeyMultiParty  *dpf.KeyMP
 	PrfKeys        []*dpf.PrfKey
 	IsKeywordBased bool
 	IsTwoParty     bool
+	KeyVariant     KeyVariant // two-party only
 	ShareNumber    uint
-	GroupSize      int // height of the database
+	GroupSize      int    // height of the database
+	Scheme         Scheme // scheme (and version) the query was generated for
+	AttributeMask  uint64 // only slots with all attributes in the mask are retrieved (optional)
+	KeywordDigest  []byte // digest of the keywords the query was generated for (keyword queries only)
+
+	// fingerprint of the layout the query was generated for (see Layout)
+	LayoutFingerprint LayoutFingerprint
 }
 
+// KeyVariant selects the two-party DPF construction used by a query
+// trading off the size of the keys sent to the servers against server computation.
+// For a domain of n bits (n = log(height) or the keyword bits, see KeywordBits):
+type KeyVariant int
+
+const (
+	// KeyPayloadInLeaf walks the full tree and embeds an integer payload in the leaf.
+	// Key size: 18n + 8 bytes; server cost: n PRF evaluations (3 AES blocks each) per row.
+	// This is the default variant
+	KeyPayloadInLeaf KeyVariant = iota
+
+	// KeyFullDepth walks the full tree and outputs a single bit per row.
+	// Key size: 18n + 1 bytes; server cost: n PRF evaluations (3 AES blocks each)
+	// plus one AES block per row
+	KeyFullDepth
+
+	// KeyEarlyTermination stops the tree gamma levels early and packs 2^gamma
+	// output bits into each leaf.
+	// Key size: 18(n - gamma) + 2^gamma/8 bytes; server cost: n - gamma PRF evaluations
+	// plus one AES block per row.
+	// Keys are smallest around gamma = 7 (one AES block per leaf); larger values of
+	// gamma trade a larger final correction word for a shallower tree
+	KeyEarlyTermination
+
+	// KeyAsymmetric shifts the key material to the second server for deployments
+	// where the first server is bandwidth constrained. The first share holds a
+	// 16-byte PRG seed and the second share holds all 2^n output bits.
+	// Key size: 16 bytes (first share) and 2^n/8 bytes (second share);
+	// server cost: one AES block per 128 rows (first share) or a lookup per row (second share).
+	// Index queries only (keyword queries have domains of at least 32 bits)
+	KeyAsymmetric
+)
+
 // EncryptedQuery is an encryption of a point function
 // that evaluates to 1 at the desired row in the database
 // bits = (0, 0,.., 1, ...0, 0)
@@ -28,7 +70,13 @@ type EncryptedQuery struct {
 	Pk                *paillier.PublicKey
 	EBits             []*paillier.Ciphertext
 	GroupSize         int
-	DBWidth, DBHeight int // if a specific will force these dimentiojs
+	DBWidth, DBHeight int    // if a specific will force these dimentiojs
+	Scheme            Scheme // scheme (and version) the query was generated for
+	AttributeMask     uint64 // only slots with all attributes in the mask are retrieved (optional)
+	IsKeywordBased    bool   // retrieves a row of the second layer of a PrivateSqrtST
+
+	// fingerprint of the layout the query was generated for (see Layout)
+	LayoutFingerprint LayoutFingerprint
 }
 
 // DoublyEncryptedQuery consists of two encrypted point functions
@@ -40,46 +88,63 @@ type DoublyEncryptedQuery struct {
 
 // NewIndexQueryShares generates PIR query shares for the index
 func (dbmd *DBMetadata) NewIndexQueryShares(index int, groupSize int, numShares uint) []*QueryShare {
-	return dbmd.newQueryShares(index, groupSize, numShares, true)
+	return dbmd.newQueryShares(index, groupSize, numShares, true, KeyPayloadInLeaf, 0, nil)
+}
+
+// NewIndexQuerySharesWithKeyVariant generates two-party PIR query shares for the index
+// using the specified DPF key variant (see KeyVariant for the size/compute trade-offs).
+// gamma is the number of early termination levels and is ignored by the other variants
+func (dbmd *DBMetadata) NewIndexQuerySharesWithKeyVariant(index int, groupSize int, variant KeyVariant, gamma uint) []*QueryShare {
+	return dbmd.newQueryShares(index, groupSize, 2, true, variant, gamma, nil)
 }
 
 // NewKeywordQueryShares generates keyword-based PIR query shares for keyword
 func (dbmd *DBMetadata) NewKeywordQueryShares(keyword int, groupSize int, numShares uint) []*QueryShare {
-	return dbmd.newQueryShares(keyword, groupSize, numShares, false)
+	return dbmd.newQueryShares(keyword, groupSize, numShares, false, KeyPayloadInLeaf, 0, nil)
 }
 
-// NewQueryShares generates random PIR query shares for the index
-func (dbmd *DBMetadata) newQueryShares(key int, groupSize int, numShares uint, isIndexQuery bool) []*QueryShare {
+// NewQueryShares generates random PIR query shares for the index.
+// The keys are drawn from random (crypto/rand if nil, see dpf.ClientInitializeWithRand)
+func (dbmd *DBMetadata) newQueryShares(key int, groupSize int, numShares uint, isIndexQuery bool, variant KeyVariant, gamma uint, random io.Reader) []*QueryShare {
 
-	dimHeight := int(math.Ceil(float64(dbmd.DBSize / groupSize))) // need groupSize elements back
+	dimHeight := ceilDiv(dbmd.DBSize, groupSize) // need groupSize elements back
 
 	if dimHeight == 0 {
 		panic("database height is set to zero; something is wrong")
 	}
 
-	// num bits to represent the index
-	numBits := uint(math.Log2(float64(dimHeight)) + 1)
-
-	// otherwise assume keyword based (32 bit keys)
-	if !isIndexQuery {
-		numBits = uint(32)
-	}
+	// num bits to represent the index (or the keyword)
+	numBits := dbmd.sharedQueryDomainBits(groupSize, !isIndexQuery)
 
-	pf := dpf.ClientInitialize(numBits)
+	pf := dpf.ClientInitializeWithRand(numBits, random)
 
 	var dpfKeysTwoParty []*dpf.Key2P
 	var dpfKeysMultiParty []*dpf.KeyMP
 
 	if numShares == 2 {
-		dpfKeysTwoParty = pf.GenerateTwoServer(uint(key), 1)
+		switch variant {
+		case KeyFullDepth:
+			dpfKeysTwoParty = pf.GenerateTwoServerBits(uint(key), 0)
+		case KeyEarlyTermination:
+			dpfKeysTwoParty = pf.GenerateTwoServerBits(uint(key), gamma)
+		case KeyAsymmetric:
+			if !isIndexQuery {
+				panic("asymmetric keys only support index queries")
+			}
+			dpfKeysTwoParty = pf.GenerateTwoServerAsymmetric(uint(key))
+		default:
+			dpfKeysTwoParty = pf.GenerateTwoServer(uint(key), 1)
+		}
 	} else {
 		dpfKeysMultiParty = pf.GenerateMultiServer(uint(key), 1, numShares)
 	}
 
-	if key >= dimHeight {
+	if isIndexQuery && key >= dimHeight {
 		panic("requesting key outside of domain")
 	}
 
+	fingerprint := dbmd.SharedLayout(groupSize).Fingerprint()
+
 	shares := make([]*QueryShare, numShares)
 	for i := 0; i < int(numShares); i++ {
 		shares[i] = &QueryShare{}
@@ -87,14 +152,27 @@ func (dbmd *DBMetadata) newQueryShares(key int, groupSize int, numShares uint, i
 		shares[i].PrfKeys = pf.PrfKeys
 		shares[i].IsKeywordBased = !isIndexQuery
 		shares[i].GroupSize = groupSize
+		shares[i].LayoutFingerprint = fingerprint
+		shares[i].Scheme = schemeForKeys(numShares == 2, variant)
+
+		if !isIndexQuery {
+			shares[i].KeywordDigest = dbmd.KeywordDigest
+		}
 
 		if numShares == 2 {
 			shares[i].KeyTwoParty = dpfKeysTwoParty[i]
 			shares[i].IsTwoParty = true
+			shares[i].KeyVariant = variant
 		} else {
 			shares[i].KeyMultiParty = dpfKeysMultiParty[i]
 			shares[i].IsTwoParty = false
 		}
+
+		if strictQueryShapes() {
+			checkStrictShape(
+				fmt.Sprintf("share/%v/%v/%v/%v/%v/%v/%v", dbmd.DBSize, groupSize, numShares, isIndexQuery, variant, gamma, i),
+				shares[i].shape())
+		}
 	}
 
 	return shares
@@ -115,16 +193,29 @@ func (dbmd *DBMetadata) NewAuthenticatedIndexQueryShares(
 	return authQueryShares
 }
 
+// NewAuthenticatedKeywordQueryShares generates keyword-based PIR query shares for keyword
+// authenticated with the key associated with the keyword (see NewKeywordKeyDB)
+func (dbmd *DBMetadata) NewAuthenticatedKeywordQueryShares(
+	keyword int, authKey *Slot, groupSize int, numShares uint) []*AuthenticatedQueryShare {
+
+	queryShares := dbmd.NewKeywordQueryShares(keyword, groupSize, numShares)
+	authTokenShares := NewAuthTokenSharesForKey(authKey, numShares)
+
+	authQueryShares := make([]*AuthenticatedQueryShare, numShares)
+	for i := 0; i < int(numShares); i++ {
+		authQueryShares[i] = &AuthenticatedQueryShare{queryShares[i], authTokenShares[i]}
+	}
+
+	return authQueryShares
+}
+
 // NewEncryptedQuery generates a new encrypted point function that acts as a PIR query
 // defaults to sqrt sized grid database layout
 func (dbmd *DBMetadata) NewEncryptedQuery(pk *paillier.PublicKey, groupSize, index int) *EncryptedQuery {
 
-	// compute sqrt dimentions
-	height := int(math.Ceil(math.Sqrt(float64(dbmd.DBSize))))
-	var width int
-	width, height = dbmd.GetDimentionsForDatabase(height, groupSize)
+	layout := dbmd.DefaultLayout(groupSize)
 
-	return dbmd.NewEncryptedQueryWithDimentions(pk, width, height, groupSize, index)
+	return dbmd.NewEncryptedQueryWithDimentions(pk, layout.Width, layout.Height, groupSize, index)
 }
 
 // NewEncryptedQueryWithDimentions generates a new encrypted point function that acts as a PIR query
@@ -140,13 +231,23 @@ func (dbmd *DBMetadata) NewEncryptedQueryWithDimentions(pk *paillier.PublicKey,
 		}
 	}
 
-	return &EncryptedQuery{
-		Pk:        pk,
-		EBits:     res,
-		GroupSize: groupSize,
-		DBWidth:   width,
-		DBHeight:  height,
+	query := &EncryptedQuery{
+		Pk:                pk,
+		EBits:             res,
+		GroupSize:         groupSize,
+		DBWidth:           width,
+		DBHeight:          height,
+		Scheme:            SchemeAHEPaillierV1,
+		LayoutFingerprint: dbmd.LayoutFor(width, height, groupSize).Fingerprint(),
 	}
+
+	if strictQueryShapes() {
+		checkStrictShape(
+			fmt.Sprintf("encrypted/%v/%x/%v/%v/%v", dbmd.DBSize, PublicKeyFingerprint(pk), width, height, groupSize),
+			query.shape())
+	}
+
+	return query
 }
 
 // NewDoublyEncryptedNullQuery generates a PIR query that does not retrieve any value
@@ -158,12 +259,9 @@ func (dbmd *DBMetadata) NewDoublyEncryptedNullQuery(pk *paillier.PublicKey, grou
 // to select the row and column in the database
 func (dbmd *DBMetadata) NewDoublyEncryptedQuery(pk *paillier.PublicKey, groupSize, index int) *DoublyEncryptedQuery {
 
-	// compute sqrt dimentions
-	height := int(math.Ceil(math.Sqrt(float64(dbmd.DBSize))))
-	var width int
-	width, height = dbmd.GetDimentionsForDatabase(height, groupSize)
+	layout := dbmd.DefaultLayout(groupSize)
 
-	return dbmd.NewDoublyEncryptedQueryWithDimentions(pk, width, height, groupSize, index)
+	return dbmd.NewDoublyEncryptedQueryWithDimentions(pk, layout.Width, layout.Height, groupSize, index)
 }
 
 // NewDoublyEncryptedQueryWithDimentions generates two encrypted point function that acts as a PIR query
@@ -199,11 +297,13 @@ func (dbmd *DBMetadata) NewDoublyEncryptedQueryWithDimentions(pk *paillier.Publi
 	}
 
 	rowQuery := &EncryptedQuery{
-		Pk:        pk,
-		EBits:     row,
-		GroupSize: groupSize,
-		DBWidth:   width,
-		DBHeight:  height,
+		Pk:                pk,
+		EBits:             row,
+		GroupSize:         groupSize,
+		DBWidth:           width,
+		DBHeight:          height,
+		Scheme:            SchemeAHEPaillierV1,
+		LayoutFingerprint: dbmd.LayoutFor(width, height, groupSize).Fingerprint(),
 	}
 
 	colQuery := &EncryptedQuery{
@@ -212,6 +312,7 @@ func (dbmd *DBMetadata) NewDoublyEncryptedQueryWithDimentions(pk *paillier.Publi
 		GroupSize: groupSize,
 		DBWidth:   width,
 		DBHeight:  1,
+		Scheme:    SchemeAHEPaillierV1,
 	}
 
 	return &DoublyEncryptedQuery{
@@ -241,7 +342,7 @@ func (dbmd *DBMetadata) NewAuthenticatedQuery(
 	var token0 *paillier.Ciphertext
 	var token1 *paillier.Ciphertext
 
-	bit := rand.Intn(2)
+	bit := randomIntn(2)
 	if bit == 0 {
 		query0 = queryReal
 		token0 = realToken
@@ -297,7 +398,27 @@ func Recover(resShares []*SecretSharedQueryResult) []*Slot {
 }
 
 // RecoverEncrypted decryptes the encrypted slot and returns slot
-func RecoverEncrypted(res *EncryptedQueryResult, sk *paillier.SecretKey) []*Slot {
+// (unpacking packed results, see PackEncryptedResult).
+// Returns a *WrongKeyError if the result was encrypted under another key
+func RecoverEncrypted(res *EncryptedQueryResult, sk *paillier.SecretKey) ([]*Slot, error) {
+
+	if err := checkResultKey(res.KeyFingerprint, sk); err != nil {
+		return nil, err
+	}
+
+	if res.Packed != nil {
+		vals, err := res.Packed.unpack(sk, res.NumBytesPerCiphertext)
+		if err != nil {
+			return nil, err
+		}
+
+		slots := make([]*Slot, len(vals))
+		for i, arr := range vals {
+			slots[i] = NewSlotFromGmpIntArray(arr, res.SlotBytes, res.NumBytesPerCiphertext)
+		}
+
+		return slots, nil
+	}
 
 	slots := make([]*Slot, len(res.Slots))
 
@@ -311,24 +432,118 @@ func RecoverEncrypted(res *EncryptedQueryResult, sk *paillier.SecretKey) []*Slot
 		slots[i] = NewSlotFromGmpIntArray(arr, res.SlotBytes, res.NumBytesPerCiphertext)
 	}
 
-	return slots
+	return slots, nil
 }
 
-// RecoverDoublyEncrypted decryptes the encrypted slot and returns slot
-func RecoverDoublyEncrypted(res *DoublyEncryptedQueryResult, sk *paillier.SecretKey) []*Slot {
+// RecoverDoublyEncrypted decryptes the encrypted slot and returns slot.
+// Returns a *WrongKeyError if the result was encrypted under another key
+func RecoverDoublyEncrypted(res *DoublyEncryptedQueryResult, sk *paillier.SecretKey) ([]*Slot, error) {
+	return RecoverDoublyEncryptedWithKeys(res, sk, sk)
+}
+
+// RecoverDoublyEncryptedWithKeys decrypts the slots of a doubly encrypted query whose
+// row and column queries were encrypted under different keys (rowSk and colSk).
+// Returns a *WrongKeyError if the result was encrypted under another column key
+func RecoverDoublyEncryptedWithKeys(res *DoublyEncryptedQueryResult, rowSk, colSk *paillier.SecretKey) ([]*Slot, error) {
+
+	if err := checkResultKey(res.KeyFingerprint, colSk); err != nil {
+		return nil, err
+	}
+
+	chunks := 1
+	if res.ChunksPerCiphertext > 1 {
+		chunks = res.ChunksPerCiphertext
+		if res.ChunkBytes <= 0 {
+			return nil, errors.New("split result has no chunk size")
+		}
+	}
 
+	split := levelTwoSplit{chunks: chunks, chunkBytes: res.ChunkBytes}
 	slots := make([]*Slot, len(res.Slots))
 
 	for i, slot := range res.Slots {
-		arr := make([]*gmp.Int, len(slot.Cts))
-		for j, c := range slot.Cts {
-			arr[j] = sk.NestedDecrypt(c)
+		if len(slot.Cts)%chunks != 0 {
+			return nil, fmt.Errorf("slot of %v ciphertexts is not split in chunks of %v", len(slot.Cts), chunks)
+		}
+
+		arr := make([]*gmp.Int, len(slot.Cts)/chunks)
+		for j := range arr {
+			cts := slot.Cts[j*chunks : (j+1)*chunks]
+
+			switch {
+			case chunks > 1:
+				parts := make([]*gmp.Int, chunks)
+				for k, c := range cts {
+					parts[k] = colSk.DecryptNestedCiphertextLayer(c).C
+				}
+				arr[j] = rowSk.Decrypt(split.join(parts))
+			case rowSk == colSk:
+				arr[j] = colSk.NestedDecrypt(cts[0])
+			default:
+				arr[j] = rowSk.Decrypt(colSk.DecryptNestedCiphertextLayer(cts[0]))
+			}
 		}
 
-		slot := NewSlotFromGmpIntArray(arr, res.SlotBytes, res.NumBytesPerCiphertext)
+		slots[i] = NewSlotFromGmpIntArray(arr, res.SlotBytes, res.NumBytesPerCiphertext)
+	}
+
+	return slots, nil
+}
+
+// RecoverGroup combines shares of slots retrieved using a query for the
+// group at index and returns the slots along with the number of valid slots.
+// Slots at positions >= validCount lie past the end of the database and are padding
+func (dbmd *DBMetadata) RecoverGroup(resShares []*SecretSharedQueryResult, index int) ([]*Slot, int) {
+
+	slots := Recover(resShares)
+	return slots, dbmd.numSlotsInDatabase(index*len(slots), len(slots))
+}
+
+// RecoverEncryptedGroup decrypts the slots retrieved using an encrypted query for
+// the row at index and returns the slots along with the number of valid slots.
+// Slots at positions >= validCount lie past the end of the database and are padding.
+// Returns a *WrongKeyError if the result was encrypted under another key
+func (dbmd *DBMetadata) RecoverEncryptedGroup(res *EncryptedQueryResult, sk *paillier.SecretKey, index int) ([]*Slot, int, error) {
+
+	slots, err := RecoverEncrypted(res, sk)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return slots, dbmd.numSlotsInDatabase(index*len(slots), len(slots)), nil
+}
+
+// RecoverDoublyEncryptedGroup decrypts the slots retrieved using a doubly encrypted query
+// for the group containing index in a database of the given width and returns the
+// slots along with the number of valid slots.
+// Slots at positions >= validCount lie past the end of the database and are padding.
+// Returns a *WrongKeyError if the result was encrypted under another key
+func (dbmd *DBMetadata) RecoverDoublyEncryptedGroup(res *DoublyEncryptedQueryResult, sk *paillier.SecretKey, index, width int) ([]*Slot, int, error) {
+
+	slots, err := RecoverDoublyEncrypted(res, sk)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	groupSize := len(slots)
+
+	rowIndex, colIndex := dbmd.IndexToCoordinates(index, width, 0)
+	start := rowIndex*width + (colIndex/groupSize)*groupSize
+
+	return slots, dbmd.numSlotsInDatabase(start, groupSize), nil
+}
+
+// numSlotsInDatabase returns how many of the n slots starting at start are in the database
+func (dbmd *DBMetadata) numSlotsInDatabase(start, n int) int {
+
+	valid := dbmd.DBSize - start
+	if valid < 0 {
+		return 0
+	}
 
-		slots[i] = slot
+	if valid > n {
+		return n
 	}
 
-	return slots
+	return valid
 }
@@ -0,0 +1,498 @@
+package pir
+
+import (
+	"encoding"
+	"errors"
+
+	"github.com/sachaservan/paillier"
+	"github.com/sachaservan/pir/dpf"
+)
+
+// MarshalBinary encodes the query share (including its DPF key)
+func (share *QueryShare) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagQueryShare)
+
+	if err := e.writeMarshaler(share.KeyTwoParty != nil, share.KeyTwoParty); err != nil {
+		return nil, err
+	}
+	if err := e.writeMarshaler(share.KeyMultiParty != nil, share.KeyMultiParty); err != nil {
+		return nil, err
+	}
+
+	e.writeInt(int64(len(share.PrfKeys)))
+	for _, key := range share.PrfKeys {
+		if key == nil {
+			e.writeByte(0)
+			continue
+		}
+		e.writeByte(1)
+		e.writeBytes(key.Bytes)
+	}
+
+	e.writeBool(share.IsKeywordBased)
+	e.writeBool(share.IsTwoParty)
+	e.writeInt(int64(share.KeyVariant))
+	e.writeInt(int64(share.ShareNumber))
+	e.writeInt(int64(share.GroupSize))
+	e.writeBytes([]byte(share.Scheme))
+	e.writeInt(int64(share.AttributeMask))
+	e.writeBytes(share.LayoutFingerprint[:])
+	e.writeBytes(share.KeywordDigest)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a query share encoded by MarshalBinary
+func (share *QueryShare) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagQueryShare)
+	res := &QueryShare{}
+
+	if key := (&dpf.Key2P{}); d.readUnmarshaler(key) {
+		res.KeyTwoParty = key
+	}
+	if key := (&dpf.KeyMP{}); d.readUnmarshaler(key) {
+		res.KeyMultiParty = key
+	}
+
+	n := d.readLen()
+	res.PrfKeys = make([]*dpf.PrfKey, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		if d.readPresent() {
+			res.PrfKeys[i] = &dpf.PrfKey{Bytes: d.readBytes()}
+		}
+	}
+
+	res.IsKeywordBased = d.readBool()
+	res.IsTwoParty = d.readBool()
+	res.KeyVariant = KeyVariant(d.readInt())
+	res.ShareNumber = uint(d.readInt())
+	res.GroupSize = int(d.readInt())
+	res.Scheme = Scheme(d.readBytes())
+	res.AttributeMask = uint64(d.readInt())
+	d.readFixedBytes(res.LayoutFingerprint[:])
+	if digest := d.readBytes(); len(digest) > 0 {
+		res.KeywordDigest = digest
+	}
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*share = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the query share and the mask seed.
+// Defined explicitly since the method promoted from the embedded
+// QueryShare would drop the mask seed
+func (share *MaskedQueryShare) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagMaskedQueryShare)
+	if err := e.writeMarshaler(share.QueryShare != nil, share.QueryShare); err != nil {
+		return nil, err
+	}
+	e.writeBytes(share.MaskSeed)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a masked query share encoded by MarshalBinary
+func (share *MaskedQueryShare) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagMaskedQueryShare)
+	res := &MaskedQueryShare{}
+	if q := (&QueryShare{}); d.readUnmarshaler(q) {
+		res.QueryShare = q
+	}
+	res.MaskSeed = d.readBytes()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*share = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the result shares
+func (res *SecretSharedQueryResult) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagSecretSharedQueryResult)
+	e.writeInt(int64(res.SlotBytes))
+	e.writeSlots(res.Shares)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes result shares encoded by MarshalBinary
+func (res *SecretSharedQueryResult) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagSecretSharedQueryResult)
+	slotBytes := d.readInt()
+	shares := d.readSlots()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	res.SlotBytes, res.Shares = int(slotBytes), shares
+
+	return nil
+}
+
+// MarshalBinary encodes the Shamir query share
+func (share *ShamirQueryShare) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagShamirQueryShare)
+	e.writeByte(share.Point)
+	e.writeInt(int64(share.Threshold))
+	e.writeInt(int64(share.GroupSize))
+	e.writeBytes(share.Selection)
+	e.writeBytes(share.LayoutFingerprint[:])
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a Shamir query share encoded by MarshalBinary
+func (share *ShamirQueryShare) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagShamirQueryShare)
+	res := &ShamirQueryShare{}
+	res.Point = d.readByte()
+	res.Threshold = int(d.readInt())
+	res.GroupSize = int(d.readInt())
+	res.Selection = d.readBytes()
+	d.readFixedBytes(res.LayoutFingerprint[:])
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*share = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the result of a Shamir query share
+func (res *ShamirQueryResult) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagShamirQueryResult)
+	e.writeByte(res.Point)
+	e.writeInt(int64(res.Threshold))
+	e.writeInt(int64(res.SlotBytes))
+	e.writeSlots(res.Shares)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a Shamir query result encoded by MarshalBinary
+func (res *ShamirQueryResult) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagShamirQueryResult)
+	decoded := &ShamirQueryResult{}
+	decoded.Point = d.readByte()
+	decoded.Threshold = int(d.readInt())
+	decoded.SlotBytes = int(d.readInt())
+	decoded.Shares = d.readSlots()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*res = *decoded
+
+	return nil
+}
+
+// MarshalBinary encodes the encrypted query (including the public key)
+func (query *EncryptedQuery) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagEncryptedQuery)
+	if err := e.writeFields(query.Pk); err != nil {
+		return nil, err
+	}
+	e.writeFixedCiphertexts(query.Pk, query.EBits)
+	e.writeInt(int64(query.GroupSize))
+	e.writeInt(int64(query.DBWidth))
+	e.writeInt(int64(query.DBHeight))
+	e.writeBytes([]byte(query.Scheme))
+	e.writeInt(int64(query.AttributeMask))
+	e.writeBool(query.IsKeywordBased)
+	e.writeBytes(query.LayoutFingerprint[:])
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an encrypted query encoded by MarshalBinary
+func (query *EncryptedQuery) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagEncryptedQuery)
+	res := &EncryptedQuery{}
+	res.Pk = d.readPublicKey()
+	res.EBits = d.readCiphertexts()
+	res.GroupSize = int(d.readInt())
+	res.DBWidth = int(d.readInt())
+	res.DBHeight = int(d.readInt())
+	res.Scheme = Scheme(d.readBytes())
+	res.AttributeMask = uint64(d.readInt())
+	res.IsKeywordBased = d.readBool()
+	d.readFixedBytes(res.LayoutFingerprint[:])
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*query = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the row and column queries
+func (query *DoublyEncryptedQuery) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagDoublyEncryptedQuery)
+	if err := e.writeMarshaler(query.Row != nil, query.Row); err != nil {
+		return nil, err
+	}
+	if err := e.writeMarshaler(query.Col != nil, query.Col); err != nil {
+		return nil, err
+	}
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a doubly encrypted query encoded by MarshalBinary
+func (query *DoublyEncryptedQuery) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagDoublyEncryptedQuery)
+	res := &DoublyEncryptedQuery{}
+	if row := (&EncryptedQuery{}); d.readUnmarshaler(row) {
+		res.Row = row
+	}
+	if col := (&EncryptedQuery{}); d.readUnmarshaler(col) {
+		res.Col = col
+	}
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*query = *res
+
+	return nil
+}
+
+// MarshalBinary encodes the encrypted slots (including the public key)
+func (res *EncryptedQueryResult) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagEncryptedQueryResult)
+	e.writeInt(int64(len(res.Slots)))
+	for _, slot := range res.Slots {
+		if slot == nil {
+			e.writeByte(0)
+			continue
+		}
+		e.writeByte(1)
+		e.writeCiphertexts(slot.Cts)
+	}
+	if err := e.writeFields(res.Pk); err != nil {
+		return nil, err
+	}
+	e.writeInt(int64(res.SlotBytes))
+	e.writeInt(int64(res.NumBytesPerCiphertext))
+	e.writeBytes(res.KeyFingerprint[:])
+	e.writeBool(res.Packed != nil)
+	if p := res.Packed; p != nil {
+		e.writeCiphertexts(p.Cts)
+		e.writeInt(int64(p.NumSlots))
+		e.writeInt(int64(p.NumCiphertextsPerSlot))
+		e.writeInt(int64(p.PackingFactor))
+	}
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes an encrypted result encoded by MarshalBinary
+func (res *EncryptedQueryResult) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagEncryptedQueryResult)
+	decoded := &EncryptedQueryResult{}
+
+	n := d.readLen()
+	decoded.Slots = make([]*EncryptedSlot, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		if d.readPresent() {
+			decoded.Slots[i] = &EncryptedSlot{Cts: d.readCiphertexts()}
+		}
+	}
+	decoded.Pk = d.readPublicKey()
+	decoded.SlotBytes = int(d.readInt())
+	decoded.NumBytesPerCiphertext = int(d.readInt())
+	d.readFixedBytes(decoded.KeyFingerprint[:])
+	if d.readBool() {
+		decoded.Packed = &PackedCiphertexts{
+			Cts:                   d.readCiphertexts(),
+			NumSlots:              int(d.readInt()),
+			NumCiphertextsPerSlot: int(d.readInt()),
+			PackingFactor:         int(d.readInt()),
+		}
+	}
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*res = *decoded
+
+	return nil
+}
+
+// MarshalBinary encodes the truncated slots and the encrypted checksums
+func (res *CompactEncryptedQueryResult) MarshalBinary() ([]byte, error) {
+
+	if res.EncryptedQueryResult == nil {
+		return nil, errors.New("compact result has no encrypted result")
+	}
+
+	b, err := res.EncryptedQueryResult.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	e := newEncoder(tagCompactEncryptedQueryResult)
+	e.writeBytes(b)
+	e.writeInt(int64(res.NumChunks))
+	e.writeCiphertexts(res.Checksums)
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a compact result encoded by MarshalBinary
+func (res *CompactEncryptedQueryResult) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagCompactEncryptedQueryResult)
+	decoded := &CompactEncryptedQueryResult{EncryptedQueryResult: &EncryptedQueryResult{}}
+
+	encrypted := d.readBytes()
+	decoded.NumChunks = int(d.readInt())
+	decoded.Checksums = d.readCiphertexts()
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	if err := decoded.EncryptedQueryResult.UnmarshalBinary(encrypted); err != nil {
+		return err
+	}
+
+	*res = *decoded
+
+	return nil
+}
+
+// MarshalBinary encodes the doubly encrypted slots (including the public key)
+func (res *DoublyEncryptedQueryResult) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagDoublyEncryptedQueryResult)
+	e.writeInt(int64(len(res.Slots)))
+	for _, slot := range res.Slots {
+		if slot == nil {
+			e.writeByte(0)
+			continue
+		}
+		e.writeByte(1)
+		e.writeCiphertexts(slot.Cts)
+	}
+	if err := e.writeFields(res.Pk); err != nil {
+		return nil, err
+	}
+	e.writeInt(int64(res.SlotBytes))
+	e.writeInt(int64(res.NumBytesPerCiphertext))
+	e.writeBytes(res.KeyFingerprint[:])
+	e.writeInt(int64(res.ChunksPerCiphertext))
+	e.writeInt(int64(res.ChunkBytes))
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a doubly encrypted result encoded by MarshalBinary
+func (res *DoublyEncryptedQueryResult) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagDoublyEncryptedQueryResult)
+	decoded := &DoublyEncryptedQueryResult{}
+
+	n := d.readLen()
+	decoded.Slots = make([]*DoublyEncryptedSlot, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		if d.readPresent() {
+			decoded.Slots[i] = &DoublyEncryptedSlot{Cts: d.readCiphertexts()}
+		}
+	}
+	decoded.Pk = d.readPublicKey()
+	decoded.SlotBytes = int(d.readInt())
+	decoded.NumBytesPerCiphertext = int(d.readInt())
+	d.readFixedBytes(decoded.KeyFingerprint[:])
+	decoded.ChunksPerCiphertext = int(d.readInt())
+	decoded.ChunkBytes = int(d.readInt())
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*res = *decoded
+
+	return nil
+}
+
+// writeMarshaler writes the encoding of v as a nullable byte string.
+// present is passed separately since v holds a typed nil pointer when absent
+func (e *encoder) writeMarshaler(present bool, v encoding.BinaryMarshaler) error {
+
+	if !present {
+		e.writeByte(0)
+		return nil
+	}
+
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	e.writeByte(1)
+	e.writeBytes(b)
+
+	return nil
+}
+
+// readUnmarshaler decodes a value written by writeMarshaler into v
+// and returns false if the value was absent
+func (d *decoder) readUnmarshaler(v encoding.BinaryUnmarshaler) bool {
+
+	if !d.readPresent() {
+		return false
+	}
+
+	b := d.readBytes()
+	if d.err != nil {
+		return false
+	}
+
+	if err := v.UnmarshalBinary(b); err != nil {
+		d.err = ErrInvalidEncoding
+		return false
+	}
+
+	return true
+}
+
+func (d *decoder) readPublicKey() *paillier.PublicKey {
+	pk := &paillier.PublicKey{}
+	if !d.readFields(pk) {
+		return nil
+	}
+	return pk
+}
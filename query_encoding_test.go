@@ -0,0 +1,181 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestQueryShareEncoding' to see log outputs.
+func TestQueryShareEncoding(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	attributes := make([]uint64, db.DBSize)
+	for i := range attributes {
+		attributes[i] = 1
+	}
+	if err := db.SetAttributes(attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	groupSize := 2
+	qIndex := rand.Intn(db.DBSize / groupSize)
+
+	queries := [][]*QueryShare{
+		db.NewIndexQueryShares(qIndex, groupSize, 3),
+		db.NewIndexQuerySharesWithAttributeMask(qIndex, groupSize, 2, 1),
+	}
+	for _, variant := range []KeyVariant{KeyPayloadInLeaf, KeyFullDepth, KeyEarlyTermination, KeyAsymmetric} {
+		queries = append(queries, db.NewIndexQuerySharesWithKeyVariant(qIndex, groupSize, variant, 4))
+	}
+
+	for _, shares := range queries {
+		resShares := make([]*SecretSharedQueryResult, len(shares))
+		for i, share := range shares {
+			b, err := share.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// truncated encodings are rejected
+			if err := (&QueryShare{}).UnmarshalBinary(b[:len(b)-1]); err == nil {
+				t.Fatalf("Decoded a truncated query share")
+			}
+
+			decoded := &QueryShare{}
+			if err := decoded.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := db.AnswerSharedQuery(decoded, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, err = res.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resShares[i] = &SecretSharedQueryResult{}
+			if err := resShares[i].UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		slots, _ := db.RecoverGroup(resShares, qIndex)
+		for j, slot := range slots {
+			if !db.Slots[qIndex*groupSize+j].Equal(slot) {
+				t.Fatalf("Query result is incorrect after decoding. %v != %v\n", db.Slots[qIndex*groupSize+j], slot)
+			}
+		}
+	}
+
+	// a share is not decoded as another type
+	b, _ := queries[0][0].MarshalBinary()
+	if err := (&SecretSharedQueryResult{}).UnmarshalBinary(b); err != ErrInvalidEncoding {
+		t.Fatalf("Decoded a query share as a result: %v", err)
+	}
+}
+
+// run with 'go test -v -run TestEncryptedQueryEncoding' to see log outputs.
+func TestEncryptedQueryEncoding(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 2
+	qIndex := rand.Intn(db.DBSize / groupSize)
+
+	query := db.NewEncryptedQuery(pk, groupSize, qIndex)
+	b, err := query.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedQuery := &EncryptedQuery{}
+	if err := decodedQuery.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.PrivateEncryptedQuery(decodedQuery, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = res.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedRes := &EncryptedQueryResult{}
+	if err := decodedRes.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := recoverEncrypted(t, res, sk)
+	slots := recoverEncrypted(t, decodedRes, sk)
+	if len(slots) != len(want) {
+		t.Fatalf("Recovered %v slots after decoding instead of %v", len(slots), len(want))
+	}
+	for j := range want {
+		if !want[j].Equal(slots[j]) {
+			t.Fatalf("Query result is incorrect after decoding. %v != %v\n", want[j], slots[j])
+		}
+	}
+}
+
+// run with 'go test -v -run TestDoublyEncryptedQueryEncoding' to see log outputs.
+func TestDoublyEncryptedQueryEncoding(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 2
+	qIndex := rand.Intn(db.DBSize / groupSize)
+
+	query := db.NewDoublyEncryptedQuery(pk, groupSize, qIndex)
+	b, err := query.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodedQuery := &DoublyEncryptedQuery{}
+	if err := decodedQuery.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.PrivateDoublyEncryptedQuery(decodedQuery, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = res.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (&DoublyEncryptedQueryResult{}).UnmarshalBinary(append(b, 0)); err == nil {
+		t.Fatalf("Decoded a result with trailing bytes")
+	}
+
+	decodedRes := &DoublyEncryptedQueryResult{}
+	if err := decodedRes.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	want := recoverDoublyEncrypted(t, res, sk)
+	slots := recoverDoublyEncrypted(t, decodedRes, sk)
+	if len(slots) != len(want) {
+		t.Fatalf("Recovered %v slots after decoding instead of %v", len(slots), len(want))
+	}
+	for j := range want {
+		if !want[j].Equal(slots[j]) {
+			t.Fatalf("Query result is incorrect after decoding. %v != %v\n", want[j], slots[j])
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package pir
+
+import (
+	"errors"
+	"sync"
+)
+
+/*
+ Retry-safe query regeneration.
+ The shares of a secret shared query hide the index from each server but
+ any two of them together reveal it, so a share must only ever be sent
+ to the server it was generated for. A client that retries a failed
+ query (e.g., against a replacement for a server that did not answer)
+ must not resend the shares it already sent: the old share held by the
+ new server and the old shares held by the other servers would reveal
+ the index together. Instead, the query is regenerated with fresh
+ randomness and the new shares are sent to all the servers. A QuerySet
+ makes this the easy pattern: its shares can be taken only once (see
+ Shares) and Refresh regenerates the shares for the same index in a new
+ set and invalidates the old one.
+*/
+
+// ErrQuerySetUsed is returned when the shares of a QuerySet are taken a second time
+// (retry with the shares of Refresh)
+var ErrQuerySetUsed = errors.New("query shares were already sent (refresh the query set to retry)")
+
+// ErrQuerySetInvalidated is returned when the shares of a QuerySet that was refreshed are taken
+var ErrQuerySetInvalidated = errors.New("query set was refreshed")
+
+// QuerySet holds the shares of a secret shared query for the group of a logical index,
+// one share per server
+type QuerySet struct {
+	dbmd      DBMetadata
+	index     int
+	groupSize int
+	numShares uint
+
+	mu          sync.Mutex
+	shares      []*QueryShare
+	used        bool
+	invalidated bool
+}
+
+// NewQuerySet generates the shares of a query for the group holding the slot at the
+// logical index (see GroupPosition)
+func (dbmd *DBMetadata) NewQuerySet(index, groupSize int, numShares uint) (*QuerySet, error) {
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, errors.New("index out of range")
+	}
+
+	if groupSize <= 0 {
+		return nil, errors.New("invalid group size")
+	}
+
+	qs := &QuerySet{
+		dbmd:      *dbmd,
+		index:     index,
+		groupSize: groupSize,
+		numShares: numShares,
+	}
+
+	row, _ := dbmd.GroupPosition(index, groupSize)
+	qs.shares = dbmd.NewIndexQueryShares(row, groupSize, numShares)
+
+	return qs, nil
+}
+
+// Index returns the logical index the query set retrieves
+func (qs *QuerySet) Index() int {
+	return qs.index
+}
+
+// Group returns the group retrieved by the query set and the position
+// of the slot of the index within the group (see GroupPosition)
+func (qs *QuerySet) Group() (int, int) {
+	return qs.dbmd.GroupPosition(qs.index, qs.groupSize)
+}
+
+// Shares returns the shares of the query, the i-th for the i-th server.
+// The shares can only be taken once: returns ErrQuerySetUsed if they were already
+// taken and ErrQuerySetInvalidated if the set was refreshed
+func (qs *QuerySet) Shares() ([]*QueryShare, error) {
+
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	if qs.invalidated {
+		return nil, ErrQuerySetInvalidated
+	}
+
+	if qs.used {
+		return nil, ErrQuerySetUsed
+	}
+
+	qs.used = true
+
+	return qs.shares, nil
+}
+
+// Refresh returns a new query set for the same index with shares generated with fresh
+// randomness and invalidates the query set (its shares can no longer be taken).
+// Queries rejected with ErrStaleLayout need a new query set for the new metadata instead
+func (qs *QuerySet) Refresh() *QuerySet {
+
+	qs.mu.Lock()
+	qs.invalidated = true
+	qs.shares = nil
+	qs.mu.Unlock()
+
+	row, _ := qs.Group()
+
+	return &QuerySet{
+		dbmd:      qs.dbmd,
+		index:     qs.index,
+		groupSize: qs.groupSize,
+		numShares: qs.numShares,
+		shares:    qs.dbmd.NewIndexQueryShares(row, qs.groupSize, qs.numShares),
+	}
+}
+
+// Recover combines the result shares of the query and returns the slot of the index
+func (qs *QuerySet) Recover(resShares []*SecretSharedQueryResult) *Slot {
+
+	row, pos := qs.Group()
+	slots, _ := qs.dbmd.RecoverGroup(resShares, row)
+
+	return slots[pos]
+}
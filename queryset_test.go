@@ -0,0 +1,118 @@
+package pir
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestQuerySetRefresh(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	dbmd := db.Metadata()
+	answer := answerWith(db)
+
+	index := rand.Intn(TestDBSize)
+	qs, err := dbmd.NewQuerySet(index, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := qs.Shares()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the shares are only handed out once
+	if _, err := qs.Shares(); !errors.Is(err, ErrQuerySetUsed) {
+		t.Fatalf("Expected ErrQuerySetUsed, got %v\n", err)
+	}
+
+	refreshed := qs.Refresh()
+	if _, err := qs.Shares(); !errors.Is(err, ErrQuerySetInvalidated) {
+		t.Fatalf("Expected ErrQuerySetInvalidated, got %v\n", err)
+	}
+
+	if refreshed.Index() != index {
+		t.Fatalf("Refreshed set retrieves index %v instead of %v\n", refreshed.Index(), index)
+	}
+
+	newShares, err := refreshed.Shares()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fresh randomness
+	for i := range shares {
+		if bytes.Equal(shares[i].KeyTwoParty.SInit, newShares[i].KeyTwoParty.SInit) {
+			t.Fatalf("Share %v was not regenerated\n", i)
+		}
+	}
+
+	resShares, err := answer(newShares)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slot := refreshed.Recover(resShares); !slot.Equal(db.Slots[index]) {
+		t.Fatalf("Incorrect slot at index %v: %v != %v\n", index, slot, db.Slots[index])
+	}
+
+	if _, err := dbmd.NewQuerySet(TestDBSize, 4, 2); err == nil {
+		t.Fatalf("Query set for an index out of range was generated\n")
+	}
+}
+
+func TestClientRetriesWithFreshShares(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	answer := answerWith(db)
+
+	errUnavailable := errors.New("server unavailable")
+
+	var sent [][]byte
+	failures := 2
+	query := func(shares []*QueryShare) ([]*SecretSharedQueryResult, error) {
+		for _, share := range shares {
+			sent = append(sent, share.KeyTwoParty.SInit)
+		}
+		if failures > 0 {
+			failures--
+			return nil, errUnavailable
+		}
+		return answer(shares)
+	}
+
+	client := NewClient(db.Metadata(), 4, 2, query)
+
+	// no retries by default
+	if _, err := client.Get(5); !errors.Is(err, errUnavailable) {
+		t.Fatalf("Expected the query to fail, got %v\n", err)
+	}
+
+	client.Retries = 2
+	slot, err := client.Get(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slot.Equal(db.Slots[5]) {
+		t.Fatalf("Incorrect slot at index 5: %v != %v\n", slot, db.Slots[5])
+	}
+
+	// no share was sent twice
+	for i := range sent {
+		for j := i + 1; j < len(sent); j++ {
+			if bytes.Equal(sent[i], sent[j]) {
+				t.Fatalf("Shares %v and %v are identical\n", i, j)
+			}
+		}
+	}
+
+	if len(sent) != 6 {
+		t.Fatalf("Expected 3 attempts, got %v shares\n", len(sent))
+	}
+}
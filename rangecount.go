@@ -0,0 +1,133 @@
+package pir
+
+import (
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Private range counts.
+ A client privately learns how many keys of a PrivateSqrtST fall in a
+ range [lo, hi] (or whether any does) without retrieving the keys in the
+ range. The keys in the range are those between the ranks of the two
+ boundaries in the sorted data: the selection vector of the range is the
+ interval of indices between the ranks and the count is its sum. The rank
+ of a boundary (the number of keys greater than it) is known from the
+ public first layer up to the row of the second layer that holds the
+ boundary, so the client retrieves the two rows that hold the boundaries
+ (see RangeRows) with any query of the second layer and counts the keys
+ of those rows that are in the range (see RangeCount); the rows strictly
+ between the boundaries are full and are counted from the layout. Both
+ rows are always retrieved (even when they are the same row) so that the
+ servers do not learn whether the range fits in a row. Keys are assumed
+ to be distinct.
+*/
+
+// RangeRows returns the rows of the second layer that hold the boundaries of the range
+// [lo, hi]: the row of hi first and the row of lo second
+func (sqst *PrivateSqrtST) RangeRows(lo, hi string) (int, int) {
+	return sqst.RowForKey(hi), sqst.RowForKey(lo)
+}
+
+// NewRangeQueryShares generates the query shares for the two rows returned by RangeRows,
+// the shares of the row of hi first
+func (sqst *PrivateSqrtST) NewRangeQueryShares(lo, hi string, numShares uint) ([][]*QueryShare, error) {
+
+	if lo > hi {
+		return nil, fmt.Errorf("range [%v, %v] is empty", lo, hi)
+	}
+
+	md := sqst.GetSecondLayerMetadata()
+	hiRow, loRow := sqst.RangeRows(lo, hi)
+
+	return [][]*QueryShare{
+		md.NewIndexQueryShares(hiRow, sqst.Height, numShares),
+		md.NewIndexQueryShares(loRow, sqst.Height, numShares),
+	}, nil
+}
+
+// NewEncryptedRangeQueries generates the encrypted queries for the two rows returned by
+// RangeRows, the query for the row of hi first
+func (sqst *PrivateSqrtST) NewEncryptedRangeQueries(pk *paillier.PublicKey, lo, hi string) ([]*EncryptedQuery, error) {
+
+	if lo > hi {
+		return nil, fmt.Errorf("range [%v, %v] is empty", lo, hi)
+	}
+
+	hiQuery, _ := sqst.NewEncryptedKeywordQuery(pk, hi)
+	loQuery, _ := sqst.NewEncryptedKeywordQuery(pk, lo)
+
+	return []*EncryptedQuery{hiQuery, loQuery}, nil
+}
+
+// RangeCount returns the number of keys in [lo, hi] given the slots recovered for the
+// rows of hi and lo (see RangeRows)
+func (sqst *PrivateSqrtST) RangeCount(lo, hi string, hiSlots, loSlots []*Slot) (int, error) {
+
+	if lo > hi {
+		return 0, nil
+	}
+
+	hiRow, loRow := sqst.RangeRows(lo, hi)
+
+	above, err := sqst.rank(hi, hiRow, hiSlots, false)
+	if err != nil {
+		return 0, err
+	}
+
+	atLeast, err := sqst.rank(lo, loRow, loSlots, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if atLeast < above {
+		return 0, nil
+	}
+
+	return atLeast - above, nil
+}
+
+// RangeExists returns whether there is a key in [lo, hi] (see RangeCount)
+func (sqst *PrivateSqrtST) RangeExists(lo, hi string, hiSlots, loSlots []*Slot) (bool, error) {
+
+	count, err := sqst.RangeCount(lo, hi, hiSlots, loSlots)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// rank returns the number of keys (excluding padding) greater than key, or greater than
+// or equal to key if inclusive, given the slots recovered for the row of the key
+func (sqst *PrivateSqrtST) rank(key string, rowIndex int, res []*Slot, inclusive bool) (int, error) {
+
+	if len(res) != sqst.Width {
+		return 0, fmt.Errorf("expected %v slots for row %v, got %v", sqst.Width, rowIndex, len(res))
+	}
+
+	md := sqst.GetSecondLayerMetadata()
+	query := NewSlotFromString(key, md.SlotBytes)
+
+	// the keys of the rows before the row of the key are all greater than the key
+	// and the keys of the rows after it are all smaller (data is sorted in descending order)
+	start := rowIndex * sqst.Width
+	count := start
+	if numKeys := md.DBSize - md.NumPaddingSlots; count > numKeys {
+		count = numKeys
+	}
+
+	for i, slot := range res {
+		if md.IsPaddingSlot(start + i) {
+			break
+		}
+
+		cmp := slot.Compare(query)
+		if cmp > 0 || (inclusive && cmp == 0) {
+			count++
+		}
+	}
+
+	return count, nil
+}
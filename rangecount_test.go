@@ -0,0 +1,127 @@
+package pir
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+func TestRangeCountSqrtST(t *testing.T) {
+	setup()
+
+	numStrings := rand.Intn(1<<8) + 100
+	data := PadToSqrt(generateStringsInSequence(numStrings))
+	sort.Strings(data)
+	sort.Sort(sort.Reverse(sort.StringSlice(data)))
+
+	sqst := NewPrivateSqrtST()
+	if err := sqst.BuildForDataWithPadding(data, len(data)-numStrings); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := func(lo, hi string) int {
+		count := 0
+		for _, key := range data {
+			if key != padding && key >= lo && key <= hi {
+				count++
+			}
+		}
+		return count
+	}
+
+	keys := generateStringsInSequence(len(data) + 10)
+	for trial := 0; trial < NumTrials; trial++ {
+		lo, hi := keys[rand.Intn(len(keys))], keys[rand.Intn(len(keys))]
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+
+		queries, err := sqst.NewRangeQueryShares(lo, hi, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows := make([][]*Slot, len(queries))
+		for i, shares := range queries {
+			resA, err := sqst.PrivateQuery(shares[0], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resB, err := sqst.PrivateQuery(shares[1], NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows[i] = Recover([]*SecretSharedQueryResult{resA, resB})
+		}
+
+		count, err := sqst.RangeCount(lo, hi, rows[0], rows[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != expected(lo, hi) {
+			t.Fatalf("Incorrect count of [%v, %v]: %v, expected %v\n", lo, hi, count, expected(lo, hi))
+		}
+
+		exists, err := sqst.RangeExists(lo, hi, rows[0], rows[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exists != (count > 0) {
+			t.Fatalf("Incorrect existence of [%v, %v]\n", lo, hi)
+		}
+	}
+
+	// ranges that contain no key
+	if _, err := sqst.NewRangeQueryShares("b", "a", 2); err == nil {
+		t.Fatal("Empty range was accepted")
+	}
+}
+
+func TestEncryptedRangeCountSqrtST(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	numStrings := rand.Intn(1<<6) + 50
+	data := PadToSqrt(generateStringsInSequence(numStrings))
+	sort.Strings(data)
+	sort.Sort(sort.Reverse(sort.StringSlice(data)))
+
+	sqst := NewPrivateSqrtST()
+	if err := sqst.BuildForDataWithPadding(data, len(data)-numStrings); err != nil {
+		t.Fatal(err)
+	}
+
+	// the whole data and a single key
+	ranges := [][2]string{{"0", "99999"}, {data[0], data[0]}, {"x", "z"}}
+	expected := []int{len(data) - sqst.NumPadding, 1, 0}
+
+	for i, r := range ranges {
+		queries, err := sqst.NewEncryptedRangeQueries(pk, r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows := make([][]*Slot, len(queries))
+		for j, query := range queries {
+			res, err := sqst.PrivateEncryptedQuery(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows[j] = recoverEncrypted(t, res, sk)
+		}
+
+		count, err := sqst.RangeCount(r[0], r[1], rows[0], rows[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != expected[i] {
+			t.Fatalf("Incorrect count of %v: %v, expected %v\n", r, count, expected[i])
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package pir
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Rate-distortion mode.
+ Slots are often padded with zeros (values shorter than the slot size),
+ so the high-order ciphertexts of an encrypted result (the ciphertexts
+ encoding the last bytes of the slots) mostly encrypt zeros. In this
+ mode the server drops the ciphertexts past the first NumChunks, chosen
+ so that at most MaxFailureRate of the slots have data in the dropped
+ ciphertexts, and adds an encrypted checksum of each slot to the result.
+ The client recovers the slots assuming that the dropped ciphertexts
+ encrypt zeros and compares them with their checksums (see
+ RecoverCompact): a slot with data in the dropped ciphertexts fails the
+ check and the client retries with a full encrypted query. The response
+ (and the work of the server) shrinks by the fraction of ciphertexts
+ dropped, at the cost of a retry for at most MaxFailureRate of the slots.
+*/
+
+// ErrLossyResult is matched (using errors.Is) by the error returned by RecoverCompact
+// when slots fail their checksum. The error is a *LossyResultError
+var ErrLossyResult = errors.New("slots were not recovered from the compact result")
+
+// LossyResultError lists the slots of a compact result that failed their checksum;
+// the other slots are recovered correctly
+type LossyResultError struct {
+	Cols []int
+}
+
+func (e *LossyResultError) Error() string {
+	return fmt.Sprintf("%v: slots %v failed their checksum (retry with a full query)", ErrLossyResult, e.Cols)
+}
+
+// Is reports whether target is ErrLossyResult
+func (e *LossyResultError) Is(target error) bool {
+	return target == ErrLossyResult
+}
+
+// checksumDomain separates the slot checksums from other uses of the hash function
+const checksumDomain = "pir-slot-checksum-v1"
+
+// checksumBytes is the size of the checksum of a slot (encrypted in a single ciphertext)
+const checksumBytes = 8
+
+// RateDistortionOptions configure compact encrypted results
+type RateDistortionOptions struct {
+	// MaxFailureRate is the largest fraction of the slots that may have data
+	// in the dropped ciphertexts (0 only drops ciphertexts that are zero in every slot)
+	MaxFailureRate float64
+}
+
+// CompactEncryptedQueryResult is an encrypted result whose slots are truncated to
+// their first NumChunks ciphertexts along with the encrypted checksums of the slots
+type CompactEncryptedQueryResult struct {
+	*EncryptedQueryResult
+	NumChunks int
+	Checksums []*paillier.Ciphertext
+}
+
+// slotChecksum returns the checksum of the slot data
+func slotChecksum(data []byte) *gmp.Int {
+
+	h := sha256.New()
+	h.Write([]byte(checksumDomain))
+	h.Write(data)
+
+	return new(gmp.Int).SetBytes(h.Sum(nil)[:checksumBytes])
+}
+
+// PrivateEncryptedQueryCompact answers the encrypted query with a compact result
+// (see RateDistortionOptions and RecoverCompact)
+func (db *Database) PrivateEncryptedQueryCompact(query *EncryptedQuery, opts RateDistortionOptions, nprocs int) (*CompactEncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := db.checkEncryptedQuery(query); err != nil {
+		return nil, err
+	}
+
+	if opts.MaxFailureRate < 0 || opts.MaxFailureRate > 1 {
+		return nil, fmt.Errorf("failure rate %v is not in [0, 1]", opts.MaxFailureRate)
+	}
+
+	if err := db.checkQueryMemory(db.estimateEncryptedQueryMemory(query, nprocs)); err != nil {
+		return nil, err
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	dimWidth := query.DBWidth
+	dimHeight := query.DBHeight
+
+	params := db.paramsForPublicKey(query.Pk)
+	numCiphertextsPerSlot := params.numCiphertextsPerSlot
+	numChunks := db.compactNumChunks(numCiphertextsPerSlot, opts.MaxFailureRate)
+
+	// slots that are not selectable are recovered as zeros
+	zeroChecksum := slotChecksum(make([]byte, db.SlotBytes))
+
+	// mapping of results and checksums; one for each process
+	slotRes := make([][]*EncryptedSlot, nprocs)
+	checksumRes := make([][]*paillier.Ciphertext, nprocs)
+	procBytesPerCiphertext := make([]int, nprocs)
+
+	for i := range slotRes {
+		slotRes[i] = make([]*EncryptedSlot, dimWidth)
+		checksumRes[i] = make([]*paillier.Ciphertext, dimWidth)
+		for col := 0; col < dimWidth; col++ {
+			slotRes[i][col] = &EncryptedSlot{
+				Cts: make([]*paillier.Ciphertext, numChunks),
+			}
+			for j := range slotRes[i][col].Cts {
+				slotRes[i][col].Cts[j] = params.nullLevelOne
+			}
+			checksumRes[i][col] = params.nullLevelOne
+		}
+	}
+
+	err := parallelRanges(context.Background(), dimHeight, nprocs, func(i, start, end int) error {
+		for row := start; row < end; row++ {
+			for col := 0; col < dimWidth; col++ {
+				checksum := zeroChecksum
+
+				slotIndex := row*dimWidth + col
+				if slotIndex < len(db.Slots) && db.matchesAttributes(slotIndex, query.AttributeMask) {
+					intArr, numBytesPerInt, err := db.Slots[slotIndex].ToGmpIntArray(numCiphertextsPerSlot)
+					if err != nil {
+						return err
+					}
+					procBytesPerCiphertext[i] = numBytesPerInt
+
+					// the dropped chunks are not computed
+					for j, val := range intArr[:numChunks] {
+						sel := query.Pk.ConstMult(query.EBits[row], val)
+						slotRes[i][col].Cts[j] = query.Pk.Add(slotRes[i][col].Cts[j], sel)
+					}
+
+					checksum = slotChecksum(db.Slots[slotIndex].Data)
+				}
+
+				sel := query.Pk.ConstMult(query.EBits[row], checksum)
+				checksumRes[i][col] = query.Pk.Add(checksumRes[i][col], sel)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	numBytesPerCiphertext := 0
+	for _, n := range procBytesPerCiphertext {
+		if n != 0 {
+			numBytesPerCiphertext = n
+			break
+		}
+	}
+
+	slots, checksums := slotRes[0], checksumRes[0]
+	for i := 1; i < nprocs; i++ {
+		for col := 0; col < dimWidth; col++ {
+			addEncryptedSlots(query.Pk, slots[col], slotRes[i][col])
+			checksums[col] = query.Pk.Add(checksums[col], checksumRes[i][col])
+		}
+	}
+
+	return &CompactEncryptedQueryResult{
+		EncryptedQueryResult: &EncryptedQueryResult{
+			Pk:                    query.Pk,
+			Slots:                 slots,
+			NumBytesPerCiphertext: numBytesPerCiphertext,
+			SlotBytes:             db.SlotBytes,
+		},
+		NumChunks: numChunks,
+		Checksums: checksums,
+	}, nil
+}
+
+// compactNumChunks returns the smallest number of chunks (out of numChunks) holding
+// all the data of all but at most maxFailureRate of the slots
+func (db *Database) compactNumChunks(numChunks int, maxFailureRate float64) int {
+
+	numBytesPerChunk := ceilDiv(db.SlotBytes, numChunks)
+	if numBytesPerChunk < 1 {
+		numBytesPerChunk = 1
+	}
+
+	// number of slots whose data ends in each chunk
+	ends := make([]int, numChunks+1)
+	for _, slot := range db.Slots {
+		used := len(slot.Data)
+		for used > 0 && slot.Data[used-1] == 0 {
+			used--
+		}
+
+		chunk := ceilDiv(used, numBytesPerChunk)
+		if chunk > numChunks {
+			chunk = numChunks
+		}
+		ends[chunk]++
+	}
+
+	maxFailures := int(maxFailureRate * float64(len(db.Slots)))
+
+	// drop chunks from the end while the slots with data in them are few enough
+	failures := 0
+	for k := numChunks; k > 1; k-- {
+		if failures+ends[k] > maxFailures {
+			return k
+		}
+		failures += ends[k]
+	}
+
+	return 1
+}
+
+// RecoverCompact decrypts the compact result and checks the slots against their checksums.
+// Returns a *LossyResultError listing the slots that failed their checksum (which must be
+// retrieved with a full query); the other slots are correct
+func RecoverCompact(res *CompactEncryptedQueryResult, sk *paillier.SecretKey) ([]*Slot, error) {
+
+	if len(res.Checksums) != len(res.Slots) {
+		return nil, errors.New("compact result does not have a checksum per slot")
+	}
+
+	slots, err := RecoverEncrypted(res.EncryptedQueryResult, sk)
+	if err != nil {
+		return nil, err
+	}
+
+	lossy := &LossyResultError{}
+	for i, slot := range slots {
+		if sk.Decrypt(res.Checksums[i]).Cmp(slotChecksum(slot.Data)) != 0 {
+			lossy.Cols = append(lossy.Cols, i)
+		}
+	}
+
+	if len(lossy.Cols) > 0 {
+		return slots, lossy
+	}
+
+	return slots, nil
+}
@@ -0,0 +1,84 @@
+package pir
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestRateDistortion' to see log outputs.
+func TestRateDistortion(t *testing.T) {
+	setup()
+
+	// short values except for one long value per 20
+	data := make([]string, 100)
+	for i := range data {
+		data[i] = "v" + strings.Repeat("x", i%10)
+		if i%20 == 7 {
+			data[i] = strings.Repeat("long value ", 6)
+		}
+	}
+
+	db := NewDatabase()
+	db.BuildForDataWithSlotSize(data, 96)
+
+	sk, pk := paillier.KeyGen(128)
+
+	retrieve := func(index int, opts RateDistortionOptions) (*CompactEncryptedQueryResult, *Slot, error) {
+		// 10 x 10 grid
+		query := db.NewEncryptedQueryWithDimentions(pk, 10, 10, 1, index/10)
+
+		res, err := db.PrivateEncryptedQueryCompact(query, opts, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the result survives the wire
+		b, err := res.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := &CompactEncryptedQueryResult{}
+		if err := decoded.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+
+		slots, err := RecoverCompact(decoded, sk)
+		return res, slots[index%10], err
+	}
+
+	numCiphertextsPerSlot := db.paramsForPublicKey(pk).numCiphertextsPerSlot
+
+	// without failures only the chunks that are zero in every slot are dropped
+	res, slot, err := retrieve(7, RateDistortionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slot.Equal(db.Slots[7]) {
+		t.Fatalf("Incorrect slot %v\n", slot)
+	}
+
+	full := res.NumChunks
+
+	// the long values fail with a 5% failure rate
+	res, slot, err = retrieve(12, RateDistortionOptions{MaxFailureRate: 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slot.Equal(db.Slots[12]) {
+		t.Fatalf("Incorrect slot %v\n", slot)
+	}
+	if res.NumChunks >= full || res.NumChunks > numCiphertextsPerSlot {
+		t.Fatalf("Result has %v chunks (%v without failures)\n", res.NumChunks, full)
+	}
+
+	_, _, err = retrieve(27, RateDistortionOptions{MaxFailureRate: 0.05})
+	var lossy *LossyResultError
+	if !errors.Is(err, ErrLossyResult) || !errors.As(err, &lossy) || len(lossy.Cols) != 1 || lossy.Cols[0] != 7 {
+		t.Fatalf("Expected a checksum failure of slot 7, got %v\n", err)
+	}
+
+	t.Logf("Chunks: %v of %v (%v without failures)\n", res.NumChunks, numCiphertextsPerSlot, full)
+}
@@ -0,0 +1,149 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+/*
+ Incremental recovery of secret shared results.
+ Recover needs every result share up front. In asynchronous deployments
+ the shares arrive from the servers at different times, so a Recovery
+ combines each share as soon as it arrives and rejects shares whose
+ shape does not match the metadata (or the shares added before it)
+ without waiting for the remaining servers.
+*/
+
+// ErrRecoveryShapeMismatch is matched (using errors.Is) by the error returned when
+// a result share does not have the expected shape. The error is a *RecoveryShapeError
+var ErrRecoveryShapeMismatch = errors.New("result share has an unexpected shape")
+
+// ErrRecoveryDone is returned when adding a share to a finished Recovery
+var ErrRecoveryDone = errors.New("recovery is done")
+
+// RecoveryShapeError describes the result share that has an unexpected shape
+type RecoveryShapeError struct {
+	Share  int // number of shares added before the rejected share
+	Reason string
+}
+
+func (e *RecoveryShapeError) Error() string {
+	return fmt.Sprintf("%v: share %v: %v", ErrRecoveryShapeMismatch, e.Share, e.Reason)
+}
+
+// Is reports whether target is ErrRecoveryShapeMismatch
+func (e *RecoveryShapeError) Is(target error) bool {
+	return target == ErrRecoveryShapeMismatch
+}
+
+// Recovery combines the result shares of a secret shared query one at a time.
+// It is safe for concurrent use
+type Recovery struct {
+	dbmd DBMetadata
+
+	mu        sync.Mutex
+	slots     []*Slot // xor of the shares added so far
+	numShares int
+	done      bool
+}
+
+// NewRecovery returns an empty Recovery for results retrieved from the
+// database described by dbmd. The number of slots per share is fixed by
+// the first share added
+func NewRecovery(dbmd DBMetadata) *Recovery {
+	return &Recovery{dbmd: dbmd}
+}
+
+// Add combines the result share with the shares added so far.
+// Returns a *RecoveryShapeError (and ignores the share) if the share does not
+// match the slot size of the database or the number of slots of the
+// previous shares
+func (r *Recovery) Add(share *SecretSharedQueryResult) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return ErrRecoveryDone
+	}
+
+	if share == nil || len(share.Shares) == 0 {
+		return &RecoveryShapeError{Share: r.numShares, Reason: "no slots"}
+	}
+
+	if share.SlotBytes != r.dbmd.SlotBytes {
+		return &RecoveryShapeError{
+			Share:  r.numShares,
+			Reason: fmt.Sprintf("slot size %v (expected %v)", share.SlotBytes, r.dbmd.SlotBytes),
+		}
+	}
+
+	if r.slots != nil && len(share.Shares) != len(r.slots) {
+		return &RecoveryShapeError{
+			Share:  r.numShares,
+			Reason: fmt.Sprintf("%v slots (expected %v)", len(share.Shares), len(r.slots)),
+		}
+	}
+
+	for i, slot := range share.Shares {
+		if slot == nil || len(slot.Data) != share.SlotBytes {
+			return &RecoveryShapeError{
+				Share:  r.numShares,
+				Reason: fmt.Sprintf("slot %v does not have %v bytes", i, share.SlotBytes),
+			}
+		}
+	}
+
+	if r.slots == nil {
+		r.slots = make([]*Slot, len(share.Shares))
+		for i := range r.slots {
+			r.slots[i] = &Slot{Data: make([]byte, share.SlotBytes)}
+		}
+	}
+
+	for i, slot := range share.Shares {
+		XorSlots(r.slots[i], slot)
+	}
+
+	r.numShares++
+
+	return nil
+}
+
+// NumShares returns the number of shares added so far
+func (r *Recovery) NumShares() int {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.numShares
+}
+
+// Done returns the recovered slots (the same slots as Recover given all the shares
+// added). No shares can be added once the recovery is done
+func (r *Recovery) Done() ([]*Slot, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.numShares == 0 {
+		return nil, errors.New("no result shares were added")
+	}
+
+	r.done = true
+
+	return r.slots, nil
+}
+
+// DoneGroup returns the slots recovered for the group at index (see RecoverGroup)
+// along with the number of valid slots
+func (r *Recovery) DoneGroup(index int) ([]*Slot, int, error) {
+
+	slots, err := r.Done()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return slots, r.dbmd.numSlotsInDatabase(index*len(slots), len(slots)), nil
+}
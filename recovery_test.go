@@ -0,0 +1,73 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+)
+
+// run with 'go test -v -run TestRecovery' to see log outputs.
+func TestRecovery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 4
+	index := 3
+
+	shares := db.NewIndexQueryShares(index, groupSize, 3)
+	resShares := make([]*SecretSharedQueryResult, len(shares))
+	for i, share := range shares {
+		var err error
+		if resShares[i], err = db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRecovery(db.DBMetadata)
+
+	// shares are added in any order
+	for _, i := range []int{2, 0, 1} {
+		if err := r.Add(resShares[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// shares with a different number of slots are rejected early
+	short := &SecretSharedQueryResult{SlotBytes: SlotBytes, Shares: resShares[0].Shares[:1]}
+	if err := r.Add(short); !errors.Is(err, ErrRecoveryShapeMismatch) {
+		t.Fatalf("Expected ErrRecoveryShapeMismatch, got %v\n", err)
+	}
+
+	// shares with a different slot size are rejected early
+	wide := &SecretSharedQueryResult{SlotBytes: SlotBytes + 1, Shares: resShares[0].Shares}
+	if err := r.Add(wide); !errors.Is(err, ErrRecoveryShapeMismatch) {
+		t.Fatalf("Expected ErrRecoveryShapeMismatch, got %v\n", err)
+	}
+
+	if r.NumShares() != 3 {
+		t.Fatalf("Rejected shares were added")
+	}
+
+	slots, valid, err := r.DoneGroup(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, expectedValid := db.RecoverGroup(resShares, index)
+	if valid != expectedValid {
+		t.Fatalf("Valid slots %v != %v\n", valid, expectedValid)
+	}
+
+	for i := range slots {
+		if !slots[i].Equal(expected[i]) || !slots[i].Equal(db.Slots[index*groupSize+i]) {
+			t.Fatalf("Recovered slot %v is incorrect\n", i)
+		}
+	}
+
+	if err := r.Add(resShares[0]); !errors.Is(err, ErrRecoveryDone) {
+		t.Fatalf("Expected ErrRecoveryDone, got %v\n", err)
+	}
+
+	if _, err := NewRecovery(db.DBMetadata).Done(); err == nil {
+		t.Fatalf("Recovered slots without any shares")
+	}
+}
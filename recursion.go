@@ -0,0 +1,130 @@
+package pir
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Multi-tier recursion.
+ A doubly encrypted query selects a row of the database with its row
+ query and a group of columns of the selected row with its column query.
+ Each tier carries its own scheme so that deployments can mix backends
+ to balance the upload size (the row tier is sent once per row, the
+ column tier once per group of columns) against server CPU (the row
+ tier touches every slot, the column tier only the row results). The
+ column tier encrypts the row tier's ciphertexts, so its backend must
+ accept them as plaintexts (Paillier level 2 over Paillier level 1).
+ Combinations are answered by the backend registered for the pair of
+ schemes (see ImplementedRecursions); tiers using a scheme that is not
+ implemented or not supported are rejected with an *UnsupportedSchemeError.
+*/
+
+// RecursionSchemes are the schemes of the row and column tiers of a doubly encrypted query
+type RecursionSchemes struct {
+	Row Scheme
+	Col Scheme
+}
+
+func (s RecursionSchemes) String() string {
+	return fmt.Sprintf("%v/%v", s.Row, s.Col)
+}
+
+// recursionBackend answers a doubly encrypted query (with the read lock held)
+type recursionBackend func(db *Database, query *DoublyEncryptedQuery, nprocs int, progress *queryProgress) (*DoublyEncryptedQueryResult, error)
+
+// recursionBackends are the backends answering each combination of tier schemes
+var recursionBackends = map[RecursionSchemes]recursionBackend{
+	{Row: SchemeAHEPaillierV1, Col: SchemeAHEPaillierV1}: (*Database).privateDoublyEncryptedQueryLocked,
+}
+
+// ImplementedRecursions are the combinations of tier schemes that this version of the
+// library can answer (the column tier of SchemeAHEPaillierV1 is Paillier level 2)
+var ImplementedRecursions = []RecursionSchemes{
+	{Row: SchemeAHEPaillierV1, Col: SchemeAHEPaillierV1},
+}
+
+// Schemes returns the schemes of the row and column tiers of the query
+func (query *DoublyEncryptedQuery) Schemes() RecursionSchemes {
+	return RecursionSchemes{Row: query.Row.scheme(), Col: query.Col.scheme()}
+}
+
+// NewDoublyEncryptedQueryWithSchemes generates a doubly encrypted query for the index
+// (see NewDoublyEncryptedQuery) whose tiers use the schemes. Returns an
+// *UnsupportedSchemeError if the combination is not implemented
+func (dbmd *DBMetadata) NewDoublyEncryptedQueryWithSchemes(pk *paillier.PublicKey, groupSize, index int, schemes RecursionSchemes) (*DoublyEncryptedQuery, error) {
+
+	if _, ok := recursionBackends[schemes]; !ok {
+		return nil, &UnsupportedSchemeError{Scheme: Scheme(schemes.String()), Supported: recursionSchemeNames()}
+	}
+
+	// every implemented tier is Paillier
+	query := dbmd.NewDoublyEncryptedQuery(pk, groupSize, index)
+	query.Row.Scheme = schemes.Row
+	query.Col.Scheme = schemes.Col
+
+	return query, nil
+}
+
+// AnswerDoublyEncryptedQuery routes the doubly encrypted query to the backend answering
+// the schemes of its tiers. Returns an *UnsupportedSchemeError if a tier uses a scheme
+// that is not supported or if the combination is not implemented
+func (db *Database) AnswerDoublyEncryptedQuery(query *DoublyEncryptedQuery, nprocs int) (*DoublyEncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	start := time.Now()
+
+	var res *DoublyEncryptedQueryResult
+	backend, err := db.recursionBackend(query)
+	if err == nil {
+		res, err = backend(db, query, nprocs, nil)
+	}
+
+	db.tracer.sample(QueryTrace{
+		Scheme:    query.Row.scheme(),
+		Encrypted: true,
+		GroupSize: query.Row.GroupSize,
+		DBSize:    db.DBSize,
+		SlotBytes: db.SlotBytes,
+		NumProcs:  nprocs,
+		Failed:    err != nil,
+	}, start)
+
+	return res, err
+}
+
+// recursionBackend returns the backend answering the schemes of the tiers of the query
+func (db *Database) recursionBackend(query *DoublyEncryptedQuery) (recursionBackend, error) {
+
+	schemes := query.Schemes()
+
+	if err := db.checkScheme(schemes.Row); err != nil {
+		return nil, err
+	}
+	if err := db.checkScheme(schemes.Col); err != nil {
+		return nil, err
+	}
+
+	backend, ok := recursionBackends[schemes]
+	if !ok {
+		return nil, &UnsupportedSchemeError{Scheme: Scheme(schemes.String()), Supported: recursionSchemeNames()}
+	}
+
+	return backend, nil
+}
+
+// recursionSchemeNames returns the implemented combinations of tier schemes as schemes
+// (for UnsupportedSchemeError)
+func recursionSchemeNames() []Scheme {
+
+	names := make([]Scheme, len(ImplementedRecursions))
+	for i, schemes := range ImplementedRecursions {
+		names[i] = Scheme(schemes.String())
+	}
+
+	return names
+}
@@ -0,0 +1,56 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestAnswerDoublyEncryptedQuery' to see log outputs.
+func TestAnswerDoublyEncryptedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	sk, pk := paillier.KeyGen(128)
+
+	groupSize := 2
+	index := 5
+
+	query, err := db.NewDoublyEncryptedQueryWithSchemes(pk, groupSize, index, ImplementedRecursions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.AnswerDoublyEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots := recoverDoublyEncrypted(t, res, sk)
+	start := index - index%groupSize
+	for i := 0; i < groupSize; i++ {
+		if !db.Slots[start+i].Equal(slots[i]) {
+			t.Fatalf("Incorrect slot %v: %v != %v\n", start+i, db.Slots[start+i], slots[i])
+		}
+	}
+
+	// combinations with a tier that is not implemented are rejected by the client and the server
+	mixed := RecursionSchemes{Row: SchemeAHELWEv1, Col: SchemeAHEPaillierV1}
+	if _, err := db.NewDoublyEncryptedQueryWithSchemes(pk, groupSize, index, mixed); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Expected an unsupported scheme error, got %v\n", err)
+	}
+
+	query.Col.Scheme = SchemeAHELWEv1
+	var schemeErr *UnsupportedSchemeError
+	if _, err := db.AnswerDoublyEncryptedQuery(query, NumProcsForQuery); !errors.As(err, &schemeErr) || schemeErr.Scheme != SchemeAHELWEv1 {
+		t.Fatalf("Answered a query with an unimplemented column tier: %v\n", err)
+	}
+
+	// tiers must be supported by the server
+	query.Col.Scheme = SchemeAHEPaillierV1
+	db.SetSupportedSchemes(SchemeDPFv1)
+	if _, err := db.AnswerDoublyEncryptedQuery(query, NumProcsForQuery); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Answered a query with a disabled scheme: %v\n", err)
+	}
+}
@@ -0,0 +1,416 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Recursive PIR over hypercubes.
+ A doubly encrypted query views the database as a grid and selects a
+ row, then a column of the row. A recursive query views the database as
+ a Dims[0] x Dims[1] x ... x Dims[d-1] hypercube (slot index in row-major
+ order, the last dimension varying fastest) and selects one coordinate
+ per dimension, so the query has Dims[0] + ... + Dims[d-1] encrypted
+ bits: O(d*n^(1/d)) for a database of n slots (see HypercubeDimensions).
+ The server folds the dimensions in turn: the first with level one bits
+ over the slots, the next ones with level two bits over the ciphertexts
+ of the previous fold. Paillier has two levels, so from the third
+ dimension on each level two ciphertext (modulo N^3) is split into two
+ plaintexts of the level two space (modulo N^2) before being folded;
+ the result of a d-dimensional query thus holds 2^(d-2) times more
+ ciphertexts than a doubly encrypted one, and the client undoes the
+ splits when recovering the slot (see RecoverRecursiveEncrypted).
+*/
+
+// RecursiveEncryptedQuery selects a slot of the database viewed as a hypercube
+type RecursiveEncryptedQuery struct {
+	Pk            *paillier.PublicKey
+	Dims          []int                    // sizes of the dimensions of the hypercube
+	EBits         [][]*paillier.Ciphertext // EBits[k] selects the coordinate of dimension k
+	Scheme        Scheme                   // scheme (and version) the query was generated for
+	AttributeMask uint64                   // only slots with all attributes in the mask are retrieved (optional)
+}
+
+// RecursiveEncryptedQueryResult holds the ciphertexts of the selected slot, encrypted
+// once per dimension of the query (see RecoverRecursiveEncrypted)
+type RecursiveEncryptedQueryResult struct {
+	Cts                   []*paillier.Ciphertext
+	Pk                    *paillier.PublicKey
+	Depth                 int // number of dimensions of the query
+	SlotBytes             int
+	NumBytesPerCiphertext int
+}
+
+// HypercubeDimensions returns d dimensions of (nearly) equal sizes whose product covers the database
+func (dbmd *DBMetadata) HypercubeDimensions(d int) []int {
+
+	if d < 1 {
+		return nil
+	}
+
+	dims := make([]int, d)
+	for k := range dims {
+		dims[k] = ceilRoot(dbmd.DBSize, d)
+	}
+
+	// shrink the dimensions while the hypercube still covers the database
+	for k := range dims {
+		for dims[k] > 1 && (dims[k]-1)*hypercubeVolume(dims)/dims[k] >= dbmd.DBSize {
+			dims[k]--
+		}
+	}
+
+	return dims
+}
+
+// hypercubeVolume returns the number of cells of the hypercube
+func hypercubeVolume(dims []int) int {
+
+	volume := 1
+	for _, dim := range dims {
+		volume *= dim
+	}
+
+	return volume
+}
+
+// hypercubeCoordinates returns the coordinates of the index in the hypercube
+func hypercubeCoordinates(index int, dims []int) []int {
+
+	coords := make([]int, len(dims))
+	for k := len(dims) - 1; k >= 0; k-- {
+		coords[k] = index % dims[k]
+		index /= dims[k]
+	}
+
+	return coords
+}
+
+// NewRecursiveEncryptedQuery generates a recursive PIR query for the index in the
+// database viewed as a hypercube of the dimensions (see HypercubeDimensions)
+func (dbmd *DBMetadata) NewRecursiveEncryptedQuery(pk *paillier.PublicKey, dims []int, index int) (*RecursiveEncryptedQuery, error) {
+
+	if err := dbmd.checkHypercube(dims); err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, fmt.Errorf("index %v is not in the database", index)
+	}
+
+	coords := hypercubeCoordinates(index, dims)
+
+	ebits := make([][]*paillier.Ciphertext, len(dims))
+	for k, dim := range dims {
+		level := paillier.EncLevelTwo
+		if k == 0 {
+			level = paillier.EncLevelOne
+		}
+
+		ebits[k] = make([]*paillier.Ciphertext, dim)
+		for i := range ebits[k] {
+			if i == coords[k] {
+				ebits[k][i] = pk.EncryptOneAtLevel(level)
+			} else {
+				ebits[k][i] = pk.EncryptZeroAtLevel(level)
+			}
+		}
+	}
+
+	return &RecursiveEncryptedQuery{
+		Pk:     pk,
+		Dims:   append([]int{}, dims...),
+		EBits:  ebits,
+		Scheme: SchemeAHEPaillierV1,
+	}, nil
+}
+
+// scheme returns the scheme of the query (queries without a scheme predate versioning)
+func (query *RecursiveEncryptedQuery) scheme() Scheme {
+
+	if query.Scheme != "" {
+		return query.Scheme
+	}
+
+	return SchemeAHEPaillierV1
+}
+
+// checkHypercube returns an error if the dimensions do not cover the database
+func (dbmd *DBMetadata) checkHypercube(dims []int) error {
+
+	if len(dims) == 0 {
+		return errors.New("hypercube has no dimensions")
+	}
+
+	volume := 1
+	for _, dim := range dims {
+		if dim <= 0 {
+			return fmt.Errorf("hypercube dimensions %v are not positive", dims)
+		}
+
+		if volume > math.MaxInt/dim {
+			return fmt.Errorf("hypercube dimensions %v are too large", dims)
+		}
+		volume *= dim
+	}
+
+	if volume < dbmd.DBSize {
+		return fmt.Errorf("hypercube dimensions %v do not cover %v slots", dims, dbmd.DBSize)
+	}
+
+	return nil
+}
+
+// PrivateRecursiveEncryptedQuery folds the dimensions of the hypercube in turn to select
+// the slot of the query (see RecoverRecursiveEncrypted)
+func (db *Database) PrivateRecursiveEncryptedQuery(query *RecursiveEncryptedQuery, nprocs int) (*RecursiveEncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if err := db.checkScheme(query.scheme()); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkHypercube(query.Dims); err != nil {
+		return nil, err
+	}
+
+	for k, dim := range query.Dims {
+		if len(query.EBits) <= k || len(query.EBits[k]) != dim {
+			return nil, fmt.Errorf("query does not have %v encrypted bits for dimension %v", dim, k)
+		}
+	}
+
+	if err := db.checkAttributeMask(query.AttributeMask); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkQueryMemory(db.estimateRecursiveEncryptedQueryMemory(query)); err != nil {
+		return nil, err
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	cells, numBytesPerCiphertext, err := db.foldSlots(query, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	for k := 1; k < len(query.Dims); k++ {
+		cells, err = foldCiphertexts(query.Pk, db.paramsForPublicKey(query.Pk), query.EBits[k], cells, nprocs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &RecursiveEncryptedQueryResult{
+		Cts:                   cells[0],
+		Pk:                    query.Pk,
+		Depth:                 len(query.Dims),
+		SlotBytes:             db.SlotBytes,
+		NumBytesPerCiphertext: numBytesPerCiphertext,
+	}, nil
+}
+
+// foldSlots folds the first dimension of the hypercube: each cell of the remaining
+// dimensions gets the (level one) encrypted slot selected by the first coordinate
+func (db *Database) foldSlots(query *RecursiveEncryptedQuery, nprocs int) ([][]*paillier.Ciphertext, int, error) {
+
+	params := db.paramsForPublicKey(query.Pk)
+	numCiphertextsPerSlot := params.numCiphertextsPerSlot
+
+	dims := query.Dims
+	stride := hypercubeVolume(dims[1:])
+
+	cells := make([][]*paillier.Ciphertext, stride)
+	procBytesPerCiphertext := make([]int, nprocs)
+
+	// each worker owns the cells of its range
+	err := parallelRanges(context.Background(), stride, nprocs, func(p, start, end int) error {
+		for cell := start; cell < end; cell++ {
+			cts := make([]*paillier.Ciphertext, numCiphertextsPerSlot)
+			for j := range cts {
+				cts[j] = params.nullLevelOne
+			}
+
+			for i := 0; i < dims[0]; i++ {
+				slotIndex := i*stride + cell
+				if slotIndex >= len(db.Slots) || !db.matchesAttributes(slotIndex, query.AttributeMask) {
+					continue
+				}
+
+				intArr, numBytesPerInt, err := db.Slots[slotIndex].ToGmpIntArray(numCiphertextsPerSlot)
+				if err != nil {
+					return err
+				}
+				procBytesPerCiphertext[p] = numBytesPerInt
+
+				for j, val := range intArr {
+					sel := query.Pk.ConstMult(query.EBits[0][i], val)
+					cts[j] = query.Pk.Add(cts[j], sel)
+				}
+			}
+
+			cells[cell] = cts
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	numBytesPerCiphertext := 0
+	for _, n := range procBytesPerCiphertext {
+		if n != 0 {
+			numBytesPerCiphertext = n
+			break
+		}
+	}
+
+	return cells, numBytesPerCiphertext, nil
+}
+
+// foldCiphertexts folds the next dimension of the hypercube with the (level two) bits:
+// each cell of the remaining dimensions gets the ciphertexts of the cell selected by the
+// coordinate, encrypted once more
+func foldCiphertexts(pk *paillier.PublicKey, params *pkParams, ebits []*paillier.Ciphertext, cells [][]*paillier.Ciphertext, nprocs int) ([][]*paillier.Ciphertext, error) {
+
+	stride := len(cells) / len(ebits)
+	folded := make([][]*paillier.Ciphertext, stride)
+
+	err := parallelRanges(context.Background(), stride, nprocs, func(p, start, end int) error {
+		for cell := start; cell < end; cell++ {
+			var cts []*paillier.Ciphertext
+
+			for i, bit := range ebits {
+				plaintexts := splitCiphertexts(pk, cells[i*stride+cell])
+				if cts == nil {
+					cts = make([]*paillier.Ciphertext, len(plaintexts))
+					for j := range cts {
+						cts[j] = params.nullLevelTwo
+					}
+				}
+
+				for j, val := range plaintexts {
+					cts[j] = pk.Add(cts[j], pk.ConstMult(bit, val))
+				}
+			}
+
+			folded[cell] = cts
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return folded, nil
+}
+
+// splitCiphertexts returns the ciphertexts as plaintexts of the level two space:
+// a level one ciphertext (modulo N^2) as is and a level two ciphertext (modulo N^3)
+// as its low and high digits in base N^2
+func splitCiphertexts(pk *paillier.PublicKey, cts []*paillier.Ciphertext) []*gmp.Int {
+
+	n2 := new(gmp.Int).Mul(pk.N, pk.N)
+
+	res := make([]*gmp.Int, 0, 2*len(cts))
+	for _, ct := range cts {
+		if ct.Level == paillier.EncLevelOne {
+			res = append(res, ct.C)
+			continue
+		}
+
+		lo := new(gmp.Int).Mod(ct.C, n2)
+		hi := new(gmp.Int).Quo(ct.C, n2)
+		res = append(res, lo, hi)
+	}
+
+	return res
+}
+
+// RecoverRecursiveEncrypted decrypts the result of a recursive query and returns the slot
+func RecoverRecursiveEncrypted(res *RecursiveEncryptedQueryResult, sk *paillier.SecretKey) (*Slot, error) {
+
+	if res.Depth < 1 {
+		return nil, errors.New("result has no dimensions")
+	}
+
+	n2 := new(gmp.Int).Mul(res.Pk.N, res.Pk.N)
+
+	// undo the folds from the last: the plaintexts of the first fold are level one
+	// ciphertexts, those of the next folds are split level two ciphertexts
+	cts := res.Cts
+	for k := res.Depth - 1; k >= 1; k-- {
+		if k >= 2 && len(cts)%2 != 0 {
+			return nil, fmt.Errorf("result has an odd number of ciphertexts at dimension %v", k)
+		}
+
+		var next []*paillier.Ciphertext
+		for j := 0; j < len(cts); j++ {
+			plaintext := sk.Decrypt(cts[j])
+			if k == 1 {
+				next = append(next, &paillier.Ciphertext{C: plaintext, Level: paillier.EncLevelOne})
+				continue
+			}
+
+			j++
+			hi := sk.Decrypt(cts[j])
+			c := new(gmp.Int).Mul(hi, n2)
+			c.Add(c, plaintext)
+			next = append(next, &paillier.Ciphertext{C: c, Level: paillier.EncLevelTwo})
+		}
+
+		cts = next
+	}
+
+	arr := make([]*gmp.Int, len(cts))
+	for j, ct := range cts {
+		arr[j] = sk.Decrypt(ct)
+	}
+
+	return NewSlotFromGmpIntArray(arr, res.SlotBytes, res.NumBytesPerCiphertext), nil
+}
+
+// EstimateRecursiveEncryptedQueryMemory returns the estimated peak memory (in bytes) of
+// answering the recursive query: the cells of the first fold and of the second fold
+func (db *Database) EstimateRecursiveEncryptedQueryMemory(query *RecursiveEncryptedQuery) int64 {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.estimateRecursiveEncryptedQueryMemory(query)
+}
+
+func (db *Database) estimateRecursiveEncryptedQueryMemory(query *RecursiveEncryptedQuery) int64 {
+
+	if len(query.Dims) == 0 {
+		return 0
+	}
+
+	params := db.paramsForPublicKey(query.Pk)
+	slot := int64(params.numCiphertextsPerSlot)
+
+	// the folds shrink the cells faster than the ciphertexts grow, so the peak is
+	// reached while the first two folds are alive
+	first := int64(hypercubeVolume(query.Dims[1:])) * slot * ciphertextBytes(query.Pk, 1)
+	second := int64(0)
+	if len(query.Dims) > 1 {
+		second = int64(hypercubeVolume(query.Dims[2:])) * slot * ciphertextBytes(query.Pk, 2)
+	}
+
+	return first + second
+}
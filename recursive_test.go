@@ -0,0 +1,65 @@
+package pir
+
+import (
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestRecursiveEncryptedQuery' to see log outputs.
+func TestRecursiveEncryptedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(100, SlotBytes)
+	sk, pk := paillier.KeyGen(128)
+
+	for d := 1; d <= 4; d++ {
+		dims := db.HypercubeDimensions(d)
+		if len(dims) != d || hypercubeVolume(dims) < db.DBSize {
+			t.Fatalf("Dimensions %v do not cover the database\n", dims)
+		}
+
+		for _, index := range []int{0, 37, db.DBSize - 1} {
+			query, err := db.NewRecursiveEncryptedQuery(pk, dims, index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := db.PrivateRecursiveEncryptedQuery(query, NumProcsForQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slot, err := RecoverRecursiveEncrypted(res, sk)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !db.Slots[index].Equal(slot) {
+				t.Fatalf("Incorrect slot %v with dimensions %v: %v != %v\n", index, dims, db.Slots[index], slot)
+			}
+		}
+	}
+
+	// uneven dimensions larger than the database
+	query, err := db.NewRecursiveEncryptedQuery(pk, []int{3, 7, 5}, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.PrivateRecursiveEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := RecoverRecursiveEncrypted(res, sk); err != nil || !db.Slots[99].Equal(slot) {
+		t.Fatalf("Incorrect slot 99 with uneven dimensions (%v)\n", err)
+	}
+
+	if _, err := db.NewRecursiveEncryptedQuery(pk, []int{3, 3, 3}, 0); err == nil {
+		t.Fatalf("Generated a query for dimensions that do not cover the database\n")
+	}
+
+	query.EBits[2] = query.EBits[2][1:]
+	if _, err := db.PrivateRecursiveEncryptedQuery(query, NumProcsForQuery); err == nil {
+		t.Fatalf("Answered a query with missing encrypted bits\n")
+	}
+}
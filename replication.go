@@ -0,0 +1,274 @@
+package pir
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+ Replication between servers.
+ The servers of a secret shared deployment must hold identical contents,
+ otherwise the recovered slots are garbage. Operators replicate updates by
+ computing a patch between two versions of the database (DiffSlots) and
+ applying it to the other servers (ApplyPatch). Patches contain the slots
+ that differ in logical order (servers may shuffle their slots with
+ different keys; see ShuffleWithinGroups) and the digests of the contents
+ before and after the patch: a patch is only applied to a database with
+ the contents it was computed from and the result is checked before it is
+ swapped in, so that operators can confirm the servers ended up with the
+ same contents by exchanging their digests (see ContentDigest).
+ Patches follow the rules of incremental updates (see UpdateSlot): the
+ epoch only changes if slots held by clients move, and the attributes of
+ appended slots are zero.
+*/
+
+// ErrPatchBase is returned when a patch is applied to a database without the contents it was computed from
+var ErrPatchBase = errors.New("patch does not apply to the database contents")
+
+// contentDigestVersion is hashed along with the contents
+const contentDigestVersion = "pir-content-v1"
+
+// ContentDigest identifies the contents of a database (see Database.ContentDigest)
+type ContentDigest [sha256.Size]byte
+
+// SlotUpdate replaces the contents of the slot at Index with Data
+type SlotUpdate struct {
+	Index int
+	Data  []byte
+}
+
+// SlotPatch transforms the contents of a database into the contents of another
+type SlotPatch struct {
+	BaseDigest ContentDigest // digest of the contents the patch applies to
+	Digest     ContentDigest // digest of the contents after the patch
+	DBSize     int           // number of slots after the patch
+	Updates    []SlotUpdate  // slots that differ (or are appended) in increasing order of index
+}
+
+// ContentDigest returns a hash of the size and contents of the slots in logical order
+// (independent of the epoch and of the shuffling of the slots)
+func (db *Database) ContentDigest() ContentDigest {
+
+	slotBytes, slots := db.logicalSlots()
+	return contentDigest(slotBytes, slots)
+}
+
+// DiffSlots returns the patch that transforms the contents of old into the contents of new
+func DiffSlots(old, new *Database) (*SlotPatch, error) {
+
+	oldBytes, oldSlots := old.logicalSlots()
+	newBytes, newSlots := new.logicalSlots()
+
+	if oldBytes != newBytes {
+		return nil, errors.New("slot sizes differ (use SwapIn)")
+	}
+
+	patch := &SlotPatch{
+		BaseDigest: contentDigest(oldBytes, oldSlots),
+		Digest:     contentDigest(newBytes, newSlots),
+		DBSize:     len(newSlots),
+	}
+
+	for i, slot := range newSlots {
+		if i < len(oldSlots) && oldSlots[i].Equal(slot) {
+			continue
+		}
+
+		data := make([]byte, len(slot.Data))
+		copy(data, slot.Data)
+		patch.Updates = append(patch.Updates, SlotUpdate{Index: i, Data: data})
+	}
+
+	return patch, nil
+}
+
+// ApplyPatch applies the patch to the database. ErrPatchBase is returned (and the
+// database is unchanged) if the contents differ from those the patch was computed from
+// or if the patched contents do not match the digest of the patch
+func (db *Database) ApplyPatch(patch *SlotPatch) error {
+
+	db.mu.Lock()
+
+	if contentDigest(db.SlotBytes, db.logicalSlotsLocked()) != patch.BaseDigest {
+		db.mu.Unlock()
+		return ErrPatchBase
+	}
+
+	n := db.DBSize
+	if patch.DBSize < 0 {
+		db.mu.Unlock()
+		return errors.New("invalid database size")
+	}
+
+	if patch.DBSize != n {
+		if err := db.checkResizableLocked(); err != nil {
+			db.mu.Unlock()
+			return err
+		}
+	} else if db.KeywordCommitment != nil && len(patch.Updates) > 0 {
+		// the Merkle proofs bind the contents of the slots
+		db.mu.Unlock()
+		return ErrFixedLayout
+	}
+
+	slots, err := db.patchedSlotsLocked(patch)
+	if err != nil {
+		db.mu.Unlock()
+		return err
+	}
+
+	// slots only move if the length of a shuffled group changes (see AppendSlots)
+	moved := false
+	if gs := db.GroupShuffle; gs != nil && patch.DBSize != n {
+		last := n
+		if patch.DBSize < n {
+			last = patch.DBSize
+		}
+		moved = last%gs.GroupSize != 0
+	}
+
+	listeners, err := db.resizeLocked(moved, func(_ []*Slot, attributes []uint64) ([]*Slot, []uint64) {
+		if attributes != nil {
+			attrs := make([]uint64, patch.DBSize)
+			copy(attrs, attributes)
+			attributes = attrs
+		}
+		return slots, attributes
+	})
+
+	if err == nil {
+		// the source values of the patched slots are unknown (see IndexOf)
+		db.records = nil
+	}
+
+	epoch := db.Epoch
+	db.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	notifySwap(listeners, epoch)
+
+	return nil
+}
+
+// patchedSlotsLocked returns the slots in logical order after applying the patch
+func (db *Database) patchedSlotsLocked(patch *SlotPatch) ([]*Slot, error) {
+
+	slots := make([]*Slot, patch.DBSize)
+	copy(slots, db.logicalSlotsLocked())
+
+	prev := -1
+	for _, update := range patch.Updates {
+		if update.Index <= prev || update.Index >= patch.DBSize {
+			return nil, errors.New("patch updates are out of order or out of range")
+		}
+		if len(update.Data) != db.SlotBytes {
+			return nil, errors.New("patch update does not match the slot size")
+		}
+
+		data := make([]byte, len(update.Data))
+		copy(data, update.Data)
+		slots[update.Index] = NewSlot(data)
+		prev = update.Index
+	}
+
+	// appended slots without an update do not match the digest
+	for _, slot := range slots {
+		if slot == nil {
+			return nil, ErrPatchBase
+		}
+	}
+
+	if contentDigest(db.SlotBytes, slots) != patch.Digest {
+		return nil, ErrPatchBase
+	}
+
+	return slots, nil
+}
+
+// logicalSlots returns the slot size and the slots in logical order
+func (db *Database) logicalSlots() (int, []*Slot) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.SlotBytes, db.logicalSlotsLocked()
+}
+
+// logicalSlotsLocked returns the slots in logical order (see ShuffleWithinGroups)
+func (db *Database) logicalSlotsLocked() []*Slot {
+
+	if db.GroupShuffle != nil {
+		return db.GroupShuffle.unshuffle(db.Slots, db.Epoch)
+	}
+
+	return db.Slots
+}
+
+// contentDigest hashes the slot size, the number of slots and the slots
+func contentDigest(slotBytes int, slots []*Slot) ContentDigest {
+
+	h := sha256.New()
+	h.Write([]byte(contentDigestVersion))
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(slotBytes))
+	h.Write(buf)
+	binary.BigEndian.PutUint64(buf, uint64(len(slots)))
+	h.Write(buf)
+
+	for _, slot := range slots {
+		h.Write(slot.Data)
+	}
+
+	var digest ContentDigest
+	h.Sum(digest[:0])
+
+	return digest
+}
+
+// MarshalBinary encodes the patch
+func (patch *SlotPatch) MarshalBinary() ([]byte, error) {
+
+	e := newEncoder(tagSlotPatch)
+	e.writeBytes(patch.BaseDigest[:])
+	e.writeBytes(patch.Digest[:])
+	e.writeInt(int64(patch.DBSize))
+
+	e.writeInt(int64(len(patch.Updates)))
+	for _, update := range patch.Updates {
+		e.writeInt(int64(update.Index))
+		e.writeBytes(update.Data)
+	}
+
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a patch encoded by MarshalBinary
+func (patch *SlotPatch) UnmarshalBinary(b []byte) error {
+
+	d := newDecoder(b, tagSlotPatch)
+	res := &SlotPatch{}
+
+	d.readFixedBytes(res.BaseDigest[:])
+	d.readFixedBytes(res.Digest[:])
+	res.DBSize = int(d.readInt())
+
+	n := d.readLen()
+	res.Updates = make([]SlotUpdate, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		res.Updates[i].Index = int(d.readInt())
+		res.Updates[i].Data = d.readBytes()
+	}
+
+	if err := d.finish(); err != nil {
+		return err
+	}
+
+	*patch = *res
+
+	return nil
+}
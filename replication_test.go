@@ -0,0 +1,132 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestReplication' to see log outputs.
+func TestReplication(t *testing.T) {
+	setup()
+
+	primary := GenerateRandomDB(TestDBSize, SlotBytes)
+	replica := NewDatabase()
+	if err := replica.SwapIn(cloneSlots(primary.Slots)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the replica shuffles its slots with a different key
+	if err := replica.ShuffleWithinGroups(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if primary.ContentDigest() != replica.ContentDigest() {
+		t.Fatalf("Digests of identical contents differ\n")
+	}
+
+	updated := NewDatabase()
+	if err := updated.SwapIn(cloneSlots(primary.Slots)); err != nil {
+		t.Fatal(err)
+	}
+
+	index := rand.Intn(TestDBSize)
+	if err := updated.UpdateSlot(index, []byte{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := updated.AppendSlots([][]byte{{3}, {4}}); err != nil {
+		t.Fatal(err)
+	}
+
+	patch, err := DiffSlots(primary, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(patch.Updates) != 3 || patch.DBSize != TestDBSize+2 {
+		t.Fatalf("Patch has %v updates for %v slots\n", len(patch.Updates), patch.DBSize)
+	}
+
+	// the patch survives encoding
+	b, err := patch.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &SlotPatch{}
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, db := range []*Database{primary, replica} {
+		if err := db.ApplyPatch(decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if db.ContentDigest() != updated.ContentDigest() {
+			t.Fatalf("Digest differs after applying the patch\n")
+		}
+	}
+
+	// the patch no longer applies to the patched contents
+	if err := replica.ApplyPatch(patch); !errors.Is(err, ErrPatchBase) {
+		t.Fatalf("Expected ErrPatchBase, got %v\n", err)
+	}
+
+	slot, err := retrieveSlot(replica, replica.Metadata(), index, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slot.Equal(updated.Slots[index]) {
+		t.Fatalf("Query result is incorrect after patch. %v != %v\n", updated.Slots[index], slot)
+	}
+}
+
+// run with 'go test -v -run TestApplyPatchDigest' to see log outputs.
+func TestApplyPatchDigest(t *testing.T) {
+	setup()
+
+	old := GenerateRandomDB(TestDBSize, SlotBytes)
+	newDB := GenerateRandomDB(TestDBSize-3, SlotBytes)
+
+	patch, err := DiffSlots(old, newDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a tampered patch is rejected and the database is unchanged
+	digest := old.ContentDigest()
+	patch.Updates[0].Data[0] ^= 1
+
+	if err := old.ApplyPatch(patch); !errors.Is(err, ErrPatchBase) {
+		t.Fatalf("Expected ErrPatchBase, got %v\n", err)
+	}
+
+	if old.ContentDigest() != digest || old.DBSize != TestDBSize {
+		t.Fatalf("Database changed after a rejected patch\n")
+	}
+
+	patch.Updates[0].Data[0] ^= 1
+	if err := old.ApplyPatch(patch); err != nil {
+		t.Fatal(err)
+	}
+
+	if old.ContentDigest() != newDB.ContentDigest() {
+		t.Fatalf("Digest differs after applying the patch\n")
+	}
+
+	if _, err := DiffSlots(old, GenerateRandomDB(TestDBSize, SlotBytes+1)); err == nil {
+		t.Fatalf("Computed a patch between databases with different slot sizes\n")
+	}
+}
+
+func cloneSlots(slots []*Slot) []*Slot {
+	res := make([]*Slot, len(slots))
+	for i, slot := range slots {
+		data := make([]byte, len(slot.Data))
+		copy(data, slot.Data)
+		res[i] = NewSlot(data)
+	}
+	return res
+}
@@ -0,0 +1,374 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/sachaservan/pir"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client is a connection to a server (or to the peer listener of a server, see ServePeers)
+type Client struct {
+	Addr string
+
+	conn *grpc.ClientConn
+	pir  PIRClient
+	peer PIRPeerClient
+}
+
+// Dial connects to the server at addr over the transport.
+// The transport secures the connection (see pir.TLSTransport) so gRPC runs without
+// transport credentials of its own
+func Dial(ctx context.Context, t pir.Transport, addr string) (*Client, error) {
+
+	conn, err := grpc.NewClient("passthrough:///"+addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return t.Dial(ctx, addr)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		Addr: addr,
+		conn: conn,
+		pir:  NewPIRClient(conn),
+		peer: NewPIRPeerClient(conn),
+	}, nil
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Metadata returns the metadata of the database
+func (c *Client) Metadata(ctx context.Context) (pir.DBMetadata, error) {
+
+	reply, err := c.pir.Metadata(ctx, &MetadataRequest{})
+	if err != nil {
+		return pir.DBMetadata{}, err
+	}
+
+	var md pir.DBMetadata
+	if err := json.Unmarshal(reply.Metadata, &md); err != nil {
+		return pir.DBMetadata{}, err
+	}
+
+	return md, nil
+}
+
+// SharedQuery sends the query share and returns the result share
+func (c *Client) SharedQuery(ctx context.Context, share *pir.QueryShare) (*pir.SecretSharedQueryResult, error) {
+
+	b, err := share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.SharedQuery(ctx, &SharedQueryRequest{Share: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.SecretSharedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// EncryptedQuery sends the encrypted query and returns its result
+func (c *Client) EncryptedQuery(ctx context.Context, query *pir.EncryptedQuery) (*pir.EncryptedQueryResult, error) {
+
+	b, err := query.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.EncryptedQuery(ctx, &EncryptedQueryRequest{Query: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.EncryptedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DoublyEncryptedQuery sends the doubly encrypted query and returns its result
+func (c *Client) DoublyEncryptedQuery(ctx context.Context, query *pir.DoublyEncryptedQuery) (*pir.DoublyEncryptedQueryResult, error) {
+
+	b, err := query.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.DoublyEncryptedQuery(ctx, &DoublyEncryptedQueryRequest{Query: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.DoublyEncryptedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CalibrateShared sends the query share and returns a random result share with the
+// shape of its answer. The server does not read the database (see pir.Database.CalibrationSharedAnswer)
+func (c *Client) CalibrateShared(ctx context.Context, share *pir.QueryShare) (*pir.SecretSharedQueryResult, error) {
+
+	b, err := share.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.CalibrateShared(ctx, &SharedQueryRequest{Share: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.SecretSharedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CalibrateEncrypted sends the encrypted query and returns a random result with the
+// shape of its answer (see pir.Database.CalibrationEncryptedAnswer)
+func (c *Client) CalibrateEncrypted(ctx context.Context, query *pir.EncryptedQuery) (*pir.EncryptedQueryResult, error) {
+
+	b, err := query.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.CalibrateEncrypted(ctx, &EncryptedQueryRequest{Query: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.EncryptedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CalibrateDoublyEncrypted sends the doubly encrypted query and returns a random result
+// with the shape of its answer (see pir.Database.CalibrationDoublyEncryptedAnswer)
+func (c *Client) CalibrateDoublyEncrypted(ctx context.Context, query *pir.DoublyEncryptedQuery) (*pir.DoublyEncryptedQueryResult, error) {
+
+	b, err := query.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.CalibrateDoublyEncrypted(ctx, &DoublyEncryptedQueryRequest{Query: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.DoublyEncryptedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// AuthenticatedQuery runs the challenge-response protocol for the authenticated query
+// (see pir.AuthProve) and returns the result of the real query.
+// Returns a *pir.ServerMisbehaviorError if the challenge shows that the server cheated
+// and ErrAuthenticationFailed (without sending the proof) if the auth key is incorrect
+func (c *Client) AuthenticatedQuery(
+	ctx context.Context,
+	query *pir.AuthenticatedEncryptedQuery,
+	state *pir.AuthQueryPrivateState) (*pir.DoublyEncryptedQueryResult, error) {
+
+	b, err := query.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	chalReply, err := c.pir.AuthChallenge(ctx, &AuthChallengeRequest{Query: b})
+	if err != nil {
+		return nil, err
+	}
+
+	chal := &pir.ChalToken{}
+	if err := c.decodeReply(chalReply.Status, chalReply.Chal, chal); err != nil {
+		return nil, err
+	}
+
+	proof, err := pir.AuthProve(state, chal)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the token of the other query is zero
+	if proof.QBit != state.Bit {
+		return nil, ErrAuthenticationFailed
+	}
+
+	if b, err = proof.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	reply, err := c.pir.AuthAnswer(ctx, &AuthAnswerRequest{Id: chalReply.Id, Proof: b})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &pir.DoublyEncryptedQueryResult{}
+	if err := c.decodeReply(reply.Status, reply.Result, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Audit returns the audit share of the authenticated query share with the ID.
+// Only answered by the peer listener of a server (see ServePeers)
+func (c *Client) Audit(ctx context.Context, id string) (*pir.AuditTokenShare, error) {
+
+	reply, err := c.peer.Audit(ctx, &AuditRequest{Id: id})
+	if err != nil {
+		return nil, err
+	}
+
+	audit := &pir.AuditTokenShare{}
+	if err := c.decodeReply(reply.Status, reply.Audit, audit); err != nil {
+		return nil, err
+	}
+
+	return audit, nil
+}
+
+// KeywordDigest returns the digest of the keywords of the server.
+// Only answered by the peer listener of a server (see ServePeers)
+func (c *Client) KeywordDigest(ctx context.Context) ([]byte, error) {
+
+	reply, err := c.peer.KeywordDigest(ctx, &KeywordDigestRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return reply.Digest, nil
+}
+
+// decodeReply returns the error of the call (see Status) or decodes the bytes field
+// of the reply into v
+func (c *Client) decodeReply(status *Status, b []byte, v encoding.BinaryUnmarshaler) error {
+
+	if err := status.err(c.Addr); err != nil {
+		return err
+	}
+
+	return v.UnmarshalBinary(b)
+}
+
+// QueryFunc returns a pir.QuerySharesFunc (see pir.NewClient) that sends
+// share i to clients[i] (concurrently) with the context
+func QueryFunc(ctx context.Context, clients []*Client) pir.QuerySharesFunc {
+
+	return func(shares []*pir.QueryShare) ([]*pir.SecretSharedQueryResult, error) {
+
+		if len(shares) != len(clients) {
+			return nil, errors.New("need exactly one server per query share")
+		}
+
+		results := make([]*pir.SecretSharedQueryResult, len(shares))
+		err := forEach(len(shares), func(i int) (err error) {
+			results[i], err = clients[i].SharedQuery(ctx, shares[i])
+			return err
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return results, nil
+	}
+}
+
+// AuthenticatedSharedQuery sends authenticated share i to clients[i] (concurrently)
+// and returns the result shares. The servers answer only if their audit passes
+func AuthenticatedSharedQuery(ctx context.Context, clients []*Client, shares []*pir.AuthenticatedQueryShare) ([]*pir.SecretSharedQueryResult, error) {
+
+	if len(shares) != len(clients) {
+		return nil, errors.New("need exactly one server per query share")
+	}
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	results := make([]*pir.SecretSharedQueryResult, len(shares))
+	err := forEach(len(shares), func(i int) error {
+		b, err := shares[i].MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		args := &AuthSharedQueryRequest{Id: hex.EncodeToString(id[:]), Share: b}
+		reply, err := clients[i].pir.AuthSharedQuery(ctx, args)
+		if err != nil {
+			return err
+		}
+
+		results[i] = &pir.SecretSharedQueryResult{}
+		return clients[i].decodeReply(reply.Status, reply.Result, results[i])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// forEach runs f(0), ..., f(n-1) concurrently and returns the first error
+func forEach(n int, f func(i int) error) error {
+
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f(i)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,1049 @@
+// Services of the PIR servers (see package rpc).
+// Queries, results and tokens are carried as bytes fields holding their
+// binary encodings (see pir.QueryShare.MarshalBinary) and the metadata of
+// the database as the JSON encoding of pir.DBMetadata.
+// Regenerate pir.pb.go and pir_grpc.pb.go with 'go generate' (see server.go).
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.9
+// 	protoc        (unknown)
+// source: pir.proto
+
+package rpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Status is the error (if any) of a call answered by the server
+type Status struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Err   string                 `protobuf:"bytes,1,opt,name=err,proto3" json:"err,omitempty"`
+	// index of the sentinel error in remoteErrors plus one (zero if none)
+	ErrCode       int32 `protobuf:"varint,2,opt,name=err_code,json=errCode,proto3" json:"err_code,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	mi := &file_pir_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Status) GetErr() string {
+	if x != nil {
+		return x.Err
+	}
+	return ""
+}
+
+func (x *Status) GetErrCode() int32 {
+	if x != nil {
+		return x.ErrCode
+	}
+	return 0
+}
+
+type MetadataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataRequest) Reset() {
+	*x = MetadataRequest{}
+	mi := &file_pir_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataRequest) ProtoMessage() {}
+
+func (x *MetadataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataRequest.ProtoReflect.Descriptor instead.
+func (*MetadataRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{1}
+}
+
+type MetadataReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metadata      []byte                 `protobuf:"bytes,1,opt,name=metadata,proto3" json:"metadata,omitempty"` // JSON encoding of pir.DBMetadata
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataReply) Reset() {
+	*x = MetadataReply{}
+	mi := &file_pir_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataReply) ProtoMessage() {}
+
+func (x *MetadataReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataReply.ProtoReflect.Descriptor instead.
+func (*MetadataReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MetadataReply) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type SharedQueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Share         []byte                 `protobuf:"bytes,1,opt,name=share,proto3" json:"share,omitempty"` // pir.QueryShare
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SharedQueryRequest) Reset() {
+	*x = SharedQueryRequest{}
+	mi := &file_pir_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SharedQueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SharedQueryRequest) ProtoMessage() {}
+
+func (x *SharedQueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SharedQueryRequest.ProtoReflect.Descriptor instead.
+func (*SharedQueryRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SharedQueryRequest) GetShare() []byte {
+	if x != nil {
+		return x.Share
+	}
+	return nil
+}
+
+type SharedQueryReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        *Status                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Result        []byte                 `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"` // pir.SecretSharedQueryResult
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SharedQueryReply) Reset() {
+	*x = SharedQueryReply{}
+	mi := &file_pir_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SharedQueryReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SharedQueryReply) ProtoMessage() {}
+
+func (x *SharedQueryReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SharedQueryReply.ProtoReflect.Descriptor instead.
+func (*SharedQueryReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SharedQueryReply) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *SharedQueryReply) GetResult() []byte {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+type EncryptedQueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         []byte                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"` // pir.EncryptedQuery
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EncryptedQueryRequest) Reset() {
+	*x = EncryptedQueryRequest{}
+	mi := &file_pir_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EncryptedQueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptedQueryRequest) ProtoMessage() {}
+
+func (x *EncryptedQueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptedQueryRequest.ProtoReflect.Descriptor instead.
+func (*EncryptedQueryRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EncryptedQueryRequest) GetQuery() []byte {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+type EncryptedQueryReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        *Status                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Result        []byte                 `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"` // pir.EncryptedQueryResult
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EncryptedQueryReply) Reset() {
+	*x = EncryptedQueryReply{}
+	mi := &file_pir_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EncryptedQueryReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncryptedQueryReply) ProtoMessage() {}
+
+func (x *EncryptedQueryReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncryptedQueryReply.ProtoReflect.Descriptor instead.
+func (*EncryptedQueryReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *EncryptedQueryReply) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *EncryptedQueryReply) GetResult() []byte {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+type DoublyEncryptedQueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         []byte                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"` // pir.DoublyEncryptedQuery
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DoublyEncryptedQueryRequest) Reset() {
+	*x = DoublyEncryptedQueryRequest{}
+	mi := &file_pir_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DoublyEncryptedQueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DoublyEncryptedQueryRequest) ProtoMessage() {}
+
+func (x *DoublyEncryptedQueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DoublyEncryptedQueryRequest.ProtoReflect.Descriptor instead.
+func (*DoublyEncryptedQueryRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DoublyEncryptedQueryRequest) GetQuery() []byte {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+type DoublyEncryptedQueryReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        *Status                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Result        []byte                 `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"` // pir.DoublyEncryptedQueryResult
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DoublyEncryptedQueryReply) Reset() {
+	*x = DoublyEncryptedQueryReply{}
+	mi := &file_pir_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DoublyEncryptedQueryReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DoublyEncryptedQueryReply) ProtoMessage() {}
+
+func (x *DoublyEncryptedQueryReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DoublyEncryptedQueryReply.ProtoReflect.Descriptor instead.
+func (*DoublyEncryptedQueryReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DoublyEncryptedQueryReply) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *DoublyEncryptedQueryReply) GetResult() []byte {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+type AuthChallengeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Query         []byte                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"` // pir.AuthenticatedEncryptedQuery
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthChallengeRequest) Reset() {
+	*x = AuthChallengeRequest{}
+	mi := &file_pir_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthChallengeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthChallengeRequest) ProtoMessage() {}
+
+func (x *AuthChallengeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthChallengeRequest.ProtoReflect.Descriptor instead.
+func (*AuthChallengeRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AuthChallengeRequest) GetQuery() []byte {
+	if x != nil {
+		return x.Query
+	}
+	return nil
+}
+
+type AuthChallengeReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        *Status                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Id            uint64                 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`    // identifies the challenge when answering it
+	Chal          []byte                 `protobuf:"bytes,3,opt,name=chal,proto3" json:"chal,omitempty"` // pir.ChalToken
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthChallengeReply) Reset() {
+	*x = AuthChallengeReply{}
+	mi := &file_pir_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthChallengeReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthChallengeReply) ProtoMessage() {}
+
+func (x *AuthChallengeReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthChallengeReply.ProtoReflect.Descriptor instead.
+func (*AuthChallengeReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *AuthChallengeReply) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *AuthChallengeReply) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuthChallengeReply) GetChal() []byte {
+	if x != nil {
+		return x.Chal
+	}
+	return nil
+}
+
+type AuthAnswerRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Proof         []byte                 `protobuf:"bytes,2,opt,name=proof,proto3" json:"proof,omitempty"` // pir.ProofToken
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthAnswerRequest) Reset() {
+	*x = AuthAnswerRequest{}
+	mi := &file_pir_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthAnswerRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthAnswerRequest) ProtoMessage() {}
+
+func (x *AuthAnswerRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthAnswerRequest.ProtoReflect.Descriptor instead.
+func (*AuthAnswerRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *AuthAnswerRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuthAnswerRequest) GetProof() []byte {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+type AuthAnswerReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        *Status                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Result        []byte                 `protobuf:"bytes,2,opt,name=result,proto3" json:"result,omitempty"` // pir.DoublyEncryptedQueryResult
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthAnswerReply) Reset() {
+	*x = AuthAnswerReply{}
+	mi := &file_pir_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthAnswerReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthAnswerReply) ProtoMessage() {}
+
+func (x *AuthAnswerReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthAnswerReply.ProtoReflect.Descriptor instead.
+func (*AuthAnswerReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *AuthAnswerReply) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *AuthAnswerReply) GetResult() []byte {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+// AuthSharedQueryRequest contains an authenticated query share. The ID is
+// chosen by the client and is the same for all the shares of the query
+type AuthSharedQueryRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Share         []byte                 `protobuf:"bytes,2,opt,name=share,proto3" json:"share,omitempty"` // pir.AuthenticatedQueryShare
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthSharedQueryRequest) Reset() {
+	*x = AuthSharedQueryRequest{}
+	mi := &file_pir_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthSharedQueryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthSharedQueryRequest) ProtoMessage() {}
+
+func (x *AuthSharedQueryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthSharedQueryRequest.ProtoReflect.Descriptor instead.
+func (*AuthSharedQueryRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AuthSharedQueryRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AuthSharedQueryRequest) GetShare() []byte {
+	if x != nil {
+		return x.Share
+	}
+	return nil
+}
+
+type AuditRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditRequest) Reset() {
+	*x = AuditRequest{}
+	mi := &file_pir_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditRequest) ProtoMessage() {}
+
+func (x *AuditRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditRequest.ProtoReflect.Descriptor instead.
+func (*AuditRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *AuditRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type AuditReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        *Status                `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	Audit         []byte                 `protobuf:"bytes,2,opt,name=audit,proto3" json:"audit,omitempty"` // pir.AuditTokenShare
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditReply) Reset() {
+	*x = AuditReply{}
+	mi := &file_pir_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditReply) ProtoMessage() {}
+
+func (x *AuditReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditReply.ProtoReflect.Descriptor instead.
+func (*AuditReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *AuditReply) GetStatus() *Status {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *AuditReply) GetAudit() []byte {
+	if x != nil {
+		return x.Audit
+	}
+	return nil
+}
+
+type KeywordDigestRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeywordDigestRequest) Reset() {
+	*x = KeywordDigestRequest{}
+	mi := &file_pir_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeywordDigestRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeywordDigestRequest) ProtoMessage() {}
+
+func (x *KeywordDigestRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeywordDigestRequest.ProtoReflect.Descriptor instead.
+func (*KeywordDigestRequest) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{16}
+}
+
+type KeywordDigestReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Digest        []byte                 `protobuf:"bytes,1,opt,name=digest,proto3" json:"digest,omitempty"` // see pir.DBMetadata.KeywordDigest
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeywordDigestReply) Reset() {
+	*x = KeywordDigestReply{}
+	mi := &file_pir_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeywordDigestReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeywordDigestReply) ProtoMessage() {}
+
+func (x *KeywordDigestReply) ProtoReflect() protoreflect.Message {
+	mi := &file_pir_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeywordDigestReply.ProtoReflect.Descriptor instead.
+func (*KeywordDigestReply) Descriptor() ([]byte, []int) {
+	return file_pir_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *KeywordDigestReply) GetDigest() []byte {
+	if x != nil {
+		return x.Digest
+	}
+	return nil
+}
+
+var File_pir_proto protoreflect.FileDescriptor
+
+const file_pir_proto_rawDesc = "" +
+	"\n" +
+	"\tpir.proto\x12\apir.rpc\"5\n" +
+	"\x06Status\x12\x10\n" +
+	"\x03err\x18\x01 \x01(\tR\x03err\x12\x19\n" +
+	"\berr_code\x18\x02 \x01(\x05R\aerrCode\"\x11\n" +
+	"\x0fMetadataRequest\"+\n" +
+	"\rMetadataReply\x12\x1a\n" +
+	"\bmetadata\x18\x01 \x01(\fR\bmetadata\"*\n" +
+	"\x12SharedQueryRequest\x12\x14\n" +
+	"\x05share\x18\x01 \x01(\fR\x05share\"S\n" +
+	"\x10SharedQueryReply\x12'\n" +
+	"\x06status\x18\x01 \x01(\v2\x0f.pir.rpc.StatusR\x06status\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\fR\x06result\"-\n" +
+	"\x15EncryptedQueryRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\fR\x05query\"V\n" +
+	"\x13EncryptedQueryReply\x12'\n" +
+	"\x06status\x18\x01 \x01(\v2\x0f.pir.rpc.StatusR\x06status\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\fR\x06result\"3\n" +
+	"\x1bDoublyEncryptedQueryRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\fR\x05query\"\\\n" +
+	"\x19DoublyEncryptedQueryReply\x12'\n" +
+	"\x06status\x18\x01 \x01(\v2\x0f.pir.rpc.StatusR\x06status\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\fR\x06result\",\n" +
+	"\x14AuthChallengeRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\fR\x05query\"a\n" +
+	"\x12AuthChallengeReply\x12'\n" +
+	"\x06status\x18\x01 \x01(\v2\x0f.pir.rpc.StatusR\x06status\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04chal\x18\x03 \x01(\fR\x04chal\"9\n" +
+	"\x11AuthAnswerRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x14\n" +
+	"\x05proof\x18\x02 \x01(\fR\x05proof\"R\n" +
+	"\x0fAuthAnswerReply\x12'\n" +
+	"\x06status\x18\x01 \x01(\v2\x0f.pir.rpc.StatusR\x06status\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\fR\x06result\">\n" +
+	"\x16AuthSharedQueryRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05share\x18\x02 \x01(\fR\x05share\"\x1e\n" +
+	"\fAuditRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"K\n" +
+	"\n" +
+	"AuditReply\x12'\n" +
+	"\x06status\x18\x01 \x01(\v2\x0f.pir.rpc.StatusR\x06status\x12\x14\n" +
+	"\x05audit\x18\x02 \x01(\fR\x05audit\"\x16\n" +
+	"\x14KeywordDigestRequest\",\n" +
+	"\x12KeywordDigestReply\x12\x16\n" +
+	"\x06digest\x18\x01 \x01(\fR\x06digest2\xa1\x06\n" +
+	"\x03PIR\x12<\n" +
+	"\bMetadata\x12\x18.pir.rpc.MetadataRequest\x1a\x16.pir.rpc.MetadataReply\x12E\n" +
+	"\vSharedQuery\x12\x1b.pir.rpc.SharedQueryRequest\x1a\x19.pir.rpc.SharedQueryReply\x12N\n" +
+	"\x0eEncryptedQuery\x12\x1e.pir.rpc.EncryptedQueryRequest\x1a\x1c.pir.rpc.EncryptedQueryReply\x12`\n" +
+	"\x14DoublyEncryptedQuery\x12$.pir.rpc.DoublyEncryptedQueryRequest\x1a\".pir.rpc.DoublyEncryptedQueryReply\x12I\n" +
+	"\x0fCalibrateShared\x12\x1b.pir.rpc.SharedQueryRequest\x1a\x19.pir.rpc.SharedQueryReply\x12R\n" +
+	"\x12CalibrateEncrypted\x12\x1e.pir.rpc.EncryptedQueryRequest\x1a\x1c.pir.rpc.EncryptedQueryReply\x12d\n" +
+	"\x18CalibrateDoublyEncrypted\x12$.pir.rpc.DoublyEncryptedQueryRequest\x1a\".pir.rpc.DoublyEncryptedQueryReply\x12K\n" +
+	"\rAuthChallenge\x12\x1d.pir.rpc.AuthChallengeRequest\x1a\x1b.pir.rpc.AuthChallengeReply\x12B\n" +
+	"\n" +
+	"AuthAnswer\x12\x1a.pir.rpc.AuthAnswerRequest\x1a\x18.pir.rpc.AuthAnswerReply\x12M\n" +
+	"\x0fAuthSharedQuery\x12\x1f.pir.rpc.AuthSharedQueryRequest\x1a\x19.pir.rpc.SharedQueryReply2\x8b\x01\n" +
+	"\aPIRPeer\x123\n" +
+	"\x05Audit\x12\x15.pir.rpc.AuditRequest\x1a\x13.pir.rpc.AuditReply\x12K\n" +
+	"\rKeywordDigest\x12\x1d.pir.rpc.KeywordDigestRequest\x1a\x1b.pir.rpc.KeywordDigestReplyB Z\x1egithub.com/sachaservan/pir/rpcb\x06proto3"
+
+var (
+	file_pir_proto_rawDescOnce sync.Once
+	file_pir_proto_rawDescData []byte
+)
+
+func file_pir_proto_rawDescGZIP() []byte {
+	file_pir_proto_rawDescOnce.Do(func() {
+		file_pir_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pir_proto_rawDesc), len(file_pir_proto_rawDesc)))
+	})
+	return file_pir_proto_rawDescData
+}
+
+var file_pir_proto_msgTypes = make([]protoimpl.MessageInfo, 18)
+var file_pir_proto_goTypes = []any{
+	(*Status)(nil),                      // 0: pir.rpc.Status
+	(*MetadataRequest)(nil),             // 1: pir.rpc.MetadataRequest
+	(*MetadataReply)(nil),               // 2: pir.rpc.MetadataReply
+	(*SharedQueryRequest)(nil),          // 3: pir.rpc.SharedQueryRequest
+	(*SharedQueryReply)(nil),            // 4: pir.rpc.SharedQueryReply
+	(*EncryptedQueryRequest)(nil),       // 5: pir.rpc.EncryptedQueryRequest
+	(*EncryptedQueryReply)(nil),         // 6: pir.rpc.EncryptedQueryReply
+	(*DoublyEncryptedQueryRequest)(nil), // 7: pir.rpc.DoublyEncryptedQueryRequest
+	(*DoublyEncryptedQueryReply)(nil),   // 8: pir.rpc.DoublyEncryptedQueryReply
+	(*AuthChallengeRequest)(nil),        // 9: pir.rpc.AuthChallengeRequest
+	(*AuthChallengeReply)(nil),          // 10: pir.rpc.AuthChallengeReply
+	(*AuthAnswerRequest)(nil),           // 11: pir.rpc.AuthAnswerRequest
+	(*AuthAnswerReply)(nil),             // 12: pir.rpc.AuthAnswerReply
+	(*AuthSharedQueryRequest)(nil),      // 13: pir.rpc.AuthSharedQueryRequest
+	(*AuditRequest)(nil),                // 14: pir.rpc.AuditRequest
+	(*AuditReply)(nil),                  // 15: pir.rpc.AuditReply
+	(*KeywordDigestRequest)(nil),        // 16: pir.rpc.KeywordDigestRequest
+	(*KeywordDigestReply)(nil),          // 17: pir.rpc.KeywordDigestReply
+}
+var file_pir_proto_depIdxs = []int32{
+	0,  // 0: pir.rpc.SharedQueryReply.status:type_name -> pir.rpc.Status
+	0,  // 1: pir.rpc.EncryptedQueryReply.status:type_name -> pir.rpc.Status
+	0,  // 2: pir.rpc.DoublyEncryptedQueryReply.status:type_name -> pir.rpc.Status
+	0,  // 3: pir.rpc.AuthChallengeReply.status:type_name -> pir.rpc.Status
+	0,  // 4: pir.rpc.AuthAnswerReply.status:type_name -> pir.rpc.Status
+	0,  // 5: pir.rpc.AuditReply.status:type_name -> pir.rpc.Status
+	1,  // 6: pir.rpc.PIR.Metadata:input_type -> pir.rpc.MetadataRequest
+	3,  // 7: pir.rpc.PIR.SharedQuery:input_type -> pir.rpc.SharedQueryRequest
+	5,  // 8: pir.rpc.PIR.EncryptedQuery:input_type -> pir.rpc.EncryptedQueryRequest
+	7,  // 9: pir.rpc.PIR.DoublyEncryptedQuery:input_type -> pir.rpc.DoublyEncryptedQueryRequest
+	3,  // 10: pir.rpc.PIR.CalibrateShared:input_type -> pir.rpc.SharedQueryRequest
+	5,  // 11: pir.rpc.PIR.CalibrateEncrypted:input_type -> pir.rpc.EncryptedQueryRequest
+	7,  // 12: pir.rpc.PIR.CalibrateDoublyEncrypted:input_type -> pir.rpc.DoublyEncryptedQueryRequest
+	9,  // 13: pir.rpc.PIR.AuthChallenge:input_type -> pir.rpc.AuthChallengeRequest
+	11, // 14: pir.rpc.PIR.AuthAnswer:input_type -> pir.rpc.AuthAnswerRequest
+	13, // 15: pir.rpc.PIR.AuthSharedQuery:input_type -> pir.rpc.AuthSharedQueryRequest
+	14, // 16: pir.rpc.PIRPeer.Audit:input_type -> pir.rpc.AuditRequest
+	16, // 17: pir.rpc.PIRPeer.KeywordDigest:input_type -> pir.rpc.KeywordDigestRequest
+	2,  // 18: pir.rpc.PIR.Metadata:output_type -> pir.rpc.MetadataReply
+	4,  // 19: pir.rpc.PIR.SharedQuery:output_type -> pir.rpc.SharedQueryReply
+	6,  // 20: pir.rpc.PIR.EncryptedQuery:output_type -> pir.rpc.EncryptedQueryReply
+	8,  // 21: pir.rpc.PIR.DoublyEncryptedQuery:output_type -> pir.rpc.DoublyEncryptedQueryReply
+	4,  // 22: pir.rpc.PIR.CalibrateShared:output_type -> pir.rpc.SharedQueryReply
+	6,  // 23: pir.rpc.PIR.CalibrateEncrypted:output_type -> pir.rpc.EncryptedQueryReply
+	8,  // 24: pir.rpc.PIR.CalibrateDoublyEncrypted:output_type -> pir.rpc.DoublyEncryptedQueryReply
+	10, // 25: pir.rpc.PIR.AuthChallenge:output_type -> pir.rpc.AuthChallengeReply
+	12, // 26: pir.rpc.PIR.AuthAnswer:output_type -> pir.rpc.AuthAnswerReply
+	4,  // 27: pir.rpc.PIR.AuthSharedQuery:output_type -> pir.rpc.SharedQueryReply
+	15, // 28: pir.rpc.PIRPeer.Audit:output_type -> pir.rpc.AuditReply
+	17, // 29: pir.rpc.PIRPeer.KeywordDigest:output_type -> pir.rpc.KeywordDigestReply
+	18, // [18:30] is the sub-list for method output_type
+	6,  // [6:18] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_pir_proto_init() }
+func file_pir_proto_init() {
+	if File_pir_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pir_proto_rawDesc), len(file_pir_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   18,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_pir_proto_goTypes,
+		DependencyIndexes: file_pir_proto_depIdxs,
+		MessageInfos:      file_pir_proto_msgTypes,
+	}.Build()
+	File_pir_proto = out.File
+	file_pir_proto_goTypes = nil
+	file_pir_proto_depIdxs = nil
+}
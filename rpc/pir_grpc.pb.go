@@ -0,0 +1,617 @@
+// Services of the PIR servers (see package rpc).
+// Queries, results and tokens are carried as bytes fields holding their
+// binary encodings (see pir.QueryShare.MarshalBinary) and the metadata of
+// the database as the JSON encoding of pir.DBMetadata.
+// Regenerate pir.pb.go and pir_grpc.pb.go with 'go generate' (see server.go).
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: pir.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PIR_Metadata_FullMethodName                 = "/pir.rpc.PIR/Metadata"
+	PIR_SharedQuery_FullMethodName              = "/pir.rpc.PIR/SharedQuery"
+	PIR_EncryptedQuery_FullMethodName           = "/pir.rpc.PIR/EncryptedQuery"
+	PIR_DoublyEncryptedQuery_FullMethodName     = "/pir.rpc.PIR/DoublyEncryptedQuery"
+	PIR_CalibrateShared_FullMethodName          = "/pir.rpc.PIR/CalibrateShared"
+	PIR_CalibrateEncrypted_FullMethodName       = "/pir.rpc.PIR/CalibrateEncrypted"
+	PIR_CalibrateDoublyEncrypted_FullMethodName = "/pir.rpc.PIR/CalibrateDoublyEncrypted"
+	PIR_AuthChallenge_FullMethodName            = "/pir.rpc.PIR/AuthChallenge"
+	PIR_AuthAnswer_FullMethodName               = "/pir.rpc.PIR/AuthAnswer"
+	PIR_AuthSharedQuery_FullMethodName          = "/pir.rpc.PIR/AuthSharedQuery"
+)
+
+// PIRClient is the client API for PIR service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PIR answers the queries of clients
+type PIRClient interface {
+	Metadata(ctx context.Context, in *MetadataRequest, opts ...grpc.CallOption) (*MetadataReply, error)
+	SharedQuery(ctx context.Context, in *SharedQueryRequest, opts ...grpc.CallOption) (*SharedQueryReply, error)
+	EncryptedQuery(ctx context.Context, in *EncryptedQueryRequest, opts ...grpc.CallOption) (*EncryptedQueryReply, error)
+	DoublyEncryptedQuery(ctx context.Context, in *DoublyEncryptedQueryRequest, opts ...grpc.CallOption) (*DoublyEncryptedQueryReply, error)
+	CalibrateShared(ctx context.Context, in *SharedQueryRequest, opts ...grpc.CallOption) (*SharedQueryReply, error)
+	CalibrateEncrypted(ctx context.Context, in *EncryptedQueryRequest, opts ...grpc.CallOption) (*EncryptedQueryReply, error)
+	CalibrateDoublyEncrypted(ctx context.Context, in *DoublyEncryptedQueryRequest, opts ...grpc.CallOption) (*DoublyEncryptedQueryReply, error)
+	AuthChallenge(ctx context.Context, in *AuthChallengeRequest, opts ...grpc.CallOption) (*AuthChallengeReply, error)
+	AuthAnswer(ctx context.Context, in *AuthAnswerRequest, opts ...grpc.CallOption) (*AuthAnswerReply, error)
+	AuthSharedQuery(ctx context.Context, in *AuthSharedQueryRequest, opts ...grpc.CallOption) (*SharedQueryReply, error)
+}
+
+type pIRClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPIRClient(cc grpc.ClientConnInterface) PIRClient {
+	return &pIRClient{cc}
+}
+
+func (c *pIRClient) Metadata(ctx context.Context, in *MetadataRequest, opts ...grpc.CallOption) (*MetadataReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MetadataReply)
+	err := c.cc.Invoke(ctx, PIR_Metadata_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) SharedQuery(ctx context.Context, in *SharedQueryRequest, opts ...grpc.CallOption) (*SharedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SharedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_SharedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) EncryptedQuery(ctx context.Context, in *EncryptedQueryRequest, opts ...grpc.CallOption) (*EncryptedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EncryptedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_EncryptedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) DoublyEncryptedQuery(ctx context.Context, in *DoublyEncryptedQueryRequest, opts ...grpc.CallOption) (*DoublyEncryptedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DoublyEncryptedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_DoublyEncryptedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) CalibrateShared(ctx context.Context, in *SharedQueryRequest, opts ...grpc.CallOption) (*SharedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SharedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_CalibrateShared_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) CalibrateEncrypted(ctx context.Context, in *EncryptedQueryRequest, opts ...grpc.CallOption) (*EncryptedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EncryptedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_CalibrateEncrypted_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) CalibrateDoublyEncrypted(ctx context.Context, in *DoublyEncryptedQueryRequest, opts ...grpc.CallOption) (*DoublyEncryptedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DoublyEncryptedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_CalibrateDoublyEncrypted_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) AuthChallenge(ctx context.Context, in *AuthChallengeRequest, opts ...grpc.CallOption) (*AuthChallengeReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthChallengeReply)
+	err := c.cc.Invoke(ctx, PIR_AuthChallenge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) AuthAnswer(ctx context.Context, in *AuthAnswerRequest, opts ...grpc.CallOption) (*AuthAnswerReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuthAnswerReply)
+	err := c.cc.Invoke(ctx, PIR_AuthAnswer_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRClient) AuthSharedQuery(ctx context.Context, in *AuthSharedQueryRequest, opts ...grpc.CallOption) (*SharedQueryReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SharedQueryReply)
+	err := c.cc.Invoke(ctx, PIR_AuthSharedQuery_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PIRServer is the server API for PIR service.
+// All implementations must embed UnimplementedPIRServer
+// for forward compatibility.
+//
+// PIR answers the queries of clients
+type PIRServer interface {
+	Metadata(context.Context, *MetadataRequest) (*MetadataReply, error)
+	SharedQuery(context.Context, *SharedQueryRequest) (*SharedQueryReply, error)
+	EncryptedQuery(context.Context, *EncryptedQueryRequest) (*EncryptedQueryReply, error)
+	DoublyEncryptedQuery(context.Context, *DoublyEncryptedQueryRequest) (*DoublyEncryptedQueryReply, error)
+	CalibrateShared(context.Context, *SharedQueryRequest) (*SharedQueryReply, error)
+	CalibrateEncrypted(context.Context, *EncryptedQueryRequest) (*EncryptedQueryReply, error)
+	CalibrateDoublyEncrypted(context.Context, *DoublyEncryptedQueryRequest) (*DoublyEncryptedQueryReply, error)
+	AuthChallenge(context.Context, *AuthChallengeRequest) (*AuthChallengeReply, error)
+	AuthAnswer(context.Context, *AuthAnswerRequest) (*AuthAnswerReply, error)
+	AuthSharedQuery(context.Context, *AuthSharedQueryRequest) (*SharedQueryReply, error)
+	mustEmbedUnimplementedPIRServer()
+}
+
+// UnimplementedPIRServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPIRServer struct{}
+
+func (UnimplementedPIRServer) Metadata(context.Context, *MetadataRequest) (*MetadataReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Metadata not implemented")
+}
+func (UnimplementedPIRServer) SharedQuery(context.Context, *SharedQueryRequest) (*SharedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SharedQuery not implemented")
+}
+func (UnimplementedPIRServer) EncryptedQuery(context.Context, *EncryptedQueryRequest) (*EncryptedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EncryptedQuery not implemented")
+}
+func (UnimplementedPIRServer) DoublyEncryptedQuery(context.Context, *DoublyEncryptedQueryRequest) (*DoublyEncryptedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DoublyEncryptedQuery not implemented")
+}
+func (UnimplementedPIRServer) CalibrateShared(context.Context, *SharedQueryRequest) (*SharedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CalibrateShared not implemented")
+}
+func (UnimplementedPIRServer) CalibrateEncrypted(context.Context, *EncryptedQueryRequest) (*EncryptedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CalibrateEncrypted not implemented")
+}
+func (UnimplementedPIRServer) CalibrateDoublyEncrypted(context.Context, *DoublyEncryptedQueryRequest) (*DoublyEncryptedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CalibrateDoublyEncrypted not implemented")
+}
+func (UnimplementedPIRServer) AuthChallenge(context.Context, *AuthChallengeRequest) (*AuthChallengeReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthChallenge not implemented")
+}
+func (UnimplementedPIRServer) AuthAnswer(context.Context, *AuthAnswerRequest) (*AuthAnswerReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthAnswer not implemented")
+}
+func (UnimplementedPIRServer) AuthSharedQuery(context.Context, *AuthSharedQueryRequest) (*SharedQueryReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AuthSharedQuery not implemented")
+}
+func (UnimplementedPIRServer) mustEmbedUnimplementedPIRServer() {}
+func (UnimplementedPIRServer) testEmbeddedByValue()             {}
+
+// UnsafePIRServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PIRServer will
+// result in compilation errors.
+type UnsafePIRServer interface {
+	mustEmbedUnimplementedPIRServer()
+}
+
+func RegisterPIRServer(s grpc.ServiceRegistrar, srv PIRServer) {
+	// If the following call pancis, it indicates UnimplementedPIRServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PIR_ServiceDesc, srv)
+}
+
+func _PIR_Metadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).Metadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_Metadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).Metadata(ctx, req.(*MetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_SharedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SharedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).SharedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_SharedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).SharedQuery(ctx, req.(*SharedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_EncryptedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EncryptedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).EncryptedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_EncryptedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).EncryptedQuery(ctx, req.(*EncryptedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_DoublyEncryptedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DoublyEncryptedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).DoublyEncryptedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_DoublyEncryptedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).DoublyEncryptedQuery(ctx, req.(*DoublyEncryptedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_CalibrateShared_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SharedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).CalibrateShared(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_CalibrateShared_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).CalibrateShared(ctx, req.(*SharedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_CalibrateEncrypted_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EncryptedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).CalibrateEncrypted(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_CalibrateEncrypted_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).CalibrateEncrypted(ctx, req.(*EncryptedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_CalibrateDoublyEncrypted_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DoublyEncryptedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).CalibrateDoublyEncrypted(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_CalibrateDoublyEncrypted_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).CalibrateDoublyEncrypted(ctx, req.(*DoublyEncryptedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_AuthChallenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthChallengeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).AuthChallenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_AuthChallenge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).AuthChallenge(ctx, req.(*AuthChallengeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_AuthAnswer_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthAnswerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).AuthAnswer(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_AuthAnswer_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).AuthAnswer(ctx, req.(*AuthAnswerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIR_AuthSharedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuthSharedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRServer).AuthSharedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIR_AuthSharedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRServer).AuthSharedQuery(ctx, req.(*AuthSharedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PIR_ServiceDesc is the grpc.ServiceDesc for PIR service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PIR_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pir.rpc.PIR",
+	HandlerType: (*PIRServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Metadata",
+			Handler:    _PIR_Metadata_Handler,
+		},
+		{
+			MethodName: "SharedQuery",
+			Handler:    _PIR_SharedQuery_Handler,
+		},
+		{
+			MethodName: "EncryptedQuery",
+			Handler:    _PIR_EncryptedQuery_Handler,
+		},
+		{
+			MethodName: "DoublyEncryptedQuery",
+			Handler:    _PIR_DoublyEncryptedQuery_Handler,
+		},
+		{
+			MethodName: "CalibrateShared",
+			Handler:    _PIR_CalibrateShared_Handler,
+		},
+		{
+			MethodName: "CalibrateEncrypted",
+			Handler:    _PIR_CalibrateEncrypted_Handler,
+		},
+		{
+			MethodName: "CalibrateDoublyEncrypted",
+			Handler:    _PIR_CalibrateDoublyEncrypted_Handler,
+		},
+		{
+			MethodName: "AuthChallenge",
+			Handler:    _PIR_AuthChallenge_Handler,
+		},
+		{
+			MethodName: "AuthAnswer",
+			Handler:    _PIR_AuthAnswer_Handler,
+		},
+		{
+			MethodName: "AuthSharedQuery",
+			Handler:    _PIR_AuthSharedQuery_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pir.proto",
+}
+
+const (
+	PIRPeer_Audit_FullMethodName         = "/pir.rpc.PIRPeer/Audit"
+	PIRPeer_KeywordDigest_FullMethodName = "/pir.rpc.PIRPeer/KeywordDigest"
+)
+
+// PIRPeerClient is the client API for PIRPeer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PIRPeer answers the requests of the other servers of a deployment
+type PIRPeerClient interface {
+	Audit(ctx context.Context, in *AuditRequest, opts ...grpc.CallOption) (*AuditReply, error)
+	KeywordDigest(ctx context.Context, in *KeywordDigestRequest, opts ...grpc.CallOption) (*KeywordDigestReply, error)
+}
+
+type pIRPeerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPIRPeerClient(cc grpc.ClientConnInterface) PIRPeerClient {
+	return &pIRPeerClient{cc}
+}
+
+func (c *pIRPeerClient) Audit(ctx context.Context, in *AuditRequest, opts ...grpc.CallOption) (*AuditReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuditReply)
+	err := c.cc.Invoke(ctx, PIRPeer_Audit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pIRPeerClient) KeywordDigest(ctx context.Context, in *KeywordDigestRequest, opts ...grpc.CallOption) (*KeywordDigestReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeywordDigestReply)
+	err := c.cc.Invoke(ctx, PIRPeer_KeywordDigest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PIRPeerServer is the server API for PIRPeer service.
+// All implementations must embed UnimplementedPIRPeerServer
+// for forward compatibility.
+//
+// PIRPeer answers the requests of the other servers of a deployment
+type PIRPeerServer interface {
+	Audit(context.Context, *AuditRequest) (*AuditReply, error)
+	KeywordDigest(context.Context, *KeywordDigestRequest) (*KeywordDigestReply, error)
+	mustEmbedUnimplementedPIRPeerServer()
+}
+
+// UnimplementedPIRPeerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPIRPeerServer struct{}
+
+func (UnimplementedPIRPeerServer) Audit(context.Context, *AuditRequest) (*AuditReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Audit not implemented")
+}
+func (UnimplementedPIRPeerServer) KeywordDigest(context.Context, *KeywordDigestRequest) (*KeywordDigestReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KeywordDigest not implemented")
+}
+func (UnimplementedPIRPeerServer) mustEmbedUnimplementedPIRPeerServer() {}
+func (UnimplementedPIRPeerServer) testEmbeddedByValue()                 {}
+
+// UnsafePIRPeerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PIRPeerServer will
+// result in compilation errors.
+type UnsafePIRPeerServer interface {
+	mustEmbedUnimplementedPIRPeerServer()
+}
+
+func RegisterPIRPeerServer(s grpc.ServiceRegistrar, srv PIRPeerServer) {
+	// If the following call pancis, it indicates UnimplementedPIRPeerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PIRPeer_ServiceDesc, srv)
+}
+
+func _PIRPeer_Audit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AuditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRPeerServer).Audit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIRPeer_Audit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRPeerServer).Audit(ctx, req.(*AuditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PIRPeer_KeywordDigest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeywordDigestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PIRPeerServer).KeywordDigest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PIRPeer_KeywordDigest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PIRPeerServer).KeywordDigest(ctx, req.(*KeywordDigestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PIRPeer_ServiceDesc is the grpc.ServiceDesc for PIRPeer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PIRPeer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pir.rpc.PIRPeer",
+	HandlerType: (*PIRPeerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Audit",
+			Handler:    _PIRPeer_Audit_Handler,
+		},
+		{
+			MethodName: "KeywordDigest",
+			Handler:    _PIRPeer_KeywordDigest_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pir.proto",
+}
@@ -0,0 +1,387 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sachaservan/paillier"
+	"github.com/sachaservan/pir"
+)
+
+const testDBSize = 1 << 8
+const testSlotBytes = 3
+const testNumProcs = 2
+
+// tcpTransport is a plaintext transport for tests
+type tcpTransport struct{}
+
+func (tcpTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (tcpTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// startServers starts n servers (and their peer listeners) and returns clients connected to them
+func startServers(t *testing.T, db, keyDB *pir.Database, n int) []*Client {
+
+	dbs := make([]*pir.Database, n)
+	for i := range dbs {
+		dbs[i] = db
+	}
+
+	_, clients := startServersForDBs(t, dbs, keyDB)
+	return clients
+}
+
+// startServersForDBs starts a server (and its peer listener) for each database
+// and returns the servers and clients connected to them
+func startServersForDBs(t *testing.T, dbs []*pir.Database, keyDB *pir.Database) ([]*Server, []*Client) {
+
+	n := len(dbs)
+	servers := make([]*Server, n)
+	peerAddrs := make([]string, n)
+	clients := make([]*Client, n)
+
+	for i := range servers {
+		servers[i] = NewServer(dbs[i], keyDB, testNumProcs)
+
+		l, err := tcpTransport{}.Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go servers[i].Serve(l)
+
+		pl, err := tcpTransport{}.Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { pl.Close() })
+		go servers[i].ServePeers(pl)
+		peerAddrs[i] = pl.Addr().String()
+
+		if clients[i], err = Dial(context.Background(), tcpTransport{}, l.Addr().String()); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { clients[i].Close() })
+	}
+
+	for i, s := range servers {
+		for j, addr := range peerAddrs {
+			if i == j {
+				continue
+			}
+			peer, err := Dial(context.Background(), tcpTransport{}, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { peer.Close() })
+			s.Peers = append(s.Peers, peer)
+		}
+	}
+
+	return servers, clients
+}
+
+// recoverEncrypted is pir.RecoverEncrypted failing the test on error
+func recoverEncrypted(t *testing.T, res *pir.EncryptedQueryResult, sk *paillier.SecretKey) []*pir.Slot {
+	t.Helper()
+
+	slots, err := pir.RecoverEncrypted(res, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return slots
+}
+
+// recoverDoublyEncrypted is pir.RecoverDoublyEncrypted failing the test on error
+func recoverDoublyEncrypted(t *testing.T, res *pir.DoublyEncryptedQueryResult, sk *paillier.SecretKey) []*pir.Slot {
+	t.Helper()
+
+	slots, err := pir.RecoverDoublyEncrypted(res, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return slots
+}
+
+// run with 'go test -v -run TestSharedQueries' to see log outputs.
+func TestSharedQueries(t *testing.T) {
+	ctx := context.Background()
+
+	db := pir.GenerateRandomDB(testDBSize, testSlotBytes)
+	clients := startServers(t, db, nil, 2)
+
+	dbmd, err := clients[0].Metadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dbmd.DBSize != db.DBSize || dbmd.SlotBytes != db.SlotBytes {
+		t.Fatalf("Metadata is incorrect: %+v", dbmd)
+	}
+
+	client := pir.NewClient(dbmd, 2, 2, QueryFunc(ctx, clients))
+	for _, index := range []int{0, 7, testDBSize - 1} {
+		slot, err := client.Get(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slot.Equal(db.Slots[index]) {
+			t.Fatalf("Retrieved slot %v is incorrect\n", index)
+		}
+	}
+
+	// errors of the servers are recognized by the client
+	stale := dbmd
+	stale.Epoch++
+	client.SetMetadata(stale)
+	if _, err := client.Get(0); !errors.Is(err, pir.ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+
+	// authenticated queries need a key database
+	shares := dbmd.NewAuthenticatedIndexQueryShares(0, pir.NewRandomSlot(testSlotBytes), 1, 2)
+	if _, err := AuthenticatedSharedQuery(ctx, clients, shares); !errors.Is(err, ErrNoKeyDatabase) {
+		t.Fatalf("Expected ErrNoKeyDatabase, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestKeywordDigests' to see log outputs.
+func TestKeywordDigests(t *testing.T) {
+	ctx := context.Background()
+
+	keywords := make([]uint, testDBSize)
+	for i := range keywords {
+		keywords[i] = uint(rand.Uint32())
+	}
+
+	dbs := []*pir.Database{
+		pir.GenerateRandomDB(testDBSize, testSlotBytes),
+		pir.GenerateRandomDB(testDBSize, testSlotBytes),
+	}
+	dbs[1].Slots = dbs[0].Slots
+
+	dbs[0].SetKeywords(keywords)
+	dbs[1].SetKeywords(append([]uint{}, keywords...))
+
+	servers, clients := startServersForDBs(t, dbs, nil)
+	for _, s := range servers {
+		if err := s.CheckPeers(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbmd, err := clients[0].Metadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares := dbmd.NewKeywordQueryShares(int(keywords[3]), 1, 2)
+	results, err := QueryFunc(ctx, clients)(shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slot := pir.Recover(results)[0]; !slot.Equal(dbs[0].Slots[3]) {
+		t.Fatalf("Retrieved slot is incorrect\n")
+	}
+
+	// the keywords of the second server diverge
+	diverged := append([]uint{}, keywords...)
+	diverged[0], diverged[1] = diverged[1], diverged[0]
+	dbs[1].SetKeywords(diverged)
+
+	if err := servers[0].CheckPeers(ctx); !errors.Is(err, pir.ErrKeywordMismatch) {
+		t.Fatalf("Expected ErrKeywordMismatch, got %v\n", err)
+	}
+
+	if _, err := QueryFunc(ctx, clients)(shares); !errors.Is(err, pir.ErrKeywordMismatch) {
+		t.Fatalf("Expected ErrKeywordMismatch, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestEncryptedQueries' to see log outputs.
+func TestEncryptedQueries(t *testing.T) {
+	ctx := context.Background()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := pir.GenerateRandomDB(testDBSize, testSlotBytes)
+	client := startServers(t, db, nil, 1)[0]
+
+	groupSize := 2
+	index := rand.Intn(testDBSize / groupSize)
+
+	// encrypted queries retrieve a row of the database
+	row := 1
+	query := db.NewEncryptedQuery(pk, groupSize, row)
+	res, err := client.EncryptedQuery(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	slots := recoverEncrypted(t, res, sk)
+	for j, slot := range slots {
+		if i := row*query.DBWidth + j; i < db.DBSize && !slot.Equal(db.Slots[i]) {
+			t.Fatalf("Encrypted query result is incorrect")
+		}
+	}
+
+	doublyRes, err := client.DoublyEncryptedQuery(ctx, db.NewDoublyEncryptedQuery(pk, groupSize, index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := db.PrivateDoublyEncryptedQuery(db.NewDoublyEncryptedQuery(pk, groupSize, index), testNumProcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, expected := recoverDoublyEncrypted(t, doublyRes, sk), recoverDoublyEncrypted(t, want, sk)
+	for j := range expected {
+		if !got[j].Equal(expected[j]) {
+			t.Fatalf("Doubly encrypted query result is incorrect")
+		}
+	}
+}
+
+// run with 'go test -v -run TestCalibration' to see log outputs.
+func TestCalibration(t *testing.T) {
+	ctx := context.Background()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := pir.GenerateRandomDB(testDBSize, testSlotBytes)
+	clients := startServers(t, db, nil, 2)
+
+	groupSize := 2
+	shares := db.NewIndexQueryShares(0, groupSize, 2)
+
+	results := make([]*pir.SecretSharedQueryResult, len(shares))
+	for i, share := range shares {
+		var err error
+		if results[i], err = clients[i].CalibrateShared(ctx, share); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if slots := pir.Recover(results); len(slots) != groupSize || len(slots[0].Data) != testSlotBytes {
+		t.Fatalf("Calibration answer does not have the shape of the real answer")
+	}
+
+	query := db.NewEncryptedQuery(pk, groupSize, 0)
+	dummy, err := clients[0].CalibrateEncrypted(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real, err := clients[0].EncryptedQuery(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dummy.Slots) != len(real.Slots) || len(recoverEncrypted(t, dummy, sk)) != len(real.Slots) {
+		t.Fatalf("Calibration answer does not have the shape of the real answer")
+	}
+
+	doublyQuery := db.NewDoublyEncryptedQuery(pk, groupSize, 0)
+	doublyDummy, err := clients[0].CalibrateDoublyEncrypted(ctx, doublyQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slots := recoverDoublyEncrypted(t, doublyDummy, sk); len(slots) != groupSize || len(slots[0].Data) != testSlotBytes {
+		t.Fatalf("Calibration answer does not have the shape of the real answer")
+	}
+}
+
+// run with 'go test -v -run TestAuthenticatedQueries' to see log outputs.
+func TestAuthenticatedQueries(t *testing.T) {
+	ctx := context.Background()
+
+	secbytes := pir.DefaultStatisticalSecurityBytes
+	sk, _ := paillier.KeyGen(128)
+
+	// group size one so that the key database has one key per slot
+	db := pir.GenerateRandomDB(testDBSize, secbytes)
+	keyDB := pir.GenerateRandomDB(pir.KeyDBSizeFor(&db.DBMetadata, 1), secbytes)
+	clients := startServers(t, db, keyDB, 2)
+
+	index := rand.Intn(testDBSize)
+	query, state := db.NewAuthenticatedQuery(sk, 1, index, keyDB.Slots[index])
+
+	res, err := clients[0].AuthenticatedQuery(ctx, query, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real := query.Query0
+	if state.Bit == 1 {
+		real = query.Query1
+	}
+
+	want, err := db.PrivateDoublyEncryptedQuery(real, testNumProcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, expected := recoverDoublyEncrypted(t, res, sk), recoverDoublyEncrypted(t, want, sk)
+	if len(got) != len(expected) {
+		t.Fatalf("Authenticated query result is incorrect")
+	}
+	for j := range expected {
+		if !got[j].Equal(expected[j]) {
+			t.Fatalf("Authenticated query result is incorrect")
+		}
+	}
+
+	// proofs with the wrong key fail
+	query, state = db.NewAuthenticatedQuery(sk, 1, index, pir.NewRandomSlot(secbytes))
+	if _, err := clients[0].AuthenticatedQuery(ctx, query, state); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("Expected ErrAuthenticationFailed, got %v\n", err)
+	}
+
+	// secret shared queries are answered only if the audit passes
+	shares := db.NewAuthenticatedIndexQueryShares(index, keyDB.Slots[index], 1, 2)
+	results, err := AuthenticatedSharedQuery(ctx, clients, shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slot := pir.Recover(results)[0]; !slot.Equal(db.Slots[index]) {
+		t.Fatalf("Authenticated shared query result is incorrect")
+	}
+
+	shares = db.NewAuthenticatedIndexQueryShares(index, pir.NewRandomSlot(secbytes), 1, 2)
+	if _, err := AuthenticatedSharedQuery(ctx, clients, shares); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("Expected ErrAuthenticationFailed, got %v\n", err)
+	}
+}
+
+// run with 'go test -v -run TestAuditTimeout' to see log outputs.
+func TestAuditTimeout(t *testing.T) {
+
+	s := NewServer(nil, nil, 1)
+	s.AuthTimeout = 10 * time.Millisecond
+
+	// the audit share of the query never arrives
+	reply, err := (&peerService{s: s}).Audit(context.Background(), &AuditRequest{Id: "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !errors.Is(reply.Status.err(""), ErrAuthenticationFailed) {
+		t.Fatalf("Expected ErrAuthenticationFailed, got %v\n", reply.Status.GetErr())
+	}
+}
@@ -0,0 +1,579 @@
+// Package rpc serves PIR databases over a pir.Transport and provides
+// client stubs for every query type (secret shared, encrypted, doubly
+// encrypted and authenticated ASPIR queries), so that deployments do
+// not rewrite the same networking code.
+// Calls are made with gRPC; the services are defined in pir.proto and
+// queries and results are sent as bytes fields holding their binary
+// encodings (see pir.QueryShare.MarshalBinary), so that clients in other
+// languages only need the protobuf definitions and the encodings.
+// Servers of a secret shared ASPIR deployment exchange the audit token
+// shares of each authenticated query over a separate peer listener
+// (see ServePeers) since the audit shares of all the servers reveal
+// the auth key to whoever collects them.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pir.proto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sachaservan/pir"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcstatus "google.golang.org/grpc/status"
+)
+
+// DefaultAuthTimeout is the time a server keeps the state of an authenticated query
+// (the challenge of an encrypted query or the audit share of a secret shared query)
+const DefaultAuthTimeout = 30 * time.Second
+
+var (
+	// ErrAuthenticationFailed is returned when the proof or audit of an authenticated query fails
+	ErrAuthenticationFailed = errors.New("query authentication failed")
+
+	// ErrUnknownChallenge is returned when answering a challenge that was not
+	// issued by the server (or that expired)
+	ErrUnknownChallenge = errors.New("unknown or expired challenge")
+
+	// ErrNoKeyDatabase is returned for authenticated queries sent to a server without a key database
+	ErrNoKeyDatabase = errors.New("server does not answer authenticated queries")
+)
+
+// remoteErrors are the errors recognized (using errors.Is) by clients when returned
+// by a server. New errors must be appended to keep the codes of older servers
+var remoteErrors = []error{
+	pir.ErrStaleLayout,
+	pir.ErrUnsupportedScheme,
+	pir.ErrQueryMemoryLimit,
+	pir.ErrNoAttributes,
+	ErrAuthenticationFailed,
+	ErrUnknownChallenge,
+	ErrNoKeyDatabase,
+	pir.ErrKeywordMismatch,
+}
+
+func newStatus(err error) *Status {
+
+	if err == nil {
+		return nil
+	}
+
+	status := &Status{Err: err.Error()}
+	for i, sentinel := range remoteErrors {
+		if errors.Is(err, sentinel) {
+			status.ErrCode = int32(i + 1)
+			break
+		}
+	}
+
+	return status
+}
+
+// err returns the error of the call as a *pir.RemoteError
+func (s *Status) err(addr string) error {
+
+	if s.GetErr() == "" {
+		return nil
+	}
+
+	var sentinel error
+	if code := int(s.GetErrCode()); code > 0 && code <= len(remoteErrors) {
+		sentinel = remoteErrors[code-1]
+	}
+
+	return pir.NewRemoteError(addr, s.GetErr(), sentinel)
+}
+
+// unmarshal decodes the bytes field of a request into v
+func unmarshal(b []byte, v encoding.BinaryUnmarshaler, what string) error {
+
+	if len(b) == 0 {
+		return grpcstatus.Errorf(codes.InvalidArgument, "missing %v", what)
+	}
+
+	if err := v.UnmarshalBinary(b); err != nil {
+		return grpcstatus.Errorf(codes.InvalidArgument, "malformed %v: %v", what, err)
+	}
+
+	return nil
+}
+
+// Server answers the queries received over a transport
+type Server struct {
+	DB       *pir.Database
+	KeyDB    *pir.Database // key database for authenticated queries (optional)
+	NumProcs int
+
+	SecParam    int           // statistical security of the challenges (in bytes)
+	AuthTimeout time.Duration // see DefaultAuthTimeout
+	Peers       []*Client     // other servers of a secret shared deployment (see ServePeers)
+
+	mu         sync.Mutex
+	challenges map[uint64]*pendingChallenge
+	audits     map[string]*pendingAudit
+
+	stats serverStats // see Status
+}
+
+// pendingChallenge is a challenge issued for an authenticated encrypted query
+type pendingChallenge struct {
+	query   *pir.AuthenticatedEncryptedQuery
+	chal    *pir.ChalToken
+	expires time.Time
+}
+
+// pendingAudit is the audit share of an authenticated query share.
+// ready is closed once the audit share is set
+type pendingAudit struct {
+	audit   *pir.AuditTokenShare
+	ready   chan struct{}
+	expires time.Time
+}
+
+// NewServer returns a server for the database (and the key database if not nil)
+func NewServer(db, keyDB *pir.Database, nprocs int) *Server {
+	return &Server{
+		DB:          db,
+		KeyDB:       keyDB,
+		NumProcs:    nprocs,
+		SecParam:    pir.DefaultStatisticalSecurityBytes,
+		AuthTimeout: DefaultAuthTimeout,
+	}
+}
+
+// Serve answers the queries of clients received on the listener until it is closed
+func (s *Server) Serve(l net.Listener) error {
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.stats.intercept))
+	RegisterPIRServer(server, &service{s: s})
+
+	return server.Serve(l)
+}
+
+// ServePeers answers the audit requests of the other servers received on the listener
+// until it is closed. The listener must only accept the other servers (e.g., using mTLS)
+func (s *Server) ServePeers(l net.Listener) error {
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(s.stats.intercept))
+	RegisterPIRPeerServer(server, &peerService{s: s})
+
+	return server.Serve(l)
+}
+
+func (s *Server) authTimeout() time.Duration {
+	if s.AuthTimeout <= 0 {
+		return DefaultAuthTimeout
+	}
+	return s.AuthTimeout
+}
+
+// service holds the methods called by clients
+type service struct {
+	UnimplementedPIRServer
+	s *Server
+}
+
+func (svc *service) Metadata(ctx context.Context, req *MetadataRequest) (*MetadataReply, error) {
+
+	md, err := json.Marshal(svc.s.DB.Metadata())
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetadataReply{Metadata: md}, nil
+}
+
+func (svc *service) SharedQuery(ctx context.Context, req *SharedQueryRequest) (*SharedQueryReply, error) {
+
+	share := &pir.QueryShare{}
+	if err := unmarshal(req.Share, share, "query share"); err != nil {
+		return nil, err
+	}
+
+	return sharedQueryReply(svc.s.DB.AnswerSharedQuery(share, svc.s.NumProcs))
+}
+
+func (svc *service) EncryptedQuery(ctx context.Context, req *EncryptedQueryRequest) (*EncryptedQueryReply, error) {
+
+	query := &pir.EncryptedQuery{}
+	if err := unmarshal(req.Query, query, "query"); err != nil {
+		return nil, err
+	}
+
+	return encryptedQueryReply(svc.s.DB.AnswerEncryptedQueryContext(ctx, query, svc.s.NumProcs))
+}
+
+func (svc *service) DoublyEncryptedQuery(ctx context.Context, req *DoublyEncryptedQueryRequest) (*DoublyEncryptedQueryReply, error) {
+
+	query, err := decodeDoublyEncryptedQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	return doublyEncryptedQueryReply(svc.s.DB.AnswerDoublyEncryptedQuery(query, svc.s.NumProcs))
+}
+
+// CalibrateShared returns a random result share with the shape of the answer to the
+// query share (see pir.Database.CalibrationSharedAnswer)
+func (svc *service) CalibrateShared(ctx context.Context, req *SharedQueryRequest) (*SharedQueryReply, error) {
+
+	share := &pir.QueryShare{}
+	if err := unmarshal(req.Share, share, "query share"); err != nil {
+		return nil, err
+	}
+
+	return sharedQueryReply(svc.s.DB.CalibrationSharedAnswer(share))
+}
+
+// CalibrateEncrypted returns a random result with the shape of the answer to the
+// encrypted query (see pir.Database.CalibrationEncryptedAnswer)
+func (svc *service) CalibrateEncrypted(ctx context.Context, req *EncryptedQueryRequest) (*EncryptedQueryReply, error) {
+
+	query := &pir.EncryptedQuery{}
+	if err := unmarshal(req.Query, query, "query"); err != nil {
+		return nil, err
+	}
+
+	return encryptedQueryReply(svc.s.DB.CalibrationEncryptedAnswer(query))
+}
+
+// CalibrateDoublyEncrypted returns a random result with the shape of the answer to the
+// doubly encrypted query (see pir.Database.CalibrationDoublyEncryptedAnswer)
+func (svc *service) CalibrateDoublyEncrypted(ctx context.Context, req *DoublyEncryptedQueryRequest) (*DoublyEncryptedQueryReply, error) {
+
+	query, err := decodeDoublyEncryptedQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	return doublyEncryptedQueryReply(svc.s.DB.CalibrationDoublyEncryptedAnswer(query))
+}
+
+// AuthChallenge issues a challenge for an authenticated encrypted query (see pir.GenerateAuthChalForQuery)
+func (svc *service) AuthChallenge(ctx context.Context, req *AuthChallengeRequest) (*AuthChallengeReply, error) {
+
+	s := svc.s
+	query := &pir.AuthenticatedEncryptedQuery{}
+	if err := unmarshal(req.Query, query, "query"); err != nil {
+		return nil, err
+	}
+
+	if query.Query0 == nil || query.Query1 == nil ||
+		query.Query0.Row == nil || query.Query0.Col == nil || query.Query1.Row == nil || query.Query1.Col == nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, "missing query")
+	}
+
+	if s.KeyDB == nil {
+		return &AuthChallengeReply{Status: newStatus(ErrNoKeyDatabase)}, nil
+	}
+
+	chal, err := pir.GenerateAuthChalForQuery(s.SecParam, s.KeyDB, query, s.NumProcs)
+	if err != nil {
+		return &AuthChallengeReply{Status: newStatus(err)}, nil
+	}
+
+	b, err := chal.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked()
+	if s.challenges == nil {
+		s.challenges = make(map[uint64]*pendingChallenge)
+	}
+	s.challenges[id] = &pendingChallenge{
+		query:   query,
+		chal:    chal,
+		expires: time.Now().Add(s.authTimeout()),
+	}
+
+	return &AuthChallengeReply{Id: id, Chal: b}, nil
+}
+
+// AuthAnswer checks the proof for a challenge and answers the query of the
+// authenticated query selected by the proof. Each challenge is answered at most once
+func (svc *service) AuthAnswer(ctx context.Context, req *AuthAnswerRequest) (*AuthAnswerReply, error) {
+
+	s := svc.s
+	proof := &pir.ProofToken{}
+	if err := unmarshal(req.Proof, proof, "proof"); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.expireLocked()
+	pending := s.challenges[req.Id]
+	delete(s.challenges, req.Id)
+	s.mu.Unlock()
+
+	if pending == nil {
+		return &AuthAnswerReply{Status: newStatus(ErrUnknownChallenge)}, nil
+	}
+
+	pk := pending.query.Query0.Row.Pk
+	if !pir.AuthCheck(pk, pending.query, pending.chal, proof) {
+		return &AuthAnswerReply{Status: newStatus(ErrAuthenticationFailed)}, nil
+	}
+
+	// the proof is for the query with the key; the other query retrieves nothing
+	query := pending.query.Query0
+	if proof.QBit == 1 {
+		query = pending.query.Query1
+	}
+
+	reply, err := doublyEncryptedQueryReply(s.DB.AnswerDoublyEncryptedQuery(query, s.NumProcs))
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthAnswerReply{Status: reply.Status, Result: reply.Result}, nil
+}
+
+// AuthSharedQuery audits the authenticated query share with the other servers
+// (see pir.GenerateAuditForSharedQuery) and answers it if the audit passes
+func (svc *service) AuthSharedQuery(ctx context.Context, req *AuthSharedQueryRequest) (*SharedQueryReply, error) {
+
+	s := svc.s
+	share := &pir.AuthenticatedQueryShare{}
+	if err := unmarshal(req.Share, share, "query share"); err != nil {
+		return nil, err
+	}
+
+	if req.Id == "" || share.QueryShare == nil || share.AuthToken == nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, "missing query share")
+	}
+
+	if s.KeyDB == nil {
+		return &SharedQueryReply{Status: newStatus(ErrNoKeyDatabase)}, nil
+	}
+
+	audit, err := pir.GenerateAuditForSharedQuery(s.KeyDB, share, s.NumProcs)
+	if err != nil {
+		return &SharedQueryReply{Status: newStatus(err)}, nil
+	}
+
+	// publish the audit share before requesting the others so that servers
+	// auditing the same query concurrently do not wait on each other
+	if err := s.publishAudit(req.Id, audit); err != nil {
+		return &SharedQueryReply{Status: newStatus(err)}, nil
+	}
+
+	audits := make([]*pir.AuditTokenShare, len(s.Peers)+1)
+	audits[0] = audit
+
+	err = forEach(len(s.Peers), func(i int) (err error) {
+		audits[i+1], err = s.Peers[i].Audit(ctx, req.Id)
+		return err
+	})
+
+	if err != nil {
+		return &SharedQueryReply{Status: newStatus(err)}, nil
+	}
+
+	if !pir.CheckAudit(audits...) {
+		return &SharedQueryReply{Status: newStatus(ErrAuthenticationFailed)}, nil
+	}
+
+	return sharedQueryReply(s.DB.AnswerSharedQuery(share.QueryShare, s.NumProcs))
+}
+
+// decodeDoublyEncryptedQuery decodes the doubly encrypted query of a request
+func decodeDoublyEncryptedQuery(b []byte) (*pir.DoublyEncryptedQuery, error) {
+
+	query := &pir.DoublyEncryptedQuery{}
+	if err := unmarshal(b, query, "query"); err != nil {
+		return nil, err
+	}
+
+	if query.Row == nil || query.Col == nil {
+		return nil, grpcstatus.Error(codes.InvalidArgument, "missing query")
+	}
+
+	return query, nil
+}
+
+// sharedQueryReply returns the reply holding the result share (or the error) of a query share
+func sharedQueryReply(result *pir.SecretSharedQueryResult, err error) (*SharedQueryReply, error) {
+
+	if err != nil {
+		return &SharedQueryReply{Status: newStatus(err)}, nil
+	}
+
+	b, err := result.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &SharedQueryReply{Result: b}, nil
+}
+
+// encryptedQueryReply returns the reply holding the result (or the error) of an encrypted query
+func encryptedQueryReply(result *pir.EncryptedQueryResult, err error) (*EncryptedQueryReply, error) {
+
+	if err != nil {
+		return &EncryptedQueryReply{Status: newStatus(err)}, nil
+	}
+
+	b, err := result.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedQueryReply{Result: b}, nil
+}
+
+// doublyEncryptedQueryReply returns the reply holding the result (or the error) of a
+// doubly encrypted query
+func doublyEncryptedQueryReply(result *pir.DoublyEncryptedQueryResult, err error) (*DoublyEncryptedQueryReply, error) {
+
+	if err != nil {
+		return &DoublyEncryptedQueryReply{Status: newStatus(err)}, nil
+	}
+
+	b, err := result.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DoublyEncryptedQueryReply{Result: b}, nil
+}
+
+// peerService holds the methods called by the other servers
+type peerService struct {
+	UnimplementedPIRPeerServer
+	s *Server
+}
+
+// Audit returns the audit share of the authenticated query share with the ID,
+// waiting until the share is received from the client
+func (svc *peerService) Audit(ctx context.Context, req *AuditRequest) (*AuditReply, error) {
+
+	s := svc.s
+	pending := s.pendingAudit(req.Id)
+
+	select {
+	case <-pending.ready:
+		b, err := pending.audit.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return &AuditReply{Audit: b}, nil
+	case <-time.After(time.Until(pending.expires)):
+		return &AuditReply{Status: newStatus(ErrAuthenticationFailed)}, nil
+	case <-ctx.Done():
+		return nil, grpcstatus.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// KeywordDigest returns the digest of the keywords of the database
+func (svc *peerService) KeywordDigest(ctx context.Context, req *KeywordDigestRequest) (*KeywordDigestReply, error) {
+	return &KeywordDigestReply{Digest: svc.s.DB.Metadata().KeywordDigest}, nil
+}
+
+// CheckPeers checks that the other servers hold the same keywords as the database
+// (see pir.Database.CheckPeerKeywords) and returns a pir.KeywordMismatchError otherwise.
+// Servers should check their peers before serving keyword queries and after updates
+func (s *Server) CheckPeers(ctx context.Context) error {
+
+	for _, peer := range s.Peers {
+		digest, err := peer.KeywordDigest(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := s.DB.CheckPeerKeywords(digest); err != nil {
+			return fmt.Errorf("peer %v: %w", peer.Addr, err)
+		}
+	}
+
+	return nil
+}
+
+// publishAudit sets the audit share of the query with the ID.
+// Fails if the ID was already used by another query
+func (s *Server) publishAudit(id string, audit *pir.AuditTokenShare) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.pendingAuditLocked(id)
+	if pending.audit != nil {
+		return errors.New("query ID already used")
+	}
+
+	pending.audit = audit
+	close(pending.ready)
+
+	return nil
+}
+
+// pendingAudit returns the audit with the ID (creating it if needed)
+func (s *Server) pendingAudit(id string) *pendingAudit {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pendingAuditLocked(id)
+}
+
+func (s *Server) pendingAuditLocked(id string) *pendingAudit {
+
+	s.expireLocked()
+	if s.audits == nil {
+		s.audits = make(map[string]*pendingAudit)
+	}
+
+	pending, ok := s.audits[id]
+	if !ok {
+		pending = &pendingAudit{
+			ready:   make(chan struct{}),
+			expires: time.Now().Add(s.authTimeout()),
+		}
+		s.audits[id] = pending
+	}
+
+	return pending
+}
+
+// expireLocked removes the expired challenges and audits
+func (s *Server) expireLocked() {
+
+	now := time.Now()
+	for id, pending := range s.challenges {
+		if now.After(pending.expires) {
+			delete(s.challenges, id)
+		}
+	}
+	for id, pending := range s.audits {
+		if now.After(pending.expires) {
+			delete(s.audits, id)
+		}
+	}
+}
+
+func randomID() (uint64, error) {
+
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sachaservan/pir"
+	"google.golang.org/grpc"
+)
+
+// statusLatencyWindow is the number of recent calls whose latencies are kept
+const statusLatencyWindow = 1024
+
+// ServerStatus is a snapshot of the state of a server and of its database (see Server.Status)
+type ServerStatus struct {
+	pir.DatabaseStatus
+	InFlight int64  // calls being answered
+	Answered uint64 // calls answered since the server started
+	Failed   uint64 // calls that were rejected or failed
+	Latency  LatencyPercentiles
+}
+
+// LatencyPercentiles are the percentiles of the latencies of the last calls
+type LatencyPercentiles struct {
+	Count int // number of calls the percentiles are computed over
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// serverStats are the counters of the calls answered by a server
+// (the zero value is ready to use)
+type serverStats struct {
+	mu        sync.Mutex
+	inFlight  int64
+	answered  uint64
+	failed    uint64
+	latencies []time.Duration // ring buffer of the last statusLatencyWindow latencies
+	next      int
+}
+
+// intercept is a grpc.UnaryServerInterceptor counting every call of the services.
+// Calls fail if the handler returns an error or if the reply carries one (see Status)
+func (s *serverStats) intercept(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+	done := s.begin()
+	reply, err := handler(ctx, req)
+
+	failed := err != nil
+	if r, ok := reply.(interface{ GetStatus() *Status }); ok && r.GetStatus() != nil {
+		failed = true
+	}
+	done(failed)
+
+	return reply, err
+}
+
+// begin counts a call being answered and returns the function recording its outcome
+func (s *serverStats) begin() func(failed bool) {
+
+	s.mu.Lock()
+	s.inFlight++
+	s.mu.Unlock()
+
+	start := time.Now()
+
+	return func(failed bool) {
+		latency := time.Since(start)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.inFlight--
+		if failed {
+			s.failed++
+		} else {
+			s.answered++
+		}
+
+		if len(s.latencies) < statusLatencyWindow {
+			s.latencies = append(s.latencies, latency)
+			return
+		}
+		s.latencies[s.next] = latency
+		s.next = (s.next + 1) % statusLatencyWindow
+	}
+}
+
+// snapshot fills the counters and latency percentiles of the status
+func (s *serverStats) snapshot(status *ServerStatus) {
+
+	s.mu.Lock()
+	status.InFlight, status.Answered, status.Failed = s.inFlight, s.answered, s.failed
+	sorted := append([]time.Duration{}, s.latencies...)
+	s.mu.Unlock()
+
+	status.Latency = latencyPercentiles(sorted)
+}
+
+// latencyPercentiles returns the percentiles of the latencies (sorted in place)
+func latencyPercentiles(sorted []time.Duration) LatencyPercentiles {
+
+	if len(sorted) == 0 {
+		return LatencyPercentiles{}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// nearest-rank percentile
+	rank := func(p int) time.Duration {
+		return sorted[(p*len(sorted)+99)/100-1]
+	}
+
+	return LatencyPercentiles{
+		Count: len(sorted),
+		P50:   rank(50),
+		P90:   rank(90),
+		P99:   rank(99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// Status returns a snapshot of the state of the server (the calls of clients and
+// of the other servers) and of its database. The snapshot can be served as JSON
+func (s *Server) Status() ServerStatus {
+
+	status := ServerStatus{DatabaseStatus: s.DB.Status()}
+	s.stats.snapshot(&status)
+
+	return status
+}
@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sachaservan/pir"
+)
+
+// run with 'go test -v -run TestServerStatus' to see log outputs.
+func TestServerStatus(t *testing.T) {
+	ctx := context.Background()
+
+	db := pir.GenerateRandomDB(testDBSize, testSlotBytes)
+	servers, clients := startServersForDBs(t, []*pir.Database{db}, nil)
+
+	shares := db.NewIndexQueryShares(3, 1, 2)
+	for i := 0; i < 2; i++ {
+		if _, err := clients[0].SharedQuery(ctx, shares[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rejected by the database (error in the reply)
+	stale := db.DBMetadata
+	stale.Epoch++
+	if _, err := clients[0].SharedQuery(ctx, stale.NewIndexQueryShares(3, 1, 2)[0]); err == nil {
+		t.Fatalf("Server answered a stale query\n")
+	}
+
+	// rejected by the service (error of the call)
+	if _, err := clients[0].pir.SharedQuery(ctx, &SharedQueryRequest{}); err == nil {
+		t.Fatalf("Server answered a request without a query share\n")
+	}
+
+	status := servers[0].Status()
+
+	if status.DBSize != testDBSize || status.SlotBytes != testSlotBytes || status.Epoch != db.Epoch {
+		t.Fatalf("Status does not describe the database: %+v\n", status)
+	}
+
+	if status.Answered != 2 || status.Failed != 2 || status.InFlight != 0 {
+		t.Fatalf("Status counted %v answered, %v failed and %v in-flight calls\n",
+			status.Answered, status.Failed, status.InFlight)
+	}
+
+	if status.Latency.Count != 4 || status.Latency.P50 > status.Latency.P99 || status.Latency.P99 > status.Latency.Max {
+		t.Fatalf("Invalid latency percentiles: %+v\n", status.Latency)
+	}
+
+	if _, err := json.Marshal(status); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sachaservan/pir"
+)
+
+// testCertificate returns a self-signed certificate for 127.0.0.1
+func testCertificate(t *testing.T, name string) (tls.Certificate, *x509.Certificate) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+// dialAll connects to the servers at addrs over the transport
+func dialAll(t *testing.T, transport pir.Transport, addrs []string) []*Client {
+
+	clients := make([]*Client, len(addrs))
+	for i, addr := range addrs {
+		var err error
+		if clients[i], err = Dial(context.Background(), transport, addr); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { clients[i].Close() })
+	}
+
+	return clients
+}
+
+// run with 'go test -v -run TestTLSTransport' to see log outputs.
+func TestTLSTransport(t *testing.T) {
+
+	db := pir.GenerateRandomDB(testDBSize, testSlotBytes)
+
+	serverCert, serverX509 := testCertificate(t, "server")
+	clientCert, clientX509 := testCertificate(t, "client")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverX509)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientX509)
+
+	serverTransport := pir.NewServerTLSTransport(serverCert, clientCAs)
+
+	addrs := make([]string, 2)
+	for i := range addrs {
+		l, err := serverTransport.Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+
+		go NewServer(db, nil, testNumProcs).Serve(l)
+		addrs[i] = l.Addr().String()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	transport := pir.NewClientTLSTransport(roots, &clientCert, pir.PublicKeyPin(serverX509))
+	client := pir.NewClient(db.DBMetadata, 2, 2, QueryFunc(ctx, dialAll(t, transport, addrs)))
+
+	for _, index := range []int{0, 7, testDBSize - 1} {
+		slot, err := client.Get(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slot.Equal(db.Slots[index]) {
+			t.Fatalf("Retrieved slot %v is incorrect\n", index)
+		}
+	}
+
+	// errors of the servers are recognized by the client
+	stale := db.DBMetadata
+	stale.Epoch++
+	client.SetMetadata(stale)
+	if _, err := client.Get(0); !errors.Is(err, pir.ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+
+	query := db.NewIndexQueryShares(0, 1, 2)
+
+	// servers with keys that are not pinned are rejected (gRPC reports the
+	// error of the handshake in the message of the status of the call)
+	wrongPin := pir.NewClientTLSTransport(roots, &clientCert, [sha256.Size]byte{})
+	if _, err := QueryFunc(ctx, dialAll(t, wrongPin, addrs))(query); err == nil ||
+		!strings.Contains(err.Error(), pir.ErrServerKeyNotPinned.Error()) {
+		t.Fatalf("Expected ErrServerKeyNotPinned, got %v\n", err)
+	}
+
+	// clients without a certificate are rejected
+	noCert := pir.NewClientTLSTransport(roots, nil)
+	if _, err := QueryFunc(ctx, dialAll(t, noCert, addrs))(query); err == nil {
+		t.Fatalf("Server answered a client without a certificate")
+	}
+}
@@ -0,0 +1,226 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+/*
+ Scheme negotiation.
+ Queries carry the identifier (and version) of the scheme they were
+ generated for so that servers can roll out new schemes incrementally:
+ the dispatcher routes each query to the routine answering its scheme
+ or rejects it with an *UnsupportedSchemeError.
+*/
+
+// Scheme identifies a query scheme and its version
+type Scheme string
+
+const (
+	// SchemeDPFv1 is the secret shared DPF scheme with payload-in-leaf two-party keys
+	// or multi-party keys
+	SchemeDPFv1 Scheme = "dpf-v1"
+
+	// SchemeDPFv2EarlyTerm is the two-party secret shared DPF scheme with
+	// bit-output keys (KeyFullDepth, KeyEarlyTermination and KeyAsymmetric)
+	SchemeDPFv2EarlyTerm Scheme = "dpf-v2-early-term"
+
+	// SchemeAHEPaillierV1 is the encrypted scheme based on Paillier (Damgård–Jurik)
+	SchemeAHEPaillierV1 Scheme = "ahe-paillier-v1"
+
+	// SchemeAHELWEv1 is reserved for an encrypted scheme based on LWE
+	SchemeAHELWEv1 Scheme = "ahe-lwe-v1"
+)
+
+// ImplementedSchemes are the schemes that this version of the library can answer
+var ImplementedSchemes = []Scheme{SchemeDPFv1, SchemeDPFv2EarlyTerm, SchemeAHEPaillierV1}
+
+// ErrUnsupportedScheme is matched (using errors.Is) by the error returned when
+// a query uses a scheme that the server does not support.
+// The error is an *UnsupportedSchemeError
+var ErrUnsupportedScheme = errors.New("unsupported query scheme")
+
+// UnsupportedSchemeError contains the scheme of the rejected query
+// and the schemes supported by the server
+type UnsupportedSchemeError struct {
+	Scheme    Scheme
+	Supported []Scheme
+}
+
+func (e *UnsupportedSchemeError) Error() string {
+	return fmt.Sprintf("%v: %q (supported: %v)", ErrUnsupportedScheme, e.Scheme, e.Supported)
+}
+
+// Is reports whether target is ErrUnsupportedScheme
+func (e *UnsupportedSchemeError) Is(target error) bool {
+	return target == ErrUnsupportedScheme
+}
+
+// scheme returns the scheme of the query share
+// (inferred from the keys for queries that predate scheme identifiers)
+func (query *QueryShare) scheme() Scheme {
+
+	if query.Scheme != "" {
+		return query.Scheme
+	}
+
+	return schemeForKeys(query.IsTwoParty, query.KeyVariant)
+}
+
+// scheme returns the scheme of the encrypted query
+// (Paillier for queries that predate scheme identifiers)
+func (query *EncryptedQuery) scheme() Scheme {
+
+	if query.Scheme != "" {
+		return query.Scheme
+	}
+
+	return SchemeAHEPaillierV1
+}
+
+// schemeForKeys returns the secret shared scheme used by the DPF keys
+func schemeForKeys(isTwoParty bool, variant KeyVariant) Scheme {
+
+	if isTwoParty && variant != KeyPayloadInLeaf {
+		return SchemeDPFv2EarlyTerm
+	}
+
+	return SchemeDPFv1
+}
+
+// SetSupportedSchemes restricts the schemes answered by AnswerSharedQuery and
+// AnswerEncryptedQuery. With no arguments all ImplementedSchemes are supported
+func (db *Database) SetSupportedSchemes(schemes ...Scheme) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.supportedSchemes = schemes
+}
+
+// SupportedSchemes returns the schemes answered by the database
+func (db *Database) SupportedSchemes() []Scheme {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.supportedSchemesLocked()
+}
+
+func (db *Database) supportedSchemesLocked() []Scheme {
+
+	if len(db.supportedSchemes) == 0 {
+		return append([]Scheme{}, ImplementedSchemes...)
+	}
+
+	return append([]Scheme{}, db.supportedSchemes...)
+}
+
+// checkScheme returns an *UnsupportedSchemeError if the scheme is not supported
+// (or not implemented)
+func (db *Database) checkScheme(scheme Scheme) error {
+
+	supported := db.supportedSchemesLocked()
+	for _, s := range supported {
+		if s == scheme && isImplementedScheme(scheme) {
+			return nil
+		}
+	}
+
+	return &UnsupportedSchemeError{Scheme: scheme, Supported: supported}
+}
+
+func isImplementedScheme(scheme Scheme) bool {
+	for _, s := range ImplementedSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// AnswerSharedQuery routes the query share to the routine answering its scheme.
+// Returns an *UnsupportedSchemeError if the scheme is not supported
+func (db *Database) AnswerSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	start := time.Now()
+	res, err := db.answerSharedQuery(query, nprocs)
+
+	db.tracer.sample(QueryTrace{
+		Scheme:    query.scheme(),
+		GroupSize: query.GroupSize,
+		DBSize:    db.DBSize,
+		SlotBytes: db.SlotBytes,
+		NumProcs:  nprocs,
+		Failed:    err != nil,
+	}, start)
+
+	return res, err
+}
+
+func (db *Database) answerSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+
+	scheme := query.scheme()
+	if err := db.checkScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case SchemeDPFv1, SchemeDPFv2EarlyTerm:
+		if schemeForKeys(query.IsTwoParty, query.KeyVariant) != scheme {
+			return nil, fmt.Errorf("query keys do not match scheme %q", scheme)
+		}
+		return db.privateSecretSharedQuery(query, nprocs)
+	}
+
+	return nil, &UnsupportedSchemeError{Scheme: scheme, Supported: db.supportedSchemesLocked()}
+}
+
+// AnswerEncryptedQuery routes the encrypted query to the routine answering its scheme.
+// Returns an *UnsupportedSchemeError if the scheme is not supported
+func (db *Database) AnswerEncryptedQuery(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+	return db.AnswerEncryptedQueryContext(context.Background(), query, nprocs)
+}
+
+// AnswerEncryptedQueryContext is AnswerEncryptedQuery with a context; the workers
+// stop as soon as the context is done (see PrivateEncryptedQueryContext)
+func (db *Database) AnswerEncryptedQueryContext(ctx context.Context, query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	start := time.Now()
+	res, err := db.answerEncryptedQuery(ctx, query, nprocs)
+
+	db.tracer.sample(QueryTrace{
+		Scheme:    query.scheme(),
+		Encrypted: true,
+		GroupSize: query.GroupSize,
+		DBSize:    db.DBSize,
+		SlotBytes: db.SlotBytes,
+		NumProcs:  nprocs,
+		Failed:    err != nil,
+	}, start)
+
+	return res, err
+}
+
+func (db *Database) answerEncryptedQuery(ctx context.Context, query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	scheme := query.scheme()
+	if err := db.checkScheme(scheme); err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case SchemeAHEPaillierV1:
+		return db.privateEncryptedQueryContext(ctx, query, nprocs, nil)
+	}
+
+	return nil, &UnsupportedSchemeError{Scheme: scheme, Supported: db.supportedSchemesLocked()}
+}
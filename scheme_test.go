@@ -0,0 +1,88 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestSchemeDispatch' to see log outputs.
+func TestSchemeDispatch(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	index := rand.Intn(db.DBSize)
+
+	for _, variant := range []KeyVariant{KeyPayloadInLeaf, KeyFullDepth, KeyEarlyTermination, KeyAsymmetric} {
+		shares := db.NewIndexQuerySharesWithKeyVariant(index, 1, variant, 3)
+
+		expected := SchemeDPFv1
+		if variant != KeyPayloadInLeaf {
+			expected = SchemeDPFv2EarlyTerm
+		}
+
+		if shares[0].Scheme != expected {
+			t.Fatalf("Query has scheme %v; expected %v\n", shares[0].Scheme, expected)
+		}
+
+		resA, err := db.AnswerSharedQuery(shares[0], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resB, err := db.AnswerSharedQuery(shares[1], NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := Recover([]*SecretSharedQueryResult{resA, resB})
+		if !db.Slots[index].Equal(res[0]) {
+			t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[index], res[0])
+		}
+	}
+
+	// queries without a scheme are answered using the scheme of their keys
+	shares := db.NewIndexQueryShares(index, 1, 2)
+	shares[0].Scheme = ""
+	if _, err := db.AnswerSharedQuery(shares[0], NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// a scheme that does not match the keys is rejected
+	shares[0].Scheme = SchemeDPFv2EarlyTerm
+	if _, err := db.AnswerSharedQuery(shares[0], NumProcsForQuery); err == nil {
+		t.Fatalf("Answered a query with mismatched scheme")
+	}
+
+	sk, pk := paillier.KeyGen(128)
+	query := db.NewEncryptedQuery(pk, 1, 0)
+	res, err := db.AnswerEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recoverEncrypted(t, res, sk)) == 0 {
+		t.Fatalf("No slots recovered\n")
+	}
+
+	// reserved schemes are not implemented
+	query.Scheme = SchemeAHELWEv1
+	_, err = db.AnswerEncryptedQuery(query, NumProcsForQuery)
+
+	var schemeErr *UnsupportedSchemeError
+	if !errors.Is(err, ErrUnsupportedScheme) || !errors.As(err, &schemeErr) || schemeErr.Scheme != SchemeAHELWEv1 {
+		t.Fatalf("Answered a query with an unimplemented scheme: %v\n", err)
+	}
+
+	// the server can restrict the schemes it answers
+	db.SetSupportedSchemes(SchemeDPFv2EarlyTerm)
+	shares = db.NewIndexQueryShares(index, 1, 2)
+	if _, err := db.AnswerSharedQuery(shares[0], NumProcsForQuery); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Answered a query with a disabled scheme: %v\n", err)
+	}
+
+	if supported := db.SupportedSchemes(); len(supported) != 1 || supported[0] != SchemeDPFv2EarlyTerm {
+		t.Fatalf("Supported schemes are incorrect: %v\n", supported)
+	}
+}
@@ -0,0 +1,197 @@
+package pir
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+ Slot encryption at rest.
+ The data owner encrypts (seals) each record with AES-GCM under a key
+ that is never given to the PIR servers; the servers store and serve
+ the sealed records and clients holding the key decrypt (open) the
+ slots they recover. The metadata carries the ID of the key used for
+ the current epoch so that clients know which key to use after a
+ rotation. Each record is bound to its key ID, epoch and index (as
+ additional data) so that the servers cannot move records between
+ positions or serve records of an older epoch without detection.
+ Records are padded to the same size before sealing so that sealed
+ records do not reveal the length of the data to the servers.
+*/
+
+// SlotKeyBytes is the size of the keys generated by NewSlotKey (AES-256)
+const SlotKeyBytes = 32
+
+// SealedRecordOverhead is the number of bytes added to each padded record by sealing
+// (nonce, tag and the length of the record)
+const SealedRecordOverhead = 12 + 16 + LengthPrefixBytes
+
+var (
+	// ErrSlotKeyMismatch is returned when opening a slot with a key other than
+	// the one advertised in the metadata
+	ErrSlotKeyMismatch = errors.New("slot is not encrypted with the key")
+
+	// ErrSlotDecryption is returned when a sealed slot fails to decrypt
+	// (e.g., the slot was modified, moved or is from another epoch)
+	ErrSlotDecryption = errors.New("slot failed to decrypt")
+)
+
+// SlotKey is a key held by the data owner (and authorized clients)
+// used to encrypt slots at rest
+type SlotKey struct {
+	ID  string
+	Key []byte // AES key (16, 24 or 32 bytes)
+}
+
+// NewSlotKey returns a random key with the ID
+func NewSlotKey(id string) (*SlotKey, error) {
+
+	key := make([]byte, SlotKeyBytes)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return &SlotKey{ID: id, Key: key}, nil
+}
+
+// SealData encrypts the records for the given epoch of the database.
+// All the sealed records have the same size (see BuildForSealedData and SwapInSealed).
+// The epoch must be the epoch the records are served under: the current
+// epoch when building a database or the current epoch plus one when swapping
+func (key *SlotKey) SealData(epoch int, data [][]byte) ([][]byte, error) {
+
+	aead, err := key.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	recordBytes := 0
+	for _, record := range data {
+		if len(record) > recordBytes {
+			recordBytes = len(record)
+		}
+	}
+
+	sealed := make([][]byte, len(data))
+	for i, record := range data {
+		plaintext := make([]byte, LengthPrefixBytes+recordBytes)
+		binary.BigEndian.PutUint32(plaintext, uint32(len(record)))
+		copy(plaintext[LengthPrefixBytes:], record)
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		sealed[i] = aead.Seal(nonce, nonce, plaintext, key.additionalData(epoch, i))
+	}
+
+	return sealed, nil
+}
+
+// BuildForSealedData constructs a PIR database for records sealed with the key
+// with keyID (see SealData and BuildForBinaryData)
+func (db *Database) BuildForSealedData(keyID string, sealed [][]byte) error {
+
+	contents, err := binaryContents(sealed, GetRequiredLengthPrefixedSlotSize(sealed))
+	if err != nil {
+		return err
+	}
+
+	contents.keyID = keyID
+	db.install(contents)
+
+	return nil
+}
+
+// SwapInSealed atomically replaces the contents of the database with records
+// sealed with the key with keyID for the next epoch (see SwapIn and SealData)
+func (db *Database) SwapInSealed(keyID string, sealed [][]byte) error {
+
+	slotSize := GetRequiredLengthPrefixedSlotSize(sealed)
+
+	slots := make([]*Slot, len(sealed))
+	for i := range sealed {
+		var err error
+		if slots[i], err = NewLengthPrefixedSlot(sealed[i], slotSize); err != nil {
+			return err
+		}
+	}
+
+	return db.swapIn(slots, keyID)
+}
+
+// OpenSlot decrypts the slot at index recovered from the database described by dbmd.
+// Returns ErrSlotKeyMismatch if the slots are encrypted with another key and
+// ErrSlotDecryption if the slot is not the sealed record at index for the epoch
+func (key *SlotKey) OpenSlot(dbmd *DBMetadata, index int, slot *Slot) ([]byte, error) {
+
+	if dbmd.SlotKeyID != key.ID {
+		return nil, ErrSlotKeyMismatch
+	}
+
+	sealed, err := dbmd.DecodeSlot(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := key.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrSlotDecryption
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, key.additionalData(dbmd.Epoch, index))
+	if err != nil || len(plaintext) < LengthPrefixBytes {
+		return nil, ErrSlotDecryption
+	}
+
+	n := int(binary.BigEndian.Uint32(plaintext))
+	if n > len(plaintext)-LengthPrefixBytes {
+		return nil, ErrSlotDecryption
+	}
+
+	return plaintext[LengthPrefixBytes : LengthPrefixBytes+n], nil
+}
+
+// GetOpened retrieves the slot at index (see Get) and decrypts it with the key
+// (see OpenSlot). Fails with ErrSlotDecryption if the epoch changes in the meantime
+func (c *Client) GetOpened(index int, key *SlotKey) ([]byte, error) {
+
+	dbmd := c.Metadata()
+
+	slot, err := c.Get(index)
+	if err != nil {
+		return nil, err
+	}
+
+	return key.OpenSlot(&dbmd, index, slot)
+}
+
+func (key *SlotKey) aead() (cipher.AEAD, error) {
+
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// additionalData binds a sealed record to the key ID, epoch and index
+func (key *SlotKey) additionalData(epoch, index int) []byte {
+
+	ad := binary.AppendUvarint(nil, uint64(len(key.ID)))
+	ad = append(ad, key.ID...)
+	ad = binary.AppendVarint(ad, int64(epoch))
+	ad = binary.AppendVarint(ad, int64(index))
+
+	return ad
+}
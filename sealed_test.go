@@ -0,0 +1,96 @@
+package pir
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// run with 'go test -v -run TestSealedSlots' to see log outputs.
+func TestSealedSlots(t *testing.T) {
+	setup()
+
+	data := [][]byte{[]byte("a"), []byte("record"), {}, []byte("a longer record"), []byte("z")}
+
+	key, err := NewSlotKey("key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := NewDatabase()
+	sealed, err := key.SealData(db.Epoch, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// sealed records do not reveal the length of the data
+	for _, record := range sealed {
+		if len(record) != len(sealed[0]) {
+			t.Fatalf("Sealed records have different sizes")
+		}
+	}
+
+	if err := db.BuildForSealedData(key.ID, sealed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.ShuffleWithinGroups(2); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(db.Metadata(), 2, 2, answerWith(db))
+	for i, record := range data {
+		opened, err := client.GetOpened(i, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(opened, record) {
+			t.Fatalf("Opened %q; expected %q\n", opened, record)
+		}
+	}
+
+	// records cannot be moved to another index
+	dbmd := db.Metadata()
+	slot, _ := client.Get(0)
+	if _, err := key.OpenSlot(&dbmd, 1, slot); !errors.Is(err, ErrSlotDecryption) {
+		t.Fatalf("Expected ErrSlotDecryption, got %v\n", err)
+	}
+
+	// key rotation at the next epoch
+	newKey, _ := NewSlotKey("key-2")
+	sealed, err = newKey.SealData(db.Epoch+1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.SwapInSealed(newKey.ID, sealed); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetMetadata(db.Metadata())
+	if _, err := client.GetOpened(1, key); !errors.Is(err, ErrSlotKeyMismatch) {
+		t.Fatalf("Expected ErrSlotKeyMismatch, got %v\n", err)
+	}
+
+	opened, err := client.GetOpened(1, newKey)
+	if err != nil || !bytes.Equal(opened, data[1]) {
+		t.Fatalf("Opened %q (%v); expected %q\n", opened, err, data[1])
+	}
+
+	// records of another epoch are rejected
+	sealed, _ = newKey.SealData(db.Epoch, data)
+	if err := db.SwapInSealed(newKey.ID, sealed); err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetMetadata(db.Metadata())
+	if _, err := client.GetOpened(1, newKey); !errors.Is(err, ErrSlotDecryption) {
+		t.Fatalf("Expected ErrSlotDecryption, got %v\n", err)
+	}
+
+	// plain swaps clear the key
+	if err := db.SwapIn(db.Slots); err != nil || db.SlotKeyID != "" {
+		t.Fatalf("Key ID %q remains after a plain swap (%v)\n", db.SlotKeyID, err)
+	}
+}
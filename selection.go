@@ -0,0 +1,124 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+ Selection within retrieved groups.
+ Queries retrieve a block of slots (a group of a secret shared query, a
+ row of an encrypted query or a group of a row of a doubly encrypted
+ query) and the client picks the slot it wants from the block. The
+ position of the slot within the block depends on the group size, the
+ width of the rows and the shuffling of the groups (see
+ ShuffleWithinGroups), so the Select functions locate the slot of a
+ logical index in a recovered block, check that the block is the one
+ retrieved for the index and return the slot (and optionally the slots
+ of the neighboring indices that are in the same block).
+*/
+
+// ErrNotInGroup is returned when the slot of an index is not in the retrieved block of slots
+var ErrNotInGroup = errors.New("index is not in the retrieved group")
+
+// SelectFromGroup returns the slot at the logical index from the slots recovered for
+// the group of a secret shared query (see GroupPosition) or for the row of an
+// encrypted query (whose width is len(slots)). Returns ErrNotInGroup if the slots
+// cannot be those of the group of the index
+func SelectFromGroup(slots []*Slot, dbmd *DBMetadata, index int) (*Slot, error) {
+
+	res, _, err := SelectNeighborsFromGroup(slots, dbmd, index, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return res[0], nil
+}
+
+// SelectNeighborsFromGroup returns the slots at the logical indices first, ..., first+len(res)-1
+// that are at most radius away from index and in the same group as index (see SelectFromGroup)
+func SelectNeighborsFromGroup(slots []*Slot, dbmd *DBMetadata, index, radius int) ([]*Slot, int, error) {
+
+	groupSize := len(slots)
+	if groupSize == 0 {
+		return nil, 0, errors.New("no slots were retrieved")
+	}
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, 0, fmt.Errorf("index %v is not in the database", index)
+	}
+
+	start := (index / groupSize) * groupSize
+
+	return dbmd.selectFromBlock(slots, start, index, radius)
+}
+
+// SelectFromDoublyEncryptedGroup returns the slot at the logical index from the slots
+// recovered for a doubly encrypted query in a database of the given width
+// (see RecoverDoublyEncryptedGroup). Returns ErrNotInGroup if the slots cannot be those
+// of the group of the index
+func SelectFromDoublyEncryptedGroup(slots []*Slot, dbmd *DBMetadata, index, width int) (*Slot, error) {
+
+	res, _, err := SelectNeighborsFromDoublyEncryptedGroup(slots, dbmd, index, width, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return res[0], nil
+}
+
+// SelectNeighborsFromDoublyEncryptedGroup returns the slots at the logical indices first, ...,
+// first+len(res)-1 that are at most radius away from index and in the same group as index
+// (see SelectFromDoublyEncryptedGroup)
+func SelectNeighborsFromDoublyEncryptedGroup(slots []*Slot, dbmd *DBMetadata, index, width, radius int) ([]*Slot, int, error) {
+
+	groupSize := len(slots)
+	if groupSize == 0 {
+		return nil, 0, errors.New("no slots were retrieved")
+	}
+
+	if width <= 0 || width%groupSize != 0 {
+		return nil, 0, fmt.Errorf("width %v is not a multiple of the group size %v", width, groupSize)
+	}
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, 0, fmt.Errorf("index %v is not in the database", index)
+	}
+
+	row, col := dbmd.IndexToCoordinates(index, width, 0)
+	start := row*width + (col/groupSize)*groupSize
+
+	return dbmd.selectFromBlock(slots, start, index, radius)
+}
+
+// selectFromBlock returns the slots of the logical indices around index (at most radius
+// away) whose slots are stored in the block of slots starting at start
+func (dbmd *DBMetadata) selectFromBlock(slots []*Slot, start, index, radius int) ([]*Slot, int, error) {
+
+	inBlock := func(i int) bool {
+		if i < 0 || i >= dbmd.DBSize {
+			return false
+		}
+		pos := dbmd.storagePosition(i) - start
+		return pos >= 0 && pos < len(slots)
+	}
+
+	if !inBlock(index) {
+		return nil, 0, ErrNotInGroup
+	}
+
+	first, last := index, index
+	for first > index-radius && inBlock(first-1) {
+		first--
+	}
+	for last < index+radius && inBlock(last+1) {
+		last++
+	}
+
+	res := make([]*Slot, 0, last-first+1)
+	for i := first; i <= last; i++ {
+		res = append(res, slots[dbmd.storagePosition(i)-start])
+	}
+
+	return res, first, nil
+}
@@ -0,0 +1,115 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestSelectFromGroup' to see log outputs.
+func TestSelectFromGroup(t *testing.T) {
+	setup()
+
+	groupSize := 4
+	db := GenerateRandomDB(TestDBSize+3, SlotBytes) // last group is partial
+	logical := make([]*Slot, db.DBSize)
+	copy(logical, db.Slots)
+
+	if err := db.ShuffleWithinGroups(groupSize); err != nil {
+		t.Fatal(err)
+	}
+	md := db.Metadata()
+
+	for _, index := range []int{0, 5, md.DBSize - 1} {
+		row, _ := md.GroupPosition(index, groupSize)
+		slots, err := retrieveGroup(db, md, row, groupSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slot, err := SelectFromGroup(slots, &md, index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slot.Equal(logical[index]) {
+			t.Fatalf("Selected slot %v is incorrect\n", index)
+		}
+
+		neighbors, first, err := SelectNeighborsFromGroup(slots, &md, index, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, neighbor := range neighbors {
+			if first+i < index-1 || first+i > index+1 || !neighbor.Equal(logical[first+i]) {
+				t.Fatalf("Neighbor %v of %v is incorrect\n", first+i, index)
+			}
+		}
+	}
+
+	// groups of another size than the shuffled groups are not aligned:
+	// the slots of some indices are stored in the neighboring groups
+	misaligned := 0
+	for row := 0; row < 10; row++ {
+		slots, err := retrieveGroup(db, md, row, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for index := row * 6; index < (row+1)*6; index++ {
+			slot, err := SelectFromGroup(slots, &md, index)
+			if errors.Is(err, ErrNotInGroup) {
+				misaligned++
+			} else if err != nil || !slot.Equal(logical[index]) {
+				t.Fatalf("Selected slot %v is incorrect (%v)\n", index, err)
+			}
+		}
+	}
+	if misaligned == 0 {
+		t.Fatalf("Expected ErrNotInGroup for misaligned groups\n")
+	}
+
+	// rows of encrypted and doubly encrypted queries
+	sk, pk := paillier.KeyGen(128)
+	db.DisableGroupShuffling()
+	md = db.Metadata()
+	index := 37
+
+	width := md.NewEncryptedQuery(pk, 1, 0).DBWidth
+	query := md.NewEncryptedQuery(pk, 1, index/width)
+	res, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slot, err := SelectFromGroup(recoverEncrypted(t, res, sk), &md, index); err != nil || !slot.Equal(logical[index]) {
+		t.Fatalf("Selected slot %v of the encrypted row is incorrect (%v)\n", index, err)
+	}
+
+	dquery := db.NewDoublyEncryptedQuery(pk, groupSize, index)
+	dres, err := db.PrivateDoublyEncryptedQuery(dquery, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, err := SelectFromDoublyEncryptedGroup(recoverDoublyEncrypted(t, dres, sk), &md, index, dquery.Row.DBWidth)
+	if err != nil || !slot.Equal(logical[index]) {
+		t.Fatalf("Selected slot %v of the doubly encrypted group is incorrect (%v)\n", index, err)
+	}
+}
+
+// retrieveGroup retrieves the slots of the group (row) using a query generated from md
+func retrieveGroup(db *Database, md DBMetadata, row, groupSize int) ([]*Slot, error) {
+
+	shares := md.NewIndexQueryShares(row, groupSize, 2)
+
+	resA, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	resB, err := db.PrivateSecretSharedQuery(shares[1], NumProcsForQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	return Recover([]*SecretSharedQueryResult{resA, resB}), nil
+}
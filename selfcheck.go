@@ -0,0 +1,146 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+ Per-query self-check.
+ In test and simulation setups a single process holds every share of a
+ query. SetSelfCheck gives the database a function returning the sibling
+ shares of a share; after answering a secret shared query the database
+ answers the siblings locally, recovers the selected row and compares it
+ with the plaintext row. DPF and domain mismatches are then reported by
+ the server answering the bad share instead of showing up as garbage at
+ the client. The check expands each sibling and scans the selected rows
+ once more, so it is meant for debugging: in builds with the pirdebug
+ tag a failed self-check panics (an assertion) instead of failing the
+ query with a *SelfCheckError.
+*/
+
+// ErrSelfCheckFailed is matched (using errors.Is) by the error returned by a query
+// whose self-check failed (see SetSelfCheck). The error is a *SelfCheckError
+var ErrSelfCheckFailed = errors.New("query self-check failed")
+
+// SelfCheckError describes a failed self-check
+type SelfCheckError struct {
+	Rows []int // rows selected by the shares (exactly one for index queries)
+	Cols []int // columns of the selected row recovered incorrectly
+}
+
+func (e *SelfCheckError) Error() string {
+	return fmt.Sprintf("%v: shares select rows %v, columns %v recovered incorrectly",
+		ErrSelfCheckFailed, e.Rows, e.Cols)
+}
+
+// Is reports whether target is ErrSelfCheckFailed
+func (e *SelfCheckError) Is(target error) bool {
+	return target == ErrSelfCheckFailed
+}
+
+// SiblingShares returns the other shares of the query of a share
+// (nil if they are unknown, in which case the share is not checked)
+type SiblingShares func(share *QueryShare) []*QueryShare
+
+// SetSelfCheck checks every secret shared query answered by the database against
+// the plaintext using the sibling shares of the query (nil disables the check)
+func (db *Database) SetSelfCheck(siblings SiblingShares) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.selfCheck = siblings
+}
+
+// selfCheckLocked checks the result of the share against the plaintext (with the read lock
+// held). Panics in debug builds if the check fails
+func (db *Database) selfCheckLocked(query *QueryShare, bits []bool, res *SecretSharedQueryResult, nprocs int) error {
+
+	if db.selfCheck == nil {
+		return nil
+	}
+
+	siblings := db.selfCheck(query)
+	if len(siblings) == 0 {
+		return nil
+	}
+
+	err := db.checkAgainstSiblings(query, bits, res, siblings, nprocs)
+	if err != nil && debugBuild {
+		panic(err)
+	}
+
+	return err
+}
+
+func (db *Database) checkAgainstSiblings(query *QueryShare, bits []bool, res *SecretSharedQueryResult, siblings []*QueryShare, nprocs int) error {
+
+	// the selection bits of the siblings combined
+	siblingBits := make([]bool, len(bits))
+	for _, sibling := range siblings {
+		if sibling.GroupSize != query.GroupSize {
+			return fmt.Errorf("%w: sibling share has group size %v instead of %v",
+				ErrSelfCheckFailed, sibling.GroupSize, query.GroupSize)
+		}
+
+		b, err := db.expandSharedQuery(sibling, nprocs)
+		if err != nil {
+			return err
+		}
+
+		for i := range siblingBits {
+			siblingBits[i] = siblingBits[i] != b[i]
+		}
+	}
+
+	dimWidth := query.GroupSize
+
+	// recover the row from the result and the results of the siblings
+	recovered := make([]*Slot, dimWidth)
+	for col := range recovered {
+		recovered[col] = NewEmptySlot(db.SlotBytes)
+		XorSlots(recovered[col], res.Shares[col])
+	}
+	db.xorRows(recovered, siblingBits, dimWidth, query.AttributeMask, 0, len(siblingBits))
+
+	checkErr := &SelfCheckError{}
+	for row := range bits {
+		if bits[row] != siblingBits[row] {
+			checkErr.Rows = append(checkErr.Rows, row)
+		}
+	}
+
+	// the plaintext row (zero if no row is selected, e.g. for a missing keyword)
+	expected := make([]*Slot, dimWidth)
+	for col := range expected {
+		expected[col] = NewEmptySlot(db.SlotBytes)
+	}
+
+	// index queries select exactly one row, keyword queries at most one
+	if len(checkErr.Rows) > 1 || (len(checkErr.Rows) == 0 && !query.IsKeywordBased) {
+		return checkErr
+	}
+
+	if len(checkErr.Rows) == 1 {
+		row := checkErr.Rows[0]
+		for col := 0; col < dimWidth; col++ {
+			slotIndex := row*dimWidth + col
+			if slotIndex < len(db.Slots) && db.matchesAttributes(slotIndex, query.AttributeMask) {
+				XorSlots(expected[col], db.Slots[slotIndex])
+			}
+		}
+	}
+
+	for col := range expected {
+		if !expected[col].Equal(recovered[col]) {
+			checkErr.Cols = append(checkErr.Cols, col)
+		}
+	}
+
+	if len(checkErr.Cols) > 0 {
+		return checkErr
+	}
+
+	return nil
+}
@@ -0,0 +1,6 @@
+//go:build pirdebug
+
+package pir
+
+// debugBuild is set in builds with the pirdebug tag (see SetSelfCheck)
+const debugBuild = true
@@ -0,0 +1,50 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+)
+
+// run with 'go test -v -run TestSelfCheck' to see log outputs.
+func TestSelfCheck(t *testing.T) {
+	setup()
+
+	groupSize := 4
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	md := db.Metadata()
+
+	shares := md.NewIndexQueryShares(5, groupSize, 2)
+	siblings := map[*QueryShare]*QueryShare{shares[0]: shares[1], shares[1]: shares[0]}
+
+	db.SetSelfCheck(func(share *QueryShare) []*QueryShare {
+		if sibling, ok := siblings[share]; ok {
+			return []*QueryShare{sibling}
+		}
+		return nil
+	})
+
+	for _, share := range shares {
+		if _, err := db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// shares without known siblings are not checked
+	if _, err := db.PrivateSecretSharedQuery(md.NewIndexQueryShares(1, groupSize, 2)[0], NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	if debugBuild {
+		t.Skip("failed self-checks panic in debug builds")
+	}
+
+	// shares of different queries do not select a single row
+	other := md.NewIndexQueryShares(9, groupSize, 2)
+	siblings[shares[0]] = other[1]
+
+	_, err := db.PrivateSecretSharedQuery(shares[0], NumProcsForQuery)
+	var checkErr *SelfCheckError
+	if !errors.Is(err, ErrSelfCheckFailed) || !errors.As(err, &checkErr) || len(checkErr.Rows) == 1 {
+		t.Fatalf("Expected a self-check error, got %v\n", err)
+	}
+}
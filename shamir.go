@@ -0,0 +1,296 @@
+package pir
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+/*
+ t-private multi-server PIR with Shamir secret sharing.
+ The secret shared queries reconstruct with XOR, so a single server that
+ does not collude learns nothing but any two (or all, with multi-party
+ keys) servers that pool their shares learn the index. In this mode the
+ selection vector of the query (one element of GF(2^8) per row, 1 at the
+ retrieved row and 0 elsewhere) is Shamir shared among the servers with
+ random polynomials of degree Threshold: the share of a server is the
+ evaluation of the polynomials at its point (1...NumServers), so any
+ Threshold servers learn nothing about the index. Each server returns
+ the sum of the rows of the database weighted by its share (bytes are
+ elements of GF(2^8)), which is the evaluation at its point of a
+ polynomial of degree Threshold whose value at zero is the retrieved
+ row; the client interpolates the results of any Threshold+1 servers
+ (see RecoverShamir). A deployment of k servers tolerates the collusion
+ of up to k-1 servers with Threshold k-1, or trades privacy for
+ availability with a lower threshold (the client needs Threshold+1
+ answers). Query shares hold one byte per row, so queries for large
+ databases should retrieve large groups (see DefaultLayout).
+*/
+
+// MaxShamirServers is the largest number of servers of a Shamir query
+// (the non-zero elements of GF(2^8))
+const MaxShamirServers = 255
+
+// ShamirQueryShare is the share of a Shamir query sent to the server at Point
+type ShamirQueryShare struct {
+	Point     byte // evaluation point of the share (1...NumServers)
+	Threshold int  // number of servers that may collude
+	GroupSize int
+	Selection []byte // share of the selection vector (one element per row)
+
+	// fingerprint of the layout the query was generated for (see Layout)
+	LayoutFingerprint LayoutFingerprint
+}
+
+// ShamirQueryResult is the answer of the server at Point to a Shamir query share
+type ShamirQueryResult struct {
+	Point     byte
+	Threshold int
+	SlotBytes int
+	Shares    []*Slot
+}
+
+// NewShamirQueryShares generates the shares of a query retrieving the group at index
+// for numServers servers, private against the collusion of up to threshold servers
+func (dbmd *DBMetadata) NewShamirQueryShares(index, groupSize, threshold, numServers int) ([]*ShamirQueryShare, error) {
+
+	if groupSize <= 0 {
+		return nil, errors.New("group size must be positive")
+	}
+
+	numRows := ceilDiv(dbmd.DBSize, groupSize)
+	if index < 0 || index >= numRows {
+		return nil, fmt.Errorf("group %v is not in the database", index)
+	}
+
+	if numServers < 2 || numServers > MaxShamirServers {
+		return nil, fmt.Errorf("number of servers %v is not in [2, %v]", numServers, MaxShamirServers)
+	}
+
+	if threshold < 1 || threshold >= numServers {
+		return nil, errors.New("threshold must be between 1 and the number of servers minus one")
+	}
+
+	fingerprint := dbmd.SharedLayout(groupSize).Fingerprint()
+
+	shares := make([]*ShamirQueryShare, numServers)
+	for i := range shares {
+		shares[i] = &ShamirQueryShare{
+			Point:             byte(i + 1),
+			Threshold:         threshold,
+			GroupSize:         groupSize,
+			Selection:         make([]byte, numRows),
+			LayoutFingerprint: fingerprint,
+		}
+	}
+
+	// random coefficients of degree 1...threshold of the polynomial of each row
+	coeffs := make([]byte, numRows*threshold)
+	if _, err := rand.Read(coeffs); err != nil {
+		return nil, err
+	}
+
+	for row := 0; row < numRows; row++ {
+		poly := coeffs[row*threshold : (row+1)*threshold]
+
+		secret := byte(0)
+		if row == index {
+			secret = 1
+		}
+
+		for _, share := range shares {
+			// Horner's rule from the coefficient of degree threshold
+			v := byte(0)
+			for d := threshold - 1; d >= 0; d-- {
+				v = gfMul(v^poly[d], share.Point)
+			}
+			share.Selection[row] = v ^ secret
+		}
+	}
+
+	return shares, nil
+}
+
+// PrivateShamirQuery answers the Shamir query share with the rows of the database
+// weighted by the share
+func (db *Database) PrivateShamirQuery(query *ShamirQueryShare, nprocs int) (*ShamirQueryResult, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if !query.LayoutFingerprint.IsZero() && query.LayoutFingerprint != db.SharedLayout(query.GroupSize).Fingerprint() {
+		return nil, ErrStaleLayout
+	}
+
+	numRows := ceilDiv(db.DBSize, query.GroupSize)
+	if len(query.Selection) != numRows {
+		return nil, fmt.Errorf("%w: query selects among %v rows, database has %v",
+			ErrStaleLayout, len(query.Selection), numRows)
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	rowBytes := query.GroupSize * db.SlotBytes
+
+	partial := make([][]byte, nprocs)
+	for w := range partial {
+		partial[w] = make([]byte, rowBytes)
+	}
+
+	err := parallelRanges(context.Background(), numRows, nprocs, func(w, start, end int) error {
+		acc := partial[w]
+		var table [256]byte
+		for row := start; row < end; row++ {
+			gfMulTable(&table, query.Selection[row])
+			for col := 0; col < query.GroupSize; col++ {
+				index := row*query.GroupSize + col
+				if index >= len(db.Slots) {
+					break
+				}
+				out := acc[col*db.SlotBytes : (col+1)*db.SlotBytes]
+				for i, b := range db.Slots[index].Data {
+					out[i] ^= table[b]
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := partial[0]
+	for _, acc := range partial[1:] {
+		for i, b := range acc {
+			sum[i] ^= b
+		}
+	}
+
+	shares := make([]*Slot, query.GroupSize)
+	for col := range shares {
+		shares[col] = NewSlot(sum[col*db.SlotBytes : (col+1)*db.SlotBytes])
+	}
+
+	return &ShamirQueryResult{
+		Point:     query.Point,
+		Threshold: query.Threshold,
+		SlotBytes: db.SlotBytes,
+		Shares:    shares,
+	}, nil
+}
+
+// RecoverShamir interpolates the results of at least Threshold+1 distinct servers
+// and returns the slots of the retrieved group
+func RecoverShamir(resShares []*ShamirQueryResult) ([]*Slot, error) {
+
+	if len(resShares) == 0 {
+		return nil, errors.New("no results to recover")
+	}
+
+	threshold := resShares[0].Threshold
+	if threshold < 1 || len(resShares) < threshold+1 {
+		return nil, fmt.Errorf("recovering needs %v results, got %v", threshold+1, len(resShares))
+	}
+
+	resShares = resShares[:threshold+1]
+
+	groupSize, slotBytes := len(resShares[0].Shares), resShares[0].SlotBytes
+	for i, res := range resShares {
+		if res.Threshold != threshold || len(res.Shares) != groupSize || res.SlotBytes != slotBytes {
+			return nil, errors.New("results are for different queries")
+		}
+
+		if res.Point == 0 {
+			return nil, errors.New("invalid evaluation point")
+		}
+
+		for _, other := range resShares[:i] {
+			if other.Point == res.Point {
+				return nil, errors.New("duplicate result")
+			}
+		}
+	}
+
+	// Lagrange coefficients at zero: prod_{j != i} x_j / (x_j - x_i)
+	coeffs := make([]byte, len(resShares))
+	for i, res := range resShares {
+		num, den := byte(1), byte(1)
+		for j, other := range resShares {
+			if j != i {
+				num = gfMul(num, other.Point)
+				den = gfMul(den, other.Point^res.Point)
+			}
+		}
+		coeffs[i] = gfMul(num, gfInv(den))
+	}
+
+	slots := make([]*Slot, groupSize)
+	var table [256]byte
+	for col := range slots {
+		data := make([]byte, slotBytes)
+		for i, res := range resShares {
+			if res.Shares[col] == nil || len(res.Shares[col].Data) != slotBytes {
+				return nil, errors.New("results are for different queries")
+			}
+			gfMulTable(&table, coeffs[i])
+			for k, b := range res.Shares[col].Data {
+				data[k] ^= table[b]
+			}
+		}
+		slots[col] = NewSlot(data)
+	}
+
+	return slots, nil
+}
+
+// gfExp and gfLog are the exponentials and logarithms of the generator 3 of
+// GF(2^8) = GF(2)[x]/(x^8 + x^4 + x^3 + x + 1) (gfExp is doubled to skip a reduction)
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [510]byte, log [256]byte) {
+
+	v := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = v, v
+		log[v] = byte(i)
+
+		// multiply by 3 = x + 1
+		hi := v & 0x80
+		v ^= v << 1
+		if hi != 0 {
+			v ^= 0x1b
+		}
+	}
+
+	return exp, log
+}
+
+// gfMul multiplies a and b in GF(2^8)
+func gfMul(a, b byte) byte {
+
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+// gfInv returns the inverse of a non-zero element of GF(2^8)
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulTable sets table[b] to s*b for every element b
+func gfMulTable(table *[256]byte, s byte) {
+	for b := range table {
+		table[b] = gfMul(s, byte(b))
+	}
+}
@@ -0,0 +1,131 @@
+package pir
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestShamirQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	md := db.Metadata()
+
+	for _, config := range [][2]int{{1, 2}, {1, 3}, {2, 3}, {2, 5}, {4, 5}} {
+		threshold, numServers := config[0], config[1]
+
+		for trial := 0; trial < NumTrials; trial++ {
+			groupSize := 1 + rand.Intn(4)
+			index := rand.Intn(ceilDiv(TestDBSize, groupSize))
+
+			shares, err := md.NewShamirQueryShares(index, groupSize, threshold, numServers)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			results := make([]*ShamirQueryResult, numServers)
+			for i, share := range shares {
+				// the shares and results survive the wire
+				b, err := share.MarshalBinary()
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded := &ShamirQueryShare{}
+				if err := decoded.UnmarshalBinary(b); err != nil {
+					t.Fatal(err)
+				}
+
+				res, err := db.PrivateShamirQuery(decoded, NumProcsForQuery)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if b, err = res.MarshalBinary(); err != nil {
+					t.Fatal(err)
+				}
+				results[i] = &ShamirQueryResult{}
+				if err := results[i].UnmarshalBinary(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// any threshold+1 results recover the group
+			rand.Shuffle(len(results), func(i, j int) { results[i], results[j] = results[j], results[i] })
+
+			slots, err := RecoverShamir(results[:threshold+1])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for col, slot := range slots {
+				i := index*groupSize + col
+				if i < TestDBSize && !slot.Equal(db.Slots[i]) {
+					t.Fatalf("Query result is incorrect (t=%v, k=%v). %v != %v\n", threshold, numServers, db.Slots[i], slot)
+				}
+			}
+
+			if _, err := RecoverShamir(results[:threshold]); err == nil {
+				t.Fatalf("Recovered from %v results with threshold %v\n", threshold, threshold)
+			}
+		}
+	}
+}
+
+func TestShamirQueryErrors(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	md := db.Metadata()
+
+	if _, err := md.NewShamirQueryShares(0, 1, 2, 2); err == nil {
+		t.Fatalf("Generated shares with a threshold equal to the number of servers")
+	}
+
+	if _, err := md.NewShamirQueryShares(0, 1, 1, MaxShamirServers+1); err == nil {
+		t.Fatalf("Generated shares for too many servers")
+	}
+
+	if _, err := md.NewShamirQueryShares(TestDBSize, 1, 1, 2); err == nil {
+		t.Fatalf("Generated shares for an index past the end of the database")
+	}
+
+	shares, err := md.NewShamirQueryShares(0, 1, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := db.PrivateShamirQuery(shares[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RecoverShamir([]*ShamirQueryResult{res, res}); err == nil {
+		t.Fatalf("Recovered from duplicate results")
+	}
+
+	// the database grew since the shares were generated
+	if err := db.SwapIn(GenerateRandomDB(TestDBSize+1, SlotBytes).Slots); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.PrivateShamirQuery(shares[0], 1); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Answered a stale query (%v)\n", err)
+	}
+}
+
+func TestGF256(t *testing.T) {
+
+	for a := 1; a < 256; a++ {
+		if gfMul(byte(a), gfInv(byte(a))) != 1 {
+			t.Fatalf("%v * %v^-1 != 1\n", a, a)
+		}
+
+		// multiplication distributes over addition
+		for b := 0; b < 256; b += 7 {
+			if gfMul(byte(a), byte(b)^0x5a) != gfMul(byte(a), byte(b))^gfMul(byte(a), 0x5a) {
+				t.Fatalf("Multiplication of %v does not distribute\n", a)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package pir
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+/*
+ Query shape checks.
+ A query must not leak its target through its size: every query generated
+ for the same metadata and parameters must have exactly the same shape.
+ The shape of a query is the length of its binary encoding (MarshalBinary),
+ which covers every field sent to the servers. The encodings are fixed
+ width where values are random: DPF keys encode FinalCW at a fixed width
+ and every block of Sigma (see package dpf) and encrypted queries pad each
+ ciphertext to the length of its modulus. In strict mode the query
+ constructors remember the first shape generated for each set of
+ parameters and panic if a later query differs.
+*/
+
+// ErrQueryShapeMismatch is returned (or panicked with in strict mode)
+// when two queries for the same parameters have different shapes
+var ErrQueryShapeMismatch = errors.New("queries for different targets have different shapes")
+
+var strictShapes struct {
+	sync.Mutex
+	enabled bool
+	shapes  map[string]int
+}
+
+// SetStrictQueryShapes enables (or disables) the shape check in the query constructors.
+// Enabling strict mode forgets previously recorded shapes
+func SetStrictQueryShapes(enabled bool) {
+	strictShapes.Lock()
+	defer strictShapes.Unlock()
+
+	strictShapes.enabled = enabled
+	strictShapes.shapes = nil
+}
+
+// strictQueryShapes returns true if strict mode is enabled
+func strictQueryShapes() bool {
+	strictShapes.Lock()
+	defer strictShapes.Unlock()
+
+	return strictShapes.enabled
+}
+
+// CheckIndexQueryShapes generates query shares for each of the indices
+// and returns ErrQueryShapeMismatch if they do not all have the same shape
+func (dbmd *DBMetadata) CheckIndexQueryShapes(indices []int, groupSize int, numShares uint) error {
+
+	ref := -1
+	for _, index := range indices {
+		for _, share := range dbmd.NewIndexQueryShares(index, groupSize, numShares) {
+			shape, err := encodedLength(share)
+			if err != nil {
+				return err
+			}
+
+			if ref < 0 {
+				ref = shape
+			} else if shape != ref {
+				return ErrQueryShapeMismatch
+			}
+		}
+	}
+
+	return nil
+}
+
+// shape returns the length of the encoding of the query share
+func (share *QueryShare) shape() int {
+	return mustEncodedLength(share)
+}
+
+// shape returns the length of the encoding of the query
+// (including the public key and the padded ciphertexts)
+func (query *EncryptedQuery) shape() int {
+	return mustEncodedLength(query)
+}
+
+// encodedLength returns the length of the binary encoding of v
+func encodedLength(v encoding.BinaryMarshaler) (int, error) {
+
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// mustEncodedLength is encodedLength for the queries built by the constructors,
+// which are always encoded
+func mustEncodedLength(v encoding.BinaryMarshaler) int {
+
+	n, err := encodedLength(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+// checkStrictShape records the shape of the first query generated for params
+// and panics if a later query has a different shape (strict mode only)
+func checkStrictShape(params string, shape int) {
+
+	strictShapes.Lock()
+	defer strictShapes.Unlock()
+
+	if !strictShapes.enabled {
+		return
+	}
+
+	if strictShapes.shapes == nil {
+		strictShapes.shapes = make(map[string]int)
+	}
+
+	ref, ok := strictShapes.shapes[params]
+	if !ok {
+		strictShapes.shapes[params] = shape
+		return
+	}
+
+	if shape != ref {
+		panic(fmt.Sprintf("%v (%v: %v != %v bytes)", ErrQueryShapeMismatch, params, shape, ref))
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
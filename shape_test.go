@@ -0,0 +1,84 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestQueryShapes' to see log outputs.
+func TestQueryShapes(t *testing.T) {
+	setup()
+
+	SetStrictQueryShapes(true)
+	defer SetStrictQueryShapes(false)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	_, pk := paillier.KeyGen(128)
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+		dimHeight := (TestDBSize + groupSize - 1) / groupSize
+		indices := []int{0, 1, dimHeight / 2, dimHeight - 1}
+
+		for numShares := uint(2); numShares <= 3; numShares++ {
+			if err := db.CheckIndexQueryShapes(indices, groupSize, numShares); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// strict mode checks keyword and encrypted queries as they are generated
+		for i := 0; i < NumQueries/10; i++ {
+			db.NewKeywordQueryShares(int(rand.Uint32()), groupSize, 2)
+			db.NewEncryptedQuery(pk, groupSize, rand.Intn(2))
+		}
+	}
+
+	share := db.NewIndexQueryShares(0, 1, 2)[0]
+	other := db.NewIndexQueryShares(0, 1, 2)[0]
+	other.KeyTwoParty.CW = other.KeyTwoParty.CW[1:]
+	if share.shape() == other.shape() {
+		t.Fatalf("Shape does not capture the key length")
+	}
+
+	// every field sent to the servers is part of the shape
+	other = db.NewIndexQueryShares(0, 1, 2)[0]
+	other.KeywordDigest = []byte{1}
+	if share.shape() == other.shape() {
+		t.Fatalf("Shape does not capture the keyword digest")
+	}
+}
+
+// run with 'go test -v -run TestEncryptedQueryShapes' to see log outputs.
+func TestEncryptedQueryShapes(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	_, pk := paillier.KeyGen(128)
+
+	// ciphertexts are encoded at a fixed width (some have leading zero bytes)
+	height := db.DefaultLayout(1).Height
+	ref := db.NewEncryptedQuery(pk, 1, 0).shape()
+	for i := 0; i < NumQueries; i++ {
+		query := db.NewEncryptedQuery(pk, 1, rand.Intn(height))
+		if shape := query.shape(); shape != ref {
+			t.Fatalf("Encrypted queries have different shapes: %v != %v bytes\n", shape, ref)
+		}
+
+		b, err := query.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := &EncryptedQuery{}
+		if err := decoded.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+
+		for j := range query.EBits {
+			if decoded.EBits[j].C.Cmp(query.EBits[j].C) != 0 || decoded.EBits[j].Level != query.EBits[j].Level {
+				t.Fatalf("Decoded ciphertext %v does not match the query\n", j)
+			}
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package pir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/paillier"
+	"github.com/sachaservan/pir/dpf"
+)
+
+/*
+ Sharding.
+ Split cuts the slots of a database into contiguous stripes (shards)
+ that can be served by different machines. Queries are generated from
+ the metadata of the whole database and sent to every shard: a shard
+ evaluates the query on the rows overlapping its stripe and adds the
+ slots it holds into a partial result (a row may span two shards, each
+ shard contributing its columns of the row). The partial results are
+ merged by XOR for secret shared queries and by homomorphic addition
+ for encrypted queries (see MergeSharedResults and MergeEncryptedResults),
+ which yields the result of the whole database. ShardedDatabase runs
+ all the shards of a database in one process.
+*/
+
+// Shard is a contiguous stripe of the slots of a database
+type Shard struct {
+	DBMetadata        // metadata of the whole database (queries are generated from it)
+	Offset     int    // index of the first slot of the shard in the whole database
+	Keywords   []uint // keywords of the rows of the whole database (optional)
+
+	db *Database // slots and attributes of the stripe
+}
+
+// ShardedDatabase answers queries over the shards of a database
+type ShardedDatabase struct {
+	DBMetadata
+	Shards []*Shard
+}
+
+// Split cuts the database into numShards shards of (nearly) equal size
+func (db *Database) Split(numShards int) (*ShardedDatabase, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if numShards < 1 || numShards > db.DBSize {
+		return nil, fmt.Errorf("cannot split %v slots into %v shards", db.DBSize, numShards)
+	}
+
+	if len(db.Slots) != db.DBSize {
+		return nil, errors.New("database is not built")
+	}
+
+	sdb := &ShardedDatabase{DBMetadata: db.DBMetadata}
+	size := ceilDiv(db.DBSize, numShards)
+
+	for lo := 0; lo < db.DBSize; lo += size {
+		hi := lo + size
+		if hi > db.DBSize {
+			hi = db.DBSize
+		}
+
+		// slots are never modified in place (see UpdateSlot) so they are shared
+		stripe := NewDatabase()
+		stripe.SlotBytes = db.SlotBytes
+		stripe.DBSize = hi - lo
+		stripe.Slots = append([]*Slot{}, db.Slots[lo:hi]...)
+		if db.Attributes != nil {
+			stripe.Attributes = append([]uint64{}, db.Attributes[lo:hi]...)
+		}
+
+		sdb.Shards = append(sdb.Shards, &Shard{
+			DBMetadata: db.DBMetadata,
+			Offset:     lo,
+			Keywords:   db.Keywords,
+			db:         stripe,
+		})
+	}
+
+	return sdb, nil
+}
+
+// NumSlots returns the number of slots of the shard
+func (shard *Shard) NumSlots() int {
+	return shard.db.DBSize
+}
+
+// PrivateSecretSharedQuery returns the partial result of the slots of the shard
+// (see MergeSharedResults)
+func (shard *Shard) PrivateSecretSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if err := shard.checkSharedLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := shard.checkKeyDomain(query); err != nil {
+		return nil, err
+	}
+
+	if err := shard.checkKeywordLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := shard.db.checkAttributeMask(query.AttributeMask); err != nil {
+		return nil, err
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	dimWidth := query.GroupSize
+	lo, hi := shard.Offset, shard.Offset+shard.db.DBSize
+
+	// rows overlapping the stripe
+	rowStart, rowEnd := lo/dimWidth, ceilDiv(hi, dimWidth)
+
+	numBits := shard.sharedQueryDomainBits(query.GroupSize, query.IsKeywordBased)
+	pf := dpf.ServerInitialize(query.PrfKeys, numBits)
+
+	bits := make([]bool, rowEnd-rowStart)
+	if err := expandSharedRows(pf, query, shard.Keywords, rowStart, bits, nprocs); err != nil {
+		return nil, err
+	}
+
+	partial := make([][]*Slot, nprocs)
+	for w := range partial {
+		partial[w] = make([]*Slot, dimWidth)
+		for col := range partial[w] {
+			partial[w][col] = NewEmptySlot(shard.SlotBytes)
+		}
+	}
+
+	err := parallelRanges(context.Background(), len(bits), nprocs, func(w, start, end int) error {
+		for r := start; r < end; r++ {
+			shard.forEachSlotOfRow(rowStart+r, dimWidth, query.AttributeMask, func(col int, slot *Slot) {
+				ConditionalXorSlots(partial[w][col], slot, bits[r])
+			})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := partial[0]
+	for w := 1; w < nprocs; w++ {
+		for col := range results {
+			XorSlots(results[col], partial[w][col])
+		}
+	}
+
+	return &SecretSharedQueryResult{shard.SlotBytes, results}, nil
+}
+
+// PrivateEncryptedQuery returns the partial result of the slots of the shard
+// (see MergeEncryptedResults)
+func (shard *Shard) PrivateEncryptedQuery(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	if err := shard.checkEncryptedLayout(query); err != nil {
+		return nil, err
+	}
+
+	if query.IsKeywordBased {
+		return nil, ErrNotKeywordLayer
+	}
+
+	if err := shard.db.checkAttributeMask(query.AttributeMask); err != nil {
+		return nil, err
+	}
+
+	dimWidth := query.DBWidth
+	lo, hi := shard.Offset, shard.Offset+shard.db.DBSize
+
+	if dimWidth <= 0 || query.DBWidth*query.DBHeight < shard.DBSize || len(query.EBits) < query.DBHeight {
+		return nil, errors.New("query dimensions do not cover the database")
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	// rows overlapping the stripe
+	rowStart, rowEnd := lo/dimWidth, ceilDiv(hi, dimWidth)
+
+	params := shard.db.paramsForPublicKey(query.Pk)
+	numCiphertextsPerSlot := params.numCiphertextsPerSlot
+
+	slotRes := make([][]*EncryptedSlot, nprocs)
+	procBytesPerCiphertext := make([]int, nprocs)
+
+	for w := range slotRes {
+		slotRes[w] = make([]*EncryptedSlot, dimWidth)
+		for col := range slotRes[w] {
+			slotRes[w][col] = &EncryptedSlot{Cts: make([]*paillier.Ciphertext, numCiphertextsPerSlot)}
+			for j := range slotRes[w][col].Cts {
+				slotRes[w][col].Cts[j] = params.nullLevelOne
+			}
+		}
+	}
+
+	err := parallelRanges(context.Background(), rowEnd-rowStart, nprocs, func(w, start, end int) error {
+		for r := rowStart + start; r < rowStart+end; r++ {
+			var err error
+			shard.forEachSlotOfRow(r, dimWidth, query.AttributeMask, func(col int, slot *Slot) {
+				intArr, numBytesPerInt, convErr := slot.ToGmpIntArray(numCiphertextsPerSlot)
+				if convErr != nil {
+					err = convErr
+					return
+				}
+				procBytesPerCiphertext[w] = numBytesPerInt
+
+				for j, val := range intArr {
+					sel := query.Pk.ConstMult(query.EBits[r], val)
+					slotRes[w][col].Cts[j] = query.Pk.Add(slotRes[w][col].Cts[j], sel)
+				}
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	numBytesPerCiphertext := 0
+	for _, n := range procBytesPerCiphertext {
+		if n != 0 {
+			numBytesPerCiphertext = n
+			break
+		}
+	}
+
+	slots := slotRes[0]
+	for w := 1; w < nprocs; w++ {
+		for col := range slots {
+			addEncryptedSlots(query.Pk, slots[col], slotRes[w][col])
+		}
+	}
+
+	return &EncryptedQueryResult{
+		Pk:                    query.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(query.Pk),
+		Slots:                 slots,
+		NumBytesPerCiphertext: numBytesPerCiphertext,
+		SlotBytes:             shard.SlotBytes,
+	}, nil
+}
+
+// forEachSlotOfRow calls fn with the column and slot of each slot of the row (of the
+// whole database viewed as a dimWidth-wide grid) held by the shard and matching the mask
+func (shard *Shard) forEachSlotOfRow(row, dimWidth int, mask uint64, fn func(col int, slot *Slot)) {
+
+	lo, hi := shard.Offset, shard.Offset+shard.db.DBSize
+
+	for col := 0; col < dimWidth; col++ {
+		index := row*dimWidth + col
+		if index < lo {
+			continue
+		}
+		if index >= hi {
+			break
+		}
+
+		if shard.db.matchesAttributes(index-lo, mask) {
+			fn(col, shard.db.Slots[index-lo])
+		}
+	}
+}
+
+// checkKeywordLayout returns a KeywordMismatchError if the keyword query share was
+// generated for different keywords (see Database.checkKeywordLayout)
+func (shard *Shard) checkKeywordLayout(query *QueryShare) error {
+
+	if !query.IsKeywordBased {
+		return nil
+	}
+
+	if shard.Keywords == nil || len(shard.Keywords) < ceilDiv(shard.DBSize, query.GroupSize) {
+		return &KeywordMismatchError{Expected: query.KeywordDigest}
+	}
+
+	if len(query.KeywordDigest) > 0 && !bytes.Equal(query.KeywordDigest, shard.KeywordDigest) {
+		return &KeywordMismatchError{Expected: query.KeywordDigest, Actual: shard.KeywordDigest}
+	}
+
+	return nil
+}
+
+// PrivateSecretSharedQuery answers the query share on every shard and merges the partial results
+func (sdb *ShardedDatabase) PrivateSecretSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+
+	partials := make([]*SecretSharedQueryResult, len(sdb.Shards))
+
+	err := sdb.forEachShard(nprocs, func(i, shardProcs int) error {
+		res, err := sdb.Shards[i].PrivateSecretSharedQuery(query, shardProcs)
+		partials[i] = res
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return MergeSharedResults(partials)
+}
+
+// PrivateEncryptedQuery answers the encrypted query on every shard and merges the partial results
+func (sdb *ShardedDatabase) PrivateEncryptedQuery(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	partials := make([]*EncryptedQueryResult, len(sdb.Shards))
+
+	err := sdb.forEachShard(nprocs, func(i, shardProcs int) error {
+		res, err := sdb.Shards[i].PrivateEncryptedQuery(query, shardProcs)
+		partials[i] = res
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return MergeEncryptedResults(partials)
+}
+
+// forEachShard runs fn on the shards concurrently, splitting nprocs among them.
+// Returns the error of the first shard that failed
+func (sdb *ShardedDatabase) forEachShard(nprocs int, fn func(i, shardProcs int) error) error {
+
+	shardProcs := nprocs / len(sdb.Shards)
+	if shardProcs < 1 {
+		shardProcs = 1
+	}
+
+	workers := newWorkerGroup(context.Background())
+	for i := range sdb.Shards {
+		i := i
+		workers.Go(i, func() error {
+			return fn(i, shardProcs)
+		})
+	}
+
+	err := workers.Wait()
+
+	// report the error of the shard rather than the worker
+	var workerErr *WorkerError
+	if errors.As(err, &workerErr) {
+		return workerErr.Err
+	}
+
+	return err
+}
+
+// MergeSharedResults combines the partial results of the shards of a database into the
+// result of the database
+func MergeSharedResults(partials []*SecretSharedQueryResult) (*SecretSharedQueryResult, error) {
+
+	if len(partials) == 0 {
+		return nil, errors.New("no partial results")
+	}
+
+	first := partials[0]
+	res := &SecretSharedQueryResult{SlotBytes: first.SlotBytes, Shares: make([]*Slot, len(first.Shares))}
+	for col := range res.Shares {
+		res.Shares[col] = NewEmptySlot(first.SlotBytes)
+	}
+
+	for i, partial := range partials {
+		if partial.SlotBytes != first.SlotBytes || len(partial.Shares) != len(first.Shares) {
+			return nil, &RecoveryShapeError{Share: i, Reason: "partial result has a different shape"}
+		}
+		for col, share := range partial.Shares {
+			XorSlots(res.Shares[col], share)
+		}
+	}
+
+	return res, nil
+}
+
+// MergeEncryptedResults combines the partial results of the shards of a database into the
+// result of the database
+func MergeEncryptedResults(partials []*EncryptedQueryResult) (*EncryptedQueryResult, error) {
+
+	if len(partials) == 0 {
+		return nil, errors.New("no partial results")
+	}
+
+	first := partials[0]
+	res := &EncryptedQueryResult{
+		Pk:             first.Pk,
+		Slots:          make([]*EncryptedSlot, len(first.Slots)),
+		SlotBytes:      first.SlotBytes,
+		KeyFingerprint: first.KeyFingerprint,
+	}
+
+	for col, slot := range first.Slots {
+		res.Slots[col] = &EncryptedSlot{Cts: append([]*paillier.Ciphertext{}, slot.Cts...)}
+	}
+
+	for i, partial := range partials {
+		if partial.SlotBytes != first.SlotBytes || len(partial.Slots) != len(first.Slots) {
+			return nil, &RecoveryShapeError{Share: i, Reason: "partial result has a different shape"}
+		}
+
+		if res.NumBytesPerCiphertext == 0 {
+			res.NumBytesPerCiphertext = partial.NumBytesPerCiphertext
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		for col, slot := range partial.Slots {
+			if len(slot.Cts) != len(res.Slots[col].Cts) {
+				return nil, &RecoveryShapeError{Share: i, Reason: "partial result has a different number of ciphertexts"}
+			}
+			addEncryptedSlots(res.Pk, res.Slots[col], slot)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,65 @@
+package pir
+
+import (
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestShardedDatabase' to see log outputs.
+func TestShardedDatabase(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize+5, SlotBytes)
+	md := db.Metadata()
+
+	// shards whose boundaries split rows
+	sdb, err := db.Split(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, shard := range sdb.Shards {
+		total += shard.NumSlots()
+	}
+	if len(sdb.Shards) != 3 || total != db.DBSize {
+		t.Fatalf("Split into %v shards of %v slots\n", len(sdb.Shards), total)
+	}
+
+	for _, groupSize := range []int{1, 3, 8} {
+		for _, index := range []int{0, db.DBSize / 3, db.DBSize - 1} {
+			row, pos := md.GroupPosition(index, groupSize)
+			shares := md.NewIndexQueryShares(row, groupSize, 2)
+
+			res := make([]*SecretSharedQueryResult, len(shares))
+			for i, share := range shares {
+				if res[i], err = sdb.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if slot := Recover(res)[pos]; !slot.Equal(db.Slots[index]) {
+				t.Fatalf("Incorrect slot %v (group size %v)\n", index, groupSize)
+			}
+		}
+	}
+
+	sk, pk := paillier.KeyGen(128)
+	query := db.NewEncryptedQuery(pk, 1, 2)
+
+	res, err := sdb.PrivateEncryptedQuery(query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for j, slot := range recoverEncrypted(t, res, sk) {
+		if index := 2*query.DBWidth + j; index < db.DBSize && !slot.Equal(db.Slots[index]) {
+			t.Fatalf("Incorrect result for slot %v\n", index)
+		}
+	}
+
+	if _, err := db.Split(0); err == nil {
+		t.Fatalf("Split into no shards\n")
+	}
+}
@@ -0,0 +1,299 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"strings"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Deterministic protocol simulation.
+ Simulate runs randomized end-to-end retrievals across the implemented
+ schemes, group sizes and layouts and summarizes the retrievals whose
+ recovered slots do not match the database. The workload is derived
+ from the seed of the configuration: the databases (size, slot size,
+ contents, padding and whether groups are shuffled), the scheme, group
+ size, key variant or layout of each database and the groups retrieved,
+ so a failing seed replays the same workload. The keys and ciphertexts
+ of the queries are generated with fresh randomness as in production.
+ Queries go through the scheme dispatcher (see AnswerSharedQuery and
+ AnswerEncryptedQuery) and the recovery routines of the client, so the
+ simulation doubles as an acceptance test of a build environment (e.g.,
+ the AES and big integer implementations of the platform).
+*/
+
+// ErrSimulationMismatch is matched (using errors.Is) by the error returned by
+// SimulationReport.Err when retrievals recovered incorrect slots
+var ErrSimulationMismatch = errors.New("simulated retrievals recovered incorrect slots")
+
+// DefaultSimulationSeed is the seed used when the configuration does not set one
+const DefaultSimulationSeed = 1
+
+// maxReportedMismatches is the number of mismatches kept in a simulation report
+const maxReportedMismatches = 32
+
+// SimulationConfig configures a simulation (zero values use the defaults)
+type SimulationConfig struct {
+	Seed               int64    // seed of the workload (DefaultSimulationSeed if zero)
+	Retrievals         int      // number of retrievals (1000 if zero)
+	RetrievalsPerDB    int      // retrievals from each generated database (16 if zero)
+	MaxDBSize          int      // databases have 1 to MaxDBSize slots (256 if zero)
+	MaxSlotBytes       int      // slots have 1 to MaxSlotBytes bytes (32 if zero)
+	Schemes            []Scheme // schemes to simulate (ImplementedSchemes if empty)
+	GroupSizes         []int    // group sizes to simulate (1, 2, 3, 4 and 8 if empty)
+	KeyBits            int      // size of the Paillier keys (SchemeCheckKeyBits if zero)
+	NumProcsForQueries int      // goroutines answering each query (1 if zero)
+}
+
+// SimulationMismatch describes a retrieval that recovered incorrect slots
+// (or whose query was rejected)
+type SimulationMismatch struct {
+	Database  int // number of the generated database (in order of generation)
+	Scheme    Scheme
+	GroupSize int
+	Query     string // key variant or layout of the query
+	DBSize    int
+	SlotBytes int
+	Shuffled  bool // groups are shuffled (see ShuffleWithinGroups)
+	Row       int  // group (secret shared queries) or row (encrypted queries) retrieved
+	Indices   []int
+	Err       error
+}
+
+func (m *SimulationMismatch) String() string {
+
+	s := fmt.Sprintf("database %v (%v slots of %v bytes, shuffled: %v): %q group size %v, %v, row %v",
+		m.Database, m.DBSize, m.SlotBytes, m.Shuffled, m.Scheme, m.GroupSize, m.Query, m.Row)
+
+	if m.Err != nil {
+		return s + ": " + m.Err.Error()
+	}
+
+	return fmt.Sprintf("%v: incorrect slots at indices %v", s, m.Indices)
+}
+
+// SimulationReport summarizes a simulation
+type SimulationReport struct {
+	Seed          int64
+	Retrievals    int
+	Databases     int
+	ByScheme      map[Scheme]int // retrievals of each scheme
+	NumMismatches int
+	Mismatches    []*SimulationMismatch // the first mismatches (at most 32)
+}
+
+// Err returns an error matching ErrSimulationMismatch if any retrieval was incorrect
+func (r *SimulationReport) Err() error {
+
+	if r.NumMismatches == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %v of %v retrievals (seed %v), first: %v",
+		ErrSimulationMismatch, r.NumMismatches, r.Retrievals, r.Seed, r.Mismatches[0])
+}
+
+func (r *SimulationReport) String() string {
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "seed %v: %v retrievals from %v databases, %v mismatches\n",
+		r.Seed, r.Retrievals, r.Databases, r.NumMismatches)
+
+	for _, scheme := range ImplementedSchemes {
+		if n, ok := r.ByScheme[scheme]; ok {
+			fmt.Fprintf(&b, "  %v: %v retrievals\n", scheme, n)
+		}
+	}
+
+	for _, m := range r.Mismatches {
+		fmt.Fprintf(&b, "  %v\n", m)
+	}
+
+	return b.String()
+}
+
+// Simulate runs the retrievals of the configuration and returns the report.
+// Returns an error only if the configuration is invalid or a database cannot be
+// generated; incorrect retrievals are reported (see SimulationReport.Err)
+func Simulate(config SimulationConfig) (*SimulationReport, error) {
+
+	config, err := config.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	sim := &simulation{
+		config: config,
+		rand:   mrand.New(mrand.NewSource(config.Seed)),
+		report: &SimulationReport{Seed: config.Seed, ByScheme: make(map[Scheme]int)},
+	}
+
+	for _, scheme := range config.Schemes {
+		if scheme == SchemeAHEPaillierV1 {
+			sim.sk, sim.pk = paillier.KeyGen(config.KeyBits)
+		}
+	}
+
+	for sim.report.Retrievals < config.Retrievals {
+		if err := sim.runDatabase(); err != nil {
+			return nil, err
+		}
+	}
+
+	return sim.report, nil
+}
+
+// withDefaults returns the configuration with the defaults set
+func (config SimulationConfig) withDefaults() (SimulationConfig, error) {
+
+	if config.Seed == 0 {
+		config.Seed = DefaultSimulationSeed
+	}
+	if config.Retrievals <= 0 {
+		config.Retrievals = 1000
+	}
+	if config.RetrievalsPerDB <= 0 {
+		config.RetrievalsPerDB = 16
+	}
+	if config.MaxDBSize <= 0 {
+		config.MaxDBSize = 256
+	}
+	if config.MaxSlotBytes <= 0 {
+		config.MaxSlotBytes = 32
+	}
+	if len(config.Schemes) == 0 {
+		config.Schemes = ImplementedSchemes
+	}
+	if len(config.GroupSizes) == 0 {
+		config.GroupSizes = []int{1, 2, 3, 4, 8}
+	}
+	if config.KeyBits <= 0 {
+		config.KeyBits = SchemeCheckKeyBits
+	}
+	if config.NumProcsForQueries <= 0 {
+		config.NumProcsForQueries = 1
+	}
+
+	for _, scheme := range config.Schemes {
+		switch scheme {
+		case SchemeDPFv1, SchemeDPFv2EarlyTerm, SchemeAHEPaillierV1:
+		default:
+			return config, &UnsupportedSchemeError{Scheme: scheme, Supported: ImplementedSchemes}
+		}
+	}
+
+	for _, groupSize := range config.GroupSizes {
+		if groupSize < 1 {
+			return config, errors.New("group sizes must be positive")
+		}
+	}
+
+	return config, nil
+}
+
+type simulation struct {
+	config SimulationConfig
+	rand   *mrand.Rand
+	report *SimulationReport
+
+	sk *paillier.SecretKey
+	pk *paillier.PublicKey
+}
+
+// runDatabase generates a database and runs the retrievals of the database
+func (sim *simulation) runDatabase() error {
+
+	r := sim.rand
+	cfg := sim.config
+
+	dbSize := 1 + r.Intn(cfg.MaxDBSize)
+	slotBytes := 1 + r.Intn(cfg.MaxSlotBytes)
+	scheme := cfg.Schemes[r.Intn(len(cfg.Schemes))]
+	groupSize := cfg.GroupSizes[r.Intn(len(cfg.GroupSizes))]
+	shuffled := r.Intn(2) == 0
+
+	slots := make([]*Slot, dbSize)
+	for i := range slots {
+		data := make([]byte, slotBytes)
+		r.Read(data)
+		slots[i] = NewSlot(data)
+	}
+
+	db := NewDatabase()
+	if err := db.SwapIn(slots); err != nil {
+		return err
+	}
+
+	if r.Intn(4) == 0 {
+		db.NumPaddingSlots = r.Intn(dbSize)
+	}
+
+	if shuffled {
+		if err := db.ShuffleWithinGroups(groupSize); err != nil {
+			return err
+		}
+	}
+
+	c, err := db.newSchemeChecker(scheme, groupSize, cfg.NumProcsForQueries)
+	if err != nil {
+		return err
+	}
+
+	sim.report.Databases++
+	numGroups := ceilDiv(dbSize, groupSize)
+
+	for i := 0; i < cfg.RetrievalsPerDB && sim.report.Retrievals < cfg.Retrievals; i++ {
+		m := &SimulationMismatch{
+			Database:  sim.report.Databases - 1,
+			Scheme:    scheme,
+			GroupSize: groupSize,
+			DBSize:    dbSize,
+			SlotBytes: slotBytes,
+			Shuffled:  shuffled,
+		}
+
+		before := len(c.err.Indices)
+
+		switch scheme {
+		case SchemeDPFv1:
+			numShares := uint(2 + r.Intn(2))
+			m.Row = r.Intn(numGroups)
+			m.Query = fmt.Sprintf("%v shares", numShares)
+			m.Err = c.checkSharedRow(m.Row, c.sharedQuery(m.Row, numShares, KeyPayloadInLeaf, 0))
+		case SchemeDPFv2EarlyTerm:
+			variant, gamma := KeyFullDepth, uint(0)
+			m.Query = "full depth keys"
+			switch r.Intn(3) {
+			case 1:
+				variant, gamma = KeyEarlyTermination, uint(1+r.Intn(earlyTerminationCheckGamma))
+				m.Query = fmt.Sprintf("early termination keys (gamma %v)", gamma)
+			case 2:
+				variant = KeyAsymmetric
+				m.Query = "asymmetric keys"
+			}
+			m.Row = r.Intn(numGroups)
+			m.Err = c.checkSharedRow(m.Row, c.sharedQuery(m.Row, 2, variant, gamma))
+		case SchemeAHEPaillierV1:
+			c.layout = c.dbmd.LayoutForHeight(1+r.Intn(numGroups), groupSize)
+			m.Row = r.Intn(c.layout.Height)
+			m.Query = fmt.Sprintf("%vx%v layout", c.layout.Height, c.layout.Width)
+			m.Err = c.checkEncryptedRow(sim.sk, c.encryptedQuery(sim.pk, m.Row), m.Row)
+		}
+
+		sim.report.Retrievals++
+		sim.report.ByScheme[scheme]++
+
+		if m.Err != nil || len(c.err.Indices) > before {
+			m.Indices = append([]int{}, c.err.Indices[before:]...)
+			sim.report.NumMismatches++
+			if len(sim.report.Mismatches) < maxReportedMismatches {
+				sim.report.Mismatches = append(sim.report.Mismatches, m)
+			}
+		}
+	}
+
+	return nil
+}
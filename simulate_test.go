@@ -0,0 +1,61 @@
+package pir
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+
+	config := SimulationConfig{
+		Seed:         42,
+		Retrievals:   200,
+		MaxDBSize:    64,
+		MaxSlotBytes: 8,
+		KeyBits:      512,
+	}
+
+	report, err := Simulate(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Retrievals != config.Retrievals {
+		t.Fatalf("expected %v retrievals, got %v", config.Retrievals, report.Retrievals)
+	}
+
+	if err := report.Err(); err != nil {
+		t.Fatalf("%v\n%v", err, report)
+	}
+
+	for _, scheme := range ImplementedSchemes {
+		if report.ByScheme[scheme] == 0 {
+			t.Fatalf("no retrievals of %v", scheme)
+		}
+	}
+
+	// the workload is derived from the seed
+	again, err := Simulate(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.Databases != report.Databases || again.ByScheme[SchemeAHEPaillierV1] != report.ByScheme[SchemeAHEPaillierV1] {
+		t.Fatalf("simulations with the same seed ran different workloads")
+	}
+}
+
+func TestSimulateMismatch(t *testing.T) {
+
+	report := &SimulationReport{Seed: 1, Retrievals: 1, NumMismatches: 1,
+		Mismatches: []*SimulationMismatch{{Scheme: SchemeDPFv1, GroupSize: 1, Indices: []int{3}}}}
+
+	if err := report.Err(); !errors.Is(err, ErrSimulationMismatch) {
+		t.Fatalf("expected ErrSimulationMismatch, got %v", err)
+	}
+
+	var unsupported *UnsupportedSchemeError
+	if _, err := Simulate(SimulationConfig{Schemes: []Scheme{SchemeAHELWEv1}}); !errors.As(err, &unsupported) {
+		t.Fatalf("expected an unsupported scheme error, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package pir
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math"
@@ -10,6 +11,9 @@ import (
 	"github.com/ncw/gmp"
 )
 
+// LengthPrefixBytes is the size of the length prefix of length prefixed slots
+const LengthPrefixBytes = 4
+
 // Slot is a set of bytes which can be xor'ed and comapred
 type Slot struct {
 	Data []byte
@@ -58,6 +62,7 @@ func (slot *Slot) Compare(other *Slot) int {
 }
 
 // ToString converts slot data to a string
+// note: trailing zero bytes are removed; use LengthPrefixedData for binary data
 func (slot *Slot) ToString() string {
 	return string(removeTrailingZeros(slot.Data))
 }
@@ -144,6 +149,39 @@ func NewSlotFromString(s string, slotSize int) *Slot {
 	}
 }
 
+// NewLengthPrefixedSlot encodes b into a slot of slotSize bytes
+// prefixed with its length such that trailing zero bytes are preserved
+func NewLengthPrefixedSlot(b []byte, slotSize int) (*Slot, error) {
+
+	if len(b)+LengthPrefixBytes > slotSize {
+		return nil, errors.New("data does not fit in the slot")
+	}
+
+	data := make([]byte, slotSize)
+	binary.BigEndian.PutUint32(data, uint32(len(b)))
+	copy(data[LengthPrefixBytes:], b)
+
+	return NewSlot(data), nil
+}
+
+// LengthPrefixedData returns the data encoded by NewLengthPrefixedSlot
+func (slot *Slot) LengthPrefixedData() ([]byte, error) {
+
+	if len(slot.Data) < LengthPrefixBytes {
+		return nil, errors.New("slot is too small to be length prefixed")
+	}
+
+	n := int(binary.BigEndian.Uint32(slot.Data))
+	if n > len(slot.Data)-LengthPrefixBytes {
+		return nil, errors.New("invalid length prefix")
+	}
+
+	res := make([]byte, n)
+	copy(res, slot.Data[LengthPrefixBytes:])
+
+	return res, nil
+}
+
 // NewSlot returns a slot populated with data
 func NewSlot(b []byte) *Slot {
 	return &Slot{
@@ -185,6 +223,20 @@ func GetRequiredSlotSize(data []string) int {
 	return minBytes
 }
 
+// GetRequiredLengthPrefixedSlotSize returns the minimum number of
+// bytes required to represent each data point with a length prefix
+func GetRequiredLengthPrefixedSlotSize(data [][]byte) int {
+
+	minBytes := 0
+	for _, b := range data {
+		if len(b) > minBytes {
+			minBytes = len(b)
+		}
+	}
+
+	return minBytes + LengthPrefixBytes
+}
+
 func removeTrailingZeros(data []byte) []byte {
 
 	res := make([]byte, 0)
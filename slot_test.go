@@ -1,6 +1,7 @@
 package pir
 
 import (
+	"bytes"
 	srand "crypto/rand"
 	"math"
 	"math/rand"
@@ -16,6 +17,36 @@ func TestToFromString(t *testing.T) {
 	}
 }
 
+func TestLengthPrefixedSlot(t *testing.T) {
+
+	values := [][]byte{{}, {0}, {1, 0, 0}, {0, 0, 2, 0}}
+	slotSize := GetRequiredLengthPrefixedSlotSize(values)
+
+	for _, v := range values {
+		slot, err := NewLengthPrefixedSlot(v, slotSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := slot.LengthPrefixedData()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, v) {
+			t.Fatalf("Value did not round-trip. %v != %v\n", res, v)
+		}
+	}
+
+	if _, err := NewLengthPrefixedSlot(make([]byte, slotSize), slotSize); err == nil {
+		t.Fatalf("Did not throw error when data does not fit in the slot")
+	}
+
+	if _, err := NewSlot([]byte{0, 0, 0, 9, 1}).LengthPrefixedData(); err == nil {
+		t.Fatalf("Did not throw error on invalid length prefix")
+	}
+}
+
 func TestToFromBigIntArray(t *testing.T) {
 	setup()
 
@@ -0,0 +1,78 @@
+package pir
+
+import (
+	"time"
+)
+
+/*
+ Operator status.
+ Database.Status returns a snapshot of the state of a database for
+ dashboards: its epoch and layout, the schemes it answers and the hit
+ rate of the cache of values derived from the public keys of clients
+ (see publicKeyCache). Servers add their own counters to the snapshot
+ (see rpc.Server.Status). The snapshot is a plain struct of exported
+ fields so that it can be served as JSON (encoding/json) without
+ scraping logs. Like query traces, the status only holds aggregate
+ public values and nothing about individual clients.
+*/
+
+// DatabaseStatus is a snapshot of the state of a database (see Database.Status)
+type DatabaseStatus struct {
+	Time            time.Time // when the snapshot was taken
+	Epoch           int
+	DBSize          int
+	SlotBytes       int
+	NumPaddingSlots int
+	Layout          Layout // default layout of encrypted queries (see NewEncryptedQuery)
+	Schemes         []Scheme
+	PublicKeyCache  CacheStatus
+}
+
+// CacheStatus holds the size and hit rate of a cache
+type CacheStatus struct {
+	Entries int
+	Hits    uint64
+	Misses  uint64
+	HitRate float64 // hits over lookups (0 if there were none)
+}
+
+// Status returns a snapshot of the state of the database
+func (db *Database) Status() DatabaseStatus {
+
+	dbmd := db.Metadata()
+
+	return DatabaseStatus{
+		Time:            time.Now(),
+		Epoch:           dbmd.Epoch,
+		DBSize:          dbmd.DBSize,
+		SlotBytes:       dbmd.SlotBytes,
+		NumPaddingSlots: dbmd.NumPaddingSlots,
+		Layout:          dbmd.DefaultLayout(1),
+		Schemes:         db.SupportedSchemes(),
+		PublicKeyCache:  db.pkCache.status(),
+	}
+}
+
+// status returns the size and hit rate of the cache
+func (c *publicKeyCache) status() CacheStatus {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := 0
+	if c.order != nil {
+		entries = c.order.Len()
+	}
+
+	return newCacheStatus(entries, c.hits, c.misses)
+}
+
+func newCacheStatus(entries int, hits, misses uint64) CacheStatus {
+
+	status := CacheStatus{Entries: entries, Hits: hits, Misses: misses}
+	if hits+misses > 0 {
+		status.HitRate = float64(hits) / float64(hits+misses)
+	}
+
+	return status
+}
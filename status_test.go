@@ -0,0 +1,39 @@
+package pir
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestDatabaseStatus' to see log outputs.
+func TestDatabaseStatus(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	// the same public key twice hits the public key cache
+	_, pk := paillier.KeyGen(128)
+	db.paramsForPublicKey(pk)
+	db.paramsForPublicKey(pk)
+
+	status := db.Status()
+
+	if status.DBSize != TestDBSize || status.SlotBytes != SlotBytes || status.Epoch != db.Epoch {
+		t.Fatalf("Status does not describe the database: %+v\n", status)
+	}
+
+	if status.PublicKeyCache.Entries != 1 || status.PublicKeyCache.Hits != 1 ||
+		status.PublicKeyCache.Misses != 1 || status.PublicKeyCache.HitRate != 0.5 {
+		t.Fatalf("Invalid public key cache status: %+v\n", status.PublicKeyCache)
+	}
+
+	if len(status.Schemes) == 0 {
+		t.Fatalf("Status has no schemes\n")
+	}
+
+	if _, err := json.Marshal(status); err != nil {
+		t.Fatal(err)
+	}
+}
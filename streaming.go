@@ -0,0 +1,324 @@
+package pir
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Streaming databases.
+ A Database holds all its slots in memory. A StreamingDatabase reads the
+ slots from a SlotSource (e.g., a database file on disk; see
+ NewDBFileSlotSource) in chunks of ChunkSize slots while answering a
+ query and accumulates the XOR (or homomorphic sum) of the selected slots
+ chunk by chunk, so that only one chunk is in memory at a time. Every
+ query reads the whole source once, so queries are answered one at a time
+ and the throughput is bounded by the read bandwidth of the source. The
+ metadata (and the keywords, if any) are held in memory and queries are
+ checked like those of a Database.
+*/
+
+// DefaultStreamChunkSize is the number of slots read at a time by a StreamingDatabase
+const DefaultStreamChunkSize = 1 << 12
+
+// SlotSource iterates over the slots of a database in storage order (see Database.Slots)
+type SlotSource interface {
+	// Seek positions the source such that Next returns the slot at index
+	Seek(index int) error
+
+	// Next returns the next slot or io.EOF after the last slot.
+	// The slot is only valid until the next call to Next or Seek
+	Next() (*Slot, error)
+}
+
+// StreamingDatabase answers queries over the slots of a SlotSource
+// without holding them in memory
+type StreamingDatabase struct {
+	ChunkSize int // number of slots read at a time (DefaultStreamChunkSize if zero)
+
+	mu     sync.Mutex // held while reading the source
+	db     *Database  // metadata, keywords and caches (without slots)
+	source SlotSource
+}
+
+// NewStreamingDatabase returns a database answering queries over the slots of source
+// which has md.DBSize slots of md.SlotBytes bytes
+func NewStreamingDatabase(md DBMetadata, keywords []uint, source SlotSource) *StreamingDatabase {
+
+	db := NewDatabase()
+	db.DBMetadata = md
+	if keywords != nil {
+		db.setKeywords(keywords)
+	}
+
+	return &StreamingDatabase{db: db, source: source}
+}
+
+// Metadata returns the metadata of the database
+func (sdb *StreamingDatabase) Metadata() DBMetadata {
+	return sdb.db.DBMetadata
+}
+
+// PrivateSecretSharedQuery answers the query share (see Database.PrivateSecretSharedQuery)
+func (sdb *StreamingDatabase) PrivateSecretSharedQuery(query *QueryShare, nprocs int) (*SecretSharedQueryResult, error) {
+
+	db := sdb.db
+
+	if query.GroupSize <= 0 {
+		return nil, errors.New("invalid group size provided in query")
+	}
+
+	if err := db.checkSharedLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkKeyDomain(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkKeywordLayout(query); err != nil {
+		return nil, err
+	}
+
+	if err := db.checkAttributeMask(query.AttributeMask); err != nil {
+		return nil, err
+	}
+
+	bits, err := db.expandSharedQuery(query, nprocs)
+	if err != nil {
+		return nil, err
+	}
+
+	dimWidth := query.GroupSize
+
+	results := make([]*Slot, dimWidth)
+	for col := range results {
+		results[col] = NewEmptySlot(db.SlotBytes)
+	}
+
+	err = sdb.scan(func(start int, chunk []*Slot) error {
+		for i, slot := range chunk {
+			index := start + i
+			ConditionalXorSlots(results[index%dimWidth], slot, bits[index/dimWidth])
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretSharedQueryResult{db.SlotBytes, results}, nil
+}
+
+// PrivateEncryptedQuery answers the encrypted query (see Database.PrivateEncryptedQuery).
+// Each chunk is split among nprocs workers
+func (sdb *StreamingDatabase) PrivateEncryptedQuery(query *EncryptedQuery, nprocs int) (*EncryptedQueryResult, error) {
+
+	db := sdb.db
+
+	if err := db.checkEncryptedQuery(query); err != nil {
+		return nil, err
+	}
+
+	// every slot of the source is read
+	if query.DBWidth <= 0 || query.DBWidth*len(query.EBits) < db.DBSize {
+		return nil, errors.New("query dimensions do not cover the database")
+	}
+
+	if nprocs < 1 {
+		nprocs = 1
+	}
+
+	dimWidth := query.DBWidth
+	params := db.paramsForPublicKey(query.Pk)
+	numCiphertextsPerSlot := params.numCiphertextsPerSlot
+
+	// accumulated slots of each worker
+	slotRes := make([][]*EncryptedSlot, nprocs)
+	for i := range slotRes {
+		slotRes[i] = make([]*EncryptedSlot, dimWidth)
+		for col := range slotRes[i] {
+			slotRes[i][col] = &EncryptedSlot{Cts: make([]*paillier.Ciphertext, numCiphertextsPerSlot)}
+			for j := range slotRes[i][col].Cts {
+				slotRes[i][col].Cts[j] = params.nullLevelOne
+			}
+		}
+	}
+
+	numBytesPerCiphertext := 0
+	var numBytesMu sync.Mutex
+
+	err := sdb.scan(func(start int, chunk []*Slot) error {
+		return parallelRanges(context.Background(), len(chunk), nprocs, func(i, lo, hi int) error {
+			for k := lo; k < hi; k++ {
+				index := start + k
+				row, col := index/dimWidth, index%dimWidth
+
+				intArr, numBytesPerInt, err := chunk[k].ToGmpIntArray(numCiphertextsPerSlot)
+				if err != nil {
+					return err
+				}
+
+				numBytesMu.Lock()
+				if numBytesPerCiphertext == 0 {
+					numBytesPerCiphertext = numBytesPerInt
+				}
+				numBytesMu.Unlock()
+
+				for j, val := range intArr {
+					sel := query.Pk.ConstMult(query.EBits[row], val)
+					slotRes[i][col].Cts[j] = query.Pk.Add(slotRes[i][col].Cts[j], sel)
+				}
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	slots := slotRes[0]
+	for i := 1; i < nprocs; i++ {
+		for j := 0; j < dimWidth; j++ {
+			addEncryptedSlots(query.Pk, slots[j], slotRes[i][j])
+		}
+	}
+
+	return &EncryptedQueryResult{
+		Pk:                    query.Pk,
+		KeyFingerprint:        PublicKeyFingerprint(query.Pk),
+		Slots:                 slots,
+		NumBytesPerCiphertext: numBytesPerCiphertext,
+		SlotBytes:             db.SlotBytes,
+	}, nil
+}
+
+// scan reads the slots of the source in chunks and calls process with the index
+// of the first slot of each chunk. The slots of a chunk are copies that remain
+// valid during the call
+func (sdb *StreamingDatabase) scan(process func(start int, chunk []*Slot) error) error {
+
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+
+	if err := sdb.source.Seek(0); err != nil {
+		return err
+	}
+
+	chunkSize := sdb.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultStreamChunkSize
+	}
+
+	dbSize := sdb.db.DBSize
+	chunk := make([]*Slot, 0, chunkSize)
+
+	for start := 0; start < dbSize; start += len(chunk) {
+		chunk = chunk[:0]
+
+		for len(chunk) < chunkSize && start+len(chunk) < dbSize {
+			slot, err := sdb.source.Next()
+			if err == io.EOF {
+				return errors.New("slot source ended before the last slot")
+			} else if err != nil {
+				return err
+			}
+
+			if len(slot.Data) != sdb.db.SlotBytes {
+				return errors.New("slot source returned a slot of the wrong size")
+			}
+
+			data := make([]byte, len(slot.Data))
+			copy(data, slot.Data)
+			chunk = append(chunk, NewSlot(data))
+		}
+
+		if err := process(start, chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DBFileSlotSource reads the slots of a database file (see LoadDatabase)
+type DBFileSlotSource struct {
+	md   DBMetadata
+	r    io.ReadSeeker
+	br   *bufio.Reader
+	next int
+	slot *Slot
+}
+
+// NewDBFileSlotSource reads the header of the database file and returns a source
+// for its slots. The metadata of the database is returned by Metadata
+func NewDBFileSlotSource(r io.ReadSeeker) (*DBFileSlotSource, error) {
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	slotBytes, dbSize, numPadding, err := readDBFileHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &DBFileSlotSource{
+		md: DBMetadata{
+			SlotBytes:       slotBytes,
+			DBSize:          dbSize,
+			NumPaddingSlots: numPadding,
+		},
+		r:    r,
+		br:   bufio.NewReader(r),
+		slot: NewEmptySlot(slotBytes),
+	}
+
+	return src, nil
+}
+
+// Metadata returns the metadata of the database stored in the file
+func (src *DBFileSlotSource) Metadata() DBMetadata {
+	return src.md
+}
+
+// Seek positions the source such that Next returns the slot at index
+func (src *DBFileSlotSource) Seek(index int) error {
+
+	if index < 0 || index > src.md.DBSize {
+		return errors.New("index out of range")
+	}
+
+	offset := int64(dbFileHeaderBytes) + int64(index)*int64(src.md.SlotBytes)
+	if _, err := src.r.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	src.br.Reset(src.r)
+	src.next = index
+
+	return nil
+}
+
+// Next returns the next slot of the file or io.EOF after the last slot
+func (src *DBFileSlotSource) Next() (*Slot, error) {
+
+	if src.next >= src.md.DBSize {
+		return nil, io.EOF
+	}
+
+	if _, err := io.ReadFull(src.br, src.slot.Data); err != nil {
+		return nil, ErrInvalidDBFile
+	}
+
+	src.next++
+
+	return src.slot, nil
+}
@@ -0,0 +1,116 @@
+package pir
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// newTestStreamingDatabase returns a streaming database reading the database file of db
+func newTestStreamingDatabase(t *testing.T, db *Database) *StreamingDatabase {
+
+	var buf bytes.Buffer
+	if err := db.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewDBFileSlotSource(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sdb := NewStreamingDatabase(src.Metadata(), db.Keywords, src)
+	sdb.ChunkSize = 7 // chunks do not align with the rows
+
+	return sdb
+}
+
+// run with 'go test -v -run TestStreamingSharedQuery' to see log outputs.
+func TestStreamingSharedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	sdb := newTestStreamingDatabase(t, db)
+	md := sdb.Metadata()
+
+	for _, groupSize := range []int{1, 3, 8} {
+		for _, numShares := range []uint{2, 3} {
+			index := rand.Intn(TestDBSize)
+			row, pos := md.GroupPosition(index, groupSize)
+			shares := md.NewIndexQueryShares(row, groupSize, numShares)
+
+			results := make([]*SecretSharedQueryResult, numShares)
+			for s := range shares {
+				var err error
+				if results[s], err = sdb.PrivateSecretSharedQuery(shares[s], NumProcsForQuery); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if slot := Recover(results)[pos]; !slot.Equal(db.Slots[index]) {
+				t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[index], slot)
+			}
+		}
+	}
+
+	// keyword queries use the keywords held in memory
+	keywords := make([]uint, TestDBSize)
+	for i := range keywords {
+		keywords[i] = uint(rand.Uint32())
+	}
+	db.SetKeywords(keywords)
+	sdb = newTestStreamingDatabase(t, db)
+	md = sdb.Metadata()
+
+	shares := md.NewKeywordQueryShares(int(keywords[5]), 1, 2)
+	resA, err := sdb.PrivateSecretSharedQuery(shares[0], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resB, err := sdb.PrivateSecretSharedQuery(shares[1], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if slot := Recover([]*SecretSharedQueryResult{resA, resB})[0]; !slot.Equal(db.Slots[5]) {
+		t.Fatalf("Keyword query result is incorrect. %v != %v\n", db.Slots[5], slot)
+	}
+}
+
+// run with 'go test -v -run TestStreamingEncryptedQuery' to see log outputs.
+func TestStreamingEncryptedQuery(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	sdb := newTestStreamingDatabase(t, db)
+	md := sdb.Metadata()
+
+	for _, groupSize := range []int{1, 3} {
+		width, height := md.GetDimentionsForDatabase(TestDBHeight, groupSize)
+		row := rand.Intn(height)
+
+		query := md.NewEncryptedQuery(pk, groupSize, row)
+		res, err := sdb.PrivateEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slots := recoverEncrypted(t, res, sk)
+		expectedSlots := recoverEncrypted(t, expected, sk)
+
+		for j := 0; j < width && row*width+j < TestDBSize; j++ {
+			if !slots[j].Equal(db.Slots[row*width+j]) || !slots[j].Equal(expectedSlots[j]) {
+				t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[row*width+j], slots[j])
+			}
+		}
+	}
+}
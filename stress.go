@@ -0,0 +1,201 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Concurrent scheme checks.
+ StressCheckScheme runs the checks of CheckScheme from several goroutines
+ at once. Every worker answers the same queries, so the servers expand
+ the same DPF keys concurrently (sharing the scratch of dpf), and the
+ slots of the database can be rewritten (with their own contents) while
+ the queries are answered. Run under 'go test -race' to catch data races
+ introduced as the query paths evolve. Goroutines still running once the
+ check returns (and the database settles) are reported as leaks.
+*/
+
+// DefaultLeakTimeout is the default time allowed for the goroutines of a stress check to exit
+const DefaultLeakTimeout = 2 * time.Second
+
+// ErrGoroutineLeak is returned by StressCheckScheme when goroutines started
+// by the check are still running after the leak timeout
+var ErrGoroutineLeak = errors.New("goroutines leaked")
+
+// StressOptions configures StressCheckScheme
+type StressOptions struct {
+	Workers     int           // goroutines answering queries concurrently (runtime.GOMAXPROCS(0) if zero)
+	Rounds      int           // times each worker answers every query (1 if zero)
+	Mutate      bool          // rewrite the slots of the database while queries are answered
+	LeakTimeout time.Duration // time allowed for goroutines to exit (DefaultLeakTimeout if zero)
+}
+
+// StressCheckScheme is CheckScheme with every query answered concurrently by opts.Workers
+// goroutines. Returns a *SchemeCheckError listing the incorrect indices, or an error
+// matching ErrGoroutineLeak if goroutines outlive the check. Other goroutines of the
+// process must be idle for the leak check to be meaningful
+func (db *Database) StressCheckScheme(scheme Scheme, groupSize, nprocs int, opts StressOptions) error {
+
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0)
+	}
+	if opts.Rounds <= 0 {
+		opts.Rounds = 1
+	}
+	if opts.LeakTimeout <= 0 {
+		opts.LeakTimeout = DefaultLeakTimeout
+	}
+
+	before := runtime.NumGoroutine()
+
+	err := db.stressCheckScheme(scheme, groupSize, nprocs, opts)
+	if err != nil {
+		return err
+	}
+
+	return waitForGoroutines(before, opts.LeakTimeout)
+}
+
+func (db *Database) stressCheckScheme(scheme Scheme, groupSize, nprocs int, opts StressOptions) error {
+
+	c, err := db.newSchemeChecker(scheme, groupSize, nprocs)
+	if err != nil {
+		return err
+	}
+
+	// queries are generated once so that every worker answers the same keys
+	var checks []func() error
+	switch scheme {
+	case SchemeDPFv1:
+		checks = append(c.sharedChecks(2, KeyPayloadInLeaf, 0), c.sharedChecks(3, KeyPayloadInLeaf, 0)...)
+	case SchemeDPFv2EarlyTerm:
+		checks = c.sharedChecks(2, KeyFullDepth, 0)
+		checks = append(checks, c.sharedChecks(2, KeyEarlyTermination, earlyTerminationCheckGamma)...)
+		checks = append(checks, c.sharedChecks(2, KeyAsymmetric, 0)...)
+	case SchemeAHEPaillierV1:
+		checks = c.encryptedChecks()
+	}
+
+	done := make(chan struct{})
+	var mutator sync.WaitGroup
+	if opts.Mutate {
+		mutator.Add(1)
+		go func() {
+			defer mutator.Done()
+			for pos := 0; ; pos++ {
+				select {
+				case <-done:
+					return
+				default:
+					db.rewriteSlot(pos)
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for round := 0; round < opts.Rounds; round++ {
+				// workers start at different queries so that they overlap
+				for i := range checks {
+					if err := checks[(w+i)%len(checks)](); err != nil {
+						once.Do(func() { firstErr = err })
+						return
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(done)
+	mutator.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return c.result()
+}
+
+// sharedChecks returns a check per group answering secret shared queries with the given keys
+func (c *schemeChecker) sharedChecks(numShares uint, variant KeyVariant, gamma uint) []func() error {
+
+	numGroups := ceilDiv(c.dbmd.DBSize, c.groupSize)
+
+	checks := make([]func() error, numGroups)
+	for row := range checks {
+		row, shares := row, c.sharedQuery(row, numShares, variant, gamma)
+		checks[row] = func() error { return c.checkSharedRow(row, shares) }
+	}
+
+	return checks
+}
+
+// encryptedChecks returns a check per row of the square-root layout answering encrypted queries
+func (c *schemeChecker) encryptedChecks() []func() error {
+
+	sk, pk := paillier.KeyGen(SchemeCheckKeyBits)
+
+	_, height := c.encryptedDimensions()
+
+	checks := make([]func() error, height)
+	for row := range checks {
+		row, query := row, c.encryptedQuery(pk, row)
+		checks[row] = func() error { return c.checkEncryptedRow(sk, query, row) }
+	}
+
+	return checks
+}
+
+// rewriteSlot replaces the slot stored at position pos (modulo the number of slots)
+// with a copy of itself, the way UpdateSlot replaces slots
+func (db *Database) rewriteSlot(pos int) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if len(db.Slots) == 0 {
+		return
+	}
+
+	pos %= len(db.Slots)
+	data := make([]byte, len(db.Slots[pos].Data))
+	copy(data, db.Slots[pos].Data)
+
+	slots := make([]*Slot, len(db.Slots))
+	copy(slots, db.Slots)
+	slots[pos] = NewSlot(data)
+	db.Slots = slots
+}
+
+// waitForGoroutines waits until at most n goroutines are running
+func waitForGoroutines(n int, timeout time.Duration) error {
+
+	deadline := time.Now().Add(timeout)
+	for {
+		running := runtime.NumGoroutine()
+		if running <= n {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %v goroutines running after %v (%v before the check)",
+				ErrGoroutineLeak, running, timeout, n)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
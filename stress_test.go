@@ -0,0 +1,44 @@
+package pir
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// run with 'go test -race -run TestStressCheckScheme' to check the query paths for data races.
+func TestStressCheckScheme(t *testing.T) {
+	setup()
+
+	defer func(bits int) { SchemeCheckKeyBits = bits }(SchemeCheckKeyBits)
+	SchemeCheckKeyBits = 128
+
+	db := GenerateRandomDB(37, SlotBytes)
+
+	opts := StressOptions{Workers: 4, Rounds: 2, Mutate: true}
+	for _, groupSize := range []int{1, 4} {
+		for _, scheme := range ImplementedSchemes {
+			if err := db.StressCheckScheme(scheme, groupSize, NumProcsForQuery, opts); err != nil {
+				t.Fatalf("Stress check failed (group size %v): %v\n", groupSize, err)
+			}
+		}
+	}
+
+	if err := db.StressCheckScheme(SchemeAHELWEv1, 1, 1, opts); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Fatalf("Expected an unsupported scheme error, got %v\n", err)
+	}
+}
+
+func TestWaitForGoroutines(t *testing.T) {
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	n := runtime.NumGoroutine()
+	go func() { <-stop }()
+
+	if err := waitForGoroutines(n, 20*time.Millisecond); !errors.Is(err, ErrGoroutineLeak) {
+		t.Fatalf("Expected a goroutine leak error, got %v\n", err)
+	}
+}
@@ -11,6 +11,6 @@ const MinGroupSize = 1
 const MaxGroupSize = 5
 const SlotBytes = 3
 const SlotBytesStep = 5
-const NumProcsForQuery = 4         // number of parallel processors
-const NumQueries = 50              // number of queries to run
-const StatisticalSecurityBytes = 8 // 8 bytes of stat sec
+const NumProcsForQuery = 4 // number of parallel processors
+const NumQueries = 50      // number of queries to run
+const StatisticalSecurityBytes = DefaultStatisticalSecurityBytes
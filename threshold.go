@@ -0,0 +1,220 @@
+package pir
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/ncw/gmp"
+	"github.com/sachaservan/paillier"
+)
+
+/*
+ Threshold decryption of encrypted query results.
+ The client's Paillier secret key is Shamir shared among custodians
+ (Shoup-style, over the integers modulo N*lambda) such that any threshold of
+ them can jointly decrypt a response while fewer learn nothing about it.
+ The client deals the shares and should discard its secret key afterwards.
+*/
+
+// ThresholdKeyShare is the share of a Paillier secret key held by one custodian
+type ThresholdKeyShare struct {
+	Index      int // evaluation point of the share (1...NumParties)
+	Share      *gmp.Int
+	Pk         *paillier.PublicKey
+	Threshold  int
+	NumParties int
+}
+
+// PartialDecryption is a custodian's partial decryption of an encrypted query result
+type PartialDecryption struct {
+	Index      int
+	Threshold  int
+	NumParties int
+	Slots      [][]*gmp.Int // one partial decryption per ciphertext of each slot
+}
+
+// NewThresholdKeyShares shares the secret key among numParties custodians
+// such that any threshold of them can decrypt
+func NewThresholdKeyShares(sk *paillier.SecretKey, threshold, numParties int) ([]*ThresholdKeyShare, error) {
+
+	if threshold < 1 || threshold > numParties {
+		return nil, errors.New("threshold must be between 1 and the number of parties")
+	}
+
+	n := sk.PublicKey.N
+	if new(gmp.Int).Mod(thresholdDelta(numParties), n).Sign() == 0 {
+		return nil, errors.New("too many parties for the public key")
+	}
+
+	// the exponent group of Z*_{N^2} has order dividing N*lambda
+	order := new(gmp.Int).Mul(n, sk.Lambda)
+
+	// d = 0 mod lambda and d = 1 mod N so that c^d = 1 + mN
+	d := new(gmp.Int).ModInverse(sk.Lambda, n)
+	if d == nil {
+		return nil, errors.New("invalid secret key")
+	}
+	d.Mul(d, sk.Lambda)
+
+	// random polynomial of degree threshold-1 with f(0) = d
+	coeffs := make([]*gmp.Int, threshold)
+	coeffs[0] = d
+	for i := 1; i < threshold; i++ {
+		c, err := thresholdRandomInt(order)
+		if err != nil {
+			return nil, err
+		}
+		coeffs[i] = c
+	}
+
+	shares := make([]*ThresholdKeyShare, numParties)
+	for i := range shares {
+		x := gmp.NewInt(int64(i + 1))
+		share := new(gmp.Int)
+		for j := threshold - 1; j >= 0; j-- {
+			share.Mul(share, x)
+			share.Add(share, coeffs[j])
+			share.Mod(share, order)
+		}
+
+		shares[i] = &ThresholdKeyShare{
+			Index:      i + 1,
+			Share:      share,
+			Pk:         &sk.PublicKey,
+			Threshold:  threshold,
+			NumParties: numParties,
+		}
+	}
+
+	return shares, nil
+}
+
+// PartialDecrypt computes the custodian's partial decryption of the result
+func (ks *ThresholdKeyShare) PartialDecrypt(res *EncryptedQueryResult) *PartialDecryption {
+
+	n2 := new(gmp.Int).Mul(ks.Pk.N, ks.Pk.N)
+
+	slots := make([][]*gmp.Int, len(res.Slots))
+	for i, eslot := range res.Slots {
+		slots[i] = make([]*gmp.Int, len(eslot.Cts))
+		for j, ct := range eslot.Cts {
+			slots[i][j] = new(gmp.Int).Exp(ct.C, ks.Share, n2)
+		}
+	}
+
+	return &PartialDecryption{
+		Index:      ks.Index,
+		Threshold:  ks.Threshold,
+		NumParties: ks.NumParties,
+		Slots:      slots,
+	}
+}
+
+// RecoverEncryptedThreshold combines at least threshold partial decryptions
+// (from distinct custodians) of the result and returns the slots
+func RecoverEncryptedThreshold(res *EncryptedQueryResult, partials []*PartialDecryption) ([]*Slot, error) {
+
+	if len(partials) == 0 || len(partials) < partials[0].Threshold {
+		return nil, errors.New("not enough partial decryptions")
+	}
+
+	threshold := partials[0].Threshold
+	numParties := partials[0].NumParties
+	partials = partials[:threshold]
+
+	indices := make([]int, threshold)
+	for i, p := range partials {
+		if p.Threshold != threshold || p.NumParties != numParties {
+			return nil, errors.New("partial decryptions use different sharings")
+		}
+
+		if p.Index < 1 || p.Index > numParties || len(p.Slots) != len(res.Slots) {
+			return nil, errors.New("invalid partial decryption")
+		}
+
+		for j := 0; j < i; j++ {
+			if indices[j] == p.Index {
+				return nil, errors.New("duplicate partial decryption")
+			}
+		}
+		indices[i] = p.Index
+	}
+
+	n := res.Pk.N
+	n2 := new(gmp.Int).Mul(n, n)
+	delta := thresholdDelta(numParties)
+	deltaInv := new(gmp.Int).ModInverse(delta, n)
+
+	// integer Lagrange coefficients delta * lambda_{0,i}
+	coeffs := make([]*gmp.Int, threshold)
+	for i := range coeffs {
+		num := new(gmp.Int).Set(delta)
+		den := gmp.NewInt(1)
+		for j := range indices {
+			if j == i {
+				continue
+			}
+			num.Mul(num, gmp.NewInt(int64(indices[j])))
+			den.Mul(den, gmp.NewInt(int64(indices[j]-indices[i])))
+		}
+		coeffs[i] = num.Quo(num, den)
+	}
+
+	slots := make([]*Slot, len(res.Slots))
+	for i, eslot := range res.Slots {
+		arr := make([]*gmp.Int, len(eslot.Cts))
+		for j := range eslot.Cts {
+
+			// c^(delta * d) = 1 + delta * m * N
+			acc := gmp.NewInt(1)
+			for k, p := range partials {
+				if len(p.Slots[i]) != len(eslot.Cts) {
+					return nil, errors.New("invalid partial decryption")
+				}
+
+				base := p.Slots[i][j]
+				exp := coeffs[k]
+				if exp.Sign() < 0 {
+					base = new(gmp.Int).ModInverse(base, n2)
+					exp = new(gmp.Int).Neg(exp)
+				}
+
+				acc.Mul(acc, new(gmp.Int).Exp(base, exp, n2))
+				acc.Mod(acc, n2)
+			}
+
+			m := acc.Sub(acc, gmp.NewInt(1))
+			m.Quo(m, n)
+			m.Mul(m, deltaInv)
+			arr[j] = m.Mod(m, n)
+		}
+
+		slots[i] = NewSlotFromGmpIntArray(arr, res.SlotBytes, res.NumBytesPerCiphertext)
+	}
+
+	return slots, nil
+}
+
+// thresholdDelta returns numParties!
+func thresholdDelta(numParties int) *gmp.Int {
+
+	delta := gmp.NewInt(1)
+	for i := 2; i <= numParties; i++ {
+		delta.Mul(delta, gmp.NewInt(int64(i)))
+	}
+
+	return delta
+}
+
+// thresholdRandomInt returns a uniformly random integer in [0, max)
+func thresholdRandomInt(max *gmp.Int) (*gmp.Int, error) {
+
+	// sample with 128 extra bits so that the bias is negligible
+	buf := make([]byte, len(max.Bytes())+16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	r := new(gmp.Int).SetBytes(buf)
+	return r.Mod(r, max), nil
+}
@@ -0,0 +1,59 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestThresholdDecryption' to see log outputs.
+func TestThresholdDecryption(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	shares, err := NewThresholdKeyShares(sk, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < NumQueries/10; i++ {
+		groupSize := MinGroupSize + rand.Intn(MaxGroupSize-MinGroupSize)
+		_, dimHeight := db.GetDimentionsForDatabase(TestDBHeight, groupSize)
+		qIndex := rand.Intn(dimHeight)
+
+		query := db.NewEncryptedQuery(pk, groupSize, qIndex)
+		response, err := db.PrivateEncryptedQuery(query, NumProcsForQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := recoverEncrypted(t, response, sk)
+
+		// any two of the three custodians can decrypt
+		for _, pair := range [][2]int{{0, 1}, {0, 2}, {2, 1}} {
+			partials := []*PartialDecryption{
+				shares[pair[0]].PartialDecrypt(response),
+				shares[pair[1]].PartialDecrypt(response),
+			}
+
+			res, err := RecoverEncryptedThreshold(response, partials)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for j := range expected {
+				if !expected[j].Equal(res[j]) {
+					t.Fatalf("Threshold decryption is incorrect. %v != %v\n", expected[j], res[j])
+				}
+			}
+		}
+
+		partials := []*PartialDecryption{shares[0].PartialDecrypt(response)}
+		if _, err := RecoverEncryptedThreshold(response, partials); err == nil {
+			t.Fatalf("Decrypted with fewer partial decryptions than the threshold")
+		}
+	}
+}
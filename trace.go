@@ -0,0 +1,117 @@
+package pir
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+/*
+ Anonymized query traces.
+ Operators can opt in to sampling a fraction of the queries answered
+ through the scheme dispatcher (see AnswerSharedQuery and
+ AnswerEncryptedQuery) into a fixed-size ring buffer for performance
+ debugging in production. A trace only holds public parameters of the
+ query (scheme and sizes) and its timing: key material, ciphertexts,
+ attribute masks and anything identifying the client are never
+ recorded, and timestamps are truncated to the second so that traces
+ cannot be joined with network logs.
+*/
+
+// QueryTraceResolution is the resolution of the timestamps of query traces
+const QueryTraceResolution = time.Second
+
+// QueryTrace is the anonymized metadata of an answered query
+type QueryTrace struct {
+	Time      time.Time // truncated to QueryTraceResolution
+	Scheme    Scheme
+	Encrypted bool // encrypted (rather than secret shared) query
+	GroupSize int
+	DBSize    int
+	SlotBytes int
+	NumProcs  int
+	Duration  time.Duration
+	Failed    bool // the query was rejected or failed
+}
+
+// QueryTracer samples query traces into a ring buffer
+type QueryTracer struct {
+	mu     sync.Mutex
+	rate   float64
+	rng    *rand.Rand
+	traces []QueryTrace // ring buffer
+	next   int          // position of the next trace
+	full   bool
+}
+
+// NewQueryTracer returns a tracer keeping the last capacity sampled traces.
+// Each query is sampled with probability rate (between 0 and 1)
+func NewQueryTracer(capacity int, rate float64) *QueryTracer {
+
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &QueryTracer{
+		rate:   rate,
+		rng:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		traces: make([]QueryTrace, capacity),
+	}
+}
+
+// SetQueryTracer starts sampling the queries answered by the dispatcher into t
+// (nil stops sampling)
+func (db *Database) SetQueryTracer(t *QueryTracer) {
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.tracer = t
+}
+
+// Traces returns the sampled traces from oldest to newest
+func (t *QueryTracer) Traces() []QueryTrace {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.full {
+		return append([]QueryTrace{}, t.traces[:t.next]...)
+	}
+
+	traces := append([]QueryTrace{}, t.traces[t.next:]...)
+	return append(traces, t.traces[:t.next]...)
+}
+
+// Reset discards the sampled traces
+func (t *QueryTracer) Reset() {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.next, t.full = 0, false
+}
+
+// sample records the trace of a query that started at start with probability t.rate
+func (t *QueryTracer) sample(trace QueryTrace, start time.Time) {
+
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.rate <= 0 || (t.rate < 1 && t.rng.Float64() >= t.rate) {
+		return
+	}
+
+	trace.Time = start.Truncate(QueryTraceResolution)
+	trace.Duration = time.Since(start)
+
+	t.traces[t.next] = trace
+	t.next++
+	if t.next == len(t.traces) {
+		t.next, t.full = 0, true
+	}
+}
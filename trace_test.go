@@ -0,0 +1,73 @@
+package pir
+
+import (
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestQueryTracer' to see log outputs.
+func TestQueryTracer(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	groupSize := 2
+
+	tracer := NewQueryTracer(3, 1)
+	db.SetQueryTracer(tracer)
+
+	for i := 0; i < 4; i++ {
+		shares := db.NewIndexQueryShares(i, groupSize, 2)
+		if _, err := db.AnswerSharedQuery(shares[0], NumProcsForQuery); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, pk := paillier.KeyGen(128)
+	query := db.NewEncryptedQuery(pk, groupSize, 0)
+	if _, err := db.AnswerEncryptedQuery(query, NumProcsForQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// the buffer keeps the last 3 traces, oldest first
+	traces := tracer.Traces()
+	if len(traces) != 3 {
+		t.Fatalf("Got %v traces instead of 3", len(traces))
+	}
+
+	for i, trace := range traces {
+		t.Logf("%+v\n", trace)
+
+		if trace.GroupSize != groupSize || trace.DBSize != db.DBSize || trace.Failed {
+			t.Fatalf("Trace %v is incorrect: %+v", i, trace)
+		}
+		if trace.Time.Nanosecond() != 0 || trace.Duration <= 0 {
+			t.Fatalf("Trace %v has incorrect timings: %+v", i, trace)
+		}
+	}
+
+	if traces[1].Encrypted || !traces[2].Encrypted || traces[2].Scheme != SchemeAHEPaillierV1 {
+		t.Fatalf("Traces are not in order: %+v", traces)
+	}
+
+	// rejected queries are traced as failed
+	tracer.Reset()
+	shares := db.NewIndexQueryShares(0, groupSize, 2)
+	shares[0].Scheme = "unknown"
+	if _, err := db.AnswerSharedQuery(shares[0], NumProcsForQuery); err == nil {
+		t.Fatalf("Answered a query with an unknown scheme")
+	}
+	if traces = tracer.Traces(); len(traces) != 1 || !traces[0].Failed {
+		t.Fatalf("Failed query was not traced: %+v", traces)
+	}
+
+	// nothing is sampled at rate zero or after removing the tracer
+	db.SetQueryTracer(NewQueryTracer(3, 0))
+	db.AnswerSharedQuery(db.NewIndexQueryShares(0, groupSize, 2)[0], NumProcsForQuery)
+	db.SetQueryTracer(nil)
+	db.AnswerSharedQuery(db.NewIndexQueryShares(0, groupSize, 2)[0], NumProcsForQuery)
+
+	if traces = tracer.Traces(); len(traces) != 1 {
+		t.Fatalf("Got %v traces instead of 1", len(traces))
+	}
+}
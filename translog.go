@@ -0,0 +1,225 @@
+package pir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+ Databases of authenticated append-only logs.
+ A transparency log (e.g., Certificate Transparency or a key transparency
+ log) publishes signed tree heads: the size and the Merkle root of its
+ entries (RFC 6962 / RFC 9162 trees). BuildFromLog stores each entry
+ with its inclusion proof in the tree of a tree head, so a client that
+ retrieves an entry privately (with any query) verifies it against a
+ tree head it trusts (see VerifyLogSlot) without revealing the entry to
+ the log or to the servers. The signature of the tree head is checked by
+ the client with the library of the log; the tree head of the database
+ (LogTree in the metadata) only says which tree head to fetch. The
+ servers must rebuild the database when the log grows, since the proofs
+ are for a fixed tree size (the slots cannot be updated or appended to).
+*/
+
+// logLeafPrefix is the domain separation byte of RFC 6962 leaf hashes
+// (interior nodes are hashed with merkleNode)
+const logLeafPrefix = 0x00
+
+// logHeaderBytes is the size of the entry length, leaf index and tree size of a log slot
+const logHeaderBytes = 4 + 2*8
+
+// ErrLogProof is returned when the inclusion proof of an entry does not verify
+// against the tree head
+var ErrLogProof = errors.New("log entry is not included in the tree head -- server likely cheating")
+
+// LogTreeHead is the size and the root hash of a log tree
+type LogTreeHead struct {
+	TreeSize uint64
+	RootHash []byte
+}
+
+// LogInclusionProof is the audit path of a leaf in a log tree
+type LogInclusionProof struct {
+	LeafIndex uint64
+	TreeSize  uint64
+	Hashes    [][]byte
+}
+
+// LogEntry is an entry retrieved from a log database
+type LogEntry struct {
+	LeafIndex uint64
+	Data      []byte
+}
+
+// BuildFromLog constructs a PIR database holding the entries of a log, the i-th slot
+// holding the i-th entry and its inclusion proof. The proofs must be for the same
+// tree head, which is set as the LogTree of the metadata
+func (db *Database) BuildFromLog(entries [][]byte, proofs []*LogInclusionProof) error {
+
+	if len(entries) == 0 {
+		return errors.New("log has no entries")
+	}
+
+	if len(proofs) != len(entries) {
+		return fmt.Errorf("expected %v inclusion proofs, got %v", len(entries), len(proofs))
+	}
+
+	var head *LogTreeHead
+	data := make([][]byte, len(entries))
+
+	for i, entry := range entries {
+		proof := proofs[i]
+		if proof == nil {
+			return fmt.Errorf("entry %v has no inclusion proof", i)
+		}
+
+		root, err := logRootFromProof(logLeafHash(entry), proof)
+		if err != nil {
+			return fmt.Errorf("entry %v: %w", i, err)
+		}
+
+		if head == nil {
+			head = &LogTreeHead{TreeSize: proof.TreeSize, RootHash: root}
+		} else if proof.TreeSize != head.TreeSize || !bytes.Equal(root, head.RootHash) {
+			return fmt.Errorf("entry %v is proven against a different tree head", i)
+		}
+
+		data[i] = encodeLogEntry(entry, proof)
+	}
+
+	contents, err := binaryContents(data, GetRequiredLengthPrefixedSlotSize(data))
+	if err != nil {
+		return err
+	}
+
+	contents.logTree = head
+	db.install(contents)
+
+	return nil
+}
+
+// VerifyLogSlot checks the inclusion proof of a slot retrieved from a log database against
+// the tree head (whose signature the caller verified) and returns the entry.
+// Returns ErrLogProof if the proof does not verify
+func (dbmd *DBMetadata) VerifyLogSlot(slot *Slot, head *LogTreeHead) (*LogEntry, error) {
+
+	if dbmd.LogTree == nil {
+		return nil, errors.New("metadata does not describe a log database")
+	}
+
+	if head.TreeSize != dbmd.LogTree.TreeSize {
+		return nil, fmt.Errorf("database holds a tree of size %v, not %v", dbmd.LogTree.TreeSize, head.TreeSize)
+	}
+
+	data, err := dbmd.DecodeSlot(slot)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, proof, err := decodeLogEntry(data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := logRootFromProof(logLeafHash(entry), proof)
+	if err != nil || proof.TreeSize != head.TreeSize || !bytes.Equal(root, head.RootHash) {
+		return nil, ErrLogProof
+	}
+
+	return &LogEntry{LeafIndex: proof.LeafIndex, Data: entry}, nil
+}
+
+// encodeLogEntry encodes the entry followed by its inclusion proof
+func encodeLogEntry(entry []byte, proof *LogInclusionProof) []byte {
+
+	buf := make([]byte, logHeaderBytes, logHeaderBytes+len(entry)+len(proof.Hashes)*merkleHashBytes)
+	binary.BigEndian.PutUint32(buf, uint32(len(entry)))
+	binary.BigEndian.PutUint64(buf[4:], proof.LeafIndex)
+	binary.BigEndian.PutUint64(buf[12:], proof.TreeSize)
+
+	buf = append(buf, entry...)
+	for _, hash := range proof.Hashes {
+		buf = append(buf, hash...)
+	}
+
+	return buf
+}
+
+// decodeLogEntry decodes an entry encoded by encodeLogEntry
+func decodeLogEntry(buf []byte) ([]byte, *LogInclusionProof, error) {
+
+	if len(buf) < logHeaderBytes {
+		return nil, nil, errors.New("log slot is too short")
+	}
+
+	n := int(binary.BigEndian.Uint32(buf))
+	proof := &LogInclusionProof{
+		LeafIndex: binary.BigEndian.Uint64(buf[4:]),
+		TreeSize:  binary.BigEndian.Uint64(buf[12:]),
+	}
+
+	rest := buf[logHeaderBytes:]
+	if n > len(rest) || (len(rest)-n)%merkleHashBytes != 0 {
+		return nil, nil, errors.New("malformed log slot")
+	}
+
+	for path := rest[n:]; len(path) > 0; path = path[merkleHashBytes:] {
+		proof.Hashes = append(proof.Hashes, path[:merkleHashBytes])
+	}
+
+	return rest[:n], proof, nil
+}
+
+// logLeafHash returns the RFC 6962 hash of the leaf of an entry
+func logLeafHash(entry []byte) []byte {
+
+	buf := make([]byte, 0, 1+len(entry))
+	buf = append(buf, logLeafPrefix)
+	buf = append(buf, entry...)
+
+	res := sha256.Sum256(buf)
+	return res[:]
+}
+
+// logRootFromProof returns the root of the tree computed from the hash of a leaf and
+// its inclusion proof (RFC 9162, section 2.1.3.2)
+func logRootFromProof(leaf []byte, proof *LogInclusionProof) ([]byte, error) {
+
+	if proof.LeafIndex >= proof.TreeSize {
+		return nil, errors.New("leaf index is outside of the tree")
+	}
+
+	fn, sn := proof.LeafIndex, proof.TreeSize-1
+	hash := leaf
+
+	for _, sibling := range proof.Hashes {
+		if len(sibling) != merkleHashBytes {
+			return nil, errors.New("malformed inclusion proof hash")
+		}
+
+		if sn == 0 {
+			return nil, errors.New("inclusion proof is too long")
+		}
+
+		if fn&1 == 1 || fn == sn {
+			hash = merkleNode(sibling, hash)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			hash = merkleNode(hash, sibling)
+		}
+
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 {
+		return nil, errors.New("inclusion proof is too short")
+	}
+
+	return hash, nil
+}
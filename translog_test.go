@@ -0,0 +1,118 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// testLogRoot returns the RFC 6962 Merkle tree hash of the leaves
+func testLogRoot(leaves [][]byte) []byte {
+
+	if len(leaves) == 1 {
+		return logLeafHash(leaves[0])
+	}
+
+	k := testLogSplit(len(leaves))
+	return merkleNode(testLogRoot(leaves[:k]), testLogRoot(leaves[k:]))
+}
+
+// testLogPath returns the RFC 6962 audit path of the m-th leaf
+func testLogPath(m int, leaves [][]byte) [][]byte {
+
+	if len(leaves) == 1 {
+		return nil
+	}
+
+	k := testLogSplit(len(leaves))
+	if m < k {
+		return append(testLogPath(m, leaves[:k]), testLogRoot(leaves[k:]))
+	}
+
+	return append(testLogPath(m-k, leaves[k:]), testLogRoot(leaves[:k]))
+}
+
+// testLogSplit returns the largest power of two smaller than n
+func testLogSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func TestBuildFromLog(t *testing.T) {
+
+	for _, treeSize := range []int{1, 2, 7, 64, 100} {
+		log := make([][]byte, treeSize)
+		for i := range log {
+			log[i] = []byte(fmt.Sprintf("entry %v", i))
+		}
+
+		head := &LogTreeHead{TreeSize: uint64(treeSize), RootHash: testLogRoot(log)}
+
+		// the database holds a subset of the entries of the log
+		var entries [][]byte
+		var proofs []*LogInclusionProof
+		for i := 0; i < treeSize; i += 1 + rand.Intn(3) {
+			entries = append(entries, log[i])
+			proofs = append(proofs, &LogInclusionProof{
+				LeafIndex: uint64(i),
+				TreeSize:  uint64(treeSize),
+				Hashes:    testLogPath(i, log),
+			})
+		}
+
+		db := NewDatabase()
+		if err := db.BuildFromLog(entries, proofs); err != nil {
+			t.Fatal(err)
+		}
+
+		if db.LogTree.TreeSize != head.TreeSize || string(db.LogTree.RootHash) != string(head.RootHash) {
+			t.Fatalf("database is built for the wrong tree head")
+		}
+
+		md := db.Metadata()
+		for i := range entries {
+			slot, err := retrieveSlot(db, md, i, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := md.VerifyLogSlot(slot, head)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(entry.Data) != string(entries[i]) || entry.LeafIndex != proofs[i].LeafIndex {
+				t.Fatalf("entry %v recovered incorrectly", i)
+			}
+		}
+
+		// entries do not verify against the tree head of another log
+		if len(entries) > 1 {
+			if _, err := md.VerifyLogSlot(db.Slots[1], &LogTreeHead{TreeSize: head.TreeSize, RootHash: make([]byte, 32)}); !errors.Is(err, ErrLogProof) {
+				t.Fatalf("expected ErrLogProof, got %v", err)
+			}
+		}
+	}
+}
+
+func TestBuildFromLogMismatchedProofs(t *testing.T) {
+
+	log := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	proofs := []*LogInclusionProof{
+		{LeafIndex: 0, TreeSize: 3, Hashes: testLogPath(0, log)},
+		{LeafIndex: 1, TreeSize: 2, Hashes: testLogPath(1, log[:2])},
+	}
+
+	if err := NewDatabase().BuildFromLog(log[:2], proofs); err == nil {
+		t.Fatalf("built a database from proofs for different tree heads")
+	}
+
+	proofs[1] = &LogInclusionProof{LeafIndex: 1, TreeSize: 3, Hashes: testLogPath(2, log)}
+	if err := NewDatabase().BuildFromLog(log[:2], proofs); err == nil {
+		t.Fatalf("built a database from an invalid proof")
+	}
+}
@@ -0,0 +1,128 @@
+package pir
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+)
+
+/*
+ Transports.
+ The privacy of the scheme relies on each query share reaching the
+ intended server (and only that server) over an authenticated channel.
+ A Transport connects clients and servers; the TLS transports require
+ TLS 1.2 or later and optionally pin the public keys of the servers
+ and authenticate the clients (mTLS) so that deployments do not run
+ over plaintext TCP by accident.
+ Queries and results are exchanged over a transport by the servers and
+ client stubs of package rpc.
+*/
+
+// Transport connects clients to servers
+type Transport interface {
+	Dial(ctx context.Context, addr string) (net.Conn, error)
+	Listen(addr string) (net.Listener, error)
+}
+
+// ErrServerKeyNotPinned is returned when the public key of a server does not match any pin
+var ErrServerKeyNotPinned = errors.New("server public key is not pinned")
+
+// TLSTransport is a Transport over TLS
+type TLSTransport struct {
+	Config *tls.Config
+}
+
+// Dial connects to the server at addr and completes the handshake
+func (t *TLSTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	dialer := &tls.Dialer{Config: t.Config}
+	return dialer.DialContext(ctx, "tcp", addr)
+}
+
+// Listen accepts TLS connections on addr
+func (t *TLSTransport) Listen(addr string) (net.Listener, error) {
+	return tls.Listen("tcp", addr, t.Config)
+}
+
+// NewServerTLSTransport returns a transport for a server with the certificate.
+// If clientCAs is not nil clients must present a certificate signed by one of them (mTLS)
+func NewServerTLSTransport(cert tls.Certificate, clientCAs *x509.CertPool) *TLSTransport {
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if clientCAs != nil {
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &TLSTransport{Config: config}
+}
+
+// NewClientTLSTransport returns a transport for a client that verifies the servers using roots
+// (the system roots if nil). If pins is not empty the public key of the server must also have
+// one of the pinned hashes (see PublicKeyPin). The client certificate is presented to servers
+// requiring mTLS (optional)
+func NewClientTLSTransport(roots *x509.CertPool, clientCert *tls.Certificate, pins ...[sha256.Size]byte) *TLSTransport {
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+	}
+
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{*clientCert}
+	}
+
+	if len(pins) > 0 {
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return ErrServerKeyNotPinned
+			}
+
+			pin := PublicKeyPin(state.PeerCertificates[0])
+			for _, p := range pins {
+				if p == pin {
+					return nil
+				}
+			}
+
+			return ErrServerKeyNotPinned
+		}
+	}
+
+	return &TLSTransport{Config: config}
+}
+
+// PublicKeyPin returns the pin of the certificate (the SHA-256 hash of its public key info)
+func PublicKeyPin(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+}
+
+// RemoteError is returned by a client when the server fails to answer a query.
+// It matches (using errors.Is) the sentinel error returned by the server if any
+type RemoteError struct {
+	Addr    string
+	Message string
+
+	sentinel error
+}
+
+func (e *RemoteError) Error() string {
+	return "server " + e.Addr + ": " + e.Message
+}
+
+// Is reports whether target is the sentinel error returned by the server
+func (e *RemoteError) Is(target error) bool {
+	return e.sentinel != nil && target == e.sentinel
+}
+
+// NewRemoteError returns the error reported by the server at addr.
+// The error matches sentinel (if not nil) using errors.Is
+func NewRemoteError(addr, message string, sentinel error) *RemoteError {
+	return &RemoteError{Addr: addr, Message: message, sentinel: sentinel}
+}
@@ -0,0 +1,129 @@
+package pir
+
+import (
+	"errors"
+)
+
+/*
+ Verifiable three-server variant of secret shared PIR
+*/
+
+// NumVerifiableServers is the number of servers in the verifiable scheme
+const NumVerifiableServers = 3
+
+// verifiablePairs lists the two servers sharing each two-party DPF key pair
+var verifiablePairs = [NumVerifiableServers][2]int{{0, 1}, {0, 2}, {1, 2}}
+
+// VerifiableQueryShare is the query sent to one of three servers.
+// The client generates one two-party query per pair of servers
+// such that any two servers can reconstruct the result while
+// the third acts as a consistency check on the other two.
+// Each server holds shares of the two pairs it belongs to (the other entry is nil)
+type VerifiableQueryShare struct {
+	Shares [NumVerifiableServers]*QueryShare
+}
+
+// VerifiableQueryResult contains the result shares for each pair of servers
+type VerifiableQueryResult struct {
+	Shares [NumVerifiableServers]*SecretSharedQueryResult
+}
+
+// ErrInconsistentResults is returned by RecoverVerifiable when the
+// reconstructions from different pairs of servers do not agree.
+// A single misbehaving server can always corrupt both pairs it belongs to,
+// so the results cannot be attributed to a specific server
+var ErrInconsistentResults = errors.New("result shares are inconsistent -- a server is likely cheating")
+
+// NewIndexVerifiableQueryShares generates PIR query shares for the index
+// to be sent to three servers (one share per server)
+func (dbmd *DBMetadata) NewIndexVerifiableQueryShares(index int, groupSize int) []*VerifiableQueryShare {
+
+	shares := make([]*VerifiableQueryShare, NumVerifiableServers)
+	for i := range shares {
+		shares[i] = &VerifiableQueryShare{}
+	}
+
+	// independent keys for each pair so that no server
+	// holds two shares of the same point function
+	for pair, servers := range verifiablePairs {
+		pairShares := dbmd.NewIndexQueryShares(index, groupSize, 2)
+		shares[servers[0]].Shares[pair] = pairShares[0]
+		shares[servers[1]].Shares[pair] = pairShares[1]
+	}
+
+	return shares
+}
+
+// PrivateVerifiableSecretSharedQuery answers each of the query shares
+// held by the server
+func (db *Database) PrivateVerifiableSecretSharedQuery(query *VerifiableQueryShare, nprocs int) (*VerifiableQueryResult, error) {
+
+	// answer all shares over the same epoch
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	res := &VerifiableQueryResult{}
+	for pair, share := range query.Shares {
+		if share == nil {
+			continue
+		}
+
+		pairRes, err := db.privateSecretSharedQuery(share, nprocs)
+		if err != nil {
+			return nil, err
+		}
+
+		res.Shares[pair] = pairRes
+	}
+
+	return res, nil
+}
+
+// RecoverVerifiable recovers the slots using each pair of servers
+// and returns ErrInconsistentResults if the reconstructions differ.
+// resShares must be ordered by server
+func RecoverVerifiable(resShares []*VerifiableQueryResult) ([]*Slot, error) {
+
+	if len(resShares) != NumVerifiableServers {
+		return nil, errors.New("verifiable recovery requires exactly three result shares")
+	}
+
+	var recovered [NumVerifiableServers][]*Slot
+	for pair, servers := range verifiablePairs {
+		a := resShares[servers[0]].Shares[pair]
+		b := resShares[servers[1]].Shares[pair]
+		if a == nil || b == nil {
+			return nil, errors.New("missing result share for server pair")
+		}
+
+		if len(a.Shares) != len(b.Shares) || a.SlotBytes != b.SlotBytes {
+			return nil, errors.New("result shares have mismatched sizes")
+		}
+
+		recovered[pair] = Recover([]*SecretSharedQueryResult{a, b})
+	}
+
+	// a single misbehaving server corrupts at most two of the three reconstructions
+	for pair := 1; pair < NumVerifiableServers; pair++ {
+		if !slotsEqual(recovered[0], recovered[pair]) {
+			return nil, ErrInconsistentResults
+		}
+	}
+
+	return recovered[0], nil
+}
+
+func slotsEqual(a, b []*Slot) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,82 @@
+package pir
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// run with 'go test -v -run TestVerifiableSharedQuery' to see log outputs.
+func TestVerifiableSharedQuery(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for groupSize := MinGroupSize; groupSize < MaxGroupSize; groupSize++ {
+
+		dimHeight := TestDBSize / groupSize
+
+		for i := 0; i < NumQueries; i++ {
+			qIndex := rand.Intn(dimHeight)
+			shares := db.NewIndexVerifiableQueryShares(qIndex, groupSize)
+
+			results := make([]*VerifiableQueryResult, len(shares))
+			for s := range shares {
+				res, err := db.PrivateVerifiableSecretSharedQuery(shares[s], NumProcsForQuery)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				results[s] = res
+			}
+
+			res, err := RecoverVerifiable(results)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+
+			for j := 0; j < groupSize; j++ {
+				index := qIndex*groupSize + j
+				if index >= db.DBSize {
+					break
+				}
+
+				if !db.Slots[index].Equal(res[j]) {
+					t.Fatalf("Query result is incorrect. %v != %v\n", db.Slots[index], res[j])
+				}
+			}
+		}
+	}
+}
+
+// run with 'go test -v -run TestVerifiableSharedQueryDetectsCheating' to see log outputs.
+func TestVerifiableSharedQueryDetectsCheating(t *testing.T) {
+	setup()
+
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+
+	for i := 0; i < NumQueries; i++ {
+		qIndex := rand.Intn(TestDBSize)
+		shares := db.NewIndexVerifiableQueryShares(qIndex, 1)
+
+		results := make([]*VerifiableQueryResult, len(shares))
+		for s := range shares {
+			res, err := db.PrivateVerifiableSecretSharedQuery(shares[s], NumProcsForQuery)
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			results[s] = res
+		}
+
+		// a cheating server corrupts one of its result shares
+		cheater := results[rand.Intn(NumVerifiableServers)]
+		for _, share := range cheater.Shares {
+			if share != nil {
+				XorSlots(share.Shares[0], NewRandomSlot(SlotBytes))
+				break
+			}
+		}
+
+		if _, err := RecoverVerifiable(results); err != ErrInconsistentResults {
+			t.Fatalf("Corrupted result share was not detected")
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package pir
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+/*
+ Private retrieval of the latest version of an item.
+ Versions are appended to a versions database and a heads database
+ holds, for each item, a pointer to its latest version. GetLatest
+ retrieves the pointer and then the version with two PIR queries, so
+ the servers only ever see one query to each database regardless of
+ the item or of how many versions it has.
+*/
+
+// versionHeaderBytes is the size of the (id, version) header of a version slot
+const versionHeaderBytes = 16
+
+// headSlotBytes is the size of a head pointer: (index in the versions database, version)
+const headSlotBytes = 16
+
+// ErrNoVersions is returned by GetLatest for items without versions
+var ErrNoVersions = errors.New("item has no versions")
+
+// ErrStaleVersions is returned by GetLatest when the retrieved version does not match
+// the head pointer (the databases were answered from different states)
+var ErrStaleVersions = errors.New("retrieved version does not match the head pointer")
+
+// VersionedDB is a pair of databases: Heads, with one head pointer per item,
+// and Versions, with every version appended so far.
+// Index 0 of Versions is a dummy slot so that both queries are always issued
+type VersionedDB struct {
+	Heads     *Database
+	Versions  *Database
+	DataBytes int // maximum size of the data of a version
+
+	mu sync.Mutex // serializes appends
+}
+
+// VersionedMetadata is a consistent snapshot of the metadata of a VersionedDB
+type VersionedMetadata struct {
+	Heads     DBMetadata
+	Versions  DBMetadata
+	DataBytes int
+}
+
+// QuerySharesFunc sends one query share to each server and returns their results (in order)
+type QuerySharesFunc func(shares []*QueryShare) ([]*SecretSharedQueryResult, error)
+
+// NewVersionedDB returns a VersionedDB for numItems items (without versions)
+// storing up to dataBytes of data per version
+func NewVersionedDB(numItems, dataBytes int) *VersionedDB {
+
+	heads := NewDatabase()
+	heads.Slots = make([]*Slot, numItems)
+	for i := range heads.Slots {
+		heads.Slots[i] = NewEmptySlot(headSlotBytes)
+	}
+	heads.SlotBytes = headSlotBytes
+	heads.DBSize = numItems
+
+	versions := NewDatabase()
+	versions.Slots = []*Slot{NewEmptySlot(versionHeaderBytes + LengthPrefixBytes + dataBytes)}
+	versions.SlotBytes = versionHeaderBytes + LengthPrefixBytes + dataBytes
+	versions.DBSize = 1
+
+	return &VersionedDB{
+		Heads:     heads,
+		Versions:  versions,
+		DataBytes: dataBytes,
+	}
+}
+
+// Append adds a new version of the item and returns its version number.
+// Version numbers of an item start at 1 and increase monotonically.
+// Each append swaps in new contents (see SwapIn) so queries generated
+// from older metadata are rejected as stale
+func (vdb *VersionedDB) Append(id int, data []byte) (uint64, error) {
+
+	vdb.mu.Lock()
+	defer vdb.mu.Unlock()
+
+	if id < 0 || id >= vdb.Heads.DBSize {
+		return 0, errors.New("item id out of range")
+	}
+
+	if len(data) > vdb.DataBytes {
+		return 0, errors.New("data does not fit in a version")
+	}
+
+	_, prev := decodeHead(vdb.Heads.Slots[id])
+	version := prev + 1
+
+	encoded, err := NewLengthPrefixedSlot(data, LengthPrefixBytes+vdb.DataBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	slot := NewEmptySlot(versionHeaderBytes)
+	binary.BigEndian.PutUint64(slot.Data, uint64(id))
+	binary.BigEndian.PutUint64(slot.Data[8:], version)
+	slot.Data = append(slot.Data, encoded.Data...)
+
+	// queries in progress only read the slots up to the old size
+	index := len(vdb.Versions.Slots)
+	if err := vdb.Versions.SwapIn(append(vdb.Versions.Slots, slot)); err != nil {
+		return 0, err
+	}
+
+	head := NewEmptySlot(headSlotBytes)
+	binary.BigEndian.PutUint64(head.Data, uint64(index))
+	binary.BigEndian.PutUint64(head.Data[8:], version)
+
+	heads := make([]*Slot, len(vdb.Heads.Slots))
+	copy(heads, vdb.Heads.Slots)
+	heads[id] = head
+
+	if err := vdb.Heads.SwapIn(heads); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Metadata returns a consistent snapshot of the metadata of both databases
+func (vdb *VersionedDB) Metadata() *VersionedMetadata {
+
+	vdb.mu.Lock()
+	defer vdb.mu.Unlock()
+
+	return &VersionedMetadata{
+		Heads:     vdb.Heads.Metadata(),
+		Versions:  vdb.Versions.Metadata(),
+		DataBytes: vdb.DataBytes,
+	}
+}
+
+// GetLatest privately retrieves the latest version of the item by first retrieving its
+// head pointer from the heads database and then the version it points to.
+// Both queries are issued even if the item has no versions.
+// Returns the data and the version number
+func (vmd *VersionedMetadata) GetLatest(
+	id int,
+	numShares uint,
+	queryHeads, queryVersions QuerySharesFunc) ([]byte, uint64, error) {
+
+	if id < 0 || id >= vmd.Heads.DBSize {
+		return nil, 0, errors.New("item id out of range")
+	}
+
+	headRes, err := queryHeads(vmd.Heads.NewIndexQueryShares(id, 1, numShares))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	index, version := decodeHead(Recover(headRes)[0])
+	if index >= uint64(vmd.Versions.DBSize) {
+		return nil, 0, ErrStaleVersions
+	}
+
+	// index 0 is the dummy slot for items without versions
+	versionRes, err := queryVersions(vmd.Versions.NewIndexQueryShares(int(index), 1, numShares))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version == 0 {
+		return nil, 0, ErrNoVersions
+	}
+
+	slot := Recover(versionRes)[0]
+	if binary.BigEndian.Uint64(slot.Data) != uint64(id) || binary.BigEndian.Uint64(slot.Data[8:]) != version {
+		return nil, 0, ErrStaleVersions
+	}
+
+	data, err := NewSlot(slot.Data[versionHeaderBytes:]).LengthPrefixedData()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return data, version, nil
+}
+
+// decodeHead returns the index and version of a head pointer
+func decodeHead(head *Slot) (uint64, uint64) {
+	return binary.BigEndian.Uint64(head.Data), binary.BigEndian.Uint64(head.Data[8:])
+}
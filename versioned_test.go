@@ -0,0 +1,91 @@
+package pir
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// answerWith returns a QuerySharesFunc answering each share on db (one server per share)
+func answerWith(db *Database) QuerySharesFunc {
+	return func(shares []*QueryShare) ([]*SecretSharedQueryResult, error) {
+		res := make([]*SecretSharedQueryResult, len(shares))
+		for i, share := range shares {
+			var err error
+			if res[i], err = db.PrivateSecretSharedQuery(share, NumProcsForQuery); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+}
+
+// run with 'go test -v -run TestVersionedGetLatest' to see log outputs.
+func TestVersionedGetLatest(t *testing.T) {
+	setup()
+
+	numItems := 50
+	vdb := NewVersionedDB(numItems, SlotBytes)
+
+	latest := make(map[int][]byte)
+	for i := 0; i < 200; i++ {
+		id := rand.Intn(numItems)
+		data := NewRandomSlot(rand.Intn(SlotBytes + 1)).Data
+
+		version, err := vdb.Append(id, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		latest[id] = data
+
+		// spot check the latest version of the item
+		if i%20 == 0 {
+			md := vdb.Metadata()
+			got, v, err := md.GetLatest(id, 2, answerWith(vdb.Heads), answerWith(vdb.Versions))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != version || !bytes.Equal(got, data) {
+				t.Fatalf("Expected version %v (%v) got %v (%v)\n", version, data, v, got)
+			}
+		}
+	}
+
+	md := vdb.Metadata()
+	for id := 0; id < numItems; id++ {
+		for _, numShares := range []uint{2, 3} {
+			got, _, err := md.GetLatest(id, numShares, answerWith(vdb.Heads), answerWith(vdb.Versions))
+
+			expected, ok := latest[id]
+			if !ok {
+				if !errors.Is(err, ErrNoVersions) {
+					t.Fatalf("Expected ErrNoVersions for item %v; got %v\n", id, err)
+				}
+				continue
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, expected) {
+				t.Fatalf("Item %v: expected %v got %v\n", id, expected, got)
+			}
+		}
+	}
+
+	// queries generated before an append are rejected
+	if _, err := vdb.Append(0, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := md.GetLatest(0, 2, answerWith(vdb.Heads), answerWith(vdb.Versions)); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Stale metadata was not rejected: %v\n", err)
+	}
+
+	if _, err := vdb.Append(0, make([]byte, SlotBytes+1)); err == nil {
+		t.Fatalf("Appended data larger than a version")
+	}
+}
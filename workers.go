@@ -0,0 +1,107 @@
+package pir
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+/*
+ Error propagation for query workers.
+ Queries are answered by several worker goroutines. A worker that fails
+ (or panics) must not crash the server: the first failure is recorded,
+ the other workers stop at their next check and the caller gets a
+ single *WorkerError once every worker has returned. Workers also stop
+ when the context of the query is done, so that a caller with a
+ deadline does not wait for a query it has given up on.
+*/
+
+// WorkerError is returned when a worker answering a query fails.
+// Err is the error of the first worker that failed (or recovered from its panic)
+type WorkerError struct {
+	Worker int
+	Err    error
+}
+
+func (e *WorkerError) Error() string {
+	return fmt.Sprintf("query worker %v failed: %v", e.Worker, e.Err)
+}
+
+// Unwrap returns the error of the worker
+func (e *WorkerError) Unwrap() error {
+	return e.Err
+}
+
+// workerGroup runs the workers of a query and keeps the first error
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg   sync.WaitGroup
+	once sync.Once
+	err  error
+}
+
+func newWorkerGroup(ctx context.Context) *workerGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &workerGroup{ctx: ctx, cancel: cancel}
+}
+
+// Go runs f as worker i on the worker pool (see SetWorkerPool) or in a new goroutine.
+// If f returns an error or panics the remaining workers are stopped
+func (g *workerGroup) Go(i int, f func() error) {
+
+	g.wg.Add(1)
+	task := func() {
+		defer g.wg.Done()
+
+		defer func() {
+			if r := recover(); r != nil {
+				g.fail(i, fmt.Errorf("panic: %v", r))
+			}
+		}()
+
+		if err := f(); err != nil {
+			g.fail(i, err)
+		}
+	}
+
+	if pool := sharedWorkerPool(); pool != nil {
+		// the pool is busy: the caller runs the worker
+		if !pool.tryRun(task) {
+			task()
+		}
+		return
+	}
+
+	go task()
+}
+
+// stopped returns true if a worker failed or the context is done;
+// workers check it between units of work
+func (g *workerGroup) stopped() bool {
+	return g.ctx.Err() != nil
+}
+
+// Wait waits for all the workers and returns the first *WorkerError, or the
+// error of the context if it is done
+func (g *workerGroup) Wait() error {
+
+	g.wg.Wait()
+
+	err := g.err
+	if err == nil {
+		err = g.ctx.Err()
+	}
+
+	g.cancel()
+
+	return err
+}
+
+func (g *workerGroup) fail(i int, err error) {
+	g.once.Do(func() {
+		g.err = &WorkerError{Worker: i, Err: err}
+		g.cancel()
+	})
+}
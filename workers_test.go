@@ -0,0 +1,71 @@
+package pir
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/paillier"
+)
+
+// run with 'go test -v -run TestWorkerGroup' to see log outputs.
+func TestWorkerGroup(t *testing.T) {
+
+	failed := errors.New("failed")
+
+	workers := newWorkerGroup(context.Background())
+	workers.Go(0, func() error { return failed })
+	workers.Go(1, func() error {
+		// siblings of a failed worker are stopped
+		for !workers.stopped() {
+		}
+		return nil
+	})
+
+	err := workers.Wait()
+	var workerErr *WorkerError
+	if !errors.As(err, &workerErr) || workerErr.Worker != 0 || !errors.Is(err, failed) {
+		t.Fatalf("Unexpected error %v\n", err)
+	}
+
+	// panics are returned as errors
+	workers = newWorkerGroup(context.Background())
+	workers.Go(3, func() error { panic("conversion failed") })
+
+	if err := workers.Wait(); !errors.As(err, &workerErr) || workerErr.Worker != 3 {
+		t.Fatalf("Unexpected error %v\n", err)
+	}
+
+	t.Logf("Error: %v\n", workerErr)
+}
+
+// run with 'go test -v -run TestEncryptedQueryContext' to see log outputs.
+func TestEncryptedQueryContext(t *testing.T) {
+	setup()
+
+	sk, pk := paillier.KeyGen(128)
+	db := GenerateRandomDB(TestDBSize, SlotBytes)
+	query := db.NewEncryptedQuery(pk, 1, 1)
+
+	res, err := db.PrivateEncryptedQueryContext(context.Background(), query, NumProcsForQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for j, slot := range recoverEncrypted(t, res, sk) {
+		if !slot.Equal(db.Slots[query.DBWidth+j]) {
+			t.Fatalf("Incorrect result for slot %v\n", j)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := db.PrivateEncryptedQueryContext(ctx, query, NumProcsForQuery); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v\n", err)
+	}
+
+	if _, err := db.AnswerEncryptedQueryContext(ctx, query, NumProcsForQuery); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled from the dispatcher, got %v\n", err)
+	}
+}
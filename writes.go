@@ -0,0 +1,198 @@
+package pir
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sachaservan/pir/dpf"
+)
+
+/*
+ Private writes.
+ Clients write into a slot of a table held as XOR shares by two servers
+ without revealing which slot they write to (Riposte: Corrigan-Gibbs,
+ Boneh and Mazieres, S&P 2015). The client generates a pair of DPF keys
+ whose outputs xor to the encoded data at the slot and to zero
+ everywhere else (see NewWriteRequests); each server expands its key
+ over every slot of its share of the table and xors the expansion in,
+ so the shares still xor to the table, with the data written into the
+ slot. Writes to the same slot collide (the slot holds the xor of the
+ data), so clients pick slots at random in tables a few times larger
+ than the number of writes of a round. A malicious client could send
+ keys writing to many slots to jam the table: the keys carry a proof
+ correction word and the servers exchange short proofs of their
+ expansions before applying a write (see PrepareWrite and CommitWrite);
+ proofs that do not match reject the write with ErrMalformedWrite. At
+ the end of a round the servers publish their shares and the table is
+ their xor (see RevealTable).
+*/
+
+// ErrMalformedWrite is returned when the write requests received by the servers do not
+// write to a single slot (or were not generated together)
+var ErrMalformedWrite = errors.New("write requests do not write to a single slot")
+
+// WriteRequest is the share of a private write sent to one of the two servers
+type WriteRequest struct {
+	ServerNumber uint
+	PrfKeys      []*dpf.PrfKey
+	Key          *dpf.Key2P
+
+	// fingerprint of the layout the request was generated for (see Layout)
+	LayoutFingerprint LayoutFingerprint
+}
+
+// PendingWrite is a write request expanded by a server, waiting for the proof of the
+// other server (see CommitWrite)
+type PendingWrite struct {
+	Proof []byte // sent to the other server
+
+	shares      [][]byte // expansion of the key for each slot (in storage order)
+	fingerprint LayoutFingerprint
+}
+
+// NewWriteTable returns a table of numSlots all-zero slots: the share of an empty
+// table held by each server
+func NewWriteTable(numSlots, slotBytes int) *Database {
+
+	db := NewDatabase()
+	db.SlotBytes = slotBytes
+	db.DBSize = numSlots
+	db.Slots = make([]*Slot, numSlots)
+	for i := range db.Slots {
+		db.Slots[i] = NewEmptySlot(slotBytes)
+	}
+
+	return db
+}
+
+// writeLayout returns the layout write requests are generated for
+// (one slot per row of the DPF domain)
+func (dbmd *DBMetadata) writeLayout() LayoutFingerprint {
+	return dbmd.SharedLayout(1).Fingerprint()
+}
+
+// NewWriteRequests generates the write requests writing data (encoded like the other
+// slots) into the slot at the index, one for each of the two servers
+func (dbmd *DBMetadata) NewWriteRequests(index int, data []byte) ([]*WriteRequest, error) {
+
+	if index < 0 || index >= dbmd.DBSize {
+		return nil, fmt.Errorf("index %v is not in the database", index)
+	}
+
+	slot, err := dbmd.encodeSlot(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pf := dpf.ClientInitialize(dbmd.sharedQueryDomainBits(1, false))
+
+	// slots are stored in shuffled order (see ShuffleWithinGroups)
+	keys := pf.GenerateTwoServerPayload(uint(dbmd.storagePosition(index)), slot.Data)
+
+	requests := make([]*WriteRequest, len(keys))
+	for i, key := range keys {
+		requests[i] = &WriteRequest{
+			ServerNumber:      uint(i),
+			PrfKeys:           pf.PrfKeys,
+			Key:               key,
+			LayoutFingerprint: dbmd.writeLayout(),
+		}
+	}
+
+	return requests, nil
+}
+
+// PrepareWrite expands the write request over the slots of the database. The proof of
+// the pending write is sent to the other server and the write is applied once the
+// proof of the other server is received (see CommitWrite)
+func (db *Database) PrepareWrite(req *WriteRequest) (*PendingWrite, error) {
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.KeywordCommitment != nil || db.KeyValue != nil || db.LogTree != nil {
+		return nil, ErrFixedLayout
+	}
+
+	fingerprint := db.writeLayout()
+	if !req.LayoutFingerprint.IsZero() && req.LayoutFingerprint != fingerprint {
+		return nil, ErrStaleLayout
+	}
+
+	if req.Key == nil {
+		return nil, errors.New("write request has no key")
+	}
+
+	numBits := db.sharedQueryDomainBits(1, false)
+	if err := req.Key.CheckDomain(numBits); err != nil {
+		return nil, err
+	}
+
+	shares := make([][]byte, db.DBSize)
+	for i := range shares {
+		shares[i] = make([]byte, db.SlotBytes)
+	}
+
+	pf := dpf.ServerInitialize(req.PrfKeys, numBits)
+	proof, err := pf.EvalFull2PPayloadProof(req.Key, 0, shares)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PendingWrite{Proof: proof, shares: shares, fingerprint: fingerprint}, nil
+}
+
+// CommitWrite applies the pending write if its proof matches the proof of the other
+// server. Returns ErrMalformedWrite (and leaves the database unchanged) otherwise
+func (db *Database) CommitWrite(w *PendingWrite, peerProof []byte) error {
+
+	if !dpf.VerifyProofs(w.Proof, peerProof) {
+		return ErrMalformedWrite
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.writeLayout() != w.fingerprint {
+		return ErrStaleLayout
+	}
+
+	// copied so that snapshots of the slots taken by readers do not change
+	slots := make([]*Slot, len(db.Slots))
+	for i, slot := range db.Slots {
+		slots[i] = NewSlot(append([]byte{}, slot.Data...))
+		XorSlots(slots[i], NewSlot(w.shares[i]))
+	}
+
+	db.Slots = slots
+	db.records = nil // the values of the slots are unknown
+
+	return nil
+}
+
+// RevealTable combines the shares of a table published by the servers into the table
+func RevealTable(shares ...[]*Slot) ([]*Slot, error) {
+
+	if len(shares) == 0 {
+		return nil, errors.New("no shares")
+	}
+
+	table := make([]*Slot, len(shares[0]))
+	for i, slot := range shares[0] {
+		table[i] = NewSlot(append([]byte{}, slot.Data...))
+	}
+
+	for s, share := range shares[1:] {
+		if len(share) != len(table) {
+			return nil, fmt.Errorf("share %v has %v slots instead of %v", s+1, len(share), len(table))
+		}
+		for i, slot := range share {
+			if len(slot.Data) != len(table[i].Data) {
+				return nil, fmt.Errorf("slot %v of share %v has a different size", i, s+1)
+			}
+			XorSlots(table[i], slot)
+		}
+	}
+
+	return table, nil
+}
@@ -0,0 +1,138 @@
+package pir
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/sachaservan/pir/dpf"
+)
+
+// run with 'go test -v -run TestPrivateWrites' to see log outputs.
+func TestPrivateWrites(t *testing.T) {
+	setup()
+
+	numSlots := 50
+	servers := []*Database{NewWriteTable(numSlots, SlotBytes), NewWriteTable(numSlots, SlotBytes)}
+	md := servers[0].Metadata()
+
+	expected := make([]*Slot, numSlots)
+	for i := range expected {
+		expected[i] = NewEmptySlot(SlotBytes)
+	}
+
+	// write sends each request to its server and exchanges the proofs
+	write := func(requests []*WriteRequest) error {
+		pending := make([]*PendingWrite, 2)
+		for i, req := range requests {
+			var err error
+			if pending[i], err = servers[i].PrepareWrite(req); err != nil {
+				return err
+			}
+		}
+
+		for i := range servers {
+			if err := servers[i].CommitWrite(pending[i], pending[1-i].Proof); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, index := range []int{0, 7, 23, numSlots - 1} {
+		data := []byte("msg")
+		data[0] = byte(index)
+
+		requests, err := md.NewWriteRequests(index, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := write(requests); err != nil {
+			t.Fatal(err)
+		}
+
+		expected[index] = NewSlotFromString(string(data), SlotBytes)
+	}
+
+	// a share alone does not reveal the table
+	if servers[0].Slots[7].Equal(expected[7]) {
+		t.Fatalf("Share of a server holds the written data\n")
+	}
+
+	table, err := RevealTable(servers[0].Slots, servers[1].Slots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range table {
+		if !table[i].Equal(expected[i]) {
+			t.Fatalf("Slot %v of the table is incorrect: %v != %v\n", i, table[i], expected[i])
+		}
+	}
+
+	// requests of different writes (writing to two slots) are rejected by both servers
+	a, _ := md.NewWriteRequests(3, []byte("a"))
+	b, _ := md.NewWriteRequests(4, []byte("b"))
+	if err := write([]*WriteRequest{a[0], b[1]}); !errors.Is(err, ErrMalformedWrite) {
+		t.Fatalf("Expected ErrMalformedWrite, got %v\n", err)
+	}
+
+	table, _ = RevealTable(servers[0].Slots, servers[1].Slots)
+	for i := range table {
+		if !table[i].Equal(expected[i]) {
+			t.Fatalf("Rejected write changed slot %v\n", i)
+		}
+	}
+
+	// forged requests writing to every slot (keys with equal seeds and different
+	// t bits at every leaf) are rejected and do not jam the table
+	forge := func(cs []byte) []*WriteRequest {
+		requests, _ := md.NewWriteRequests(0, []byte("x"))
+		honest := requests[0].Key
+
+		cw := make([][]byte, len(honest.CW))
+		for i := range cw {
+			cw[i] = make([]byte, aes.BlockSize+2)
+			cw[i][aes.BlockSize] = 1
+			cw[i][aes.BlockSize+1] = 1
+		}
+
+		for i, req := range requests {
+			req.Key = &dpf.Key2P{
+				SInit:        make([]byte, aes.BlockSize),
+				TInit:        byte(i),
+				CW:           cw,
+				FinalPayload: honest.FinalPayload,
+				CS:           cs,
+			}
+		}
+
+		return requests
+	}
+
+	if err := write(forge(bytes.Repeat([]byte{1}, sha256.Size))); !errors.Is(err, ErrMalformedWrite) {
+		t.Fatalf("Expected ErrMalformedWrite, got %v\n", err)
+	}
+
+	if err := write(forge(make([]byte, sha256.Size))); !errors.Is(err, dpf.ErrKeyDomain) {
+		t.Fatalf("Expected ErrKeyDomain, got %v\n", err)
+	}
+
+	table, _ = RevealTable(servers[0].Slots, servers[1].Slots)
+	for i := range table {
+		if !table[i].Equal(expected[i]) {
+			t.Fatalf("Forged write changed slot %v\n", i)
+		}
+	}
+
+	// requests for another table are stale
+	other := NewWriteTable(numSlots+1, SlotBytes).Metadata()
+	c, _ := other.NewWriteRequests(3, []byte("c"))
+	if _, err := servers[0].PrepareWrite(c[0]); !errors.Is(err, ErrStaleLayout) {
+		t.Fatalf("Expected ErrStaleLayout, got %v\n", err)
+	}
+}